@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a single audit log record, written as one JSON line.
+type Entry struct {
+	Time    time.Time `json:"timestamp"`
+	Client  string    `json:"client"`
+	User    string    `json:"user"`
+	Command string    `json:"command"`
+	Keys    []string  `json:"keys"`
+}
+
+// Logger appends entries to an audit log file, rotating it once it grows
+// beyond maxSize bytes. Rotated files are renamed path.1, path.2, ... and
+// at most maxFiles of them are kept.
+type Logger struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// Open opens the audit log at path for appending. A maxSize of zero
+// disables rotation.
+func Open(path string, maxSize int64, maxFiles int) (*Logger, error) {
+	l := &Logger{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// Log appends an entry to the log.
+func (l *Logger) Log(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files by one, moves the current log to path.1
+// and starts a new one.
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if l.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
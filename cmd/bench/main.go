@@ -0,0 +1,414 @@
+// Command bench measures the throughput and latency of a running server
+// with workloads like those of redis-benchmark: a number of clients send
+// requests, optionally pipelined, and the requests per second and latency
+// percentiles of each test are reported.
+//
+// In the commands, __rand_int__ is replaced with a random 12 digit number
+// below -r, when given, and __data__ with a value of -d bytes. A command
+// given after the flags is run instead of the -t tests.
+//
+// Given several comma separated addresses, each client connects to all of
+// the servers and sends each request to the server its key, the first
+// argument, belongs to by consistent hashing, as twemproxy would; requests
+// without arguments go to a server at random.
+//
+// Usage:
+//
+//	bench [-addr host:port[,host:port...]] [-c clients] [-n requests] [-P pipeline] [-d size]
+//	      [-r keyspace] [-t tests | -mix test:weight,...] [-q] [command args...]
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/ring"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// tests are the workloads selected by -t and -mix, in the order they run.
+var tests = []struct {
+	name string
+	argv []string
+}{
+	{"ping", []string{"PING"}},
+	{"set", []string{"SET", "key:__rand_int__", "__data__"}},
+	{"get", []string{"GET", "key:__rand_int__"}},
+	{"incr", []string{"INCR", "counter:__rand_int__"}},
+	{"lpush", []string{"LPUSH", "mylist", "__data__"}},
+	{"rpush", []string{"RPUSH", "mylist", "__data__"}},
+	{"lpop", []string{"LPOP", "mylist"}},
+	{"rpop", []string{"RPOP", "mylist"}},
+	{"sadd", []string{"SADD", "myset", "element:__rand_int__"}},
+	{"hset", []string{"HSET", "myhash", "element:__rand_int__", "__data__"}},
+	{"spop", []string{"SPOP", "myset"}},
+	{"zadd", []string{"ZADD", "myzset", "0", "element:__rand_int__"}},
+	{"lrange_100", []string{"LRANGE", "mylist", "0", "99"}},
+	{"lrange_600", []string{"LRANGE", "mylist", "0", "599"}},
+}
+
+// lookupTest returns the command of the test with the given name.
+func lookupTest(name string) ([]string, bool) {
+	for _, t := range tests {
+		if t.name == name {
+			return t.argv, true
+		}
+	}
+	return nil, false
+}
+
+// workload is a benchmark run: each request is one of the commands, picked
+// at random by weight.
+type workload struct {
+	name     string
+	commands [][]string
+	weights  []int
+	total    int
+}
+
+// pick returns the index of a command chosen by weight.
+func (w *workload) pick(rnd *rand.Rand) int {
+	if len(w.commands) == 1 {
+		return 0
+	}
+	n := rnd.Intn(w.total)
+	for i, weight := range w.weights {
+		if n < weight {
+			return i
+		}
+		n -= weight
+	}
+	return len(w.commands) - 1
+}
+
+type options struct {
+	ring     *ring.Ring // The servers, with a single one when not sharding
+	clients  int
+	requests int
+	pipeline int
+	keyspace int
+	data     string
+	quiet    bool
+}
+
+// result is what a client measured.
+type result struct {
+	latencies []time.Duration
+	errors    int
+	firstErr  string
+	err       error
+}
+
+func main() {
+	var o options
+	addrs := flag.String("addr", "127.0.0.1:6379", "server address, or comma separated addresses to shard keys over")
+	flag.IntVar(&o.clients, "c", 50, "number of parallel clients")
+	flag.IntVar(&o.requests, "n", 100000, "total number of requests per test")
+	flag.IntVar(&o.pipeline, "P", 1, "requests pipelined per round trip")
+	size := flag.Int("d", 3, "data size in bytes of SET, LPUSH and similar values")
+	flag.IntVar(&o.keyspace, "r", 0, "replace __rand_int__ with random numbers below this, 0 keeps it")
+	testList := flag.String("t", "ping,set,get,incr,lpush,rpush,lpop,rpop,sadd,hset,spop,zadd,lrange_100,lrange_600", "comma separated tests to run")
+	mix := flag.String("mix", "", "run one workload mixing tests by weight, as get:9,set:1")
+	flag.BoolVar(&o.quiet, "q", false, "print only the requests per second and median latency")
+	flag.Parse()
+	if o.clients < 1 || o.requests < 1 || o.pipeline < 1 || *size < 0 {
+		fmt.Fprintln(os.Stderr, "-c, -n and -P must be positive, -d must not be negative")
+		os.Exit(2)
+	}
+	o.data = strings.Repeat("x", *size)
+	o.ring = ring.New(strings.Split(*addrs, ","))
+
+	workloads, err := parseWorkloads(flag.Args(), *testList, *mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	failed := false
+	for _, w := range workloads {
+		if needsList(w) {
+			if err := fillList(o, 600); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		}
+		res, elapsed, err := run(o, w)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		report(o, w, res, elapsed)
+		if res.errors > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseWorkloads returns the workloads to run: the command in args, the
+// mix, or each of the tests.
+func parseWorkloads(args []string, testList, mix string) ([]*workload, error) {
+	if len(args) > 0 {
+		return []*workload{{name: strings.Join(args, " "), commands: [][]string{args}, weights: []int{1}, total: 1}}, nil
+	}
+	if mix != "" {
+		w := &workload{name: "MIX " + mix}
+		for _, part := range strings.Split(mix, ",") {
+			name, weightStr, _ := strings.Cut(part, ":")
+			argv, ok := lookupTest(strings.ToLower(name))
+			if !ok {
+				return nil, fmt.Errorf("unknown test '%s'", name)
+			}
+			weight := 1
+			if weightStr != "" {
+				var err error
+				if weight, err = strconv.Atoi(weightStr); err != nil || weight < 1 {
+					return nil, fmt.Errorf("invalid weight '%s'", weightStr)
+				}
+			}
+			w.commands = append(w.commands, argv)
+			w.weights = append(w.weights, weight)
+			w.total += weight
+		}
+		return []*workload{w}, nil
+	}
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(testList, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := lookupTest(name); !ok {
+			return nil, fmt.Errorf("unknown test '%s'", name)
+		}
+		selected[name] = true
+	}
+	var workloads []*workload
+	for _, t := range tests {
+		if selected[t.name] {
+			workloads = append(workloads, &workload{name: strings.ToUpper(t.name), commands: [][]string{t.argv}, weights: []int{1}, total: 1})
+		}
+	}
+	return workloads, nil
+}
+
+// needsList reports whether w reads ranges of mylist, which must then be
+// filled first.
+func needsList(w *workload) bool {
+	for _, argv := range w.commands {
+		if argv[0] == "LRANGE" && argv[1] == "mylist" {
+			return true
+		}
+	}
+	return false
+}
+
+// fillList pushes n values to mylist, so LRANGE has elements to return.
+func fillList(o options, n int) error {
+	c, err := dial(o.ring.Servers()[o.ring.Server("mylist")])
+	if err != nil {
+		return err
+	}
+	defer c.c.Close()
+	for i := 0; i < n; i++ {
+		c.write([]string{"LPUSH", "mylist", o.data})
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if _, err := resp.ReadResp(c.r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func dial(addr string) (*conn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}, nil
+}
+
+// write buffers argv as a RESP array of bulk strings.
+func (c *conn) write(argv []string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(argv))
+	for _, arg := range argv {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// run runs w with o.clients clients until o.requests requests were answered.
+func run(o options, w *workload) (result, time.Duration, error) {
+	conns := make([][]*conn, o.clients) // Connections of each client, by server
+	defer func() {
+		for _, cs := range conns {
+			for _, c := range cs {
+				c.c.Close()
+			}
+		}
+	}()
+	for i := range conns {
+		for _, addr := range o.ring.Servers() {
+			c, err := dial(addr)
+			if err != nil {
+				return result{}, 0, err
+			}
+			conns[i] = append(conns[i], c)
+		}
+	}
+
+	var remaining atomic.Int64
+	remaining.Store(int64(o.requests))
+	results := make([]result, o.clients)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, cs := range conns {
+		wg.Add(1)
+		go func(i int, cs []*conn) {
+			defer wg.Done()
+			results[i] = runClient(o, w, cs, &remaining, rand.New(rand.NewSource(time.Now().UnixNano()+int64(i))))
+		}(i, cs)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var total result
+	for _, r := range results {
+		if r.err != nil {
+			return result{}, 0, r.err
+		}
+		total.latencies = append(total.latencies, r.latencies...)
+		total.errors += r.errors
+		if total.firstErr == "" {
+			total.firstErr = r.firstErr
+		}
+	}
+	slices.Sort(total.latencies)
+	return total, elapsed, nil
+}
+
+// runClient sends batches of up to o.pipeline requests on cs, the
+// connections to each server, while requests remain, and measures the
+// latency of each from the time its batch was sent.
+func runClient(o options, w *workload, cs []*conn, remaining *atomic.Int64, rnd *rand.Rand) result {
+	var res result
+	argv := make([]string, 0, 32)
+	sentTo := make([]*conn, 0, o.pipeline) // Connection of each request of the batch
+	for {
+		n := int64(o.pipeline)
+		left := remaining.Add(-n)
+		if left+n <= 0 {
+			return res
+		}
+		if left < 0 {
+			n += left
+		}
+		sentTo = sentTo[:0]
+		for i := int64(0); i < n; i++ {
+			argv = expand(argv[:0], w.commands[w.pick(rnd)], o, rnd)
+			c := cs[server(o.ring, argv, rnd)]
+			c.write(argv)
+			sentTo = append(sentTo, c)
+		}
+		sent := time.Now()
+		for _, c := range cs {
+			if err := c.w.Flush(); err != nil {
+				res.err = err
+				return res
+			}
+		}
+		for _, c := range sentTo {
+			reply, err := resp.ReadResp(c.r)
+			if err != nil {
+				res.err = err
+				return res
+			}
+			res.latencies = append(res.latencies, time.Since(sent))
+			if reply.Type == resp.Error {
+				res.errors++
+				if res.firstErr == "" {
+					res.firstErr = reply.Str
+				}
+			}
+		}
+	}
+}
+
+// server returns the index of the server argv is sent to: the one holding
+// its first argument, or one at random for commands without arguments.
+func server(r *ring.Ring, argv []string, rnd *rand.Rand) int {
+	if len(argv) < 2 {
+		return rnd.Intn(len(r.Servers()))
+	}
+	return r.Server(argv[1])
+}
+
+// expand appends cmd to argv with its placeholders replaced.
+func expand(argv, cmd []string, o options, rnd *rand.Rand) []string {
+	for _, arg := range cmd {
+		switch {
+		case arg == "__data__":
+			arg = o.data
+		case o.keyspace > 0 && strings.Contains(arg, "__rand_int__"):
+			arg = strings.ReplaceAll(arg, "__rand_int__", fmt.Sprintf("%012d", rnd.Intn(o.keyspace)))
+		}
+		argv = append(argv, arg)
+	}
+	return argv
+}
+
+// percentile returns the latency below which p percent of the sorted
+// latencies fall.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(latencies))*p/100+0.5) - 1
+	return latencies[min(max(i, 0), len(latencies)-1)]
+}
+
+func msec(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// report prints the results of w.
+func report(o options, w *workload, res result, elapsed time.Duration) {
+	rps := float64(len(res.latencies)) / elapsed.Seconds()
+	if o.quiet {
+		fmt.Printf("%s: %.2f requests per second, p50=%s msec\n", w.name, rps, msec(percentile(res.latencies, 50)))
+	} else {
+		fmt.Printf("====== %s ======\n", w.name)
+		fmt.Printf("  %d requests completed in %.2f seconds\n", len(res.latencies), elapsed.Seconds())
+		fmt.Printf("  %d parallel clients\n", o.clients)
+		if n := len(o.ring.Servers()); n > 1 {
+			fmt.Printf("  %d servers\n", n)
+		}
+		fmt.Printf("  %d bytes payload\n", len(o.data))
+		fmt.Printf("  pipeline %d\n\n", o.pipeline)
+		fmt.Printf("Latency by percentile (msec):\n")
+		for _, p := range []float64{50, 95, 99, 99.9, 100} {
+			fmt.Printf("  %6.2f%% <= %s\n", p, msec(percentile(res.latencies, p)))
+		}
+		fmt.Printf("\nThroughput: %.2f requests per second\n\n", rps)
+	}
+	if res.errors > 0 {
+		fmt.Printf("  %d error replies, the first: %s\n", res.errors, res.firstErr)
+	}
+}
@@ -0,0 +1,539 @@
+// Command cli is a command line client for the server, like redis-cli. With
+// a command as arguments it runs it and prints the reply; otherwise it reads
+// commands from an interactive prompt, keeping their history in
+// ~/.go_redis_cli_history. Replies are formatted as redis-cli does, or
+// printed raw with -raw, the default when the output is not a terminal.
+//
+// With -pipe, the RESP protocol read from stdin is sent to the server as it
+// is, for mass insertion, and the replies counted.
+//
+// Given several comma separated addresses, keys are spread over the servers
+// by consistent hashing, as twemproxy would: a command is sent to the server
+// its key, the first argument, belongs to. A command without arguments,
+// such as PING or FLUSHALL, is sent to every server.
+//
+// Usage:
+//
+//	cli [-addr host:port[,host:port...]] [-raw] [command args...]
+//	cli [-addr host:port] -pipe < commands
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/ring"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+}
+
+func dial(addr string) (*conn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c: c, r: bufio.NewReader(c)}, nil
+}
+
+func (c *conn) do(args []string) (resp.RespValue, error) {
+	argv := make([]resp.RespValue, len(args))
+	for i, arg := range args {
+		argv[i] = resp.NewBulk(arg)
+	}
+	if err := resp.WriteResp(c.c, resp.NewArray(argv)); err != nil {
+		return resp.RespValue{}, err
+	}
+	return resp.ReadResp(c.r)
+}
+
+// shards are the connections to the servers keys are spread over, a
+// single one unless several addresses were given.
+type shards struct {
+	ring  *ring.Ring
+	conns []*conn // By server
+}
+
+func dialShards(addrs []string) (*shards, error) {
+	s := &shards{ring: ring.New(addrs)}
+	for _, addr := range addrs {
+		c, err := dial(addr)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("%s: %v", addr, err)
+		}
+		s.conns = append(s.conns, c)
+	}
+	return s, nil
+}
+
+// do runs args on the server holding its key, or on every server if it has
+// no arguments, and returns the replies by server.
+func (s *shards) do(args []string) ([]resp.RespValue, error) {
+	conns := s.conns
+	if len(args) > 1 {
+		i := s.ring.Server(args[1])
+		conns = conns[i : i+1]
+	}
+	replies := make([]resp.RespValue, len(conns))
+	for i, c := range conns {
+		reply, err := c.do(args)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// print prints the replies of a command, headed by the address of their
+// server when it ran on several.
+func (s *shards) print(replies []resp.RespValue, raw bool) {
+	for i, reply := range replies {
+		if len(replies) > 1 {
+			fmt.Printf("%s:\n", s.ring.Servers()[i])
+		}
+		fmt.Print(format(reply, raw))
+	}
+}
+
+func (s *shards) close() {
+	for _, c := range s.conns {
+		c.c.Close()
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6379", "server address, or comma separated addresses to shard keys over")
+	raw := flag.Bool("raw", !isTerminal(os.Stdout), "print replies raw instead of formatted")
+	pipe := flag.Bool("pipe", false, "send the protocol read from stdin to the server")
+	flag.Parse()
+
+	addrs := strings.Split(*addr, ",")
+	if *pipe && len(addrs) > 1 {
+		fmt.Fprintln(os.Stderr, "-pipe takes a single address")
+		os.Exit(2)
+	}
+	s, err := dialShards(addrs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not connect to %v\n", err)
+		os.Exit(1)
+	}
+	defer s.close()
+
+	switch {
+	case *pipe:
+		if err := runPipe(s.conns[0], os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case flag.NArg() > 0:
+		replies, err := s.do(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		s.print(replies, *raw)
+	default:
+		runPrompt(s, *addr, *raw)
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runPrompt reads commands from stdin until EOF or quit, running each.
+// "history" lists the previous commands, and "!!" and "!n" run one again.
+func runPrompt(s *shards, addr string, raw bool) {
+	hist := loadHistory()
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 64*1024), resp.MaxBulkLen)
+	for {
+		fmt.Printf("%s> ", addr)
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			recalled, err := hist.recall(line)
+			if err != nil {
+				fmt.Printf("(error) %v\n", err)
+				continue
+			}
+			line = recalled
+			fmt.Println(line)
+		}
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Printf("Invalid argument(s): %v\n", err)
+			continue
+		}
+		hist.add(line)
+		switch strings.ToLower(args[0]) {
+		case "quit", "exit":
+			return
+		case "history":
+			hist.print()
+			continue
+		}
+		replies, err := s.do(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		s.print(replies, raw)
+	}
+}
+
+// history is the list of commands entered at the prompt, saved to a file.
+type history struct {
+	path  string
+	lines []string
+}
+
+// maxHistory is the number of commands kept in the history file.
+const maxHistory = 1000
+
+func loadHistory() *history {
+	h := &history{}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return h
+	}
+	h.path = filepath.Join(home, ".go_redis_cli_history")
+	if data, err := os.ReadFile(h.path); err == nil {
+		h.lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(h.lines) == 1 && h.lines[0] == "" {
+			h.lines = nil
+		}
+	}
+	return h
+}
+
+func (h *history) add(line string) {
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	if h.path == "" {
+		return
+	}
+	if len(h.lines) == maxHistory {
+		// Rewrite the file when it is full, dropping the oldest command.
+		os.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
+
+func (h *history) print() {
+	for i, line := range h.lines {
+		fmt.Printf("%5d  %s\n", i+1, line)
+	}
+}
+
+// recall returns the command that "!!" or "!n" refers to.
+func (h *history) recall(ref string) (string, error) {
+	if ref == "!!" {
+		if len(h.lines) == 0 {
+			return "", errors.New("history is empty")
+		}
+		return h.lines[len(h.lines)-1], nil
+	}
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(h.lines) {
+		return "", fmt.Errorf("no command %s in history", ref)
+	}
+	return h.lines[n-1], nil
+}
+
+// splitArgs splits a command line into arguments as redis-cli does:
+// separated by spaces, with double quoted arguments taking the escapes
+// \n, \r, \t, \b, \a, \", \\ and \xHH, and single quoted ones only \'.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		var arg strings.Builder
+		switch line[i] {
+		case '"':
+			i++
+			for ; ; i++ {
+				if i == len(line) {
+					return nil, errors.New("unbalanced quotes")
+				}
+				ch := line[i]
+				if ch == '"' {
+					i++
+					break
+				}
+				if ch == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						ch = '\n'
+					case 'r':
+						ch = '\r'
+					case 't':
+						ch = '\t'
+					case 'b':
+						ch = '\b'
+					case 'a':
+						ch = '\a'
+					case 'x':
+						if i+2 < len(line) {
+							if b, err := hex.DecodeString(line[i+1 : i+3]); err == nil {
+								ch = b[0]
+								i += 2
+								break
+							}
+						}
+						ch = 'x'
+					default:
+						ch = line[i]
+					}
+				}
+				arg.WriteByte(ch)
+			}
+		case '\'':
+			i++
+			for ; ; i++ {
+				if i == len(line) {
+					return nil, errors.New("unbalanced quotes")
+				}
+				if line[i] == '\'' {
+					i++
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				}
+				arg.WriteByte(line[i])
+			}
+		default:
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				arg.WriteByte(line[i])
+				i++
+			}
+			args = append(args, arg.String())
+			continue
+		}
+		// A closing quote must end the argument.
+		if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			return nil, errors.New("closing quote must be followed by a space")
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// format renders a reply as redis-cli does, or raw.
+func format(v resp.RespValue, raw bool) string {
+	if raw {
+		return formatRaw(v)
+	}
+	return formatValue(v, "")
+}
+
+// formatValue renders v with the items of arrays numbered, nested arrays
+// indented by prefix.
+func formatValue(v resp.RespValue, prefix string) string {
+	switch v.Type {
+	case resp.String:
+		return v.Str + "\n"
+	case resp.Error:
+		return "(error) " + v.Str + "\n"
+	case resp.Integer:
+		return "(integer) " + strconv.FormatInt(v.Num, 10) + "\n"
+	case resp.BigNumber:
+		return "(big number) " + v.Str + "\n"
+	case resp.Double:
+		return "(double) " + v.Str + "\n"
+	case resp.Boolean:
+		if v.Num != 0 {
+			return "(true)\n"
+		}
+		return "(false)\n"
+	case resp.Bulk:
+		if v.Null {
+			return "(nil)\n"
+		}
+		return quote(v.Str) + "\n"
+	case resp.Verbatim:
+		return v.Text() + "\n"
+	case resp.Attribute:
+		n := len(v.Array) - 1
+		attrs := formatValue(resp.NewMap(v.Array[:n]), prefix)
+		return "(attributes) " + attrs + prefix + formatValue(v.Array[n], prefix)
+	case resp.Array, resp.Push:
+		if v.Null {
+			return "(nil)\n"
+		}
+		if len(v.Array) == 0 {
+			return "(empty array)\n"
+		}
+		var b strings.Builder
+		width := len(strconv.Itoa(len(v.Array)))
+		for i, item := range v.Array {
+			label := fmt.Sprintf("%*d) ", width, i+1)
+			if i > 0 {
+				b.WriteString(prefix)
+			}
+			b.WriteString(label)
+			b.WriteString(formatValue(item, prefix+strings.Repeat(" ", len(label))))
+		}
+		return b.String()
+	case resp.Map:
+		if len(v.Array) == 0 {
+			return "(empty hash)\n"
+		}
+		var b strings.Builder
+		width := len(strconv.Itoa(len(v.Array) / 2))
+		for i := 0; i+1 < len(v.Array); i += 2 {
+			label := fmt.Sprintf("%*d# ", width, i/2+1)
+			if i > 0 {
+				b.WriteString(prefix)
+			}
+			b.WriteString(label)
+			b.WriteString(strings.TrimSuffix(formatValue(v.Array[i], prefix), "\n"))
+			b.WriteString(" => ")
+			b.WriteString(formatValue(v.Array[i+1], prefix+strings.Repeat(" ", len(label))))
+		}
+		return b.String()
+	}
+	return fmt.Sprintf("(unknown reply type %q)\n", v.Type)
+}
+
+// formatRaw renders v without decoration, one item of an array per line.
+func formatRaw(v resp.RespValue) string {
+	switch v.Type {
+	case resp.Integer:
+		return strconv.FormatInt(v.Num, 10) + "\n"
+	case resp.Boolean:
+		return formatValue(v, "")
+	case resp.Array, resp.Push, resp.Map:
+		var b strings.Builder
+		for _, item := range v.Array {
+			b.WriteString(formatRaw(item))
+		}
+		return b.String()
+	case resp.Attribute:
+		return formatRaw(v.Array[len(v.Array)-1])
+	case resp.Verbatim:
+		return v.Text() + "\n"
+	}
+	if v.Null {
+		return "\n"
+	}
+	return v.Str + "\n"
+}
+
+// quote returns s double quoted, with the bytes that are not printable
+// ASCII escaped.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if ch < 0x20 || ch >= 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// runPipe sends in to the server and reads the replies meanwhile. A PING
+// with a random message sent last marks the end of the replies.
+func runPipe(c *conn, in io.Reader) error {
+	var token [20]byte
+	rand.Read(token[:])
+	marker := hex.EncodeToString(token[:])
+
+	sendErr := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(c.c)
+		if _, err := io.Copy(w, in); err != nil {
+			sendErr <- err
+			return
+		}
+		fmt.Fprintf(w, "*2\r\n$4\r\nPING\r\n$%d\r\n%s\r\n", len(marker), marker)
+		sendErr <- w.Flush()
+	}()
+
+	replies, errs := 0, 0
+	for {
+		reply, err := resp.ReadResp(c.r)
+		if err == io.EOF {
+			return fmt.Errorf("connection closed by the server after %d replies", replies)
+		}
+		if err != nil {
+			return err
+		}
+		if reply.Type == resp.String && reply.Str == marker {
+			break
+		}
+		replies++
+		if reply.Type == resp.Error {
+			errs++
+			if errs <= 10 {
+				fmt.Fprintln(os.Stderr, reply.Str)
+			}
+		}
+	}
+	if err := <-sendErr; err != nil {
+		return err
+	}
+	fmt.Printf("All data transferred. Waiting for the last reply...\nLast reply received from server.\nerrors: %d, replies: %d\n", errs, replies)
+	if errs > 0 {
+		return fmt.Errorf("%d commands failed", errs)
+	}
+	return nil
+}
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// redisDumpOf10 is the payload of DUMP of the string "10", as Redis
+// documents it.
+const redisDumpOf10 = "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"
+
+// sicily is the geospatial index of the Redis documentation.
+var sicily = []string{"13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}
+
+// compatCase runs setup, then argv, and checks the reply of argv. Arguments
+// in braces are keys unique to the case.
+type compatCase struct {
+	command string
+	name    string
+	setup   [][]string
+	argv    []string
+	want    expectation
+}
+
+// expectation checks a reply, and describes what was expected.
+type expectation func(v resp.RespValue) (bool, string)
+
+func ok() expectation { return simple("OK") }
+
+func simple(s string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.String && v.Str == s, "+" + s
+	}
+}
+
+func integer(n int64) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Integer && v.Num == n, ":" + strconv.FormatInt(n, 10)
+	}
+}
+
+// intBetween expects an integer in [lo, hi].
+func intBetween(lo, hi int64) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Integer && v.Num >= lo && v.Num <= hi, fmt.Sprintf("an integer in [%d, %d]", lo, hi)
+	}
+}
+
+func bulk(s string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Bulk && !v.Null && v.Str == s, strconv.Quote(s)
+	}
+}
+
+func null() expectation {
+	return func(v resp.RespValue) (bool, string) {
+		return v.Null, "(nil)"
+	}
+}
+
+// errPrefix expects an error starting with prefix, such as "WRONGTYPE" or
+// "ERR wrong number of arguments".
+func errPrefix(prefix string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Error && strings.HasPrefix(v.Str, prefix), "-" + prefix + "..."
+	}
+}
+
+func arityErr() expectation { return errPrefix("ERR wrong number of arguments") }
+func wrongType() expectation {
+	return errPrefix("WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+func notInteger() expectation { return errPrefix("ERR value is not an integer or out of range") }
+func notFloat() expectation   { return errPrefix("ERR value is not a valid float") }
+func syntaxErr() expectation  { return errPrefix("ERR syntax error") }
+
+// array expects an array of these bulk strings in order.
+func array(items ...string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		want := "[" + strings.Join(items, " ") + "]"
+		if v.Type != resp.Array || v.Null || len(v.Array) != len(items) {
+			return false, want
+		}
+		for i, item := range v.Array {
+			if item.Type != resp.Bulk || item.Null || item.Str != items[i] {
+				return false, want
+			}
+		}
+		return true, want
+	}
+}
+
+// unordered expects an array of these bulk strings in any order.
+func unordered(items ...string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		want := "[" + strings.Join(items, " ") + "] in any order"
+		if v.Type != resp.Array || v.Null || len(v.Array) != len(items) {
+			return false, want
+		}
+		got := make([]string, len(v.Array))
+		for i, item := range v.Array {
+			if item.Type != resp.Bulk || item.Null {
+				return false, want
+			}
+			got[i] = item.Str
+		}
+		slices.Sort(got)
+		sorted := slices.Clone(items)
+		slices.Sort(sorted)
+		return slices.Equal(got, sorted), want
+	}
+}
+
+// pairs expects a flat array of field value pairs, in any order of the
+// pairs, as HGETALL returns.
+func pairs(items ...string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		want := "[" + strings.Join(items, " ") + "] as pairs in any order"
+		if v.Type != resp.Array || len(v.Array) != len(items) {
+			return false, want
+		}
+		wantPairs := make(map[string]string)
+		for i := 0; i < len(items); i += 2 {
+			wantPairs[items[i]] = items[i+1]
+		}
+		for i := 0; i+1 < len(v.Array); i += 2 {
+			if wantPairs[v.Array[i].Str] != v.Array[i+1].Str {
+				return false, want
+			}
+		}
+		return true, want
+	}
+}
+
+// help expects the reply to HELP of a container command: an array of
+// simple strings, from the header naming the command to the entry of HELP.
+func help(command string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		want := "[+" + command + " <subcommand> ... +    Print this help.]"
+		if v.Type != resp.Array || len(v.Array) < 3 {
+			return false, want
+		}
+		for _, line := range v.Array {
+			if line.Type != resp.String {
+				return false, want
+			}
+		}
+		n := len(v.Array)
+		return strings.HasPrefix(v.Array[0].Str, command+" <subcommand> ") &&
+			v.Array[n-2].Str == "HELP" && v.Array[n-1].Str == "    Print this help.", want
+	}
+}
+
+// emptyArray expects an empty array.
+func emptyArray() expectation { return array() }
+
+// entryIDs expects stream entries with these IDs in order, each an array
+// of its ID and its fields and values.
+func entryIDs(ids ...string) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		want := "entries [" + strings.Join(ids, " ") + "]"
+		if v.Type != resp.Array || v.Null || len(v.Array) != len(ids) {
+			return false, want
+		}
+		for i, e := range v.Array {
+			if len(e.Array) != 2 || e.Array[0].Str != ids[i] {
+				return false, want
+			}
+		}
+		return true, want
+	}
+}
+
+// scanEnd expects the last reply of a scan: the cursor 0 and n keys.
+func scanEnd(n int) expectation {
+	return func(v resp.RespValue) (bool, string) {
+		want := fmt.Sprintf("[0 [%d keys]]", n)
+		return v.Type == resp.Array && len(v.Array) == 2 && v.Array[0].Str == "0" &&
+			v.Array[1].Type == resp.Array && len(v.Array[1].Array) == n, want
+	}
+}
+
+// cases are derived from the command documentation of Redis.
+var cases = []compatCase{
+	// Connection
+	{command: "PING", name: "without argument", argv: []string{"PING"}, want: simple("PONG")},
+	{command: "PING", name: "with a message", argv: []string{"PING", "hello"}, want: bulk("hello")},
+	{command: "PING", name: "too many arguments", argv: []string{"PING", "a", "b"}, want: arityErr()},
+	{command: "HELLO", name: "RESP2 properties as a flat array", argv: []string{"HELLO", "2"}, want: func(v resp.RespValue) (bool, string) {
+		i := slices.IndexFunc(v.Array, func(item resp.RespValue) bool { return item.Str == "proto" })
+		return v.Type == resp.Array && len(v.Array)%2 == 0 && i >= 0 && i%2 == 0 && v.Array[i+1].Num == 2, "[... \"proto\" :2 ...]"
+	}},
+	{command: "HELLO", name: "unsupported protocol version", argv: []string{"HELLO", "4"}, want: errPrefix("NOPROTO")},
+	{command: "HELLO", name: "protocol version not an integer", argv: []string{"HELLO", "x"}, want: errPrefix("ERR Protocol version is not an integer or out of range")},
+	{command: "HELLO", name: "unknown option", argv: []string{"HELLO", "2", "NOSUCH"}, want: errPrefix("ERR Syntax error in HELLO option 'NOSUCH'")},
+	{command: "CLIENT", name: "SETINFO lib-name", argv: []string{"CLIENT", "SETINFO", "lib-name", "go-redis(,go1.22.0)"}, want: ok()},
+	{command: "CLIENT", name: "SETINFO unknown attribute", argv: []string{"CLIENT", "SETINFO", "lib-x", "1"}, want: errPrefix("ERR Unrecognized option 'lib-x'")},
+	{command: "CLIENT", name: "SETINFO value with a space", argv: []string{"CLIENT", "SETINFO", "lib-ver", "1 2"}, want: errPrefix("ERR lib-ver cannot contain spaces")},
+	{command: "CLIENT", name: "UNBLOCK a client not connected", argv: []string{"CLIENT", "UNBLOCK", "999999999"}, want: integer(0)},
+	{command: "CLIENT", name: "UNBLOCK a client not blocked", setup: [][]string{{"CLIENT", "SETNAME", "unblock"}}, argv: []string{"CLIENT", "UNBLOCK", "1", "ERROR"}, want: integer(0)},
+	{command: "CLIENT", name: "UNBLOCK unknown reason", argv: []string{"CLIENT", "UNBLOCK", "1", "NOW"}, want: errPrefix("ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR")},
+	{command: "CLIENT", name: "UNBLOCK id not a number", argv: []string{"CLIENT", "UNBLOCK", "x"}, want: notInteger()},
+	{command: "CLIENT", name: "KILL an address not connected", argv: []string{"CLIENT", "KILL", "127.0.0.1:1"}, want: errPrefix("ERR No such client")},
+	{command: "CLIENT", name: "KILL filter matching no client", argv: []string{"CLIENT", "KILL", "ADDR", "127.0.0.1:1"}, want: integer(0)},
+	{command: "CLIENT", name: "KILL MAXAGE older than any client", argv: []string{"CLIENT", "KILL", "TYPE", "normal", "MAXAGE", "100000"}, want: integer(0)},
+	{command: "CLIENT", name: "KILL filter without a value", argv: []string{"CLIENT", "KILL", "TYPE", "normal", "SKIPME"}, want: syntaxErr()},
+	{command: "CLIENT", name: "KILL unknown type", argv: []string{"CLIENT", "KILL", "TYPE", "nosuch"}, want: errPrefix("ERR Unknown client type 'nosuch'")},
+	{command: "CLIENT", name: "KILL unknown user", argv: []string{"CLIENT", "KILL", "USER", "nosuch"}, want: errPrefix("ERR No such user 'nosuch'")},
+	{command: "CLIENT", name: "KILL ID zero", argv: []string{"CLIENT", "KILL", "ID", "0"}, want: errPrefix("ERR client-id should be greater than 0")},
+	{command: "CLIENT", name: "KILL MAXAGE not an integer", argv: []string{"CLIENT", "KILL", "MAXAGE", "x"}, want: notInteger()},
+	{command: "CLIENT", name: "PAUSE timeout not an integer", argv: []string{"CLIENT", "PAUSE", "x"}, want: errPrefix("ERR timeout is not an integer or out of range")},
+	{command: "CLIENT", name: "PAUSE negative timeout", argv: []string{"CLIENT", "PAUSE", "-1"}, want: errPrefix("ERR timeout is negative")},
+	{command: "CLIENT", name: "PAUSE unknown mode", argv: []string{"CLIENT", "PAUSE", "10", "READ"}, want: syntaxErr()},
+	{command: "CLIENT", name: "UNPAUSE without a pause", argv: []string{"CLIENT", "UNPAUSE"}, want: ok()},
+	{command: "OBJECT", name: "HELP", argv: []string{"OBJECT", "HELP"}, want: help("OBJECT")},
+	{command: "OBJECT", name: "HELP in lower case", argv: []string{"object", "help"}, want: help("OBJECT")},
+	{command: "OBJECT", name: "HELP with arguments", argv: []string{"OBJECT", "HELP", "x"}, want: errPrefix("ERR wrong number of arguments for 'object|help' command")},
+	{command: "OBJECT", name: "unknown subcommand", argv: []string{"OBJECT", "NOSUCH"}, want: errPrefix("ERR unknown subcommand 'NOSUCH'. Try OBJECT HELP.")},
+	{command: "OBJECT", name: "IDLETIME without a key", argv: []string{"OBJECT", "IDLETIME"}, want: errPrefix("ERR wrong number of arguments for 'object|idletime' command")},
+	{command: "CLIENT", name: "HELP", argv: []string{"CLIENT", "HELP"}, want: help("CLIENT")},
+	{command: "CLIENT", name: "SETNAME with two names", argv: []string{"CLIENT", "SETNAME", "a", "b"}, want: errPrefix("ERR wrong number of arguments for 'client|setname' command")},
+	{command: "CLIENT", name: "unknown subcommand", argv: []string{"CLIENT", "NOSUCH"}, want: errPrefix("ERR unknown subcommand 'NOSUCH'. Try CLIENT HELP.")},
+	{command: "COMMAND", name: "GETKEYS of a subcommand", argv: []string{"COMMAND", "GETKEYS", "OBJECT", "IDLETIME", "k"}, want: array("k")},
+	{command: "COMMAND", name: "HELP", argv: []string{"COMMAND", "HELP"}, want: help("COMMAND")},
+	{command: "PUBSUB", name: "HELP", argv: []string{"PUBSUB", "HELP"}, want: help("PUBSUB")},
+	{command: "SCRIPT", name: "HELP", argv: []string{"SCRIPT", "HELP"}, want: help("SCRIPT")},
+	{command: "FUNCTION", name: "HELP", argv: []string{"FUNCTION", "HELP"}, want: help("FUNCTION")},
+	{command: "DEBUG", name: "STRINGMATCH-LEN", argv: []string{"DEBUG", "STRINGMATCH-LEN"}, want: simple("Apparently Redis did not crash: test passed")},
+	{command: "KEYS", name: "pathological pattern", argv: []string{"KEYS", "*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*b"}, want: emptyArray()},
+	{command: "ACL", name: "WHOAMI", argv: []string{"ACL", "WHOAMI"}, want: bulk("default")},
+	{command: "ACL", name: "CAT unknown category", argv: []string{"ACL", "CAT", "nosuch"}, want: errPrefix("ERR Unknown category 'nosuch'")},
+	{command: "ACL", name: "GETUSER of an unknown user", argv: []string{"ACL", "GETUSER", "nosuch"}, want: null()},
+	{command: "ACL", name: "DELUSER of the default user", argv: []string{"ACL", "DELUSER", "default"}, want: errPrefix("ERR The 'default' user cannot be removed")},
+	{command: "ACL", name: "DELUSER of an unknown user", argv: []string{"ACL", "DELUSER", "nosuch"}, want: integer(0)},
+	{command: "ACL", name: "SETUSER with a space in the name", argv: []string{"ACL", "SETUSER", "a b"}, want: errPrefix("ERR Usernames can't contain spaces or null characters")},
+	{command: "AUTH", name: "password without one configured", argv: []string{"AUTH", "pw"}, want: errPrefix("ERR AUTH <password> called without any password configured for the default user")},
+	{command: "AUTH", name: "unknown user", argv: []string{"AUTH", "nosuch", "pw"}, want: errPrefix("WRONGPASS invalid username-password pair or user is disabled.")},
+	{command: "AUTH", name: "default user without a password", argv: []string{"AUTH", "default", "anything"}, want: ok()},
+	{command: "HELLO", name: "AUTH as an unknown user", argv: []string{"HELLO", "2", "AUTH", "nosuch", "pw"}, want: errPrefix("WRONGPASS")},
+	{command: "SELECT", name: "db0", argv: []string{"SELECT", "0"}, want: ok()},
+	{command: "SELECT", name: "index out of range", argv: []string{"SELECT", "-1"}, want: errPrefix("ERR DB index is out of range")},
+	{command: "SELECT", name: "not an integer", argv: []string{"SELECT", "x"}, want: notInteger()},
+	{command: "CLIENT", name: "REPLY ON", argv: []string{"CLIENT", "REPLY", "ON"}, want: ok()},
+	{command: "CLIENT", name: "REPLY unknown mode", argv: []string{"CLIENT", "REPLY", "MAYBE"}, want: syntaxErr()},
+	{command: "SAVE", name: "plain", argv: []string{"SAVE"}, want: ok()},
+	{command: "DEBUG", name: "RELOAD", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"DEBUG", "RELOAD"}, want: ok()},
+	{command: "SHUTDOWN", name: "SAVE and NOSAVE together", argv: []string{"SHUTDOWN", "SAVE", "NOSAVE"}, want: syntaxErr()},
+	{command: "SHUTDOWN", name: "ABORT without a shutdown in progress", argv: []string{"SHUTDOWN", "ABORT"}, want: errPrefix("ERR No shutdown in progress.")},
+	{command: "(unknown)", name: "unknown command", argv: []string{"NOSUCHCOMMAND", "x"}, want: errPrefix("ERR unknown command")},
+	{command: "(unknown)", name: "unknown command with its args", argv: []string{"nosuchCommand", "x", "y"}, want: errPrefix("ERR unknown command 'nosuchCommand', with args beginning with: 'x' 'y' ")},
+	{command: "(unknown)", name: "non-ASCII name folding to an ASCII command", argv: []string{"ſet", "x", "y"}, want: errPrefix("ERR unknown command 'ſet'")},
+	{command: "SET", name: "mixed-case name", argv: []string{"sEt", "{k}", "v"}, want: ok()},
+
+	// Strings
+	{command: "SET", name: "plain", argv: []string{"SET", "{k}", "v"}, want: ok()},
+	{command: "SET", name: "missing value", argv: []string{"SET", "{k}"}, want: arityErr()},
+	{command: "SET", name: "NX on an existing key", setup: [][]string{{"SET", "{k}", "a"}}, argv: []string{"SET", "{k}", "b", "NX"}, want: null()},
+	{command: "SET", name: "XX on a missing key", argv: []string{"SET", "{k}", "b", "XX"}, want: null()},
+	{command: "SET", name: "GET returns the old value", setup: [][]string{{"SET", "{k}", "old"}}, argv: []string{"SET", "{k}", "new", "GET"}, want: bulk("old")},
+	{command: "SET", name: "NX and XX together", argv: []string{"SET", "{k}", "v", "NX", "XX"}, want: syntaxErr()},
+	{command: "SET", name: "non-integer EX", argv: []string{"SET", "{k}", "v", "EX", "soon"}, want: notInteger()},
+	{command: "SET", name: "zero EX", argv: []string{"SET", "{k}", "v", "EX", "0"}, want: errPrefix("ERR invalid expire time in 'set' command")},
+	{command: "SET", name: "unknown option", argv: []string{"SET", "{k}", "v", "SOMETIMES"}, want: syntaxErr()},
+	{command: "GET", name: "existing key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"GET", "{k}"}, want: bulk("v")},
+	{command: "GET", name: "missing key", argv: []string{"GET", "{k}"}, want: null()},
+	{command: "GET", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"GET", "{k}"}, want: wrongType()},
+	{command: "GET", name: "no key", argv: []string{"GET"}, want: arityErr()},
+	{command: "GETDEL", name: "existing key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"GETDEL", "{k}"}, want: bulk("v")},
+	{command: "GETDEL", name: "missing key", argv: []string{"GETDEL", "{k}"}, want: null()},
+	{command: "GETEX", name: "without options", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}, {"GETEX", "{k}"}}, argv: []string{"TTL", "{k}"}, want: intBetween(99, 100)},
+	{command: "GETEX", name: "EXAT", setup: [][]string{{"SET", "{k}", "v"}, {"GETEX", "{k}", "EXAT", "4102444800"}}, argv: []string{"EXPIRETIME", "{k}"}, want: integer(4102444800)},
+	{command: "GETEX", name: "EXAT in the past", setup: [][]string{{"SET", "{k}", "v"}, {"GETEX", "{k}", "EXAT", "1"}}, argv: []string{"EXISTS", "{k}"}, want: integer(0)},
+	{command: "GETEX", name: "PERSIST", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}, {"GETEX", "{k}", "PERSIST"}}, argv: []string{"TTL", "{k}"}, want: integer(-1)},
+	{command: "GETEX", name: "missing key", argv: []string{"GETEX", "{k}", "EX", "10"}, want: null()},
+	{command: "GETEX", name: "zero expire time", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"GETEX", "{k}", "EX", "0"}, want: errPrefix("ERR invalid expire time in 'getex' command")},
+	{command: "GETEX", name: "EX and PERSIST together", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"GETEX", "{k}", "EX", "10", "PERSIST"}, want: syntaxErr()},
+	{command: "GETEX", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"GETEX", "{k}"}, want: wrongType()},
+	{command: "INCR", name: "missing key", argv: []string{"INCR", "{k}"}, want: integer(1)},
+	{command: "INCR", name: "existing number", setup: [][]string{{"SET", "{k}", "41"}}, argv: []string{"INCR", "{k}"}, want: integer(42)},
+	{command: "INCR", name: "not a number", setup: [][]string{{"SET", "{k}", "abc"}}, argv: []string{"INCR", "{k}"}, want: notInteger()},
+	{command: "INCR", name: "overflow", setup: [][]string{{"SET", "{k}", "9223372036854775807"}}, argv: []string{"INCR", "{k}"}, want: errPrefix("ERR increment or decrement would overflow")},
+	{command: "GETSET", name: "old value", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"GETSET", "{k}", "w"}, want: bulk("v")},
+	{command: "GETSET", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"GETSET", "{k}", "w"}, want: wrongType()},
+	{command: "OBJECT", name: "IDLETIME of a fresh key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"OBJECT", "IDLETIME", "{k}"}, want: integer(0)},
+	{command: "OBJECT", name: "IDLETIME of a missing key", argv: []string{"OBJECT", "IDLETIME", "{k}"}, want: null()},
+	{command: "RENAME", name: "missing key", argv: []string{"RENAME", "{a}", "{b}"}, want: errPrefix("ERR no such key")},
+	{command: "COPY", name: "existing destination", setup: [][]string{{"SET", "{a}", "v"}, {"SET", "{b}", "w"}}, argv: []string{"COPY", "{a}", "{b}"}, want: integer(0)},
+	{command: "COPY", name: "REPLACE", setup: [][]string{{"SET", "{a}", "v"}, {"SET", "{b}", "w"}}, argv: []string{"COPY", "{a}", "{b}", "REPLACE"}, want: integer(1)},
+	{command: "COPY", name: "same key", setup: [][]string{{"SET", "{a}", "v"}}, argv: []string{"COPY", "{a}", "{a}"}, want: errPrefix("ERR source and destination objects are the same")},
+	{command: "INCR", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"INCR", "{k}"}, want: wrongType()},
+	{command: "DECR", name: "missing key", argv: []string{"DECR", "{k}"}, want: integer(-1)},
+	{command: "DECR", name: "overflow", setup: [][]string{{"SET", "{k}", "-9223372036854775808"}}, argv: []string{"DECR", "{k}"}, want: errPrefix("ERR increment or decrement would overflow")},
+	{command: "INCRBYFLOAT", name: "missing key", argv: []string{"INCRBYFLOAT", "{k}", "1.5"}, want: bulk("1.5")},
+	{command: "INCRBYFLOAT", name: "shortest result", setup: [][]string{{"SET", "{k}", "10.50"}}, argv: []string{"INCRBYFLOAT", "{k}", "0.1"}, want: bulk("10.6")},
+	{command: "INCRBYFLOAT", name: "exponents", setup: [][]string{{"SET", "{k}", "5.0e3"}}, argv: []string{"INCRBYFLOAT", "{k}", "2.0e2"}, want: bulk("5200")},
+	{command: "INCRBYFLOAT", name: "not a float", setup: [][]string{{"SET", "{k}", "abc"}}, argv: []string{"INCRBYFLOAT", "{k}", "1"}, want: errPrefix("ERR value is not a valid float")},
+	{command: "INCRBYFLOAT", name: "increment not a float", argv: []string{"INCRBYFLOAT", "{k}", "x"}, want: errPrefix("ERR value is not a valid float")},
+	{command: "INCRBYFLOAT", name: "infinite result", setup: [][]string{{"SET", "{k}", "1e308"}}, argv: []string{"INCRBYFLOAT", "{k}", "1e308"}, want: errPrefix("ERR increment would produce NaN or Infinity")},
+	{command: "INCRBYFLOAT", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"INCRBYFLOAT", "{k}", "1"}, want: wrongType()},
+	{command: "APPEND", name: "missing key", argv: []string{"APPEND", "{k}", "abc"}, want: integer(3)},
+	{command: "APPEND", name: "existing key", setup: [][]string{{"SET", "{k}", "ab"}}, argv: []string{"APPEND", "{k}", "cd"}, want: integer(4)},
+	{command: "STRLEN", name: "missing key", argv: []string{"STRLEN", "{k}"}, want: integer(0)},
+	{command: "STRLEN", name: "existing key", setup: [][]string{{"SET", "{k}", "hello"}}, argv: []string{"STRLEN", "{k}"}, want: integer(5)},
+	{command: "GETRANGE", name: "negative range", setup: [][]string{{"SET", "{k}", "This is a string"}}, argv: []string{"GETRANGE", "{k}", "-3", "-1"}, want: bulk("ing")},
+	{command: "GETRANGE", name: "range past the end", setup: [][]string{{"SET", "{k}", "This is a string"}}, argv: []string{"GETRANGE", "{k}", "10", "100"}, want: bulk("string")},
+	{command: "GETRANGE", name: "missing key", argv: []string{"GETRANGE", "{k}", "0", "-1"}, want: bulk("")},
+	{command: "SUBSTR", name: "alias of GETRANGE", setup: [][]string{{"SET", "{k}", "This is a string"}}, argv: []string{"SUBSTR", "{k}", "0", "3"}, want: bulk("This")},
+	{command: "SETRANGE", name: "pads with zero bytes", argv: []string{"SETRANGE", "{k}", "3", "x"}, want: integer(4)},
+	{command: "SETRANGE", name: "past the maximum string size", argv: []string{"SETRANGE", "{k}", "9223372036854775807", "x"}, want: errPrefix("ERR string exceeds maximum allowed size")},
+	{command: "SETRANGE", name: "negative offset", argv: []string{"SETRANGE", "{k}", "-1", "x"}, want: errPrefix("ERR offset is out of range")},
+
+	{command: "APPEND", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"APPEND", "{k}", "a"}, want: wrongType()},
+	{command: "STRLEN", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"STRLEN", "{k}"}, want: wrongType()},
+	{command: "SETRANGE", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"SETRANGE", "{k}", "0", "a"}, want: wrongType()},
+	{command: "GETRANGE", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"GETRANGE", "{k}", "0", "-1"}, want: wrongType()},
+	{command: "DECR", name: "hash key", setup: [][]string{{"HSET", "{k}", "f", "v"}}, argv: []string{"DECR", "{k}"}, want: wrongType()},
+	// Keys
+	{command: "DEL", name: "existing and missing keys", setup: [][]string{{"SET", "{a}", "1"}, {"SET", "{b}", "2"}}, argv: []string{"DEL", "{a}", "{b}", "{c}"}, want: integer(2)},
+	{command: "DEL", name: "no key", argv: []string{"DEL"}, want: arityErr()},
+	{command: "UNLINK", name: "existing and missing keys", setup: [][]string{{"SET", "{a}", "1"}, {"RPUSH", "{b}", "x"}}, argv: []string{"UNLINK", "{a}", "{b}", "{c}"}, want: integer(2)},
+	{command: "SCAN", name: "MATCH of a single key", setup: [][]string{{"SET", "{a}", "1"}}, argv: []string{"SCAN", "0", "MATCH", "{a}", "COUNT", "100000"}, want: scanEnd(1)},
+	{command: "SCAN", name: "TYPE filters keys out", setup: [][]string{{"SET", "{a}", "1"}}, argv: []string{"SCAN", "0", "MATCH", "{a}", "TYPE", "list", "COUNT", "100000"}, want: scanEnd(0)},
+	{command: "RANDOMKEY", name: "with an argument", argv: []string{"RANDOMKEY", "x"}, want: arityErr()},
+	{command: "SCAN", name: "invalid cursor", argv: []string{"SCAN", "abc"}, want: errPrefix("ERR invalid cursor")},
+	{command: "SCAN", name: "COUNT 0", argv: []string{"SCAN", "0", "COUNT", "0"}, want: syntaxErr()},
+	{command: "SCAN", name: "unknown option", argv: []string{"SCAN", "0", "LIMIT", "1"}, want: syntaxErr()},
+	{command: "EXISTS", name: "counts repeated keys", setup: [][]string{{"SET", "{a}", "1"}}, argv: []string{"EXISTS", "{a}", "{a}", "{b}"}, want: integer(2)},
+	{command: "TYPE", name: "missing key", argv: []string{"TYPE", "{k}"}, want: simple("none")},
+	{command: "TYPE", name: "sorted set", setup: [][]string{{"ZADD", "{k}", "1", "a"}}, argv: []string{"TYPE", "{k}"}, want: simple("zset")},
+	{command: "TYPE", name: "emptied list", setup: [][]string{{"RPUSH", "{k}", "a"}, {"LPOP", "{k}"}}, argv: []string{"TYPE", "{k}"}, want: simple("none")},
+	{command: "EXPIRE", name: "existing key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"EXPIRE", "{k}", "100"}, want: integer(1)},
+	{command: "EXPIRE", name: "missing key", argv: []string{"EXPIRE", "{k}", "100"}, want: integer(0)},
+	{command: "EXPIRE", name: "not a number", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"EXPIRE", "{k}", "soon"}, want: notInteger()},
+	{command: "EXPIRE", name: "NX with an expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}}, argv: []string{"EXPIRE", "{k}", "200", "NX"}, want: integer(0)},
+	{command: "EXPIRE", name: "NX and XX together", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"EXPIRE", "{k}", "200", "NX", "XX"}, want: errPrefix("ERR NX and XX, GT or LT options at the same time are not compatible")},
+	{command: "EXPIRE", name: "GT and LT together", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"EXPIRE", "{k}", "200", "GT", "LT"}, want: errPrefix("ERR GT and LT options at the same time are not compatible")},
+	{command: "EXPIRE", name: "XX and GT together", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}}, argv: []string{"EXPIRE", "{k}", "200", "XX", "GT"}, want: integer(1)},
+	{command: "EXPIRE", name: "XX and LT on a later time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}}, argv: []string{"EXPIRE", "{k}", "200", "XX", "LT"}, want: integer(0)},
+	{command: "EXPIRE", name: "unsupported option", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"EXPIRE", "{k}", "200", "NOSUCH"}, want: errPrefix("ERR Unsupported option NOSUCH")},
+	{command: "EXPIRE", name: "negative time deletes", setup: [][]string{{"SET", "{k}", "v"}, {"EXPIRE", "{k}", "-1"}}, argv: []string{"EXISTS", "{k}"}, want: integer(0)},
+	{command: "TTL", name: "missing key", argv: []string{"TTL", "{k}"}, want: integer(-2)},
+	{command: "TTL", name: "no expire time", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"TTL", "{k}"}, want: integer(-1)},
+	{command: "TTL", name: "with an expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}}, argv: []string{"TTL", "{k}"}, want: intBetween(99, 100)},
+	{command: "TTL", name: "expire time past 292 years", setup: [][]string{{"SET", "{k}", "v", "EX", "9999999999999"}}, argv: []string{"TTL", "{k}"}, want: intBetween(9999999999998, 9999999999999)},
+	{command: "TTL", name: "absolute expire time past 292 years", setup: [][]string{{"SET", "{k}", "v", "EXAT", "99999999999"}}, argv: []string{"TTL", "{k}"}, want: intBetween(97000000000, 98300000000)},
+	{command: "TTL", name: "EXPIREAT past 292 years", setup: [][]string{{"SET", "{k}", "v"}, {"EXPIREAT", "{k}", "99999999999"}}, argv: []string{"TTL", "{k}"}, want: intBetween(97000000000, 98300000000)},
+	{command: "TTL", name: "RESTORE ABSTTL past 292 years", setup: [][]string{{"RESTORE", "{k}", "99999999999000", redisDumpOf10, "ABSTTL"}}, argv: []string{"TTL", "{k}"}, want: intBetween(97000000000, 98300000000)},
+	{command: "PTTL", name: "expire time past 292 years", setup: [][]string{{"SET", "{k}", "v", "PX", "9999999999999999"}}, argv: []string{"PTTL", "{k}"}, want: intBetween(9999999999990000, 9999999999999999)},
+	{command: "PTTL", name: "with an expire time", setup: [][]string{{"SET", "{k}", "v", "PX", "100000"}}, argv: []string{"PTTL", "{k}"}, want: intBetween(99000, 100000)},
+	{command: "SET", name: "clears the expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}, {"SET", "{k}", "w"}}, argv: []string{"TTL", "{k}"}, want: integer(-1)},
+	{command: "SET", name: "KEEPTTL keeps the expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}, {"SET", "{k}", "w", "KEEPTTL"}}, argv: []string{"TTL", "{k}"}, want: intBetween(99, 100)},
+	{command: "GETSET", name: "clears the expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}, {"GETSET", "{k}", "w"}}, argv: []string{"TTL", "{k}"}, want: integer(-1)},
+	{command: "INCR", name: "keeps the expire time", setup: [][]string{{"SET", "{k}", "1", "EX", "100"}, {"INCR", "{k}"}}, argv: []string{"TTL", "{k}"}, want: intBetween(99, 100)},
+	{command: "APPEND", name: "keeps the expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}, {"APPEND", "{k}", "w"}}, argv: []string{"TTL", "{k}"}, want: intBetween(99, 100)},
+	{command: "RENAME", name: "moves the expire time", setup: [][]string{{"SET", "{a}", "v", "EX", "100"}, {"RENAME", "{a}", "{b}"}}, argv: []string{"TTL", "{b}"}, want: intBetween(99, 100)},
+	{command: "RENAME", name: "drops the expire time of the destination", setup: [][]string{{"SET", "{a}", "v"}, {"SET", "{b}", "w", "EX", "100"}, {"RENAME", "{a}", "{b}"}}, argv: []string{"TTL", "{b}"}, want: integer(-1)},
+	{command: "COPY", name: "copies the expire time", setup: [][]string{{"SET", "{a}", "v", "EX", "100"}, {"COPY", "{a}", "{b}"}}, argv: []string{"TTL", "{b}"}, want: intBetween(99, 100)},
+	{command: "DUMP", name: "missing key", argv: []string{"DUMP", "{k}"}, want: null()},
+	{command: "RESTORE", name: "payload of Redis", setup: [][]string{{"RESTORE", "{k}", "0", redisDumpOf10}}, argv: []string{"GET", "{k}"}, want: bulk("10")},
+	{command: "RESTORE", name: "existing key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"RESTORE", "{k}", "0", redisDumpOf10}, want: errPrefix("BUSYKEY Target key name already exists.")},
+	{command: "RESTORE", name: "REPLACE", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"RESTORE", "{k}", "0", redisDumpOf10, "REPLACE"}, want: ok()},
+	{command: "RESTORE", name: "wrong checksum", argv: []string{"RESTORE", "{k}", "0", redisDumpOf10[:len(redisDumpOf10)-1] + "x"}, want: errPrefix("ERR DUMP payload version or checksum are wrong")},
+	{command: "RESTORE", name: "negative TTL", argv: []string{"RESTORE", "{k}", "-1", redisDumpOf10}, want: errPrefix("ERR Invalid TTL value, must be >= 0")},
+	{command: "RESTORE", name: "sets the TTL", setup: [][]string{{"RESTORE", "{k}", "100000", redisDumpOf10}}, argv: []string{"TTL", "{k}"}, want: intBetween(99, 100)},
+	{command: "RESTORE", name: "IDLETIME", setup: [][]string{{"RESTORE", "{k}", "0", redisDumpOf10, "IDLETIME", "1000"}}, argv: []string{"OBJECT", "IDLETIME", "{k}"}, want: intBetween(1000, 1001)},
+	{command: "RESTORE", name: "IDLETIME with FREQ", argv: []string{"RESTORE", "{k}", "0", redisDumpOf10, "IDLETIME", "1", "FREQ", "1"}, want: syntaxErr()},
+	{command: "EXPIRETIME", name: "no expire time", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"EXPIRETIME", "{k}"}, want: integer(-1)},
+	{command: "EXPIRETIME", name: "absolute time", setup: [][]string{{"SET", "{k}", "v"}, {"EXPIREAT", "{k}", "33177117420"}}, argv: []string{"EXPIRETIME", "{k}"}, want: integer(33177117420)},
+	{command: "PERSIST", name: "removes the expire time", setup: [][]string{{"SET", "{k}", "v", "EX", "100"}}, argv: []string{"PERSIST", "{k}"}, want: integer(1)},
+	{command: "PERSIST", name: "no expire time", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"PERSIST", "{k}"}, want: integer(0)},
+
+	// Lists
+	{command: "LPUSH", name: "returns the length", argv: []string{"LPUSH", "{l}", "a", "b", "c"}, want: integer(3)},
+	{command: "LPUSH", name: "string key", setup: [][]string{{"SET", "{l}", "v"}}, argv: []string{"LPUSH", "{l}", "a"}, want: wrongType()},
+	{command: "LPUSH", name: "no element", argv: []string{"LPUSH", "{l}"}, want: arityErr()},
+	{command: "RPUSH", name: "returns the length", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"RPUSH", "{l}", "b"}, want: integer(2)},
+	{command: "LPUSHX", name: "missing key", argv: []string{"LPUSHX", "{l}", "a"}, want: integer(0)},
+	{command: "LPUSHX", name: "string key", setup: [][]string{{"SET", "{l}", "v"}}, argv: []string{"LPUSHX", "{l}", "a"}, want: wrongType()},
+	{command: "RPUSHX", name: "string key", setup: [][]string{{"SET", "{l}", "v"}}, argv: []string{"RPUSHX", "{l}", "a"}, want: wrongType()},
+	{command: "RPUSHX", name: "existing key", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"RPUSHX", "{l}", "b"}, want: integer(2)},
+	{command: "LRANGE", name: "LPUSH reverses", setup: [][]string{{"LPUSH", "{l}", "a", "b", "c"}}, argv: []string{"LRANGE", "{l}", "0", "-1"}, want: array("c", "b", "a")},
+	{command: "LRANGE", name: "out of range", setup: [][]string{{"RPUSH", "{l}", "a", "b", "c"}}, argv: []string{"LRANGE", "{l}", "5", "10"}, want: emptyArray()},
+	{command: "LRANGE", name: "missing key", argv: []string{"LRANGE", "{l}", "0", "-1"}, want: emptyArray()},
+	{command: "LRANGE", name: "not a number", argv: []string{"LRANGE", "{l}", "a", "-1"}, want: notInteger()},
+	{command: "LPOP", name: "existing list", setup: [][]string{{"RPUSH", "{l}", "a", "b"}}, argv: []string{"LPOP", "{l}"}, want: bulk("a")},
+	{command: "LPOP", name: "last element deletes the key", setup: [][]string{{"RPUSH", "{l}", "a"}, {"LPOP", "{l}"}}, argv: []string{"EXISTS", "{l}"}, want: integer(0)},
+	{command: "LPOP", name: "missing key", argv: []string{"LPOP", "{l}"}, want: null()},
+	{command: "RPOP", name: "existing list", setup: [][]string{{"RPUSH", "{l}", "a", "b"}}, argv: []string{"RPOP", "{l}"}, want: bulk("b")},
+	{command: "BLPOP", name: "last element deletes the key", setup: [][]string{{"RPUSH", "{l}", "a"}, {"BLPOP", "{l}", "0"}}, argv: []string{"EXISTS", "{l}"}, want: integer(0)},
+	{command: "BLPOP", name: "timeout elapses", argv: []string{"BLPOP", "{l}", "0.01"}, want: null()},
+	{command: "BLPOP", name: "string key", setup: [][]string{{"SET", "{l}", "v"}}, argv: []string{"BLPOP", "{l}", "0"}, want: wrongType()},
+	{command: "BLPOP", name: "negative timeout", argv: []string{"BLPOP", "{l}", "-1"}, want: errPrefix("ERR timeout is negative")},
+	{command: "BRPOP", name: "not a number", argv: []string{"BRPOP", "{l}", "x"}, want: errPrefix("ERR timeout is not a float or out of range")},
+	{command: "LLEN", name: "missing key", argv: []string{"LLEN", "{l}"}, want: integer(0)},
+	{command: "LLEN", name: "string key", setup: [][]string{{"SET", "{l}", "v"}}, argv: []string{"LLEN", "{l}"}, want: wrongType()},
+	{command: "LINDEX", name: "negative index", setup: [][]string{{"RPUSH", "{l}", "a", "b", "c"}}, argv: []string{"LINDEX", "{l}", "-1"}, want: bulk("c")},
+	{command: "LINDEX", name: "out of range", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"LINDEX", "{l}", "5"}, want: null()},
+	{command: "LSET", name: "existing index", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"LSET", "{l}", "0", "b"}, want: ok()},
+	{command: "LSET", name: "out of range", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"LSET", "{l}", "5", "b"}, want: errPrefix("ERR index out of range")},
+	{command: "LSET", name: "missing key", argv: []string{"LSET", "{l}", "0", "b"}, want: errPrefix("ERR no such key")},
+	{command: "LREM", name: "from the head", setup: [][]string{{"RPUSH", "{l}", "a", "b", "a", "a"}}, argv: []string{"LREM", "{l}", "2", "a"}, want: integer(2)},
+	{command: "LREM", name: "last element deletes the key", setup: [][]string{{"RPUSH", "{l}", "a", "a"}, {"LREM", "{l}", "0", "a"}}, argv: []string{"EXISTS", "{l}"}, want: integer(0)},
+	{command: "LTRIM", name: "empty range deletes the key", setup: [][]string{{"RPUSH", "{l}", "a", "b"}, {"LTRIM", "{l}", "5", "10"}}, argv: []string{"EXISTS", "{l}"}, want: integer(0)},
+	{command: "LINSERT", name: "before the pivot", setup: [][]string{{"RPUSH", "{l}", "a", "c"}}, argv: []string{"LINSERT", "{l}", "BEFORE", "c", "b"}, want: integer(3)},
+	{command: "LINSERT", name: "missing pivot", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"LINSERT", "{l}", "AFTER", "x", "b"}, want: integer(-1)},
+	{command: "LINSERT", name: "missing key", argv: []string{"LINSERT", "{l}", "BEFORE", "a", "b"}, want: integer(0)},
+	{command: "LINSERT", name: "string key", setup: [][]string{{"SET", "{l}", "v"}}, argv: []string{"LINSERT", "{l}", "BEFORE", "a", "b"}, want: wrongType()},
+	{command: "LINSERT", name: "invalid position", setup: [][]string{{"RPUSH", "{l}", "a"}}, argv: []string{"LINSERT", "{l}", "MIDDLE", "a", "b"}, want: syntaxErr()},
+	{command: "LTRIM", name: "keeps the range", setup: [][]string{{"RPUSH", "{l}", "a", "b", "c"}, {"LTRIM", "{l}", "1", "-1"}}, argv: []string{"LRANGE", "{l}", "0", "-1"}, want: array("b", "c")},
+
+	{command: "RPOP", name: "missing key", argv: []string{"RPOP", "{k}"}, want: null()},
+	{command: "LPOP", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"LPOP", "{k}"}, want: wrongType()},
+	{command: "LRANGE", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"LRANGE", "{k}", "0", "-1"}, want: wrongType()},
+	{command: "LINDEX", name: "missing key", argv: []string{"LINDEX", "{k}", "0"}, want: null()},
+	{command: "LINDEX", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"LINDEX", "{k}", "0"}, want: wrongType()},
+	{command: "LREM", name: "missing key", argv: []string{"LREM", "{k}", "0", "a"}, want: integer(0)},
+	{command: "LTRIM", name: "set key", setup: [][]string{{"SADD", "{k}", "a"}}, argv: []string{"LTRIM", "{k}", "0", "1"}, want: wrongType()},
+	// Hashes
+	{command: "HSET", name: "new fields", argv: []string{"HSET", "{h}", "f1", "v1", "f2", "v2"}, want: integer(2)},
+	{command: "HSET", name: "existing field", setup: [][]string{{"HSET", "{h}", "f", "v"}}, argv: []string{"HSET", "{h}", "f", "w"}, want: integer(0)},
+	{command: "HSET", name: "odd arguments", argv: []string{"HSET", "{h}", "f1", "v1", "f2"}, want: arityErr()},
+	{command: "HSET", name: "string key", setup: [][]string{{"SET", "{h}", "v"}}, argv: []string{"HSET", "{h}", "f", "v"}, want: wrongType()},
+	{command: "HMSET", name: "replies OK", argv: []string{"HMSET", "{h}", "f1", "v1", "f2", "v2"}, want: ok()},
+	{command: "HMSET", name: "odd arguments", argv: []string{"HMSET", "{h}", "f1", "v1", "f2"}, want: arityErr()},
+	{command: "HGET", name: "existing field", setup: [][]string{{"HSET", "{h}", "f", "v"}}, argv: []string{"HGET", "{h}", "f"}, want: bulk("v")},
+	{command: "HGET", name: "missing field", setup: [][]string{{"HSET", "{h}", "f", "v"}}, argv: []string{"HGET", "{h}", "g"}, want: null()},
+	{command: "HDEL", name: "existing and missing fields", setup: [][]string{{"HSET", "{h}", "f", "v"}}, argv: []string{"HDEL", "{h}", "f", "g"}, want: integer(1)},
+	{command: "HEXISTS", name: "missing field", setup: [][]string{{"HSET", "{h}", "f", "v"}}, argv: []string{"HEXISTS", "{h}", "g"}, want: integer(0)},
+	{command: "HLEN", name: "existing hash", setup: [][]string{{"HSET", "{h}", "f", "v"}, {"HSET", "{h}", "g", "w"}}, argv: []string{"HLEN", "{h}"}, want: integer(2)},
+	{command: "HDEL", name: "last field deletes the key", setup: [][]string{{"HSET", "{h}", "f", "v"}, {"HDEL", "{h}", "f"}}, argv: []string{"EXISTS", "{h}"}, want: integer(0)},
+	{command: "HGETALL", name: "fields and values", setup: [][]string{{"HSET", "{h}", "f", "v"}, {"HSET", "{h}", "g", "w"}}, argv: []string{"HGETALL", "{h}"}, want: pairs("f", "v", "g", "w")},
+	{command: "HGETALL", name: "missing key", argv: []string{"HGETALL", "{h}"}, want: emptyArray()},
+
+	{command: "HGET", name: "missing key", argv: []string{"HGET", "{k}", "f"}, want: null()},
+	{command: "HGET", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"HGET", "{k}", "f"}, want: wrongType()},
+	{command: "HDEL", name: "missing key", argv: []string{"HDEL", "{k}", "f"}, want: integer(0)},
+	{command: "HLEN", name: "missing key", argv: []string{"HLEN", "{k}"}, want: integer(0)},
+	{command: "HEXISTS", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"HEXISTS", "{k}", "f"}, want: wrongType()},
+	{command: "HGETALL", name: "list key", setup: [][]string{{"RPUSH", "{k}", "a"}}, argv: []string{"HGETALL", "{k}"}, want: wrongType()},
+	// Sets
+	{command: "SREM", name: "last member deletes the key", setup: [][]string{{"SADD", "{s}", "a"}, {"SREM", "{s}", "a"}}, argv: []string{"EXISTS", "{s}"}, want: integer(0)},
+	{command: "SPOP", name: "last member deletes the key", setup: [][]string{{"SADD", "{s}", "a", "b"}, {"SPOP", "{s}", "5"}}, argv: []string{"EXISTS", "{s}"}, want: integer(0)},
+	{command: "SADD", name: "counts new members", setup: [][]string{{"SADD", "{s}", "a"}}, argv: []string{"SADD", "{s}", "a", "b", "b"}, want: integer(1)},
+	{command: "SADD", name: "string key", setup: [][]string{{"SET", "{s}", "v"}}, argv: []string{"SADD", "{s}", "a"}, want: wrongType()},
+	{command: "SREM", name: "existing and missing members", setup: [][]string{{"SADD", "{s}", "a", "b"}}, argv: []string{"SREM", "{s}", "a", "c"}, want: integer(1)},
+	{command: "SISMEMBER", name: "member", setup: [][]string{{"SADD", "{s}", "a"}}, argv: []string{"SISMEMBER", "{s}", "a"}, want: integer(1)},
+	{command: "SCARD", name: "missing key", argv: []string{"SCARD", "{s}"}, want: integer(0)},
+	{command: "SMEMBERS", name: "members", setup: [][]string{{"SADD", "{s}", "a", "b", "c"}}, argv: []string{"SMEMBERS", "{s}"}, want: unordered("a", "b", "c")},
+	{command: "SPOP", name: "missing key", argv: []string{"SPOP", "{s}"}, want: null()},
+	{command: "SPOP", name: "single member as a bulk string", setup: [][]string{{"SADD", "{s}", "a"}}, argv: []string{"SPOP", "{s}"}, want: bulk("a")},
+	{command: "SPOP", name: "count as an array", setup: [][]string{{"SADD", "{s}", "a"}}, argv: []string{"SPOP", "{s}", "5"}, want: array("a")},
+	{command: "SPOP", name: "zero count", setup: [][]string{{"SADD", "{s}", "a"}}, argv: []string{"SPOP", "{s}", "0"}, want: emptyArray()},
+	{command: "SPOP", name: "negative count", setup: [][]string{{"SADD", "{s}", "a"}}, argv: []string{"SPOP", "{s}", "-1"}, want: errPrefix("ERR value is out of range, must be positive")},
+	{command: "SRANDMEMBER", name: "count larger than the set", setup: [][]string{{"SADD", "{s}", "a", "b"}}, argv: []string{"SRANDMEMBER", "{s}", "5"}, want: unordered("a", "b")},
+	{command: "SINTER", name: "intersection", setup: [][]string{{"SADD", "{a}", "x", "y", "z"}, {"SADD", "{b}", "y", "z", "w"}}, argv: []string{"SINTER", "{a}", "{b}"}, want: unordered("y", "z")},
+	{command: "SINTER", name: "missing key", setup: [][]string{{"SADD", "{a}", "x"}}, argv: []string{"SINTER", "{a}", "{b}"}, want: emptyArray()},
+	{command: "SINTER", name: "string key after a missing key", setup: [][]string{{"SET", "{b}", "v"}}, argv: []string{"SINTER", "{a}", "{b}"}, want: wrongType()},
+	{command: "SUNION", name: "union", setup: [][]string{{"SADD", "{a}", "x"}, {"SADD", "{b}", "y"}}, argv: []string{"SUNION", "{a}", "{b}"}, want: unordered("x", "y")},
+	{command: "SDIFF", name: "difference", setup: [][]string{{"SADD", "{a}", "x", "y"}, {"SADD", "{b}", "y"}}, argv: []string{"SDIFF", "{a}", "{b}"}, want: unordered("x")},
+	{command: "SDIFF", name: "string key", setup: [][]string{{"SET", "{a}", "v"}}, argv: []string{"SDIFF", "{a}", "{b}"}, want: wrongType()},
+	{command: "SDIFF", name: "string key after a missing key", setup: [][]string{{"SET", "{b}", "v"}}, argv: []string{"SDIFF", "{a}", "{b}"}, want: wrongType()},
+
+	{command: "SISMEMBER", name: "missing key", argv: []string{"SISMEMBER", "{k}", "a"}, want: integer(0)},
+	{command: "SMEMBERS", name: "missing key", argv: []string{"SMEMBERS", "{k}"}, want: emptyArray()},
+	{command: "SMEMBERS", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"SMEMBERS", "{k}"}, want: wrongType()},
+	{command: "SREM", name: "missing key", argv: []string{"SREM", "{k}", "a"}, want: integer(0)},
+	{command: "SRANDMEMBER", name: "missing key", argv: []string{"SRANDMEMBER", "{k}"}, want: null()},
+	{command: "SRANDMEMBER", name: "single member as a bulk string", setup: [][]string{{"SADD", "{k}", "a"}}, argv: []string{"SRANDMEMBER", "{k}"}, want: bulk("a")},
+	{command: "SRANDMEMBER", name: "count on a missing key", argv: []string{"SRANDMEMBER", "{k}", "2"}, want: emptyArray()},
+	{command: "SCARD", name: "hash key", setup: [][]string{{"HSET", "{k}", "f", "v"}}, argv: []string{"SCARD", "{k}"}, want: wrongType()},
+	{command: "SINTER", name: "string key", setup: [][]string{{"SET", "{a}", "v"}}, argv: []string{"SINTER", "{a}", "{b}"}, want: wrongType()},
+	{command: "SUNION", name: "string key", setup: [][]string{{"SADD", "{a}", "x"}, {"SET", "{b}", "v"}}, argv: []string{"SUNION", "{a}", "{b}"}, want: wrongType()},
+	// Sorted sets
+	{command: "ZREM", name: "last member deletes the key", setup: [][]string{{"ZADD", "{z}", "1", "a"}, {"ZREM", "{z}", "a"}}, argv: []string{"EXISTS", "{z}"}, want: integer(0)},
+	{command: "ZADD", name: "counts new members", argv: []string{"ZADD", "{z}", "1", "a", "2", "b"}, want: integer(2)},
+	{command: "ZADD", name: "updated scores are not counted", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZADD", "{z}", "2", "a", "1", "b"}, want: integer(1)},
+	{command: "ZADD", name: "CH counts updated scores", setup: [][]string{{"ZADD", "{z}", "1", "a", "1", "c"}}, argv: []string{"ZADD", "{z}", "CH", "2", "a", "1", "b", "1", "c"}, want: integer(2)},
+	{command: "ZADD", name: "CH without a member", argv: []string{"ZADD", "{z}", "CH", "1"}, want: syntaxErr()},
+	{command: "ZADD", name: "not a float", argv: []string{"ZADD", "{z}", "x", "a"}, want: notFloat()},
+	{command: "ZADD", name: "odd arguments", argv: []string{"ZADD", "{z}", "1", "a", "2"}, want: syntaxErr()},
+	{command: "ZADD", name: "string key", setup: [][]string{{"SET", "{z}", "v"}}, argv: []string{"ZADD", "{z}", "1", "a"}, want: wrongType()},
+	{command: "ZADD", name: "NX leaves existing members", setup: [][]string{{"ZADD", "{z}", "1", "a"}, {"ZADD", "{z}", "NX", "2", "a", "1", "b"}}, argv: []string{"ZRANGE", "{z}", "0", "-1", "WITHSCORES"}, want: array("a", "1", "b", "1")},
+	{command: "ZADD", name: "XX adds no members", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZADD", "{z}", "XX", "CH", "2", "a", "1", "b"}, want: integer(1)},
+	{command: "ZADD", name: "XX does not create the key", setup: [][]string{{"ZADD", "{y}", "XX", "1", "a"}}, argv: []string{"EXISTS", "{y}"}, want: integer(0)},
+	{command: "ZADD", name: "NX and XX together", argv: []string{"ZADD", "{z}", "NX", "XX", "1", "a"}, want: errPrefix("ERR XX and NX options at the same time are not compatible")},
+	{command: "ZADD", name: "NX and GT together", argv: []string{"ZADD", "{z}", "NX", "GT", "1", "a"}, want: errPrefix("ERR GT, LT, and/or NX options at the same time are not compatible")},
+	{command: "ZADD", name: "NX and LT together", argv: []string{"ZADD", "{z}", "LT", "NX", "1", "a"}, want: errPrefix("ERR GT, LT, and/or NX options at the same time are not compatible")},
+	{command: "ZADD", name: "GT and LT together", argv: []string{"ZADD", "{z}", "GT", "LT", "1", "a"}, want: errPrefix("ERR GT, LT, and/or NX options at the same time are not compatible")},
+	{command: "ZADD", name: "GT CH counts raised scores and new members", setup: [][]string{{"ZADD", "{z}", "1", "a", "5", "b"}}, argv: []string{"ZADD", "{z}", "GT", "CH", "2", "a", "3", "b", "1", "c"}, want: integer(2)},
+	{command: "ZADD", name: "LT CH counts lowered scores and new members", setup: [][]string{{"ZADD", "{z}", "1", "a", "5", "b"}}, argv: []string{"ZADD", "{z}", "LT", "CH", "2", "a", "3", "b", "1", "c"}, want: integer(2)},
+	{command: "ZADD", name: "GT without CH counts new members", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZADD", "{z}", "GT", "2", "a", "1", "b"}, want: integer(1)},
+	{command: "ZADD", name: "GT keeps a greater score", setup: [][]string{{"ZADD", "{z}", "5", "a"}, {"ZADD", "{z}", "GT", "2", "a"}}, argv: []string{"ZSCORE", "{z}", "a"}, want: bulk("5")},
+	{command: "ZADD", name: "XX LT CH updates existing members only", setup: [][]string{{"ZADD", "{z}", "5", "a"}}, argv: []string{"ZADD", "{z}", "XX", "LT", "CH", "2", "a", "1", "b"}, want: integer(1)},
+	{command: "GEOADD", name: "GT is not an option", argv: []string{"GEOADD", "{g}", "GT", "13.361389", "38.115556", "Palermo"}, want: syntaxErr()},
+	{command: "ZSCORE", name: "score as a bulk string", setup: [][]string{{"ZADD", "{z}", "1.5", "a"}}, argv: []string{"ZSCORE", "{z}", "a"}, want: bulk("1.5")},
+	{command: "ZSCORE", name: "infinite score", setup: [][]string{{"ZADD", "{z}", "+inf", "a"}}, argv: []string{"ZSCORE", "{z}", "a"}, want: bulk("inf")},
+	{command: "ZSCORE", name: "large score with an exponent", setup: [][]string{{"ZADD", "{z}", "1e300", "a"}}, argv: []string{"ZSCORE", "{z}", "a"}, want: bulk("1e+300")},
+	{command: "ZSCORE", name: "missing member", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZSCORE", "{z}", "b"}, want: null()},
+	{command: "ZINCRBY", name: "new member", argv: []string{"ZINCRBY", "{z}", "2.5", "a"}, want: bulk("2.5")},
+	{command: "ZCARD", name: "members", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}}, argv: []string{"ZCARD", "{z}"}, want: integer(2)},
+	{command: "ZREM", name: "existing and missing members", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZREM", "{z}", "a", "b"}, want: integer(1)},
+	{command: "ZRANGE", name: "by rank", setup: [][]string{{"ZADD", "{z}", "2", "b", "1", "a", "3", "c"}}, argv: []string{"ZRANGE", "{z}", "0", "-1"}, want: array("a", "b", "c")},
+	{command: "ZRANGE", name: "with scores", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}}, argv: []string{"ZRANGE", "{z}", "0", "-1", "WITHSCORES"}, want: array("a", "1", "b", "2")},
+	{command: "ZRANGE", name: "scores as ZSCORE writes them", setup: [][]string{{"ZADD", "{z}", "1e300", "a", "+inf", "b"}}, argv: []string{"ZRANGE", "{z}", "0", "-1", "WITHSCORES"}, want: array("a", "1e+300", "b", "inf")},
+	{command: "ZRANGE", name: "ties by member", setup: [][]string{{"ZADD", "{z}", "1", "b", "1", "a"}}, argv: []string{"ZRANGE", "{z}", "0", "-1"}, want: array("a", "b")},
+	{command: "ZRANGE", name: "BYSCORE REV LIMIT", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b", "3", "c"}}, argv: []string{"ZRANGE", "{z}", "(3", "-inf", "BYSCORE", "REV", "LIMIT", "1", "5"}, want: array("a")},
+	{command: "ZRANGE", name: "LIMIT without BYSCORE", argv: []string{"ZRANGE", "{z}", "0", "-1", "LIMIT", "0", "1"}, want: errPrefix("ERR syntax error, LIMIT is only supported")},
+	{command: "ZREVRANGE", name: "by rank", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}}, argv: []string{"ZREVRANGE", "{z}", "0", "-1"}, want: array("b", "a")},
+	{command: "ZRANGEBYSCORE", name: "exclusive and infinite bounds", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b", "3", "c"}}, argv: []string{"ZRANGEBYSCORE", "{z}", "(1", "+inf"}, want: array("b", "c")},
+	{command: "ZRANGEBYSCORE", name: "limit", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b", "3", "c"}}, argv: []string{"ZRANGEBYSCORE", "{z}", "-inf", "+inf", "LIMIT", "1", "1"}, want: array("b")},
+	{command: "ZRANGEBYSCORE", name: "invalid bound", argv: []string{"ZRANGEBYSCORE", "{z}", "x", "1"}, want: errPrefix("ERR min or max is not a float")},
+	{command: "ZREVRANGEBYSCORE", name: "max first", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}}, argv: []string{"ZREVRANGEBYSCORE", "{z}", "+inf", "-inf"}, want: array("b", "a")},
+	{command: "ZCOUNT", name: "inclusive bounds", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b", "3", "c"}}, argv: []string{"ZCOUNT", "{z}", "1", "2"}, want: integer(2)},
+	{command: "ZRANK", name: "member", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}}, argv: []string{"ZRANK", "{z}", "b"}, want: integer(1)},
+	{command: "ZRANK", name: "missing member", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZRANK", "{z}", "b"}, want: null()},
+	{command: "ZREVRANK", name: "member", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}}, argv: []string{"ZREVRANK", "{z}", "b"}, want: integer(0)},
+	{command: "ZREMRANGEBYSCORE", name: "exclusive bound", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b", "3", "c"}}, argv: []string{"ZREMRANGEBYSCORE", "{z}", "(1", "2"}, want: integer(1)},
+	{command: "ZREMRANGEBYSCORE", name: "last member deletes the key", setup: [][]string{{"ZADD", "{z}", "1", "a"}, {"ZREMRANGEBYSCORE", "{z}", "-inf", "+inf"}}, argv: []string{"EXISTS", "{z}"}, want: integer(0)},
+	{command: "ZREMRANGEBYSCORE", name: "type of the deleted key", setup: [][]string{{"ZADD", "{z}", "1", "a"}, {"ZREMRANGEBYSCORE", "{z}", "-inf", "+inf"}}, argv: []string{"TYPE", "{z}"}, want: simple("none")},
+	{command: "ZREMRANGEBYSCORE", name: "not a float", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZREMRANGEBYSCORE", "{z}", "x", "1"}, want: errPrefix("ERR min or max is not a float")},
+	{command: "ZREMRANGEBYRANK", name: "negative ranks", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b", "3", "c"}}, argv: []string{"ZREMRANGEBYRANK", "{z}", "-2", "-1"}, want: integer(2)},
+	{command: "ZREMRANGEBYRANK", name: "last member deletes the key", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}, {"ZREMRANGEBYRANK", "{z}", "0", "-1"}}, argv: []string{"EXISTS", "{z}"}, want: integer(0)},
+	{command: "ZREMRANGEBYRANK", name: "type of the deleted key", setup: [][]string{{"ZADD", "{z}", "1", "a", "2", "b"}, {"ZREMRANGEBYRANK", "{z}", "0", "-1"}}, argv: []string{"TYPE", "{z}"}, want: simple("none")},
+	{command: "ZREMRANGEBYRANK", name: "not an integer", setup: [][]string{{"ZADD", "{z}", "1", "a"}}, argv: []string{"ZREMRANGEBYRANK", "{z}", "a", "1"}, want: notInteger()},
+
+	{command: "ZSCORE", name: "missing key", argv: []string{"ZSCORE", "{k}", "a"}, want: null()},
+	{command: "ZSCORE", name: "set key", setup: [][]string{{"SADD", "{k}", "a"}}, argv: []string{"ZSCORE", "{k}", "a"}, want: wrongType()},
+	{command: "ZCARD", name: "missing key", argv: []string{"ZCARD", "{k}"}, want: integer(0)},
+	{command: "ZRANGE", name: "missing key", argv: []string{"ZRANGE", "{k}", "0", "-1"}, want: emptyArray()},
+	{command: "ZRANGE", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"ZRANGE", "{k}", "0", "-1"}, want: wrongType()},
+	{command: "ZREM", name: "missing key", argv: []string{"ZREM", "{k}", "a"}, want: integer(0)},
+	{command: "ZRANK", name: "missing key", argv: []string{"ZRANK", "{k}", "a"}, want: null()},
+	{command: "ZCOUNT", name: "missing key", argv: []string{"ZCOUNT", "{k}", "-inf", "+inf"}, want: integer(0)},
+	{command: "ZINCRBY", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"ZINCRBY", "{k}", "1", "a"}, want: wrongType()},
+	{command: "ZREMRANGEBYSCORE", name: "missing key", argv: []string{"ZREMRANGEBYSCORE", "{k}", "-inf", "+inf"}, want: integer(0)},
+	{command: "ZREMRANGEBYRANK", name: "string key", setup: [][]string{{"SET", "{k}", "v"}}, argv: []string{"ZREMRANGEBYRANK", "{k}", "0", "-1"}, want: wrongType()},
+	// Streams
+	{command: "XADD", name: "explicit ID", argv: []string{"XADD", "{x}", "1-1", "f", "v"}, want: bulk("1-1")},
+	{command: "XADD", name: "milliseconds only", setup: [][]string{{"XADD", "{x}", "5-3", "f", "v"}}, argv: []string{"XADD", "{x}", "5", "f", "v"}, want: bulk("5-4")},
+	{command: "XADD", name: "generated sequence", setup: [][]string{{"XADD", "{x}", "5-3", "f", "v"}}, argv: []string{"XADD", "{x}", "6-*", "f", "v"}, want: bulk("6-0")},
+	{command: "XADD", name: "ID not greater", setup: [][]string{{"XADD", "{x}", "5-3", "f", "v"}}, argv: []string{"XADD", "{x}", "5-3", "f", "v"}, want: errPrefix("ERR The ID specified in XADD is equal or smaller than the target stream top item")},
+	{command: "XADD", name: "0-0", argv: []string{"XADD", "{x}", "0-0", "f", "v"}, want: errPrefix("ERR The ID specified in XADD must be greater than 0-0")},
+	{command: "XADD", name: "invalid ID", argv: []string{"XADD", "{x}", "a-b", "f", "v"}, want: errPrefix("ERR Invalid stream ID specified as stream command argument")},
+	{command: "XADD", name: "odd arguments", argv: []string{"XADD", "{x}", "*", "f", "v", "g"}, want: arityErr()},
+	{command: "XADD", name: "NOMKSTREAM on a missing key", argv: []string{"XADD", "{x}", "NOMKSTREAM", "*", "f", "v"}, want: null()},
+	{command: "XADD", name: "string key", setup: [][]string{{"SET", "{x}", "v"}}, argv: []string{"XADD", "{x}", "*", "f", "v"}, want: wrongType()},
+	{command: "XADD", name: "MAXLEN", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XADD", "{x}", "3-1", "f", "v"}}, argv: []string{"XADD", "{x}", "MAXLEN", "2", "4-1", "f", "v"}, want: bulk("4-1")},
+	{command: "XADD", name: "MAXLEN and MINID together", argv: []string{"XADD", "{x}", "MAXLEN", "2", "MINID", "1", "*", "f", "v"}, want: errPrefix("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")},
+	{command: "XADD", name: "LIMIT without ~", argv: []string{"XADD", "{x}", "MAXLEN", "2", "LIMIT", "10", "*", "f", "v"}, want: errPrefix("ERR syntax error, LIMIT cannot be used without the special ~ option")},
+	{command: "XADD", name: "negative MAXLEN", argv: []string{"XADD", "{x}", "MAXLEN", "-1", "*", "f", "v"}, want: errPrefix("ERR The MAXLEN argument must be >= 0.")},
+	{command: "XTRIM", name: "MAXLEN", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XADD", "{x}", "3-1", "f", "v"}}, argv: []string{"XTRIM", "{x}", "MAXLEN", "=", "1"}, want: integer(2)},
+	{command: "XTRIM", name: "MINID", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XADD", "{x}", "3-1", "f", "v"}}, argv: []string{"XTRIM", "{x}", "MINID", "2-1"}, want: integer(1)},
+	{command: "XTRIM", name: "approximate MAXLEN within a node", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XADD", "{x}", "3-1", "f", "v"}}, argv: []string{"XTRIM", "{x}", "MAXLEN", "~", "1"}, want: integer(0)},
+	{command: "XTRIM", name: "without a strategy", argv: []string{"XTRIM", "{x}", "LIMIT", "0", "x"}, want: errPrefix("ERR syntax error")},
+	{command: "XTRIM", name: "missing key", argv: []string{"XTRIM", "{x}", "MAXLEN", "0"}, want: integer(0)},
+	{command: "XLEN", name: "missing key", argv: []string{"XLEN", "{x}"}, want: integer(0)},
+	{command: "XDEL", name: "last entry keeps the key", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XDEL", "{x}", "1-1"}}, argv: []string{"EXISTS", "{x}"}, want: integer(1)},
+	{command: "XRANGE", name: "all entries", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}}, argv: []string{"XRANGE", "{x}", "-", "+"}, want: entryIDs("1-1", "2-1")},
+	{command: "XRANGE", name: "exclusive start", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}}, argv: []string{"XRANGE", "{x}", "(1-1", "+"}, want: entryIDs("2-1")},
+	{command: "XRANGE", name: "end without sequence", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}}, argv: []string{"XRANGE", "{x}", "-", "1"}, want: entryIDs("1-1")},
+	{command: "XRANGE", name: "missing key", argv: []string{"XRANGE", "{x}", "-", "+"}, want: emptyArray()},
+	{command: "XREVRANGE", name: "count", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}}, argv: []string{"XREVRANGE", "{x}", "+", "-", "COUNT", "1"}, want: entryIDs("2-1")},
+	{command: "XREAD", name: "nothing new", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}}, argv: []string{"XREAD", "STREAMS", "{x}", "$"}, want: null()},
+	{command: "XREAD", name: "unbalanced streams", argv: []string{"XREAD", "STREAMS", "{x}", "{y}", "0"}, want: errPrefix("ERR Unbalanced 'xread' list of streams")},
+	{command: "XREAD", name: "> without a group", argv: []string{"XREAD", "STREAMS", "{x}", ">"}, want: errPrefix("ERR The > ID can be specified only when calling XREADGROUP")},
+	{command: "XREAD", name: "BLOCK with entries to read", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}}, argv: []string{"XREAD", "BLOCK", "0", "STREAMS", "{x}", "0"}, want: func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Array && len(v.Array) == 1, "[[{x} [[1-1 [f v]]]]]"
+	}},
+	{command: "XREAD", name: "BLOCK timeout", argv: []string{"XREAD", "BLOCK", "10", "STREAMS", "{x}", "$"}, want: null()},
+	{command: "XREAD", name: "negative BLOCK", argv: []string{"XREAD", "BLOCK", "-1", "STREAMS", "{x}", "$"}, want: errPrefix("ERR timeout is negative")},
+	{command: "XREADGROUP", name: "missing group", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}}, argv: []string{"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}, want: errPrefix("NOGROUP No such key")},
+	{command: "XGROUP", name: "create on a missing key", argv: []string{"XGROUP", "CREATE", "{x}", "g", "$"}, want: errPrefix("ERR The XGROUP subcommand requires the key to exist")},
+	{command: "XGROUP", name: "create with MKSTREAM", argv: []string{"XGROUP", "CREATE", "{x}", "g", "$", "MKSTREAM"}, want: ok()},
+	{command: "XGROUP", name: "existing group", setup: [][]string{{"XGROUP", "CREATE", "{x}", "g", "$", "MKSTREAM"}}, argv: []string{"XGROUP", "CREATE", "{x}", "g", "$"}, want: errPrefix("BUSYGROUP")},
+	{command: "XGROUP", name: "destroy", setup: [][]string{{"XGROUP", "CREATE", "{x}", "g", "$", "MKSTREAM"}}, argv: []string{"XGROUP", "DESTROY", "{x}", "g"}, want: integer(1)},
+	{command: "XGROUP", name: "consumer of a missing group", setup: [][]string{{"XGROUP", "CREATE", "{x}", "g", "$", "MKSTREAM"}}, argv: []string{"XGROUP", "CREATECONSUMER", "{x}", "h", "c"}, want: errPrefix("NOGROUP No such consumer group 'h'")},
+	{command: "XGROUP", name: "help", argv: []string{"XGROUP", "HELP"}, want: help("XGROUP")},
+	{command: "XACK", name: "pending entry", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}}, argv: []string{"XACK", "{x}", "g", "1-1", "2-1"}, want: integer(1)},
+	{command: "XPENDING", name: "no pending entries", setup: [][]string{{"XGROUP", "CREATE", "{x}", "g", "$", "MKSTREAM"}}, argv: []string{"XPENDING", "{x}", "g", "-", "+", "10"}, want: emptyArray()},
+	{command: "XPENDING", name: "missing group", argv: []string{"XPENDING", "{x}", "g"}, want: errPrefix("NOGROUP No such key")},
+	{command: "XCLAIM", name: "JUSTID", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}}, argv: []string{"XCLAIM", "{x}", "g", "d", "0", "1-1", "3-1", "JUSTID"}, want: array("1-1")},
+	{command: "XCLAIM", name: "not idle long enough", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}}, argv: []string{"XCLAIM", "{x}", "g", "d", "3600000", "1-1"}, want: emptyArray()},
+	{command: "XCLAIM", name: "deleted entry", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}, {"XDEL", "{x}", "1-1"}}, argv: []string{"XCLAIM", "{x}", "g", "d", "0", "1-1", "2-1", "JUSTID"}, want: array("2-1")},
+	{command: "XCLAIM", name: "unknown option", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}}, argv: []string{"XCLAIM", "{x}", "g", "d", "0", "1-1", "NOPE"}, want: errPrefix("ERR Unrecognized XCLAIM option 'NOPE'")},
+	{command: "XCLAIM", name: "missing group", argv: []string{"XCLAIM", "{x}", "g", "d", "0", "1-1"}, want: errPrefix("NOGROUP No such key")},
+	{command: "XAUTOCLAIM", name: "cursor", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}}, argv: []string{"XAUTOCLAIM", "{x}", "g", "d", "0", "-", "COUNT", "1", "JUSTID"}, want: func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Array && len(v.Array) == 3 && v.Array[0].Str == "2-1" && len(v.Array[1].Array) == 1 && v.Array[1].Array[0].Str == "1-1", "[2-1 [1-1] []]"
+	}},
+	{command: "XAUTOCLAIM", name: "COUNT 0", setup: [][]string{{"XADD", "{x}", "1-1", "f", "v"}, {"XADD", "{x}", "2-1", "f", "v"}, {"XGROUP", "CREATE", "{x}", "g", "0"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "{x}", ">"}}, argv: []string{"XAUTOCLAIM", "{x}", "g", "d", "0", "-", "COUNT", "0"}, want: errPrefix("ERR COUNT must be > 0")},
+	{command: "XSETID", name: "smaller than the last entry", setup: [][]string{{"XADD", "{x}", "5-1", "f", "v"}}, argv: []string{"XSETID", "{x}", "4-1"}, want: errPrefix("ERR The ID specified in XSETID is smaller than the target stream top item")},
+	{command: "XSETID", name: "ENTRIESADDED below the length", setup: [][]string{{"XADD", "{x}", "5-1", "f", "v"}}, argv: []string{"XSETID", "{x}", "6-1", "ENTRIESADDED", "0"}, want: errPrefix("ERR The entries_added specified in XSETID is smaller than the target stream length")},
+	{command: "XSETID", name: "missing key", argv: []string{"XSETID", "{x}", "1-1"}, want: errPrefix("ERR no such key")},
+	{command: "XSETID", name: "next XADD", setup: [][]string{{"XADD", "{x}", "5-1", "f", "v"}, {"XSETID", "{x}", "9-9"}}, argv: []string{"XADD", "{x}", "9-9", "f", "v"}, want: errPrefix("ERR The ID specified in XADD is equal or smaller")},
+	{command: "XINFO", name: "stream of a missing key", argv: []string{"XINFO", "STREAM", "{x}"}, want: errPrefix("ERR no such key")},
+	{command: "XINFO", name: "groups of a string key", setup: [][]string{{"SET", "{x}", "v"}}, argv: []string{"XINFO", "GROUPS", "{x}"}, want: wrongType()},
+	{command: "XINFO", name: "help", argv: []string{"XINFO", "HELP"}, want: help("XINFO")},
+	// HyperLogLog
+	{command: "PFADD", name: "new key", argv: []string{"PFADD", "{h}", "foo", "bar", "zap"}, want: integer(1)},
+	{command: "PFADD", name: "new key without elements", argv: []string{"PFADD", "{h}"}, want: integer(1)},
+	{command: "PFADD", name: "no register changed", setup: [][]string{{"PFADD", "{h}", "foo", "bar", "zap"}}, argv: []string{"PFADD", "{h}", "zap", "zap", "foo"}, want: integer(0)},
+	{command: "PFADD", name: "string key", setup: [][]string{{"SET", "{h}", "v"}}, argv: []string{"PFADD", "{h}", "a"}, want: errPrefix("WRONGTYPE Key is not a valid HyperLogLog string value.")},
+	{command: "PFADD", name: "list key", setup: [][]string{{"RPUSH", "{h}", "a"}}, argv: []string{"PFADD", "{h}", "a"}, want: wrongType()},
+	{command: "PFCOUNT", name: "single key", setup: [][]string{{"PFADD", "{h}", "foo", "bar", "zap"}}, argv: []string{"PFCOUNT", "{h}"}, want: integer(3)},
+	{command: "PFCOUNT", name: "missing key", argv: []string{"PFCOUNT", "{h}"}, want: integer(0)},
+	{command: "PFCOUNT", name: "union", setup: [][]string{{"PFADD", "{h}", "foo", "bar", "zap"}, {"PFADD", "{g}", "1", "2", "3"}}, argv: []string{"PFCOUNT", "{h}", "{g}"}, want: integer(6)},
+	{command: "PFMERGE", name: "union", setup: [][]string{{"PFADD", "{h}", "foo", "bar", "zap"}, {"PFADD", "{g}", "1", "2", "3"}, {"PFMERGE", "{m}", "{h}", "{g}"}}, argv: []string{"PFCOUNT", "{m}"}, want: integer(6)},
+	{command: "PFMERGE", name: "keeps sparse sources sparse", setup: [][]string{{"PFADD", "{h}", "a"}, {"PFMERGE", "{m}", "{h}"}}, argv: []string{"PFDEBUG", "ENCODING", "{m}"}, want: simple("sparse")},
+	{command: "PFMERGE", name: "dense if a source is", setup: [][]string{{"PFADD", "{h}", "a"}, {"PFDEBUG", "TODENSE", "{h}"}, {"PFMERGE", "{m}", "{h}"}}, argv: []string{"PFDEBUG", "ENCODING", "{m}"}, want: simple("dense")},
+	{command: "PFDEBUG", name: "ENCODING of a new key", setup: [][]string{{"PFADD", "{h}", "a"}}, argv: []string{"PFDEBUG", "ENCODING", "{h}"}, want: simple("sparse")},
+	{command: "PFDEBUG", name: "TODENSE", setup: [][]string{{"PFADD", "{h}", "a"}}, argv: []string{"PFDEBUG", "TODENSE", "{h}"}, want: integer(1)},
+	{command: "PFDEBUG", name: "DECODE of an empty key", setup: [][]string{{"PFADD", "{h}"}}, argv: []string{"PFDEBUG", "DECODE", "{h}"}, want: simple("Z:16384")},
+	{command: "PFDEBUG", name: "DECODE of a dense key", setup: [][]string{{"PFADD", "{h}", "a"}, {"PFDEBUG", "TODENSE", "{h}"}}, argv: []string{"PFDEBUG", "DECODE", "{h}"}, want: errPrefix("ERR HLL encoding is not sparse")},
+	{command: "PFDEBUG", name: "GETREG", setup: [][]string{{"PFADD", "{h}", "a"}}, argv: []string{"PFDEBUG", "GETREG", "{h}"}, want: func(v resp.RespValue) (bool, string) {
+		set := 0
+		for _, r := range v.Array {
+			if r.Num != 0 {
+				set++
+			}
+		}
+		return v.Type == resp.Array && len(v.Array) == 16384 && set == 1, "16384 registers, one of them set"
+	}},
+	{command: "PFDEBUG", name: "missing key", argv: []string{"PFDEBUG", "GETREG", "{h}"}, want: errPrefix("ERR The specified key does not exist")},
+	{command: "PFDEBUG", name: "unknown subcommand", setup: [][]string{{"PFADD", "{h}", "a"}}, argv: []string{"PFDEBUG", "NOPE", "{h}"}, want: errPrefix("ERR Unknown PFDEBUG subcommand 'NOPE'")},
+
+	// Geo
+	{command: "GEOADD", name: "new members", argv: append([]string{"GEOADD", "{g}"}, sicily...), want: integer(2)},
+	{command: "GEOADD", name: "NX leaves existing members", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOADD", "{g}", "NX", "CH", "13", "38", "Palermo"}, want: integer(0)},
+	{command: "GEOADD", name: "XX CH counts moved members", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOADD", "{g}", "XX", "CH", "13", "38", "Palermo", "14", "38", "Messina"}, want: integer(1)},
+	{command: "GEOADD", name: "NX and XX together", argv: []string{"GEOADD", "{g}", "NX", "XX", "13", "38", "Palermo"}, want: syntaxErr()},
+	{command: "GEOADD", name: "incomplete position", argv: []string{"GEOADD", "{g}", "13", "38", "Palermo", "15"}, want: syntaxErr()},
+	{command: "GEOADD", name: "invalid position", argv: []string{"GEOADD", "{g}", "13", "86", "Pole"}, want: errPrefix("ERR invalid longitude,latitude pair 13.000000,86.000000")},
+	{command: "GEOADD", name: "list key", setup: [][]string{{"RPUSH", "{g}", "a"}}, argv: []string{"GEOADD", "{g}", "13", "38", "Palermo"}, want: wrongType()},
+	{command: "GEODIST", name: "meters", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEODIST", "{g}", "Palermo", "Catania"}, want: bulk("166274.1516")},
+	{command: "GEODIST", name: "kilometers", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEODIST", "{g}", "Palermo", "Catania", "km"}, want: bulk("166.2742")},
+	{command: "GEODIST", name: "missing member", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEODIST", "{g}", "Palermo", "Rome"}, want: null()},
+	{command: "GEODIST", name: "unknown unit", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEODIST", "{g}", "Palermo", "Catania", "ly"}, want: errPrefix("ERR unsupported unit provided. please use M, KM, FT, MI")},
+	{command: "GEOPOS", name: "coordinates", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOPOS", "{g}", "Palermo"}, want: func(v resp.RespValue) (bool, string) {
+		ok := v.Type == resp.Array && len(v.Array) == 1 && len(v.Array[0].Array) == 2 &&
+			v.Array[0].Array[0].Str == "13.36138933897018433" && v.Array[0].Array[1].Str == "38.11555639549629859"
+		return ok, "[[13.36138933897018433 38.11555639549629859]]"
+	}},
+	{command: "GEOHASH", name: "standard geohashes", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOHASH", "{g}", "Palermo", "Catania"}, want: array("sqc8b49rny0", "sqdtr74hyu0")},
+	{command: "GEOSEARCH", name: "BYRADIUS ASC", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOSEARCH", "{g}", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"}, want: array("Catania", "Palermo")},
+	{command: "GEOSEARCH", name: "BYBOX COUNT", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOSEARCH", "{g}", "FROMMEMBER", "Palermo", "BYBOX", "400", "400", "km", "DESC", "COUNT", "1"}, want: array("Catania")},
+	{command: "GEOSEARCH", name: "missing key", argv: []string{"GEOSEARCH", "{g}", "FROMMEMBER", "Palermo", "BYRADIUS", "1", "km"}, want: emptyArray()},
+	{command: "GEOSEARCH", name: "missing member", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEOSEARCH", "{g}", "FROMMEMBER", "Rome", "BYRADIUS", "1", "km"}, want: errPrefix("ERR could not decode requested zset member")},
+	{command: "GEOSEARCH", name: "without an area", argv: []string{"GEOSEARCH", "{g}", "FROMLONLAT", "15", "37", "ASC", "WITHDIST"}, want: errPrefix("ERR exactly one of BYRADIUS and BYBOX can be specified for")},
+	{command: "GEOSEARCH", name: "ANY without COUNT", argv: []string{"GEOSEARCH", "{g}", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "ANY"}, want: errPrefix("ERR the ANY argument requires COUNT argument")},
+	{command: "GEOSEARCHSTORE", name: "stores geohashes", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...), {"GEOSEARCHSTORE", "{d}", "{g}", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km"}}, argv: []string{"ZRANGE", "{d}", "0", "-1", "WITHSCORES"}, want: array("Catania", "3479447370796909")},
+	{command: "GEOSEARCHSTORE", name: "STOREDIST", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...), {"GEOSEARCHSTORE", "{d}", "{g}", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km", "STOREDIST"}}, argv: []string{"ZRANGE", "{d}", "0", "-1", "WITHSCORES"}, want: array("Catania", "56.4412578701582")},
+	{command: "GEOSEARCHSTORE", name: "nothing found deletes the key", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...), {"SET", "{d}", "v"}, {"GEOSEARCHSTORE", "{d}", "{g}", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "m"}}, argv: []string{"EXISTS", "{d}"}, want: integer(0)},
+	{command: "GEOSEARCHSTORE", name: "WITHDIST", argv: []string{"GEOSEARCHSTORE", "{d}", "{g}", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "m", "WITHDIST"}, want: errPrefix("ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options")},
+	{command: "GEORADIUS", name: "WITHDIST", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEORADIUS", "{g}", "15", "37", "100", "km", "WITHDIST"}, want: func(v resp.RespValue) (bool, string) {
+		ok := v.Type == resp.Array && len(v.Array) == 1 && len(v.Array[0].Array) == 2 &&
+			v.Array[0].Array[0].Str == "Catania" && v.Array[0].Array[1].Str == "56.4413"
+		return ok, "[[Catania 56.4413]]"
+	}},
+	{command: "GEORADIUSBYMEMBER", name: "STORE", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...)}, argv: []string{"GEORADIUSBYMEMBER", "{g}", "Palermo", "200", "km", "STORE", "{d}"}, want: integer(2)},
+	{command: "GEORADIUS_RO", name: "no STORE", argv: []string{"GEORADIUS_RO", "{g}", "15", "37", "100", "km", "STORE", "{d}"}, want: syntaxErr()},
+	{command: "ZREM", name: "removes geo members", setup: [][]string{append([]string{"GEOADD", "{g}"}, sicily...), {"ZREM", "{g}", "Palermo"}}, argv: []string{"GEOSEARCH", "{g}", "FROMLONLAT", "15", "37", "BYRADIUS", "500", "km"}, want: array("Catania")},
+
+	// Pub/sub
+	{command: "PUBSUB", name: "NUMSUB without channels", argv: []string{"PUBSUB", "NUMSUB"}, want: emptyArray()},
+	{command: "PUBSUB", name: "NUMSUB of a channel without subscribers", argv: []string{"PUBSUB", "NUMSUB", "{c}"}, want: func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Array && len(v.Array) == 2 && v.Array[0].Type == resp.Bulk && v.Array[1].Type == resp.Integer && v.Array[1].Num == 0, "[channel :0]"
+	}},
+	{command: "PUBSUB", name: "NUMPAT with an argument", argv: []string{"PUBSUB", "NUMPAT", "x"}, want: arityErr()},
+	{command: "PUBSUB", name: "unknown subcommand", argv: []string{"PUBSUB", "NOPE"}, want: errPrefix("ERR unknown subcommand")},
+
+	// Replication
+	{command: "ROLE", name: "master without replicas", argv: []string{"ROLE"}, want: func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Array && len(v.Array) == 3 && v.Array[0].Str == "master" && v.Array[1].Type == resp.Integer && v.Array[2].Type == resp.Array && len(v.Array[2].Array) == 0, "[\"master\" :0 []]"
+	}},
+	{command: "ROLE", name: "with an argument", argv: []string{"ROLE", "x"}, want: arityErr()},
+
+	// Cluster
+	{command: "CLUSTER", name: "KEYSLOT", argv: []string{"CLUSTER", "KEYSLOT", "somekey"}, want: integer(11058)},
+	{command: "CLUSTER", name: "KEYSLOT with a hash tag", argv: []string{"CLUSTER", "KEYSLOT", "foo{hash_tag}"}, want: integer(2515)},
+	{command: "CLUSTER", name: "KEYSLOT with an empty hash tag", argv: []string{"CLUSTER", "KEYSLOT", "{}a"}, want: integer(10875)},
+	{command: "CLUSTER", name: "COUNTKEYSINSLOT without cluster mode", argv: []string{"CLUSTER", "COUNTKEYSINSLOT", "0"}, want: errPrefix("ERR This instance has cluster support disabled")},
+
+	// Scripting
+	{command: "EVAL", name: "returns an integer", argv: []string{"EVAL", "return 1", "0"}, want: integer(1)},
+	{command: "EVAL", name: "Lua table as an array", argv: []string{"EVAL", "return {1, 'two'}", "0"}, want: func(v resp.RespValue) (bool, string) {
+		return v.Type == resp.Array && len(v.Array) == 2 && v.Array[0].Type == resp.Integer && v.Array[0].Num == 1 && v.Array[1].Str == "two", "[:1 \"two\"]"
+	}},
+	{command: "EVAL", name: "KEYS and ARGV", argv: []string{"EVAL", "return redis.call('SET', KEYS[1], ARGV[1])", "1", "{k}", "v"}, want: ok()},
+	{command: "EVAL", name: "negative number of keys", argv: []string{"EVAL", "return 1", "-1"}, want: errPrefix("ERR Number of keys can't be negative")},
+	{command: "EVAL", name: "more keys than arguments", argv: []string{"EVAL", "return 1", "2", "a"}, want: errPrefix("ERR Number of keys can't be greater than number of args")},
+	{command: "EVALSHA", name: "unknown script", argv: []string{"EVALSHA", "ffffffffffffffffffffffffffffffffffffffff", "0"}, want: errPrefix("NOSCRIPT")},
+	{command: "SCRIPT", name: "KILL without a running script", argv: []string{"SCRIPT", "KILL"}, want: errPrefix("NOTBUSY")},
+	{command: "FUNCTION", name: "KILL without a running function", argv: []string{"FUNCTION", "KILL"}, want: errPrefix("NOTBUSY")},
+	{command: "FUNCTION", name: "LOAD returns the library name", argv: []string{"FUNCTION", "LOAD", "REPLACE", compatLibrary}, want: bulk("compatlib")},
+	{command: "FUNCTION", name: "LOAD without metadata", argv: []string{"FUNCTION", "LOAD", "return 1"}, want: errPrefix("ERR Missing library metadata")},
+	{command: "FUNCTION", name: "DELETE a missing library", argv: []string{"FUNCTION", "DELETE", "compat_missing_lib"}, want: errPrefix("ERR Library not found")},
+	{command: "FCALL", name: "keys and arguments", setup: [][]string{{"FUNCTION", "LOAD", "REPLACE", compatLibrary}}, argv: []string{"FCALL", "compat_set", "1", "{k}", "v"}, want: ok()},
+	{command: "FCALL", name: "unknown function", argv: []string{"FCALL", "compat_missing_fn", "0"}, want: errPrefix("ERR Function not found")},
+	{command: "FCALL_RO", name: "function without no-writes", setup: [][]string{{"FUNCTION", "LOAD", "REPLACE", compatLibrary}}, argv: []string{"FCALL_RO", "compat_set", "1", "{k}", "v"}, want: errPrefix("ERR Can not execute a script with write flag")},
+	{command: "FCALL_RO", name: "no-writes function", setup: [][]string{{"FUNCTION", "LOAD", "REPLACE", compatLibrary}, {"SET", "{k}", "v"}}, argv: []string{"FCALL_RO", "compat_get", "1", "{k}"}, want: bulk("v")},
+}
+
+// compatLibrary is the function library the FUNCTION and FCALL cases load.
+const compatLibrary = "#!lua name=compatlib\n" +
+	"redis.register_function('compat_set', function(keys, args) return redis.call('SET', keys[1], args[1]) end)\n" +
+	"redis.register_function{function_name='compat_get', callback=function(keys) return redis.call('GET', keys[1]) end, flags={'no-writes'}}\n"
@@ -0,0 +1,234 @@
+// Command compat checks the server against the behavior Redis documents:
+// argument and type errors, and the format of the replies. It boots a
+// server on a random port, or uses the one at -addr, runs the cases of
+// cases.go and prints a compatibility matrix with the cases passed per
+// command. It exits with a non-zero status if any case fails.
+//
+// Usage:
+//
+//	compat [-addr host:port] [-run pattern] [-timeout duration] [-v]
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/config"
+	"github.com/liweiyuan/go-redis-server/network"
+	"github.com/liweiyuan/go-redis-server/persistence"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+type conn struct {
+	addr    string
+	timeout time.Duration // Time a reply may take
+	c       net.Conn
+	r       *bufio.Reader
+}
+
+func dial(addr string, timeout time.Duration) (*conn, error) {
+	c := &conn{addr: addr, timeout: timeout}
+	if err := c.redial(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// redial replaces the connection, dropping the replies still due on the
+// old one, so that the reply a case did not wait for is not taken as that
+// of the next case.
+func (c *conn) redial() error {
+	if c.c != nil {
+		c.c.Close()
+	}
+	nc, err := net.Dial("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.c, c.r = nc, bufio.NewReader(nc)
+	return nil
+}
+
+func (c *conn) do(args ...string) resp.RespValue {
+	argv := make([]resp.RespValue, len(args))
+	for i, arg := range args {
+		argv[i] = resp.NewBulk(arg)
+	}
+	if err := resp.WriteResp(c.c, resp.NewArray(argv)); err != nil {
+		c.redial()
+		return resp.NewError("write: " + err.Error())
+	}
+	c.c.SetReadDeadline(time.Now().Add(c.timeout))
+	reply, err := resp.ReadResp(c.r)
+	if err != nil {
+		c.redial()
+		return resp.NewError("read: " + err.Error())
+	}
+	return reply
+}
+
+func main() {
+	addr := flag.String("addr", "", "server address, empty to boot one on a random port")
+	run := flag.String("run", "", "only run the cases of the commands matching this regular expression")
+	verbose := flag.Bool("v", false, "print every case, not only the failed ones")
+	timeout := flag.Duration("timeout", 5*time.Second, "time a reply may take, longer under the race detector")
+	flag.Parse()
+
+	filter, err := regexp.Compile("(?i)" + *run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *addr == "" {
+		if *addr, err = boot(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	c, err := dial(*addr, *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	type tally struct{ passed, total int }
+	matrix := make(map[string]*tally)
+	prefix := "compat:" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":"
+	failed := 0
+	for i, cs := range cases {
+		if !filter.MatchString(cs.command) {
+			continue
+		}
+		keys := fmt.Sprintf("%s%d:", prefix, i)
+		for _, argv := range cs.setup {
+			c.do(expandKeys(argv, keys)...)
+		}
+		got := c.do(expandKeys(cs.argv, keys)...)
+		ok, want := cs.want(got)
+		t := matrix[cs.command]
+		if t == nil {
+			t = &tally{}
+			matrix[cs.command] = t
+		}
+		t.total++
+		if ok {
+			t.passed++
+			if *verbose {
+				fmt.Printf("ok   %s: %s\n", cs.command, cs.name)
+			}
+		} else {
+			failed++
+			fmt.Printf("FAIL %s: %s\n     %s\n     got  %s\n     want %s\n", cs.command, cs.name, strings.Join(cs.argv, " "), describe(got), want)
+		}
+	}
+
+	names := make([]string, 0, len(matrix))
+	for name := range matrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("\n%-20s %8s  %s\n", "COMMAND", "PASSED", "STATUS")
+	passed, total := 0, 0
+	for _, name := range names {
+		t := matrix[name]
+		status := "compatible"
+		if t.passed < t.total {
+			status = "INCOMPATIBLE"
+		}
+		fmt.Printf("%-20s %4d/%-3d  %s\n", name, t.passed, t.total, status)
+		passed += t.passed
+		total += t.total
+	}
+	fmt.Printf("\n%d/%d cases passed\n", passed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// boot starts a server on a random port in a temporary directory and
+// returns its address once it accepts connections.
+func boot() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	dir, err := os.MkdirTemp("", "compat-")
+	if err != nil {
+		return "", err
+	}
+
+	cfg := config.Default()
+	cfg.Port = port
+	cfg.Bind = []string{"127.0.0.1"}
+	cfg.Dir = dir
+	cfg.SavePoints = nil
+	s := storage.NewStorage()
+	cr := command.NewCommandRegistry()
+	cr.SetSnapshotter(persistence.New(filepath.Join(cfg.Dir, cfg.DBFilename)))
+	log.SetOutput(io.Discard) // Keep the log of the server out of the report.
+	go network.Start(cfg, s, cr)
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			c.Close()
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("server did not start on %s", addr)
+}
+
+// expandKeys returns argv with the arguments in braces, such as {list},
+// replaced by keys unique to the case.
+func expandKeys(argv []string, prefix string) []string {
+	out := make([]string, len(argv))
+	for i, arg := range argv {
+		if len(arg) > 2 && arg[0] == '{' && arg[len(arg)-1] == '}' {
+			arg = prefix + arg[1:len(arg)-1]
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// describe renders a reply for a failure report.
+func describe(v resp.RespValue) string {
+	switch v.Type {
+	case resp.String:
+		return "+" + v.Str
+	case resp.Error:
+		return "-" + v.Str
+	case resp.Integer:
+		return ":" + strconv.FormatInt(v.Num, 10)
+	case resp.Bulk:
+		if v.Null {
+			return "(nil)"
+		}
+		return strconv.Quote(v.Str)
+	case resp.Array, resp.Push:
+		if v.Null {
+			return "(nil array)"
+		}
+		items := make([]string, len(v.Array))
+		for i, item := range v.Array {
+			items[i] = describe(item)
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	return fmt.Sprintf("%+v", v)
+}
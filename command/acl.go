@@ -0,0 +1,534 @@
+package command
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/persistence"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// Users authenticate connections with AUTH or HELLO AUTH, by name and
+// password. Passwords are only kept as their SHA-256 digests, in memory as
+// in the ACL file. Every user may run every command on every key and
+// channel: the rules setting permissions are accepted only when they grant
+// them all, so the users of a Redis ACL file written with ~* &* +@all load
+// unchanged.
+
+// aclAllPermissions are the rules of the permissions every user has.
+var aclAllPermissions = []string{"~*", "&*", "+@all"}
+
+// aclUser is a user connections authenticate as.
+type aclUser struct {
+	name      string
+	enabled   bool     // Connections may authenticate as the user
+	nopass    bool     // Any password authenticates
+	passwords []string // SHA-256 digests of the passwords, in hex
+}
+
+// newDefaultUser returns the default user as the server starts with it:
+// enabled and without a password, so that connections are authenticated
+// as it from the start.
+func newDefaultUser() *aclUser {
+	return &aclUser{name: "default", enabled: true, nopass: true}
+}
+
+// hashPassword returns the SHA-256 digest of password, in hex.
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// validPasswordHash reports whether hash is a SHA-256 digest in lowercase
+// hex, as the # and ! rules take.
+func validPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if !(hash[i] >= '0' && hash[i] <= '9' || hash[i] >= 'a' && hash[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+var errBadPasswordHash = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+
+// setRule changes u as the rule of ACL SETUSER says.
+func (u *aclUser) setRule(rule string) error {
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.nopass, u.passwords = true, nil
+	case lower == "resetpass":
+		u.nopass, u.passwords = false, nil
+	case lower == "reset":
+		*u = aclUser{name: u.name}
+	case lower == "allkeys" || lower == "allchannels" || lower == "allcommands" || lower == "+@all" || rule == "~*" || rule == "&*":
+		// Every user has all the permissions.
+	case rule != "" && (rule[0] == '>' || rule[0] == '#'):
+		hash := rule[1:]
+		if rule[0] == '>' {
+			hash = hashPassword(hash)
+		} else if !validPasswordHash(hash) {
+			return errBadPasswordHash
+		}
+		if !u.hasPassword(hash) {
+			u.passwords = append(u.passwords, hash)
+		}
+		u.nopass = false
+	case rule != "" && (rule[0] == '<' || rule[0] == '!'):
+		hash := rule[1:]
+		if rule[0] == '<' {
+			hash = hashPassword(hash)
+		} else if !validPasswordHash(hash) {
+			return errBadPasswordHash
+		}
+		i := u.passwordIndex(hash)
+		if i < 0 {
+			return errors.New("The password you are trying to remove from the user does not exist")
+		}
+		u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+	case rule != "" && strings.ContainsRune("~%&+-", rune(rule[0])) || lower == "resetkeys" || lower == "resetchannels" || lower == "nocommands":
+		return errors.New("Only the rules granting all permissions, ~* &* +@all, are supported")
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+// passwordIndex returns the index of the password of digest hash, -1 if
+// the user has no such password.
+func (u *aclUser) passwordIndex(hash string) int {
+	for i, p := range u.passwords {
+		if p == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+func (u *aclUser) hasPassword(hash string) bool {
+	return u.passwordIndex(hash) >= 0
+}
+
+// authenticates reports whether password authenticates a connection as u.
+func (u *aclUser) authenticates(password string) bool {
+	if !u.enabled {
+		return false
+	}
+	if u.nopass {
+		return true
+	}
+	hash := hashPassword(password)
+	ok := 0
+	for _, p := range u.passwords {
+		ok |= subtle.ConstantTimeCompare([]byte(p), []byte(hash))
+	}
+	return ok == 1
+}
+
+// flags returns the flags of u, as ACL GETUSER lists them.
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// rules returns the rules defining u, as ACL LIST describes it and the ACL
+// file stores it: its flags, the digests of its passwords and its
+// permissions.
+func (u *aclUser) rules() []string {
+	rules := u.flags()
+	for _, p := range u.passwords {
+		rules = append(rules, "#"+p)
+	}
+	return append(rules, aclAllPermissions...)
+}
+
+// describe returns the line of u in ACL LIST and the ACL file.
+func (u *aclUser) describe() string {
+	return "user " + u.name + " " + strings.Join(u.rules(), " ")
+}
+
+// aclTable holds the users.
+type aclTable struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+	file  string // See SetACLFile
+}
+
+func newACLTable() *aclTable {
+	return &aclTable{users: map[string]*aclUser{"default": newDefaultUser()}}
+}
+
+// user returns a copy of the user called name.
+func (t *aclTable) user(name string) (aclUser, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	u, ok := t.users[name]
+	if !ok {
+		return aclUser{}, false
+	}
+	cp := *u
+	cp.passwords = append([]string(nil), u.passwords...)
+	return cp, true
+}
+
+// sorted returns the users ordered by name.
+func (t *aclTable) sorted() []*aclUser {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	users := make([]*aclUser, 0, len(t.users))
+	for _, u := range t.users {
+		cp := *u
+		users = append(users, &cp)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].name < users[j].name })
+	return users
+}
+
+// checkUsername returns the error of a name ACL SETUSER refuses.
+func checkUsername(name string) error {
+	if strings.ContainsAny(name, " \x00") {
+		return errs.Errorf("Usernames can't contain spaces or null characters")
+	}
+	return nil
+}
+
+// setUser applies rules to the user called name, created disabled and
+// without passwords if it does not exist. Either all the rules apply or,
+// if one is invalid, none does.
+func (t *aclTable) setUser(name string, rules []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := aclUser{name: name}
+	if old, ok := t.users[name]; ok {
+		u = *old
+		u.passwords = append([]string(nil), old.passwords...)
+	}
+	for _, rule := range rules {
+		if err := u.setRule(rule); err != nil {
+			return errs.Errorf("Error in ACL SETUSER modifier '%s': %v", rule, err)
+		}
+	}
+	t.users[name] = &u
+	return nil
+}
+
+// authenticate reports whether password authenticates a connection as the
+// user called name.
+func (t *aclTable) authenticate(name, password string) bool {
+	u, ok := t.user(name)
+	return ok && u.authenticates(password)
+}
+
+// errNoACLFile is the error of ACL SAVE and ACL LOAD without an ACL file.
+var errNoACLFile = errs.Errorf("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+
+// SetACLFile sets the file ACL SAVE writes the users to and ACL LOAD reads
+// them from.
+func (cr *CommandRegistry) SetACLFile(path string) {
+	cr.acl.mu.Lock()
+	defer cr.acl.mu.Unlock()
+	cr.acl.file = path
+}
+
+// LoadACL replaces the users with those of the ACL file, as ACL LOAD does.
+// A missing file holds no user besides the default one, which the server
+// starts with unless the file defines it.
+func (cr *CommandRegistry) LoadACL() error {
+	return cr.loadACL(nil)
+}
+
+// loadACL is LoadACL run by caller, nil for none.
+func (cr *CommandRegistry) loadACL(caller *Client) error {
+	cr.acl.mu.Lock()
+	path := cr.acl.file
+	cr.acl.mu.Unlock()
+	if path == "" {
+		return errNoACLFile
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return errs.Errorf("Error loading ACLs, opening file '%s': %v", path, err)
+	}
+	users, err := parseACLFile(path, string(data))
+	if err != nil {
+		return err
+	}
+	cr.acl.mu.Lock()
+	cr.acl.users = users
+	cr.acl.mu.Unlock()
+	cr.disconnectUsers(caller, func(name string) bool {
+		_, ok := users[name]
+		return !ok
+	})
+	return nil
+}
+
+// disconnectUsers closes the connections of the users gone reports, that of
+// caller, unless nil, after its reply.
+func (cr *CommandRegistry) disconnectUsers(caller *Client, gone func(name string) bool) {
+	for _, client := range cr.clients.All() {
+		if !gone(client.User()) {
+			continue
+		}
+		if client == caller {
+			client.Close()
+		} else {
+			client.kill()
+		}
+	}
+}
+
+// parseACLFile parses the users of the ACL file at path: a line for each,
+// "user" followed by the name and the rules, blank lines being skipped.
+// Errors name the line.
+func parseACLFile(path, data string) (map[string]*aclUser, error) {
+	users := make(map[string]*aclUser)
+	for i, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		lineErr := func(format string, args ...any) error {
+			return errs.Errorf("%s:%d: %s", path, i+1, fmt.Sprintf(format, args...))
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return nil, lineErr("should start with user keyword followed by the username")
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return nil, lineErr("Duplicate user '%s' found", name)
+		}
+		u := &aclUser{name: name}
+		for _, rule := range fields[2:] {
+			if err := u.setRule(rule); err != nil {
+				return nil, lineErr("%v in rule '%s'", err, rule)
+			}
+		}
+		users[name] = u
+	}
+	if _, ok := users["default"]; !ok {
+		users["default"] = newDefaultUser()
+	}
+	return users, nil
+}
+
+// saveACL writes the users to the ACL file, as ACL SAVE does.
+func (cr *CommandRegistry) saveACL() error {
+	var b strings.Builder
+	for _, u := range cr.acl.sorted() {
+		b.WriteString(u.describe() + "\n")
+	}
+	cr.acl.mu.RLock()
+	path := cr.acl.file
+	cr.acl.mu.RUnlock()
+	if path == "" {
+		return errNoACLFile
+	}
+	if err := persistence.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		log.Printf("Failed to save the ACL file %s: %v", path, err)
+		return errs.Errorf("There was an error trying to save the ACLs. Please check the server logs for more information")
+	}
+	return nil
+}
+
+// DefaultUserHasPassword reports whether connections must authenticate to
+// run commands as the default user, which lifts protected mode.
+func (cr *CommandRegistry) DefaultUserHasPassword() bool {
+	u, ok := cr.acl.user("default")
+	return !ok || !u.nopass
+}
+
+// AuthenticateDefault authenticates client as the default user if it is
+// enabled and needs no password, as new connections are, and leaves it
+// unauthenticated otherwise.
+func (cr *CommandRegistry) AuthenticateDefault(client *Client) {
+	u, ok := cr.acl.user("default")
+	client.setUser("default", ok && u.enabled && u.nopass)
+}
+
+// authenticate authenticates client as the user called name, and returns
+// the WRONGPASS error if password does not authenticate as the user.
+func (cr *CommandRegistry) authenticate(client *Client, name, password string) error {
+	if !cr.acl.authenticate(name, password) {
+		return errWrongPass
+	}
+	client.setUser(name, true)
+	return nil
+}
+
+var errWrongPass = errs.New("WRONGPASS", "invalid username-password pair or user is disabled.")
+
+// AuthCommand implements the AUTH command.
+type AuthCommand struct {
+	registry *CommandRegistry
+	user     string
+	password string
+}
+
+// newAuthCommand creates a new AuthCommand bound to the registry, from
+// the arguments [username] password, the username defaulting to default.
+func (cr *CommandRegistry) newAuthCommand(args []resp.RespValue) (Command, error) {
+	if len(args) > 2 {
+		return nil, errs.Syntax
+	}
+	c := &AuthCommand{registry: cr, user: "default", password: args[len(args)-1].Str}
+	if len(args) == 2 {
+		c.user = args[0].Str
+	} else if u, ok := cr.acl.user("default"); ok && u.nopass {
+		return nil, errs.Errorf("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	return c, nil
+}
+
+// Apply is never called for AUTH, which needs the calling client.
+func (c *AuthCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("AUTH"))
+}
+
+// ApplyClient executes the AUTH command, authenticating the client.
+func (c *AuthCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	if err := c.registry.authenticate(client, c.user, c.password); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
+
+// ACLUserCommand implements the subcommands of ACL managing the users:
+// SETUSER, GETUSER, DELUSER, USERS, LIST, SAVE and LOAD.
+type ACLUserCommand struct {
+	registry   *CommandRegistry
+	subcommand string
+	args       []string // The user names, then the rules of SETUSER
+}
+
+// newACLUserCommand returns the constructor of the ACL subcommand named
+// subcommand, whose arguments need no parsing, bound to the registry.
+func (cr *CommandRegistry) newACLUserCommand(subcommand string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &ACLUserCommand{registry: cr, subcommand: subcommand, args: bulkStrings(args)}, nil
+	}
+}
+
+// newACLSetUserCommand creates a new ACL SETUSER command, checking the
+// name of the user.
+func (cr *CommandRegistry) newACLSetUserCommand(args []resp.RespValue) (Command, error) {
+	if err := checkUsername(args[0].Str); err != nil {
+		return nil, err
+	}
+	return &ACLUserCommand{registry: cr, subcommand: "SETUSER", args: bulkStrings(args)}, nil
+}
+
+// Apply executes the ACL subcommand.
+func (c *ACLUserCommand) Apply(s *storage.Storage) resp.RespValue {
+	acl := c.registry.acl
+	switch c.subcommand {
+	case "SETUSER":
+		if err := acl.setUser(c.args[0], c.args[1:]); err != nil {
+			return replyError(err)
+		}
+		return replyOK()
+	case "GETUSER":
+		u, ok := acl.user(c.args[0])
+		if !ok {
+			return replyNil()
+		}
+		return resp.NewMap([]resp.RespValue{
+			resp.NewBulk("flags"), replyBulkArray(u.flags()),
+			resp.NewBulk("passwords"), replyBulkArray(u.passwords),
+			resp.NewBulk("commands"), resp.NewBulk("+@all"),
+			resp.NewBulk("keys"), resp.NewBulk("~*"),
+			resp.NewBulk("channels"), resp.NewBulk("&*"),
+			resp.NewBulk("selectors"), resp.NewArray([]resp.RespValue{}),
+		})
+	case "DELUSER":
+		return c.deleteUsers(nil)
+	case "USERS":
+		users := acl.sorted()
+		names := make([]string, len(users))
+		for i, u := range users {
+			names[i] = u.name
+		}
+		return replyBulkArray(names)
+	case "LIST":
+		users := acl.sorted()
+		lines := make([]string, len(users))
+		for i, u := range users {
+			lines[i] = u.describe()
+		}
+		return replyBulkArray(lines)
+	case "SAVE":
+		if err := c.registry.saveACL(); err != nil {
+			return replyError(err)
+		}
+		return replyOK()
+	case "LOAD":
+		if err := c.registry.loadACL(nil); err != nil {
+			return replyError(err)
+		}
+		return replyOK()
+	}
+	return replyError(errs.Errorf("unknown ACL subcommand '%s'", c.subcommand))
+}
+
+// ApplyClient executes the ACL subcommand for the calling client, whose
+// connection DELUSER and LOAD close after the reply if they remove its user.
+func (c *ACLUserCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "DELUSER":
+		return c.deleteUsers(client)
+	case "LOAD":
+		if err := c.registry.loadACL(client); err != nil {
+			return replyError(err)
+		}
+		return replyOK()
+	}
+	return c.Apply(s)
+}
+
+// deleteUsers deletes the users named by the arguments, closing their
+// connections, and replies with the number of users deleted.
+func (c *ACLUserCommand) deleteUsers(caller *Client) resp.RespValue {
+	for _, name := range c.args {
+		if name == "default" {
+			return replyError(errs.Errorf("The 'default' user cannot be removed"))
+		}
+	}
+	acl := c.registry.acl
+	deleted := map[string]bool{}
+	acl.mu.Lock()
+	for _, name := range c.args {
+		if _, ok := acl.users[name]; ok {
+			delete(acl.users, name)
+			deleted[name] = true
+		}
+	}
+	acl.mu.Unlock()
+	c.registry.disconnectUsers(caller, func(name string) bool { return deleted[name] })
+	return replyInteger(int64(len(deleted)))
+}
@@ -0,0 +1,96 @@
+package command
+
+import (
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// commandAlias is a deprecated or legacy command that another command
+// implements: its arguments are rewritten into those of the target, whose
+// reply may be adapted. The alias has the flags, key positions and
+// categories of the target, and its own arity.
+type commandAlias struct {
+	Name    string
+	Target  string
+	MinArgs int
+	MaxArgs int
+	Rewrite func(args []resp.RespValue) []resp.RespValue // nil to keep the arguments
+	Reply   func(reply resp.RespValue) resp.RespValue    // nil to keep the reply
+}
+
+var aliases = []commandAlias{
+	{Name: "SUBSTR", Target: "GETRANGE", MinArgs: 3, MaxArgs: 3},
+	{Name: "GETSET", Target: "SET", MinArgs: 2, MaxArgs: 2, Rewrite: insertArgs(2, "GET")},
+	{Name: "HMSET", Target: "HSET", MinArgs: 3, MaxArgs: -1, Reply: okUnlessError},
+	{Name: "ZRANGEBYSCORE", Target: "ZRANGE", MinArgs: 3, MaxArgs: -1, Rewrite: insertArgs(3, "BYSCORE")},
+	{Name: "ZREVRANGEBYSCORE", Target: "ZRANGE", MinArgs: 3, MaxArgs: -1, Rewrite: insertArgs(3, "BYSCORE", "REV")},
+	{Name: "ZREVRANGE", Target: "ZRANGE", MinArgs: 3, MaxArgs: 4, Rewrite: insertArgs(3, "REV")},
+}
+
+// registerAliases registers the commands of the alias table, once their
+// targets are registered.
+func (cr *CommandRegistry) registerAliases() {
+	specs := make([]CommandSpec, len(aliases))
+	for i, alias := range aliases {
+		target, ok := cr.commands[alias.Target]
+		if !ok {
+			panic("command: alias " + alias.Name + " of unknown command " + alias.Target)
+		}
+		spec := *target
+		spec.Name = alias.Name
+		spec.MinArgs = alias.MinArgs
+		spec.MaxArgs = alias.MaxArgs
+		spec.New = alias.constructor(target.New)
+		specs[i] = spec
+	}
+	cr.register(specs)
+}
+
+// constructor returns the constructor of the alias, built on that of its
+// target.
+func (alias commandAlias) constructor(newTarget func(args []resp.RespValue) (Command, error)) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		if alias.Rewrite != nil {
+			args = alias.Rewrite(args)
+		}
+		cmd, err := newTarget(args)
+		if err != nil || alias.Reply == nil {
+			return cmd, err
+		}
+		return &aliasCommand{Command: cmd, reply: alias.Reply}, nil
+	}
+}
+
+// aliasCommand adapts the reply of the command an alias runs. Only aliases
+// with a Reply function are wrapped, as the wrapper hides the optional
+// interfaces of the command, such as ClientAwareCommand.
+type aliasCommand struct {
+	Command
+	reply func(resp.RespValue) resp.RespValue
+}
+
+// Apply executes the command and adapts its reply.
+func (c *aliasCommand) Apply(s *storage.Storage) resp.RespValue {
+	return c.reply(c.Command.Apply(s))
+}
+
+// insertArgs returns a Rewrite function inserting words at position pos of
+// the arguments, after the arguments the alias and its target share.
+func insertArgs(pos int, words ...string) func(args []resp.RespValue) []resp.RespValue {
+	return func(args []resp.RespValue) []resp.RespValue {
+		out := make([]resp.RespValue, 0, len(args)+len(words))
+		out = append(out, args[:pos]...)
+		for _, w := range words {
+			out = append(out, resp.NewBulk(w))
+		}
+		return append(out, args[pos:]...)
+	}
+}
+
+// okUnlessError replaces a successful reply with +OK, as for HMSET.
+func okUnlessError(reply resp.RespValue) resp.RespValue {
+	if reply.Type == resp.Error {
+		return reply
+	}
+	return replyOK()
+}
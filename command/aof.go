@@ -0,0 +1,336 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/persistence"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// aofRewriteConfig holds the auto-aof-rewrite-percentage and
+// auto-aof-rewrite-min-size settings.
+type aofRewriteConfig struct {
+	percentage int
+	minSize    int64
+}
+
+// SetAOF sets the append only file that write commands are appended to.
+// It is rewritten automatically once it reaches minSize bytes and grew by
+// percentage percent since the last rewrite.
+func (cr *CommandRegistry) SetAOF(aof *persistence.AOF, percentage int, minSize int64) {
+	cr.aof = aof
+	cr.aofRewrite = aofRewriteConfig{percentage: percentage, minSize: minSize}
+}
+
+// AOF returns the append only file, nil if it is disabled.
+func (cr *CommandRegistry) AOF() *persistence.AOF {
+	return cr.aof
+}
+
+// propagatingCommand is implemented by commands whose effect is not
+// reproduced by running them again, such as those taking relative expire
+// times or popping random members. propagate returns the commands to
+// append to the append only file instead, none if nothing changed.
+type propagatingCommand interface {
+	propagate(result resp.RespValue) [][]string
+}
+
+// propagate appends the write command argv, run as cmd with the given
+// result, to the append only file. The command is logged under its
+// registered name, so renaming it does not affect the file.
+func (cr *CommandRegistry) propagate(spec *CommandSpec, argv []string, cmd Command, result resp.RespValue) {
+	for _, argv := range commandEffects(spec, argv, cmd, result) {
+		if err := cr.aof.Feed(argv); err != nil {
+			log.Printf("Failed to write the append only file: %v", err)
+		}
+	}
+}
+
+// commandEffects returns the commands reproducing the effect of the write
+// command argv, run as cmd with the given result, none if it failed.
+func commandEffects(spec *CommandSpec, argv []string, cmd Command, result resp.RespValue) [][]string {
+	if result.Type == resp.Error {
+		return nil
+	}
+	if pc, ok := cmd.(propagatingCommand); ok {
+		return pc.propagate(result)
+	}
+	name := spec.Name
+	if spec.container != nil {
+		name = spec.container.Name
+	}
+	return [][]string{append([]string{name}, argv[1:]...)}
+}
+
+// propagateScript appends the effects of a script, the commands its writes
+// are reproduced by, to the append only file as a transaction, so that
+// loading the file never applies part of them.
+func (cr *CommandRegistry) propagateScript(cmds [][]string) {
+	var err error
+	switch len(cmds) {
+	case 0:
+		return
+	case 1:
+		err = cr.aof.Feed(cmds[0])
+	default:
+		err = cr.aof.FeedTransaction(cmds)
+	}
+	if err != nil {
+		log.Printf("Failed to write the append only file: %v", err)
+	}
+}
+
+// Replay runs a command read from the append only file. Commands are
+// looked up by their registered name, whatever rename-command says.
+func (cr *CommandRegistry) Replay(s *storage.Storage, argv []string) error {
+	spec, ok := cr.commands[upperName(argv[0])]
+	if !ok {
+		return errs.Errorf("unknown command '%s'", argv[0])
+	}
+	args := make([]resp.RespValue, len(argv)-1)
+	for i, arg := range argv[1:] {
+		args[i] = resp.NewBulk(arg)
+	}
+	cmd, err := spec.parse(args)
+	if err != nil {
+		return err
+	}
+	cmd.Apply(s)
+	return nil
+}
+
+// RewriteAOFIfDue starts a background rewrite of the append only file if
+// one is scheduled or the file grew enough since the last rewrite.
+func (cr *CommandRegistry) RewriteAOFIfDue(s *storage.Storage) {
+	if cr.aof == nil || !cr.aof.RewriteDue(cr.aofRewrite.percentage, cr.aofRewrite.minSize) {
+		return
+	}
+	if cr.snapshotter != nil && (cr.snapshotter.Loading() || cr.snapshotter.BackgroundSaving()) {
+		return
+	}
+	cr.execMu.Lock()
+	defer cr.execMu.Unlock()
+	size, base := cr.aof.Sizes()
+	log.Printf("Starting automatic rewriting of AOF on %d%% growth", (size-base)*100/max(base, 1))
+	if _, err := cr.aof.BackgroundRewrite(s); err != nil {
+		log.Printf("Background append only file rewriting error: %v", err)
+	}
+}
+
+// propagate logs SET with an absolute expire time, so replaying it later
+// does not extend the life of the key.
+func (c *SetCommand) propagate(result resp.RespValue) [][]string {
+	if !c.written {
+		return nil
+	}
+	argv := []string{"SET", c.key, c.value}
+	switch {
+	case c.expire != nil:
+		argv = append(argv, "PXAT", strconv.FormatInt(c.expireAt.UnixMilli(), 10))
+	case c.opts.KeepTTL:
+		argv = append(argv, "KEEPTTL")
+	}
+	return [][]string{argv}
+}
+
+// propagate logs the EXPIRE family as PEXPIREAT, or as DEL when the expire
+// time had already passed.
+func (c *ExpireCommand) propagate(result resp.RespValue) [][]string {
+	if result.Num == 0 {
+		return nil
+	}
+	if !c.at.After(time.Now()) {
+		return [][]string{{"DEL", c.key}}
+	}
+	return [][]string{{"PEXPIREAT", c.key, strconv.FormatInt(c.at.UnixMilli(), 10)}}
+}
+
+// propagate logs GETEX as PEXPIREAT with an absolute expire time, as
+// PERSIST, or as DEL when the expire time had already passed. GETEX
+// without options changes nothing.
+func (c *GetExCommand) propagate(result resp.RespValue) [][]string {
+	switch {
+	case !c.found:
+		return nil
+	case c.persist:
+		return [][]string{{"PERSIST", c.key}}
+	case c.expire == nil:
+		return nil
+	case !c.expireAt.After(time.Now()):
+		return [][]string{{"DEL", c.key}}
+	}
+	return [][]string{{"PEXPIREAT", c.key, strconv.FormatInt(c.expireAt.UnixMilli(), 10)}}
+}
+
+// propagate logs RESTORE with an absolute expire time, so replaying it
+// later does not extend the life of the key, or as DEL when the expire
+// time had already passed and the key was replaced.
+func (c *RestoreCommand) propagate(result resp.RespValue) [][]string {
+	if c.expired {
+		if c.opts.Replace {
+			return [][]string{{"DEL", c.key}}
+		}
+		return nil
+	}
+	argv := []string{"RESTORE", c.key, strconv.FormatInt(c.opts.ExpireAt, 10), c.payload}
+	if c.opts.Replace {
+		argv = append(argv, "REPLACE")
+	}
+	if c.opts.ExpireAt > 0 {
+		argv = append(argv, "ABSTTL")
+	}
+	if c.opts.IdleTime >= 0 {
+		argv = append(argv, "IDLETIME", strconv.FormatInt(c.opts.IdleTime, 10))
+	}
+	return [][]string{argv}
+}
+
+// propagate logs SPOP as SREM of the members it popped.
+func (c *SPopCommand) propagate(result resp.RespValue) [][]string {
+	if result.Type == resp.Bulk && !result.Null {
+		return [][]string{{"SREM", c.key, result.Str}}
+	}
+	members := result.Elements()
+	if len(members) == 0 {
+		return nil
+	}
+	return [][]string{append([]string{"SREM", c.key}, bulkStrings(members)...)}
+}
+
+// propagate logs BLPOP and BRPOP as the LPOP or RPOP they did, if any.
+func (c *BPopCommand) propagate(result resp.RespValue) [][]string {
+	popped := result.Elements()
+	if len(popped) != 2 {
+		return nil
+	}
+	name := "RPOP"
+	if c.left {
+		name = "LPOP"
+	}
+	return [][]string{{name, popped[0].Str}}
+}
+
+// propagate logs XREADGROUP as a read of each stream it read entries
+// from, of as many entries as it read and without BLOCK, so replaying it
+// delivers the same entries whenever it was served, and the consumers it
+// created reading nothing. XREAD changes nothing.
+func (c *XReadCommand) propagate(result resp.RespValue) [][]string {
+	if c.group == "" {
+		return nil
+	}
+	var effects [][]string
+	for _, r := range c.streams {
+		switch {
+		case r.read > 0:
+			argv := []string{"XREADGROUP", "GROUP", c.group, c.consumer, "COUNT", strconv.Itoa(r.read)}
+			if c.noAck {
+				argv = append(argv, "NOACK")
+			}
+			id := ">"
+			if !r.newOnly {
+				id = r.after.String()
+			}
+			effects = append(effects, append(argv, "STREAMS", r.key, id))
+		case r.created:
+			effects = append(effects, []string{"XGROUP", "CREATECONSUMER", r.key, c.group, c.consumer})
+		}
+	}
+	return effects
+}
+
+// propagate logs XCLAIM as its effect, see claimEffects.
+func (c *XClaimCommand) propagate(result resp.RespValue) [][]string {
+	return claimEffects(c.key, c.group, c.consumer, c.claim)
+}
+
+// propagate logs XAUTOCLAIM as its effect, see claimEffects.
+func (c *XAutoClaimCommand) propagate(result resp.RespValue) [][]string {
+	return claimEffects(c.key, c.group, c.consumer, c.claim)
+}
+
+// claimEffects returns the commands reproducing claim, made for consumer
+// of group, whatever the clock says when they are replayed: an XCLAIM of
+// each entry claimed with its delivery time and count, an XACK of the
+// pending entries dropped as they were deleted from the stream, and an
+// XGROUP SETID if LASTID moved the last ID of the group and nothing was
+// claimed.
+func claimEffects(key, group, consumer string, claim storage.StreamClaim) [][]string {
+	var effects [][]string
+	for _, p := range claim.Pending {
+		effects = append(effects, []string{"XCLAIM", key, group, consumer, "0", p.ID.String(),
+			"TIME", strconv.FormatInt(p.DeliveryTime, 10),
+			"RETRYCOUNT", strconv.FormatUint(p.DeliveryCount, 10),
+			"FORCE", "JUSTID", "LASTID", claim.LastID.String()})
+	}
+	if len(claim.Deleted) > 0 {
+		argv := []string{"XACK", key, group}
+		for _, id := range claim.Deleted {
+			argv = append(argv, id.String())
+		}
+		effects = append(effects, argv)
+	}
+	if claim.LastIDChanged && len(claim.Pending) == 0 {
+		effects = append(effects, []string{"XGROUP", "SETID", key, group, claim.LastID.String(),
+			"ENTRIESREAD", strconv.FormatInt(claim.EntriesRead, 10)})
+	}
+	return effects
+}
+
+// propagate logs PFDEBUG as PFDEBUG TODENSE when it converted the
+// HyperLogLog to dense, the only change it makes.
+func (c *PFDebugCommand) propagate(result resp.RespValue) [][]string {
+	if !c.converted {
+		return nil
+	}
+	return [][]string{{"PFDEBUG", "TODENSE", c.key}}
+}
+
+// propagate logs GEORADIUS and GEORADIUSBYMEMBER only when they store
+// their results, as they otherwise only read.
+func (c *GeoSearchCommand) propagate(result resp.RespValue) [][]string {
+	if c.store == "" {
+		return nil
+	}
+	return [][]string{append([]string{c.name}, c.argv...)}
+}
+
+// propagate logs XADD with the ID of the entry it added, so replaying it
+// adds the same entry whatever the clock says, and with the LIMIT of
+// approximate trimming spelled out, so replaying it evicts the same ones.
+func (c *XAddCommand) propagate(result resp.RespValue) [][]string {
+	if result.Null {
+		return nil
+	}
+	argv := []string{"XADD", c.key}
+	if c.opts.NoMkStream {
+		argv = append(argv, "NOMKSTREAM")
+	}
+	argv = append(argv, c.trim.argv()...)
+	argv = append(argv, result.Str)
+	return [][]string{append(argv, c.fields...)}
+}
+
+// infoAOF renders the append only file fields of INFO persistence.
+func (cr *CommandRegistry) infoAOF() string {
+	if cr.aof == nil {
+		return "aof_enabled:0\r\n"
+	}
+	rewriting, scheduled, status := 0, 0, "ok"
+	if cr.aof.Rewriting() {
+		rewriting = 1
+	}
+	if cr.aof.RewriteScheduled() {
+		scheduled = 1
+	}
+	if !cr.aof.LastRewriteOK() {
+		status = "err"
+	}
+	size, base := cr.aof.Sizes()
+	return fmt.Sprintf("aof_enabled:1\r\naof_rewrite_in_progress:%d\r\naof_rewrite_scheduled:%d\r\naof_last_bgrewrite_status:%s\r\naof_current_size:%d\r\naof_base_size:%d\r\n",
+		rewriting, scheduled, status, size, base)
+}
@@ -0,0 +1,293 @@
+package command
+
+import (
+	"container/list"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// blockingCommand is implemented by commands that block the calling client
+// until one of their keys can serve them or their timeout elapses, such as
+// BLPOP. Apply runs them without blocking, as scripts do.
+type blockingCommand interface {
+	propagatingCommand
+	// blockingKeys returns the keys the command waits for, in the order
+	// it tries them, without duplicates.
+	blockingKeys() []string
+	// blockTimeout returns how long the command waits, zero for ever.
+	blockTimeout() time.Duration
+	// serve runs the command against key, and reports whether it did:
+	// false if key holds nothing for it, or data of another type.
+	serve(s *storage.Storage, key string) (resp.RespValue, bool)
+	// checkKey returns the error the command replies with at once if key
+	// holds data of another type. A client already blocked keeps waiting
+	// when one of its keys is overwritten so, as in Redis.
+	checkKey(s *storage.Storage, key string) error
+}
+
+// preparingCommand is implemented by blocking commands that depend on the
+// client or on their keys as they stood when the command was run, which
+// they take before trying their keys, such as XREAD BLOCK resolving "$" to
+// the last ID of each stream. An error is replied with at once.
+type preparingCommand interface {
+	prepare(client *Client, s *storage.Storage) error
+}
+
+// waiter is a client blocked by a command, queued on each of its keys.
+type waiter struct {
+	client   *Client
+	cmd      blockingCommand
+	keys     []string
+	elems    []*list.Element // Elements of the waiter in the queues of keys
+	deadline time.Time       // Zero for no timeout
+	done     chan struct{}   // Closed once result is set
+	result   resp.RespValue
+}
+
+// BlockingTable queues the clients blocked by commands such as BLPOP on
+// each of their keys, in the order they blocked. A write to a key serves
+// the clients queued on it first come, first served: the one that waited
+// the longest gets the first element pushed, before the writing command
+// replies. A client leaves the queues once served, once its timeout
+// elapses, on CLIENT UNBLOCK, or when it disconnects.
+type BlockingTable struct {
+	mu       sync.Mutex
+	queues   map[string]*list.List // Waiters by key, longest waiting first
+	waiters  map[*Client]*waiter
+	blocking atomic.Int64 // len(waiters), read without the lock
+}
+
+func newBlockingTable() *BlockingTable {
+	return &BlockingTable{
+		queues:  make(map[string]*list.List),
+		waiters: make(map[*Client]*waiter),
+	}
+}
+
+// block runs cmd for client, or queues the client on the keys of cmd if
+// none can serve it, returning the waiter to wait on. Its keys are tried in
+// order, as Redis does, but a key other clients wait for serves those it
+// can first, the longest waiting first. A client that already disconnected
+// is not queued.
+func (bt *BlockingTable) block(client *Client, cmd blockingCommand, s *storage.Storage, served func(blockingCommand, resp.RespValue)) (resp.RespValue, *waiter) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	// The client counts as blocked before its keys are looked at, so that a
+	// write landing meanwhile serves it once it queued.
+	bt.blocking.Add(1)
+	defer func() { bt.blocking.Store(int64(len(bt.waiters))) }()
+	if pc, ok := cmd.(preparingCommand); ok {
+		if err := pc.prepare(client, s); err != nil {
+			return replyError(err), nil
+		}
+	}
+	keys := cmd.blockingKeys()
+	for _, key := range keys {
+		if err := cmd.checkKey(s, key); err != nil {
+			return replyError(err), nil
+		}
+		if _, ok := bt.queues[key]; ok {
+			bt.serve([]string{key}, s, served)
+		}
+		if result, ok := cmd.serve(s, key); ok {
+			return result, nil
+		}
+	}
+	if client.Disconnected() {
+		return resp.NewNullArray(), nil
+	}
+	w := &waiter{client: client, cmd: cmd, keys: keys, done: make(chan struct{})}
+	if timeout := cmd.blockTimeout(); timeout > 0 {
+		w.deadline = time.Now().Add(timeout)
+	}
+	bt.enqueue(w)
+	return resp.NewNullArray(), w
+}
+
+// wait waits for w to be served, and returns its reply: that of its command,
+// a null array once its timeout elapsed, or an error if CLIENT UNBLOCK
+// asked for one.
+func (bt *BlockingTable) wait(w *waiter) resp.RespValue {
+	var timeout <-chan time.Time
+	if !w.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(w.deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.done:
+	case <-timeout:
+		bt.unblock(w, resp.NewNullArray())
+	}
+	<-w.done
+	return w.result
+}
+
+// serve serves the clients queued on keys that their keys can serve,
+// longest waiting first. A client that cannot be served, such as one
+// reading a consumer group another client just read, keeps waiting without
+// holding back those queued after it. served is called for each command
+// served, to propagate it.
+func (bt *BlockingTable) serve(keys []string, s *storage.Storage, served func(blockingCommand, resp.RespValue)) {
+	for _, key := range keys {
+		q, ok := bt.queues[key]
+		if !ok {
+			continue
+		}
+		for e := q.Front(); e != nil; {
+			w, next := e.Value.(*waiter), e.Next()
+			if result, ok := w.cmd.serve(s, key); ok {
+				bt.remove(w)
+				w.result = result
+				close(w.done)
+				served(w.cmd, result)
+			}
+			e = next
+		}
+	}
+}
+
+// Waiting reports whether clients are blocked, which writes check before
+// looking for the clients their keys can serve.
+func (bt *BlockingTable) Waiting() bool {
+	return bt.blocking.Load() > 0
+}
+
+// Unblock unblocks client if it is blocked, as CLIENT UNBLOCK does, with
+// the reply of a timeout, or with an error if withError is set. It reports
+// whether the client was blocked.
+func (bt *BlockingTable) Unblock(client *Client, withError bool) bool {
+	bt.mu.Lock()
+	w, ok := bt.waiters[client]
+	bt.mu.Unlock()
+	if !ok {
+		return false
+	}
+	result := resp.NewNullArray()
+	if withError {
+		result = replyError(errs.New("UNBLOCKED", "client unblocked via CLIENT UNBLOCK"))
+	}
+	return bt.unblock(w, result)
+}
+
+// Disconnect unblocks a client whose connection went away, and keeps it
+// from blocking again: its connection may still be running the command
+// that was about to block it.
+func (bt *BlockingTable) Disconnect(client *Client) {
+	client.mu.Lock()
+	client.disconnected = true
+	client.mu.Unlock()
+	bt.mu.Lock()
+	w, ok := bt.waiters[client]
+	bt.mu.Unlock()
+	if ok {
+		bt.unblock(w, resp.NewNullArray())
+	}
+}
+
+// unblock removes w from the queues with the given reply, unless it was
+// served meanwhile, and reports whether it did.
+func (bt *BlockingTable) unblock(w *waiter, result resp.RespValue) bool {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	bt.remove(w)
+	w.result = result
+	close(w.done)
+	return true
+}
+
+// Blocked returns the number of blocked clients, and the number of keys
+// they wait for.
+func (bt *BlockingTable) Blocked() (clients, keys int) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return len(bt.waiters), len(bt.queues)
+}
+
+func (bt *BlockingTable) enqueue(w *waiter) {
+	w.elems = make([]*list.Element, len(w.keys))
+	for i, key := range w.keys {
+		q, ok := bt.queues[key]
+		if !ok {
+			q = list.New()
+			bt.queues[key] = q
+		}
+		w.elems[i] = q.PushBack(w)
+	}
+	bt.waiters[w.client] = w
+	bt.blocking.Store(int64(len(bt.waiters)))
+}
+
+func (bt *BlockingTable) remove(w *waiter) {
+	for i, key := range w.keys {
+		q := bt.queues[key]
+		q.Remove(w.elems[i])
+		if q.Len() == 0 {
+			delete(bt.queues, key)
+		}
+	}
+	delete(bt.waiters, w.client)
+	bt.blocking.Store(int64(len(bt.waiters)))
+}
+
+// serveBlocked serves the clients blocked on the keys of the write command
+// argv, which just ran with the given result.
+func (cr *CommandRegistry) serveBlocked(argv []resp.RespValue, result resp.RespValue, s *storage.Storage) {
+	if result.Type == resp.Error || !cr.blocking.Waiting() {
+		return
+	}
+	keys, err := cr.GetKeys(argv)
+	if err != nil || len(keys) == 0 {
+		return
+	}
+	cr.blocking.mu.Lock()
+	defer cr.blocking.mu.Unlock()
+	cr.blocking.serve(keys, s, cr.propagateServed)
+}
+
+// propagateServed appends the effect of a blocking command that was served
+// to the append only file.
+func (cr *CommandRegistry) propagateServed(cmd blockingCommand, result resp.RespValue) {
+	if cr.aof == nil || result.Type == resp.Error {
+		return
+	}
+	for _, argv := range cmd.propagate(result) {
+		if err := cr.aof.Feed(argv); err != nil {
+			log.Printf("Failed to write the append only file: %v", err)
+		}
+	}
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds with
+// millisecond precision, as Redis does. Zero waits for ever, and so does a
+// timeout too long for a time.Duration.
+func parseTimeout(arg string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(secs) {
+		return 0, errs.Errorf("timeout is not a float or out of range")
+	}
+	ms := math.Ceil(secs * 1000)
+	if ms > math.MaxInt64 {
+		return 0, errs.Errorf("timeout is out of range")
+	}
+	if ms < 0 {
+		return 0, errs.NegativeTimeout
+	}
+	if ms >= float64(math.MaxInt64/int64(time.Millisecond)) {
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
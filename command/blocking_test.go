@@ -0,0 +1,383 @@
+package command_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/internal/servertest"
+	"github.com/liweiyuan/go-redis-server/persistence"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// slack is how late a timeout may elapse, generous enough for the race
+// detector.
+const slack = 50 * time.Millisecond
+
+// blockedClients is how many clients block in each test.
+const blockedClients = 50
+
+// waitBlocked waits until n clients are blocked.
+func waitBlocked(t *testing.T, srv *servertest.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		clients, _ := srv.Registry.Blocking().Blocked()
+		if clients == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients blocked, want %d", clients, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// noWaiters checks that no client is blocked, nor any key waited for.
+func noWaiters(t *testing.T, srv *servertest.Server) {
+	t.Helper()
+	if clients, keys := srv.Registry.Blocking().Blocked(); clients != 0 || keys != 0 {
+		t.Errorf("%d clients still blocked on %d keys", clients, keys)
+	}
+}
+
+// popped returns the element of a BLPOP or BRPOP reply, and whether there
+// was one.
+func popped(v resp.RespValue) (string, bool, error) {
+	if v.Null {
+		return "", false, nil
+	}
+	elems := v.Elements()
+	if v.Type != resp.Array || len(elems) != 2 {
+		return "", false, fmt.Errorf("unexpected reply %+v", v)
+	}
+	return elems[1].Str, true, nil
+}
+
+// TestBlockingServesFirstComeFirstServed blocks clients on a key one after
+// the other, then pushes as many elements, one per RPUSH or all in one,
+// and checks that each client got the element of its rank.
+func TestBlockingServesFirstComeFirstServed(t *testing.T) {
+	for _, together := range []bool{false, true} {
+		t.Run(fmt.Sprintf("together=%v", together), func(t *testing.T) {
+			srv := servertest.Start(t)
+			got := make([]resp.RespValue, blockedClients)
+			var wg sync.WaitGroup
+			for i := 0; i < blockedClients; i++ {
+				wg.Add(1)
+				go func(i int, c *command.Client) {
+					defer wg.Done()
+					got[i] = srv.Exec(c, "BLPOP", "other", "k", "0")
+				}(i, srv.Client())
+				waitBlocked(t, srv, i+1)
+			}
+			if together {
+				push := []string{"RPUSH", "k"}
+				for i := 0; i < blockedClients; i++ {
+					push = append(push, strconv.Itoa(i))
+				}
+				srv.Exec(nil, push...)
+			} else {
+				for i := 0; i < blockedClients; i++ {
+					srv.Exec(nil, "RPUSH", "k", strconv.Itoa(i))
+				}
+			}
+			wg.Wait()
+			for i, v := range got {
+				elem, ok, err := popped(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok || elem != strconv.Itoa(i) {
+					t.Errorf("client %d got %+v, want %d", i, v, i)
+				}
+			}
+			if n := srv.Exec(nil, "LLEN", "k"); n.Num != 0 {
+				t.Errorf("%d elements left", n.Num)
+			}
+			noWaiters(t, srv)
+		})
+	}
+}
+
+// TestBlockingServesAnyKey checks that a client blocked on several keys is
+// served by a push to any of them, and only once.
+func TestBlockingServesAnyKey(t *testing.T) {
+	srv := servertest.Start(t)
+	done := make(chan resp.RespValue, 1)
+	go func(c *command.Client) {
+		done <- srv.Exec(c, "BRPOP", "a", "b", "c", "0")
+	}(srv.Client())
+	waitBlocked(t, srv, 1)
+	srv.Exec(nil, "RPUSH", "c", "x")
+	srv.Exec(nil, "RPUSH", "b", "y")
+	if v := (<-done).Elements(); len(v) != 2 || v[0].Str != "c" || v[1].Str != "x" {
+		t.Errorf("got %+v, want [c x]", v)
+	}
+	if n := srv.Exec(nil, "LLEN", "b"); n.Num != 1 {
+		t.Errorf("LLEN b is %d, want 1", n.Num)
+	}
+	noWaiters(t, srv)
+}
+
+// TestBlockingTimeouts checks that BLPOP replies with a null array once its
+// timeout elapsed, not before and not much later.
+func TestBlockingTimeouts(t *testing.T) {
+	srv := servertest.Start(t)
+	for _, timeout := range []string{"0.001", "0.01", "0.05", "0.1", "0.25"} {
+		secs, _ := strconv.ParseFloat(timeout, 64)
+		want := time.Duration(secs * float64(time.Second))
+		start := time.Now()
+		v := srv.Exec(srv.Client(), "BLPOP", "k", timeout)
+		elapsed := time.Since(start)
+		if !v.Null {
+			t.Errorf("timeout %s: got %+v, want a null array", timeout, v)
+		}
+		if elapsed < want || elapsed > want+slack {
+			t.Errorf("timeout %s elapsed after %v", timeout, elapsed)
+		}
+	}
+	noWaiters(t, srv)
+}
+
+// TestBlockingClientsLeave blocks clients, unblocks with CLIENT UNBLOCK or
+// disconnects every other one, then checks that the pushes that follow go
+// to the remaining ones in order.
+func TestBlockingClientsLeave(t *testing.T) {
+	srv := servertest.Start(t)
+	got := make([]resp.RespValue, blockedClients)
+	conns := make([]*command.Client, blockedClients)
+	var wg sync.WaitGroup
+	for i := range conns {
+		conns[i] = srv.Client()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i] = srv.Exec(conns[i], "BLPOP", "k", "0")
+		}(i)
+		waitBlocked(t, srv, i+1)
+	}
+	admin := srv.Client()
+	left := 0
+	for i := 0; i < blockedClients; i += 2 {
+		if i%4 == 0 {
+			reason := "TIMEOUT"
+			if i%8 == 4 {
+				reason = "ERROR"
+			}
+			if v := srv.Exec(admin, "CLIENT", "UNBLOCK", strconv.FormatInt(conns[i].ID, 10), reason); v.Num != 1 {
+				t.Fatalf("CLIENT UNBLOCK of client %d got %+v, want 1", i, v)
+			}
+		} else {
+			srv.Registry.Blocking().Disconnect(conns[i])
+		}
+		left++
+	}
+	waitBlocked(t, srv, blockedClients-left)
+	for i := 1; i < blockedClients; i += 2 {
+		srv.Exec(nil, "RPUSH", "k", strconv.Itoa(i))
+	}
+	wg.Wait()
+	for i, v := range got {
+		if i%8 == 4 {
+			if v.Type != resp.Error || !strings.HasPrefix(v.Str, "UNBLOCKED ") {
+				t.Errorf("client %d got %+v, want -UNBLOCKED", i, v)
+			}
+			continue
+		}
+		elem, ok, err := popped(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 && ok {
+			t.Errorf("client %d left, but got %+v", i, v)
+		}
+		if i%2 == 1 && (!ok || elem != strconv.Itoa(i)) {
+			t.Errorf("client %d got %+v, want %d", i, v, i)
+		}
+	}
+	if v := srv.Exec(admin, "CLIENT", "UNBLOCK", strconv.FormatInt(conns[1].ID, 10)); v.Num != 0 {
+		t.Errorf("CLIENT UNBLOCK of client 1 once served got %+v, want 0", v)
+	}
+	// A client that was unblocked blocks again, one that disconnected does
+	// not.
+	waitBlocked(t, srv, 0)
+	start := time.Now()
+	if v := srv.Exec(conns[0], "BLPOP", "k", "0.05"); !v.Null || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("BLPOP once unblocked got %+v after %v", v, time.Since(start))
+	}
+	if v := srv.Exec(conns[2], "BLPOP", "k", "0"); !v.Null {
+		t.Errorf("BLPOP once disconnected got %+v", v)
+	}
+	noWaiters(t, srv)
+}
+
+// TestBlockingStress runs consumers popping with random timeouts from
+// random keys, some of which are unblocked or disconnect, against
+// producers pushing unique elements, and checks that every element is
+// popped exactly once or left in its list, and that no waiter is left
+// behind. The append only file is enabled, which applies writes one at a
+// time, and must replay to the lists left.
+func TestBlockingStress(t *testing.T) {
+	rounds := 20
+	if testing.Short() {
+		rounds = 2
+	}
+	seed := servertest.Seed(t)
+	for round := 0; round < rounds; round++ {
+		t.Run(fmt.Sprintf("round %d", round), func(t *testing.T) {
+			stress(t, rand.New(rand.NewSource(seed+int64(round))))
+		})
+	}
+}
+
+func stress(t *testing.T, rnd *rand.Rand) {
+	dir := t.TempDir()
+	aof, err := persistence.OpenAOF(dir, "appendonly.aof", persistence.AOFOptions{Fsync: "no"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+	srv := servertest.Start(t)
+	srv.Registry.SetAOF(aof, 0, 0)
+	keys := []string{"k0", "k1", "k2", "k3"}
+	const pushes = 500
+	var mu sync.Mutex
+	seen := make(map[string]int)
+
+	stop := make(chan struct{})
+	var consumers sync.WaitGroup
+	conns := make(chan *command.Client, blockedClients)
+	for i := 0; i < blockedClients; i++ {
+		c := srv.Client()
+		conns <- c
+		r := rand.New(rand.NewSource(rnd.Int63()))
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if c.Disconnected() {
+					return
+				}
+				args := []string{"BLPOP"}
+				for _, k := range r.Perm(len(keys))[:1+r.Intn(len(keys))] {
+					args = append(args, keys[k])
+				}
+				args = append(args, strconv.FormatFloat(float64(1+r.Intn(20))/1000, 'f', 3, 64))
+				if r.Intn(2) == 0 {
+					args[0] = "BRPOP"
+				}
+				reply := srv.Exec(c, args...)
+				if reply.Type == resp.Error && strings.HasPrefix(reply.Str, "UNBLOCKED ") {
+					continue
+				}
+				elem, ok, err := popped(reply)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok {
+					mu.Lock()
+					seen[elem]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	// Unblock or disconnect clients at random while producers push.
+	unblocked := make(chan struct{})
+	go func() {
+		defer close(unblocked)
+		for {
+			select {
+			case <-stop:
+				return
+			case c := <-conns:
+				if rnd.Intn(10) == 0 {
+					srv.Registry.Blocking().Disconnect(c)
+				} else {
+					srv.Registry.Blocking().Unblock(c, rnd.Intn(2) == 0)
+					conns <- c
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	var producers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		producers.Add(1)
+		go func(p int) {
+			defer producers.Done()
+			for n := 0; n < pushes; n++ {
+				key := keys[(p+n)%len(keys)]
+				srv.Exec(nil, "RPUSH", key, fmt.Sprintf("%d-%d", p, n))
+				if n%50 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}(p)
+	}
+	producers.Wait()
+	close(stop)
+	<-unblocked
+	consumers.Wait()
+	if t.Failed() {
+		return
+	}
+
+	for _, key := range keys {
+		rest := srv.Exec(nil, "LRANGE", key, "0", "-1")
+		for _, elem := range rest.Elements() {
+			seen[elem.Str]++
+		}
+	}
+	for p := 0; p < 4; p++ {
+		for n := 0; n < pushes; n++ {
+			elem := fmt.Sprintf("%d-%d", p, n)
+			if seen[elem] != 1 {
+				t.Errorf("element %s popped or left %d times", elem, seen[elem])
+			}
+		}
+	}
+	noWaiters(t, srv)
+	replays(t, srv, dir, keys)
+}
+
+// replays loads the append only file in dir and checks that it holds the
+// same keys as srv.
+func replays(t *testing.T, srv *servertest.Server, dir string, keys []string) {
+	aof, err := persistence.OpenAOF(dir, "appendonly.aof", persistence.AOFOptions{Fsync: "no"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+	loaded := servertest.Start(t)
+	if err := aof.Load(loaded.Storage, func(argv []string) error { return loaded.Registry.Replay(loaded.Storage, argv) }); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		want := srv.Exec(nil, "LRANGE", key, "0", "-1").Elements()
+		got := loaded.Exec(nil, "LRANGE", key, "0", "-1").Elements()
+		if len(got) != len(want) {
+			t.Errorf("append only file replays %s with %d elements, want %d", key, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i].Str != want[i].Str {
+				t.Errorf("append only file replays %s[%d] as %q, want %q", key, i, got[i].Str, want[i].Str)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/scripting"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// defaultBusyReplyThreshold is how long a script runs before other clients
+// are answered with -BUSY, unless SetBusyReplyThreshold says otherwise.
+const defaultBusyReplyThreshold = 5 * time.Second
+
+// States of a running script.
+const (
+	scriptRunning int32 = iota
+	scriptWrote         // It called a write command, so it can no longer be killed
+	scriptKilled        // SCRIPT KILL or FUNCTION KILL stopped it
+)
+
+// runningScript is a script, or function, being run. Commands of other
+// clients wait for it to return until it ran for longer than the busy reply
+// threshold; from then on they are answered with -BUSY.
+type runningScript struct {
+	function bool // Run by FCALL rather than EVAL
+	readOnly bool // It may not call write commands
+	start    time.Time
+	ctx      context.Context // Canceled by SCRIPT KILL and FUNCTION KILL
+	cancel   context.CancelFunc
+	done     chan struct{} // Closed once it returned
+	state    atomic.Int32  // scriptRunning, scriptWrote or scriptKilled
+	effects  [][]string    // Commands reproducing its writes, for the append only file
+}
+
+// busyCommand is implemented by commands that run while a script does,
+// without waiting for it, such as SCRIPT KILL.
+type busyCommand interface {
+	allowBusy() bool
+}
+
+// SetBusyReplyThreshold sets how long a script, or function, runs before
+// the commands of other clients are answered with -BUSY instead of waiting
+// for it to return. Zero makes them wait however long it runs.
+func (cr *CommandRegistry) SetBusyReplyThreshold(d time.Duration) {
+	cr.busyReplyThreshold = d
+}
+
+// runScript runs a script, or function, with run, which is given the
+// context stopping it and the executor of the commands it calls, and
+// appends the writes it made to the append only file.
+func (cr *CommandRegistry) runScript(client *Client, s *storage.Storage, function, readOnly bool, run func(ctx context.Context, call scripting.CallFunc) (resp.RespValue, error)) resp.RespValue {
+	ctx, cancel := context.WithCancel(context.Background())
+	rs := &runningScript{function: function, readOnly: readOnly, start: time.Now(), ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	cr.script.Store(rs)
+	result, err := run(ctx, cr.scriptCall(client, s, rs))
+	cr.script.Store(nil)
+	cancel()
+	close(rs.done)
+
+	// A script failing halfway keeps the writes it made, so they are
+	// logged either way.
+	if cr.aof != nil {
+		cr.propagateScript(rs.effects)
+	}
+	if err != nil {
+		return replyError(err)
+	}
+	return result
+}
+
+// waitScript waits for the script being run, if any, to return. Once the
+// script ran for longer than the busy reply threshold, it returns the -BUSY
+// error instead.
+func (cr *CommandRegistry) waitScript() error {
+	for {
+		rs := cr.script.Load()
+		if rs == nil {
+			return nil
+		}
+		if cr.busyReplyThreshold <= 0 {
+			<-rs.done
+			continue
+		}
+		timer := time.NewTimer(time.Until(rs.start.Add(cr.busyReplyThreshold)))
+		select {
+		case <-rs.done:
+			timer.Stop()
+		case <-timer.C:
+			if rs.function {
+				return errs.BusyFunction
+			}
+			return errs.BusyScript
+		}
+	}
+}
+
+// killScript stops the script run by EVAL, or the function run by FCALL if
+// function is true. A script that already called a write command is not
+// stopped, as that would leave its writes half done.
+func (cr *CommandRegistry) killScript(function bool) error {
+	rs := cr.script.Load()
+	if rs == nil || rs.function != function {
+		return errs.NotBusy
+	}
+	if !rs.state.CompareAndSwap(scriptRunning, scriptKilled) && rs.state.Load() == scriptWrote {
+		return errs.Unkillable
+	}
+	rs.cancel()
+	return nil
+}
+
+// markWrite records that the script is about to call a write command,
+// which makes it unkillable. It returns false if the script was killed.
+func (rs *runningScript) markWrite() bool {
+	return rs.state.CompareAndSwap(scriptRunning, scriptWrote) || rs.state.Load() == scriptWrote
+}
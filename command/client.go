@@ -0,0 +1,436 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// ClientAwareCommand is implemented by commands that act on the calling client.
+// The connection handler calls ApplyClient instead of Apply for them.
+type ClientAwareCommand interface {
+	ApplyClient(c *Client, s *storage.Storage) resp.RespValue
+}
+
+// Client is the state of a client connection.
+type Client struct {
+	ID        int64
+	Addr      string
+	LocalAddr string
+	CreatedAt time.Time
+
+	mu              sync.Mutex
+	name            string
+	user            string // The user the client runs commands as
+	authenticated   bool   // Authenticated as user, see CommandRegistry.AuthenticateDefault
+	lastInteraction time.Time
+	lastCommand     string
+	noEvict         bool   // Exempt from client eviction
+	noTouch         bool   // Does not update the access time of keys it reads
+	protocol        int    // RESP protocol version
+	db              int    // Database selected with SELECT, db0 being the only one
+	repliesOff      bool   // Set by CLIENT REPLY OFF
+	skipReplies     int    // Replies still to drop, after CLIENT REPLY SKIP
+	libName         string // Set with CLIENT SETINFO
+	libVer          string
+	tracking        trackingState
+	subscriptions   [3]map[string]struct{} // Subscribed channels and patterns by pubsubKind
+	push            func(resp.RespValue)   // Writes an out-of-band message to the connection
+	closing         bool                   // Close the connection after the current reply
+	disconnected    bool                   // The connection went away, see BlockingTable.Disconnect
+	inputMemory     int64                  // Bytes read of requests not yet executed
+	outputMemory    int64                  // Bytes of replies being written
+	disconnect      func()                 // Closes the connection at once
+	list            *ClientList            // The list the client is registered in
+	detached        bool                   // Its memory no longer counts in the list: evicted or unregistered
+}
+
+// Name returns the connection name set with CLIENT SETNAME.
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// SetName sets the connection name.
+func (c *Client) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// User returns the name of the user the client runs commands as.
+func (c *Client) User() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// Authenticated reports whether the client may run commands besides those
+// authenticating it.
+func (c *Client) Authenticated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authenticated
+}
+
+func (c *Client) setUser(name string, authenticated bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user, c.authenticated = name, authenticated
+}
+
+// NoEvict reports whether the client is exempt from client eviction.
+func (c *Client) NoEvict() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.noEvict
+}
+
+// NoTouch reports whether the commands of the client leave the access time
+// of the keys they read unchanged.
+func (c *Client) NoTouch() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.noTouch
+}
+
+// Protocol returns the RESP protocol version spoken by the client.
+func (c *Client) Protocol() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocol
+}
+
+// DB returns the index of the database selected by the client.
+func (c *Client) DB() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db
+}
+
+// ReplySuppressed reports whether the reply to the command the client just
+// ran is dropped rather than sent, as CLIENT REPLY OFF and SKIP ask. It is
+// called once for each reply, which counts it against a SKIP. Out-of-band
+// messages are sent regardless.
+func (c *Client) ReplySuppressed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skipReplies > 0 {
+		c.skipReplies--
+		return true
+	}
+	return c.repliesOff
+}
+
+// SetPusher sets the function used to send out-of-band messages, such as
+// invalidations, to the client. It must be safe to call concurrently with
+// the connection writing replies.
+func (c *Client) SetPusher(push func(resp.RespValue)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.push = push
+}
+
+// Push sends an out-of-band message to the client.
+func (c *Client) Push(v resp.RespValue) {
+	c.mu.Lock()
+	push := c.push
+	c.mu.Unlock()
+	if push != nil {
+		push(v)
+	}
+}
+
+// SetDisconnect sets the function closing the connection at once, used to
+// evict the client.
+func (c *Client) SetDisconnect(disconnect func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disconnect = disconnect
+}
+
+// AddInputMemory adds n, which may be negative, to the bytes of requests
+// the connection read and did not finish executing.
+func (c *Client) AddInputMemory(n int64) {
+	c.addMemory(&c.inputMemory, n)
+}
+
+// AddOutputMemory adds n, which may be negative, to the bytes of replies
+// being written to the connection.
+func (c *Client) AddOutputMemory(n int64) {
+	c.addMemory(&c.outputMemory, n)
+}
+
+// addMemory adds n to counter, one of the memory counters of the client,
+// and to the total of its list, evicting clients if the total grew past
+// the limit.
+func (c *Client) addMemory(counter *int64, n int64) {
+	c.mu.Lock()
+	*counter += n
+	counted := !c.detached && c.list != nil
+	if counted {
+		c.list.memory.Add(n)
+	}
+	c.mu.Unlock()
+	if counted && n > 0 {
+		c.list.enforceMemoryLimit()
+	}
+}
+
+// Memory returns the bytes the buffers of the connection hold.
+func (c *Client) Memory() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inputMemory + c.outputMemory
+}
+
+// detach stops counting the memory of the client in its list, and reports
+// whether it was counted.
+func (c *Client) detach() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.detached || c.list == nil {
+		return false
+	}
+	c.detached = true
+	c.list.memory.Add(-(c.inputMemory + c.outputMemory))
+	return true
+}
+
+// kill closes the connection at once.
+func (c *Client) kill() {
+	c.mu.Lock()
+	disconnect := c.disconnect
+	c.mu.Unlock()
+	if disconnect != nil {
+		disconnect()
+	}
+}
+
+// clientType returns the type of the client, as CLIENT KILL TYPE selects
+// it: pubsub if it is subscribed to a channel or pattern, normal
+// otherwise. The server has no replicas nor master.
+func (c *Client) clientType() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subscriptionCount(globalChannels)+c.subscriptionCount(shardChannels) > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// InSubscribeMode reports whether the client is a RESP2 client subscribed
+// to at least one channel or pattern, which restricts the commands it may
+// send.
+func (c *Client) InSubscribeMode() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocol < 3 && c.subscriptionCount(globalChannels)+c.subscriptionCount(shardChannels) > 0
+}
+
+// Close asks for the connection to be closed once the reply to the current
+// command has been written.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closing = true
+}
+
+// Closing reports whether the connection is to be closed.
+func (c *Client) Closing() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closing
+}
+
+// Disconnected reports whether the connection of the client went away.
+func (c *Client) Disconnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.disconnected
+}
+
+// Touch records that the client just ran the named command.
+func (c *Client) Touch(cmdName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastInteraction = time.Now()
+	c.lastCommand = strings.ToLower(cmdName)
+}
+
+// flags returns the CLIENT LIST flags of the client.
+func (c *Client) flags() string {
+	flags := ""
+	if c.noEvict {
+		flags += "e"
+	}
+	if c.noTouch {
+		flags += "T"
+	}
+	if c.subscriptionCount(globalChannels)+c.subscriptionCount(shardChannels) > 0 {
+		flags += "P"
+	}
+	if c.tracking.enabled {
+		flags += "t"
+		if c.tracking.bcast {
+			flags += "B"
+		}
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return flags
+}
+
+// redir returns the client ID invalidations are redirected to, or -1 when
+// tracking is off.
+func (c *Client) redir() int64 {
+	if !c.tracking.enabled {
+		return -1
+	}
+	return c.tracking.redirect
+}
+
+// info returns the CLIENT LIST line describing the client.
+func (c *Client) info() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d ssub=%d qbuf=%d omem=%d tot-mem=%d cmd=%s user=%s redir=%d resp=%d lib-name=%s lib-ver=%s",
+		c.ID, c.Addr, c.LocalAddr, c.name,
+		int64(now.Sub(c.CreatedAt).Seconds()), int64(now.Sub(c.lastInteraction).Seconds()),
+		c.flags(), c.db, len(c.subscriptions[globalChannels]), len(c.subscriptions[channelPatterns]), len(c.subscriptions[shardChannels]),
+		c.inputMemory, c.outputMemory, c.inputMemory+c.outputMemory,
+		c.lastCommand, c.user, c.redir(), c.protocol, c.libName, c.libVer)
+}
+
+// ClientList tracks the connected clients.
+type ClientList struct {
+	mu      sync.Mutex
+	nextID  int64
+	clients map[int64]*Client
+
+	memory      atomic.Int64 // Bytes the buffers of the clients hold
+	memoryLimit atomic.Int64 // Most bytes memory may reach before clients are evicted, 0 for no limit
+	evicted     atomic.Int64 // Clients evicted for exceeding memoryLimit
+	evicting    sync.Mutex   // Held while clients are evicted
+}
+
+func newClientList() *ClientList {
+	return &ClientList{clients: make(map[int64]*Client)}
+}
+
+// Register adds a new client connected from addr to the local address
+// laddr, and returns it.
+func (cl *ClientList) Register(addr, laddr string) *Client {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.nextID++
+	now := time.Now()
+	c := &Client{
+		ID:              cl.nextID,
+		Addr:            addr,
+		LocalAddr:       laddr,
+		CreatedAt:       now,
+		lastInteraction: now,
+		protocol:        2,
+		user:            "default",
+		list:            cl,
+	}
+	cl.clients[c.ID] = c
+	return c
+}
+
+// Unregister removes a disconnected client.
+func (cl *ClientList) Unregister(c *Client) {
+	c.detach()
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	delete(cl.clients, c.ID)
+}
+
+// Get returns the client with the given ID.
+func (cl *ClientList) Get(id int64) (*Client, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	c, ok := cl.clients[id]
+	return c, ok
+}
+
+// Len returns the number of connected clients.
+func (cl *ClientList) Len() int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return len(cl.clients)
+}
+
+// All returns the connected clients ordered by ID.
+func (cl *ClientList) All() []*Client {
+	cl.mu.Lock()
+	clients := make([]*Client, 0, len(cl.clients))
+	for _, c := range cl.clients {
+		clients = append(clients, c)
+	}
+	cl.mu.Unlock()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ID < clients[j].ID
+	})
+	return clients
+}
+
+// SetMemoryLimit sets the most bytes the buffers of all clients may hold,
+// as maxmemory-clients does; 0 removes the limit. Past it, the clients
+// holding the most are disconnected, largest first, until the rest hold
+// less.
+func (cl *ClientList) SetMemoryLimit(limit int64) {
+	cl.memoryLimit.Store(limit)
+	cl.enforceMemoryLimit()
+}
+
+// Memory returns the bytes the buffers of all clients hold.
+func (cl *ClientList) Memory() int64 {
+	return cl.memory.Load()
+}
+
+// Evicted returns the number of clients disconnected for exceeding the
+// memory limit.
+func (cl *ClientList) Evicted() int64 {
+	return cl.evicted.Load()
+}
+
+// enforceMemoryLimit evicts clients while the memory of all clients
+// exceeds the limit. Clients exempted with CLIENT NO-EVICT are never
+// evicted. Evicting a client stops counting its memory at once, before its
+// connection finishes closing, so a client is not evicted for memory
+// another one is about to release. If clients are already being evicted,
+// the eviction in progress takes care of the limit.
+func (cl *ClientList) enforceMemoryLimit() {
+	limit := cl.memoryLimit.Load()
+	if limit <= 0 || cl.memory.Load() <= limit || !cl.evicting.TryLock() {
+		return
+	}
+	defer cl.evicting.Unlock()
+	clients := cl.All()
+	memory := make(map[*Client]int64, len(clients))
+	for _, c := range clients {
+		memory[c] = c.Memory()
+	}
+	sort.SliceStable(clients, func(i, j int) bool { return memory[clients[i]] > memory[clients[j]] })
+	for _, c := range clients {
+		if cl.memory.Load() <= limit {
+			return
+		}
+		if c.NoEvict() || !c.detach() {
+			continue
+		}
+		cl.evicted.Add(1)
+		c.kill()
+	}
+}
@@ -0,0 +1,756 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerClientCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "QUIT", MinArgs: 0, MaxArgs: -1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth, Categories: []string{"@connection"}, New: NewQuitCommand},
+		{Name: "RESET", MinArgs: 0, MaxArgs: 0, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth, Categories: []string{"@connection"}, New: cr.newResetCommand},
+		{Name: "AUTH", MinArgs: 1, MaxArgs: -1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth, Categories: []string{"@connection"}, New: cr.newAuthCommand},
+		{Name: "SELECT", MinArgs: 1, MaxArgs: 1, Flags: FlagLoading | FlagStale | FlagFast, Categories: []string{"@connection"}, New: cr.newSelectCommand},
+		{Name: "HELLO", MinArgs: 0, MaxArgs: -1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast | FlagNoAuth, Categories: []string{"@connection"}, New: cr.newHelloCommand},
+		{Name: "CLIENT", MinArgs: 1, MaxArgs: -1, Flags: FlagNoScript | FlagLoading | FlagStale, Categories: []string{"@connection"}, Subcommands: cr.clientSubcommands()},
+	})
+}
+
+// clientSubcommands returns the subcommands of CLIENT.
+func (cr *CommandRegistry) clientSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "CACHING", MinArgs: 1, MaxArgs: 1, New: cr.newClientSwitchCommand("CACHING", "YES", "NO"), Usage: "(YES|NO)", Help: []string{
+			"Enable/disable tracking of the keys for next command in OPTIN/OPTOUT modes.",
+		}},
+		{Name: "GETREDIR", MinArgs: 0, MaxArgs: 0, New: cr.newClientCommand("GETREDIR"), Help: []string{
+			"Return the client ID we are redirecting to when tracking is enabled.",
+		}},
+		{Name: "GETNAME", MinArgs: 0, MaxArgs: 0, New: cr.newClientCommand("GETNAME"), Help: []string{
+			"Return the name of the current connection.",
+		}},
+		{Name: "ID", MinArgs: 0, MaxArgs: 0, New: cr.newClientCommand("ID"), Help: []string{
+			"Return the ID of the current connection.",
+		}},
+		{Name: "INFO", MinArgs: 0, MaxArgs: 0, New: cr.newClientCommand("INFO"), Help: []string{
+			"Return information about the current client connection.",
+		}},
+		{Name: "KILL", MinArgs: 1, MaxArgs: -1, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, New: cr.newClientKillCommand, Usage: "<ip:port> | <option> <value> [<option> <value> [...]]", Help: []string{
+			"Kill the connection made from <ip:port>, or the connections matching",
+			"all the options. Options are:",
+			"* ADDR <ip:port>",
+			"  Kill connections made from the specified address.",
+			"* LADDR <ip:port>",
+			"  Kill connections made to the specified local address.",
+			"* TYPE (NORMAL|MASTER|REPLICA|PUBSUB)",
+			"  Kill connections by type.",
+			"* USER <username>",
+			"  Kill connections authenticated by <username>.",
+			"* SKIPME (YES|NO)",
+			"  Skip killing current connection (default: yes).",
+			"* ID <client-id>",
+			"  Kill connections by client id.",
+			"* MAXAGE <maxage>",
+			"  Kill connections older than the specified age.",
+		}},
+		{Name: "LIST", MinArgs: 0, MaxArgs: 0, New: cr.newClientCommand("LIST"), Help: []string{
+			"Return information about client connections.",
+		}},
+		{Name: "NO-EVICT", MinArgs: 1, MaxArgs: 1, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, New: cr.newClientSwitchCommand("NO-EVICT", "ON", "OFF"), Usage: "(ON|OFF)", Help: []string{
+			"Protect current client connection from eviction.",
+		}},
+		{Name: "NO-TOUCH", MinArgs: 1, MaxArgs: 1, New: cr.newClientSwitchCommand("NO-TOUCH", "ON", "OFF"), Usage: "(ON|OFF)", Help: []string{
+			"Will not touch LRU/LFU stats when this mode is on.",
+		}},
+		{Name: "PAUSE", MinArgs: 1, MaxArgs: 2, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, New: cr.newClientPauseCommand, Usage: "<timeout> [WRITE|ALL]", Help: []string{
+			"Suspend all, or just write, clients for <timeout> milliseconds.",
+		}},
+		{Name: "REPLY", MinArgs: 1, MaxArgs: 1, Flags: FlagNoScript | FlagLoading | FlagStale, New: cr.newClientReplyCommand, Usage: "(ON|OFF|SKIP)", Help: []string{
+			"Control the replies sent to the current connection.",
+		}},
+		{Name: "SETINFO", MinArgs: 2, MaxArgs: 2, New: cr.newClientSetInfoCommand, Usage: "<option> <value>", Help: []string{
+			"Set client meta attr. Options are:",
+			"* LIB-NAME: the client lib name.",
+			"* LIB-VER: the client lib version.",
+		}},
+		{Name: "SETNAME", MinArgs: 1, MaxArgs: 1, New: cr.newClientSetNameCommand, Usage: "<name>", Help: []string{
+			"Assign the name <name> to the current connection.",
+		}},
+		{Name: "TRACKING", MinArgs: 1, MaxArgs: -1, New: cr.newClientTrackingCommand, Usage: "(ON|OFF) [REDIRECT <id>] [BCAST] [PREFIX <prefix> [...]] [OPTIN] [OPTOUT] [NOLOOP]", Help: []string{
+			"Control server assisted client side caching.",
+		}},
+		{Name: "TRACKINGINFO", MinArgs: 0, MaxArgs: 0, New: cr.newClientCommand("TRACKINGINFO"), Help: []string{
+			"Report tracking status for the current connection.",
+		}},
+		{Name: "UNBLOCK", MinArgs: 1, MaxArgs: 2, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, New: cr.newClientUnblockCommand, Usage: "<clientid> [TIMEOUT|ERROR]", Help: []string{
+			"Unblock the specified blocked client.",
+		}},
+		{Name: "UNPAUSE", MinArgs: 0, MaxArgs: 0, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, New: cr.newClientCommand("UNPAUSE"), Help: []string{
+			"Stop the current client pause, resuming traffic.",
+		}},
+	}
+}
+
+// ClientCommand implements the CLIENT command.
+type ClientCommand struct {
+	registry   *CommandRegistry
+	subcommand string
+	args       []string
+	tracking   trackingState // Parsed CLIENT TRACKING options
+	kill       killFilter    // Parsed CLIENT KILL filters
+}
+
+// clientCommand returns the CLIENT subcommand named subcommand with the
+// arguments args, bound to the registry.
+func (cr *CommandRegistry) clientCommand(subcommand string, args []resp.RespValue) *ClientCommand {
+	return &ClientCommand{registry: cr, subcommand: subcommand, args: bulkStrings(args)}
+}
+
+// newClientCommand returns the constructor of the CLIENT subcommand named
+// subcommand, whose arguments need no parsing.
+func (cr *CommandRegistry) newClientCommand(subcommand string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return cr.clientCommand(subcommand, args), nil
+	}
+}
+
+// newClientSwitchCommand returns the constructor of the CLIENT subcommand
+// named subcommand, which turns a mode on or off with its argument, on or
+// off, in any case.
+func (cr *CommandRegistry) newClientSwitchCommand(subcommand, on, off string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		c := cr.clientCommand(subcommand, args)
+		c.args[0] = strings.ToUpper(c.args[0])
+		if c.args[0] != on && c.args[0] != off {
+			return nil, errs.Syntax
+		}
+		return c, nil
+	}
+}
+
+// newClientReplyCommand creates a new CLIENT REPLY command.
+func (cr *CommandRegistry) newClientReplyCommand(args []resp.RespValue) (Command, error) {
+	c := cr.clientCommand("REPLY", args)
+	c.args[0] = strings.ToUpper(c.args[0])
+	if c.args[0] != "ON" && c.args[0] != "OFF" && c.args[0] != "SKIP" {
+		return nil, errs.Syntax
+	}
+	return c, nil
+}
+
+// newClientUnblockCommand creates a new CLIENT UNBLOCK command.
+func (cr *CommandRegistry) newClientUnblockCommand(args []resp.RespValue) (Command, error) {
+	if _, err := strconv.ParseInt(args[0].Str, 10, 64); err != nil {
+		return nil, errs.NotInteger
+	}
+	c := cr.clientCommand("UNBLOCK", args)
+	if len(c.args) == 2 {
+		c.args[1] = strings.ToUpper(c.args[1])
+		if c.args[1] != "TIMEOUT" && c.args[1] != "ERROR" {
+			return nil, errs.Errorf("CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+		}
+	}
+	return c, nil
+}
+
+// newClientSetNameCommand creates a new CLIENT SETNAME command.
+func (cr *CommandRegistry) newClientSetNameCommand(args []resp.RespValue) (Command, error) {
+	if err := checkClientName(args[0].Str); err != nil {
+		return nil, err
+	}
+	return cr.clientCommand("SETNAME", args), nil
+}
+
+// newClientSetInfoCommand creates a new CLIENT SETINFO command.
+func (cr *CommandRegistry) newClientSetInfoCommand(args []resp.RespValue) (Command, error) {
+	c := cr.clientCommand("SETINFO", args)
+	attr := strings.ToLower(c.args[0])
+	if attr != "lib-name" && attr != "lib-ver" {
+		return nil, errs.Errorf("Unrecognized option '%s'", c.args[0])
+	}
+	for _, ch := range []byte(c.args[1]) {
+		if ch < '!' || ch > '~' {
+			return nil, errs.Errorf("%s cannot contain spaces, newlines or special characters.", attr)
+		}
+	}
+	c.args[0] = attr
+	return c, nil
+}
+
+// newClientTrackingCommand creates a new CLIENT TRACKING command.
+func (cr *CommandRegistry) newClientTrackingCommand(args []resp.RespValue) (Command, error) {
+	c := cr.clientCommand("TRACKING", args)
+	var err error
+	if c.tracking, err = parseTracking(c.args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClientPauseCommand creates a new CLIENT PAUSE command.
+func (cr *CommandRegistry) newClientPauseCommand(args []resp.RespValue) (Command, error) {
+	c := cr.clientCommand("PAUSE", args)
+	timeout, err := strconv.ParseInt(c.args[0], 10, 64)
+	if err != nil {
+		return nil, errs.Errorf("timeout is not an integer or out of range")
+	}
+	if timeout < 0 {
+		return nil, errs.NegativeTimeout
+	}
+	if len(c.args) == 2 {
+		c.args[1] = strings.ToUpper(c.args[1])
+		if c.args[1] != "WRITE" && c.args[1] != "ALL" {
+			return nil, errs.Syntax
+		}
+	}
+	return c, nil
+}
+
+// newClientKillCommand creates a new CLIENT KILL command.
+func (cr *CommandRegistry) newClientKillCommand(args []resp.RespValue) (Command, error) {
+	c := cr.clientCommand("KILL", args)
+	var err error
+	if c.kill, err = cr.parseKillFilter(c.args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkClientName returns the error of a connection name with spaces or
+// newlines, which would break the CLIENT LIST format.
+func checkClientName(name string) error {
+	if strings.ContainsAny(name, " \r\n") {
+		return errs.Errorf("Client names cannot contain spaces, newlines or special characters.")
+	}
+	return nil
+}
+
+// parseTracking parses the arguments of CLIENT TRACKING on|off [options].
+func parseTracking(args []string) (trackingState, error) {
+	var state trackingState
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		state.enabled = true
+	case "OFF":
+	default:
+		return state, errs.Syntax
+	}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i+1 >= len(args) {
+				return state, errs.Syntax
+			}
+			i++
+			id, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return state, errs.NotInteger
+			}
+			state.redirect = id
+		case "PREFIX":
+			if i+1 >= len(args) {
+				return state, errs.Syntax
+			}
+			i++
+			state.prefixes = append(state.prefixes, args[i])
+		case "BCAST":
+			state.bcast = true
+		case "OPTIN":
+			state.optIn = true
+		case "OPTOUT":
+			state.optOut = true
+		case "NOLOOP":
+			state.noLoop = true
+		default:
+			return state, errs.Syntax
+		}
+	}
+	if len(state.prefixes) > 0 && !state.bcast {
+		return state, errs.Errorf("PREFIX option requires BCAST mode to be enabled")
+	}
+	if state.optIn && state.optOut {
+		return state, errs.Errorf("You can't use both OPTIN and OPTOUT")
+	}
+	if state.bcast && (state.optIn || state.optOut) {
+		return state, errs.Errorf("OPTIN and OPTOUT are not compatible with BCAST")
+	}
+	for i, p := range state.prefixes {
+		for j, q := range state.prefixes {
+			if i != j && strings.HasPrefix(p, q) {
+				return state, errs.Errorf("Prefix '%s' overlaps with another provided prefix '%s'. Prefixes for a single client must not overlap.", p, q)
+			}
+		}
+	}
+	return state, nil
+}
+
+// killFilter selects the clients CLIENT KILL disconnects: those matching
+// every filter given.
+type killFilter struct {
+	legacy     bool   // The old form, CLIENT KILL addr
+	id         int64  // Zero for any
+	clientType string // "" for any
+	addr       string // "" for any
+	laddr      string // "" for any
+	user       string // "" for any
+	maxAge     int64  // Seconds; only clients connected for longer match, zero for any
+	skipMe     bool   // The calling client does not match
+}
+
+// parseKillFilter parses the arguments of CLIENT KILL: either the address
+// of the client alone, or filter and value pairs.
+func (cr *CommandRegistry) parseKillFilter(args []string) (killFilter, error) {
+	if len(args) == 1 {
+		return killFilter{legacy: true, addr: args[0]}, nil
+	}
+	if len(args)%2 != 0 {
+		return killFilter{}, errs.Syntax
+	}
+	f := killFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id < 1 {
+				return f, errs.Errorf("client-id should be greater than 0")
+			}
+			f.id = id
+		case "TYPE":
+			f.clientType = strings.ToLower(value)
+			switch f.clientType {
+			case "normal", "pubsub", "master", "replica":
+			case "slave":
+				f.clientType = "replica"
+			default:
+				return f, errs.Errorf("Unknown client type '%s'", value)
+			}
+		case "USER":
+			if _, ok := cr.acl.user(value); !ok {
+				return f, errs.Errorf("No such user '%s'", value)
+			}
+			f.user = value
+		case "ADDR":
+			f.addr = value
+		case "LADDR":
+			f.laddr = value
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				f.skipMe = true
+			case "no":
+				f.skipMe = false
+			default:
+				return f, errs.Syntax
+			}
+		case "MAXAGE":
+			age, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return f, errs.NotInteger
+			}
+			f.maxAge = age
+		default:
+			return f, errs.Syntax
+		}
+	}
+	return f, nil
+}
+
+// matches reports whether the filter selects other, for a CLIENT KILL sent
+// by caller at now.
+func (f killFilter) matches(other, caller *Client, now time.Time) bool {
+	if f.skipMe && other == caller {
+		return false
+	}
+	if f.id != 0 && other.ID != f.id {
+		return false
+	}
+	if f.addr != "" && other.Addr != f.addr {
+		return false
+	}
+	if f.laddr != "" && other.LocalAddr != f.laddr {
+		return false
+	}
+	if f.user != "" && other.User() != f.user {
+		return false
+	}
+	if f.maxAge > 0 && int64(now.Sub(other.CreatedAt).Seconds()) <= f.maxAge {
+		return false
+	}
+	if f.clientType != "" && other.clientType() != f.clientType {
+		return false
+	}
+	return true
+}
+
+// applyKill disconnects the clients selected by the filters. The calling
+// client, if selected, is disconnected once the reply is written.
+func (c *ClientCommand) applyKill(client *Client) resp.RespValue {
+	now := time.Now()
+	killed := int64(0)
+	for _, other := range c.registry.clients.All() {
+		if !c.kill.matches(other, client, now) {
+			continue
+		}
+		if other == client {
+			client.Close()
+		} else {
+			other.kill()
+		}
+		killed++
+	}
+	if c.kill.legacy {
+		if killed == 0 {
+			return replyError(errs.Errorf("No such client"))
+		}
+		return replyOK()
+	}
+	return replyInteger(killed)
+}
+
+// Apply is never called for CLIENT, which needs the calling client.
+func (c *ClientCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("CLIENT"))
+}
+
+// ApplyClient executes the CLIENT command for the calling client.
+func (c *ClientCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "ID":
+		return replyInteger(client.ID)
+	case "GETNAME":
+		name := client.Name()
+		return replyBulkOrNil(name, name != "")
+	case "SETNAME":
+		client.SetName(c.args[0])
+		return replyOK()
+	case "SETINFO":
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if c.args[0] == "lib-name" {
+			client.libName = c.args[1]
+		} else {
+			client.libVer = c.args[1]
+		}
+		return replyOK()
+	case "INFO":
+		return resp.NewVerbatim("txt", client.info()+"\n")
+	case "LIST":
+		var b strings.Builder
+		for _, other := range c.registry.clients.All() {
+			b.WriteString(other.info())
+			b.WriteString("\n")
+		}
+		return resp.NewVerbatim("txt", b.String())
+	case "NO-EVICT":
+		client.mu.Lock()
+		client.noEvict = c.args[0] == "ON"
+		client.mu.Unlock()
+		return replyOK()
+	case "NO-TOUCH":
+		client.mu.Lock()
+		client.noTouch = c.args[0] == "ON"
+		client.mu.Unlock()
+		return replyOK()
+	case "REPLY":
+		// The reply to CLIENT REPLY itself is dropped, but for ON, and so is
+		// the reply to the next command for SKIP.
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		client.repliesOff = c.args[0] == "OFF"
+		client.skipReplies = 0
+		if c.args[0] == "SKIP" {
+			client.skipReplies = 2
+		}
+		return replyOK()
+	case "TRACKING":
+		return c.applyTracking(client)
+	case "KILL":
+		return c.applyKill(client)
+	case "PAUSE":
+		timeout, _ := strconv.ParseInt(c.args[0], 10, 64)
+		all := len(c.args) == 1 || c.args[1] == "ALL"
+		c.registry.Pause(time.Duration(timeout)*time.Millisecond, all)
+		return replyOK()
+	case "UNBLOCK":
+		id, _ := strconv.ParseInt(c.args[0], 10, 64)
+		target, ok := c.registry.clients.Get(id)
+		if !ok {
+			return replyInteger(0)
+		}
+		withError := len(c.args) == 2 && c.args[1] == "ERROR"
+		if !c.registry.blocking.Unblock(target, withError) {
+			return replyInteger(0)
+		}
+		return replyInteger(1)
+	case "UNPAUSE":
+		c.registry.Unpause()
+		return replyOK()
+	case "CACHING":
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if !client.tracking.enabled || !(client.tracking.optIn || client.tracking.optOut) {
+			return replyError(errs.Errorf("CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled"))
+		}
+		if client.tracking.optIn && c.args[0] == "NO" {
+			return replyError(errs.Errorf("CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."))
+		}
+		if client.tracking.optOut && c.args[0] == "YES" {
+			return replyError(errs.Errorf("CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode."))
+		}
+		client.tracking.caching = c.args[0] == "YES"
+		client.tracking.cachingSet = true
+		return replyOK()
+	case "GETREDIR":
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return replyInteger(client.redir())
+	case "TRACKINGINFO":
+		return trackingInfo(client)
+	}
+	return replyError(errs.Syntax)
+}
+
+// applyTracking turns tracking on or off for the client.
+func (c *ClientCommand) applyTracking(client *Client) resp.RespValue {
+	tracking := c.registry.tracking
+	if !c.tracking.enabled {
+		tracking.disable(client)
+		return replyOK()
+	}
+	if c.tracking.redirect != 0 {
+		if c.tracking.redirect == client.ID {
+			return replyError(errs.Errorf("A client can only redirect to a different client"))
+		}
+		if _, ok := c.registry.clients.Get(c.tracking.redirect); !ok {
+			return replyError(errs.Errorf("The client ID you want redirect to does not exist"))
+		}
+	}
+	client.mu.Lock()
+	current := client.tracking
+	client.mu.Unlock()
+	if current.enabled {
+		if current.bcast != c.tracking.bcast {
+			return replyError(errs.Errorf("You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode."))
+		}
+		if (current.optIn || current.optOut) != (c.tracking.optIn || c.tracking.optOut) {
+			return replyError(errs.Errorf("You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode."))
+		}
+		if current.bcast {
+			c.tracking.prefixes = append(append([]string(nil), current.prefixes...), c.tracking.prefixes...)
+		}
+	}
+	tracking.enable(client, c.tracking)
+	return replyOK()
+}
+
+// trackingInfo returns the CLIENT TRACKINGINFO reply for the client.
+func trackingInfo(client *Client) resp.RespValue {
+	client.mu.Lock()
+	state := client.tracking
+	redirect := client.redir()
+	client.mu.Unlock()
+
+	var flags []string
+	if !state.enabled {
+		flags = append(flags, "off")
+	} else {
+		flags = append(flags, "on")
+		if state.bcast {
+			flags = append(flags, "bcast")
+		}
+		if state.optIn {
+			flags = append(flags, "optin")
+			if state.cachingSet && state.caching {
+				flags = append(flags, "caching-yes")
+			}
+		}
+		if state.optOut {
+			flags = append(flags, "optout")
+			if state.cachingSet && !state.caching {
+				flags = append(flags, "caching-no")
+			}
+		}
+		if state.noLoop {
+			flags = append(flags, "noloop")
+		}
+	}
+	return resp.NewArray([]resp.RespValue{
+		resp.NewBulk("flags"), statusArray(flags),
+		resp.NewBulk("redirect"), replyInteger(redirect),
+		resp.NewBulk("prefixes"), replyBulkArray(state.prefixes),
+	})
+}
+
+// HelloCommand implements the HELLO command.
+type HelloCommand struct {
+	registry *CommandRegistry
+	protocol int    // Zero to keep the current version
+	name     string // Set with SETNAME
+	setName  bool
+	user     string // Authenticated as with AUTH
+	password string
+	auth     bool
+}
+
+// newHelloCommand creates a new HelloCommand bound to the registry, from
+// the arguments [protover [AUTH username password] [SETNAME clientname]].
+func (cr *CommandRegistry) newHelloCommand(args []resp.RespValue) (Command, error) {
+	c := &HelloCommand{registry: cr}
+	if len(args) == 0 {
+		return c, nil
+	}
+	protocol, err := strconv.ParseInt(args[0].Str, 10, 64)
+	if err != nil {
+		return nil, errs.Errorf("Protocol version is not an integer or out of range")
+	}
+	if protocol < 2 || protocol > 3 {
+		return nil, errs.New("NOPROTO", "unsupported protocol version")
+	}
+	c.protocol = int(protocol)
+
+	for i := 1; i < len(args); i++ {
+		more := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i].Str); {
+		case opt == "AUTH" && more >= 2:
+			c.user, c.password, c.auth = args[i+1].Str, args[i+2].Str, true
+			i += 2
+		case opt == "SETNAME" && more >= 1:
+			if err := checkClientName(args[i+1].Str); err != nil {
+				return nil, err
+			}
+			c.name, c.setName = args[i+1].Str, true
+			i++
+		default:
+			return nil, errs.Errorf("Syntax error in HELLO option '%s'", args[i].Str)
+		}
+	}
+	return c, nil
+}
+
+// Apply is never called for HELLO, which needs the calling client.
+func (c *HelloCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("HELLO"))
+}
+
+// ApplyClient executes the HELLO command, authenticating the client if
+// asked to and switching it to the requested protocol version, and replies
+// with the server properties.
+func (c *HelloCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	if c.auth {
+		if err := c.registry.authenticate(client, c.user, c.password); err != nil {
+			return replyError(err)
+		}
+	} else if !client.Authenticated() {
+		return replyError(errs.New("NOAUTH", "HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"))
+	}
+	client.mu.Lock()
+	if c.protocol != 0 {
+		client.protocol = c.protocol
+	}
+	if c.setName {
+		client.name = c.name
+	}
+	protocol := client.protocol
+	client.mu.Unlock()
+	return resp.NewMap([]resp.RespValue{
+		resp.NewBulk("server"), resp.NewBulk("redis"),
+		resp.NewBulk("version"), resp.NewBulk(ServerVersion),
+		resp.NewBulk("proto"), resp.NewInteger(int64(protocol)),
+		resp.NewBulk("id"), resp.NewInteger(client.ID),
+		resp.NewBulk("mode"), resp.NewBulk("standalone"),
+		resp.NewBulk("role"), resp.NewBulk("master"),
+		resp.NewBulk("modules"), resp.NewArray([]resp.RespValue{}),
+	})
+}
+
+// SelectCommand implements the SELECT command. The server has a single
+// database, db0, the only one that can be selected.
+type SelectCommand struct{}
+
+// newSelectCommand creates a new SELECT command, checking the database
+// index as Redis does.
+func (cr *CommandRegistry) newSelectCommand(args []resp.RespValue) (Command, error) {
+	index, err := strconv.ParseInt(args[0].Str, 10, 32)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	if index != 0 {
+		if cr.clusterEnabled {
+			return nil, errs.Errorf("SELECT is not allowed in cluster mode")
+		}
+		return nil, errs.Errorf("DB index is out of range")
+	}
+	return &SelectCommand{}, nil
+}
+
+// Apply executes the SELECT command.
+func (c *SelectCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyOK()
+}
+
+// ApplyClient executes the SELECT command for the calling client.
+func (c *SelectCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	client.mu.Lock()
+	client.db = 0
+	client.mu.Unlock()
+	return replyOK()
+}
+
+// QuitCommand implements the QUIT command.
+type QuitCommand struct{}
+
+// NewQuitCommand creates a new QuitCommand.
+func NewQuitCommand(args []resp.RespValue) (Command, error) {
+	return &QuitCommand{}, nil
+}
+
+// Apply executes the QUIT command.
+func (c *QuitCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyOK()
+}
+
+// ApplyClient executes the QUIT command, closing the connection after the
+// reply.
+func (c *QuitCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	client.Close()
+	return replyOK()
+}
+
+// ResetCommand implements the RESET command.
+type ResetCommand struct {
+	registry *CommandRegistry
+}
+
+// newResetCommand creates a new ResetCommand bound to the registry.
+func (cr *CommandRegistry) newResetCommand(args []resp.RespValue) (Command, error) {
+	return &ResetCommand{registry: cr}, nil
+}
+
+// Apply is never called for RESET, which needs the calling client.
+func (c *ResetCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("RESET"))
+}
+
+// ApplyClient executes the RESET command, returning the connection to its
+// initial state: no subscriptions, no tracking, RESP2, db0, replies on,
+// default flags and authenticated as the default user if it needs no
+// password.
+func (c *ResetCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	c.registry.pubsub.Disconnect(client)
+	c.registry.tracking.disable(client)
+	c.registry.AuthenticateDefault(client)
+	client.mu.Lock()
+	client.protocol = 2
+	client.noEvict = false
+	client.noTouch = false
+	client.db = 0
+	client.repliesOff = false
+	client.skipReplies = 0
+	client.mu.Unlock()
+	return resp.NewString("RESET")
+}
@@ -0,0 +1,37 @@
+package command_test
+
+import (
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/internal/servertest"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// TestClientNoTouch checks that the reads and writes of a client in CLIENT
+// NO-TOUCH mode leave the idle time of keys as it is, and that those of
+// other clients reset it.
+func TestClientNoTouch(t *testing.T) {
+	srv := servertest.Start(t)
+	quiet, other := srv.Client(), srv.Client()
+	srv.Exec(nil, "SET", "string", "v")
+	srv.Exec(nil, "SADD", "set", "a")
+	for _, key := range []string{"string", "set"} {
+		dump := srv.Exec(nil, "DUMP", key)
+		expectReply(t, "restore "+key, srv.Exec(nil, "RESTORE", key, "0", dump.Str, "REPLACE", "IDLETIME", "100"), resp.NewString("OK"))
+	}
+
+	expectReply(t, "no-touch", srv.Exec(quiet, "CLIENT", "NO-TOUCH", "ON"), resp.NewString("OK"))
+	srv.Exec(quiet, "GET", "string")
+	srv.Exec(quiet, "SADD", "set", "b")
+	for _, key := range []string{"string", "set"} {
+		if idle := srv.Exec(nil, "OBJECT", "IDLETIME", key); idle.Type != resp.Integer || idle.Num < 100 {
+			t.Errorf("%s: idle time after a no-touch access: got %+v, want at least 100", key, idle)
+		}
+	}
+
+	srv.Exec(other, "GET", "string")
+	srv.Exec(other, "SMEMBERS", "set")
+	for _, key := range []string{"string", "set"} {
+		expectReply(t, key+": idle time after an access", srv.Exec(nil, "OBJECT", "IDLETIME", key), resp.NewInteger(0))
+	}
+}
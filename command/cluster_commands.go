@@ -0,0 +1,102 @@
+package command
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/keyslot"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerClusterCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "CLUSTER", MinArgs: 1, MaxArgs: -1, Flags: FlagLoading | FlagStale, Subcommands: cr.clusterSubcommands()},
+	})
+}
+
+// clusterSubcommands returns the subcommands of CLUSTER.
+func (cr *CommandRegistry) clusterSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "COUNTKEYSINSLOT", MinArgs: 1, MaxArgs: 1, New: cr.newClusterCountKeysInSlotCommand, Usage: "<slot>", Help: []string{
+			"Return the number of keys in <slot>.",
+		}},
+		{Name: "GETKEYSINSLOT", MinArgs: 2, MaxArgs: 2, New: cr.newClusterGetKeysInSlotCommand, Usage: "<slot> <count>", Help: []string{
+			"Return key names stored by current node in a slot.",
+		}},
+		{Name: "KEYSLOT", MinArgs: 1, MaxArgs: 1, New: newClusterKeySlotCommand, Usage: "<key>", Help: []string{
+			"Return the hash slot for <key>.",
+		}},
+	}
+}
+
+// SetClusterEnabled sets whether the server runs in cluster mode, in which
+// the keys of a command must all belong to the same hash slot. The server
+// holds every slot itself.
+func (cr *CommandRegistry) SetClusterEnabled(enabled bool) {
+	cr.clusterEnabled = enabled
+}
+
+// ClusterCommand implements the CLUSTER command. KEYSLOT is supported in
+// cluster mode or not, so clients can compute the slots of their keys;
+// COUNTKEYSINSLOT and GETKEYSINSLOT, used to move the keys of a slot to
+// another node, require cluster mode.
+type ClusterCommand struct {
+	subcommand string
+	key        string // KEYSLOT
+	slot       int    // COUNTKEYSINSLOT, GETKEYSINSLOT
+	count      int    // GETKEYSINSLOT
+}
+
+// newClusterKeySlotCommand creates a new CLUSTER KEYSLOT command.
+func newClusterKeySlotCommand(args []resp.RespValue) (Command, error) {
+	return &ClusterCommand{subcommand: "KEYSLOT", key: args[0].Str}, nil
+}
+
+// newClusterCountKeysInSlotCommand creates a new CLUSTER COUNTKEYSINSLOT
+// command, provided the server runs in cluster mode.
+func (cr *CommandRegistry) newClusterCountKeysInSlotCommand(args []resp.RespValue) (Command, error) {
+	if !cr.clusterEnabled {
+		return nil, errs.Errorf("This instance has cluster support disabled")
+	}
+	slot, err := strconv.ParseInt(args[0].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	if slot < 0 || slot >= keyslot.Count {
+		return nil, errs.Errorf("Invalid slot")
+	}
+	return &ClusterCommand{subcommand: "COUNTKEYSINSLOT", slot: int(slot)}, nil
+}
+
+// newClusterGetKeysInSlotCommand creates a new CLUSTER GETKEYSINSLOT
+// command, provided the server runs in cluster mode.
+func (cr *CommandRegistry) newClusterGetKeysInSlotCommand(args []resp.RespValue) (Command, error) {
+	if !cr.clusterEnabled {
+		return nil, errs.Errorf("This instance has cluster support disabled")
+	}
+	slot, err := strconv.ParseInt(args[0].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	count, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	if slot < 0 || slot >= keyslot.Count || count < 0 {
+		return nil, errs.Errorf("Invalid slot or number of keys")
+	}
+	return &ClusterCommand{subcommand: "GETKEYSINSLOT", slot: int(slot), count: int(min(count, math.MaxInt32))}, nil
+}
+
+// Apply executes the CLUSTER command.
+func (c *ClusterCommand) Apply(s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "COUNTKEYSINSLOT":
+		return replyInteger(int64(s.CountKeysInSlot(c.slot)))
+	case "GETKEYSINSLOT":
+		return replyBulkArray(s.KeysInSlot(c.slot, c.count))
+	}
+	return replyInteger(int64(keyslot.Of(c.key)))
+}
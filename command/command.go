@@ -1,10 +1,19 @@
 package command
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/persistence"
 	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/scripting"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
@@ -15,38 +24,422 @@ type Command interface {
 
 // CommandRegistry holds the mapping of command names to their implementations.
 type CommandRegistry struct {
-	commands map[string]func(args []resp.RespValue) (Command, error)
+	commands     map[string]*CommandSpec
+	renames      map[string]string // Name used by clients to registered name, "" if disabled
+	stats        *CommandStats
+	clients      *ClientList
+	tracking     *TrackingTable
+	pubsub       *PubSub
+	blocking     *BlockingTable
+	acl          *aclTable
+	snapshotter  *persistence.Snapshotter
+	aof          *persistence.AOF
+	aofRewrite   aofRewriteConfig
+	scripts      *scripting.Engine
+	infoSections []infoSection
+	execMu       sync.RWMutex // Held exclusively by commands that run alone, such as scripts
+	writeMu      sync.Mutex   // Serializes write commands while the append only file is enabled
+
+	script             atomic.Pointer[runningScript] // Script or function being run, if any
+	busyReplyThreshold time.Duration                 // See SetBusyReplyThreshold
+	earlyExpireWindow  time.Duration                 // See SetEarlyExpireWindow
+
+	clusterEnabled bool // See SetClusterEnabled
+
+	shutdown shutdownState // See Shutdown
+	pause    pauseState    // See Pause
+
+	replID  string    // Replication ID reported by INFO replication
+	runID   string    // ID of this run of the server, reported by INFO server
+	started time.Time // Start time, for the uptime reported by INFO server
+	tcpPort int       // See SetTCPPort
+}
+
+// exclusiveCommand is implemented by commands that no other command may run
+// concurrently with, such as scripts, which execute atomically.
+type exclusiveCommand interface {
+	exclusive()
 }
 
 // NewCommandRegistry creates a new CommandRegistry.
 func NewCommandRegistry() *CommandRegistry {
 	cr := &CommandRegistry{
-		commands: make(map[string]func(args []resp.RespValue) (Command, error)),
+		commands: make(map[string]*CommandSpec),
+		renames:  make(map[string]string),
+		stats:    newCommandStats(),
+		clients:  newClientList(),
+		pubsub:   newPubSub(),
+		acl:      newACLTable(),
+		scripts:  scripting.NewEngine(),
+
+		busyReplyThreshold: defaultBusyReplyThreshold,
+		shutdown:           shutdownState{timeout: defaultShutdownTimeout},
+		replID:             randomID(),
+		runID:              randomID(),
+		started:            time.Now(),
 	}
+	cr.tracking = newTrackingTable(cr.clients)
+	cr.blocking = newBlockingTable()
 	registerStringCommands(cr)
+	registerExpireCommands(cr)
 	registerListCommands(cr)
 	registerHashCommands(cr)
 	registerSetCommands(cr)
 	registerSortedSetCommands(cr)
+	registerStreamCommands(cr)
+	registerHyperLogLogCommands(cr)
+	registerGeoCommands(cr)
+	registerServerCommands(cr)
+	registerClientCommands(cr)
+	registerPubSubCommands(cr)
+	registerScriptCommands(cr)
+	registerFunctionCommands(cr)
+	registerClusterCommands(cr)
+	cr.registerAliases()
+	cr.registerInfoSections()
 	return cr
 }
 
-// register registers a new command.
-func (cr *CommandRegistry) register(name string, constructor func(args []resp.RespValue) (Command, error)) {
-	cr.commands[strings.ToUpper(name)] = constructor
+// register registers the commands described by specs.
+func (cr *CommandRegistry) register(specs []CommandSpec) {
+	for i := range specs {
+		spec := specs[i]
+		spec.Name = upperName(spec.Name)
+		checkClassified(&spec)
+		spec.initSubcommands()
+		cr.commands[spec.Name] = &spec
+	}
+}
+
+// checkClassified panics if spec does not say whether the command reads or
+// writes the dataset, which CLIENT PAUSE WRITE and the ACL categories rely
+// on: a command taking keys is a write, read-only, may-replicate or pubsub
+// command, and no command is both a write and a read-only one.
+func checkClassified(spec *CommandSpec) {
+	if spec.HasFlag(FlagWrite) && spec.HasFlag(FlagReadOnly) {
+		panic("command: " + spec.FullName() + " is both a write and a read-only command")
+	}
+	takesKeys := spec.FirstKey > 0 || spec.KeysFunc != nil
+	if takesKeys && !spec.HasFlag(FlagWrite|FlagReadOnly|FlagMayReplicate|FlagPubSub) {
+		panic("command: " + spec.FullName() + " takes keys but is not classified as a write or read-only command")
+	}
+}
+
+// Stats returns the per-command statistics.
+func (cr *CommandRegistry) Stats() *CommandStats {
+	return cr.stats
+}
+
+// Clients returns the list of connected clients.
+func (cr *CommandRegistry) Clients() *ClientList {
+	return cr.clients
+}
+
+// Tracking returns the client-side caching tracking table.
+func (cr *CommandRegistry) Tracking() *TrackingTable {
+	return cr.tracking
+}
+
+// Blocking returns the table of the clients blocked by commands such as
+// BLPOP.
+func (cr *CommandRegistry) Blocking() *BlockingTable {
+	return cr.blocking
+}
+
+// PubSub returns the pub/sub channel subscriptions.
+func (cr *CommandRegistry) PubSub() *PubSub {
+	return cr.pubsub
+}
+
+// Snapshotter returns the snapshotter, nil if persistence is not
+// configured.
+func (cr *CommandRegistry) Snapshotter() *persistence.Snapshotter {
+	return cr.snapshotter
+}
+
+// SetSnapshotter sets the snapshotter used by SAVE and DEBUG RELOAD.
+func (cr *CommandRegistry) SetSnapshotter(p *persistence.Snapshotter) {
+	cr.snapshotter = p
+}
+
+// Execute runs cmd, parsed from the request argv, on behalf of client.
+// Commands run concurrently with each other, except exclusive commands,
+// which run alone. While a script runs, commands wait for it to return, or
+// are answered with -BUSY once it ran for too long; only the commands
+// killing it run alongside. Write commands are appended to the append only
+// file, if enabled. Commands of clients held back by CLIENT PAUSE wait for
+// the pause to end first. Blocking commands, such as BLPOP, wait for one of
+// their keys to serve them, see BlockingTable.
+func (cr *CommandRegistry) Execute(client *Client, argv []resp.RespValue, cmd Command, s *storage.Storage) resp.RespValue {
+	if spec, ok := cr.LookupArgv(argv); ok && client != nil {
+		cr.waitPause(spec)
+	}
+	// The commands of a client in CLIENT NO-TOUCH mode run on a view of
+	// the storage leaving the access times of keys as they are.
+	view := s
+	if client != nil && client.NoTouch() {
+		view = s.WithoutTouch()
+	}
+	if bc, ok := cmd.(busyCommand); ok && bc.allowBusy() {
+		return apply(client, cmd, view)
+	}
+	if err := cr.waitScript(); err != nil {
+		return replyError(err)
+	}
+	bc, blocking := cmd.(blockingCommand)
+	if !blocking || client == nil {
+		return cr.execute(argv, cmd, s, func() resp.RespValue { return apply(client, cmd, view) })
+	}
+	// The clients served along with this one are propagated as they are,
+	// this one with the result.
+	var w *waiter
+	result := cr.execute(argv, cmd, s, func() resp.RespValue {
+		var result resp.RespValue
+		result, w = cr.blocking.block(client, bc, view, func(served blockingCommand, result resp.RespValue) {
+			if served != bc {
+				cr.propagateServed(served, result)
+			}
+		})
+		return result
+	})
+	if w == nil {
+		return result
+	}
+	// The client waits without holding the locks, so other commands can
+	// serve it.
+	return cr.blocking.wait(w)
+}
+
+// execute runs cmd, invoked as argv, through run holding the locks it
+// needs, then appends it to the append only file and serves the clients
+// blocked on the keys it wrote.
+func (cr *CommandRegistry) execute(argv []resp.RespValue, cmd Command, s *storage.Storage, run func() resp.RespValue) resp.RespValue {
+	if _, ok := cmd.(exclusiveCommand); ok {
+		cr.execMu.Lock()
+		defer cr.execMu.Unlock()
+	} else {
+		cr.execMu.RLock()
+		defer cr.execMu.RUnlock()
+	}
+	spec, ok := cr.LookupArgv(argv)
+	if !ok || !spec.MayWrite() {
+		return run()
+	}
+	if cr.aof == nil || !spec.HasFlag(FlagWrite) {
+		result := run()
+		cr.serveBlocked(argv, result, s)
+		return result
+	}
+	// Write commands must reach the file in the order they were applied.
+	cr.writeMu.Lock()
+	defer cr.writeMu.Unlock()
+	result := run()
+	cr.propagate(spec, bulkStrings(argv), cmd, result)
+	cr.serveBlocked(argv, result, s)
+	return result
+}
+
+// LookupArgv returns the spec of the command invoked by argv: that of the
+// subcommand named by its second element for a container command, or of
+// the container itself if it names none.
+func (cr *CommandRegistry) LookupArgv(argv []resp.RespValue) (*CommandSpec, bool) {
+	if len(argv) == 0 {
+		return nil, false
+	}
+	spec, ok := cr.Lookup(argv[0].Str)
+	if !ok || len(argv) < 2 {
+		return spec, ok
+	}
+	if sub, ok := spec.Subcommand(argv[1].Str); ok {
+		return sub, true
+	}
+	return spec, true
+}
+
+// apply runs cmd on behalf of client, which client-aware commands need.
+// Without a client, as for internal health checks, cmd runs through Apply.
+func apply(client *Client, cmd Command, s *storage.Storage) resp.RespValue {
+	if cc, ok := cmd.(ClientAwareCommand); ok && client != nil {
+		return cc.ApplyClient(client, s)
+	}
+	return cmd.Apply(s)
+}
+
+// ActiveExpireCycle deletes expired keys nobody accessed. It does not run
+// while a script does, so keys do not vanish in the middle of a script, nor
+// while CLIENT PAUSE holds back writes.
+func (cr *CommandRegistry) ActiveExpireCycle(s *storage.Storage) int {
+	if cr.writesPaused() {
+		return 0
+	}
+	cr.execMu.RLock()
+	defer cr.execMu.RUnlock()
+	return s.ActiveExpireCycle()
+}
+
+// Defrag rebuilds the containers that shrank far below their peak length,
+// see storage.Storage.Defrag. Commands modify containers in place, so it
+// runs alone, like an exclusive command.
+func (cr *CommandRegistry) Defrag(s *storage.Storage) int {
+	if !s.DefragStats().Enabled {
+		return 0
+	}
+	cr.execMu.Lock()
+	defer cr.execMu.Unlock()
+	return s.Defrag()
+}
+
+// SaveIfDue starts a background save if a save point of the snapshotter
+// was reached. Like BGSAVE, it waits until no command runs, so the
+// snapshot starts while no write is in progress.
+func (cr *CommandRegistry) SaveIfDue(s *storage.Storage) {
+	if cr.snapshotter == nil {
+		return
+	}
+	sp, ok := cr.snapshotter.DueSavePoint(s.Dirty())
+	if !ok {
+		return
+	}
+	cr.execMu.Lock()
+	defer cr.execMu.Unlock()
+	log.Printf("%d changes in %d seconds. Saving...", sp.Changes, sp.Seconds)
+	if err := cr.snapshotter.BackgroundSave(s); err != nil {
+		log.Printf("Background saving error: %v", err)
+	}
+}
+
+// Register adds a command defined outside the registry, such as one of a
+// program embedding the server, to those clients can invoke. It must be
+// called before the server starts serving. Its Command may reply with
+// values encoded beforehand, see resp.NewRaw, and, if it implements
+// ClientAwareCommand, send push frames with Client.Push.
+func (cr *CommandRegistry) Register(spec CommandSpec) error {
+	name := upperName(spec.Name)
+	if name == "" {
+		return errs.Errorf("command name is empty")
+	}
+	if spec.New == nil && len(spec.Subcommands) == 0 {
+		return errs.Errorf("command '%s' has no constructor", name)
+	}
+	if _, ok := cr.commands[name]; ok {
+		return errs.Errorf("command '%s' already exists", name)
+	}
+	if _, ok := cr.renames[name]; ok {
+		return errs.Errorf("command '%s' already exists", name)
+	}
+	cr.register([]CommandSpec{spec})
+	return nil
+}
+
+// Rename makes the command available under newName instead of its
+// registered name. An empty newName disables the command.
+func (cr *CommandRegistry) Rename(name, newName string) error {
+	name = upperName(name)
+	newName = upperName(newName)
+	if _, ok := cr.commands[name]; !ok {
+		return errs.Errorf("no such command '%s' in rename-command", name)
+	}
+	if newName != "" {
+		if _, ok := cr.Lookup(newName); ok {
+			return errs.Errorf("target command name '%s' already exists", newName)
+		}
+		cr.renames[newName] = name
+	}
+	cr.renames[name] = ""
+	return nil
+}
+
+// Lookup returns the spec of the command clients invoke as name, taking
+// renamed and disabled commands into account.
+func (cr *CommandRegistry) Lookup(name string) (*CommandSpec, bool) {
+	name = upperName(name)
+	if target, ok := cr.renames[name]; ok {
+		if target == "" {
+			return nil, false
+		}
+		name = target
+	}
+	spec, ok := cr.commands[name]
+	return spec, ok
+}
+
+// lookupFullName returns the spec of the command or subcommand named name,
+// as COMMAND INFO reports them, such as GET or CLIENT|ID.
+func (cr *CommandRegistry) lookupFullName(name string) (*CommandSpec, bool) {
+	name, subcommand, isSubcommand := strings.Cut(name, "|")
+	spec, ok := cr.Lookup(name)
+	if !ok || !isSubcommand {
+		return spec, ok
+	}
+	return spec.Subcommand(subcommand)
+}
+
+// Specs returns the specs of all registered commands, sorted by name.
+func (cr *CommandRegistry) Specs() []*CommandSpec {
+	specs := make([]*CommandSpec, 0, len(cr.commands))
+	for _, spec := range cr.commands {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+	return specs
+}
+
+// GetKeys returns the keys that the invocation argv, whose first element is
+// the command name, would touch.
+func (cr *CommandRegistry) GetKeys(argv []resp.RespValue) ([]string, error) {
+	if len(argv) == 0 {
+		return nil, errs.Errorf("Invalid command specified")
+	}
+	spec, ok := cr.Lookup(argv[0].Str)
+	if !ok {
+		return nil, errs.Errorf("Invalid command specified")
+	}
+	spec, _, err := spec.dispatch(argv[1:])
+	if err != nil {
+		return nil, errs.Errorf("Invalid number of arguments specified for command")
+	}
+
+	var positions []int
+	if spec.KeysFunc != nil {
+		positions = spec.KeysFunc(argv)
+	} else {
+		positions = spec.KeyPositions(len(argv))
+	}
+	keys := make([]string, len(positions))
+	for i, pos := range positions {
+		keys[i] = argv[pos].Str
+	}
+	return keys, nil
 }
 
 // ParseCommand parses a RESP array into a Command.
 func (cr *CommandRegistry) ParseCommand(respValue resp.RespValue) (Command, error) {
 	if respValue.Type != resp.Array || len(respValue.Array) == 0 {
-		return nil, resp.NewError("ERR invalid command format")
+		return nil, errs.Errorf("invalid command format")
 	}
 
-	cmdName := strings.ToUpper(respValue.Array[0].Str)
-	constructor, ok := cr.commands[cmdName]
+	name, err := commandName(respValue.Array)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := cr.Lookup(name)
 	if !ok {
-		return nil, resp.NewError(fmt.Sprintf("ERR unknown command '%s'", cmdName))
+		args := make([]string, len(respValue.Array)-1)
+		for i, arg := range respValue.Array[1:] {
+			args[i] = arg.Str
+		}
+		return nil, errs.UnknownCommand(name, args)
 	}
 
-	return constructor(respValue.Array[1:])
-}
\ No newline at end of file
+	return spec.parse(respValue.Array[1:])
+}
+
+// randomID returns a random run or replication ID: 40 hex characters, as
+// Redis generates them at startup.
+func randomID() string {
+	var b [20]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,62 @@
+package command_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/internal/servertest"
+)
+
+// TestConcurrentWrites runs the writes of each type from several clients
+// at once, along with reads of the same keys, and checks that no update is
+// lost. Run with -race, it also checks that reads never see a container
+// being modified.
+func TestConcurrentWrites(t *testing.T) {
+	const clients, writes = 8, 200
+	for _, tc := range []struct {
+		name  string
+		write func(client, i int) []string
+		read  []string
+		check []string
+		want  int64
+	}{
+		{"INCR", func(int, int) []string { return []string{"INCR", "k"} }, []string{"GET", "k"}, []string{"GET", "k"}, clients * writes},
+		{"APPEND", func(int, int) []string { return []string{"APPEND", "k", "x"} }, []string{"STRLEN", "k"}, []string{"STRLEN", "k"}, clients * writes},
+		{"SADD", func(c, i int) []string { return []string{"SADD", "k", fmt.Sprintf("%d-%d", c, i)} }, []string{"SMEMBERS", "k"}, []string{"SCARD", "k"}, clients * writes},
+		{"RPUSH", func(c, i int) []string { return []string{"RPUSH", "k", strconv.Itoa(i)} }, []string{"LRANGE", "k", "0", "-1"}, []string{"LLEN", "k"}, clients * writes},
+		{"ZADD", func(c, i int) []string { return []string{"ZADD", "k", strconv.Itoa(i), fmt.Sprintf("%d-%d", c, i)} }, []string{"ZRANGE", "k", "0", "-1"}, []string{"ZCARD", "k"}, clients * writes},
+		{"ZINCRBY", func(int, int) []string { return []string{"ZINCRBY", "k", "1", "m"} }, []string{"ZRANGE", "k", "0", "-1", "WITHSCORES"}, []string{"ZSCORE", "k", "m"}, clients * writes},
+		{"HSET", func(c, i int) []string { return []string{"HSET", "k", fmt.Sprintf("%d-%d", c, i), "v"} }, []string{"HGETALL", "k"}, []string{"HLEN", "k"}, clients * writes},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := servertest.Start(t)
+			var wg sync.WaitGroup
+			for c := 0; c < clients; c++ {
+				wg.Add(2)
+				go func(c int) {
+					defer wg.Done()
+					for i := 0; i < writes; i++ {
+						srv.Exec(nil, tc.write(c, i)...)
+					}
+				}(c)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < writes/10; i++ {
+						srv.Exec(nil, tc.read...)
+					}
+				}()
+			}
+			wg.Wait()
+			got := srv.Exec(nil, tc.check...)
+			n := got.Num
+			if got.Str != "" {
+				n, _ = strconv.ParseInt(got.Str, 10, 64)
+			}
+			if n != tc.want {
+				t.Errorf("%s got %+v, want %d", tc.check, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// initSubcommands completes the subcommands of a container command once it
+// is registered: their names are upper-cased, they are linked to spec, they
+// inherit its flags and categories unless they declare some, and HELP is
+// added last.
+func (spec *CommandSpec) initSubcommands() {
+	if len(spec.Subcommands) == 0 {
+		return
+	}
+	subs := make([]CommandSpec, 0, len(spec.Subcommands)+1)
+	subs = append(subs, spec.Subcommands...)
+	subs = append(subs, helpSubcommand(spec))
+	for i := range subs {
+		sub := &subs[i]
+		sub.Name = upperName(sub.Name)
+		sub.container = spec
+		if sub.Flags == 0 {
+			sub.Flags = spec.Flags
+		}
+		if sub.Categories == nil {
+			sub.Categories = spec.Categories
+		}
+		checkClassified(sub)
+	}
+	spec.Subcommands = subs
+}
+
+// helpSubcommand returns the spec of the HELP subcommand of container.
+func helpSubcommand(container *CommandSpec) CommandSpec {
+	return CommandSpec{
+		Name: "HELP", MinArgs: 0, MaxArgs: 0, Flags: FlagLoading | FlagStale,
+		Help: []string{"Print this help."},
+		New: func(args []resp.RespValue) (Command, error) {
+			return &HelpCommand{lines: container.HelpLines()}, nil
+		},
+	}
+}
+
+// Subcommand returns the spec of the subcommand of a container command
+// named name, HELP included.
+func (spec *CommandSpec) Subcommand(name string) (*CommandSpec, bool) {
+	for i := range spec.Subcommands {
+		if equalName(spec.Subcommands[i].Name, name) {
+			return &spec.Subcommands[i], true
+		}
+	}
+	return nil, false
+}
+
+// dispatch returns the spec invoked by the arguments args of spec, and the
+// arguments to build it from: for a container command, those following the
+// name of the subcommand they invoke. The arguments are checked against the
+// spec found.
+func (spec *CommandSpec) dispatch(args []resp.RespValue) (*CommandSpec, []resp.RespValue, error) {
+	if err := spec.validate(args); err != nil {
+		return nil, nil, err
+	}
+	if len(spec.Subcommands) == 0 || len(args) == 0 {
+		return spec, args, nil
+	}
+	sub, ok := spec.Subcommand(args[0].Str)
+	if !ok {
+		return nil, nil, errs.UnknownSubcommand(spec.Name, args[0].Str)
+	}
+	if err := sub.validate(args[1:]); err != nil {
+		return nil, nil, err
+	}
+	return sub, args[1:], nil
+}
+
+// parse builds the command invoked by the arguments args of spec.
+func (spec *CommandSpec) parse(args []resp.RespValue) (Command, error) {
+	spec, args, err := spec.dispatch(args)
+	if err != nil {
+		return nil, err
+	}
+	return spec.New(args)
+}
+
+// HelpLines returns the lines of the reply to HELP, in the layout of Redis:
+// a header, then each subcommand with its arguments followed by its
+// description, indented, HELP itself last.
+func (spec *CommandSpec) HelpLines() []string {
+	lines := []string{spec.Name + " <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"}
+	for _, sub := range spec.Subcommands {
+		lines = append(lines, strings.TrimSpace(sub.Name+" "+sub.Usage))
+		for _, line := range sub.Help {
+			lines = append(lines, "    "+line)
+		}
+	}
+	return lines
+}
+
+// HelpCommand implements the HELP subcommand of the container commands.
+type HelpCommand struct {
+	lines []string
+}
+
+// Apply executes the HELP subcommand, replying with its lines as simple
+// strings.
+func (c *HelpCommand) Apply(s *storage.Storage) resp.RespValue {
+	return statusArray(c.lines)
+}
@@ -0,0 +1,181 @@
+package command
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerExpireCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "EXPIRE", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: expireConstructor("EX")},
+		{Name: "PEXPIRE", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: expireConstructor("PX")},
+		{Name: "EXPIREAT", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: expireConstructor("EXAT")},
+		{Name: "PEXPIREAT", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: expireConstructor("PXAT")},
+		{Name: "TTL", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: ttlConstructor(time.Second, false)},
+		{Name: "PTTL", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: ttlConstructor(time.Millisecond, false)},
+		{Name: "EXPIRETIME", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: ttlConstructor(time.Second, true)},
+		{Name: "PEXPIRETIME", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: ttlConstructor(time.Millisecond, true)},
+		{Name: "PERSIST", MinArgs: 1, MaxArgs: 1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: NewPersistCommand},
+	})
+}
+
+// expireArg is an expire time given to SET or the EXPIRE family, either
+// relative to the time the command runs or absolute.
+type expireArg struct {
+	ms       int64 // Milliseconds from now, or since the Unix epoch
+	absolute bool
+}
+
+// parseExpireArg parses the value of the EX, PX, EXAT or PXAT option of
+// the named command.
+func parseExpireArg(unit, arg, cmdName string) (expireArg, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return expireArg{}, errs.NotInteger
+	}
+	invalid := errs.Errorf("invalid expire time in '%s' command", cmdName)
+	if (cmdName == "set" || cmdName == "getex") && n <= 0 {
+		return expireArg{}, invalid
+	}
+	e := expireArg{ms: n, absolute: unit == "EXAT" || unit == "PXAT"}
+	if unit == "EX" || unit == "EXAT" {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return expireArg{}, invalid
+		}
+		e.ms = n * 1000
+	}
+	if !e.absolute && e.ms > math.MaxInt64-time.Now().UnixMilli() {
+		return expireArg{}, invalid
+	}
+	return e, nil
+}
+
+// at returns the expire time for a command running at now. The offset is
+// added in milliseconds, as a time.Duration only spans 292 years.
+func (e expireArg) at(now time.Time) time.Time {
+	if e.absolute {
+		return time.UnixMilli(e.ms)
+	}
+	return time.UnixMilli(addMs(now.UnixMilli(), e.ms))
+}
+
+// addMs returns the Unix milliseconds ms after now, clamped to the range
+// of an int64 rather than wrapping.
+func addMs(now, ms int64) int64 {
+	switch {
+	case ms > 0 && now > math.MaxInt64-ms:
+		return math.MaxInt64
+	case ms < 0 && now < math.MinInt64-ms:
+		return math.MinInt64
+	}
+	return now + ms
+}
+
+// ExpireCommand implements the EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT
+// commands.
+type ExpireCommand struct {
+	key    string
+	expire expireArg
+	cond   storage.ExpireCondition // The options given, checked by Apply
+	at     time.Time               // Expire time set by Apply, which propagate logs
+}
+
+// expireConstructor returns the constructor of ExpireCommand for an expire
+// time given with the SET option unit.
+func expireConstructor(unit string) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		cmdName := map[string]string{"EX": "expire", "PX": "pexpire", "EXAT": "expireat", "PXAT": "pexpireat"}[unit]
+		expire, err := parseExpireArg(unit, args[1].Str, cmdName)
+		if err != nil {
+			return nil, err
+		}
+		c := &ExpireCommand{key: args[0].Str, expire: expire}
+		for _, arg := range args[2:] {
+			switch strings.ToUpper(arg.Str) {
+			case "NX":
+				c.cond |= storage.ExpireNX
+			case "XX":
+				c.cond |= storage.ExpireXX
+			case "GT":
+				c.cond |= storage.ExpireGT
+			case "LT":
+				c.cond |= storage.ExpireLT
+			default:
+				return nil, errs.Errorf("Unsupported option %s", arg.Str)
+			}
+		}
+		return c, nil
+	}
+}
+
+// Apply executes the EXPIRE command. NX excludes the other options, and GT
+// excludes LT, while XX combines with either.
+func (c *ExpireCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.cond&storage.ExpireNX != 0 && c.cond != storage.ExpireNX {
+		return replyError(errs.Errorf("NX and XX, GT or LT options at the same time are not compatible"))
+	}
+	if c.cond&storage.ExpireGT != 0 && c.cond&storage.ExpireLT != 0 {
+		return replyError(errs.Errorf("GT and LT options at the same time are not compatible"))
+	}
+	c.at = c.expire.at(time.Now())
+	if s.Expire(c.key, c.at, c.cond) {
+		return replyInteger(1)
+	}
+	return replyInteger(0)
+}
+
+// TTLCommand implements the TTL, PTTL, EXPIRETIME and PEXPIRETIME commands.
+type TTLCommand struct {
+	key      string
+	unit     time.Duration
+	absolute bool // Reply with the expire time rather than the time left
+}
+
+// ttlConstructor returns the constructor of TTLCommand replying in unit.
+func ttlConstructor(unit time.Duration, absolute bool) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &TTLCommand{key: args[0].Str, unit: unit, absolute: absolute}, nil
+	}
+}
+
+// Apply executes the TTL command.
+func (c *TTLCommand) Apply(s *storage.Storage) resp.RespValue {
+	at, volatile, exists := s.ExpireTime(c.key)
+	switch {
+	case !exists:
+		return replyInteger(-2)
+	case !volatile:
+		return replyInteger(-1)
+	case c.absolute:
+		return replyInteger(at.UnixMilli() / c.unit.Milliseconds())
+	}
+	// In milliseconds, as time.Until saturates past 292 years.
+	left := max(at.UnixMilli()-time.Now().UnixMilli(), 0)
+	// Round to the nearest unit, as Redis does for TTL.
+	unit := c.unit.Milliseconds()
+	return replyInteger((min(left, math.MaxInt64-unit/2) + unit/2) / unit)
+}
+
+// PersistCommand implements the PERSIST command.
+type PersistCommand struct {
+	key string
+}
+
+// NewPersistCommand creates a new PersistCommand.
+func NewPersistCommand(args []resp.RespValue) (Command, error) {
+	return &PersistCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the PERSIST command.
+func (c *PersistCommand) Apply(s *storage.Storage) resp.RespValue {
+	if s.Persist(c.key) {
+		return replyInteger(1)
+	}
+	return replyInteger(0)
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// Probabilistic early expiration lets the clients of a cache refresh a hot
+// key before it expires, one at a time, rather than all missing it at once
+// when it does and recomputing it together. GET and GETEX hint a RESP3
+// client at refreshing the value they read, with an early-expire attribute,
+// with a probability rising as the key nears its expire time: exp(-ttl/w)
+// for a window w, as in the XFetch algorithm, where w stands for the time
+// recomputing a value takes times its beta parameter.
+
+// SetEarlyExpireWindow sets the window of probabilistic early expiration,
+// zero disabling the hints.
+func (cr *CommandRegistry) SetEarlyExpireWindow(d time.Duration) {
+	cr.earlyExpireWindow = d
+}
+
+// earlyExpireHint is embedded by the commands reading a key that hint at
+// refreshing it.
+type earlyExpireHint struct {
+	window time.Duration // See SetEarlyExpireWindow
+}
+
+// hint returns reply, the value of key read for client, with the
+// early-expire attribute when the dice say the key should be refreshed.
+func (h earlyExpireHint) hint(client *Client, s *storage.Storage, key string, reply resp.RespValue) resp.RespValue {
+	if h.window <= 0 || reply.Null || reply.Type != resp.Bulk || client.Protocol() < 3 {
+		return reply
+	}
+	at, ok := s.PeekExpireTime(key)
+	if !ok {
+		return reply
+	}
+	ttl := time.Until(at)
+	if rand.Float64() >= math.Exp(-float64(ttl)/float64(h.window)) {
+		return reply
+	}
+	return resp.NewAttribute([]resp.RespValue{resp.NewBulk("early-expire"), replyInteger(ttl.Milliseconds())}, reply)
+}
+
+// newGetCommand creates a GetCommand hinting at early expiration.
+func (cr *CommandRegistry) newGetCommand(args []resp.RespValue) (Command, error) {
+	return &GetCommand{key: args[0].Str, earlyExpireHint: earlyExpireHint{cr.earlyExpireWindow}}, nil
+}
+
+// newGetExCommand creates a GetExCommand hinting at early expiration.
+func (cr *CommandRegistry) newGetExCommand(args []resp.RespValue) (Command, error) {
+	cmd, err := NewGetExCommand(args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.(*GetExCommand).earlyExpireHint = earlyExpireHint{cr.earlyExpireWindow}
+	return cmd, nil
+}
@@ -0,0 +1,295 @@
+package command
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/glob"
+	"github.com/liweiyuan/go-redis-server/internal/rdb"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/scripting"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerFunctionCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "FCALL", MinArgs: 2, MaxArgs: -1, Flags: FlagNoScript | FlagMayReplicate | FlagStale | FlagMovableKeys, Categories: []string{"@scripting"}, KeysFunc: evalKeys, New: cr.fcallConstructor(false)},
+		{Name: "FCALL_RO", MinArgs: 2, MaxArgs: -1, Flags: FlagReadOnly | FlagNoScript | FlagStale | FlagMovableKeys, Categories: []string{"@scripting"}, KeysFunc: evalKeys, New: cr.fcallConstructor(true)},
+		{Name: "FUNCTION", MinArgs: 1, MaxArgs: -1, Flags: FlagNoScript | FlagMayReplicate, Categories: []string{"@scripting"}, Subcommands: cr.functionSubcommands()},
+	})
+}
+
+// functionSubcommands returns the subcommands of FUNCTION. Those that do
+// not change the libraries are not held back by CLIENT PAUSE WRITE.
+func (cr *CommandRegistry) functionSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "LOAD", MinArgs: 1, MaxArgs: 2, New: cr.newFunctionLoadCommand, Usage: "[REPLACE] <FUNCTION CODE>", Help: []string{
+			"Create a new library with the given library name and code.",
+		}},
+		{Name: "DELETE", MinArgs: 1, MaxArgs: 1, New: cr.newFunctionCommand("DELETE"), Usage: "<LIBRARY NAME>", Help: []string{
+			"Delete the given library.",
+		}},
+		{Name: "LIST", MinArgs: 0, MaxArgs: -1, Flags: FlagNoScript, New: cr.newFunctionListCommand, Usage: "[LIBRARYNAME PATTERN] [WITHCODE]", Help: []string{
+			"Return general information on all the libraries:",
+			"* Library name",
+			"* The engine used to run the Library",
+			"* Library description",
+			"* Functions list",
+			"* Library code (if WITHCODE is given)",
+			"It also possible to get only function that matches a pattern using LIBRARYNAME argument.",
+		}},
+		{Name: "DUMP", MinArgs: 0, MaxArgs: 0, Flags: FlagNoScript, New: cr.newFunctionCommand("DUMP"), Help: []string{
+			"Return a serialized payload representing the current libraries, can be restored using FUNCTION RESTORE command",
+		}},
+		{Name: "RESTORE", MinArgs: 1, MaxArgs: 2, New: cr.newFunctionRestoreCommand, Usage: "<PAYLOAD> [FLUSH|APPEND|REPLACE]", Help: []string{
+			"Restore the libraries represented by the given payload, it is possible to give a restore policy to",
+			"control how to handle existing libraries (default APPEND):",
+			"* FLUSH: delete all existing libraries.",
+			"* APPEND: appends the restored libraries to the existing libraries. On collision, abort.",
+			"* REPLACE: appends the restored libraries to the existing libraries, On collision, replace the old",
+			"  libraries with the new libraries.",
+		}},
+		{Name: "KILL", MinArgs: 0, MaxArgs: 0, Flags: FlagNoScript, New: cr.newFunctionCommand("KILL"), Help: []string{
+			"Kill the current running function.",
+		}},
+	}
+}
+
+// syncFunctions loads the function libraries saved with the dataset into
+// the scripting engine, as when they were read from a snapshot. Libraries
+// that fail to load are dropped from the dataset, so they are reported
+// once. It must be called by an exclusive command.
+func (cr *CommandRegistry) syncFunctions(s *storage.Storage) {
+	if err := cr.scripts.SyncLibraries(s.Functions()); err != nil {
+		log.Printf("Failed to load function libraries: %v", err)
+		s.SetFunctions(cr.scripts.LibraryCode())
+	}
+}
+
+// FcallCommand implements the FCALL and FCALL_RO commands. Like scripts,
+// functions are exclusive: no other command runs while a function does.
+type FcallCommand struct {
+	registry *CommandRegistry
+	function string
+	readOnly bool
+	keys     []string
+	argv     []string
+}
+
+// fcallConstructor returns the constructor of FcallCommand for calls that
+// may or may not write.
+func (cr *CommandRegistry) fcallConstructor(readOnly bool) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		n, err := parseNumKeys(args[1].Str, len(args)-2)
+		if err != nil {
+			return nil, err
+		}
+		return &FcallCommand{
+			registry: cr,
+			function: args[0].Str,
+			readOnly: readOnly,
+			keys:     bulkStrings(args[2 : 2+n]),
+			argv:     bulkStrings(args[2+n:]),
+		}, nil
+	}
+}
+
+func (c *FcallCommand) exclusive() {}
+
+// Apply is never called for FCALL, which needs the calling client.
+func (c *FcallCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("FCALL"))
+}
+
+// ApplyClient executes the FCALL command for the calling client. A function
+// registered with the no-writes flag may not write, whichever command calls
+// it, and FCALL_RO only calls such functions.
+func (c *FcallCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	cr := c.registry
+	cr.syncFunctions(s)
+	f, ok := cr.scripts.Function(c.function)
+	if !ok {
+		return replyError(scripting.ErrNoFunction)
+	}
+	if c.readOnly && !f.ReadOnly() {
+		return replyError(errs.Errorf("Can not execute a script with write flag using *_ro command."))
+	}
+	return cr.runScript(client, s, true, f.ReadOnly(), func(ctx context.Context, call scripting.CallFunc) (resp.RespValue, error) {
+		return cr.scripts.Call(ctx, c.function, c.keys, c.argv, call)
+	})
+}
+
+// FunctionCommand implements the FUNCTION command.
+type FunctionCommand struct {
+	registry   *CommandRegistry
+	subcommand string
+	args       []string
+	argv       []string // The whole invocation, for the append only file
+	pattern    string   // LIST: library name pattern, empty for all
+	withCode   bool     // LIST: reply with the code of the libraries
+	policy     scripting.LoadPolicy
+}
+
+// functionCommand returns the FUNCTION subcommand named subcommand with
+// the arguments args, bound to the registry.
+func (cr *CommandRegistry) functionCommand(subcommand string, args []resp.RespValue) *FunctionCommand {
+	rest := bulkStrings(args)
+	return &FunctionCommand{registry: cr, subcommand: subcommand, args: rest, argv: append([]string{"FUNCTION", subcommand}, rest...)}
+}
+
+// newFunctionCommand returns the constructor of the FUNCTION subcommand
+// named subcommand, whose arguments need no parsing.
+func (cr *CommandRegistry) newFunctionCommand(subcommand string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return cr.functionCommand(subcommand, args), nil
+	}
+}
+
+// newFunctionLoadCommand creates a new FUNCTION LOAD command.
+func (cr *CommandRegistry) newFunctionLoadCommand(args []resp.RespValue) (Command, error) {
+	c := cr.functionCommand("LOAD", args)
+	if len(c.args) == 2 {
+		if !strings.EqualFold(c.args[0], "REPLACE") {
+			return nil, errs.Errorf("Unknown option given: %s", c.args[0])
+		}
+		c.policy = scripting.ReplaceLibraries
+		c.args = c.args[1:]
+	}
+	return c, nil
+}
+
+// newFunctionRestoreCommand creates a new FUNCTION RESTORE command.
+func (cr *CommandRegistry) newFunctionRestoreCommand(args []resp.RespValue) (Command, error) {
+	c := cr.functionCommand("RESTORE", args)
+	if len(c.args) == 2 {
+		switch strings.ToUpper(c.args[1]) {
+		case "APPEND":
+			c.policy = scripting.AppendLibraries
+		case "REPLACE":
+			c.policy = scripting.ReplaceLibraries
+		case "FLUSH":
+			c.policy = scripting.FlushLibraries
+		default:
+			return nil, errs.Errorf("Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+		}
+	}
+	return c, nil
+}
+
+// newFunctionListCommand creates a new FUNCTION LIST command.
+func (cr *CommandRegistry) newFunctionListCommand(args []resp.RespValue) (Command, error) {
+	c := cr.functionCommand("LIST", args)
+	for i := 0; i < len(c.args); i++ {
+		switch {
+		case strings.EqualFold(c.args[i], "WITHCODE"):
+			c.withCode = true
+		case strings.EqualFold(c.args[i], "LIBRARYNAME"):
+			if i+1 == len(c.args) {
+				return nil, errs.Errorf("library name argument was not given")
+			}
+			i++
+			c.pattern = c.args[i]
+		default:
+			return nil, errs.Errorf("Unknown argument %s", c.args[i])
+		}
+	}
+	return c, nil
+}
+
+func (c *FunctionCommand) exclusive() {}
+
+// allowBusy lets FUNCTION KILL run while a function does.
+func (c *FunctionCommand) allowBusy() bool {
+	return c.subcommand == "KILL"
+}
+
+// Apply executes the FUNCTION command, as when replaying the append only
+// file. The libraries are saved with the dataset.
+func (c *FunctionCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.subcommand == "KILL" {
+		if err := c.registry.killScript(true); err != nil {
+			return replyError(err)
+		}
+		return replyOK()
+	}
+	scripts := c.registry.scripts
+	c.registry.syncFunctions(s)
+	switch c.subcommand {
+	case "LOAD":
+		names, err := scripts.LoadLibraries(c.args, c.policy)
+		if err != nil {
+			return replyError(err)
+		}
+		s.SetFunctions(scripts.LibraryCode())
+		return resp.NewBulk(names[0])
+	case "DELETE":
+		if err := scripts.DeleteLibrary(c.args[0]); err != nil {
+			return replyError(err)
+		}
+		s.SetFunctions(scripts.LibraryCode())
+		return replyOK()
+	case "DUMP":
+		return resp.NewBulk(string(rdb.FunctionsPayload(scripts.LibraryCode())))
+	case "RESTORE":
+		code, err := rdb.ReadFunctionsPayload([]byte(c.args[0]))
+		if err != nil {
+			return replyError(errs.Errorf("payload version or checksum are wrong"))
+		}
+		if _, err := scripts.LoadLibraries(code, c.policy); err != nil {
+			return replyError(err)
+		}
+		s.SetFunctions(scripts.LibraryCode())
+		return replyOK()
+	case "LIST":
+		return c.list(scripts.Libraries())
+	}
+	return replyError(errs.Syntax)
+}
+
+// ApplyClient executes the FUNCTION command for the calling client, and
+// appends the subcommands changing the libraries to the append only file.
+func (c *FunctionCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	result := c.Apply(s)
+	switch c.subcommand {
+	case "LOAD", "DELETE", "RESTORE":
+		if c.registry.aof != nil && result.Type != resp.Error {
+			c.registry.propagateScript([][]string{c.argv})
+		}
+	}
+	return result
+}
+
+// list renders the reply of FUNCTION LIST: a map per library, with the
+// functions it registered.
+func (c *FunctionCommand) list(libs []scripting.Library) resp.RespValue {
+	reply := []resp.RespValue{}
+	for _, lib := range libs {
+		if c.pattern != "" && !glob.Match(c.pattern, lib.Name) {
+			continue
+		}
+		functions := make([]resp.RespValue, len(lib.Functions))
+		for i, f := range lib.Functions {
+			description := replyNil()
+			if f.Description != "" {
+				description = resp.NewBulk(f.Description)
+			}
+			functions[i] = resp.NewMap([]resp.RespValue{
+				resp.NewBulk("name"), resp.NewBulk(f.Name),
+				resp.NewBulk("description"), description,
+				resp.NewBulk("flags"), replyBulkArray(f.Flags),
+			})
+		}
+		fields := []resp.RespValue{
+			resp.NewBulk("library_name"), resp.NewBulk(lib.Name),
+			resp.NewBulk("engine"), resp.NewBulk("LUA"),
+			resp.NewBulk("functions"), resp.NewArray(functions),
+		}
+		if c.withCode {
+			fields = append(fields, resp.NewBulk("library_code"), resp.NewBulk(lib.Code))
+		}
+		reply = append(reply, resp.NewMap(fields))
+	}
+	return resp.NewArray(reply)
+}
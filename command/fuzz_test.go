@@ -0,0 +1,101 @@
+package command_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// fuzzLimits are those of a connection with the default configuration.
+var fuzzLimits = resp.Limits{
+	MaxLineLength:   64 * 1024,
+	MaxMultiBulkLen: 1024 * 1024,
+	MaxBulkLen:      512 * 1024 * 1024,
+	MaxValueBytes:   1024 * 1024 * 1024,
+}
+
+// interesting are arguments likely to reach edge cases.
+var interesting = []string{
+	"", "0", "1", "-1", "2", "-2", "10", "100", "-100", "0.5", "-0.5", "1e308", "-1e308", "1e-308",
+	"inf", "-inf", "+inf", "nan", "(1", "(", "[a", "-", "+",
+	"2147483647", "2147483648", "-2147483648", "4294967296",
+	"9223372036854775807", "-9223372036854775808", "9223372036854775808", "18446744073709551616",
+	"abc", "key", "field", "member", "*", "?", "[", "\\", "\r\n", "\x00", "\xff",
+	"NX", "XX", "GT", "LT", "EX", "PX", "EXAT", "PXAT", "KEEPTTL", "GET", "WITHSCORES", "LIMIT",
+	"BEFORE", "AFTER", "COUNT", "LOAD", "FLUSH", "EXISTS", "KILL", "LIST", "INFO", "ID", "TRACKING", "ON", "OFF",
+	"return 1", "return redis.call('GET', KEYS[1])", "return {1, 2, {3}}", "return redis.call('NOSUCH')",
+	"return redis.pcall('INCR', KEYS[1])", "error('x')", "return nil", "return 1.5", "return redis.error_reply('x')",
+}
+
+// skipFuzz reports whether FuzzExecute should not run argv: DEBUG can sleep
+// or reload the dataset, which says nothing about malformed input, CLIENT
+// PAUSE would hold back the inputs that follow, and SRANDMEMBER with a
+// count of minus a billion asks for a reply as large as it is valid.
+func skipFuzz(argv []resp.RespValue) bool {
+	if len(argv) == 0 {
+		return false
+	}
+	name := strings.ToUpper(argv[0].Str)
+	if name == "CLIENT" && len(argv) >= 2 && strings.EqualFold(argv[1].Str, "PAUSE") {
+		return true
+	}
+	if name == "SRANDMEMBER" && len(argv) == 3 {
+		n, err := strconv.ParseInt(argv[2].Str, 10, 64)
+		return err == nil && n < -100000
+	}
+	return name == "DEBUG"
+}
+
+func encode(argv ...string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(argv))
+	for _, arg := range argv {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.Bytes()
+}
+
+// FuzzExecute runs the commands read from malformed input through
+// ParseCommand and Execute, as a connection does, each input on an empty
+// dataset.
+func FuzzExecute(f *testing.F) {
+	cr := command.NewCommandRegistry()
+	for i, spec := range cr.Specs() {
+		f.Add(encode(spec.Name, "key", "1", "2"))
+		n := len(interesting)
+		f.Add(encode(spec.Name, "key", interesting[i%n], interesting[(7*i+3)%n]))
+	}
+	client := cr.Clients().Register("fuzz:1", "fuzz:0")
+	client.SetPusher(func(resp.RespValue) {})
+	f.Fuzz(func(t *testing.T, input []byte) {
+		s := storage.NewStorage()
+		r := resp.NewReader(bufio.NewReader(bytes.NewReader(input)), fuzzLimits)
+		for {
+			v, err := r.ReadValue()
+			if err != nil {
+				return
+			}
+			if skipFuzz(v.Array) {
+				continue
+			}
+			cmd, err := cr.ParseCommand(v)
+			if err != nil {
+				continue
+			}
+			// Blocking commands run without a client, as from a script,
+			// so they do not wait.
+			if spec, ok := cr.LookupArgv(v.Array); ok && spec.HasFlag(command.FlagBlocking) {
+				cr.Execute(nil, v.Array, cmd, s)
+				continue
+			}
+			cr.Execute(client, v.Array, cmd, s)
+		}
+	})
+}
@@ -0,0 +1,455 @@
+package command
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/geohash"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerGeoCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "GEOADD", MinArgs: 4, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: NewGeoAddCommand},
+		{Name: "GEOPOS", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: NewGeoPosCommand},
+		{Name: "GEODIST", MinArgs: 3, MaxArgs: 4, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: NewGeoDistCommand},
+		{Name: "GEOHASH", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: NewGeoHashCommand},
+		{Name: "GEOSEARCH", MinArgs: 6, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: geoSearchConstructor("GEOSEARCH", geoSearch)},
+		{Name: "GEOSEARCHSTORE", MinArgs: 7, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Categories: []string{"@geo"}, New: geoSearchConstructor("GEOSEARCHSTORE", geoSearchStore)},
+		{Name: "GEORADIUS", MinArgs: 5, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagMovableKeys, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, KeysFunc: geoRadiusKeys(6), New: geoSearchConstructor("GEORADIUS", geoRadius)},
+		{Name: "GEORADIUS_RO", MinArgs: 5, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: geoSearchConstructor("GEORADIUS_RO", geoRadiusRO)},
+		{Name: "GEORADIUSBYMEMBER", MinArgs: 4, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagMovableKeys, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, KeysFunc: geoRadiusKeys(5), New: geoSearchConstructor("GEORADIUSBYMEMBER", geoRadiusByMember)},
+		{Name: "GEORADIUSBYMEMBER_RO", MinArgs: 4, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@geo"}, New: geoSearchConstructor("GEORADIUSBYMEMBER_RO", geoRadiusByMemberRO)},
+	})
+}
+
+// geoRadiusKeys returns the key positions function of GEORADIUS, whose
+// options start at argv[options], or GEORADIUSBYMEMBER: the source key and
+// the key of the STORE or STOREDIST option, if any.
+func geoRadiusKeys(options int) func(argv []resp.RespValue) []int {
+	return func(argv []resp.RespValue) []int {
+		positions := []int{1}
+		for i := options; i+1 < len(argv); i++ {
+			if strings.EqualFold(argv[i].Str, "STORE") || strings.EqualFold(argv[i].Str, "STOREDIST") {
+				positions = append(positions, i+1)
+				i++
+			}
+		}
+		return positions
+	}
+}
+
+// GeoAddCommand implements the GEOADD command.
+type GeoAddCommand struct {
+	key       string
+	opts      storage.ZAddOptions
+	locations []storage.GeoLocation
+}
+
+// NewGeoAddCommand creates a new GeoAddCommand from the arguments
+// key [NX|XX] [CH] longitude latitude member [longitude latitude member ...].
+func NewGeoAddCommand(args []resp.RespValue) (Command, error) {
+	c := &GeoAddCommand{key: args[0].Str}
+	opts, i := parseZAddOptions(args, 1, false)
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%3 != 0 || opts.NX && opts.XX {
+		return nil, errs.Syntax
+	}
+	c.opts = opts
+	for j := 0; j < len(rest); j += 3 {
+		lon, lat, err := parseLonLat(rest[j], rest[j+1])
+		if err != nil {
+			return nil, err
+		}
+		c.locations = append(c.locations, storage.GeoLocation{Member: rest[j+2].Str, Lon: lon, Lat: lat})
+	}
+	return c, nil
+}
+
+// Apply executes the GEOADD command.
+func (c *GeoAddCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.GeoAdd(c.key, c.opts, c.locations...)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// parseGeoFloat parses a coordinate or a distance, which is never NaN.
+func parseGeoFloat(arg resp.RespValue) (float64, bool) {
+	f, err := strconv.ParseFloat(arg.Str, 64)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+// parseLonLat parses a longitude and a latitude in the range geohashes
+// cover.
+func parseLonLat(lonArg, latArg resp.RespValue) (float64, float64, error) {
+	lon, ok := parseGeoFloat(lonArg)
+	if !ok {
+		return 0, 0, errs.NotFloat
+	}
+	lat, ok := parseGeoFloat(latArg)
+	if !ok {
+		return 0, 0, errs.NotFloat
+	}
+	if !geohash.Valid(lon, lat) {
+		return 0, 0, errs.Errorf("invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+// parseGeoUnit parses a unit of distance and returns its length in meters.
+func parseGeoUnit(arg resp.RespValue) (float64, error) {
+	switch strings.ToLower(arg.Str) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, errs.Errorf("unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// formatGeoDistance formats a distance as GEODIST and WITHDIST reply it.
+func formatGeoDistance(dist float64) string {
+	return strconv.FormatFloat(dist, 'f', 4, 64)
+}
+
+// replyGeoCoordinates returns a position as a longitude and a latitude
+// with up to 17 decimals, as GEOPOS and WITHCOORD reply it.
+func replyGeoCoordinates(lon, lat float64) resp.RespValue {
+	format := func(f float64) string {
+		s := strings.TrimRight(strconv.FormatFloat(f, 'f', 17, 64), "0")
+		return strings.TrimSuffix(s, ".")
+	}
+	return resp.NewBulkArray([]string{format(lon), format(lat)})
+}
+
+// GeoPosCommand implements the GEOPOS command.
+type GeoPosCommand struct {
+	key     string
+	members []string
+}
+
+// NewGeoPosCommand creates a new GeoPosCommand.
+func NewGeoPosCommand(args []resp.RespValue) (Command, error) {
+	c := &GeoPosCommand{key: args[0].Str}
+	for _, arg := range args[1:] {
+		c.members = append(c.members, arg.Str)
+	}
+	return c, nil
+}
+
+// Apply executes the GEOPOS command.
+func (c *GeoPosCommand) Apply(s *storage.Storage) resp.RespValue {
+	hashes, found, err := s.GeoHashes(c.key, c.members...)
+	if err != nil {
+		return replyError(err)
+	}
+	vals := make([]resp.RespValue, len(c.members))
+	for i := range vals {
+		if !found[i] {
+			vals[i] = resp.NewNullArray()
+			continue
+		}
+		vals[i] = replyGeoCoordinates(geohash.Decode(hashes[i]))
+	}
+	return resp.NewArray(vals)
+}
+
+// GeoDistCommand implements the GEODIST command.
+type GeoDistCommand struct {
+	key              string
+	member1, member2 string
+	unit             float64
+}
+
+// NewGeoDistCommand creates a new GeoDistCommand from the arguments
+// key member1 member2 [M|KM|FT|MI].
+func NewGeoDistCommand(args []resp.RespValue) (Command, error) {
+	c := &GeoDistCommand{key: args[0].Str, member1: args[1].Str, member2: args[2].Str, unit: 1}
+	if len(args) == 4 {
+		unit, err := parseGeoUnit(args[3])
+		if err != nil {
+			return nil, err
+		}
+		c.unit = unit
+	}
+	return c, nil
+}
+
+// Apply executes the GEODIST command.
+func (c *GeoDistCommand) Apply(s *storage.Storage) resp.RespValue {
+	dist, found, err := s.GeoDist(c.key, c.member1, c.member2)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyBulkOrNil(formatGeoDistance(dist/c.unit), found)
+}
+
+// GeoHashCommand implements the GEOHASH command.
+type GeoHashCommand struct {
+	key     string
+	members []string
+}
+
+// NewGeoHashCommand creates a new GeoHashCommand.
+func NewGeoHashCommand(args []resp.RespValue) (Command, error) {
+	c := &GeoHashCommand{key: args[0].Str}
+	for _, arg := range args[1:] {
+		c.members = append(c.members, arg.Str)
+	}
+	return c, nil
+}
+
+// Apply executes the GEOHASH command.
+func (c *GeoHashCommand) Apply(s *storage.Storage) resp.RespValue {
+	hashes, found, err := s.GeoHashes(c.key, c.members...)
+	if err != nil {
+		return replyError(err)
+	}
+	vals := make([]resp.RespValue, len(c.members))
+	for i := range vals {
+		vals[i] = replyBulkOrNil(geohash.String(hashes[i]), found[i])
+	}
+	return resp.NewArray(vals)
+}
+
+// geoSearchKind tells apart the commands searching geospatial indexes,
+// which differ in how they take the center and the area.
+type geoSearchKind int
+
+const (
+	geoRadius           geoSearchKind = iota // key longitude latitude radius unit, STORE allowed
+	geoRadiusRO                              // As geoRadius, without STORE
+	geoRadiusByMember                        // key member radius unit, STORE allowed
+	geoRadiusByMemberRO                      // As geoRadiusByMember, without STORE
+	geoSearch                                // key, then FROMMEMBER or FROMLONLAT, BYRADIUS or BYBOX
+	geoSearchStore                           // destination key, then as geoSearch
+)
+
+// GeoSearchCommand implements the GEOSEARCH and GEOSEARCHSTORE commands,
+// along with GEORADIUS, GEORADIUSBYMEMBER and their read only variants.
+type GeoSearchCommand struct {
+	name      string
+	argv      []string // The arguments, logged as they are when storing
+	key       string
+	query     storage.GeoQuery
+	unit      float64 // Meters of the unit of the distances
+	withDist  bool
+	withHash  bool
+	withCoord bool
+	store     string // The key the results are stored at, if any
+	storeDist bool
+}
+
+// geoSearchConstructor returns the constructor of the named command of
+// the given kind.
+func geoSearchConstructor(name string, kind geoSearchKind) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return newGeoSearchCommand(name, kind, args)
+	}
+}
+
+// newGeoSearchCommand parses the arguments of a command searching a
+// geospatial index, with the options and the errors of Redis.
+func newGeoSearchCommand(name string, kind geoSearchKind, args []resp.RespValue) (*GeoSearchCommand, error) {
+	c := &GeoSearchCommand{name: name}
+	for _, arg := range args {
+		c.argv = append(c.argv, arg.Str)
+	}
+	i := 0
+	if kind == geoSearchStore {
+		c.store = args[0].Str
+		i++
+	}
+	c.key = args[i].Str
+	i++
+
+	var err error
+	q := &c.query
+	switch kind {
+	case geoRadius, geoRadiusRO:
+		if q.Lon, q.Lat, err = parseLonLat(args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+		q.FromLonLat = true
+		i += 2
+	case geoRadiusByMember, geoRadiusByMemberRO:
+		q.FromMember = args[i].Str
+		i++
+	}
+	if kind != geoSearch && kind != geoSearchStore {
+		if q.Radius, c.unit, err = parseGeoRadius(args[i], args[i+1]); err != nil {
+			return nil, err
+		}
+		i += 2
+	}
+
+	canStore := kind == geoRadius || kind == geoRadiusByMember
+	var from, by bool
+	for ; i < len(args); i++ {
+		rest := len(args) - i - 1
+		switch arg := strings.ToUpper(args[i].Str); {
+		case arg == "WITHDIST":
+			c.withDist = true
+		case arg == "WITHHASH":
+			c.withHash = true
+		case arg == "WITHCOORD":
+			c.withCoord = true
+		case arg == "ANY":
+			q.Any = true
+		case arg == "ASC":
+			q.Sort = 1
+		case arg == "DESC":
+			q.Sort = -1
+		case arg == "COUNT" && rest >= 1:
+			count, err := strconv.ParseInt(args[i+1].Str, 10, 64)
+			if err != nil {
+				return nil, errs.NotInteger
+			}
+			if count <= 0 {
+				return nil, errs.Errorf("COUNT must be > 0")
+			}
+			q.Count = int(min(count, math.MaxInt32))
+			i++
+		case (arg == "STORE" || arg == "STOREDIST") && canStore && rest >= 1:
+			c.store, c.storeDist = args[i+1].Str, arg == "STOREDIST"
+			i++
+		case arg == "STOREDIST" && kind == geoSearchStore:
+			c.storeDist = true
+		case arg == "FROMMEMBER" && rest >= 1 && (kind == geoSearch || kind == geoSearchStore):
+			if from {
+				return nil, errs.Syntax
+			}
+			q.FromMember, from = args[i+1].Str, true
+			i++
+		case arg == "FROMLONLAT" && rest >= 2 && (kind == geoSearch || kind == geoSearchStore):
+			if from {
+				return nil, errs.Syntax
+			}
+			if q.Lon, q.Lat, err = parseLonLat(args[i+1], args[i+2]); err != nil {
+				return nil, err
+			}
+			q.FromLonLat, from = true, true
+			i += 2
+		case arg == "BYRADIUS" && rest >= 2 && (kind == geoSearch || kind == geoSearchStore):
+			if by {
+				return nil, errs.Syntax
+			}
+			if q.Radius, c.unit, err = parseGeoRadius(args[i+1], args[i+2]); err != nil {
+				return nil, err
+			}
+			by = true
+			i += 2
+		case arg == "BYBOX" && rest >= 3 && (kind == geoSearch || kind == geoSearchStore):
+			if by {
+				return nil, errs.Syntax
+			}
+			if q.Width, q.Height, c.unit, err = parseGeoBox(args[i+1], args[i+2], args[i+3]); err != nil {
+				return nil, err
+			}
+			q.ByBox, by = true, true
+			i += 3
+		default:
+			return nil, errs.Syntax
+		}
+	}
+
+	if c.store != "" && (c.withDist || c.withHash || c.withCoord) {
+		option := "STORE option in GEORADIUS"
+		if kind == geoSearchStore {
+			option = "GEOSEARCHSTORE"
+		}
+		return nil, errs.Errorf("%s is not compatible with WITHDIST, WITHHASH and WITHCOORD options", option)
+	}
+	if (kind == geoSearch || kind == geoSearchStore) && !from {
+		return nil, errs.Errorf("exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name)
+	}
+	if (kind == geoSearch || kind == geoSearchStore) && !by {
+		return nil, errs.Errorf("exactly one of BYRADIUS and BYBOX can be specified for %s", name)
+	}
+	if q.Any && q.Count == 0 {
+		return nil, errs.Errorf("the ANY argument requires COUNT argument")
+	}
+	// The nearest members are found by sorting them, which COUNT needs
+	// unless ANY members will do.
+	if q.Count > 0 && q.Sort == 0 && !q.Any {
+		q.Sort = 1
+	}
+	q.Radius *= c.unit
+	q.Width *= c.unit
+	q.Height *= c.unit
+	return c, nil
+}
+
+// parseGeoRadius parses a radius and its unit, returning both in meters.
+func parseGeoRadius(radiusArg, unitArg resp.RespValue) (float64, float64, error) {
+	radius, ok := parseGeoFloat(radiusArg)
+	if !ok {
+		return 0, 0, errs.Errorf("need numeric radius")
+	}
+	if radius < 0 {
+		return 0, 0, errs.Errorf("radius cannot be negative")
+	}
+	unit, err := parseGeoUnit(unitArg)
+	return radius, unit, err
+}
+
+// parseGeoBox parses the width and the height of a box and their unit.
+func parseGeoBox(widthArg, heightArg, unitArg resp.RespValue) (float64, float64, float64, error) {
+	width, ok := parseGeoFloat(widthArg)
+	if !ok {
+		return 0, 0, 0, errs.Errorf("need numeric width")
+	}
+	height, ok := parseGeoFloat(heightArg)
+	if !ok {
+		return 0, 0, 0, errs.Errorf("need numeric height")
+	}
+	if width < 0 || height < 0 {
+		return 0, 0, 0, errs.Errorf("height or width cannot be negative")
+	}
+	unit, err := parseGeoUnit(unitArg)
+	return width, height, unit, err
+}
+
+// Apply executes the command, searching the index and replying with the
+// members found, or storing them.
+func (c *GeoSearchCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.store != "" {
+		n, err := s.GeoSearchStore(c.store, c.key, c.query, c.storeDist, c.unit)
+		if err != nil {
+			return replyError(err)
+		}
+		return replyInteger(n)
+	}
+	results, err := s.GeoSearch(c.key, c.query)
+	if err != nil {
+		return replyError(err)
+	}
+	vals := make([]resp.RespValue, len(results))
+	for i, r := range results {
+		if !c.withDist && !c.withHash && !c.withCoord {
+			vals[i] = resp.NewBulk(r.Member)
+			continue
+		}
+		item := []resp.RespValue{resp.NewBulk(r.Member)}
+		if c.withDist {
+			item = append(item, resp.NewBulk(formatGeoDistance(r.Dist/c.unit)))
+		}
+		if c.withHash {
+			item = append(item, replyInteger(int64(r.Hash)))
+		}
+		if c.withCoord {
+			item = append(item, replyGeoCoordinates(r.Lon, r.Lat))
+		}
+		vals[i] = resp.NewArray(item)
+	}
+	return resp.NewArray(vals)
+}
@@ -1,46 +1,49 @@
 package command
 
 import (
+	"github.com/liweiyuan/go-redis-server/internal/errs"
 	"github.com/liweiyuan/go-redis-server/resp"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
 func registerHashCommands(cr *CommandRegistry) {
-	cr.register("HSET", NewHSetCommand)
-	cr.register("HGET", NewHGetCommand)
-	cr.register("HDEL", NewHDelCommand)
-	cr.register("HEXISTS", NewHExistsCommand)
-	cr.register("HLEN", NewHLenCommand)
-	cr.register("HGETALL", NewHGetAllCommand)
-}
-
-// HSetCommand implements the HSET command.
+	cr.register([]CommandSpec{
+		{Name: "HSET", MinArgs: 3, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hash"}, New: NewHSetCommand},
+		{Name: "HGET", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hash"}, New: NewHGetCommand},
+		{Name: "HDEL", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hash"}, New: NewHDelCommand},
+		{Name: "HEXISTS", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hash"}, New: NewHExistsCommand},
+		{Name: "HLEN", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hash"}, New: NewHLenCommand},
+		{Name: "HGETALL", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hash"}, New: NewHGetAllCommand},
+	})
+}
+
+// HSetCommand implements the HSET command, and through an alias the HMSET
+// command.
 type HSetCommand struct {
 	key   string
-	field string
-	value string
+	pairs []string // Fields and values, alternately
 }
 
 // NewHSetCommand creates a new HSetCommand.
 func NewHSetCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'hset' command")
+	if len(args)%2 == 0 {
+		return nil, errs.WrongArgs("hset")
 	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR HSET arguments must be bulk strings")
+	pairs := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		pairs[i] = arg.Str
 	}
-
-	return &HSetCommand{key: args[0].Str, field: args[1].Str, value: args[2].Str}, nil
+	return &HSetCommand{key: args[0].Str, pairs: pairs}, nil
 }
 
-// Apply executes the HSET command.
+// Apply executes the HSET command, replying with the number of fields
+// added.
 func (c *HSetCommand) Apply(s *storage.Storage) resp.RespValue {
-	count, err := s.HSet(c.key, c.field, c.value)
+	added, err := s.HSet(c.key, c.pairs...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(added)
 }
 
 // HGetCommand implements the HGET command.
@@ -51,27 +54,16 @@ type HGetCommand struct {
 
 // NewHGetCommand creates a new HGetCommand.
 func NewHGetCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'hget' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR HGET arguments must be bulk strings")
-	}
-
 	return &HGetCommand{key: args[0].Str, field: args[1].Str}, nil
 }
 
 // Apply executes the HGET command.
 func (c *HGetCommand) Apply(s *storage.Storage) resp.RespValue {
-	val, err := s.HGet(c.key, c.field)
+	val, found, err := s.HGet(c.key, c.field)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-	if val == "" {
-		return resp.NewBulk("") // Return null bulk string if field not found
+		return replyError(err)
 	}
-	return resp.NewBulk(val)
+	return replyBulkOrNil(val, found)
 }
 
 // HDelCommand implements the HDEL command.
@@ -82,16 +74,9 @@ type HDelCommand struct {
 
 // NewHDelCommand creates a new HDelCommand.
 func NewHDelCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'hdel' command")
-	}
-
 	key := args[0].Str
 	fields := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR HDEL arguments must be bulk strings")
-		}
 		fields[i] = arg.Str
 	}
 	return &HDelCommand{key: key, fields: fields}, nil
@@ -101,9 +86,9 @@ func NewHDelCommand(args []resp.RespValue) (Command, error) {
 func (c *HDelCommand) Apply(s *storage.Storage) resp.RespValue {
 	count, err := s.HDel(c.key, c.fields...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(count)
 }
 
 // HExistsCommand implements the HEXISTS command.
@@ -114,14 +99,6 @@ type HExistsCommand struct {
 
 // NewHExistsCommand creates a new HExistsCommand.
 func NewHExistsCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'hexists' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR HEXISTS arguments must be bulk strings")
-	}
-
 	return &HExistsCommand{key: args[0].Str, field: args[1].Str}, nil
 }
 
@@ -129,9 +106,9 @@ func NewHExistsCommand(args []resp.RespValue) (Command, error) {
 func (c *HExistsCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.HExists(c.key, c.field)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyBool(val == 1)
 }
 
 // HLenCommand implements the HLEN command.
@@ -141,14 +118,6 @@ type HLenCommand struct {
 
 // NewHLenCommand creates a new HLenCommand.
 func NewHLenCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'hlen' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR HLEN argument must be a bulk string")
-	}
-
 	return &HLenCommand{key: args[0].Str}, nil
 }
 
@@ -156,9 +125,9 @@ func NewHLenCommand(args []resp.RespValue) (Command, error) {
 func (c *HLenCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.HLen(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyInteger(val)
 }
 
 // HGetAllCommand implements the HGETALL command.
@@ -168,27 +137,15 @@ type HGetAllCommand struct {
 
 // NewHGetAllCommand creates a new HGetAllCommand.
 func NewHGetAllCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'hgetall' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR HGETALL argument must be a bulk string")
-	}
-
 	return &HGetAllCommand{key: args[0].Str}, nil
 }
 
-// Apply executes the HGETALL command.
+// Apply executes the HGETALL command, replying with a map of the fields
+// to their values, which RESP2 clients get as a flat array.
 func (c *HGetAllCommand) Apply(s *storage.Storage) resp.RespValue {
 	values, err := s.HGetAll(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-
-	respValues := make([]resp.RespValue, len(values))
-	for i, val := range values {
-		respValues[i] = resp.NewBulk(val)
+		return replyError(err)
 	}
-	return resp.NewArray(respValues)
+	return resp.NewBulkMap(values)
 }
\ No newline at end of file
@@ -0,0 +1,147 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerHyperLogLogCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "PFADD", MinArgs: 1, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@hyperloglog"}, New: NewPFAddCommand},
+		{Name: "PFCOUNT", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly | FlagMayReplicate, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@hyperloglog"}, New: NewPFCountCommand},
+		{Name: "PFMERGE", MinArgs: 1, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@hyperloglog"}, New: NewPFMergeCommand},
+		{Name: "PFDEBUG", MinArgs: 2, MaxArgs: 2, Flags: FlagWrite | FlagDenyOOM | FlagAdmin, FirstKey: 2, LastKey: 2, Step: 1, Categories: []string{"@hyperloglog", "@dangerous"}, New: NewPFDebugCommand},
+	})
+}
+
+// PFAddCommand implements the PFADD command.
+type PFAddCommand struct {
+	key   string
+	elems []string
+}
+
+// NewPFAddCommand creates a new PFAddCommand.
+func NewPFAddCommand(args []resp.RespValue) (Command, error) {
+	c := &PFAddCommand{key: args[0].Str}
+	for _, arg := range args[1:] {
+		c.elems = append(c.elems, arg.Str)
+	}
+	return c, nil
+}
+
+// Apply executes the PFADD command.
+func (c *PFAddCommand) Apply(s *storage.Storage) resp.RespValue {
+	updated, err := s.PFAdd(c.key, c.elems...)
+	if err != nil {
+		return replyError(err)
+	}
+	if updated {
+		return replyInteger(1)
+	}
+	return replyInteger(0)
+}
+
+// PFCountCommand implements the PFCOUNT command.
+type PFCountCommand struct {
+	keys []string
+}
+
+// NewPFCountCommand creates a new PFCountCommand.
+func NewPFCountCommand(args []resp.RespValue) (Command, error) {
+	c := &PFCountCommand{}
+	for _, arg := range args {
+		c.keys = append(c.keys, arg.Str)
+	}
+	return c, nil
+}
+
+// Apply executes the PFCOUNT command.
+func (c *PFCountCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.PFCount(c.keys...)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// PFMergeCommand implements the PFMERGE command.
+type PFMergeCommand struct {
+	dst  string
+	srcs []string
+}
+
+// NewPFMergeCommand creates a new PFMergeCommand.
+func NewPFMergeCommand(args []resp.RespValue) (Command, error) {
+	c := &PFMergeCommand{dst: args[0].Str}
+	for _, arg := range args[1:] {
+		c.srcs = append(c.srcs, arg.Str)
+	}
+	return c, nil
+}
+
+// Apply executes the PFMERGE command.
+func (c *PFMergeCommand) Apply(s *storage.Storage) resp.RespValue {
+	if err := s.PFMerge(c.dst, c.srcs...); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
+
+// PFDebugCommand implements the PFDEBUG command, which inspects the
+// encoding of a HyperLogLog for tests.
+type PFDebugCommand struct {
+	subcommand string
+	key        string
+	converted  bool // The HyperLogLog was converted to dense
+}
+
+// NewPFDebugCommand creates a new PFDebugCommand.
+func NewPFDebugCommand(args []resp.RespValue) (Command, error) {
+	c := &PFDebugCommand{subcommand: strings.ToUpper(args[0].Str), key: args[1].Str}
+	switch c.subcommand {
+	case "GETREG", "DECODE", "ENCODING", "TODENSE":
+		return c, nil
+	}
+	return nil, errs.Errorf("Unknown PFDEBUG subcommand '%s'", args[0].Str)
+}
+
+// Apply executes the PFDEBUG command.
+func (c *PFDebugCommand) Apply(s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "GETREG":
+		regs, converted, err := s.PFDebugGetReg(c.key)
+		if err != nil {
+			return replyError(err)
+		}
+		c.converted = converted
+		vals := make([]resp.RespValue, len(regs))
+		for i, v := range regs {
+			vals[i] = replyInteger(int64(v))
+		}
+		return resp.NewArray(vals)
+	case "DECODE":
+		decoded, err := s.PFDebugDecode(c.key)
+		if err != nil {
+			return replyError(err)
+		}
+		return resp.NewString(decoded)
+	case "ENCODING":
+		encoding, err := s.PFDebugEncoding(c.key)
+		if err != nil {
+			return replyError(err)
+		}
+		return resp.NewString(encoding)
+	}
+	converted, err := s.PFDebugToDense(c.key)
+	if err != nil {
+		return replyError(err)
+	}
+	c.converted = converted
+	if converted {
+		return replyInteger(1)
+	}
+	return replyInteger(0)
+}
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// infoSection is a section of the INFO reply.
+type infoSection struct {
+	name      string
+	isDefault bool // Included when INFO is called without arguments
+	render    func(s *storage.Storage) string
+}
+
+// AddInfoSection adds a section to the INFO reply. The render function
+// returns the section body as "field:value\r\n" lines. Default sections are
+// included when INFO is called without arguments.
+func (cr *CommandRegistry) AddInfoSection(name string, isDefault bool, render func(s *storage.Storage) string) {
+	cr.infoSections = append(cr.infoSections, infoSection{name: strings.ToLower(name), isDefault: isDefault, render: render})
+}
+
+func (cr *CommandRegistry) registerInfoSections() {
+	cr.AddInfoSection("server", true, func(s *storage.Storage) string {
+		uptime := int64(time.Since(cr.started).Seconds())
+		return fmt.Sprintf("redis_version:%s\r\nredis_git_sha1:%s\r\nredis_git_dirty:0\r\nredis_mode:standalone\r\nos:%s %s\r\narch_bits:%d\r\ngo_version:%s\r\nprocess_id:%d\r\nrun_id:%s\r\ntcp_port:%d\r\nuptime_in_seconds:%d\r\nuptime_in_days:%d\r\n",
+			ServerVersion, GitSHA1, runtime.GOOS, runtime.GOARCH, strconv.IntSize, runtime.Version(), os.Getpid(), cr.runID, cr.tcpPort, uptime, uptime/86400)
+	})
+	cr.AddInfoSection("clients", true, func(s *storage.Storage) string {
+		blocked, keys := cr.blocking.Blocked()
+		return fmt.Sprintf("connected_clients:%d\r\nblocked_clients:%d\r\ntotal_blocking_keys:%d\r\n", cr.clients.Len(), blocked, keys)
+	})
+	cr.AddInfoSection("memory", true, func(s *storage.Storage) string {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		ds := s.DefragStats()
+		running := 0
+		if ds.Running {
+			running = 1
+		}
+		return fmt.Sprintf("used_memory:%d\r\nused_memory_sys:%d\r\nmem_clients_normal:%d\r\nmaxmemory_clients:%d\r\nactive_defrag_running:%d\r\nactive_defrag_hits:%d\r\nactive_defrag_reclaimed_bytes:%d\r\nlazyfree_pending_objects:0\r\n",
+			ms.HeapAlloc, ms.Sys, cr.clients.Memory(), cr.clients.memoryLimit.Load(), running, ds.Hits, ds.Reclaimed)
+	})
+	cr.AddInfoSection("persistence", true, func(s *storage.Storage) string {
+		if cr.snapshotter == nil {
+			return "loading:0\r\n" + cr.infoAOF()
+		}
+		loading, bgsave, bgsaveStatus := 0, 0, "ok"
+		if cr.snapshotter.Loading() {
+			loading = 1
+		}
+		if cr.snapshotter.BackgroundSaving() {
+			bgsave = 1
+		}
+		if !cr.snapshotter.LastBackgroundSaveOK() {
+			bgsaveStatus = "err"
+		}
+		return fmt.Sprintf("loading:%d\r\nrdb_changes_since_last_save:%d\r\nrdb_bgsave_in_progress:%d\r\nrdb_last_save_time:%d\r\nrdb_last_bgsave_status:%s\r\n",
+			loading, s.Dirty(), bgsave, cr.snapshotter.LastSave().Unix(), bgsaveStatus) + cr.infoAOF()
+	})
+	cr.AddInfoSection("stats", true, func(s *storage.Storage) string {
+		channels, patterns, shards := cr.pubsub.counts()
+		return fmt.Sprintf("keyspace_hits:%d\r\nkeyspace_misses:%d\r\nevicted_clients:%d\r\npubsub_channels:%d\r\npubsub_patterns:%d\r\npubsubshard_channels:%d\r\n",
+			s.KeyspaceHits(), s.KeyspaceMisses(), cr.clients.Evicted(), channels, patterns, shards) +
+			s.InfoKeyspacePrefixes()
+	})
+	// The server does not replicate: it is always a master without
+	// replicas, and no replication stream advances its offset.
+	cr.AddInfoSection("replication", true, func(s *storage.Storage) string {
+		return fmt.Sprintf("role:master\r\nconnected_slaves:0\r\nmaster_failover_state:no-failover\r\nmaster_replid:%s\r\nmaster_replid2:%s\r\nmaster_repl_offset:0\r\nsecond_repl_offset:-1\r\nrepl_backlog_active:0\r\n",
+			cr.replID, strings.Repeat("0", 40))
+	})
+	cr.AddInfoSection("cluster", true, func(s *storage.Storage) string {
+		enabled := 0
+		if cr.clusterEnabled {
+			enabled = 1
+		}
+		return fmt.Sprintf("cluster_enabled:%d\r\n", enabled)
+	})
+	// The server has a single database, db0, reported once it holds keys
+	// as Redis reports the databases that are not empty.
+	cr.AddInfoSection("keyspace", true, func(s *storage.Storage) string {
+		c := s.KeyCounts()
+		if c.Keys == 0 {
+			return ""
+		}
+		return fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=%d\r\n", c.Keys, c.Expires, c.AvgTTL)
+	})
+	cr.AddInfoSection("commandstats", false, func(s *storage.Storage) string {
+		return cr.stats.infoCommandStats()
+	})
+	cr.AddInfoSection("latencystats", false, func(s *storage.Storage) string {
+		return cr.stats.infoLatencyStats()
+	})
+}
+
+// info renders the requested INFO sections. With no names, the default
+// sections are rendered; "all" and "everything" select every section.
+func (cr *CommandRegistry) info(s *storage.Storage, names []string) string {
+	selectAll := false
+	selected := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == "all" || name == "everything" {
+			selectAll = true
+		}
+		selected[name] = true
+	}
+
+	var b strings.Builder
+	for _, section := range cr.infoSections {
+		include := selectAll || selected[section.name] || (len(names) == 0 || selected["default"]) && section.isDefault
+		if !include {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		b.WriteString(section.render(s))
+	}
+	return b.String()
+}
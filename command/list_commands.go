@@ -3,25 +3,31 @@ package command
 import (
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/liweiyuan/go-redis-server/internal/errs"
 	"github.com/liweiyuan/go-redis-server/resp"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
 func registerListCommands(cr *CommandRegistry) {
-	cr.register("LPUSH", NewLPushCommand)
-	cr.register("RPUSH", NewRPushCommand)
-	cr.register("LPOP", NewLPopCommand)
-	cr.register("RPOP", NewRPopCommand)
-	cr.register("LLEN", NewLLenCommand)
-	cr.register("LINDEX", NewLIndexCommand)
-	cr.register("LSET", NewLSetCommand)
-	cr.register("LREM", NewLRemCommand)
-	cr.register("LPUSHX", NewLPushXCommand)
-	cr.register("RPUSHX", NewRPushXCommand)
-	cr.register("LINSERT", NewLInsertCommand)
-	cr.register("LRANGE", NewLRangeCommand)
-	cr.register("LTRIM", NewLTrimCommand)
+	cr.register([]CommandSpec{
+		{Name: "LPUSH", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLPushCommand},
+		{Name: "RPUSH", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewRPushCommand},
+		{Name: "LPOP", MinArgs: 1, MaxArgs: 1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLPopCommand},
+		{Name: "RPOP", MinArgs: 1, MaxArgs: 1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewRPopCommand},
+		{Name: "BLPOP", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Categories: []string{"@list"}, New: NewBLPopCommand},
+		{Name: "BRPOP", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Categories: []string{"@list"}, New: NewBRPopCommand},
+		{Name: "LLEN", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLLenCommand},
+		{Name: "LINDEX", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLIndexCommand},
+		{Name: "LSET", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLSetCommand},
+		{Name: "LREM", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLRemCommand},
+		{Name: "LPUSHX", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLPushXCommand},
+		{Name: "RPUSHX", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewRPushXCommand},
+		{Name: "LINSERT", MinArgs: 4, MaxArgs: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLInsertCommand},
+		{Name: "LRANGE", MinArgs: 3, MaxArgs: 3, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLRangeCommand},
+		{Name: "LTRIM", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@list"}, New: NewLTrimCommand},
+	})
 }
 
 // LPushCommand implements the LPUSH command.
@@ -32,16 +38,9 @@ type LPushCommand struct {
 
 // NewLPushCommand creates a new LPushCommand.
 func NewLPushCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lpush' command")
-	}
-
 	key := args[0].Str
 	values := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR LPUSH arguments must be bulk strings")
-		}
 		values[i] = arg.Str
 	}
 	return &LPushCommand{key: key, values: values}, nil
@@ -51,9 +50,9 @@ func NewLPushCommand(args []resp.RespValue) (Command, error) {
 func (c *LPushCommand) Apply(s *storage.Storage) resp.RespValue {
 	length, err := s.LPush(c.key, c.values...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(length)
+	return replyInteger(length)
 }
 
 // RPushCommand implements the RPUSH command.
@@ -64,16 +63,9 @@ type RPushCommand struct {
 
 // NewRPushCommand creates a new RPushCommand.
 func NewRPushCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'rpush' command")
-	}
-
 	key := args[0].Str
 	values := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR RPUSH arguments must be bulk strings")
-		}
 		values[i] = arg.Str
 	}
 	return &RPushCommand{key: key, values: values}, nil
@@ -83,9 +75,9 @@ func NewRPushCommand(args []resp.RespValue) (Command, error) {
 func (c *RPushCommand) Apply(s *storage.Storage) resp.RespValue {
 	length, err := s.RPush(c.key, c.values...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(length)
+	return replyInteger(length)
 }
 
 // LPopCommand implements the LPOP command.
@@ -95,27 +87,16 @@ type LPopCommand struct {
 
 // NewLPopCommand creates a new LPopCommand.
 func NewLPopCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lpop' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LPOP argument must be a bulk string")
-	}
-
 	return &LPopCommand{key: args[0].Str}, nil
 }
 
 // Apply executes the LPOP command.
 func (c *LPopCommand) Apply(s *storage.Storage) resp.RespValue {
-	val, err := s.LPop(c.key)
+	val, found, err := s.LPop(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	if val == "" {
-		return resp.NewBulk("") // Return null bulk string if no element
-	}
-	return resp.NewBulk(val)
+	return replyBulkOrNil(val, found)
 }
 
 // RPopCommand implements the RPOP command.
@@ -125,27 +106,90 @@ type RPopCommand struct {
 
 // NewRPopCommand creates a new RPopCommand.
 func NewRPopCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'rpop' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR RPOP argument must be a bulk string")
-	}
-
 	return &RPopCommand{key: args[0].Str}, nil
 }
 
 // Apply executes the RPOP command.
 func (c *RPopCommand) Apply(s *storage.Storage) resp.RespValue {
-	val, err := s.RPop(c.key)
+	val, found, err := s.RPop(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	if val == "" {
-		return resp.NewBulk("") // Return null bulk string if no element
+	return replyBulkOrNil(val, found)
+}
+
+// BPopCommand implements the BLPOP and BRPOP commands.
+type BPopCommand struct {
+	keys    []string
+	timeout time.Duration // Zero for no timeout
+	left    bool          // BLPOP rather than BRPOP
+}
+
+// NewBLPopCommand creates a new BPopCommand for BLPOP.
+func NewBLPopCommand(args []resp.RespValue) (Command, error) {
+	return newBPopCommand(args, true)
+}
+
+// NewBRPopCommand creates a new BPopCommand for BRPOP.
+func NewBRPopCommand(args []resp.RespValue) (Command, error) {
+	return newBPopCommand(args, false)
+}
+
+func newBPopCommand(args []resp.RespValue, left bool) (Command, error) {
+	timeout, err := parseTimeout(args[len(args)-1].Str)
+	if err != nil {
+		return nil, err
+	}
+	c := &BPopCommand{timeout: timeout, left: left}
+	seen := make(map[string]bool, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		if !seen[arg.Str] {
+			seen[arg.Str] = true
+			c.keys = append(c.keys, arg.Str)
+		}
+	}
+	return c, nil
+}
+
+// Apply executes the command without blocking, as a script does: it pops
+// from the first non-empty list, or replies with a null array.
+func (c *BPopCommand) Apply(s *storage.Storage) resp.RespValue {
+	for _, key := range c.keys {
+		if err := c.checkKey(s, key); err != nil {
+			return replyError(err)
+		}
+		if result, ok := c.serve(s, key); ok {
+			return result
+		}
 	}
-	return resp.NewBulk(val)
+	return resp.NewNullArray()
+}
+
+func (c *BPopCommand) blockingKeys() []string {
+	return c.keys
+}
+
+func (c *BPopCommand) blockTimeout() time.Duration {
+	return c.timeout
+}
+
+// serve pops an element of the list at key, replying with the key and the
+// element.
+func (c *BPopCommand) serve(s *storage.Storage, key string) (resp.RespValue, bool) {
+	pop := s.RPop
+	if c.left {
+		pop = s.LPop
+	}
+	val, found, err := pop(key)
+	if err != nil || !found {
+		return resp.RespValue{}, false
+	}
+	return replyBulkArray([]string{key, val}), true
+}
+
+func (c *BPopCommand) checkKey(s *storage.Storage, key string) error {
+	_, err := s.LLen(key)
+	return err
 }
 
 // LLenCommand implements the LLEN command.
@@ -155,14 +199,6 @@ type LLenCommand struct {
 
 // NewLLenCommand creates a new LLenCommand.
 func NewLLenCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'llen' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LLEN argument must be a bulk string")
-	}
-
 	return &LLenCommand{key: args[0].Str}, nil
 }
 
@@ -170,9 +206,9 @@ func NewLLenCommand(args []resp.RespValue) (Command, error) {
 func (c *LLenCommand) Apply(s *storage.Storage) resp.RespValue {
 	length, err := s.LLen(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(length)
+	return replyInteger(length)
 }
 
 // LIndexCommand implements the LINDEX command.
@@ -183,17 +219,9 @@ type LIndexCommand struct {
 
 // NewLIndexCommand creates a new LIndexCommand.
 func NewLIndexCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lindex' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LINDEX arguments must be bulk strings")
-	}
-
 	index, err := strconv.ParseInt(args[1].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 
 	return &LIndexCommand{key: args[0].Str, index: index}, nil
@@ -201,14 +229,11 @@ func NewLIndexCommand(args []resp.RespValue) (Command, error) {
 
 // Apply executes the LINDEX command.
 func (c *LIndexCommand) Apply(s *storage.Storage) resp.RespValue {
-	val, err := s.LIndex(c.key, c.index)
+	val, found, err := s.LIndex(c.key, c.index)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-	if val == "" {
-		return resp.NewBulk("") // Return null bulk string if no element or out of range
+		return replyError(err)
 	}
-	return resp.NewBulk(val)
+	return replyBulkOrNil(val, found)
 }
 
 // LSetCommand implements the LSET command.
@@ -220,17 +245,9 @@ type LSetCommand struct {
 
 // NewLSetCommand creates a new LSetCommand.
 func NewLSetCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lset' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LSET arguments must be bulk strings")
-	}
-
 	index, err := strconv.ParseInt(args[1].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 
 	return &LSetCommand{key: args[0].Str, index: index, value: args[2].Str}, nil
@@ -240,9 +257,9 @@ func NewLSetCommand(args []resp.RespValue) (Command, error) {
 func (c *LSetCommand) Apply(s *storage.Storage) resp.RespValue {
 	err := s.LSet(c.key, c.index, c.value)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewString("OK")
+	return replyOK()
 }
 
 // LRemCommand implements the LREM command.
@@ -254,17 +271,9 @@ type LRemCommand struct {
 
 // NewLRemCommand creates a new LRemCommand.
 func NewLRemCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lrem' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LREM arguments must be bulk strings")
-	}
-
 	count, err := strconv.ParseInt(args[1].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 
 	return &LRemCommand{key: args[0].Str, count: count, value: args[2].Str}, nil
@@ -274,9 +283,9 @@ func NewLRemCommand(args []resp.RespValue) (Command, error) {
 func (c *LRemCommand) Apply(s *storage.Storage) resp.RespValue {
 	removed, err := s.LRem(c.key, c.count, c.value)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(removed)
+	return replyInteger(removed)
 }
 
 // LPushXCommand implements the LPUSHX command.
@@ -287,16 +296,9 @@ type LPushXCommand struct {
 
 // NewLPushXCommand creates a new LPushXCommand.
 func NewLPushXCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lpushx' command")
-	}
-
 	key := args[0].Str
 	values := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR LPUSHX arguments must be bulk strings")
-		}
 		values[i] = arg.Str
 	}
 	return &LPushXCommand{key: key, values: values}, nil
@@ -306,9 +308,9 @@ func NewLPushXCommand(args []resp.RespValue) (Command, error) {
 func (c *LPushXCommand) Apply(s *storage.Storage) resp.RespValue {
 	length, err := s.LPushX(c.key, c.values...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(length)
+	return replyInteger(length)
 }
 
 // RPushXCommand implements the RPUSHX command.
@@ -319,16 +321,9 @@ type RPushXCommand struct {
 
 // NewRPushXCommand creates a new RPushXCommand.
 func NewRPushXCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'rpushx' command")
-	}
-
 	key := args[0].Str
 	values := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR RPUSHX arguments must be bulk strings")
-		}
 		values[i] = arg.Str
 	}
 	return &RPushXCommand{key: key, values: values}, nil
@@ -338,9 +333,9 @@ func NewRPushXCommand(args []resp.RespValue) (Command, error) {
 func (c *RPushXCommand) Apply(s *storage.Storage) resp.RespValue {
 	length, err := s.RPushX(c.key, c.values...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(length)
+	return replyInteger(length)
 }
 
 // LInsertCommand implements the LINSERT command.
@@ -353,17 +348,9 @@ type LInsertCommand struct {
 
 // NewLInsertCommand creates a new LInsertCommand.
 func NewLInsertCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 4 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'linsert' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk || args[3].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LINSERT arguments must be bulk strings")
-	}
-
 	position := strings.ToUpper(args[1].Str)
 	if position != "BEFORE" && position != "AFTER" {
-		return nil, resp.NewError("ERR syntax error")
+		return nil, errs.Syntax
 	}
 
 	return &LInsertCommand{key: args[0].Str, position: position, pivot: args[2].Str, value: args[3].Str}, nil
@@ -373,9 +360,9 @@ func NewLInsertCommand(args []resp.RespValue) (Command, error) {
 func (c *LInsertCommand) Apply(s *storage.Storage) resp.RespValue {
 	length, err := s.LInsert(c.key, c.position, c.pivot, c.value)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(length)
+	return replyInteger(length)
 }
 
 // LRangeCommand implements the LRANGE command.
@@ -387,21 +374,13 @@ type LRangeCommand struct {
 
 // NewLRangeCommand creates a new LRangeCommand.
 func NewLRangeCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'lrange' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LRANGE arguments must be bulk strings")
-	}
-
 	start, err := strconv.ParseInt(args[1].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 	stop, err := strconv.ParseInt(args[2].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 
 	return &LRangeCommand{key: args[0].Str, start: start, stop: stop}, nil
@@ -411,14 +390,9 @@ func NewLRangeCommand(args []resp.RespValue) (Command, error) {
 func (c *LRangeCommand) Apply(s *storage.Storage) resp.RespValue {
 	values, err := s.LRange(c.key, c.start, c.stop)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-
-	respValues := make([]resp.RespValue, len(values))
-	for i, val := range values {
-		respValues[i] = resp.NewBulk(val)
+		return replyError(err)
 	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(values)
 }
 
 // LTrimCommand implements the LTRIM command.
@@ -430,21 +404,13 @@ type LTrimCommand struct {
 
 // NewLTrimCommand creates a new LTrimCommand.
 func NewLTrimCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'ltrim' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR LTRIM arguments must be bulk strings")
-	}
-
 	start, err := strconv.ParseInt(args[1].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 	stop, err := strconv.ParseInt(args[2].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 
 	return &LTrimCommand{key: args[0].Str, start: start, stop: stop}, nil
@@ -454,7 +420,7 @@ func NewLTrimCommand(args []resp.RespValue) (Command, error) {
 func (c *LTrimCommand) Apply(s *storage.Storage) resp.RespValue {
 	err := s.LTrim(c.key, c.start, c.stop)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewString("OK")
+	return replyOK()
 }
\ No newline at end of file
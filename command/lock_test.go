@@ -0,0 +1,97 @@
+package command_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/servertest"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// The lock pattern of redlock and redsync: acquire with SET NX PX, release
+// and extend with scripts that compare the lock token first.
+const (
+	unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+	extendScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+func expectReply(t *testing.T, name string, got, want resp.RespValue) {
+	t.Helper()
+	if got.Type != want.Type || got.Str != want.Str || got.Num != want.Num || got.Null != want.Null {
+		t.Errorf("%s: got %+v, want %+v", name, got, want)
+	}
+}
+
+func TestLockPattern(t *testing.T) {
+	c := servertest.Start(t).Dial(t)
+	key := "lock"
+
+	expectReply(t, "acquire", c.Do("SET", key, "token-a", "NX", "PX", "10000"), resp.NewString("OK"))
+	expectReply(t, "acquire while held", c.Do("SET", key, "token-b", "NX", "PX", "10000"), resp.NewNullBulk())
+	expectReply(t, "unlock with wrong token", c.Do("EVAL", unlockScript, "1", key, "token-b"), resp.NewInteger(0))
+	expectReply(t, "extend with wrong token", c.Do("EVAL", extendScript, "1", key, "token-b", "20000"), resp.NewInteger(0))
+	expectReply(t, "extend", c.Do("EVAL", extendScript, "1", key, "token-a", "20000"), resp.NewInteger(1))
+	if ttl := c.Do("PTTL", key); ttl.Type != resp.Integer || ttl.Num <= 10000 || ttl.Num > 20000 {
+		t.Errorf("ttl after extend: got %+v", ttl)
+	}
+	sha := c.Do("SCRIPT", "LOAD", unlockScript)
+	expectReply(t, "unlock", c.Do("EVALSHA", sha.Str, "1", key, "token-a"), resp.NewInteger(1))
+	expectReply(t, "unlock twice", c.Do("EVALSHA", sha.Str, "1", key, "token-a"), resp.NewInteger(0))
+
+	expectReply(t, "acquire with short ttl", c.Do("SET", key, "token-c", "NX", "PX", "50"), resp.NewString("OK"))
+	time.Sleep(100 * time.Millisecond)
+	expectReply(t, "acquire after expiry", c.Do("SET", key, "token-d", "NX", "PX", "10000"), resp.NewString("OK"))
+	expectReply(t, "unlock after expiry", c.Do("EVAL", unlockScript, "1", key, "token-c"), resp.NewInteger(0))
+}
+
+// TestLockContention has clients repeatedly acquire and release a lock,
+// and checks that no two of them ever hold it at the same time.
+func TestLockContention(t *testing.T) {
+	clients, rounds := 20, 50
+	if testing.Short() {
+		clients, rounds = 5, 20
+	}
+	srv := servertest.Start(t)
+	key := "lock"
+	var holders int32
+	var violations, acquired int64
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		c := srv.Dial(t)
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for n := 0; n < rounds; {
+				token := fmt.Sprintf("%d-%d", id, n)
+				reply := c.Do("SET", key, token, "NX", "PX", "5000")
+				if reply.Type == resp.Error {
+					t.Errorf("SET: %s", reply.Str)
+					return
+				}
+				if reply.Null {
+					continue
+				}
+				if atomic.AddInt32(&holders, 1) != 1 {
+					atomic.AddInt64(&violations, 1)
+				}
+				atomic.AddInt64(&acquired, 1)
+				atomic.AddInt32(&holders, -1)
+				if reply := c.Do("EVAL", unlockScript, "1", key, token); reply.Type != resp.Integer || reply.Num != 1 {
+					t.Errorf("unlock returned %+v", reply)
+					return
+				}
+				n++
+			}
+		}(i)
+	}
+	wg.Wait()
+	if violations > 0 {
+		t.Errorf("lock held by more than one client %d times", violations)
+	}
+	if !t.Failed() && acquired != int64(clients*rounds) {
+		t.Errorf("acquired %d times, want %d", acquired, clients*rounds)
+	}
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"strconv"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// Command names are matched byte by byte, ASCII letters regardless of their
+// case, and no other byte folded: unlike strings.ToUpper or
+// strings.EqualFold, a name with non-ASCII letters, such as "ſet", never
+// matches an ASCII command, and a name that is not valid UTF-8 is compared
+// as it is.
+
+// upperName returns name with its ASCII letters upper-cased. A name without
+// lower-case letters, as most clients send them, is returned as it is,
+// without allocating.
+func upperName(name string) string {
+	for i := 0; i < len(name); i++ {
+		if isLower(name[i]) {
+			b := []byte(name)
+			for j := i; j < len(b); j++ {
+				if isLower(b[j]) {
+					b[j] -= 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return name
+}
+
+// equalName reports whether the names a and b are equal, ASCII letters
+// compared regardless of their case.
+func equalName(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if upperByte(a[i]) != upperByte(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func upperByte(c byte) byte {
+	if isLower(c) {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+// commandName returns the name of the command invoked by argv, or the error
+// of an invocation whose name is not a bulk string, as a RESP3 client may
+// send.
+func commandName(argv []resp.RespValue) (string, error) {
+	name := argv[0]
+	if name.Type != resp.Bulk {
+		return "", errs.Errorf("Protocol error: expected '$', got %s", strconv.QuoteRune(rune(name.Type)))
+	}
+	if name.Null {
+		return "", errs.Errorf("Protocol error: invalid bulk length")
+	}
+	return name.Str, nil
+}
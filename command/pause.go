@@ -0,0 +1,84 @@
+package command
+
+import (
+	"sync"
+	"time"
+)
+
+// pauseState is the CLIENT PAUSE in effect, if any.
+type pauseState struct {
+	mu     sync.Mutex
+	until  time.Time     // End of the pause, zero when not paused
+	all    bool          // All commands are paused, not only those that may write
+	resume chan struct{} // Closed when the pause is lifted early by CLIENT UNPAUSE
+}
+
+// Pause holds back the commands of clients until the end of d: all of them
+// if all is set, or only those that may write otherwise. A pause already in
+// effect is extended if it ends earlier, and kept pausing all commands if
+// it does.
+func (cr *CommandRegistry) Pause(d time.Duration, all bool) {
+	p := &cr.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	until := time.Now().Add(d)
+	if !time.Now().Before(p.until) {
+		p.until, p.all = time.Time{}, false
+	}
+	if until.After(p.until) {
+		p.until = until
+	}
+	p.all = p.all || all
+	if p.resume == nil {
+		p.resume = make(chan struct{})
+	}
+}
+
+// Unpause lifts the pause in effect, letting the commands held back run.
+func (cr *CommandRegistry) Unpause() {
+	p := &cr.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.until, p.all = time.Time{}, false
+	if p.resume != nil {
+		close(p.resume)
+		p.resume = nil
+	}
+}
+
+// paused returns the end of the pause holding back spec, or the zero time
+// if it may run, along with the channel closed if the pause is lifted.
+func (cr *CommandRegistry) paused(spec *CommandSpec) (time.Time, <-chan struct{}) {
+	p := &cr.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !time.Now().Before(p.until) || !(p.all || spec.MayWrite()) {
+		return time.Time{}, nil
+	}
+	return p.until, p.resume
+}
+
+// waitPause waits for the pause holding back spec, if any, to end.
+func (cr *CommandRegistry) waitPause(spec *CommandSpec) {
+	for {
+		until, resume := cr.paused(spec)
+		if until.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(until))
+		select {
+		case <-timer.C:
+		case <-resume:
+			timer.Stop()
+		}
+	}
+}
+
+// writesPaused reports whether a pause holds back writes, during which
+// keys are not expired actively either.
+func (cr *CommandRegistry) writesPaused() bool {
+	p := &cr.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().Before(p.until)
+}
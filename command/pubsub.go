@@ -0,0 +1,229 @@
+package command
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/internal/glob"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// pubsubKind selects between global channels, shard channels and channel
+// patterns, whose subscriptions are kept apart.
+type pubsubKind int
+
+const (
+	globalChannels pubsubKind = iota
+	shardChannels
+	channelPatterns
+)
+
+// pubsubNames holds the names used in the replies and messages of each kind.
+var pubsubNames = [...]struct {
+	subscribe, unsubscribe, message string
+}{
+	globalChannels:  {"subscribe", "unsubscribe", "message"},
+	shardChannels:   {"ssubscribe", "sunsubscribe", "smessage"},
+	channelPatterns: {"psubscribe", "punsubscribe", "pmessage"},
+}
+
+// PubSub holds the channel subscriptions of all clients.
+type PubSub struct {
+	mu   sync.Mutex
+	subs [3]map[string]map[*Client]struct{} // kind -> channel or pattern -> subscribers
+}
+
+func newPubSub() *PubSub {
+	ps := &PubSub{}
+	for i := range ps.subs {
+		ps.subs[i] = make(map[string]map[*Client]struct{})
+	}
+	return ps
+}
+
+// subscribe subscribes the client to channels and returns one confirmation
+// per channel.
+func (ps *PubSub) subscribe(c *Client, kind pubsubKind, channels []string) []resp.RespValue {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	replies := make([]resp.RespValue, 0, len(channels))
+	for _, channel := range channels {
+		subscribers, ok := ps.subs[kind][channel]
+		if !ok {
+			subscribers = make(map[*Client]struct{})
+			ps.subs[kind][channel] = subscribers
+		}
+		subscribers[c] = struct{}{}
+
+		c.mu.Lock()
+		if c.subscriptions[kind] == nil {
+			c.subscriptions[kind] = make(map[string]struct{})
+		}
+		c.subscriptions[kind][channel] = struct{}{}
+		count := c.subscriptionCount(kind)
+		c.mu.Unlock()
+
+		replies = append(replies, c.pubsubReply(pubsubNames[kind].subscribe, resp.NewBulk(channel), count))
+	}
+	return replies
+}
+
+// unsubscribe unsubscribes the client from channels, or from all of its
+// channels if none are given, and returns one confirmation per channel.
+func (ps *PubSub) unsubscribe(c *Client, kind pubsubKind, channels []string) []resp.RespValue {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if len(channels) == 0 {
+		channels = c.subscribed(kind)
+		if len(channels) == 0 {
+			c.mu.Lock()
+			count := c.subscriptionCount(kind)
+			c.mu.Unlock()
+			return []resp.RespValue{c.pubsubReply(pubsubNames[kind].unsubscribe, replyNil(), count)}
+		}
+	}
+	replies := make([]resp.RespValue, 0, len(channels))
+	for _, channel := range channels {
+		if subscribers, ok := ps.subs[kind][channel]; ok {
+			delete(subscribers, c)
+			if len(subscribers) == 0 {
+				delete(ps.subs[kind], channel)
+			}
+		}
+
+		c.mu.Lock()
+		delete(c.subscriptions[kind], channel)
+		count := c.subscriptionCount(kind)
+		c.mu.Unlock()
+
+		replies = append(replies, c.pubsubReply(pubsubNames[kind].unsubscribe, resp.NewBulk(channel), count))
+	}
+	return replies
+}
+
+// Publish sends message to the subscribers of channel, and for global
+// channels to the clients subscribed to a matching pattern. It returns how
+// many messages were delivered.
+func (ps *PubSub) Publish(kind pubsubKind, channel, message string) int {
+	type delivery struct {
+		c       *Client
+		pattern string
+	}
+	ps.mu.Lock()
+	deliveries := make([]delivery, 0, len(ps.subs[kind][channel]))
+	for c := range ps.subs[kind][channel] {
+		deliveries = append(deliveries, delivery{c: c})
+	}
+	if kind == globalChannels {
+		for pattern, subscribers := range ps.subs[channelPatterns] {
+			if !glob.Match(pattern, channel) {
+				continue
+			}
+			for c := range subscribers {
+				deliveries = append(deliveries, delivery{c: c, pattern: pattern})
+			}
+		}
+	}
+	ps.mu.Unlock()
+
+	for _, d := range deliveries {
+		if d.pattern != "" {
+			d.c.Push(d.c.outOfBand([]resp.RespValue{
+				resp.NewBulk(pubsubNames[channelPatterns].message), resp.NewBulk(d.pattern), resp.NewBulk(channel), resp.NewBulk(message),
+			}))
+			continue
+		}
+		d.c.Push(d.c.outOfBand([]resp.RespValue{
+			resp.NewBulk(pubsubNames[kind].message), resp.NewBulk(channel), resp.NewBulk(message),
+		}))
+	}
+	return len(deliveries)
+}
+
+// Disconnect drops all subscriptions of a client that is going away.
+func (ps *PubSub) Disconnect(c *Client) {
+	ps.unsubscribe(c, globalChannels, nil)
+	ps.unsubscribe(c, shardChannels, nil)
+	ps.unsubscribe(c, channelPatterns, nil)
+}
+
+// channels returns the channels of a kind with at least one subscriber
+// that match pattern, or all of them if pattern is empty.
+func (ps *PubSub) channels(kind pubsubKind, pattern string) []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	channels := make([]string, 0, len(ps.subs[kind]))
+	for channel := range ps.subs[kind] {
+		if pattern == "" || glob.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// numSub returns the number of subscribers of a channel.
+func (ps *PubSub) numSub(kind pubsubKind, channel string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.subs[kind][channel])
+}
+
+// numPat returns the number of distinct patterns subscribed to.
+func (ps *PubSub) numPat() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.subs[channelPatterns])
+}
+
+// counts returns the number of channels, patterns and shard channels with
+// at least one subscriber, for INFO.
+func (ps *PubSub) counts() (channels, patterns, shards int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.subs[globalChannels]), len(ps.subs[channelPatterns]), len(ps.subs[shardChannels])
+}
+
+// subscriptionCount returns the subscription count reported in the
+// (un)subscribe confirmations of a kind: shard channels are counted on
+// their own, channels and patterns together. c.mu must be held.
+func (c *Client) subscriptionCount(kind pubsubKind) int {
+	if kind == shardChannels {
+		return len(c.subscriptions[shardChannels])
+	}
+	return len(c.subscriptions[globalChannels]) + len(c.subscriptions[channelPatterns])
+}
+
+// subscribed returns the channels of a kind the client is subscribed to.
+func (c *Client) subscribed(kind pubsubKind) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channels := make([]string, 0, len(c.subscriptions[kind]))
+	for channel := range c.subscriptions[kind] {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// isSubscribed reports whether the client is subscribed to a channel.
+func (c *Client) isSubscribed(kind pubsubKind, channel string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.subscriptions[kind][channel]
+	return ok
+}
+
+// pubsubReply returns a (un)subscribe confirmation.
+func (c *Client) pubsubReply(kind string, channel resp.RespValue, count int) resp.RespValue {
+	return c.outOfBand([]resp.RespValue{resp.NewBulk(kind), channel, replyInteger(int64(count))})
+}
+
+// outOfBand wraps a message that is not the reply to a command: a push
+// message in RESP3 and a plain array in RESP2.
+func (c *Client) outOfBand(vals []resp.RespValue) resp.RespValue {
+	if c.Protocol() >= 3 {
+		return resp.NewPush(vals)
+	}
+	return resp.NewArray(vals)
+}
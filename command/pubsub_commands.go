@@ -0,0 +1,179 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerPubSubCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "SUBSCRIBE", MinArgs: 1, MaxArgs: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale, New: cr.subscribeConstructor(globalChannels)},
+		{Name: "UNSUBSCRIBE", MinArgs: 0, MaxArgs: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale, New: cr.unsubscribeConstructor(globalChannels)},
+		{Name: "PSUBSCRIBE", MinArgs: 1, MaxArgs: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale, New: cr.subscribeConstructor(channelPatterns)},
+		{Name: "PUNSUBSCRIBE", MinArgs: 0, MaxArgs: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale, New: cr.unsubscribeConstructor(channelPatterns)},
+		{Name: "PUBLISH", MinArgs: 2, MaxArgs: 2, Flags: FlagPubSub | FlagLoading | FlagStale | FlagFast | FlagMayReplicate, New: cr.publishConstructor(globalChannels)},
+		{Name: "SSUBSCRIBE", MinArgs: 1, MaxArgs: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale, FirstKey: 1, LastKey: -1, Step: 1, New: cr.subscribeConstructor(shardChannels)},
+		{Name: "SUNSUBSCRIBE", MinArgs: 0, MaxArgs: -1, Flags: FlagPubSub | FlagNoScript | FlagLoading | FlagStale, FirstKey: 1, LastKey: -1, Step: 1, New: cr.unsubscribeConstructor(shardChannels)},
+		{Name: "SPUBLISH", MinArgs: 2, MaxArgs: 2, Flags: FlagPubSub | FlagLoading | FlagStale | FlagFast | FlagMayReplicate, FirstKey: 1, LastKey: 1, Step: 1, New: cr.publishConstructor(shardChannels)},
+		{Name: "PUBSUB", MinArgs: 1, MaxArgs: -1, Flags: FlagPubSub | FlagLoading | FlagStale, Subcommands: cr.pubsubSubcommands()},
+	})
+}
+
+// pubsubSubcommands returns the subcommands of PUBSUB.
+func (cr *CommandRegistry) pubsubSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "CHANNELS", MinArgs: 0, MaxArgs: 1, New: cr.newPubSubCommand("CHANNELS"), Usage: "[<pattern>]", Help: []string{
+			"Return the currently active channels matching a <pattern> (default: '*').",
+		}},
+		{Name: "NUMPAT", MinArgs: 0, MaxArgs: 0, New: cr.newPubSubCommand("NUMPAT"), Help: []string{
+			"Return number of subscriptions to patterns.",
+		}},
+		{Name: "NUMSUB", MinArgs: 0, MaxArgs: -1, New: cr.newPubSubCommand("NUMSUB"), Usage: "[<channel> ...]", Help: []string{
+			"Return the number of subscribers for the specified channels, excluding",
+			"pattern subscriptions(default: no channels).",
+		}},
+		{Name: "SHARDCHANNELS", MinArgs: 0, MaxArgs: 1, New: cr.newPubSubCommand("SHARDCHANNELS"), Usage: "[<pattern>]", Help: []string{
+			"Return the currently active shard level channels matching a <pattern> (default: '*').",
+		}},
+		{Name: "SHARDNUMSUB", MinArgs: 0, MaxArgs: -1, New: cr.newPubSubCommand("SHARDNUMSUB"), Usage: "[<shardchannel> ...]", Help: []string{
+			"Return the number of subscribers for the specified shard level channel(s)",
+		}},
+	}
+}
+
+func bulkStrings(args []resp.RespValue) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.Str
+	}
+	return strs
+}
+
+// SubscribeCommand implements the SUBSCRIBE, SSUBSCRIBE and PSUBSCRIBE
+// commands.
+type SubscribeCommand struct {
+	pubsub   *PubSub
+	kind     pubsubKind
+	channels []string
+}
+
+// subscribeConstructor returns the constructor of SubscribeCommand for
+// channels of the given kind.
+func (cr *CommandRegistry) subscribeConstructor(kind pubsubKind) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &SubscribeCommand{pubsub: cr.pubsub, kind: kind, channels: bulkStrings(args)}, nil
+	}
+}
+
+// Apply is never called for SUBSCRIBE, which needs the calling client.
+func (c *SubscribeCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient(strings.ToUpper(pubsubNames[c.kind].subscribe)))
+}
+
+// ApplyClient executes the SUBSCRIBE command for the calling client.
+func (c *SubscribeCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	return replyMulti(client, c.pubsub.subscribe(client, c.kind, c.channels))
+}
+
+// UnsubscribeCommand implements the UNSUBSCRIBE, SUNSUBSCRIBE and
+// PUNSUBSCRIBE commands.
+type UnsubscribeCommand struct {
+	pubsub   *PubSub
+	kind     pubsubKind
+	channels []string
+}
+
+// unsubscribeConstructor returns the constructor of UnsubscribeCommand for
+// channels of the given kind.
+func (cr *CommandRegistry) unsubscribeConstructor(kind pubsubKind) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &UnsubscribeCommand{pubsub: cr.pubsub, kind: kind, channels: bulkStrings(args)}, nil
+	}
+}
+
+// Apply is never called for UNSUBSCRIBE, which needs the calling client.
+func (c *UnsubscribeCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient(strings.ToUpper(pubsubNames[c.kind].unsubscribe)))
+}
+
+// ApplyClient executes the UNSUBSCRIBE command for the calling client.
+func (c *UnsubscribeCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	return replyMulti(client, c.pubsub.unsubscribe(client, c.kind, c.channels))
+}
+
+// PublishCommand implements the PUBLISH and SPUBLISH commands.
+type PublishCommand struct {
+	pubsub  *PubSub
+	kind    pubsubKind
+	channel string
+	message string
+}
+
+// publishConstructor returns the constructor of PublishCommand for
+// channels of the given kind.
+func (cr *CommandRegistry) publishConstructor(kind pubsubKind) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &PublishCommand{pubsub: cr.pubsub, kind: kind, channel: args[0].Str, message: args[1].Str}, nil
+	}
+}
+
+// Apply executes the PUBLISH command.
+func (c *PublishCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyInteger(int64(c.pubsub.Publish(c.kind, c.channel, c.message)))
+}
+
+// PubSubCommand implements the PUBSUB command.
+type PubSubCommand struct {
+	pubsub     *PubSub
+	subcommand string
+	args       []string
+}
+
+// newPubSubCommand returns the constructor of the PUBSUB subcommand named
+// subcommand, bound to the registry.
+func (cr *CommandRegistry) newPubSubCommand(subcommand string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &PubSubCommand{pubsub: cr.pubsub, subcommand: subcommand, args: bulkStrings(args)}, nil
+	}
+}
+
+// Apply executes the PUBSUB command.
+func (c *PubSubCommand) Apply(s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "CHANNELS", "SHARDCHANNELS":
+		kind := globalChannels
+		if c.subcommand == "SHARDCHANNELS" {
+			kind = shardChannels
+		}
+		pattern := ""
+		if len(c.args) == 1 {
+			pattern = c.args[0]
+		}
+		return replyBulkArray(c.pubsub.channels(kind, pattern))
+	case "NUMPAT":
+		return replyInteger(int64(c.pubsub.numPat()))
+	case "NUMSUB", "SHARDNUMSUB":
+		kind := globalChannels
+		if c.subcommand == "SHARDNUMSUB" {
+			kind = shardChannels
+		}
+		reply := make([]resp.RespValue, 0, 2*len(c.args))
+		for _, channel := range c.args {
+			reply = append(reply, resp.NewBulk(channel), replyInteger(int64(c.pubsub.numSub(kind, channel))))
+		}
+		return resp.NewArray(reply)
+	}
+	return replyError(errs.Syntax)
+}
+
+// replyMulti sends all but the last of replies to the client right away
+// and returns the last one, for commands that reply more than once.
+func replyMulti(client *Client, replies []resp.RespValue) resp.RespValue {
+	for _, reply := range replies[:len(replies)-1] {
+		client.Push(reply)
+	}
+	return replies[len(replies)-1]
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// Reply builders shared by all commands, so nulls, empty arrays, OK and
+// integer replies are encoded the same way everywhere.
+
+// replyOK returns the +OK status reply.
+func replyOK() resp.RespValue {
+	return resp.NewString("OK")
+}
+
+// replyNil returns the null bulk string reply.
+func replyNil() resp.RespValue {
+	return resp.NewNullBulk()
+}
+
+// replyInteger returns an integer reply.
+func replyInteger(n int64) resp.RespValue {
+	return resp.NewInteger(n)
+}
+
+// replyError returns an error reply carrying the message of err, with the
+// ERR code if it has none.
+func replyError(err error) resp.RespValue {
+	return resp.NewError(errs.Reply(err))
+}
+
+// replyBulkOrNil returns a bulk string reply if found is true, and a null
+// bulk string reply otherwise.
+func replyBulkOrNil(val string, found bool) resp.RespValue {
+	if !found {
+		return replyNil()
+	}
+	return resp.NewBulk(val)
+}
+
+// replyDouble returns a score or other float as a double reply, which
+// RESP2 clients get as a bulk string.
+func replyDouble(f float64) resp.RespValue {
+	return resp.NewDouble(f)
+}
+
+// replyBool returns the answer of a predicate as a boolean reply, which
+// RESP2 clients get as the integer 1 or 0.
+func replyBool(b bool) resp.RespValue {
+	return resp.NewBoolean(b)
+}
+
+// replyIntegerOrNil returns an integer reply if found is true, and a null
+// bulk string reply otherwise.
+func replyIntegerOrNil(n int64, found bool) resp.RespValue {
+	if !found {
+		return replyNil()
+	}
+	return resp.NewInteger(n)
+}
+
+// replyBulkArray returns an array reply of bulk strings. A nil or empty
+// slice yields an empty array, never a null one.
+func replyBulkArray(vals []string) resp.RespValue {
+	return resp.NewBulkArray(vals)
+}
@@ -0,0 +1,198 @@
+package command_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/internal/servertest"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// scanTypes are the types of the stable keys, with the command creating one.
+var scanTypes = []struct {
+	name   string
+	create func(key string) []string
+}{
+	{"string", func(key string) []string { return []string{"SET", key, "v"} }},
+	{"list", func(key string) []string { return []string{"RPUSH", key, "a", "b"} }},
+	{"set", func(key string) []string { return []string{"SADD", key, "a", "b"} }},
+	{"hash", func(key string) []string { return []string{"HSET", key, "f", "v"} }},
+	{"zset", func(key string) []string { return []string{"ZADD", key, "1", "a"} }},
+	{"stream", func(key string) []string { return []string{"XADD", key, "*", "f", "v"} }},
+}
+
+// TestScanGuarantees checks the guarantees of SCAN on random keyspaces: a
+// full scan returns every key that exists for its whole duration exactly
+// once, whatever COUNT is and whatever keys are written or deleted
+// meanwhile, and returns no key twice. MATCH and TYPE only filter what the
+// scan returns. Each round draws a new keyspace.
+func TestScanGuarantees(t *testing.T) {
+	rounds, keys := 20, 5000
+	if testing.Short() {
+		rounds, keys = 3, 500
+	}
+	seed := servertest.Seed(t)
+	for round := 0; round < rounds; round++ {
+		rnd := rand.New(rand.NewSource(seed + int64(round)))
+		srv := servertest.Start(t)
+		stable := populate(srv, rnd, rnd.Intn(keys+1))
+		count := strconv.Itoa(1 + rnd.Intn(200))
+
+		seen, err := scan(srv, "COUNT", count)
+		if err == nil {
+			err = exactlyOnce(seen, stable, nil)
+		}
+		if err != nil {
+			t.Errorf("round %d: %d keys, COUNT %s: %v", round, len(stable), count, err)
+		}
+
+		pattern := fmt.Sprintf("k%d*", rnd.Intn(10))
+		seen, err = scan(srv, "MATCH", pattern, "COUNT", count)
+		if err == nil {
+			err = exactlyOnce(seen, filter(stable, func(key, _ string) bool { return matchPrefix(key, pattern) }), nil)
+		}
+		if err != nil {
+			t.Errorf("round %d: MATCH %s: %v", round, pattern, err)
+		}
+
+		typ := scanTypes[rnd.Intn(len(scanTypes))].name
+		seen, err = scan(srv, "TYPE", typ, "COUNT", count)
+		if err == nil {
+			err = exactlyOnce(seen, filter(stable, func(_, t string) bool { return t == typ }), nil)
+		}
+		if err != nil {
+			t.Errorf("round %d: TYPE %s: %v", round, typ, err)
+		}
+
+		seen, churned, err := scanWhileChurning(srv, rnd, count)
+		if err == nil {
+			err = exactlyOnce(seen, stable, churned)
+		}
+		if err != nil {
+			t.Errorf("round %d: writes during the scan: %v", round, err)
+		}
+	}
+}
+
+// scan runs a full scan with the given options and returns how many times
+// each key was returned.
+func scan(srv *servertest.Server, opts ...string) (map[string]int, error) {
+	seen := make(map[string]int)
+	cursor := "0"
+	for calls := 0; ; calls++ {
+		if calls > 1_000_000 {
+			return nil, fmt.Errorf("scan did not end")
+		}
+		reply := srv.Exec(nil, append([]string{"SCAN", cursor}, opts...)...)
+		if reply.Type == resp.Error {
+			return nil, fmt.Errorf("SCAN %s: %s", cursor, reply.Str)
+		}
+		if reply.Type != resp.Array || len(reply.Array) != 2 || reply.Array[1].Type != resp.Array {
+			return nil, fmt.Errorf("SCAN %s: unexpected reply %+v", cursor, reply)
+		}
+		for _, key := range reply.Array[1].Elements() {
+			seen[key.Str]++
+		}
+		cursor = reply.Array[0].Str
+		if cursor == "0" {
+			return seen, nil
+		}
+	}
+}
+
+// populate creates n stable keys of random types and returns their types
+// by key.
+func populate(srv *servertest.Server, rnd *rand.Rand, n int) map[string]string {
+	stable := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := "k" + strconv.Itoa(i)
+		if rnd.Intn(10) == 0 {
+			key = fmt.Sprintf("{tag%d}%s", rnd.Intn(5), key)
+		}
+		typ := scanTypes[rnd.Intn(len(scanTypes))]
+		srv.Exec(nil, typ.create(key)...)
+		stable[key] = typ.name
+	}
+	return stable
+}
+
+// scanWhileChurning runs a full scan while other goroutines create and
+// delete keys outside the stable ones, and returns what the scan saw and
+// the keys that were written.
+func scanWhileChurning(srv *servertest.Server, rnd *rand.Rand, count string) (map[string]int, map[string]bool, error) {
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	churned := make([]map[string]bool, 4)
+	for w := range churned {
+		churned[w] = make(map[string]bool)
+		wg.Add(1)
+		go func(w int, seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for !stop.Load() {
+				key := fmt.Sprintf("churn%d:%d", w, r.Intn(2000))
+				churned[w][key] = true
+				switch r.Intn(3) {
+				case 0:
+					srv.Exec(nil, "SET", key, "v")
+				case 1:
+					srv.Exec(nil, "SADD", key, strconv.Itoa(r.Intn(100)))
+				default:
+					srv.Exec(nil, "DEL", key)
+				}
+			}
+		}(w, rnd.Int63())
+	}
+	seen, err := scan(srv, "COUNT", count)
+	stop.Store(true)
+	wg.Wait()
+	all := make(map[string]bool)
+	for _, c := range churned {
+		for key := range c {
+			all[key] = true
+		}
+	}
+	return seen, all, err
+}
+
+// exactlyOnce checks that seen holds each stable key once, and otherwise
+// only keys of other, at most once.
+func exactlyOnce(seen map[string]int, stable map[string]string, other map[string]bool) error {
+	for key := range stable {
+		if seen[key] != 1 {
+			return fmt.Errorf("key %q returned %d times", key, seen[key])
+		}
+	}
+	for key, n := range seen {
+		if _, ok := stable[key]; ok {
+			continue
+		}
+		if !other[key] {
+			return fmt.Errorf("unexpected key %q", key)
+		}
+		if n > 1 {
+			return fmt.Errorf("key %q returned %d times", key, n)
+		}
+	}
+	return nil
+}
+
+func filter(stable map[string]string, keep func(key, typ string) bool) map[string]string {
+	kept := make(map[string]string)
+	for key, typ := range stable {
+		if keep(key, typ) {
+			kept[key] = typ
+		}
+	}
+	return kept
+}
+
+// matchPrefix reports whether key matches pattern, a prefix followed by *.
+func matchPrefix(key, pattern string) bool {
+	prefix := pattern[:len(pattern)-1]
+	return len(key) >= len(prefix) && key[:len(prefix)] == prefix
+}
@@ -0,0 +1,240 @@
+package command
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/scripting"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerScriptCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "EVAL", MinArgs: 2, MaxArgs: -1, Flags: FlagNoScript | FlagMayReplicate | FlagStale | FlagMovableKeys, Categories: []string{"@scripting"}, KeysFunc: evalKeys, New: cr.evalConstructor(false, false)},
+		{Name: "EVALSHA", MinArgs: 2, MaxArgs: -1, Flags: FlagNoScript | FlagMayReplicate | FlagStale | FlagMovableKeys, Categories: []string{"@scripting"}, KeysFunc: evalKeys, New: cr.evalConstructor(true, false)},
+		{Name: "EVAL_RO", MinArgs: 2, MaxArgs: -1, Flags: FlagReadOnly | FlagNoScript | FlagStale | FlagMovableKeys, Categories: []string{"@scripting"}, KeysFunc: evalKeys, New: cr.evalConstructor(false, true)},
+		{Name: "EVALSHA_RO", MinArgs: 2, MaxArgs: -1, Flags: FlagReadOnly | FlagNoScript | FlagStale | FlagMovableKeys, Categories: []string{"@scripting"}, KeysFunc: evalKeys, New: cr.evalConstructor(true, true)},
+		{Name: "SCRIPT", MinArgs: 1, MaxArgs: -1, Flags: FlagNoScript | FlagMayReplicate, Categories: []string{"@scripting"}, Subcommands: cr.scriptSubcommands()},
+	})
+}
+
+// scriptSubcommands returns the subcommands of SCRIPT. Those that do not
+// change the script cache are not held back by CLIENT PAUSE WRITE.
+func (cr *CommandRegistry) scriptSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "EXISTS", MinArgs: 1, MaxArgs: -1, Flags: FlagNoScript, New: cr.newScriptCommand("EXISTS"), Usage: "<sha1> [<sha1> ...]", Help: []string{
+			"Return information about the existence of the scripts in the script cache.",
+		}},
+		{Name: "FLUSH", MinArgs: 0, MaxArgs: 1, New: cr.newScriptFlushCommand, Usage: "[ASYNC|SYNC]", Help: []string{
+			"Flush the Lua scripts cache. Valid modes are:",
+			"* ASYNC: Asynchronously flush the scripts cache.",
+			"* SYNC: Synchronously flush the scripts cache.",
+		}},
+		{Name: "KILL", MinArgs: 0, MaxArgs: 0, Flags: FlagNoScript, New: cr.newScriptCommand("KILL"), Help: []string{
+			"Kill the currently executing Lua script.",
+		}},
+		{Name: "LOAD", MinArgs: 1, MaxArgs: 1, New: cr.newScriptCommand("LOAD"), Usage: "<script>", Help: []string{
+			"Load a script into the scripts cache without executing it.",
+		}},
+	}
+}
+
+// parseNumKeys parses the numkeys argument of EVAL given the number of
+// arguments that follow it.
+func parseNumKeys(arg string, rest int) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, errs.NotInteger
+	}
+	if n < 0 {
+		return 0, errs.Errorf("Number of keys can't be negative")
+	}
+	if n > rest {
+		return 0, errs.Errorf("Number of keys can't be greater than number of args")
+	}
+	return n, nil
+}
+
+// evalKeys returns the key positions of an EVAL invocation, which are given
+// by its numkeys argument.
+func evalKeys(argv []resp.RespValue) []int {
+	n, err := parseNumKeys(argv[2].Str, len(argv)-3)
+	if err != nil {
+		return nil
+	}
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = 3 + i
+	}
+	return positions
+}
+
+// EvalCommand implements the EVAL, EVALSHA, EVAL_RO and EVALSHA_RO
+// commands. Scripts are exclusive: no other command runs while a script
+// does.
+type EvalCommand struct {
+	registry *CommandRegistry
+	script   string // Script body, or its SHA1 digest for EVALSHA
+	bySHA    bool
+	readOnly bool
+	keys     []string
+	argv     []string
+}
+
+// evalConstructor returns the constructor of EvalCommand for scripts given
+// by body or by SHA1 digest, that may or may not write.
+func (cr *CommandRegistry) evalConstructor(bySHA, readOnly bool) func([]resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		n, err := parseNumKeys(args[1].Str, len(args)-2)
+		if err != nil {
+			return nil, err
+		}
+		return &EvalCommand{
+			registry: cr,
+			script:   args[0].Str,
+			bySHA:    bySHA,
+			readOnly: readOnly,
+			keys:     bulkStrings(args[2 : 2+n]),
+			argv:     bulkStrings(args[2+n:]),
+		}, nil
+	}
+}
+
+func (c *EvalCommand) exclusive() {}
+
+// Apply is never called for EVAL, which needs the calling client.
+func (c *EvalCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("EVAL"))
+}
+
+// ApplyClient executes the EVAL command for the calling client.
+func (c *EvalCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	sha := c.script
+	if !c.bySHA {
+		var err error
+		if sha, err = c.registry.scripts.Load(c.script); err != nil {
+			return replyError(err)
+		}
+	}
+	return c.registry.runScript(client, s, false, c.readOnly, func(ctx context.Context, call scripting.CallFunc) (resp.RespValue, error) {
+		return c.registry.scripts.Run(ctx, sha, c.keys, c.argv, call)
+	})
+}
+
+// scriptCall returns the executor of the commands the script rs run by
+// client calls. The commands are not subject to the exclusive lock, which
+// the script already holds. The commands reproducing its writes are
+// appended to its effects, for the append only file.
+func (cr *CommandRegistry) scriptCall(client *Client, s *storage.Storage, rs *runningScript) scripting.CallFunc {
+	return func(args []string) resp.RespValue {
+		argv := make([]resp.RespValue, len(args))
+		for i, arg := range args {
+			argv[i] = resp.NewBulk(arg)
+		}
+		spec, ok := cr.LookupArgv(argv)
+		if !ok {
+			return replyError(errs.Errorf("Unknown Redis command called from script"))
+		}
+		if spec.HasFlag(FlagNoScript) {
+			return replyError(errs.Errorf("This Redis command is not allowed from script"))
+		}
+		if rs.readOnly && spec.HasFlag(FlagWrite) {
+			return replyError(errs.Errorf("Write commands are not allowed from read-only scripts."))
+		}
+		if spec.HasFlag(FlagWrite) && !rs.markWrite() {
+			if rs.function {
+				return replyError(scripting.ErrFunctionKilled)
+			}
+			return replyError(scripting.ErrScriptKilled)
+		}
+
+		cmd, err := cr.ParseCommand(resp.NewArray(argv))
+		if err != nil {
+			cr.stats.RecordRejected(spec.FullName())
+			return replyError(err)
+		}
+		start := time.Now()
+		result := apply(client, cmd, s)
+		cr.stats.Record(spec.FullName(), time.Since(start), result.Type == resp.Error)
+
+		if spec.HasFlag(FlagWrite) {
+			if result.Type != resp.Error {
+				keys, _ := cr.GetKeys(argv)
+				cr.tracking.Invalidate(client, keys)
+			}
+			// The writes are logged rather than the script, which may
+			// not do the same when run again.
+			if cr.aof != nil {
+				rs.effects = append(rs.effects, commandEffects(spec, args, cmd, result)...)
+			}
+		} else if spec.HasFlag(FlagReadOnly) {
+			keys, _ := cr.GetKeys(argv)
+			cr.tracking.Read(client, keys)
+		}
+		return result
+	}
+}
+
+// ScriptCommand implements the SCRIPT command.
+type ScriptCommand struct {
+	registry   *CommandRegistry
+	subcommand string
+	args       []string
+}
+
+// newScriptCommand returns the constructor of the SCRIPT subcommand named
+// subcommand, whose arguments need no parsing, bound to the registry.
+func (cr *CommandRegistry) newScriptCommand(subcommand string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &ScriptCommand{registry: cr, subcommand: subcommand, args: bulkStrings(args)}, nil
+	}
+}
+
+// newScriptFlushCommand creates a new SCRIPT FLUSH command.
+func (cr *CommandRegistry) newScriptFlushCommand(args []resp.RespValue) (Command, error) {
+	if len(args) == 1 && !strings.EqualFold(args[0].Str, "SYNC") && !strings.EqualFold(args[0].Str, "ASYNC") {
+		return nil, errs.Errorf("SCRIPT FLUSH only support SYNC|ASYNC option")
+	}
+	return &ScriptCommand{registry: cr, subcommand: "FLUSH", args: bulkStrings(args)}, nil
+}
+
+// allowBusy lets SCRIPT KILL run while a script does.
+func (c *ScriptCommand) allowBusy() bool {
+	return c.subcommand == "KILL"
+}
+
+// Apply executes the SCRIPT command.
+func (c *ScriptCommand) Apply(s *storage.Storage) resp.RespValue {
+	scripts := c.registry.scripts
+	switch c.subcommand {
+	case "LOAD":
+		sha, err := scripts.Load(c.args[0])
+		if err != nil {
+			return replyError(err)
+		}
+		return resp.NewBulk(sha)
+	case "EXISTS":
+		reply := make([]resp.RespValue, len(c.args))
+		for i, sha := range c.args {
+			exists := int64(0)
+			if scripts.Exists(sha) {
+				exists = 1
+			}
+			reply[i] = replyInteger(exists)
+		}
+		return resp.NewArray(reply)
+	case "KILL":
+		if err := c.registry.killScript(false); err != nil {
+			return replyError(err)
+		}
+		return replyOK()
+	case "FLUSH":
+		scripts.Flush()
+		return replyOK()
+	}
+	return replyError(errs.Syntax)
+}
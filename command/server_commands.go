@@ -0,0 +1,525 @@
+package command
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/glob"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerServerCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "COMMAND", MinArgs: 0, MaxArgs: -1, Flags: FlagLoading | FlagStale, Categories: []string{"@connection"}, New: cr.newCommandCommand(""), Subcommands: cr.commandSubcommands()},
+		{Name: "SAVE", MinArgs: 0, MaxArgs: 0, Flags: FlagAdmin, New: cr.newSaveCommand},
+		{Name: "BGSAVE", MinArgs: 0, MaxArgs: 0, Flags: FlagAdmin | FlagNoScript, New: cr.newBgsaveCommand},
+		{Name: "SHUTDOWN", MinArgs: 0, MaxArgs: 4, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, New: cr.newShutdownCommand},
+		{Name: "BGREWRITEAOF", MinArgs: 0, MaxArgs: 0, Flags: FlagAdmin | FlagNoScript, New: cr.newBgrewriteaofCommand},
+		{Name: "LASTSAVE", MinArgs: 0, MaxArgs: 0, Flags: FlagLoading | FlagStale | FlagFast, Categories: []string{"@admin", "@dangerous"}, New: cr.newLastSaveCommand},
+		{Name: "DEBUG", MinArgs: 1, MaxArgs: -1, Flags: FlagAdmin | FlagLoading | FlagStale, Subcommands: cr.debugSubcommands()},
+		{Name: "INFO", MinArgs: 0, MaxArgs: -1, Flags: FlagLoading | FlagStale, Categories: []string{"@dangerous"}, New: cr.newInfoCommand},
+		{Name: "ACL", MinArgs: 1, MaxArgs: -1, Flags: FlagNoScript | FlagLoading | FlagStale, Subcommands: cr.aclSubcommands()},
+		{Name: "ROLE", MinArgs: 0, MaxArgs: 0, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast, Categories: []string{"@admin", "@dangerous"}, New: newRoleCommand},
+	})
+}
+
+// InfoCommand implements the INFO command.
+type InfoCommand struct {
+	registry *CommandRegistry
+	sections []string
+}
+
+// newInfoCommand creates a new InfoCommand bound to the registry.
+func (cr *CommandRegistry) newInfoCommand(args []resp.RespValue) (Command, error) {
+	sections := make([]string, len(args))
+	for i, arg := range args {
+		sections[i] = arg.Str
+	}
+	return &InfoCommand{registry: cr, sections: sections}, nil
+}
+
+// Apply executes the INFO command.
+func (c *InfoCommand) Apply(s *storage.Storage) resp.RespValue {
+	return resp.NewVerbatim("txt", c.registry.info(s, c.sections))
+}
+
+// commandSubcommands returns the subcommands of COMMAND, which replies
+// with the details of all the commands when given none.
+func (cr *CommandRegistry) commandSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "COUNT", MinArgs: 0, MaxArgs: 0, New: cr.newCommandCommand("COUNT"), Help: []string{
+			"Return the total number of commands in this Redis server.",
+		}},
+		{Name: "LIST", MinArgs: 0, MaxArgs: 0, New: cr.newCommandCommand("LIST"), Help: []string{
+			"Return a list of all commands in this Redis server.",
+		}},
+		{Name: "INFO", MinArgs: 0, MaxArgs: -1, New: cr.newCommandCommand("INFO"), Usage: "[<command-name> ...]", Help: []string{
+			"Return details about multiple Redis commands.",
+			"If no command names are given, documentation details for all",
+			"commands are returned.",
+		}},
+		{Name: "GETKEYS", MinArgs: 1, MaxArgs: -1, New: cr.newCommandCommand("GETKEYS"), Usage: "<full-command>", Help: []string{
+			"Return the keys from a full Redis command.",
+		}},
+	}
+}
+
+// CommandCommand implements the COMMAND command.
+type CommandCommand struct {
+	registry   *CommandRegistry
+	subcommand string // "" for COMMAND itself
+	args       []string
+	argv       []resp.RespValue
+}
+
+// newCommandCommand returns the constructor of the COMMAND subcommand
+// named subcommand, or of COMMAND itself if it is empty, bound to the
+// registry.
+func (cr *CommandRegistry) newCommandCommand(subcommand string) func(args []resp.RespValue) (Command, error) {
+	return func(args []resp.RespValue) (Command, error) {
+		return &CommandCommand{registry: cr, subcommand: subcommand, args: bulkStrings(args), argv: args}, nil
+	}
+}
+
+// Apply executes the COMMAND command.
+func (c *CommandCommand) Apply(s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "COUNT":
+		return replyInteger(int64(len(c.registry.commands)))
+	case "LIST":
+		specs := c.registry.Specs()
+		names := make([]string, len(specs))
+		for i, spec := range specs {
+			names[i] = strings.ToLower(spec.Name)
+		}
+		return replyBulkArray(names)
+	case "INFO":
+		if len(c.args) == 0 {
+			return c.allInfo()
+		}
+		infos := make([]resp.RespValue, len(c.args))
+		for i, name := range c.args {
+			spec, ok := c.registry.lookupFullName(name)
+			if !ok {
+				infos[i] = resp.NewNullArray()
+				continue
+			}
+			infos[i] = commandInfo(spec)
+		}
+		return resp.NewArray(infos)
+	case "GETKEYS":
+		keys, err := c.registry.GetKeys(c.argv)
+		if err != nil {
+			return replyError(err)
+		}
+		if len(keys) == 0 {
+			return replyError(errs.Errorf("The command has no key arguments"))
+		}
+		return replyBulkArray(keys)
+	default:
+		return c.allInfo()
+	}
+}
+
+func (c *CommandCommand) allInfo() resp.RespValue {
+	specs := c.registry.Specs()
+	infos := make([]resp.RespValue, len(specs))
+	for i, spec := range specs {
+		infos[i] = commandInfo(spec)
+	}
+	return resp.NewArray(infos)
+}
+
+// commandInfo builds the COMMAND INFO reply entry for a spec, with those
+// of its subcommands.
+func commandInfo(spec *CommandSpec) resp.RespValue {
+	subcommands := make([]resp.RespValue, len(spec.Subcommands))
+	for i := range spec.Subcommands {
+		subcommands[i] = commandInfo(&spec.Subcommands[i])
+	}
+	return resp.NewArray([]resp.RespValue{
+		resp.NewBulk(strings.ToLower(spec.FullName())),
+		resp.NewInteger(int64(spec.Arity())),
+		statusArray(spec.Flags.Names()),
+		resp.NewInteger(int64(spec.FirstKey)),
+		resp.NewInteger(int64(spec.LastKey)),
+		resp.NewInteger(int64(spec.Step)),
+		statusArray(spec.ACLCategories()),
+		resp.NewArray([]resp.RespValue{}), // Tips
+		resp.NewArray([]resp.RespValue{}), // Key specifications
+		resp.NewArray(subcommands),
+	})
+}
+
+// statusArray returns an array reply of simple strings.
+func statusArray(vals []string) resp.RespValue {
+	respValues := make([]resp.RespValue, len(vals))
+	for i, val := range vals {
+		respValues[i] = resp.NewString(val)
+	}
+	return resp.NewArray(respValues)
+}
+
+// SaveCommand implements the SAVE command.
+type SaveCommand struct {
+	registry *CommandRegistry
+}
+
+// newSaveCommand creates a new SaveCommand bound to the registry.
+func (cr *CommandRegistry) newSaveCommand(args []resp.RespValue) (Command, error) {
+	return &SaveCommand{registry: cr}, nil
+}
+
+// Apply executes the SAVE command.
+func (c *SaveCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.registry.snapshotter == nil {
+		return replyError(errs.NoPersistence)
+	}
+	if err := c.registry.snapshotter.Save(s); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
+
+// BgsaveCommand implements the BGSAVE command.
+type BgsaveCommand struct {
+	registry *CommandRegistry
+}
+
+// newBgsaveCommand creates a new BgsaveCommand bound to the registry.
+func (cr *CommandRegistry) newBgsaveCommand(args []resp.RespValue) (Command, error) {
+	return &BgsaveCommand{registry: cr}, nil
+}
+
+// BGSAVE runs alone so that the snapshot starts while no write is in
+// progress.
+func (c *BgsaveCommand) exclusive() {}
+
+// Apply executes the BGSAVE command.
+func (c *BgsaveCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.registry.snapshotter == nil {
+		return replyError(errs.NoPersistence)
+	}
+	if err := c.registry.snapshotter.BackgroundSave(s); err != nil {
+		return replyError(err)
+	}
+	return resp.NewString("Background saving started")
+}
+
+// BgrewriteaofCommand implements the BGREWRITEAOF command.
+type BgrewriteaofCommand struct {
+	registry *CommandRegistry
+}
+
+// newBgrewriteaofCommand creates a new BgrewriteaofCommand bound to the
+// registry.
+func (cr *CommandRegistry) newBgrewriteaofCommand(args []resp.RespValue) (Command, error) {
+	return &BgrewriteaofCommand{registry: cr}, nil
+}
+
+// BGREWRITEAOF runs alone so that the rewrite starts while no write is in
+// progress.
+func (c *BgrewriteaofCommand) exclusive() {}
+
+// Apply executes the BGREWRITEAOF command.
+func (c *BgrewriteaofCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.registry.aof == nil {
+		return replyError(errs.Errorf("append only file is not enabled"))
+	}
+	scheduled, err := c.registry.aof.BackgroundRewrite(s)
+	if err != nil {
+		return replyError(err)
+	}
+	if scheduled {
+		return resp.NewString("Background append only file rewriting scheduled")
+	}
+	return resp.NewString("Background append only file rewriting started")
+}
+
+// RoleCommand implements the ROLE command. The server does not replicate,
+// so it is always a master without replicas.
+type RoleCommand struct{}
+
+func newRoleCommand(args []resp.RespValue) (Command, error) {
+	return &RoleCommand{}, nil
+}
+
+// Apply executes the ROLE command.
+func (c *RoleCommand) Apply(s *storage.Storage) resp.RespValue {
+	return resp.NewArray([]resp.RespValue{resp.NewBulk("master"), replyInteger(0), resp.NewArray([]resp.RespValue{})})
+}
+
+// aclSubcommands returns the subcommands of ACL.
+func (cr *CommandRegistry) aclSubcommands() []CommandSpec {
+	admin := FlagAdmin | FlagNoScript | FlagLoading | FlagStale
+	return []CommandSpec{
+		{Name: "CAT", MinArgs: 0, MaxArgs: 1, New: cr.newACLCatCommand, Usage: "[<category>]", Help: []string{
+			"List all commands that belong to <category>, or all command categories",
+			"when no category is specified.",
+		}},
+		{Name: "DELUSER", MinArgs: 1, MaxArgs: -1, Flags: admin, New: cr.newACLUserCommand("DELUSER"), Usage: "<username> [<username> ...]", Help: []string{
+			"Delete a list of users.",
+		}},
+		{Name: "GETUSER", MinArgs: 1, MaxArgs: 1, Flags: admin, New: cr.newACLUserCommand("GETUSER"), Usage: "<username>", Help: []string{
+			"Get the user's details.",
+		}},
+		{Name: "LIST", MinArgs: 0, MaxArgs: 0, Flags: admin, New: cr.newACLUserCommand("LIST"), Help: []string{
+			"List all users in ACL format.",
+		}},
+		{Name: "LOAD", MinArgs: 0, MaxArgs: 0, Flags: admin, New: cr.newACLUserCommand("LOAD"), Help: []string{
+			"Reload users from the ACL file.",
+		}},
+		{Name: "SAVE", MinArgs: 0, MaxArgs: 0, Flags: admin, New: cr.newACLUserCommand("SAVE"), Help: []string{
+			"Save the current config to the ACL file.",
+		}},
+		{Name: "SETUSER", MinArgs: 1, MaxArgs: -1, Flags: admin, New: cr.newACLSetUserCommand, Usage: "<username> <attribute> [<attribute> ...]", Help: []string{
+			"Create or modify a user with the specified attributes.",
+		}},
+		{Name: "USERS", MinArgs: 0, MaxArgs: 0, Flags: admin, New: cr.newACLUserCommand("USERS"), Help: []string{
+			"List all usernames.",
+		}},
+		{Name: "WHOAMI", MinArgs: 0, MaxArgs: 0, New: cr.newACLWhoamiCommand, Help: []string{
+			"Return the current connection username.",
+		}},
+	}
+}
+
+// ACLCommand implements the subcommands of ACL describing the commands and
+// the calling connection: CAT lists the ACL categories, or the commands of
+// one, and WHOAMI names the user of the connection. Those managing the
+// users are ACLUserCommand.
+type ACLCommand struct {
+	registry   *CommandRegistry
+	subcommand string
+	category   string // Category listed by CAT, "" for all
+}
+
+// newACLCatCommand creates a new ACL CAT command bound to the registry.
+func (cr *CommandRegistry) newACLCatCommand(args []resp.RespValue) (Command, error) {
+	c := &ACLCommand{registry: cr, subcommand: "CAT"}
+	if len(args) == 1 {
+		c.category = strings.ToLower(args[0].Str)
+	}
+	return c, nil
+}
+
+// newACLWhoamiCommand creates a new ACL WHOAMI command.
+func (cr *CommandRegistry) newACLWhoamiCommand(args []resp.RespValue) (Command, error) {
+	return &ACLCommand{registry: cr, subcommand: "WHOAMI"}, nil
+}
+
+// ApplyClient executes the ACL command for the calling client.
+func (c *ACLCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	if c.subcommand == "WHOAMI" {
+		return resp.NewBulk(client.User())
+	}
+	return c.Apply(s)
+}
+
+// Apply executes the ACL command.
+func (c *ACLCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.subcommand == "WHOAMI" {
+		return resp.NewBulk("default")
+	}
+	// Container commands are listed as their subcommands.
+	categories := map[string][]string{}
+	add := func(spec *CommandSpec) {
+		for _, category := range spec.ACLCategories() {
+			category = strings.TrimPrefix(category, "@")
+			categories[category] = append(categories[category], strings.ToLower(spec.FullName()))
+		}
+	}
+	for _, spec := range c.registry.Specs() {
+		if len(spec.Subcommands) == 0 {
+			add(spec)
+		}
+		for i := range spec.Subcommands {
+			add(&spec.Subcommands[i])
+		}
+	}
+	if c.category == "" {
+		names := make([]string, 0, len(categories))
+		for name := range categories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return replyBulkArray(names)
+	}
+	commands, ok := categories[c.category]
+	if !ok {
+		return replyError(errs.Errorf("Unknown category '%s'", c.category))
+	}
+	return replyBulkArray(commands)
+}
+
+// LastSaveCommand implements the LASTSAVE command.
+type LastSaveCommand struct {
+	registry *CommandRegistry
+}
+
+// newLastSaveCommand creates a new LastSaveCommand bound to the registry.
+func (cr *CommandRegistry) newLastSaveCommand(args []resp.RespValue) (Command, error) {
+	return &LastSaveCommand{registry: cr}, nil
+}
+
+// Apply executes the LASTSAVE command.
+func (c *LastSaveCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.registry.snapshotter == nil {
+		return replyInteger(0)
+	}
+	return replyInteger(c.registry.snapshotter.LastSave().Unix())
+}
+
+// debugSubcommands returns the subcommands of DEBUG.
+func (cr *CommandRegistry) debugSubcommands() []CommandSpec {
+	return []CommandSpec{
+		{Name: "RELOAD", MinArgs: 0, MaxArgs: -1, New: cr.newDebugReloadCommand, Usage: "[NOSAVE] [NOFLUSH]", Help: []string{
+			"Save the dataset on disk and reload it back to memory. With NOSAVE the",
+			"existing snapshot is reloaded, and with NOFLUSH the keys missing from it",
+			"are kept.",
+		}},
+		{Name: "FLUSHALL", MinArgs: 0, MaxArgs: 0, New: cr.newDebugFlushAllCommand, Help: []string{
+			"Remove all the keys, as FLUSHALL does.",
+		}},
+		{Name: "BIGKEYS", MinArgs: 0, MaxArgs: 1, New: cr.newDebugBigKeysCommand, Usage: "[<count>]", Help: []string{
+			"Report the number of keys and the <count> biggest keys of each type",
+			"(default: 1).",
+		}},
+		{Name: "COLDKEYS", MinArgs: 1, MaxArgs: 2, New: cr.newDebugColdKeysCommand, Usage: "<seconds> [<samples>]", Help: []string{
+			"Return the keys not accessed for at least <seconds>, with their idle",
+			"time, among up to <samples> keys (default: 10000).",
+		}},
+		{Name: "STRINGMATCH-LEN", MinArgs: 0, MaxArgs: 0, New: cr.newDebugStringMatchLenCommand, Help: []string{
+			"Run a fuzz tester against the glob-style pattern matcher.",
+		}},
+	}
+}
+
+// DebugCommand implements the DEBUG command.
+type DebugCommand struct {
+	registry   *CommandRegistry
+	subcommand string
+	noSave     bool // DEBUG RELOAD NOSAVE: reload the existing snapshot
+	noFlush    bool // DEBUG RELOAD NOFLUSH: keep keys missing from the snapshot
+	top        int  // DEBUG BIGKEYS: keys to report per type
+	minIdle    int  // DEBUG COLDKEYS: seconds since the last access
+	samples    int  // DEBUG COLDKEYS: keys to sample
+}
+
+// newDebugReloadCommand creates a new DEBUG RELOAD command bound to the
+// registry.
+func (cr *CommandRegistry) newDebugReloadCommand(args []resp.RespValue) (Command, error) {
+	c := &DebugCommand{registry: cr, subcommand: "RELOAD"}
+	for _, arg := range args {
+		switch strings.ToUpper(arg.Str) {
+		case "NOSAVE":
+			c.noSave = true
+		case "NOFLUSH":
+			c.noFlush = true
+		default:
+			return nil, errs.Errorf("DEBUG RELOAD only supports the NOSAVE and NOFLUSH options.")
+		}
+	}
+	return c, nil
+}
+
+// newDebugFlushAllCommand creates a new DEBUG FLUSHALL command bound to the
+// registry.
+func (cr *CommandRegistry) newDebugFlushAllCommand(args []resp.RespValue) (Command, error) {
+	return &DebugCommand{registry: cr, subcommand: "FLUSHALL"}, nil
+}
+
+// newDebugBigKeysCommand creates a new DEBUG BIGKEYS command bound to the
+// registry.
+func (cr *CommandRegistry) newDebugBigKeysCommand(args []resp.RespValue) (Command, error) {
+	c := &DebugCommand{registry: cr, subcommand: "BIGKEYS", top: 1}
+	if len(args) == 1 {
+		top, err := strconv.Atoi(args[0].Str)
+		if err != nil || top < 0 {
+			return nil, errs.NotInteger
+		}
+		c.top = top
+	}
+	return c, nil
+}
+
+// newDebugColdKeysCommand creates a new DEBUG COLDKEYS command bound to the
+// registry.
+func (cr *CommandRegistry) newDebugColdKeysCommand(args []resp.RespValue) (Command, error) {
+	c := &DebugCommand{registry: cr, subcommand: "COLDKEYS", samples: 10000}
+	var err error
+	if c.minIdle, err = strconv.Atoi(args[0].Str); err != nil || c.minIdle < 0 {
+		return nil, errs.NotInteger
+	}
+	if len(args) == 2 {
+		if c.samples, err = strconv.Atoi(args[1].Str); err != nil || c.samples <= 0 {
+			return nil, errs.NotPositive
+		}
+	}
+	return c, nil
+}
+
+// newDebugStringMatchLenCommand creates a new DEBUG STRINGMATCH-LEN command
+// bound to the registry.
+func (cr *CommandRegistry) newDebugStringMatchLenCommand(args []resp.RespValue) (Command, error) {
+	return &DebugCommand{registry: cr, subcommand: "STRINGMATCH-LEN"}, nil
+}
+
+// Apply executes the DEBUG command.
+func (c *DebugCommand) Apply(s *storage.Storage) resp.RespValue {
+	switch c.subcommand {
+	case "RELOAD":
+		return c.reload(s)
+	case "FLUSHALL":
+		s.FlushAll()
+		c.registry.tracking.InvalidateAll()
+		return replyOK()
+	case "BIGKEYS":
+		return resp.NewBulk(s.KeyspaceReport(c.top).String())
+	case "COLDKEYS":
+		// A map of the keys to the seconds since their last access.
+		cold := s.ColdKeys(time.Duration(c.minIdle)*time.Second, c.samples)
+		pairs := make([]resp.RespValue, 0, len(cold)*2)
+		for _, k := range cold {
+			pairs = append(pairs, resp.NewBulk(k.Key), replyInteger(int64(k.Idle/time.Second)))
+		}
+		return resp.NewMap(pairs)
+	case "STRINGMATCH-LEN":
+		// As many cycles as Redis runs would take seconds with the dataset
+		// locked; a tenth of them still reaches the pathological patterns.
+		glob.FuzzTest(rand.New(rand.NewSource(time.Now().UnixNano())), 1000000)
+		return resp.NewString("Apparently Redis did not crash: test passed")
+	}
+	return replyError(errs.Syntax)
+}
+
+// reload saves the dataset and loads it back from the snapshot file.
+func (c *DebugCommand) reload(s *storage.Storage) resp.RespValue {
+	snapshotter := c.registry.snapshotter
+	if snapshotter == nil {
+		return replyError(errs.NoPersistence)
+	}
+	if !c.noSave {
+		if err := snapshotter.Save(s); err != nil {
+			return replyError(errs.Errorf("Error trying to save the DB: %v", err))
+		}
+	}
+	snapshot := s
+	if c.noFlush {
+		// Load into a scratch dataset and merge it into the current one.
+		snapshot = storage.NewStorage()
+	}
+	if err := snapshotter.Load(snapshot); err != nil {
+		return replyError(errs.Errorf("Error trying to load the RDB dump: %v", err))
+	}
+	if c.noFlush {
+		s.Merge(snapshot)
+	}
+	c.registry.tracking.InvalidateAll()
+	return replyOK()
+}
@@ -1,23 +1,27 @@
 package command
 
 import (
+	"math"
 	"strconv"
 
+	"github.com/liweiyuan/go-redis-server/internal/errs"
 	"github.com/liweiyuan/go-redis-server/resp"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
 func registerSetCommands(cr *CommandRegistry) {
-	cr.register("SADD", NewSAddCommand)
-	cr.register("SREM", NewSRemCommand)
-	cr.register("SISMEMBER", NewSIsMemberCommand)
-	cr.register("SCARD", NewSCardCommand)
-	cr.register("SMEMBERS", NewSMembersCommand)
-	cr.register("SPOP", NewSPopCommand)
-	cr.register("SRANDMEMBER", NewSRandMemberCommand)
-	cr.register("SINTER", NewSInterCommand)
-	cr.register("SUNION", NewSUnionCommand)
-	cr.register("SDIFF", NewSDiffCommand)
+	cr.register([]CommandSpec{
+		{Name: "SADD", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSAddCommand},
+		{Name: "SREM", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSRemCommand},
+		{Name: "SISMEMBER", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSIsMemberCommand},
+		{Name: "SCARD", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSCardCommand},
+		{Name: "SMEMBERS", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSMembersCommand},
+		{Name: "SPOP", MinArgs: 1, MaxArgs: 2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSPopCommand},
+		{Name: "SRANDMEMBER", MinArgs: 1, MaxArgs: 2, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@set"}, New: NewSRandMemberCommand},
+		{Name: "SINTER", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@set"}, New: NewSInterCommand},
+		{Name: "SUNION", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@set"}, New: NewSUnionCommand},
+		{Name: "SDIFF", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@set"}, New: NewSDiffCommand},
+	})
 }
 
 // SAddCommand implements the SADD command.
@@ -28,16 +32,9 @@ type SAddCommand struct {
 
 // NewSAddCommand creates a new SAddCommand.
 func NewSAddCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'sadd' command")
-	}
-
 	key := args[0].Str
 	members := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR SADD arguments must be bulk strings")
-		}
 		members[i] = arg.Str
 	}
 	return &SAddCommand{key: key, members: members}, nil
@@ -47,9 +44,9 @@ func NewSAddCommand(args []resp.RespValue) (Command, error) {
 func (c *SAddCommand) Apply(s *storage.Storage) resp.RespValue {
 	count, err := s.SAdd(c.key, c.members...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(count)
 }
 
 // SRemCommand implements the SREM command.
@@ -60,16 +57,9 @@ type SRemCommand struct {
 
 // NewSRemCommand creates a new SRemCommand.
 func NewSRemCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'srem' command")
-	}
-
 	key := args[0].Str
 	members := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR SREM arguments must be bulk strings")
-		}
 		members[i] = arg.Str
 	}
 	return &SRemCommand{key: key, members: members}, nil
@@ -79,9 +69,9 @@ func NewSRemCommand(args []resp.RespValue) (Command, error) {
 func (c *SRemCommand) Apply(s *storage.Storage) resp.RespValue {
 	count, err := s.SRem(c.key, c.members...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(count)
 }
 
 // SIsMemberCommand implements the SISMEMBER command.
@@ -92,14 +82,6 @@ type SIsMemberCommand struct {
 
 // NewSIsMemberCommand creates a new SIsMemberCommand.
 func NewSIsMemberCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'sismember' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR SISMEMBER arguments must be bulk strings")
-	}
-
 	return &SIsMemberCommand{key: args[0].Str, member: args[1].Str}, nil
 }
 
@@ -107,9 +89,9 @@ func NewSIsMemberCommand(args []resp.RespValue) (Command, error) {
 func (c *SIsMemberCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.SIsMember(c.key, c.member)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyBool(val == 1)
 }
 
 // SCardCommand implements the SCARD command.
@@ -119,14 +101,6 @@ type SCardCommand struct {
 
 // NewSCardCommand creates a new SCardCommand.
 func NewSCardCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'scard' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR SCARD argument must be a bulk string")
-	}
-
 	return &SCardCommand{key: args[0].Str}, nil
 }
 
@@ -134,9 +108,9 @@ func NewSCardCommand(args []resp.RespValue) (Command, error) {
 func (c *SCardCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.SCard(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyInteger(val)
 }
 
 // SMembersCommand implements the SMEMBERS command.
@@ -146,14 +120,6 @@ type SMembersCommand struct {
 
 // NewSMembersCommand creates a new SMembersCommand.
 func NewSMembersCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'smembers' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR SMEMBERS argument must be a bulk string")
-	}
-
 	return &SMembersCommand{key: args[0].Str}, nil
 }
 
@@ -161,104 +127,90 @@ func NewSMembersCommand(args []resp.RespValue) (Command, error) {
 func (c *SMembersCommand) Apply(s *storage.Storage) resp.RespValue {
 	members, err := s.SMembers(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
-	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(members)
 }
 
 // SPopCommand implements the SPOP command.
 type SPopCommand struct {
-	key   string
-	count int64
+	key       string
+	count     int64
+	withCount bool // The reply is an array rather than a single member
 }
 
 // NewSPopCommand creates a new SPopCommand.
 func NewSPopCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 1 || len(args) > 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'spop' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR SPOP argument must be a bulk string")
-	}
-
-	count := int64(1) // Default count is 1
+	c := &SPopCommand{key: args[0].Str, count: 1}
 	if len(args) == 2 {
-		if args[1].Type != resp.Bulk {
-			return nil, resp.NewError("ERR SPOP count argument must be an integer")
-		}
-		parsedCount, err := strconv.ParseInt(args[1].Str, 10, 64)
+		count, err := strconv.ParseInt(args[1].Str, 10, 64)
 		if err != nil {
-			return nil, resp.NewError("ERR value is not an integer or out of range")
+			return nil, errs.NotInteger
+		}
+		if count < 0 {
+			return nil, errs.NotPositive
 		}
-		count = parsedCount
+		c.count, c.withCount = count, true
 	}
-
-	return &SPopCommand{key: args[0].Str, count: count}, nil
+	return c, nil
 }
 
-// Apply executes the SPOP command.
+// Apply executes the SPOP command. Without a count, it replies with the
+// popped member, or nil if the set is empty; with one, with an array of
+// the popped members.
 func (c *SPopCommand) Apply(s *storage.Storage) resp.RespValue {
 	members, err := s.SPop(c.key, c.count)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+	if !c.withCount {
+		if len(members) == 0 {
+			return replyNil()
+		}
+		return resp.NewBulk(members[0])
 	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(members)
 }
 
 // SRandMemberCommand implements the SRANDMEMBER command.
 type SRandMemberCommand struct {
-	key   string
-	count int64
+	key       string
+	count     int64
+	withCount bool // The reply is an array rather than a single member
 }
 
 // NewSRandMemberCommand creates a new SRandMemberCommand.
 func NewSRandMemberCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 1 || len(args) > 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'srandmember' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR SRANDMEMBER argument must be a bulk string")
-	}
-
-	count := int64(1) // Default count is 1
+	c := &SRandMemberCommand{key: args[0].Str, count: 1}
 	if len(args) == 2 {
-		if args[1].Type != resp.Bulk {
-			return nil, resp.NewError("ERR SRANDMEMBER count argument must be an integer")
-		}
-		parsedCount, err := strconv.ParseInt(args[1].Str, 10, 64)
+		count, err := strconv.ParseInt(args[1].Str, 10, 64)
 		if err != nil {
-			return nil, resp.NewError("ERR value is not an integer or out of range")
+			return nil, errs.NotInteger
 		}
-		count = parsedCount
+		// As in Redis, so that -count cannot overflow.
+		if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+			return nil, errs.Errorf("value is out of range")
+		}
+		c.count, c.withCount = count, true
 	}
-
-	return &SRandMemberCommand{key: args[0].Str, count: count}, nil
+	return c, nil
 }
 
-// Apply executes the SRANDMEMBER command.
+// Apply executes the SRANDMEMBER command. Without a count, it replies with
+// a random member, or nil if the key does not exist; with one, with an
+// array of members.
 func (c *SRandMemberCommand) Apply(s *storage.Storage) resp.RespValue {
 	members, err := s.SRandMember(c.key, c.count)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+	if !c.withCount {
+		if len(members) == 0 {
+			return replyNil()
+		}
+		return resp.NewBulk(members[0])
 	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(members)
 }
 
 // SInterCommand implements the SINTER command.
@@ -268,15 +220,8 @@ type SInterCommand struct {
 
 // NewSInterCommand creates a new SInterCommand.
 func NewSInterCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'sinter' command")
-	}
-
 	keys := make([]string, len(args))
 	for i, arg := range args {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR SINTER arguments must be bulk strings")
-		}
 		keys[i] = arg.Str
 	}
 	return &SInterCommand{keys: keys}, nil
@@ -286,14 +231,9 @@ func NewSInterCommand(args []resp.RespValue) (Command, error) {
 func (c *SInterCommand) Apply(s *storage.Storage) resp.RespValue {
 	members, err := s.SInter(c.keys...)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+		return replyError(err)
 	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(members)
 }
 
 // SUnionCommand implements the SUNION command.
@@ -303,15 +243,8 @@ type SUnionCommand struct {
 
 // NewSUnionCommand creates a new SUnionCommand.
 func NewSUnionCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'sunion' command")
-	}
-
 	keys := make([]string, len(args))
 	for i, arg := range args {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR SUNION arguments must be bulk strings")
-		}
 		keys[i] = arg.Str
 	}
 	return &SUnionCommand{keys: keys}, nil
@@ -321,14 +254,9 @@ func NewSUnionCommand(args []resp.RespValue) (Command, error) {
 func (c *SUnionCommand) Apply(s *storage.Storage) resp.RespValue {
 	members, err := s.SUnion(c.keys...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
-	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(members)
 }
 
 // SDiffCommand implements the SDIFF command.
@@ -338,15 +266,8 @@ type SDiffCommand struct {
 
 // NewSDiffCommand creates a new SDiffCommand.
 func NewSDiffCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'sdiff' command")
-	}
-
 	keys := make([]string, len(args))
 	for i, arg := range args {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR SDIFF arguments must be bulk strings")
-		}
 		keys[i] = arg.Str
 	}
 	return &SDiffCommand{keys: keys}, nil
@@ -356,12 +277,7 @@ func NewSDiffCommand(args []resp.RespValue) (Command, error) {
 func (c *SDiffCommand) Apply(s *storage.Storage) resp.RespValue {
 	members, err := s.SDiff(c.keys...)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+		return replyError(err)
 	}
-	return resp.NewArray(respValues)
+	return replyBulkArray(members)
 }
\ No newline at end of file
@@ -0,0 +1,182 @@
+package command
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// defaultShutdownTimeout is how long a shutdown waits for the connections
+// to finish their commands, unless SetShutdownTimeout says otherwise.
+const defaultShutdownTimeout = 10 * time.Second
+
+// Drainer stops and resumes the serving of connections, for a shutdown.
+type Drainer interface {
+	// Drain stops accepting connections and closes the open ones, except
+	// that of except, as soon as their command in flight returned and its
+	// reply was written. Requests already read are answered with an error
+	// instead of being executed. Connections still open after grace are
+	// closed anyway.
+	Drain(except *Client, grace time.Duration)
+	// Resume accepts connections again after Drain.
+	Resume()
+}
+
+// ShutdownOptions are the options of SHUTDOWN.
+type ShutdownOptions struct {
+	Save   bool // Save the dataset even without save points
+	NoSave bool // Do not save the dataset, even with save points
+	Now    bool // Close the connections without waiting for their commands
+	Force  bool // Exit even if the dataset could not be saved
+}
+
+// shutdownState is the state of the shutdown of the server.
+type shutdownState struct {
+	drainer Drainer
+	timeout time.Duration
+	pidFile string     // See SetPidFile
+	mu      sync.Mutex // Held by a shutdown in progress
+}
+
+// SetDrainer sets the drainer of the connections of the server, which
+// enables Shutdown.
+func (cr *CommandRegistry) SetDrainer(d Drainer) {
+	cr.shutdown.drainer = d
+}
+
+// SetShutdownTimeout sets how long a shutdown waits for the connections to
+// finish their commands before closing them.
+func (cr *CommandRegistry) SetShutdownTimeout(d time.Duration) {
+	cr.shutdown.timeout = d
+}
+
+// SetPidFile sets the path of the file the process ID was written to,
+// which a shutdown removes.
+func (cr *CommandRegistry) SetPidFile(path string) {
+	cr.shutdown.pidFile = path
+}
+
+// Shutdown shuts the server down, on behalf of client, nil for a signal.
+// The connections are drained first, so commands in flight complete and
+// their replies are written, and then the dataset is saved, unless opts say
+// otherwise, and the append only file synced. The process exits once done.
+// If the dataset cannot be saved, and opts do not force the shutdown, the
+// server accepts connections again and the error is returned.
+//
+// The server has no replicas, so there are none to notify.
+func (cr *CommandRegistry) Shutdown(s *storage.Storage, client *Client, opts ShutdownOptions) error {
+	if cr.shutdown.drainer == nil {
+		return errs.Errorf("SHUTDOWN is not supported by this server")
+	}
+	if !cr.shutdown.mu.TryLock() {
+		return errs.Errorf("SHUTDOWN already in progress")
+	}
+	defer cr.shutdown.mu.Unlock()
+
+	grace := cr.shutdown.timeout
+	if opts.Now {
+		grace = 0
+	}
+	log.Printf("Shutting down, waiting up to %v for the connections to finish their commands...", grace)
+	cr.shutdown.drainer.Drain(client, grace)
+
+	if err := cr.saveOnShutdown(s, opts); err != nil {
+		log.Printf("Error saving the dataset on shutdown: %v", err)
+		if !opts.Force {
+			log.Printf("Errors trying to shut down the server, check the logs for more information")
+			cr.shutdown.drainer.Resume()
+			return errs.Errorf("Errors trying to SHUTDOWN. Check logs.")
+		}
+	}
+	if cr.aof != nil {
+		// Writes wait for the process to exit rather than miss the file.
+		cr.writeMu.Lock()
+		if err := cr.aof.Close(); err != nil {
+			log.Printf("Error syncing the append only file on shutdown: %v", err)
+		}
+	}
+	if cr.shutdown.pidFile != "" {
+		log.Printf("Removing the pid file.")
+		os.Remove(cr.shutdown.pidFile)
+	}
+	log.Printf("Redis is now ready to exit, bye bye...")
+	os.Exit(0)
+	return nil
+}
+
+// saveOnShutdown saves the dataset as a shutdown with opts does: if save
+// points are configured or opts ask for it, and unless opts forbid it. A
+// background save in progress is waited for first.
+func (cr *CommandRegistry) saveOnShutdown(s *storage.Storage, opts ShutdownOptions) error {
+	if opts.NoSave || cr.snapshotter == nil || (!opts.Save && !cr.snapshotter.HasSavePoints()) {
+		return nil
+	}
+	for cr.snapshotter.BackgroundSaving() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Printf("Saving the final snapshot before exiting")
+	return cr.snapshotter.Save(s)
+}
+
+// ShutdownCommand implements the SHUTDOWN command.
+type ShutdownCommand struct {
+	registry *CommandRegistry
+	opts     ShutdownOptions
+	abort    bool
+}
+
+// newShutdownCommand creates a new ShutdownCommand bound to the registry,
+// from the arguments [NOSAVE|SAVE] [NOW] [FORCE] [ABORT].
+func (cr *CommandRegistry) newShutdownCommand(args []resp.RespValue) (Command, error) {
+	c := &ShutdownCommand{registry: cr}
+	for _, arg := range args {
+		switch strings.ToUpper(arg.Str) {
+		case "NOSAVE":
+			c.opts.NoSave = true
+		case "SAVE":
+			c.opts.Save = true
+		case "NOW":
+			c.opts.Now = true
+		case "FORCE":
+			c.opts.Force = true
+		case "ABORT":
+			c.abort = true
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	if (c.opts.Save && c.opts.NoSave) || (c.abort && len(args) > 1) {
+		return nil, errs.Syntax
+	}
+	return c, nil
+}
+
+// allowBusy lets SHUTDOWN NOSAVE run while a script does, as the way to
+// stop a script that can no longer be killed.
+func (c *ShutdownCommand) allowBusy() bool {
+	return c.opts.NoSave
+}
+
+// Apply is never called for SHUTDOWN, which needs the calling client.
+func (c *ShutdownCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyError(errs.NeedsClient("SHUTDOWN"))
+}
+
+// ApplyClient executes the SHUTDOWN command. The process exits on success,
+// so only errors are replied. Connections are not served while a shutdown
+// waits for them, so there is never one to abort.
+func (c *ShutdownCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	if c.abort {
+		return replyError(errs.Errorf("No shutdown in progress."))
+	}
+	if err := c.registry.Shutdown(s, client, c.opts); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
@@ -1,62 +1,104 @@
 package command
 
 import (
+	"math"
 	"strconv"
 	"strings"
 
+	"github.com/liweiyuan/go-redis-server/internal/errs"
 	"github.com/liweiyuan/go-redis-server/resp"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
 func registerSortedSetCommands(cr *CommandRegistry) {
-	cr.register("ZADD", NewZAddCommand)
-	cr.register("ZSCORE", NewZScoreCommand)
-	cr.register("ZREM", NewZRemCommand)
-	cr.register("ZCARD", NewZCardCommand)
-	cr.register("ZRANGE", NewZRangeCommand)
-	cr.register("ZRANGEBYSCORE", NewZRangeByScoreCommand)
-	cr.register("ZCOUNT", NewZCountCommand)
-	cr.register("ZINCRBY", NewZIncrByCommand)
-	cr.register("ZRANK", NewZRankCommand)
-	cr.register("ZREVRANK", NewZRevRankCommand)
-	cr.register("ZREVRANGEBYSCORE", NewZRevRangeByScoreCommand)
-	cr.register("ZREVRANGE", NewZRevRangeCommand)
+	cr.register([]CommandSpec{
+		{Name: "ZADD", MinArgs: 3, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZAddCommand},
+		{Name: "ZSCORE", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZScoreCommand},
+		{Name: "ZREM", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZRemCommand},
+		{Name: "ZCARD", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZCardCommand},
+		{Name: "ZRANGE", MinArgs: 3, MaxArgs: -1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZRangeCommand},
+		{Name: "ZCOUNT", MinArgs: 3, MaxArgs: 3, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZCountCommand},
+		{Name: "ZINCRBY", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZIncrByCommand},
+		{Name: "ZRANK", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZRankCommand},
+		{Name: "ZREVRANK", MinArgs: 2, MaxArgs: 2, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZRevRankCommand},
+		{Name: "ZREMRANGEBYSCORE", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZRemRangeByScoreCommand},
+		{Name: "ZREMRANGEBYRANK", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@sortedset"}, New: NewZRemRangeByRankCommand},
+	})
 }
 
 // ZAddCommand implements the ZADD command.
 type ZAddCommand struct {
 	key     string
+	opts    storage.ZAddOptions
 	members []storage.ZSetMember
 }
 
-// NewZAddCommand creates a new ZAddCommand.
+// NewZAddCommand creates a new ZAddCommand from the arguments
+// key [NX|XX] [GT|LT] [CH] score member [score member ...].
 func NewZAddCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 3 || len(args)%2 == 0 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zadd' command")
+	key := args[0].Str
+	opts, i := parseZAddOptions(args, 1, true)
+	if opts.NX && opts.XX {
+		return nil, errs.Errorf("XX and NX options at the same time are not compatible")
+	}
+	if opts.GT && opts.LT || opts.NX && (opts.GT || opts.LT) {
+		return nil, errs.Errorf("GT, LT, and/or NX options at the same time are not compatible")
 	}
 
-	key := args[0].Str
-	members := make([]storage.ZSetMember, (len(args)-1)/2)
-	for i := 1; i < len(args); i += 2 {
-		if args[i].Type != resp.Bulk || args[i+1].Type != resp.Bulk {
-			return nil, resp.NewError("ERR ZADD arguments must be bulk strings")
-		}
-		score, err := strconv.ParseFloat(args[i].Str, 64)
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return nil, errs.Syntax
+	}
+	members := make([]storage.ZSetMember, len(rest)/2)
+	for j := 0; j < len(rest); j += 2 {
+		score, err := strconv.ParseFloat(rest[j].Str, 64)
 		if err != nil {
-			return nil, resp.NewError("ERR value is not a valid float")
+			return nil, errs.NotFloat
 		}
-		members[(i-1)/2] = storage.ZSetMember{Score: score, Member: args[i+1].Str}
+		members[j/2] = storage.ZSetMember{Score: score, Member: rest[j+1].Str}
 	}
-	return &ZAddCommand{key: key, members: members}, nil
+	return &ZAddCommand{key: key, opts: opts, members: members}, nil
+}
+
+// parseZAddOptions parses the NX, XX and CH options of ZADD and GEOADD
+// from args[i:], along with GT and LT if scores is set, as only ZADD takes
+// them, and returns them with the index of the first argument after them.
+// The caller rejects incompatible options.
+func parseZAddOptions(args []resp.RespValue, i int, scores bool) (storage.ZAddOptions, int) {
+	var opts storage.ZAddOptions
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "CH":
+			opts.CH = true
+		case "GT":
+			if !scores {
+				break loop
+			}
+			opts.GT = true
+		case "LT":
+			if !scores {
+				break loop
+			}
+			opts.LT = true
+		default:
+			break loop
+		}
+	}
+	return opts, i
 }
 
 // Apply executes the ZADD command.
 func (c *ZAddCommand) Apply(s *storage.Storage) resp.RespValue {
-	count, err := s.ZAdd(c.key, c.members...)
+	count, err := s.ZAddWithOptions(c.key, c.opts, c.members...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(count)
 }
 
 // ZScoreCommand implements the ZSCORE command.
@@ -67,14 +109,6 @@ type ZScoreCommand struct {
 
 // NewZScoreCommand creates a new ZScoreCommand.
 func NewZScoreCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zscore' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZSCORE arguments must be bulk strings")
-	}
-
 	return &ZScoreCommand{key: args[0].Str, member: args[1].Str}, nil
 }
 
@@ -82,12 +116,12 @@ func NewZScoreCommand(args []resp.RespValue) (Command, error) {
 func (c *ZScoreCommand) Apply(s *storage.Storage) resp.RespValue {
 	score, found, err := s.ZScore(c.key, c.member)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
 	if !found {
-		return resp.NewBulk("") // Return null bulk string if member not found
+		return replyNil()
 	}
-	return resp.NewBulk(strconv.FormatFloat(score, 'f', -1, 64))
+	return replyDouble(score)
 }
 
 // ZRemCommand implements the ZREM command.
@@ -98,16 +132,9 @@ type ZRemCommand struct {
 
 // NewZRemCommand creates a new ZRemCommand.
 func NewZRemCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrem' command")
-	}
-
 	key := args[0].Str
 	members := make([]string, len(args)-1)
 	for i, arg := range args[1:] {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR ZREM arguments must be bulk strings")
-		}
 		members[i] = arg.Str
 	}
 	return &ZRemCommand{key: key, members: members}, nil
@@ -117,9 +144,9 @@ func NewZRemCommand(args []resp.RespValue) (Command, error) {
 func (c *ZRemCommand) Apply(s *storage.Storage) resp.RespValue {
 	count, err := s.ZRem(c.key, c.members...)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(count)
 }
 
 // ZCardCommand implements the ZCARD command.
@@ -129,14 +156,6 @@ type ZCardCommand struct {
 
 // NewZCardCommand creates a new ZCardCommand.
 func NewZCardCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zcard' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZCARD argument must be a bulk string")
-	}
-
 	return &ZCardCommand{key: args[0].Str}, nil
 }
 
@@ -144,157 +163,150 @@ func NewZCardCommand(args []resp.RespValue) (Command, error) {
 func (c *ZCardCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.ZCard(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyInteger(val)
 }
 
-// ZRangeCommand implements the ZRANGE command.
+// ZRangeCommand implements the ZRANGE command, and through aliases the
+// ZRANGEBYSCORE, ZREVRANGEBYSCORE and ZREVRANGE commands.
 type ZRangeCommand struct {
 	key        string
-	start      int64
+	byScore    bool
+	start      int64 // Ranks, unless byScore
 	stop       int64
+	min        storage.ScoreBound // Scores, with byScore
+	max        storage.ScoreBound
+	rev        bool
+	offset     int64
+	count      int64 // -1 means no limit
 	withScores bool
 }
 
-// NewZRangeCommand creates a new ZRangeCommand.
+// NewZRangeCommand creates a new ZRangeCommand from the arguments
+// key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES].
 func NewZRangeCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 3 || len(args) > 4 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrange' command")
+	c := &ZRangeCommand{key: args[0].Str, count: -1}
+	limit := false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Str) {
+		case "BYSCORE":
+			c.byScore = true
+		case "REV":
+			c.rev = true
+		case "WITHSCORES":
+			c.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, errs.Syntax
+			}
+			var err error
+			if c.offset, err = strconv.ParseInt(args[i+1].Str, 10, 64); err != nil {
+				return nil, errs.NotInteger
+			}
+			if c.count, err = strconv.ParseInt(args[i+2].Str, 10, 64); err != nil {
+				return nil, errs.NotInteger
+			}
+			limit = true
+			i += 2
+		default:
+			return nil, errs.Syntax
+		}
 	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZRANGE arguments must be bulk strings")
+	if limit && !c.byScore {
+		return nil, errs.Errorf("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
 	}
 
-	start, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if !c.byScore {
+		var err error
+		if c.start, err = strconv.ParseInt(args[1].Str, 10, 64); err != nil {
+			return nil, errs.NotInteger
+		}
+		if c.stop, err = strconv.ParseInt(args[2].Str, 10, 64); err != nil {
+			return nil, errs.NotInteger
+		}
+		return c, nil
+	}
+	// With REV, the range goes from the maximum to the minimum.
+	first, err := parseScoreBound(args[1].Str)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, err
 	}
-	stop, err := strconv.ParseInt(args[2].Str, 10, 64)
+	second, err := parseScoreBound(args[2].Str)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, err
 	}
-
-	withScores := false
-	if len(args) == 4 {
-		if strings.ToUpper(args[3].Str) == "WITHSCORES" {
-			withScores = true
-		} else {
-			return nil, resp.NewError("ERR syntax error")
-		}
+	c.min, c.max = first, second
+	if c.rev {
+		c.min, c.max = second, first
 	}
-
-	return &ZRangeCommand{key: args[0].Str, start: start, stop: stop, withScores: withScores}, nil
+	return c, nil
 }
 
-// Apply executes the ZRANGE command.
-func (c *ZRangeCommand) Apply(s *storage.Storage) resp.RespValue {
-	members, err := s.ZRange(c.key, c.start, c.stop, c.withScores)
-	if err != nil {
-		return resp.NewError(err.Error())
+// parseScoreBound parses an end of a score range: a float, -inf or +inf,
+// prefixed with '(' to exclude it.
+func parseScoreBound(arg string) (storage.ScoreBound, error) {
+	var bound storage.ScoreBound
+	if strings.HasPrefix(arg, "(") {
+		bound.Exclusive = true
+		arg = arg[1:]
 	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return bound, errs.NotFloatBound
 	}
-	return resp.NewArray(respValues)
-}
-
-// ZRangeByScoreCommand implements the ZRANGEBYSCORE command.
-type ZRangeByScoreCommand struct {
-	key        string
-	min        float64
-	max        float64
-	offset     int64
-	count      int64
-	withScores bool
+	bound.Score = score
+	return bound, nil
 }
 
-// NewZRangeByScoreCommand creates a new ZRangeByScoreCommand.
-func NewZRangeByScoreCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrangebyscore' command")
-	}
-
-	key := args[0].Str
-	min, err := strconv.ParseFloat(args[1].Str, 64)
-	if err != nil {
-		return nil, resp.NewError("ERR min is not a valid float")
+// Apply executes the ZRANGE command.
+func (c *ZRangeCommand) Apply(s *storage.Storage) resp.RespValue {
+	var members []storage.ZSetMember
+	var err error
+	if c.byScore {
+		members, err = s.ZRangeByScore(c.key, c.min, c.max, c.rev, c.offset, c.count)
+	} else {
+		members, err = s.ZRange(c.key, c.start, c.stop, c.rev)
 	}
-	max, err := strconv.ParseFloat(args[2].Str, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR max is not a valid float")
-	}
-
-	offset := int64(0)
-	count := int64(-1) // -1 means no limit
-	withScores := false
-
-	for i := 3; i < len(args); i++ {
-		switch strings.ToUpper(args[i].Str) {
-		case "WITHSCORES":
-			withScores = true
-		case "LIMIT":
-			if i+2 >= len(args) {
-				return nil, resp.NewError("ERR syntax error")
-			}
-			offset, err = strconv.ParseInt(args[i+1].Str, 10, 64)
-			if err != nil {
-				return nil, resp.NewError("ERR offset is not an integer or out of range")
-			}
-			count, err = strconv.ParseInt(args[i+2].Str, 10, 64)
-			if err != nil {
-				return nil, resp.NewError("ERR count is not an integer or out of range")
-			}
-			i += 2
-		default:
-			return nil, resp.NewError("ERR syntax error")
-		}
+		return replyError(err)
 	}
-
-	return &ZRangeByScoreCommand{key: key, min: min, max: max, offset: offset, count: count, withScores: withScores}, nil
+	return replyMembers(members, c.withScores)
 }
 
-// Apply executes the ZRANGEBYSCORE command.
-func (c *ZRangeByScoreCommand) Apply(s *storage.Storage) resp.RespValue {
-	members, err := s.ZRangeByScore(c.key, c.min, c.max, c.offset, c.count, c.withScores)
-	if err != nil {
-		return resp.NewError(err.Error())
+// replyMembers returns the members of a sorted set as an array reply, each
+// followed by its score as a double if withScores is set.
+func replyMembers(members []storage.ZSetMember, withScores bool) resp.RespValue {
+	if !withScores {
+		names := make([]string, len(members))
+		for i, m := range members {
+			names[i] = m.Member
+		}
+		return replyBulkArray(names)
 	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+	vals := make([]resp.RespValue, 0, 2*len(members))
+	for _, m := range members {
+		vals = append(vals, resp.NewBulk(m.Member), replyDouble(m.Score))
 	}
-	return resp.NewArray(respValues)
+	return resp.NewArray(vals)
 }
 
 // ZCountCommand implements the ZCOUNT command.
 type ZCountCommand struct {
 	key string
-	min float64
-	max float64
+	min storage.ScoreBound
+	max storage.ScoreBound
 }
 
 // NewZCountCommand creates a new ZCountCommand.
 func NewZCountCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zcount' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZCOUNT arguments must be bulk strings")
-	}
-
-	min, err := strconv.ParseFloat(args[1].Str, 64)
+	min, err := parseScoreBound(args[1].Str)
 	if err != nil {
-		return nil, resp.NewError("ERR min is not a valid float")
+		return nil, err
 	}
-	max, err := strconv.ParseFloat(args[2].Str, 64)
+	max, err := parseScoreBound(args[2].Str)
 	if err != nil {
-		return nil, resp.NewError("ERR max is not a valid float")
+		return nil, err
 	}
 
 	return &ZCountCommand{key: args[0].Str, min: min, max: max}, nil
@@ -304,9 +316,9 @@ func NewZCountCommand(args []resp.RespValue) (Command, error) {
 func (c *ZCountCommand) Apply(s *storage.Storage) resp.RespValue {
 	count, err := s.ZCount(c.key, c.min, c.max)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewInteger(count)
+	return replyInteger(count)
 }
 
 // ZIncrByCommand implements the ZINCRBY command.
@@ -318,17 +330,9 @@ type ZIncrByCommand struct {
 
 // NewZIncrByCommand creates a new ZIncrByCommand.
 func NewZIncrByCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zincrby' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZINCRBY arguments must be bulk strings")
-	}
-
 	increment, err := strconv.ParseFloat(args[1].Str, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not a valid float")
+		return nil, errs.NotFloat
 	}
 
 	return &ZIncrByCommand{key: args[0].Str, increment: increment, member: args[2].Str}, nil
@@ -338,9 +342,9 @@ func NewZIncrByCommand(args []resp.RespValue) (Command, error) {
 func (c *ZIncrByCommand) Apply(s *storage.Storage) resp.RespValue {
 	newScore, err := s.ZIncrBy(c.key, c.increment, c.member)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	return resp.NewBulk(strconv.FormatFloat(newScore, 'f', -1, 64))
+	return replyDouble(newScore)
 }
 
 // ZRankCommand implements the ZRANK command.
@@ -351,14 +355,6 @@ type ZRankCommand struct {
 
 // NewZRankCommand creates a new ZRankCommand.
 func NewZRankCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrank' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZRANK arguments must be bulk strings")
-	}
-
 	return &ZRankCommand{key: args[0].Str, member: args[1].Str}, nil
 }
 
@@ -366,12 +362,9 @@ func NewZRankCommand(args []resp.RespValue) (Command, error) {
 func (c *ZRankCommand) Apply(s *storage.Storage) resp.RespValue {
 	rank, found, err := s.ZRank(c.key, c.member)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
 	}
-	if !found {
-		return resp.NewBulk("") // Return null bulk string if member not found
-	}
-	return resp.NewInteger(rank)
+	return replyIntegerOrNil(rank, found)
 }
 
 // ZRevRankCommand implements the ZREVRANK command.
@@ -382,14 +375,6 @@ type ZRevRankCommand struct {
 
 // NewZRevRankCommand creates a new ZRevRankCommand.
 func NewZRevRankCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrevrank' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZREVRANK arguments must be bulk strings")
-	}
-
 	return &ZRevRankCommand{key: args[0].Str, member: args[1].Str}, nil
 }
 
@@ -397,132 +382,65 @@ func NewZRevRankCommand(args []resp.RespValue) (Command, error) {
 func (c *ZRevRankCommand) Apply(s *storage.Storage) resp.RespValue {
 	rank, found, err := s.ZRevRank(c.key, c.member)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-	if !found {
-		return resp.NewBulk("") // Return null bulk string if member not found
+		return replyError(err)
 	}
-	return resp.NewInteger(rank)
+	return replyIntegerOrNil(rank, found)
 }
 
-// ZRevRangeByScoreCommand implements the ZREVRANGEBYSCORE command.
-type ZRevRangeByScoreCommand struct {
-	key        string
-	max        float64
-	min        float64
-	offset     int64
-	count      int64
-	withScores bool
+// ZRemRangeByScoreCommand implements the ZREMRANGEBYSCORE command.
+type ZRemRangeByScoreCommand struct {
+	key string
+	min storage.ScoreBound
+	max storage.ScoreBound
 }
 
-// NewZRevRangeByScoreCommand creates a new ZRevRangeByScoreCommand.
-func NewZRevRangeByScoreCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 3 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrevrangebyscore' command")
-	}
-
-	key := args[0].Str
-	max, err := strconv.ParseFloat(args[1].Str, 64)
+// NewZRemRangeByScoreCommand creates a new ZRemRangeByScoreCommand.
+func NewZRemRangeByScoreCommand(args []resp.RespValue) (Command, error) {
+	min, err := parseScoreBound(args[1].Str)
 	if err != nil {
-		return nil, resp.NewError("ERR max is not a valid float")
+		return nil, err
 	}
-	min, err := strconv.ParseFloat(args[2].Str, 64)
+	max, err := parseScoreBound(args[2].Str)
 	if err != nil {
-		return nil, resp.NewError("ERR min is not a valid float")
-	}
-
-	offset := int64(0)
-	count := int64(-1) // -1 means no limit
-	withScores := false
-
-	for i := 3; i < len(args); i++ {
-		switch strings.ToUpper(args[i].Str) {
-		case "WITHSCORES":
-			withScores = true
-		case "LIMIT":
-			if i+2 >= len(args) {
-				return nil, resp.NewError("ERR syntax error")
-			}
-			offset, err = strconv.ParseInt(args[i+1].Str, 10, 64)
-			if err != nil {
-				return nil, resp.NewError("ERR offset is not an integer or out of range")
-			}
-			count, err = strconv.ParseInt(args[i+2].Str, 10, 64)
-			if err != nil {
-				return nil, resp.NewError("ERR count is not an integer or out of range")
-			}
-			i += 2
-		default:
-			return nil, resp.NewError("ERR syntax error")
-		}
+		return nil, err
 	}
-
-	return &ZRevRangeByScoreCommand{key: key, max: max, min: min, offset: offset, count: count, withScores: withScores}, nil
+	return &ZRemRangeByScoreCommand{key: args[0].Str, min: min, max: max}, nil
 }
 
-// Apply executes the ZREVRANGEBYSCORE command.
-func (c *ZRevRangeByScoreCommand) Apply(s *storage.Storage) resp.RespValue {
-	members, err := s.ZRevRangeByScore(c.key, c.max, c.min, c.offset, c.count, c.withScores)
+// Apply executes the ZREMRANGEBYSCORE command.
+func (c *ZRemRangeByScoreCommand) Apply(s *storage.Storage) resp.RespValue {
+	removed, err := s.ZRemRangeByScore(c.key, c.min, c.max)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+		return replyError(err)
 	}
-	return resp.NewArray(respValues)
+	return replyInteger(removed)
 }
 
-// ZRevRangeCommand implements the ZREVRANGE command.
-type ZRevRangeCommand struct {
-	key        string
-	start      int64
-	stop       int64
-	withScores bool
+// ZRemRangeByRankCommand implements the ZREMRANGEBYRANK command.
+type ZRemRangeByRankCommand struct {
+	key   string
+	start int64
+	stop  int64
 }
 
-// NewZRevRangeCommand creates a new ZRevRangeCommand.
-func NewZRevRangeCommand(args []resp.RespValue) (Command, error) {
-	if len(args) < 3 || len(args) > 4 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'zrevrange' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk || args[2].Type != resp.Bulk {
-		return nil, resp.NewError("ERR ZREVRANGE arguments must be bulk strings")
-	}
-
+// NewZRemRangeByRankCommand creates a new ZRemRangeByRankCommand.
+func NewZRemRangeByRankCommand(args []resp.RespValue) (Command, error) {
 	start, err := strconv.ParseInt(args[1].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
+		return nil, errs.NotInteger
 	}
 	stop, err := strconv.ParseInt(args[2].Str, 10, 64)
 	if err != nil {
-		return nil, resp.NewError("ERR value is not an integer or out of range")
-	}
-
-	withScores := false
-	if len(args) == 4 {
-		if strings.ToUpper(args[3].Str) == "WITHSCORES" {
-			withScores = true
-		} else {
-			return nil, resp.NewError("ERR syntax error")
-		}
+		return nil, errs.NotInteger
 	}
-
-	return &ZRevRangeCommand{key: args[0].Str, start: start, stop: stop, withScores: withScores}, nil
+	return &ZRemRangeByRankCommand{key: args[0].Str, start: start, stop: stop}, nil
 }
 
-// Apply executes the ZREVRANGE command.
-func (c *ZRevRangeCommand) Apply(s *storage.Storage) resp.RespValue {
-	members, err := s.ZRevRange(c.key, c.start, c.stop, c.withScores)
+// Apply executes the ZREMRANGEBYRANK command.
+func (c *ZRemRangeByRankCommand) Apply(s *storage.Storage) resp.RespValue {
+	removed, err := s.ZRemRangeByRank(c.key, c.start, c.stop)
 	if err != nil {
-		return resp.NewError(err.Error())
-	}
-
-	respValues := make([]resp.RespValue, len(members))
-	for i, member := range members {
-		respValues[i] = resp.NewBulk(member)
+		return replyError(err)
 	}
-	return resp.NewArray(respValues)
-}
\ No newline at end of file
+	return replyInteger(removed)
+}
@@ -0,0 +1,165 @@
+package command
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyHistogram is a log-linear histogram of latencies in microseconds.
+// Each power of two is split into 1<<latencySubBits buckets, which bounds
+// the error of a reported percentile to 1/(1<<latencySubBits).
+type latencyHistogram struct {
+	counts [64 << latencySubBits]uint64
+	total  uint64
+}
+
+const latencySubBits = 3
+
+func latencyBucket(usec uint64) int {
+	if usec < 1<<latencySubBits {
+		return int(usec)
+	}
+	exp := bits.Len64(usec) - 1 - latencySubBits
+	sub := usec >> uint(exp) & (1<<latencySubBits - 1)
+	return (exp+1)<<latencySubBits + int(sub)
+}
+
+// latencyBucketMax returns the largest latency that falls in bucket i.
+func latencyBucketMax(i int) uint64 {
+	if i < 1<<latencySubBits {
+		return uint64(i)
+	}
+	exp := i>>latencySubBits - 1
+	sub := uint64(i & (1<<latencySubBits - 1))
+	return (1<<latencySubBits|sub+1)<<uint(exp) - 1
+}
+
+func (h *latencyHistogram) record(usec uint64) {
+	h.counts[latencyBucket(usec)]++
+	h.total++
+}
+
+// percentile returns the latency below which p percent of the samples fall.
+func (h *latencyHistogram) percentile(p float64) uint64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(p / 100 * float64(h.total))
+	if rank == 0 {
+		rank = 1
+	}
+	seen := uint64(0)
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return latencyBucketMax(i)
+		}
+	}
+	return latencyBucketMax(len(h.counts) - 1)
+}
+
+// commandStat holds the statistics of a single command.
+type commandStat struct {
+	calls         int64
+	usec          int64
+	rejectedCalls int64
+	failedCalls   int64
+	latency       latencyHistogram
+}
+
+// CommandStats records per-command call counts and latencies, as reported
+// by INFO commandstats and INFO latencystats.
+type CommandStats struct {
+	mu    sync.Mutex
+	stats map[string]*commandStat
+}
+
+func newCommandStats() *CommandStats {
+	return &CommandStats{stats: make(map[string]*commandStat)}
+}
+
+func (cs *CommandStats) get(name string) *commandStat {
+	name = strings.ToLower(name)
+	stat, ok := cs.stats[name]
+	if !ok {
+		stat = &commandStat{}
+		cs.stats[name] = stat
+	}
+	return stat
+}
+
+// Record records an executed call of the named command. Failed calls are
+// those that replied with an error.
+func (cs *CommandStats) Record(name string, d time.Duration, failed bool) {
+	usec := d.Microseconds()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stat := cs.get(name)
+	stat.calls++
+	stat.usec += usec
+	stat.latency.record(uint64(usec))
+	if failed {
+		stat.failedCalls++
+	}
+}
+
+// RecordRejected records a call of the named command that was rejected
+// before execution, e.g. because of a wrong number of arguments.
+func (cs *CommandStats) RecordRejected(name string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.get(name).rejectedCalls++
+}
+
+// Reset clears all statistics.
+func (cs *CommandStats) Reset() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.stats = make(map[string]*commandStat)
+}
+
+func (cs *CommandStats) sortedNames() []string {
+	names := make([]string, 0, len(cs.stats))
+	for name := range cs.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// infoCommandStats renders the INFO commandstats section.
+func (cs *CommandStats) infoCommandStats() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	var b strings.Builder
+	for _, name := range cs.sortedNames() {
+		stat := cs.stats[name]
+		perCall := 0.0
+		if stat.calls > 0 {
+			perCall = float64(stat.usec) / float64(stat.calls)
+		}
+		fmt.Fprintf(&b, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d\r\n",
+			name, stat.calls, stat.usec, perCall, stat.rejectedCalls, stat.failedCalls)
+	}
+	return b.String()
+}
+
+// infoLatencyStats renders the INFO latencystats section.
+func (cs *CommandStats) infoLatencyStats() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	var b strings.Builder
+	for _, name := range cs.sortedNames() {
+		stat := cs.stats[name]
+		if stat.calls == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "latency_percentiles_usec_%s:p50=%d,p99=%d,p99.9=%d\r\n",
+			name, stat.latency.percentile(50), stat.latency.percentile(99), stat.latency.percentile(99.9))
+	}
+	return b.String()
+}
@@ -0,0 +1,1436 @@
+package command
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func registerStreamCommands(cr *CommandRegistry) {
+	cr.register([]CommandSpec{
+		{Name: "XADD", MinArgs: 4, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXAddCommand},
+		{Name: "XTRIM", MinArgs: 3, MaxArgs: -1, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXTrimCommand},
+		{Name: "XLEN", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXLenCommand},
+		{Name: "XRANGE", MinArgs: 3, MaxArgs: 5, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXRangeCommand},
+		{Name: "XREVRANGE", MinArgs: 3, MaxArgs: 5, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXRevRangeCommand},
+		{Name: "XDEL", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXDelCommand},
+		{Name: "XREAD", MinArgs: 3, MaxArgs: -1, Flags: FlagReadOnly | FlagMovableKeys | FlagBlocking, Categories: []string{"@stream"}, KeysFunc: xreadKeys, New: NewXReadCommand},
+		{Name: "XREADGROUP", MinArgs: 6, MaxArgs: -1, Flags: FlagWrite | FlagMovableKeys | FlagBlocking, Categories: []string{"@stream"}, KeysFunc: xreadKeys, New: NewXReadGroupCommand},
+		{Name: "XACK", MinArgs: 3, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXAckCommand},
+		{Name: "XPENDING", MinArgs: 2, MaxArgs: 7, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXPendingCommand},
+		{Name: "XCLAIM", MinArgs: 5, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXClaimCommand},
+		{Name: "XAUTOCLAIM", MinArgs: 5, MaxArgs: 8, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXAutoClaimCommand},
+		{Name: "XSETID", MinArgs: 2, MaxArgs: 6, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@stream"}, New: NewXSetIDCommand},
+		{Name: "XGROUP", MinArgs: 1, MaxArgs: -1, Flags: FlagWrite, Categories: []string{"@stream"}, Subcommands: xgroupSubcommands},
+		{Name: "XINFO", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, Categories: []string{"@stream"}, Subcommands: xinfoSubcommands},
+	})
+}
+
+// xgroupSubcommands are the subcommands of XGROUP.
+var xgroupSubcommands = []CommandSpec{
+	{Name: "CREATE", MinArgs: 3, MaxArgs: 6, Flags: FlagWrite | FlagDenyOOM, FirstKey: 2, LastKey: 2, Step: 1, New: NewXGroupCreateCommand,
+		Usage: "<key> <groupname> <id|$> [option]", Help: []string{
+			"Create a new consumer group. Options are:",
+			"* MKSTREAM",
+			"  Create the empty stream if it does not exist.",
+			"* ENTRIESREAD entries_read",
+			"  Set the group's entries_read counter (internal use).",
+		}},
+	{Name: "CREATECONSUMER", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 2, LastKey: 2, Step: 1, New: NewXGroupCreateConsumerCommand,
+		Usage: "<key> <groupname> <consumer>", Help: []string{
+			"Create a new consumer in the specified group.",
+		}},
+	{Name: "DELCONSUMER", MinArgs: 3, MaxArgs: 3, FirstKey: 2, LastKey: 2, Step: 1, New: NewXGroupDelConsumerCommand,
+		Usage: "<key> <groupname> <consumer>", Help: []string{
+			"Remove the specified consumer.",
+		}},
+	{Name: "DESTROY", MinArgs: 2, MaxArgs: 2, FirstKey: 2, LastKey: 2, Step: 1, New: NewXGroupDestroyCommand,
+		Usage: "<key> <groupname>", Help: []string{
+			"Remove the specified group.",
+		}},
+	{Name: "SETID", MinArgs: 3, MaxArgs: 5, FirstKey: 2, LastKey: 2, Step: 1, New: NewXGroupSetIDCommand,
+		Usage: "<key> <groupname> <id|$> [ENTRIESREAD entries_read]", Help: []string{
+			"Set the current group ID and entries_read counter.",
+		}},
+}
+
+// xinfoSubcommands are the subcommands of XINFO.
+var xinfoSubcommands = []CommandSpec{
+	{Name: "CONSUMERS", MinArgs: 2, MaxArgs: 2, FirstKey: 2, LastKey: 2, Step: 1, New: NewXInfoConsumersCommand,
+		Usage: "<key> <groupname>", Help: []string{
+			"Show consumers of <groupname>.",
+		}},
+	{Name: "GROUPS", MinArgs: 1, MaxArgs: 1, FirstKey: 2, LastKey: 2, Step: 1, New: NewXInfoGroupsCommand,
+		Usage: "<key>", Help: []string{
+			"Show the stream consumer groups.",
+		}},
+	{Name: "STREAM", MinArgs: 1, MaxArgs: 4, FirstKey: 2, LastKey: 2, Step: 1, New: NewXInfoStreamCommand,
+		Usage: "<key> [FULL [COUNT <count>]", Help: []string{
+			"Show information about the stream.",
+		}},
+}
+
+// xinfoFullCount is the number of entries, and of pending entries of each
+// group and consumer, XINFO STREAM FULL lists unless COUNT says otherwise.
+const xinfoFullCount = 10
+
+// parseStreamID parses an ID argument: <ms>-<seq>, or <ms> standing for
+// <ms>-<seq>, with "-" and "+" standing for the smallest and greatest IDs.
+func parseStreamID(arg string, seq uint64) (storage.StreamID, error) {
+	switch arg {
+	case "-":
+		return storage.StreamID{}, nil
+	case "+":
+		return storage.MaxStreamID, nil
+	}
+	return storage.ParseStreamID(arg, seq)
+}
+
+// parseStreamIDs parses IDs given as <ms>-<seq>, or <ms> standing for
+// <ms>-0.
+func parseStreamIDs(args []resp.RespValue) ([]storage.StreamID, error) {
+	ids := make([]storage.StreamID, len(args))
+	for i, arg := range args {
+		id, err := storage.ParseStreamID(arg.Str, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseEntriesRead parses the argument of the ENTRIESREAD option.
+func parseEntriesRead(arg string) (int64, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errs.NotInteger
+	}
+	if n < -1 {
+		return 0, errs.Errorf("value for ENTRIESREAD must be positive or -1")
+	}
+	return n, nil
+}
+
+// replyStreamEntries returns entries as an array of pairs: the ID of the
+// entry, and its fields and values, null for an entry deleted since it
+// was delivered.
+func replyStreamEntries(entries []storage.StreamEntry) resp.RespValue {
+	items := make([]resp.RespValue, len(entries))
+	for i, e := range entries {
+		items[i] = replyStreamEntry(e)
+	}
+	return resp.NewArray(items)
+}
+
+func replyStreamEntry(e storage.StreamEntry) resp.RespValue {
+	fields := resp.NewNullArray()
+	if e.Fields != nil {
+		fields = replyBulkArray(e.Fields)
+	}
+	return resp.NewArray([]resp.RespValue{resp.NewBulk(e.ID.String()), fields})
+}
+
+// streamTrimArgs are the trimming options of XADD and XTRIM.
+type streamTrimArgs struct {
+	trim       storage.StreamTrim
+	strategy   string // MAXLEN or MINID, empty if neither is given
+	limitGiven bool
+}
+
+// parse parses the trimming option at args[i], if it is one, and returns
+// the number of arguments it takes, 0 if it is not.
+func (t *streamTrimArgs) parse(args []resp.RespValue, i int) (int, error) {
+	opt := strings.ToUpper(args[i].Str)
+	more := len(args) - 1 - i
+	switch {
+	case (opt == "MAXLEN" || opt == "MINID") && more > 0:
+		if t.strategy != "" && t.strategy != opt {
+			return 0, errs.Errorf("syntax error, MAXLEN and MINID options at the same time are not compatible")
+		}
+		t.strategy, t.trim.Approx = opt, false
+		n := 1
+		if op := args[i+1].Str; (op == "~" || op == "=") && more > 1 {
+			t.trim.Approx = op == "~"
+			n++
+		}
+		threshold := args[i+n].Str
+		if opt == "MINID" {
+			id, err := parseStreamID(threshold, 0)
+			if err != nil {
+				return 0, err
+			}
+			t.trim.MinID, t.trim.ByMinID = id, true
+			return n + 1, nil
+		}
+		maxLen, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return 0, errs.NotInteger
+		}
+		if maxLen < 0 {
+			return 0, errs.Errorf("The MAXLEN argument must be >= 0.")
+		}
+		t.trim.MaxLen = maxLen
+		return n + 1, nil
+	case opt == "LIMIT" && more > 0:
+		limit, err := strconv.ParseInt(args[i+1].Str, 10, 64)
+		if err != nil {
+			return 0, errs.NotInteger
+		}
+		if limit < 0 {
+			return 0, errs.Errorf("The LIMIT argument must be >= 0.")
+		}
+		t.trim.Limit, t.limitGiven = limit, true
+		return 2, nil
+	}
+	return 0, nil
+}
+
+// check checks the trimming options once parsed, XTRIM requiring a
+// strategy, and sets the default LIMIT of approximate trimming.
+func (t *streamTrimArgs) check(xadd bool) error {
+	switch {
+	case t.trim.Limit != 0 && t.strategy == "":
+		return errs.Errorf("syntax error, LIMIT cannot be used without specifying a trimming strategy")
+	case !xadd && t.strategy == "":
+		return errs.Errorf("syntax error, XTRIM must be called with a trimming strategy")
+	case t.limitGiven && !t.trim.Approx:
+		return errs.Errorf("syntax error, LIMIT cannot be used without the special ~ option")
+	case t.trim.Approx && !t.limitGiven:
+		t.trim.Limit = storage.DefaultTrimLimit
+	}
+	return nil
+}
+
+// argv returns the trimming options as arguments, with the LIMIT of
+// approximate trimming spelled out, none if no strategy is given.
+func (t *streamTrimArgs) argv() []string {
+	if t.strategy == "" {
+		return nil
+	}
+	threshold := strconv.FormatInt(t.trim.MaxLen, 10)
+	if t.trim.ByMinID {
+		threshold = t.trim.MinID.String()
+	}
+	if !t.trim.Approx {
+		return []string{t.strategy, "=", threshold}
+	}
+	return []string{t.strategy, "~", threshold, "LIMIT", strconv.FormatInt(t.trim.Limit, 10)}
+}
+
+// XAddCommand implements the XADD command.
+type XAddCommand struct {
+	key    string
+	opts   storage.XAddOptions
+	trim   streamTrimArgs
+	fields []string // Fields and values, alternately
+}
+
+// NewXAddCommand creates a new XAddCommand.
+func NewXAddCommand(args []resp.RespValue) (Command, error) {
+	c := &XAddCommand{key: args[0].Str}
+	i := 1
+	for ; i < len(args) && args[i].Str != "*"; i++ {
+		if strings.EqualFold(args[i].Str, "NOMKSTREAM") {
+			c.opts.NoMkStream = true
+			continue
+		}
+		n, err := c.trim.parse(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break // The ID
+		}
+		i += n - 1
+	}
+	if err := c.trim.check(true); err != nil {
+		return nil, err
+	}
+	if c.trim.strategy != "" {
+		c.opts.Trim = &c.trim.trim
+	}
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return nil, errs.WrongArgs("xadd")
+	}
+	switch id := args[i].Str; {
+	case id == "*":
+		c.opts.Auto = true
+	case strings.HasSuffix(id, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(id, "-*"), 10, 64)
+		if err != nil {
+			return nil, errs.InvalidStreamID
+		}
+		c.opts.ID, c.opts.SeqAuto = storage.StreamID{Ms: ms}, true
+	default:
+		parsed, err := storage.ParseStreamID(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.IsZero() && strings.Contains(id, "-") {
+			return nil, errs.Errorf("The ID specified in XADD must be greater than 0-0")
+		}
+		// Without a sequence number, the next one of the millisecond is
+		// taken.
+		c.opts.ID, c.opts.SeqAuto = parsed, !strings.Contains(id, "-")
+	}
+	c.fields = make([]string, len(args)-i-1)
+	for j, arg := range args[i+1:] {
+		c.fields[j] = arg.Str
+	}
+	return c, nil
+}
+
+// Apply executes the XADD command, replying with the ID of the entry
+// added, or null if NOMKSTREAM kept the stream from being created.
+func (c *XAddCommand) Apply(s *storage.Storage) resp.RespValue {
+	id, added, err := s.XAdd(c.key, c.opts, c.fields)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyBulkOrNil(id.String(), added)
+}
+
+// XTrimCommand implements the XTRIM command.
+type XTrimCommand struct {
+	key  string
+	trim streamTrimArgs
+}
+
+// NewXTrimCommand creates a new XTrimCommand.
+func NewXTrimCommand(args []resp.RespValue) (Command, error) {
+	c := &XTrimCommand{key: args[0].Str}
+	for i := 1; i < len(args); i++ {
+		n, err := c.trim.parse(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errs.Syntax
+		}
+		i += n - 1
+	}
+	if err := c.trim.check(false); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Apply executes the XTRIM command, replying with the number of entries
+// evicted.
+func (c *XTrimCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.XTrim(c.key, c.trim.trim)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// XLenCommand implements the XLEN command.
+type XLenCommand struct {
+	key string
+}
+
+// NewXLenCommand creates a new XLenCommand.
+func NewXLenCommand(args []resp.RespValue) (Command, error) {
+	return &XLenCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the XLEN command.
+func (c *XLenCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.XLen(c.key)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// XRangeCommand implements the XRANGE and XREVRANGE commands.
+type XRangeCommand struct {
+	key        string
+	start, end storage.StreamID
+	empty      bool // The interval holds no ID
+	count      int  // -1 for no limit
+	rev        bool
+}
+
+// NewXRangeCommand creates a new XRangeCommand for XRANGE.
+func NewXRangeCommand(args []resp.RespValue) (Command, error) {
+	return newXRangeCommand(args[0].Str, args[1].Str, args[2].Str, args[3:], false)
+}
+
+// NewXRevRangeCommand creates a new XRangeCommand for XREVRANGE, which
+// takes the end of the interval first.
+func NewXRevRangeCommand(args []resp.RespValue) (Command, error) {
+	return newXRangeCommand(args[0].Str, args[2].Str, args[1].Str, args[3:], true)
+}
+
+func newXRangeCommand(key, start, end string, opts []resp.RespValue, rev bool) (Command, error) {
+	c := &XRangeCommand{key: key, count: -1, rev: rev}
+	var err error
+	if c.start, err = parseIntervalID(start, false); err != nil {
+		return nil, err
+	}
+	if c.end, err = parseIntervalID(end, true); err != nil {
+		return nil, err
+	}
+	c.empty = c.start.Compare(c.end) > 0
+	switch {
+	case len(opts) == 0:
+	case len(opts) == 2 && strings.EqualFold(opts[0].Str, "COUNT"):
+		count, err := strconv.ParseInt(opts[1].Str, 10, 64)
+		if err != nil {
+			return nil, errs.NotInteger
+		}
+		c.count = int(min(max(count, 0), math.MaxInt32))
+	default:
+		return nil, errs.Syntax
+	}
+	return c, nil
+}
+
+// parseIntervalID parses a bound of an XRANGE interval. A missing sequence
+// number is 0 for the start, and the greatest for the end. A bound starting
+// with "(" excludes the ID that follows.
+func parseIntervalID(arg string, end bool) (storage.StreamID, error) {
+	seq := uint64(0)
+	if end {
+		seq = math.MaxUint64
+	}
+	inner, exclusive := strings.CutPrefix(arg, "(")
+	id, err := parseStreamID(inner, seq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	var ok bool
+	if end {
+		if id, ok = id.Prev(); !ok {
+			return id, errs.Errorf("invalid end ID for the interval")
+		}
+	} else if id, ok = id.Next(); !ok {
+		return id, errs.Errorf("invalid start ID for the interval")
+	}
+	return id, nil
+}
+
+// Apply executes the XRANGE or XREVRANGE command. COUNT 0 replies with a
+// null array, as in Redis.
+func (c *XRangeCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.count == 0 {
+		if _, err := s.XLen(c.key); err != nil {
+			return replyError(err)
+		}
+		return resp.NewNullArray()
+	}
+	var entries []storage.StreamEntry
+	var err error
+	if !c.empty {
+		entries, err = s.XRange(c.key, c.start, c.end, c.count, c.rev)
+	} else {
+		_, err = s.XLen(c.key)
+	}
+	if err != nil {
+		return replyError(err)
+	}
+	return replyStreamEntries(entries)
+}
+
+// XDelCommand implements the XDEL command.
+type XDelCommand struct {
+	key string
+	ids []storage.StreamID
+}
+
+// NewXDelCommand creates a new XDelCommand.
+func NewXDelCommand(args []resp.RespValue) (Command, error) {
+	ids, err := parseStreamIDs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &XDelCommand{key: args[0].Str, ids: ids}, nil
+}
+
+// Apply executes the XDEL command, replying with the number of entries
+// deleted.
+func (c *XDelCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.XDel(c.key, c.ids...)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// xreadKeys returns the positions of the keys of XREAD and XREADGROUP: the
+// first half of the arguments following STREAMS.
+func xreadKeys(argv []resp.RespValue) []int {
+	for i := 1; i < len(argv); i++ {
+		switch strings.ToUpper(argv[i].Str) {
+		case "GROUP":
+			i += 2
+		case "COUNT", "BLOCK":
+			i++
+		case "STREAMS":
+			rest := len(argv) - i - 1
+			if rest == 0 || rest%2 != 0 {
+				return nil
+			}
+			positions := make([]int, rest/2)
+			for j := range positions {
+				positions[j] = i + 1 + j
+			}
+			return positions
+		}
+	}
+	return nil
+}
+
+// streamRead is a stream XREAD or XREADGROUP reads, with the ID it reads
+// after, and what the command last read from it.
+type streamRead struct {
+	key     string
+	after   storage.StreamID
+	last    bool // "$": after the last entry when the command runs
+	newOnly bool // ">": the entries never delivered to the group
+	read    int  // Entries read
+	created bool // The consumer was created reading it
+}
+
+// XReadCommand implements the XREAD and XREADGROUP commands.
+type XReadCommand struct {
+	group    string // Consumer group of XREADGROUP, empty for XREAD
+	consumer string
+	count    int
+	noAck    bool
+	streams  []streamRead
+	resp3    bool // The reply maps keys to entries
+}
+
+// NewXReadCommand creates a new XReadCommand for XREAD.
+func NewXReadCommand(args []resp.RespValue) (Command, error) {
+	return newXReadCommand(args, false)
+}
+
+// NewXReadGroupCommand creates a new XReadCommand for XREADGROUP.
+func NewXReadGroupCommand(args []resp.RespValue) (Command, error) {
+	return newXReadCommand(args, true)
+}
+
+func newXReadCommand(args []resp.RespValue, group bool) (Command, error) {
+	name := "xread"
+	if group {
+		name = "xreadgroup"
+	}
+	c := &XReadCommand{}
+	var timeout time.Duration
+	block := false
+	i := 0
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		if opt == "STREAMS" {
+			break
+		}
+		switch {
+		case opt == "COUNT" && i+1 < len(args):
+			count, err := strconv.ParseInt(args[i+1].Str, 10, 64)
+			if err != nil {
+				return nil, errs.NotInteger
+			}
+			c.count = int(min(max(count, 0), math.MaxInt32))
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1].Str, 10, 64)
+			if err != nil {
+				return nil, errs.Errorf("timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, errs.Errorf("timeout is negative")
+			}
+			// A timeout too long for a time.Duration waits for ever.
+			if ms < math.MaxInt64/int64(time.Millisecond) {
+				timeout = time.Duration(ms) * time.Millisecond
+			}
+			block = true
+			i++
+		case opt == "GROUP" && group && i+2 < len(args):
+			c.group, c.consumer = args[i+1].Str, args[i+2].Str
+			i += 2
+		case opt == "NOACK" && group:
+			c.noAck = true
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	rest := args[min(i+1, len(args)):]
+	if i == len(args) || len(rest) == 0 {
+		return nil, errs.Syntax
+	}
+	if len(rest)%2 != 0 {
+		id := "'$'"
+		if group {
+			id = "'>'"
+		}
+		return nil, errs.Errorf("Unbalanced '%s' list of streams: for each stream key an ID or %s must be specified.", name, id)
+	}
+	if group && c.group == "" {
+		return nil, errs.Errorf("Missing GROUP option for XREADGROUP")
+	}
+	keys, ids := rest[:len(rest)/2], rest[len(rest)/2:]
+	for j, key := range keys {
+		r := streamRead{key: key.Str}
+		switch id := ids[j].Str; {
+		case id == "$" && !group:
+			r.last = true
+		case id == "$":
+			return nil, errs.Errorf("The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		case id == ">" && group:
+			r.newOnly = true
+		case id == ">":
+			return nil, errs.Errorf("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			after, err := parseStreamID(id, 0)
+			if err != nil {
+				return nil, err
+			}
+			r.after = after
+		}
+		c.streams = append(c.streams, r)
+	}
+	if block {
+		return &XReadBlockCommand{XReadCommand: c, timeout: timeout}, nil
+	}
+	return c, nil
+}
+
+// ApplyClient executes the command, replying to a RESP3 client with a map
+// of the streams read.
+func (c *XReadCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	c.resp3 = client.Protocol() >= 3
+	return c.Apply(s)
+}
+
+// Apply executes the XREAD or XREADGROUP command, replying with each
+// stream read and its entries, or with a null array if there are none.
+func (c *XReadCommand) Apply(s *storage.Storage) resp.RespValue {
+	if err := c.checkGroups(s); err != nil {
+		return replyError(err)
+	}
+	var pairs []resp.RespValue
+	for i := range c.streams {
+		r := &c.streams[i]
+		entries, err := c.read(s, r)
+		if err != nil {
+			return replyError(err)
+		}
+		// Reading the history of a consumer replies even when it is empty.
+		if len(entries) > 0 || (c.group != "" && !r.newOnly) {
+			pairs = append(pairs, resp.NewBulk(r.key), replyStreamEntries(entries))
+		}
+	}
+	return c.reply(pairs)
+}
+
+// checkGroups checks that the group XREADGROUP reads exists in each of its
+// streams.
+func (c *XReadCommand) checkGroups(s *storage.Storage) error {
+	if c.group == "" {
+		return nil
+	}
+	for _, r := range c.streams {
+		if ok, err := s.XHasGroup(r.key, c.group); err != nil || !ok {
+			if err != nil {
+				return err
+			}
+			return errs.New("NOGROUP", "No such key '"+r.key+"' or consumer group '"+c.group+"' in XREADGROUP with GROUP option")
+		}
+	}
+	return nil
+}
+
+// read returns the entries of the stream r read by the command, and
+// records what it read for propagate.
+func (c *XReadCommand) read(s *storage.Storage, r *streamRead) ([]storage.StreamEntry, error) {
+	var entries []storage.StreamEntry
+	var err error
+	switch {
+	case c.group != "":
+		entries, r.created, err = s.XReadGroup(r.key, c.group, c.consumer, r.after, r.newOnly, c.count, c.noAck)
+	case !r.last:
+		entries, err = s.XRead(r.key, r.after, c.count)
+	}
+	r.read = len(entries)
+	return entries, err
+}
+
+// reply returns the streams read, given as keys and entries alternately:
+// a map for a RESP3 client, an array of pairs otherwise, and a null array
+// if there are none.
+func (c *XReadCommand) reply(pairs []resp.RespValue) resp.RespValue {
+	if len(pairs) == 0 {
+		return resp.NewNullArray()
+	}
+	if c.resp3 {
+		return resp.NewMap(pairs)
+	}
+	streams := make([]resp.RespValue, len(pairs)/2)
+	for i := range streams {
+		streams[i] = resp.NewArray(pairs[2*i : 2*i+2])
+	}
+	return resp.NewArray(streams)
+}
+
+// XReadBlockCommand implements XREAD and XREADGROUP with the BLOCK option,
+// which wait for entries to be added to their streams when there are none
+// to read. Scripts and transactions run them without waiting.
+type XReadBlockCommand struct {
+	*XReadCommand
+	timeout time.Duration // Zero for no timeout
+}
+
+// prepare takes the protocol of the client, checks the groups XREADGROUP
+// reads, and resolves "$" to the last ID of each stream: XREAD BLOCK waits
+// for the entries added once it ran.
+func (c *XReadBlockCommand) prepare(client *Client, s *storage.Storage) error {
+	c.resp3 = client.Protocol() >= 3
+	if err := c.checkGroups(s); err != nil {
+		return err
+	}
+	for i := range c.streams {
+		r := &c.streams[i]
+		if !r.last {
+			continue
+		}
+		id, err := s.XLastID(r.key)
+		if err != nil {
+			return err
+		}
+		r.after, r.last = id, false
+	}
+	return nil
+}
+
+func (c *XReadBlockCommand) blockingKeys() []string {
+	keys := make([]string, 0, len(c.streams))
+	seen := make(map[string]bool, len(c.streams))
+	for _, r := range c.streams {
+		if !seen[r.key] {
+			seen[r.key] = true
+			keys = append(keys, r.key)
+		}
+	}
+	return keys
+}
+
+func (c *XReadBlockCommand) blockTimeout() time.Duration {
+	return c.timeout
+}
+
+// serve reads all the streams of the command, whichever key was written,
+// as Redis 7 does, and serves it once there are entries to reply with.
+// XREADGROUP fails once key is deleted or holds data of another type, or
+// once its group is destroyed.
+func (c *XReadBlockCommand) serve(s *storage.Storage, key string) (resp.RespValue, bool) {
+	if c.group != "" {
+		if _, err := s.XLen(key); err != nil || s.Exists(key) == 0 {
+			return replyError(errs.New("UNBLOCKED", "the stream key no longer exists")), true
+		}
+	}
+	result := c.Apply(s)
+	return result, !result.Null
+}
+
+func (c *XReadBlockCommand) checkKey(s *storage.Storage, key string) error {
+	_, err := s.XLen(key)
+	return err
+}
+
+// XAckCommand implements the XACK command.
+type XAckCommand struct {
+	key, group string
+	ids        []storage.StreamID
+}
+
+// NewXAckCommand creates a new XAckCommand.
+func NewXAckCommand(args []resp.RespValue) (Command, error) {
+	ids, err := parseStreamIDs(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return &XAckCommand{key: args[0].Str, group: args[1].Str, ids: ids}, nil
+}
+
+// Apply executes the XACK command, replying with the number of entries
+// acknowledged.
+func (c *XAckCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.XAck(c.key, c.group, c.ids...)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// XPendingCommand implements the XPENDING command.
+type XPendingCommand struct {
+	key, group string
+	extended   bool // A range was given
+	filter     storage.XPendingFilter
+}
+
+// NewXPendingCommand creates a new XPendingCommand.
+func NewXPendingCommand(args []resp.RespValue) (Command, error) {
+	c := &XPendingCommand{key: args[0].Str, group: args[1].Str}
+	opts := args[2:]
+	if len(opts) == 0 {
+		return c, nil
+	}
+	if len(opts) >= 2 && strings.EqualFold(opts[0].Str, "IDLE") {
+		idle, err := strconv.ParseInt(opts[1].Str, 10, 64)
+		if err != nil {
+			return nil, errs.NotInteger
+		}
+		c.filter.MinIdle = idle
+		opts = opts[2:]
+	}
+	if len(opts) < 3 || len(opts) > 4 {
+		return nil, errs.Syntax
+	}
+	var err error
+	if c.filter.Start, err = parseIntervalID(opts[0].Str, false); err != nil {
+		return nil, err
+	}
+	if c.filter.End, err = parseIntervalID(opts[1].Str, true); err != nil {
+		return nil, err
+	}
+	count, err := strconv.ParseInt(opts[2].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	c.filter.Count = int(min(max(count, 0), math.MaxInt32))
+	if len(opts) == 4 {
+		c.filter.Consumer = opts[3].Str
+	}
+	c.extended = true
+	return c, nil
+}
+
+// Apply executes the XPENDING command. Without a range it replies with the
+// number of pending entries, the smallest and greatest of their IDs, and
+// the number pending for each consumer; with one, with each pending entry
+// in the range, its consumer, the milliseconds since it was delivered and
+// the number of deliveries.
+func (c *XPendingCommand) Apply(s *storage.Storage) resp.RespValue {
+	noGroup := errs.New("NOGROUP", "No such key '"+c.key+"' or consumer group '"+c.group+"'")
+	if c.extended {
+		pending, ok, err := s.XPending(c.key, c.group, c.filter)
+		if err != nil {
+			return replyError(err)
+		}
+		if !ok {
+			return replyError(noGroup)
+		}
+		now := time.Now().UnixMilli()
+		items := make([]resp.RespValue, len(pending))
+		for i, p := range pending {
+			items[i] = resp.NewArray([]resp.RespValue{
+				resp.NewBulk(p.ID.String()),
+				resp.NewBulk(p.Consumer),
+				replyInteger(max(now-p.DeliveryTime, 0)),
+				replyInteger(int64(p.DeliveryCount)),
+			})
+		}
+		return resp.NewArray(items)
+	}
+
+	sum, ok, err := s.XPendingSummary(c.key, c.group)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(noGroup)
+	}
+	if sum.Count == 0 {
+		return resp.NewArray([]resp.RespValue{replyInteger(0), replyNil(), replyNil(), resp.NewNullArray()})
+	}
+	consumers := make([]resp.RespValue, len(sum.Consumers))
+	for i, name := range sum.Consumers {
+		consumers[i] = replyBulkArray([]string{name, strconv.FormatInt(sum.PerConsumer[name], 10)})
+	}
+	return resp.NewArray([]resp.RespValue{
+		replyInteger(int64(sum.Count)),
+		resp.NewBulk(sum.First.String()),
+		resp.NewBulk(sum.Last.String()),
+		resp.NewArray(consumers),
+	})
+}
+
+// claimNoGroup returns the error of XCLAIM and XAUTOCLAIM naming a group
+// the stream at key does not have.
+func claimNoGroup(key, group string) error {
+	return errs.New("NOGROUP", "No such key '"+key+"' or consumer group '"+group+"'")
+}
+
+// replyClaimed returns the entries claimed, or only their IDs with JUSTID.
+func replyClaimed(entries []storage.StreamEntry, justID bool) resp.RespValue {
+	if !justID {
+		return replyStreamEntries(entries)
+	}
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID.String()
+	}
+	return replyBulkArray(ids)
+}
+
+// XClaimCommand implements the XCLAIM command.
+type XClaimCommand struct {
+	key, group, consumer string
+	ids                  []storage.StreamID
+	opts                 storage.XClaimOptions
+	idle                 int64 // IDLE, -1 if not given
+	claim                storage.StreamClaim
+}
+
+// NewXClaimCommand creates a new XClaimCommand.
+func NewXClaimCommand(args []resp.RespValue) (Command, error) {
+	c := &XClaimCommand{key: args[0].Str, group: args[1].Str, consumer: args[2].Str, idle: -1}
+	c.opts.DeliveryTime, c.opts.RetryCount = -1, -1
+	minIdle, err := strconv.ParseInt(args[3].Str, 10, 64)
+	if err != nil {
+		return nil, errs.Errorf("Invalid min-idle-time argument for XCLAIM")
+	}
+	c.opts.MinIdle = max(minIdle, 0)
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := storage.ParseStreamID(args[i].Str, 0)
+		if err != nil {
+			break
+		}
+		c.ids = append(c.ids, id)
+	}
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		more := i+1 < len(args)
+		switch {
+		case opt == "FORCE":
+			c.opts.Force = true
+		case opt == "JUSTID":
+			c.opts.JustID = true
+		case opt == "IDLE" && more:
+			i++
+			if c.idle, err = strconv.ParseInt(args[i].Str, 10, 64); err != nil {
+				return nil, errs.Errorf("Invalid IDLE option argument for XCLAIM")
+			}
+		case opt == "TIME" && more:
+			i++
+			if c.opts.DeliveryTime, err = strconv.ParseInt(args[i].Str, 10, 64); err != nil {
+				return nil, errs.Errorf("Invalid TIME option argument for XCLAIM")
+			}
+		case opt == "RETRYCOUNT" && more:
+			i++
+			if c.opts.RetryCount, err = strconv.ParseInt(args[i].Str, 10, 64); err != nil {
+				return nil, errs.Errorf("Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+		case opt == "LASTID" && more:
+			i++
+			if c.opts.LastID, err = parseStreamID(args[i].Str, 0); err != nil {
+				return nil, err
+			}
+			c.opts.HasLastID = true
+		default:
+			return nil, errs.Errorf("Unrecognized XCLAIM option '%s'", args[i].Str)
+		}
+	}
+	return c, nil
+}
+
+// Apply executes the XCLAIM command, replying with the entries claimed.
+// IDLE sets their delivery time that many milliseconds ago, and TIME sets
+// it outright; neither may be in the future.
+func (c *XClaimCommand) Apply(s *storage.Storage) resp.RespValue {
+	opts := c.opts
+	if c.idle >= 0 {
+		opts.DeliveryTime = max(time.Now().UnixMilli()-c.idle, 0)
+	}
+	claim, ok, err := s.XClaim(c.key, c.group, c.consumer, c.ids, opts)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(claimNoGroup(c.key, c.group))
+	}
+	c.claim = claim
+	return replyClaimed(claim.Entries, c.opts.JustID)
+}
+
+// XAutoClaimCommand implements the XAUTOCLAIM command.
+type XAutoClaimCommand struct {
+	key, group, consumer string
+	minIdle              int64
+	start                storage.StreamID
+	count                int
+	justID               bool
+	claim                storage.StreamClaim
+}
+
+// xautoclaimCount is the number of entries XAUTOCLAIM claims at most
+// unless COUNT says otherwise.
+const xautoclaimCount = 100
+
+// NewXAutoClaimCommand creates a new XAutoClaimCommand.
+func NewXAutoClaimCommand(args []resp.RespValue) (Command, error) {
+	c := &XAutoClaimCommand{key: args[0].Str, group: args[1].Str, consumer: args[2].Str, count: xautoclaimCount}
+	minIdle, err := strconv.ParseInt(args[3].Str, 10, 64)
+	if err != nil {
+		return nil, errs.Errorf("Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	c.minIdle = max(minIdle, 0)
+	if c.start, err = parseIntervalID(args[4].Str, false); err != nil {
+		return nil, err
+	}
+	for i := 5; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].Str); {
+		case opt == "JUSTID":
+			c.justID = true
+		case opt == "COUNT" && i+1 < len(args):
+			i++
+			count, err := strconv.ParseInt(args[i].Str, 10, 64)
+			// COUNT times the attempts per entry must not overflow.
+			if err != nil || count < 1 || count > math.MaxInt64/10 {
+				return nil, errs.Errorf("COUNT must be > 0")
+			}
+			c.count = int(min(count, math.MaxInt32))
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	return c, nil
+}
+
+// Apply executes the XAUTOCLAIM command, replying with the ID to scan from
+// next, 0-0 once all pending entries were looked at, the entries claimed,
+// and the IDs of the pending entries dropped as they were deleted from the
+// stream.
+func (c *XAutoClaimCommand) Apply(s *storage.Storage) resp.RespValue {
+	claim, ok, err := s.XAutoClaim(c.key, c.group, c.consumer, c.minIdle, c.start, c.count, c.justID)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(claimNoGroup(c.key, c.group))
+	}
+	c.claim = claim
+	deleted := make([]string, len(claim.Deleted))
+	for i, id := range claim.Deleted {
+		deleted[i] = id.String()
+	}
+	return resp.NewArray([]resp.RespValue{
+		resp.NewBulk(claim.Next.String()),
+		replyClaimed(claim.Entries, c.justID),
+		replyBulkArray(deleted),
+	})
+}
+
+// XSetIDCommand implements the XSETID command.
+type XSetIDCommand struct {
+	key  string
+	id   storage.StreamID
+	opts storage.XSetIDOptions
+}
+
+// NewXSetIDCommand creates a new XSetIDCommand.
+func NewXSetIDCommand(args []resp.RespValue) (Command, error) {
+	id, err := storage.ParseStreamID(args[1].Str, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := &XSetIDCommand{key: args[0].Str, id: id, opts: storage.XSetIDOptions{EntriesAdded: -1}}
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		if i+1 == len(args) {
+			return nil, errs.Syntax
+		}
+		i++
+		switch opt {
+		case "ENTRIESADDED":
+			n, err := strconv.ParseInt(args[i].Str, 10, 64)
+			if err != nil {
+				return nil, errs.NotInteger
+			}
+			if n < 0 {
+				return nil, errs.Errorf("entries_added must be positive")
+			}
+			c.opts.EntriesAdded = n
+		case "MAXDELETEDID":
+			maxDeleted, err := storage.ParseStreamID(args[i].Str, 0)
+			if err != nil {
+				return nil, err
+			}
+			if id.Compare(maxDeleted) < 0 {
+				return nil, errs.Errorf("The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+			c.opts.MaxDeletedID, c.opts.HasMaxDeletedID = maxDeleted, true
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	return c, nil
+}
+
+// Apply executes the XSETID command.
+func (c *XSetIDCommand) Apply(s *storage.Storage) resp.RespValue {
+	ok, err := s.XSetID(c.key, c.id, c.opts)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(errs.NoSuchKey)
+	}
+	return replyOK()
+}
+
+// XGroupCreateCommand implements the XGROUP CREATE subcommand.
+type XGroupCreateCommand struct {
+	key, group  string
+	id          storage.StreamID
+	last        bool // "$": the group starts after the last entry
+	mkStream    bool
+	entriesRead int64
+}
+
+// NewXGroupCreateCommand creates a new XGroupCreateCommand.
+func NewXGroupCreateCommand(args []resp.RespValue) (Command, error) {
+	c := &XGroupCreateCommand{key: args[0].Str, group: args[1].Str, entriesRead: -1}
+	var err error
+	if c.id, c.last, err = parseGroupID(args[2].Str); err != nil {
+		return nil, err
+	}
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].Str); {
+		case opt == "MKSTREAM":
+			c.mkStream = true
+		case opt == "ENTRIESREAD" && i+1 < len(args):
+			if c.entriesRead, err = parseEntriesRead(args[i+1].Str); err != nil {
+				return nil, err
+			}
+			i++
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	return c, nil
+}
+
+// parseGroupID parses the ID a consumer group is set to, "$" standing for
+// the last entry of the stream.
+func parseGroupID(arg string) (storage.StreamID, bool, error) {
+	if arg == "$" {
+		return storage.StreamID{}, true, nil
+	}
+	id, err := parseStreamID(arg, 0)
+	return id, false, err
+}
+
+// Apply executes the XGROUP CREATE subcommand.
+func (c *XGroupCreateCommand) Apply(s *storage.Storage) resp.RespValue {
+	if err := s.XGroupCreate(c.key, c.group, c.id, c.last, c.mkStream, c.entriesRead); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
+
+// XGroupSetIDCommand implements the XGROUP SETID subcommand.
+type XGroupSetIDCommand struct {
+	key, group  string
+	id          storage.StreamID
+	last        bool
+	entriesRead int64
+}
+
+// NewXGroupSetIDCommand creates a new XGroupSetIDCommand.
+func NewXGroupSetIDCommand(args []resp.RespValue) (Command, error) {
+	c := &XGroupSetIDCommand{key: args[0].Str, group: args[1].Str, entriesRead: -1}
+	var err error
+	if c.id, c.last, err = parseGroupID(args[2].Str); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(args) == 3:
+	case len(args) == 5 && strings.EqualFold(args[3].Str, "ENTRIESREAD"):
+		if c.entriesRead, err = parseEntriesRead(args[4].Str); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errs.Syntax
+	}
+	return c, nil
+}
+
+// Apply executes the XGROUP SETID subcommand.
+func (c *XGroupSetIDCommand) Apply(s *storage.Storage) resp.RespValue {
+	if err := s.XGroupSetID(c.key, c.group, c.id, c.last, c.entriesRead); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
+
+// XGroupDestroyCommand implements the XGROUP DESTROY subcommand.
+type XGroupDestroyCommand struct {
+	key, group string
+}
+
+// NewXGroupDestroyCommand creates a new XGroupDestroyCommand.
+func NewXGroupDestroyCommand(args []resp.RespValue) (Command, error) {
+	return &XGroupDestroyCommand{key: args[0].Str, group: args[1].Str}, nil
+}
+
+// Apply executes the XGROUP DESTROY subcommand, replying with 1 if the
+// group existed and 0 otherwise.
+func (c *XGroupDestroyCommand) Apply(s *storage.Storage) resp.RespValue {
+	destroyed, err := s.XGroupDestroy(c.key, c.group)
+	if err != nil {
+		return replyError(err)
+	}
+	if !destroyed {
+		return replyInteger(0)
+	}
+	return replyInteger(1)
+}
+
+// XGroupCreateConsumerCommand implements the XGROUP CREATECONSUMER
+// subcommand.
+type XGroupCreateConsumerCommand struct {
+	key, group, consumer string
+}
+
+// NewXGroupCreateConsumerCommand creates a new XGroupCreateConsumerCommand.
+func NewXGroupCreateConsumerCommand(args []resp.RespValue) (Command, error) {
+	return &XGroupCreateConsumerCommand{key: args[0].Str, group: args[1].Str, consumer: args[2].Str}, nil
+}
+
+// Apply executes the XGROUP CREATECONSUMER subcommand, replying with 1 if
+// the consumer was created and 0 if it existed.
+func (c *XGroupCreateConsumerCommand) Apply(s *storage.Storage) resp.RespValue {
+	created, err := s.XGroupCreateConsumer(c.key, c.group, c.consumer)
+	if err != nil {
+		return replyError(err)
+	}
+	if !created {
+		return replyInteger(0)
+	}
+	return replyInteger(1)
+}
+
+// XGroupDelConsumerCommand implements the XGROUP DELCONSUMER subcommand.
+type XGroupDelConsumerCommand struct {
+	key, group, consumer string
+}
+
+// NewXGroupDelConsumerCommand creates a new XGroupDelConsumerCommand.
+func NewXGroupDelConsumerCommand(args []resp.RespValue) (Command, error) {
+	return &XGroupDelConsumerCommand{key: args[0].Str, group: args[1].Str, consumer: args[2].Str}, nil
+}
+
+// Apply executes the XGROUP DELCONSUMER subcommand, replying with the
+// number of entries that were pending for the consumer.
+func (c *XGroupDelConsumerCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.XGroupDelConsumer(c.key, c.group, c.consumer)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// XInfoStreamCommand implements the XINFO STREAM subcommand.
+type XInfoStreamCommand struct {
+	key   string
+	full  bool
+	count int
+}
+
+// NewXInfoStreamCommand creates a new XInfoStreamCommand.
+func NewXInfoStreamCommand(args []resp.RespValue) (Command, error) {
+	c := &XInfoStreamCommand{key: args[0].Str, count: xinfoFullCount}
+	opts := args[1:]
+	if len(opts) == 0 {
+		return c, nil
+	}
+	if !strings.EqualFold(opts[0].Str, "FULL") || len(opts) == 2 {
+		return nil, errs.Syntax
+	}
+	c.full = true
+	if len(opts) == 3 {
+		if !strings.EqualFold(opts[1].Str, "COUNT") {
+			return nil, errs.Syntax
+		}
+		count, err := strconv.ParseInt(opts[2].Str, 10, 64)
+		if err != nil {
+			return nil, errs.NotInteger
+		}
+		c.count = int(min(max(count, 0), math.MaxInt32))
+	}
+	return c, nil
+}
+
+// Apply executes the XINFO STREAM subcommand.
+func (c *XInfoStreamCommand) Apply(s *storage.Storage) resp.RespValue {
+	info, ok, err := s.XInfoStream(c.key, c.full, c.count)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(errs.NoSuchKey)
+	}
+	fields := []resp.RespValue{
+		resp.NewBulk("length"), replyInteger(int64(info.Length)),
+		resp.NewBulk("radix-tree-keys"), replyInteger(int64(info.Nodes)),
+		resp.NewBulk("radix-tree-nodes"), replyInteger(int64(info.Nodes + 1)),
+		resp.NewBulk("last-generated-id"), resp.NewBulk(info.LastID.String()),
+		resp.NewBulk("max-deleted-entry-id"), resp.NewBulk(info.MaxDeletedID.String()),
+		resp.NewBulk("entries-added"), replyInteger(int64(info.EntriesAdded)),
+		resp.NewBulk("recorded-first-entry-id"), resp.NewBulk(info.FirstID.String()),
+	}
+	if !c.full {
+		return resp.NewMap(append(fields,
+			resp.NewBulk("groups"), replyInteger(int64(info.GroupCount)),
+			resp.NewBulk("first-entry"), replyStreamEntryOrNil(info.First),
+			resp.NewBulk("last-entry"), replyStreamEntryOrNil(info.Last),
+		))
+	}
+	groups := make([]resp.RespValue, len(info.Groups))
+	for i, g := range info.Groups {
+		groups[i] = replyGroupFull(g)
+	}
+	return resp.NewMap(append(fields,
+		resp.NewBulk("entries"), replyStreamEntries(info.Entries),
+		resp.NewBulk("groups"), resp.NewArray(groups),
+	))
+}
+
+func replyStreamEntryOrNil(e *storage.StreamEntry) resp.RespValue {
+	if e == nil {
+		return replyNil()
+	}
+	return replyStreamEntry(*e)
+}
+
+// replyGroupFull describes a consumer group for XINFO STREAM FULL, with its
+// pending entries and consumers.
+func replyGroupFull(g storage.StreamGroupInfo) resp.RespValue {
+	pending := make([]resp.RespValue, len(g.Pending))
+	for i, p := range g.Pending {
+		pending[i] = resp.NewArray([]resp.RespValue{
+			resp.NewBulk(p.ID.String()),
+			resp.NewBulk(p.Consumer),
+			replyInteger(p.DeliveryTime),
+			replyInteger(int64(p.DeliveryCount)),
+		})
+	}
+	consumers := make([]resp.RespValue, len(g.Consumers))
+	for i, c := range g.Consumers {
+		cpending := make([]resp.RespValue, len(c.Pending))
+		for j, p := range c.Pending {
+			cpending[j] = resp.NewArray([]resp.RespValue{
+				resp.NewBulk(p.ID.String()),
+				replyInteger(p.DeliveryTime),
+				replyInteger(int64(p.DeliveryCount)),
+			})
+		}
+		consumers[i] = resp.NewMap([]resp.RespValue{
+			resp.NewBulk("name"), resp.NewBulk(c.Name),
+			resp.NewBulk("seen-time"), replyInteger(c.SeenTime),
+			resp.NewBulk("active-time"), replyInteger(c.ActiveTime),
+			resp.NewBulk("pel-count"), replyInteger(int64(c.PendingCount)),
+			resp.NewBulk("pending"), resp.NewArray(cpending),
+		})
+	}
+	return resp.NewMap([]resp.RespValue{
+		resp.NewBulk("name"), resp.NewBulk(g.Name),
+		resp.NewBulk("last-delivered-id"), resp.NewBulk(g.LastID.String()),
+		resp.NewBulk("entries-read"), replyCounter(g.EntriesRead),
+		resp.NewBulk("lag"), replyCounter(g.Lag),
+		resp.NewBulk("pel-count"), replyInteger(int64(g.PendingCount)),
+		resp.NewBulk("pending"), resp.NewArray(pending),
+		resp.NewBulk("consumers"), resp.NewArray(consumers),
+	})
+}
+
+// replyCounter returns the entries read or lag of a group, null if it is
+// unknown.
+func replyCounter(n int64) resp.RespValue {
+	return replyIntegerOrNil(n, n >= 0)
+}
+
+// XInfoGroupsCommand implements the XINFO GROUPS subcommand.
+type XInfoGroupsCommand struct {
+	key string
+}
+
+// NewXInfoGroupsCommand creates a new XInfoGroupsCommand.
+func NewXInfoGroupsCommand(args []resp.RespValue) (Command, error) {
+	return &XInfoGroupsCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the XINFO GROUPS subcommand.
+func (c *XInfoGroupsCommand) Apply(s *storage.Storage) resp.RespValue {
+	groups, ok, err := s.XInfoGroups(c.key)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(errs.NoSuchKey)
+	}
+	items := make([]resp.RespValue, len(groups))
+	for i, g := range groups {
+		items[i] = resp.NewMap([]resp.RespValue{
+			resp.NewBulk("name"), resp.NewBulk(g.Name),
+			resp.NewBulk("consumers"), replyInteger(int64(len(g.Consumers))),
+			resp.NewBulk("pending"), replyInteger(int64(g.PendingCount)),
+			resp.NewBulk("last-delivered-id"), resp.NewBulk(g.LastID.String()),
+			resp.NewBulk("entries-read"), replyCounter(g.EntriesRead),
+			resp.NewBulk("lag"), replyCounter(g.Lag),
+		})
+	}
+	return resp.NewArray(items)
+}
+
+// XInfoConsumersCommand implements the XINFO CONSUMERS subcommand.
+type XInfoConsumersCommand struct {
+	key, group string
+}
+
+// NewXInfoConsumersCommand creates a new XInfoConsumersCommand.
+func NewXInfoConsumersCommand(args []resp.RespValue) (Command, error) {
+	return &XInfoConsumersCommand{key: args[0].Str, group: args[1].Str}, nil
+}
+
+// Apply executes the XINFO CONSUMERS subcommand, replying with the
+// milliseconds since each consumer last tried to read, and since it last
+// read entries, -1 if it never did.
+func (c *XInfoConsumersCommand) Apply(s *storage.Storage) resp.RespValue {
+	consumers, ok, err := s.XInfoConsumers(c.key, c.group)
+	if err != nil {
+		return replyError(err)
+	}
+	if !ok {
+		return replyError(errs.NoSuchKey)
+	}
+	now := time.Now().UnixMilli()
+	items := make([]resp.RespValue, len(consumers))
+	for i, cons := range consumers {
+		inactive := int64(-1)
+		if cons.ActiveTime >= 0 {
+			inactive = max(now-cons.ActiveTime, 0)
+		}
+		items[i] = resp.NewMap([]resp.RespValue{
+			resp.NewBulk("name"), resp.NewBulk(cons.Name),
+			resp.NewBulk("pending"), replyInteger(int64(cons.PendingCount)),
+			resp.NewBulk("idle"), replyInteger(max(now-cons.SeenTime, 0)),
+			resp.NewBulk("inactive"), replyInteger(inactive),
+		})
+	}
+	return resp.NewArray(items)
+}
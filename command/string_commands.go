@@ -1,114 +1,260 @@
 package command
 
 import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
 	"github.com/liweiyuan/go-redis-server/resp"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
 func registerStringCommands(cr *CommandRegistry) {
-	cr.register("PING", NewPingCommand)
-	cr.register("SET", NewSetCommand)
-	cr.register("GET", NewGetCommand)
-	cr.register("DEL", NewDelCommand)
-	cr.register("EXISTS", NewExistsCommand)
-	cr.register("INCR", NewIncrCommand)
-	cr.register("DECR", NewDecrCommand)
+	cr.register([]CommandSpec{
+		{Name: "PING", MinArgs: 0, MaxArgs: 1, Flags: FlagLoading | FlagFast, Categories: []string{"@connection"}, New: NewPingCommand},
+		{Name: "SET", MinArgs: 2, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewSetCommand},
+		{Name: "GET", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: cr.newGetCommand},
+		{Name: "GETEX", MinArgs: 1, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: cr.newGetExCommand},
+		{Name: "GETDEL", MinArgs: 1, MaxArgs: 1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewGetDelCommand},
+		{Name: "DEL", MinArgs: 1, MaxArgs: -1, Flags: FlagWrite, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@keyspace"}, New: NewDelCommand},
+		{Name: "UNLINK", MinArgs: 1, MaxArgs: -1, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@keyspace"}, New: NewDelCommand},
+		{Name: "KEYS", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly, Categories: []string{"@keyspace", "@dangerous"}, New: NewKeysCommand},
+		{Name: "RANDOMKEY", MinArgs: 0, MaxArgs: 0, Flags: FlagReadOnly, Categories: []string{"@keyspace"}, New: NewRandomKeyCommand},
+		{Name: "SCAN", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, Categories: []string{"@keyspace"}, New: NewScanCommand},
+		{Name: "EXISTS", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Categories: []string{"@keyspace"}, New: NewExistsCommand},
+		{Name: "TYPE", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: NewTypeCommand},
+		{Name: "RENAME", MinArgs: 2, MaxArgs: 2, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Categories: []string{"@keyspace"}, New: NewRenameCommand},
+		{Name: "COPY", MinArgs: 2, MaxArgs: 3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Categories: []string{"@keyspace"}, New: NewCopyCommand},
+		{Name: "DUMP", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace"}, New: NewDumpCommand},
+		{Name: "RESTORE", MinArgs: 3, MaxArgs: -1, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@keyspace", "@dangerous"}, New: NewRestoreCommand},
+		{Name: "OBJECT", MinArgs: 1, MaxArgs: -1, Flags: FlagReadOnly, Categories: []string{"@keyspace"}, Subcommands: objectSubcommands},
+		{Name: "INCR", MinArgs: 1, MaxArgs: 1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewIncrCommand},
+		{Name: "DECR", MinArgs: 1, MaxArgs: 1, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewDecrCommand},
+		{Name: "INCRBYFLOAT", MinArgs: 2, MaxArgs: 2, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewIncrByFloatCommand},
+		{Name: "SETRANGE", MinArgs: 3, MaxArgs: 3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewSetRangeCommand},
+		{Name: "GETRANGE", MinArgs: 3, MaxArgs: 3, Flags: FlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewGetRangeCommand},
+		{Name: "APPEND", MinArgs: 2, MaxArgs: 2, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewAppendCommand},
+		{Name: "STRLEN", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Categories: []string{"@string"}, New: NewStrLenCommand},
+	})
+}
+
+// objectSubcommands are the subcommands of OBJECT.
+var objectSubcommands = []CommandSpec{
+	{Name: "IDLETIME", MinArgs: 1, MaxArgs: 1, FirstKey: 2, LastKey: 2, Step: 1, New: NewObjectIdleTimeCommand, Usage: "<key>", Help: []string{
+		"Return the idle time of the key, that is the approximated number of",
+		"seconds elapsed since the last access to the key.",
+	}},
 }
 
 // PingCommand implements the PING command.
 type PingCommand struct {
 	message string
+	echo    bool // The message was given as an argument
 }
 
 // NewPingCommand creates a new PingCommand.
 func NewPingCommand(args []resp.RespValue) (Command, error) {
-	if len(args) > 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'ping' command")
-	}
-
 	msg := "PONG"
 	if len(args) == 1 {
-		if args[0].Type != resp.Bulk {
-			return nil, resp.NewError("ERR PING argument must be a bulk string")
-		}
 		msg = args[0].Str
 	}
-	return &PingCommand{message: msg}, nil
+	return &PingCommand{message: msg, echo: len(args) == 1}, nil
 }
 
-// Apply executes the PING command.
+// Apply executes the PING command: PONG as a simple string, or the message
+// given as a bulk string.
 func (c *PingCommand) Apply(s *storage.Storage) resp.RespValue {
+	if c.echo {
+		return resp.NewBulk(c.message)
+	}
 	return resp.NewString(c.message)
 }
 
+// ApplyClient executes the PING command for the calling client. In RESP2
+// subscribe mode the reply is a "pong" message array.
+func (c *PingCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	if !client.InSubscribeMode() {
+		return c.Apply(s)
+	}
+	msg := ""
+	if c.echo {
+		msg = c.message
+	}
+	return replyBulkArray([]string{"pong", msg})
+}
+
 // SetCommand implements the SET command.
 type SetCommand struct {
-	key   string
-	value string
+	key    string
+	value  string
+	opts   storage.SetOptions
+	expire *expireArg
+
+	// Outcome of Apply, which propagate logs.
+	expireAt time.Time
+	written  bool
 }
 
 // NewSetCommand creates a new SetCommand.
 func NewSetCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 2 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'set' command")
-	}
-
-	if args[0].Type != resp.Bulk || args[1].Type != resp.Bulk {
-		return nil, resp.NewError("ERR SET arguments must be bulk strings")
+	c := &SetCommand{key: args[0].Str, value: args[1].Str}
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		switch {
+		case opt == "NX" && !c.opts.XX:
+			c.opts.NX = true
+		case opt == "XX" && !c.opts.NX:
+			c.opts.XX = true
+		case opt == "GET":
+			c.opts.Get = true
+		case opt == "KEEPTTL" && c.expire == nil:
+			c.opts.KeepTTL = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") && c.expire == nil && !c.opts.KeepTTL && i+1 < len(args):
+			i++
+			expire, err := parseExpireArg(opt, args[i].Str, "set")
+			if err != nil {
+				return nil, err
+			}
+			c.expire = &expire
+		default:
+			return nil, errs.Syntax
+		}
 	}
-
-	return &SetCommand{key: args[0].Str, value: args[1].Str}, nil
+	return c, nil
 }
 
 // Apply executes the SET command.
 func (c *SetCommand) Apply(s *storage.Storage) resp.RespValue {
-	s.Set(c.key, c.value)
-	return resp.NewString("OK")
+	opts := c.opts
+	if c.expire != nil {
+		opts.ExpireAt = c.expire.at(time.Now())
+	}
+	old, existed, written, err := s.SetWithOptions(c.key, c.value, opts)
+	if err != nil {
+		return replyError(err)
+	}
+	c.expireAt, c.written = opts.ExpireAt, written
+	if opts.Get {
+		return replyBulkOrNil(old, existed)
+	}
+	if !written {
+		return replyNil()
+	}
+	return replyOK()
 }
 
 // GetCommand implements the GET command.
 type GetCommand struct {
 	key string
+	earlyExpireHint
 }
 
 // NewGetCommand creates a new GetCommand.
 func NewGetCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'get' command")
+	return &GetCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the GET command.
+func (c *GetCommand) Apply(s *storage.Storage) resp.RespValue {
+	val, found, err := s.Get(c.key)
+	if err != nil {
+		return replyError(err)
 	}
+	return replyBulkOrNil(val, found)
+}
+
+// ApplyClient executes the GET command, hinting a RESP3 client at
+// refreshing a key about to expire.
+func (c *GetCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	return c.hint(client, s, c.key, c.Apply(s))
+}
 
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR GET argument must be a bulk string")
+// GetExCommand implements the GETEX command.
+type GetExCommand struct {
+	key     string
+	expire  *expireArg
+	persist bool
+	earlyExpireHint
+
+	// Outcome of Apply, which propagate logs.
+	expireAt time.Time
+	found    bool
+}
+
+// NewGetExCommand creates a new GetExCommand from the arguments
+// key [EX seconds | PX milliseconds | EXAT timestamp | PXAT timestamp | PERSIST].
+func NewGetExCommand(args []resp.RespValue) (Command, error) {
+	c := &GetExCommand{key: args[0].Str}
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Str)
+		switch {
+		case opt == "PERSIST" && c.expire == nil:
+			c.persist = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") && c.expire == nil && !c.persist && i+1 < len(args):
+			i++
+			expire, err := parseExpireArg(opt, args[i].Str, "getex")
+			if err != nil {
+				return nil, err
+			}
+			c.expire = &expire
+		default:
+			return nil, errs.Syntax
+		}
 	}
+	return c, nil
+}
 
-	return &GetCommand{key: args[0].Str}, nil
+// Apply executes the GETEX command.
+func (c *GetExCommand) Apply(s *storage.Storage) resp.RespValue {
+	opts := storage.GetExOptions{Persist: c.persist}
+	if c.expire != nil {
+		opts.ExpireAt = c.expire.at(time.Now())
+	}
+	val, found, err := s.GetEx(c.key, opts)
+	if err != nil {
+		return replyError(err)
+	}
+	c.expireAt, c.found = opts.ExpireAt, found
+	return replyBulkOrNil(val, found)
 }
 
-// Apply executes the GET command.
-func (c *GetCommand) Apply(s *storage.Storage) resp.RespValue {
-	val, ok := s.Get(c.key)
-	if !ok {
-		return resp.NewBulk("") // Return null bulk string if key not found
+// ApplyClient executes the GETEX command, hinting a RESP3 client at
+// refreshing a key about to expire.
+func (c *GetExCommand) ApplyClient(client *Client, s *storage.Storage) resp.RespValue {
+	return c.hint(client, s, c.key, c.Apply(s))
+}
+
+// GetDelCommand implements the GETDEL command.
+type GetDelCommand struct {
+	key string
+}
+
+// NewGetDelCommand creates a new GetDelCommand.
+func NewGetDelCommand(args []resp.RespValue) (Command, error) {
+	return &GetDelCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the GETDEL command.
+func (c *GetDelCommand) Apply(s *storage.Storage) resp.RespValue {
+	val, found, err := s.GetDel(c.key)
+	if err != nil {
+		return replyError(err)
 	}
-	return resp.NewBulk(val)
+	return replyBulkOrNil(val, found)
 }
 
-// DelCommand implements the DEL command.
+// DelCommand implements the DEL and UNLINK commands. Values are freed by
+// the garbage collector in the background either way, so UNLINK is DEL.
 type DelCommand struct {
 	keys []string
 }
 
 // NewDelCommand creates a new DelCommand.
 func NewDelCommand(args []resp.RespValue) (Command, error) {
-	if len(args) == 0 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'del' command")
-	}
-
 	keys := make([]string, len(args))
 	for i, arg := range args {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR DEL arguments must be bulk strings")
-		}
 		keys[i] = arg.Str
 	}
 	return &DelCommand{keys: keys}, nil
@@ -117,7 +263,7 @@ func NewDelCommand(args []resp.RespValue) (Command, error) {
 // Apply executes the DEL command.
 func (c *DelCommand) Apply(s *storage.Storage) resp.RespValue {
 	count := s.Del(c.keys...)
-	return resp.NewInteger(int64(count))
+	return replyInteger(int64(count))
 }
 
 // ExistsCommand implements the EXISTS command.
@@ -127,15 +273,8 @@ type ExistsCommand struct {
 
 // NewExistsCommand creates a new ExistsCommand.
 func NewExistsCommand(args []resp.RespValue) (Command, error) {
-	if len(args) == 0 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'exists' command")
-	}
-
 	keys := make([]string, len(args))
 	for i, arg := range args {
-		if arg.Type != resp.Bulk {
-			return nil, resp.NewError("ERR EXISTS arguments must be bulk strings")
-		}
 		keys[i] = arg.Str
 	}
 	return &ExistsCommand{keys: keys}, nil
@@ -144,24 +283,275 @@ func NewExistsCommand(args []resp.RespValue) (Command, error) {
 // Apply executes the EXISTS command.
 func (c *ExistsCommand) Apply(s *storage.Storage) resp.RespValue {
 	count := s.Exists(c.keys...)
-	return resp.NewInteger(int64(count))
+	return replyInteger(int64(count))
 }
 
-// IncrCommand implements the INCR command.
-type IncrCommand struct {
+// TypeCommand implements the TYPE command.
+type TypeCommand struct {
 	key string
 }
 
-// NewIncrCommand creates a new IncrCommand.
-func NewIncrCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'incr' command")
+// NewTypeCommand creates a new TypeCommand.
+func NewTypeCommand(args []resp.RespValue) (Command, error) {
+	return &TypeCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the TYPE command.
+func (c *TypeCommand) Apply(s *storage.Storage) resp.RespValue {
+	return resp.NewString(s.Type(c.key))
+}
+
+// RenameCommand implements the RENAME command.
+type RenameCommand struct {
+	src string
+	dst string
+}
+
+// NewRenameCommand creates a new RenameCommand.
+func NewRenameCommand(args []resp.RespValue) (Command, error) {
+	return &RenameCommand{src: args[0].Str, dst: args[1].Str}, nil
+}
+
+// Apply executes the RENAME command.
+func (c *RenameCommand) Apply(s *storage.Storage) resp.RespValue {
+	if err := s.Rename(c.src, c.dst); err != nil {
+		return replyError(err)
+	}
+	return replyOK()
+}
+
+// CopyCommand implements the COPY command.
+type CopyCommand struct {
+	src     string
+	dst     string
+	replace bool
+}
+
+// NewCopyCommand creates a new CopyCommand from the arguments
+// source destination [REPLACE].
+func NewCopyCommand(args []resp.RespValue) (Command, error) {
+	c := &CopyCommand{src: args[0].Str, dst: args[1].Str}
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2].Str, "REPLACE") {
+			return nil, errs.Syntax
+		}
+		c.replace = true
+	}
+	return c, nil
+}
+
+// Apply executes the COPY command.
+func (c *CopyCommand) Apply(s *storage.Storage) resp.RespValue {
+	copied, err := s.Copy(c.src, c.dst, c.replace)
+	if err != nil {
+		return replyError(err)
+	}
+	if copied {
+		return replyInteger(1)
+	}
+	return replyInteger(0)
+}
+
+// DumpCommand implements the DUMP command.
+type DumpCommand struct {
+	key string
+}
+
+// NewDumpCommand creates a new DumpCommand.
+func NewDumpCommand(args []resp.RespValue) (Command, error) {
+	return &DumpCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the DUMP command.
+func (c *DumpCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyBulkOrNil(s.DumpKey(c.key))
+}
+
+// RestoreCommand implements the RESTORE command.
+type RestoreCommand struct {
+	key     string
+	ttl     int64 // Milliseconds, an absolute time with ABSTTL
+	absTTL  bool
+	payload string
+	opts    storage.RestoreOptions
+	expired bool // The expire time had already passed
+}
+
+// NewRestoreCommand creates a new RestoreCommand from the arguments
+// key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds]
+// [FREQ frequency]. FREQ is checked and ignored, as keys have no access
+// frequency here.
+func NewRestoreCommand(args []resp.RespValue) (Command, error) {
+	c := &RestoreCommand{key: args[0].Str, payload: args[2].Str, opts: storage.RestoreOptions{IdleTime: -1}}
+	freq := false
+	for i := 3; i < len(args); i++ {
+		more := i+1 < len(args)
+		switch strings.ToUpper(args[i].Str) {
+		case "REPLACE":
+			c.opts.Replace = true
+		case "ABSTTL":
+			c.absTTL = true
+		case "IDLETIME":
+			if !more || freq {
+				return nil, errs.Syntax
+			}
+			i++
+			idle, err := strconv.ParseInt(args[i].Str, 10, 64)
+			if err != nil {
+				return nil, errs.NotInteger
+			}
+			if idle < 0 {
+				return nil, errs.Errorf("Invalid IDLETIME value, must be >= 0")
+			}
+			c.opts.IdleTime = idle
+		case "FREQ":
+			if !more || c.opts.IdleTime >= 0 {
+				return nil, errs.Syntax
+			}
+			i++
+			n, err := strconv.ParseInt(args[i].Str, 10, 64)
+			if err != nil {
+				return nil, errs.NotInteger
+			}
+			if n < 0 || n > 255 {
+				return nil, errs.Errorf("Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			freq = true
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	ttl, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	if ttl < 0 {
+		return nil, errs.Errorf("Invalid TTL value, must be >= 0")
+	}
+	c.ttl = ttl
+	return c, nil
+}
+
+// Apply executes the RESTORE command.
+func (c *RestoreCommand) Apply(s *storage.Storage) resp.RespValue {
+	c.opts.ExpireAt = c.ttl
+	if c.ttl > 0 && !c.absTTL {
+		c.opts.ExpireAt = addMs(time.Now().UnixMilli(), c.ttl)
 	}
+	if err := s.RestoreKey(c.key, c.payload, c.opts); err != nil {
+		return replyError(err)
+	}
+	c.expired = c.opts.ExpireAt > 0 && c.opts.ExpireAt <= time.Now().UnixMilli()
+	return replyOK()
+}
+
+// ObjectIdleTimeCommand implements the OBJECT IDLETIME command.
+type ObjectIdleTimeCommand struct {
+	key string
+}
 
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR INCR argument must be a bulk string")
+// NewObjectIdleTimeCommand creates a new ObjectIdleTimeCommand.
+func NewObjectIdleTimeCommand(args []resp.RespValue) (Command, error) {
+	return &ObjectIdleTimeCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the OBJECT IDLETIME command, replying with the seconds
+// since the key was last accessed.
+func (c *ObjectIdleTimeCommand) Apply(s *storage.Storage) resp.RespValue {
+	idle, ok := s.IdleTime(c.key)
+	if !ok {
+		return replyNil()
 	}
+	return replyInteger(int64(idle / time.Second))
+}
+
+// KeysCommand implements the KEYS command.
+type KeysCommand struct {
+	pattern string
+}
 
+// NewKeysCommand creates a new KeysCommand.
+func NewKeysCommand(args []resp.RespValue) (Command, error) {
+	return &KeysCommand{pattern: args[0].Str}, nil
+}
+
+// Apply executes the KEYS command.
+func (c *KeysCommand) Apply(s *storage.Storage) resp.RespValue {
+	return replyBulkArray(s.Keys(c.pattern))
+}
+
+// ScanCommand implements the SCAN command.
+type ScanCommand struct {
+	cursor  uint64
+	count   int
+	pattern string
+	typ     string
+}
+
+// NewScanCommand creates a new ScanCommand.
+func NewScanCommand(args []resp.RespValue) (Command, error) {
+	cursor, err := strconv.ParseUint(args[0].Str, 10, 64)
+	if err != nil {
+		return nil, errs.Errorf("invalid cursor")
+	}
+	c := &ScanCommand{cursor: cursor, count: 10}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return nil, errs.Syntax
+		}
+		value := args[i+1].Str
+		switch strings.ToUpper(args[i].Str) {
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, errs.NotInteger
+			}
+			if n < 1 {
+				return nil, errs.Syntax
+			}
+			c.count = n
+		case "MATCH":
+			c.pattern = value
+		case "TYPE":
+			c.typ = strings.ToLower(value)
+		default:
+			return nil, errs.Syntax
+		}
+	}
+	return c, nil
+}
+
+// Apply executes the SCAN command.
+func (c *ScanCommand) Apply(s *storage.Storage) resp.RespValue {
+	keys, next := s.Scan(c.cursor, c.count, c.pattern, c.typ)
+	return resp.NewArray([]resp.RespValue{resp.NewBulk(strconv.FormatUint(next, 10)), replyBulkArray(keys)})
+}
+
+// RandomKeyCommand implements the RANDOMKEY command.
+type RandomKeyCommand struct{}
+
+// NewRandomKeyCommand creates a new RandomKeyCommand.
+func NewRandomKeyCommand(args []resp.RespValue) (Command, error) {
+	return &RandomKeyCommand{}, nil
+}
+
+// Apply executes the RANDOMKEY command, replying with nil if there are no
+// keys.
+func (c *RandomKeyCommand) Apply(s *storage.Storage) resp.RespValue {
+	key, ok := s.RandomKey()
+	if !ok {
+		return replyNil()
+	}
+	return resp.NewBulk(key)
+}
+
+// IncrCommand implements the INCR command.
+type IncrCommand struct {
+	key string
+}
+
+// NewIncrCommand creates a new IncrCommand.
+func NewIncrCommand(args []resp.RespValue) (Command, error) {
 	return &IncrCommand{key: args[0].Str}, nil
 }
 
@@ -169,9 +559,33 @@ func NewIncrCommand(args []resp.RespValue) (Command, error) {
 func (c *IncrCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.Incr(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
+	}
+	return replyInteger(val)
+}
+
+// IncrByFloatCommand implements the INCRBYFLOAT command.
+type IncrByFloatCommand struct {
+	key  string
+	incr float64
+}
+
+// NewIncrByFloatCommand creates a new IncrByFloatCommand.
+func NewIncrByFloatCommand(args []resp.RespValue) (Command, error) {
+	incr, err := strconv.ParseFloat(args[1].Str, 64)
+	if err != nil || math.IsNaN(incr) {
+		return nil, errs.NotFloat
+	}
+	return &IncrByFloatCommand{key: args[0].Str, incr: incr}, nil
+}
+
+// Apply executes the INCRBYFLOAT command.
+func (c *IncrByFloatCommand) Apply(s *storage.Storage) resp.RespValue {
+	val, err := s.IncrByFloat(c.key, c.incr)
+	if err != nil {
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyDouble(val)
 }
 
 // DecrCommand implements the DECR command.
@@ -181,14 +595,6 @@ type DecrCommand struct {
 
 // NewDecrCommand creates a new DecrCommand.
 func NewDecrCommand(args []resp.RespValue) (Command, error) {
-	if len(args) != 1 {
-		return nil, resp.NewError("ERR wrong number of arguments for 'decr' command")
-	}
-
-	if args[0].Type != resp.Bulk {
-		return nil, resp.NewError("ERR DECR argument must be a bulk string")
-	}
-
 	return &DecrCommand{key: args[0].Str}, nil
 }
 
@@ -196,7 +602,102 @@ func NewDecrCommand(args []resp.RespValue) (Command, error) {
 func (c *DecrCommand) Apply(s *storage.Storage) resp.RespValue {
 	val, err := s.Decr(c.key)
 	if err != nil {
-		return resp.NewError(err.Error())
+		return replyError(err)
+	}
+	return replyInteger(val)
+}
+
+// SetRangeCommand implements the SETRANGE command.
+type SetRangeCommand struct {
+	key    string
+	offset int64
+	value  string
+}
+
+// NewSetRangeCommand creates a new SetRangeCommand.
+func NewSetRangeCommand(args []resp.RespValue) (Command, error) {
+	offset, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	if offset < 0 {
+		return nil, errs.Errorf("offset is out of range")
+	}
+	return &SetRangeCommand{key: args[0].Str, offset: offset, value: args[2].Str}, nil
+}
+
+// Apply executes the SETRANGE command.
+func (c *SetRangeCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.SetRange(c.key, c.offset, c.value)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// GetRangeCommand implements the GETRANGE command.
+type GetRangeCommand struct {
+	key        string
+	start, end int64
+}
+
+// NewGetRangeCommand creates a new GetRangeCommand.
+func NewGetRangeCommand(args []resp.RespValue) (Command, error) {
+	start, err := strconv.ParseInt(args[1].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	end, err := strconv.ParseInt(args[2].Str, 10, 64)
+	if err != nil {
+		return nil, errs.NotInteger
+	}
+	return &GetRangeCommand{key: args[0].Str, start: start, end: end}, nil
+}
+
+// Apply executes the GETRANGE command.
+func (c *GetRangeCommand) Apply(s *storage.Storage) resp.RespValue {
+	val, err := s.GetRange(c.key, c.start, c.end)
+	if err != nil {
+		return replyError(err)
+	}
+	return resp.NewBulk(val)
+}
+
+// AppendCommand implements the APPEND command.
+type AppendCommand struct {
+	key   string
+	value string
+}
+
+// NewAppendCommand creates a new AppendCommand.
+func NewAppendCommand(args []resp.RespValue) (Command, error) {
+	return &AppendCommand{key: args[0].Str, value: args[1].Str}, nil
+}
+
+// Apply executes the APPEND command.
+func (c *AppendCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.Append(c.key, c.value)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyInteger(n)
+}
+
+// StrLenCommand implements the STRLEN command.
+type StrLenCommand struct {
+	key string
+}
+
+// NewStrLenCommand creates a new StrLenCommand.
+func NewStrLenCommand(args []resp.RespValue) (Command, error) {
+	return &StrLenCommand{key: args[0].Str}, nil
+}
+
+// Apply executes the STRLEN command.
+func (c *StrLenCommand) Apply(s *storage.Storage) resp.RespValue {
+	n, err := s.StrLen(c.key)
+	if err != nil {
+		return replyError(err)
 	}
-	return resp.NewInteger(val)
+	return replyInteger(n)
 }
\ No newline at end of file
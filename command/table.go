@@ -0,0 +1,196 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// CommandFlag describes a property of a command, as reported by COMMAND INFO.
+type CommandFlag uint32
+
+const (
+	// FlagWrite marks commands that may modify the dataset.
+	FlagWrite CommandFlag = 1 << iota
+	// FlagReadOnly marks commands that only read the dataset.
+	FlagReadOnly
+	// FlagDenyOOM marks commands that may grow memory usage.
+	FlagDenyOOM
+	// FlagAdmin marks administrative commands.
+	FlagAdmin
+	// FlagPubSub marks publish/subscribe commands.
+	FlagPubSub
+	// FlagFast marks commands that run in constant or logarithmic time.
+	FlagFast
+	// FlagLoading marks commands allowed while the dataset is loading.
+	FlagLoading
+	// FlagStale marks commands allowed while a replica has stale data.
+	FlagStale
+	// FlagNoScript marks commands that scripts may not call.
+	FlagNoScript
+	// FlagMovableKeys marks commands whose key positions depend on their
+	// arguments.
+	FlagMovableKeys
+	// FlagMayReplicate marks commands that are not write commands but may
+	// write or be propagated, such as scripts and PUBLISH.
+	FlagMayReplicate
+	// FlagBlocking marks commands that may block the client, such as BLPOP.
+	FlagBlocking
+	// FlagNoAuth marks commands clients may run before authenticating, such
+	// as AUTH.
+	FlagNoAuth
+)
+
+var flagNames = []struct {
+	flag CommandFlag
+	name string
+}{
+	{FlagWrite, "write"},
+	{FlagReadOnly, "readonly"},
+	{FlagDenyOOM, "denyoom"},
+	{FlagAdmin, "admin"},
+	{FlagPubSub, "pubsub"},
+	{FlagFast, "fast"},
+	{FlagLoading, "loading"},
+	{FlagStale, "stale"},
+	{FlagNoScript, "noscript"},
+	{FlagMovableKeys, "movablekeys"},
+	{FlagMayReplicate, "may_replicate"},
+	{FlagBlocking, "blocking"},
+	{FlagNoAuth, "no_auth"},
+}
+
+// Names returns the COMMAND INFO names of the flags that are set.
+func (f CommandFlag) Names() []string {
+	names := []string{}
+	for _, fn := range flagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return names
+}
+
+// CommandSpec is the metadata of a command: its arity, flags, key positions
+// and ACL categories, along with the constructor that builds it.
+//
+// Container commands, such as CLIENT or OBJECT, have subcommands named by
+// their first argument, each with a spec of its own. The arity of a
+// subcommand does not count the command and subcommand names, its key
+// positions count them, and it inherits the flags and categories of its
+// container unless it declares some. The constructor of a subcommand is
+// given the arguments following its name; that of a container command is
+// only called without any, for the commands that accept it, like COMMAND.
+type CommandSpec struct {
+	Name        string
+	MinArgs     int // Minimum number of arguments, not counting the command name
+	MaxArgs     int // Maximum number of arguments, or -1 for no limit
+	Flags       CommandFlag
+	FirstKey    int // Position of the first key argument, 0 if the command takes no keys
+	LastKey     int // Position of the last key argument, negative counts from the end
+	Step        int // Step between key arguments
+	Categories  []string
+	KeysFunc    func(argv []resp.RespValue) []int // Key positions of commands with movable keys
+	New         func(args []resp.RespValue) (Command, error)
+	Subcommands []CommandSpec // Subcommands of a container command, HELP added by the registry
+	Usage       string        // Arguments of a subcommand as shown by HELP, such as "<key>"
+	Help        []string      // Lines describing a subcommand in the reply to HELP
+
+	container *CommandSpec // Container command of a subcommand
+}
+
+// FullName returns the name of the command as COMMAND INFO and INFO
+// commandstats report it: that of a subcommand is prefixed with the name of
+// its container, as in CLIENT|ID.
+func (spec *CommandSpec) FullName() string {
+	if spec.container != nil {
+		return spec.container.Name + "|" + spec.Name
+	}
+	return spec.Name
+}
+
+// Arity returns the command arity in the Redis convention: the exact number
+// of arguments including the command name, and the subcommand name for a
+// subcommand, or its negated minimum when the command accepts a variable
+// number of arguments.
+func (spec *CommandSpec) Arity() int {
+	names := 1
+	if spec.container != nil {
+		names = 2
+	}
+	if spec.MinArgs == spec.MaxArgs {
+		return spec.MinArgs + names
+	}
+	return -(spec.MinArgs + names)
+}
+
+// HasFlag reports whether the command has the given flag.
+func (spec *CommandSpec) HasFlag(flag CommandFlag) bool {
+	return spec.Flags&flag != 0
+}
+
+// MayWrite reports whether the command may modify the dataset or be
+// propagated: write commands, and those that may be, such as scripts. They
+// are the commands CLIENT PAUSE WRITE holds back.
+func (spec *CommandSpec) MayWrite() bool {
+	return spec.HasFlag(FlagWrite | FlagMayReplicate)
+}
+
+// ACLCategories returns the ACL categories of the command: the categories
+// declared in the table plus those implied by its flags.
+func (spec *CommandSpec) ACLCategories() []string {
+	categories := []string{}
+	if spec.HasFlag(FlagWrite) {
+		categories = append(categories, "@write")
+	}
+	if spec.HasFlag(FlagReadOnly) {
+		categories = append(categories, "@read")
+	}
+	categories = append(categories, spec.Categories...)
+	if spec.HasFlag(FlagAdmin) {
+		categories = append(categories, "@admin", "@dangerous")
+	}
+	if spec.HasFlag(FlagPubSub) {
+		categories = append(categories, "@pubsub")
+	}
+	if spec.HasFlag(FlagFast) {
+		categories = append(categories, "@fast")
+	} else {
+		categories = append(categories, "@slow")
+	}
+	if spec.HasFlag(FlagBlocking) {
+		categories = append(categories, "@blocking")
+	}
+	return categories
+}
+
+// KeyPositions returns the positions of the key arguments in an invocation
+// of argc arguments, counting the command name as position 0.
+func (spec *CommandSpec) KeyPositions(argc int) []int {
+	if spec.FirstKey == 0 {
+		return nil
+	}
+	last := spec.LastKey
+	if last < 0 {
+		last = argc + last
+	}
+	positions := []int{}
+	for i := spec.FirstKey; i <= last && i < argc; i += spec.Step {
+		positions = append(positions, i)
+	}
+	return positions
+}
+
+// validate checks the arguments of an invocation against the spec.
+func (spec *CommandSpec) validate(args []resp.RespValue) error {
+	if len(args) < spec.MinArgs || (spec.MaxArgs >= 0 && len(args) > spec.MaxArgs) {
+		return errs.WrongArgs(strings.ToLower(spec.FullName()))
+	}
+	for _, arg := range args {
+		if arg.Type != resp.Bulk {
+			return errs.Errorf("%s arguments must be bulk strings", spec.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package command
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// invalidateChannel is the channel RESP2 clients subscribe to in order to
+// receive the invalidations redirected to them.
+const invalidateChannel = "__redis__:invalidate"
+
+// trackingState is the CLIENT TRACKING configuration of a client.
+type trackingState struct {
+	enabled  bool
+	redirect int64 // ID of the client receiving the invalidations, 0 for self
+	bcast    bool
+	optIn    bool
+	optOut   bool
+	noLoop   bool
+	prefixes []string // BCAST prefixes, none means all keys
+
+	// caching is the CLIENT CACHING yes/no override for the next command.
+	caching    bool
+	cachingSet bool
+}
+
+// TrackingTable remembers which clients may have cached which keys, and
+// sends them invalidation messages when those keys are modified.
+type TrackingTable struct {
+	clients *ClientList
+
+	mu       sync.Mutex
+	keys     map[string]map[int64]struct{} // key -> IDs of the clients that read it
+	prefixes map[string]map[int64]struct{} // BCAST prefix -> IDs of the subscribed clients
+}
+
+func newTrackingTable(clients *ClientList) *TrackingTable {
+	return &TrackingTable{
+		clients:  clients,
+		keys:     make(map[string]map[int64]struct{}),
+		prefixes: make(map[string]map[int64]struct{}),
+	}
+}
+
+// enable turns tracking on for a client with the given configuration.
+func (t *TrackingTable) enable(c *Client, state trackingState) {
+	t.disable(c)
+	c.mu.Lock()
+	c.tracking = state
+	c.mu.Unlock()
+	if !state.bcast {
+		return
+	}
+	prefixes := state.prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, prefix := range prefixes {
+		ids, ok := t.prefixes[prefix]
+		if !ok {
+			ids = make(map[int64]struct{})
+			t.prefixes[prefix] = ids
+		}
+		ids[c.ID] = struct{}{}
+	}
+}
+
+// disable turns tracking off for a client. Entries of the client left in
+// the key table are skipped and dropped when the key is next invalidated.
+func (t *TrackingTable) disable(c *Client) {
+	c.mu.Lock()
+	state := c.tracking
+	c.tracking = trackingState{}
+	c.mu.Unlock()
+	if !state.bcast {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for prefix, ids := range t.prefixes {
+		delete(ids, c.ID)
+		if len(ids) == 0 {
+			delete(t.prefixes, prefix)
+		}
+	}
+}
+
+// Disconnect stops tracking for a client that is going away.
+func (t *TrackingTable) Disconnect(c *Client) {
+	t.disable(c)
+}
+
+// Read records that the client has read keys with a read-only command, so
+// that it is told when they change. It also consumes the CLIENT CACHING
+// override, which only applies to the command that follows it.
+func (t *TrackingTable) Read(c *Client, keys []string) {
+	c.mu.Lock()
+	state := c.tracking
+	c.tracking.caching, c.tracking.cachingSet = false, false
+	c.mu.Unlock()
+	if !state.enabled || state.bcast || len(keys) == 0 {
+		return
+	}
+	if state.optIn && !(state.cachingSet && state.caching) {
+		return
+	}
+	if state.optOut && state.cachingSet && !state.caching {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		ids, ok := t.keys[key]
+		if !ok {
+			ids = make(map[int64]struct{})
+			t.keys[key] = ids
+		}
+		ids[c.ID] = struct{}{}
+	}
+}
+
+// Invalidate tells the clients tracking keys that they were modified by
+// the client writer, which may be nil for modifications made by the server
+// itself.
+func (t *TrackingTable) Invalidate(writer *Client, keys []string) {
+	pending := make(map[int64][]string)
+	t.mu.Lock()
+	for _, key := range keys {
+		for id := range t.keys[key] {
+			pending[id] = append(pending[id], key)
+		}
+		delete(t.keys, key)
+		for prefix, ids := range t.prefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			for id := range ids {
+				pending[id] = append(pending[id], key)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for id, keys := range pending {
+		c, ok := t.clients.Get(id)
+		if !ok {
+			continue
+		}
+		c.mu.Lock()
+		state := c.tracking
+		c.mu.Unlock()
+		if !state.enabled || (state.noLoop && c == writer) {
+			continue
+		}
+		t.send(c, state, replyBulkArray(dedup(keys)))
+	}
+}
+
+// InvalidateAll tells every tracking client that all keys were modified,
+// e.g. after FLUSHALL.
+func (t *TrackingTable) InvalidateAll() {
+	t.mu.Lock()
+	t.keys = make(map[string]map[int64]struct{})
+	t.mu.Unlock()
+	for _, c := range t.clients.All() {
+		c.mu.Lock()
+		state := c.tracking
+		c.mu.Unlock()
+		if state.enabled {
+			t.send(c, state, resp.NewNullArray())
+		}
+	}
+}
+
+// send delivers an invalidation message for keys to the client, or to the
+// client it redirects to. RESP3 clients get an "invalidate" push message.
+// RESP2 clients can only receive invalidations through a redirection, as
+// messages of the __redis__:invalidate channel they are subscribed to.
+func (t *TrackingTable) send(c *Client, state trackingState, keys resp.RespValue) {
+	target := c
+	if state.redirect != 0 {
+		redir, ok := t.clients.Get(state.redirect)
+		if !ok {
+			return
+		}
+		target = redir
+	}
+	if target.Protocol() >= 3 {
+		target.Push(resp.NewPush([]resp.RespValue{resp.NewBulk("invalidate"), keys}))
+	} else if state.redirect != 0 && target.isSubscribed(globalChannels, invalidateChannel) {
+		target.Push(resp.NewArray([]resp.RespValue{resp.NewBulk("message"), resp.NewBulk(invalidateChannel), keys}))
+	}
+}
+
+func dedup(keys []string) []string {
+	seen := make(map[string]struct{}, len(keys))
+	out := keys[:0]
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			out = append(out, key)
+		}
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+package command
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// ServerVersion is the Redis version whose behavior the server follows, as
+// it reports it in INFO server, HELLO and its startup log. Tools parse it
+// to decide which commands they may use. Builds may set it, along with
+// GitSHA1, with the linker:
+//
+//	go build -ldflags "-X github.com/liweiyuan/go-redis-server/command.ServerVersion=7.2.4 -X github.com/liweiyuan/go-redis-server/command.GitSHA1=$(git rev-parse --short=8 HEAD)"
+var ServerVersion = "7.2.0"
+
+// GitSHA1 is the commit the server was built from, reported as
+// redis_git_sha1 by INFO server, all zeros when the build does not set it.
+var GitSHA1 = "00000000"
+
+// VersionLine returns the line redis-server --version prints, such as
+// "Redis server v=7.2.0 sha=00000000:0 malloc=go1.22.5 bits=64": the Go
+// runtime stands for the allocator.
+func VersionLine() string {
+	return fmt.Sprintf("Redis server v=%s sha=%s:0 malloc=%s bits=%d", ServerVersion, GitSHA1, runtime.Version(), strconv.IntSize)
+}
+
+// SetTCPPort sets the port the server listens on, as INFO server reports it.
+func (cr *CommandRegistry) SetTCPPort(port int) {
+	cr.tcpPort = port
+}
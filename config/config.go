@@ -0,0 +1,483 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/keyslot"
+)
+
+// Config holds the server configuration.
+type Config struct {
+	Port          int      // TCP port to listen on
+	Bind          []string // Addresses to listen on, empty for all interfaces
+	ProtectedMode bool     // Refuse non-loopback clients when no bind address is set
+
+	// TCP socket options.
+	TCPBacklog    int   // Accept queue length of the listening socket
+	TCPNoDelay    bool  // Disable Nagle's algorithm on client connections
+	TCPSendBuffer int64 // Socket send buffer size, 0 for the system default
+	TCPRecvBuffer int64 // Socket receive buffer size, 0 for the system default
+
+	// Per-connection rate limits, zero means unlimited.
+	ClientRateLimitCommands int64 // Commands per second
+	ClientRateLimitBytes    int64 // Request bytes per second
+
+	RenameCommands []RenameCommand
+
+	KeyspaceStatsPrefixes []string // Key prefixes with separate hit/miss counters
+	BigKeysLogInterval    int      // Seconds between logs of the biggest keys, 0 disables them
+
+	PidFile          string // Path the process ID is written to, empty for none
+	LogFile          string // Path of the server log, empty for the standard error
+	LogRedirectStdio bool   // Redirect the standard output and error to LogFile
+
+	AuditLogFile     string // Audit log path, empty disables audit logging
+	AuditLogMaxSize  int64  // Size in bytes at which the audit log is rotated, 0 disables rotation
+	AuditLogMaxFiles int    // Number of rotated audit logs to keep
+
+	ACLFile string // File of the users, loaded at startup and by ACL LOAD, empty for none
+
+	Dir        string      // Directory of the snapshot file
+	DBFilename string      // Name of the snapshot file
+	SavePoints []SavePoint // Automatic snapshots, empty disables them
+
+	savePointsSet bool // A save directive replaced the default save points
+
+	AppendOnly               bool   // Log write commands to the append only file
+	AppendFilename           string // Base name of the append only files
+	AppendDirname            string // Directory of the append only files, in Dir
+	AppendFsync              string // always, everysec or no
+	AOFUseRDBPreamble        bool   // Rewrite the append only file as an RDB snapshot followed by commands
+	AOFLoadTruncated         bool   // Trim a truncated append only file at startup instead of refusing to start
+	AutoAOFRewritePercentage int    // Growth since the last rewrite that triggers one, 0 disables
+	AutoAOFRewriteMinSize    int64  // Size below which the file is not rewritten automatically
+
+	ReplyStreamThreshold int64 // Bulk reply size from which the payload bypasses the output buffer, 0 disables
+
+	// Request size limits, zero means unlimited.
+	ProtoMaxInlineLen      int   // Longest protocol line, such as a length header
+	ProtoMaxMultiBulkLen   int   // Most arguments in a request
+	ProtoMaxBulkLen        int64 // Longest argument
+	ClientQueryBufferLimit int64 // Most bytes in a request
+
+	ClientPipelineQueueLimit int64 // Bytes of pipelined requests read ahead of the one executing
+	MaxMemoryClients         int64 // Bytes the buffers of all clients may hold before the largest are evicted, 0 for no limit
+
+	ReplyWriteTimeout int // Seconds a reply may take to be written before the client is disconnected, 0 for no limit
+
+	BusyReplyThreshold int // Milliseconds a script runs before other clients are answered with -BUSY, 0 for never
+
+	EarlyExpireWindow int // Milliseconds of the window of probabilistic early expiration hints, 0 disables them
+
+	ShutdownTimeout int // Seconds a shutdown waits for the connections to finish their commands
+
+	// Writes are refused unless MinReplicasToWrite replicas lag at most
+	// MinReplicasMaxLag seconds behind; zero in either disables the check.
+	MinReplicasToWrite int
+	MinReplicasMaxLag  int
+
+	ClusterEnabled     bool          // Require the keys of a command to belong to the same hash slot
+	ClusterRemoteSlots []RemoteSlots // Hash slots served by other nodes, in cluster mode
+	ClusterProxy       bool          // Forward commands on remote slots instead of answering -MOVED
+
+	ActiveDefrag bool // Rebuild sets, hashes and sorted sets that shrank far below their peak length
+
+	HealthCheckAddr    string // Address of the HTTP health check endpoints, empty disables them
+	HealthCheckTimeout int    // Milliseconds the health check PING may take
+}
+
+// RenameCommand is a rename-command directive. An empty NewName disables
+// the command.
+type RenameCommand struct {
+	Name    string
+	NewName string
+}
+
+// RemoteSlots is a cluster-remote-slots directive: the hash slots First to
+// Last, inclusive, are served by the node at Addr.
+type RemoteSlots struct {
+	First int
+	Last  int
+	Addr  string
+}
+
+// SavePoint is a save directive: a snapshot is taken once Changes changes
+// were made and Seconds seconds passed since the last one.
+type SavePoint struct {
+	Seconds int
+	Changes int64
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Port:          6379,
+		ProtectedMode: true,
+
+		TCPBacklog: 511,
+		TCPNoDelay: true,
+
+		LogRedirectStdio: true,
+
+		AuditLogMaxSize:  100 * 1024 * 1024,
+		AuditLogMaxFiles: 5,
+
+		Dir:        ".",
+		DBFilename: "dump.rdb",
+		SavePoints: []SavePoint{{3600, 1}, {300, 100}, {60, 10000}},
+
+		AppendFilename:           "appendonly.aof",
+		AppendDirname:            "appendonlydir",
+		AppendFsync:              "everysec",
+		AOFUseRDBPreamble:        true,
+		AOFLoadTruncated:         true,
+		AutoAOFRewritePercentage: 100,
+		AutoAOFRewriteMinSize:    64 * 1024 * 1024,
+
+		ReplyStreamThreshold: 64 * 1024,
+
+		ProtoMaxInlineLen:      64 * 1024,
+		ProtoMaxMultiBulkLen:   1024 * 1024,
+		ProtoMaxBulkLen:        512 * 1024 * 1024,
+		ClientQueryBufferLimit: 1024 * 1024 * 1024,
+		ReplyWriteTimeout:      60,
+
+		ClientPipelineQueueLimit: 1024 * 1024,
+
+		BusyReplyThreshold: 5000,
+
+		ShutdownTimeout: 10,
+
+		MinReplicasMaxLag: 10,
+
+		HealthCheckTimeout: 1000,
+	}
+}
+
+// Load reads a redis.conf style configuration file. Each line holds a
+// directive followed by its arguments; blank lines and lines starting with
+// '#' are ignored.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := Default()
+	if err := cfg.Parse(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse applies the directives read from r to the configuration.
+func (c *Config) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			fields[i] = unquote(field)
+		}
+		if err := c.Set(fields[0], fields[1:]...); err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// ParseArgs applies command line overrides of the form --directive value...
+func (c *Config) ParseArgs(args []string) error {
+	for i := 0; i < len(args); {
+		if !strings.HasPrefix(args[i], "--") {
+			return fmt.Errorf("unexpected argument %q", args[i])
+		}
+		name := strings.TrimPrefix(args[i], "--")
+		i++
+		var values []string
+		for i < len(args) && !strings.HasPrefix(args[i], "--") {
+			values = append(values, args[i])
+			i++
+		}
+		if err := c.Set(name, values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set applies a single directive.
+func (c *Config) Set(name string, args ...string) error {
+	name = strings.ToLower(name)
+	var err error
+	switch name {
+	case "port":
+		c.Port, err = parseInt(name, args)
+	case "bind":
+		if len(args) == 0 {
+			return fmt.Errorf("wrong number of arguments for '%s'", name)
+		}
+		c.Bind = args
+	case "protected-mode":
+		c.ProtectedMode, err = parseBool(name, args)
+	case "tcp-backlog":
+		c.TCPBacklog, err = parseInt(name, args)
+	case "tcp-nodelay":
+		c.TCPNoDelay, err = parseBool(name, args)
+	case "tcp-sndbuf":
+		c.TCPSendBuffer, err = parseMemory(name, args)
+	case "tcp-rcvbuf":
+		c.TCPRecvBuffer, err = parseMemory(name, args)
+	case "client-rate-limit-commands":
+		c.ClientRateLimitCommands, err = parseInt64(name, args)
+	case "client-rate-limit-bytes":
+		c.ClientRateLimitBytes, err = parseMemory(name, args)
+	case "rename-command":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for '%s'", name)
+		}
+		c.RenameCommands = append(c.RenameCommands, RenameCommand{Name: args[0], NewName: args[1]})
+	case "keyspace-stats-prefixes":
+		c.KeyspaceStatsPrefixes = args
+	case "bigkeys-log-interval":
+		c.BigKeysLogInterval, err = parseInt(name, args)
+	case "pidfile":
+		c.PidFile, err = oneArg(name, args)
+	case "logfile":
+		c.LogFile, err = oneArg(name, args)
+	case "logfile-redirect-stdio":
+		c.LogRedirectStdio, err = parseBool(name, args)
+	case "daemonize":
+		// A Go process cannot fork itself into the background safely. It
+		// is started in the background by its init system or supervisor
+		// instead, with pidfile and logfile.
+		var daemonize bool
+		if daemonize, err = parseBool(name, args); err == nil && daemonize {
+			err = fmt.Errorf("'%s yes' is not supported, start the server in the background with pidfile and logfile instead", name)
+		}
+	case "audit-log-file":
+		c.AuditLogFile, err = oneArg(name, args)
+	case "audit-log-max-size":
+		c.AuditLogMaxSize, err = parseMemory(name, args)
+	case "audit-log-max-files":
+		c.AuditLogMaxFiles, err = parseInt(name, args)
+	case "aclfile":
+		c.ACLFile, err = oneArg(name, args)
+	case "dir":
+		c.Dir, err = oneArg(name, args)
+	case "dbfilename":
+		c.DBFilename, err = oneArg(name, args)
+	case "save":
+		err = c.setSavePoints(args)
+	case "appendonly":
+		c.AppendOnly, err = parseBool(name, args)
+	case "appendfilename":
+		c.AppendFilename, err = oneArg(name, args)
+	case "appenddirname":
+		c.AppendDirname, err = oneArg(name, args)
+	case "appendfsync":
+		c.AppendFsync, err = oneArg(name, args)
+		if err == nil && c.AppendFsync != "always" && c.AppendFsync != "everysec" && c.AppendFsync != "no" {
+			err = fmt.Errorf("argument for '%s' must be 'always', 'everysec' or 'no'", name)
+		}
+	case "aof-use-rdb-preamble":
+		c.AOFUseRDBPreamble, err = parseBool(name, args)
+	case "aof-load-truncated":
+		c.AOFLoadTruncated, err = parseBool(name, args)
+	case "auto-aof-rewrite-percentage":
+		c.AutoAOFRewritePercentage, err = parseInt(name, args)
+	case "auto-aof-rewrite-min-size":
+		c.AutoAOFRewriteMinSize, err = parseMemory(name, args)
+	case "reply-stream-threshold":
+		c.ReplyStreamThreshold, err = parseMemory(name, args)
+	case "proto-max-inline-len":
+		var n int64
+		n, err = parseMemory(name, args)
+		c.ProtoMaxInlineLen = int(n)
+	case "proto-max-multibulk-len":
+		c.ProtoMaxMultiBulkLen, err = parseInt(name, args)
+	case "proto-max-bulk-len":
+		c.ProtoMaxBulkLen, err = parseMemory(name, args)
+	case "client-query-buffer-limit":
+		c.ClientQueryBufferLimit, err = parseMemory(name, args)
+	case "client-pipeline-queue-limit":
+		c.ClientPipelineQueueLimit, err = parseMemory(name, args)
+	case "maxmemory-clients":
+		c.MaxMemoryClients, err = parseMemory(name, args)
+	case "reply-write-timeout":
+		c.ReplyWriteTimeout, err = parseInt(name, args)
+	case "busy-reply-threshold", "lua-time-limit":
+		c.BusyReplyThreshold, err = parseInt(name, args)
+	case "early-expire-window":
+		c.EarlyExpireWindow, err = parseInt(name, args)
+	case "shutdown-timeout":
+		c.ShutdownTimeout, err = parseInt(name, args)
+	case "min-replicas-to-write", "min-slaves-to-write":
+		c.MinReplicasToWrite, err = parseInt(name, args)
+	case "min-replicas-max-lag", "min-slaves-max-lag":
+		c.MinReplicasMaxLag, err = parseInt(name, args)
+	case "cluster-enabled":
+		c.ClusterEnabled, err = parseBool(name, args)
+	case "cluster-remote-slots":
+		err = c.addRemoteSlots(args)
+	case "cluster-proxy":
+		c.ClusterProxy, err = parseBool(name, args)
+	case "activedefrag":
+		c.ActiveDefrag, err = parseBool(name, args)
+	case "lazyfree-lazy-user-del", "lazyfree-lazy-expire", "lazyfree-lazy-server-del", "lazyfree-lazy-eviction", "lazyfree-lazy-user-flush":
+		// Removing a value only drops a reference, and the garbage
+		// collector reclaims it in the background, so values are always
+		// freed lazily. The directives are accepted for redis.conf files.
+		_, err = parseBool(name, args)
+	case "health-check-addr":
+		c.HealthCheckAddr, err = oneArg(name, args)
+	case "health-check-timeout":
+		c.HealthCheckTimeout, err = parseInt(name, args)
+	default:
+		return fmt.Errorf("unknown directive '%s'", name)
+	}
+	return err
+}
+
+// addRemoteSlots applies a cluster-remote-slots directive, such as
+// "cluster-remote-slots 0-5460 10.0.0.2:6379". A single slot may be given
+// instead of a range.
+func (c *Config) addRemoteSlots(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("wrong number of arguments for 'cluster-remote-slots'")
+	}
+	first, last, isRange := strings.Cut(args[0], "-")
+	if !isRange {
+		last = first
+	}
+	rs := RemoteSlots{Addr: args[1]}
+	var err1, err2 error
+	rs.First, err1 = strconv.Atoi(first)
+	rs.Last, err2 = strconv.Atoi(last)
+	if err1 != nil || err2 != nil || rs.First < 0 || rs.First > rs.Last || rs.Last >= keyslot.Count {
+		return fmt.Errorf("invalid slot range '%s'", args[0])
+	}
+	if _, _, err := net.SplitHostPort(rs.Addr); err != nil {
+		return fmt.Errorf("invalid node address '%s'", rs.Addr)
+	}
+	c.ClusterRemoteSlots = append(c.ClusterRemoteSlots, rs)
+	return nil
+}
+
+// setSavePoints applies a save directive. The first one replaces the
+// default save points and later ones add to them, so a config file can list
+// one save point per line. save "" disables automatic snapshots.
+func (c *Config) setSavePoints(args []string) error {
+	if !c.savePointsSet {
+		c.SavePoints = nil
+		c.savePointsSet = true
+	}
+	if len(args) == 1 && args[0] == "" {
+		c.SavePoints = nil
+		return nil
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return fmt.Errorf("wrong number of arguments for 'save'")
+	}
+	for i := 0; i < len(args); i += 2 {
+		seconds, err := strconv.Atoi(args[i])
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("invalid save seconds '%s'", args[i])
+		}
+		changes, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return fmt.Errorf("invalid save changes '%s'", args[i+1])
+		}
+		c.SavePoints = append(c.SavePoints, SavePoint{Seconds: seconds, Changes: changes})
+	}
+	return nil
+}
+
+// unquote strips the double quotes around a config file argument, so that
+// "" can be used to pass an empty string.
+func unquote(arg string) string {
+	if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+func oneArg(name string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("wrong number of arguments for '%s'", name)
+	}
+	return args[0], nil
+}
+
+func parseBool(name string, args []string) (bool, error) {
+	arg, err := oneArg(name, args)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(arg) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("argument for '%s' must be 'yes' or 'no'", name)
+}
+
+func parseInt(name string, args []string) (int, error) {
+	n, err := parseInt64(name, args)
+	return int(n), err
+}
+
+func parseInt64(name string, args []string) (int64, error) {
+	arg, err := oneArg(name, args)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value '%s' for '%s'", arg, name)
+	}
+	return n, nil
+}
+
+// parseMemory parses a byte count with an optional k/kb/m/mb/g/gb unit.
+func parseMemory(name string, args []string) (int64, error) {
+	arg, err := oneArg(name, args)
+	if err != nil {
+		return 0, err
+	}
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	lower := strings.ToLower(arg)
+	scale := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory value '%s' for '%s'", arg, name)
+	}
+	return n * scale, nil
+}
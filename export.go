@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/liweiyuan/go-redis-server/persistence"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// dumpArgs are the arguments of the export and import subcommands.
+type dumpArgs struct {
+	file   string // --out for export, --in for import; - for stdout or stdin
+	format string
+	config []string // Config file and directives, as the server takes them
+}
+
+// parseDumpArgs extracts fileFlag and --format from args.
+func parseDumpArgs(args []string, fileFlag string) (*dumpArgs, error) {
+	da := &dumpArgs{file: "-"}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case fileFlag, "--format":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing argument for '%s'", args[i])
+			}
+			if args[i] == fileFlag {
+				da.file = args[i+1]
+			} else {
+				da.format = args[i+1]
+			}
+			i++
+		default:
+			da.config = append(da.config, args[i])
+		}
+	}
+	if da.format == "" {
+		da.format = persistence.FormatOf(da.file)
+	}
+	return da, nil
+}
+
+// runExport writes the dataset of the snapshot file in a readable format:
+//
+//	go-redis-server export [config] [--directive value...] [--out file] [--format json|csv]
+func runExport(args []string) error {
+	da, err := parseDumpArgs(args, "--out")
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(da.config)
+	if err != nil {
+		return err
+	}
+	s := storage.NewStorage()
+	if err := persistence.New(filepath.Join(cfg.Dir, cfg.DBFilename)).Load(s); err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if da.file != "-" {
+		f, err := os.Create(da.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := persistence.Export(s, w, da.format); err != nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
+
+// runImport adds the keys of a file written by export to the snapshot
+// file, which the server loads at startup:
+//
+//	go-redis-server import [config] [--directive value...] [--in file] [--format json|csv]
+func runImport(args []string) error {
+	da, err := parseDumpArgs(args, "--in")
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(da.config)
+	if err != nil {
+		return err
+	}
+	snapshotter := persistence.New(filepath.Join(cfg.Dir, cfg.DBFilename))
+	s := storage.NewStorage()
+	if err := snapshotter.Load(s); err != nil {
+		return err
+	}
+	var r io.Reader = os.Stdin
+	if da.file != "-" {
+		f, err := os.Open(da.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if err := persistence.Import(s, r, da.format); err != nil {
+		return fmt.Errorf("%s: %w", da.file, err)
+	}
+	return snapshotter.Save(s)
+}
@@ -1,3 +1,5 @@
 module github.com/liweiyuan/go-redis-server
 
 go 1.22.0
+
+require github.com/yuin/gopher-lua v1.1.1
@@ -0,0 +1,121 @@
+// Package errs is the catalog of the error replies shared by the commands
+// and the storage. Every error reply starts with a code, ERR for generic
+// errors, that client libraries match to tell errors apart.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is an error reply: a code followed by a message.
+type Error struct {
+	Code string // Such as ERR, WRONGTYPE or NOSCRIPT
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Code + " " + e.Msg
+}
+
+// New returns an error reply with the given code and message.
+func New(code, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+// Errorf returns an ERR error reply with the formatted message.
+func Errorf(format string, args ...any) *Error {
+	return New("ERR", fmt.Sprintf(format, args...))
+}
+
+// The errors shared by several commands, with the messages of Redis.
+var (
+	WrongType       = New("WRONGTYPE", "Operation against a key holding the wrong kind of value")
+	NotInteger      = New("ERR", "value is not an integer or out of range")
+	NotPositive     = New("ERR", "value is out of range, must be positive")
+	NotFloat        = New("ERR", "value is not a valid float")
+	NotFloatBound   = New("ERR", "min or max is not a float")
+	Syntax          = New("ERR", "syntax error")
+	NoSuchKey       = New("ERR", "no such key")
+	SameObject      = New("ERR", "source and destination objects are the same")
+	OutOfRange      = New("ERR", "index out of range")
+	Overflow        = New("ERR", "increment or decrement would overflow")
+	StringTooLong   = New("ERR", "string exceeds maximum allowed size (proto-max-bulk-len)")
+	NoScript        = New("NOSCRIPT", "No matching script. Please use EVAL.")
+	NoFunction      = New("ERR", "Function not found")
+	BusyScript      = New("BUSY", "Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+	BusyFunction    = New("BUSY", "Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.")
+	NotBusy         = New("NOTBUSY", "No scripts in execution right now.")
+	Unkillable      = New("UNKILLABLE", "Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+	ScriptKilled    = New("ERR", "Script killed by user with SCRIPT KILL...")
+	FunctionKilled  = New("ERR", "Script killed by user with FUNCTION KILL...")
+	InvalidStreamID = New("ERR", "Invalid stream ID specified as stream command argument")
+	NegativeTimeout = New("ERR", "timeout is negative")
+	NoPersistence   = New("ERR", "persistence is not configured")
+)
+
+// NeedsClient returns the error of a command that needs the calling
+// client, such as AUTH or SUBSCRIBE, run without one, as by a health
+// check.
+func NeedsClient(name string) *Error {
+	return Errorf("%s requires a client connection", name)
+}
+
+// WrongArgs returns the error of a command called with the wrong number
+// of arguments. Subcommands are named as in "client|setname".
+func WrongArgs(name string) *Error {
+	return Errorf("wrong number of arguments for '%s' command", name)
+}
+
+// UnknownSubcommand returns the error of an unknown subcommand of the
+// named command.
+func UnknownSubcommand(name, subcommand string) *Error {
+	return Errorf("unknown subcommand '%s'. Try %s HELP.", subcommand, name)
+}
+
+// UnknownCommand returns the error of an unknown command, which quotes its
+// name and the beginning of its arguments, up to 128 bytes of each, as
+// Redis does.
+func UnknownCommand(name string, args []string) *Error {
+	const limit = 128
+	var quoted []byte
+	for _, arg := range args {
+		if len(quoted) >= limit {
+			break
+		}
+		quoted = append(quoted, '\'')
+		quoted = append(quoted, arg[:min(len(arg), limit-len(quoted)+1)]...)
+		quoted = append(quoted, "' "...)
+	}
+	return Errorf("unknown command '%s', with args beginning with: %s", name[:min(len(name), limit)], quoted)
+}
+
+// Reply returns the text of the error reply for err. Errors of the catalog
+// keep their code; any other error, such as one returned by the standard
+// library, gets the ERR code unless its text starts with one.
+func Reply(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Error()
+	}
+	msg := err.Error()
+	if hasCode(msg) {
+		return msg
+	}
+	return "ERR " + msg
+}
+
+// hasCode reports whether msg starts with an error code: an upper case
+// word followed by a space.
+func hasCode(msg string) bool {
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c == ' ' {
+			return i > 0
+		}
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// Package geohash encodes coordinates as the scores Redis stores geospatial
+// members of sorted sets with, and measures distances between them as
+// Redis does.
+//
+// A position is encoded as a 52 bit geohash: the longitude and latitude are
+// each mapped to 26 bits, dividing their range in halves, and interleaved,
+// latitude bits in the even positions. Latitudes are limited to the range
+// of Web Mercator, ±85.05112878 degrees, rather than ±90, so a position
+// decodes to the center of its cell, within about 0.6 meters.
+package geohash
+
+import "math"
+
+const (
+	steps = 26 // Bits of each coordinate
+
+	LonMin = -180.0
+	LonMax = 180.0
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	earthRadius = 6372797.560856 // Meters, as Redis measures the earth
+)
+
+const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Valid reports whether lon and lat can be encoded.
+func Valid(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// Encode returns the geohash of lon and lat, within the limits of Valid.
+func Encode(lon, lat float64) uint64 {
+	return encode(lon, lat, LonMin, LonMax, LatMin, LatMax)
+}
+
+// encode returns the geohash of lon and lat in the given ranges.
+func encode(lon, lat, lonMin, lonMax, latMin, latMax float64) uint64 {
+	latOffset := (lat - latMin) / (latMax - latMin) * (1 << steps)
+	lonOffset := (lon - lonMin) / (lonMax - lonMin) * (1 << steps)
+	return interleave(uint32(latOffset), uint32(lonOffset))
+}
+
+// Decode returns the longitude and latitude of the center of the cell of
+// hash, clamped to the limits of Valid.
+func Decode(hash uint64) (lon, lat float64) {
+	ilat, ilon := deinterleave(hash)
+	const scale = 1 << steps
+	latLo := LatMin + float64(ilat)/scale*(LatMax-LatMin)
+	latHi := LatMin + float64(ilat+1)/scale*(LatMax-LatMin)
+	lonLo := LonMin + float64(ilon)/scale*(LonMax-LonMin)
+	lonHi := LonMin + float64(ilon+1)/scale*(LonMax-LonMin)
+	lon = min(max((lonLo+lonHi)/2, LonMin), LonMax)
+	lat = min(max((latLo+latHi)/2, LatMin), LatMax)
+	return lon, lat
+}
+
+// interleave spreads the bits of x to the even positions and those of y to
+// the odd ones.
+func interleave(x, y uint32) uint64 {
+	var h uint64
+	for i := 0; i < 32; i++ {
+		h |= uint64(x>>i&1)<<(2*i) | uint64(y>>i&1)<<(2*i+1)
+	}
+	return h
+}
+
+// deinterleave undoes interleave.
+func deinterleave(h uint64) (x, y uint32) {
+	for i := 0; i < 32; i++ {
+		x |= uint32(h>>(2*i)&1) << i
+		y |= uint32(h>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+// String returns the standard 11 character geohash of the position hash
+// stands for, as GEOHASH replies: the position is encoded again with the
+// latitude range of ±90 degrees, and the 11th character, for which there
+// are no bits left, is always 0.
+func String(hash uint64) string {
+	lon, lat := Decode(hash)
+	std := encode(lon, lat, -180, 180, -90, 90)
+	var buf [11]byte
+	for i := 0; i < 10; i++ {
+		buf[i] = alphabet[std>>(52-(i+1)*5)&0x1f]
+	}
+	buf[10] = alphabet[0]
+	return string(buf[:])
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// latDistance returns the distance in meters between two latitudes on the
+// same meridian.
+func latDistance(lat1, lat2 float64) float64 {
+	return earthRadius * math.Abs(radians(lat2)-radians(lat1))
+}
+
+// Distance returns the distance in meters between two positions, with the
+// haversine formula.
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	v := math.Sin((radians(lon2) - radians(lon1)) / 2)
+	if v == 0 {
+		return latDistance(lat1, lat2)
+	}
+	lat1r, lat2r := radians(lat1), radians(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// InBox reports whether the position lon, lat lies within the box of
+// width and height meters centered on clon, clat, and returns its distance
+// from the center.
+func InBox(clon, clat, width, height, lon, lat float64) (float64, bool) {
+	if latDistance(lat, clat) > height/2 {
+		return 0, false
+	}
+	if Distance(lon, lat, clon, lat) > width/2 {
+		return 0, false
+	}
+	return Distance(clon, clat, lon, lat), true
+}
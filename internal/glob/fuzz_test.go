@@ -0,0 +1,29 @@
+package glob
+
+import (
+	"testing"
+	"time"
+)
+
+// slowMatch is the time after which a match counts as a failure: matching
+// is bounded so that patterns cannot spend the CPU of the server.
+const slowMatch = time.Second
+
+// FuzzMatch matches strings against patterns, both with and without case.
+func FuzzMatch(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"*", "abc"}, {"a*b?c", "axxbyc"}, {"[a-z]*[^0-9]", "key1"}, {"\\*", "*"}, {"[", "["},
+		{"*a*a*a*a*a*a*a*a*b", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		{"?*?*?*?*?*?*?*?*!", "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, pattern, str string) {
+		start := time.Now()
+		Match(pattern, str)
+		MatchNoCase(pattern, str)
+		if elapsed := time.Since(start); elapsed > slowMatch {
+			t.Fatalf("matching a %d-byte pattern against a %d-byte string took %v", len(pattern), len(str), elapsed)
+		}
+	})
+}
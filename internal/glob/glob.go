@@ -0,0 +1,196 @@
+// Package glob implements the Redis glob-style pattern matching used by
+// KEYS, PSUBSCRIBE, PUBSUB CHANNELS and other commands taking a pattern.
+//
+// A '*' matches any sequence of characters, including none, and a '?' any
+// single character. A bracket expression matches one character from a set:
+// [abc] one of the listed characters, [^abc] any character but those, and
+// [a-z] a character in the range. A backslash matches the following
+// character literally.
+//
+// Matching is bounded so that a pattern cannot be used to spend the CPU of
+// the server, as KEYS or SCAN MATCH run it against every key: a match
+// giving up, on too deep a recursion or after too many steps, reports that
+// the string does not match.
+package glob
+
+import "math/rand"
+
+const (
+	// maxNesting bounds the recursion on '*'.
+	maxNesting = 1000
+	// maxSteps bounds the pattern characters a match compares, counting
+	// those compared again as a '*' backtracks. Linear matches of strings
+	// up to a few megabytes stay well within it.
+	maxSteps = 1 << 22
+)
+
+// matcher holds the state of a match across the recursion on '*'.
+type matcher struct {
+	nocase bool
+	// skipLonger is set once the rest of the pattern cannot match, which
+	// ends the match.
+	skipLonger bool
+	steps      int
+}
+
+// Match reports whether str matches pattern.
+func Match(pattern, str string) bool {
+	m := matcher{}
+	return m.match(pattern, str, 0)
+}
+
+// MatchNoCase reports whether str matches pattern, ignoring ASCII case.
+func MatchNoCase(pattern, str string) bool {
+	m := matcher{nocase: true}
+	return m.match(pattern, str, 0)
+}
+
+func (m *matcher) match(pattern, str string, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+	nocase := m.nocase
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		if m.steps++; m.steps > maxSteps {
+			m.skipLonger = true
+			return false
+		}
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for s < len(str) {
+				if m.match(pattern[p+1:], str[s:], nesting+1) {
+					return true
+				}
+				if m.skipLonger {
+					return false
+				}
+				s++
+			}
+			// The rest of the pattern matches nowhere in the rest of the
+			// string, so letting an earlier '*' consume more characters
+			// cannot help either.
+			m.skipLonger = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			matched := false
+			for ; ; m.steps++ {
+				if p >= len(pattern) {
+					// Unterminated class, treat the end of the pattern as ']'.
+					p = len(pattern) - 1
+					break
+				}
+				if pattern[p] == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						matched = true
+					}
+				} else if pattern[p] == ']' {
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end, c := pattern[p], pattern[p+2], str[s]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = lower(start), lower(end), lower(c)
+					}
+					p += 2
+					if c >= start && c <= end {
+						matched = true
+					}
+				} else if equal(pattern[p], str[s], nocase) {
+					matched = true
+				}
+				p++
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			fallthrough
+		default:
+			if !equal(pattern[p], str[s], nocase) {
+				return false
+			}
+			s++
+		}
+		p++
+	}
+	if s == len(str) {
+		for p < len(pattern) && pattern[p] == '*' {
+			p++
+		}
+	}
+	return p == len(pattern) && s == len(str)
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// fuzzAlphabet is that of the patterns and strings FuzzTest generates:
+// mostly wildcards and bracket syntax, which make for pathological
+// patterns.
+const fuzzAlphabet = "**??[]^-\\abAB"
+
+// FuzzTest matches cycles random strings against random patterns of up to
+// 32 bytes, as DEBUG STRINGMATCH-LEN does, and returns the number of
+// matches. Half of the bytes are random, the others drawn from wildcards
+// and bracket syntax, so that malformed and pathological patterns are
+// frequent.
+func FuzzTest(rnd *rand.Rand, cycles int) int {
+	var pattern, str [32]byte
+	matches := 0
+	for ; cycles > 0; cycles-- {
+		p := fuzzFill(rnd, pattern[:rnd.Intn(len(pattern))])
+		s := fuzzFill(rnd, str[:rnd.Intn(len(str))])
+		if Match(p, s) {
+			matches++
+		}
+	}
+	return matches
+}
+
+// fuzzFill fills b with random bytes for FuzzTest and returns it as a
+// string.
+func fuzzFill(rnd *rand.Rand, b []byte) string {
+	for i := range b {
+		if rnd.Intn(2) == 0 {
+			b[i] = byte(rnd.Intn(256))
+		} else {
+			b[i] = fuzzAlphabet[rnd.Intn(len(fuzzAlphabet))]
+		}
+	}
+	return string(b)
+}
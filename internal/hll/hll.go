@@ -0,0 +1,522 @@
+// Package hll implements the HyperLogLog strings of Redis, byte for byte,
+// so values can move between this server and Redis through RDB files,
+// DUMP and RESTORE, or plain GET and SET, and give the same estimates.
+//
+// A HyperLogLog is a 16 byte header followed by 16384 registers of 6 bits.
+// The header holds the "HYLL" magic, the encoding and the cardinality last
+// computed, little-endian, whose most significant bit is set when it is
+// stale. Registers are stored densely, packed least significant bit first,
+// or sparsely as a run-length encoding made of three opcodes:
+//
+//	00xxxxxx           ZERO: xxxxxx+1 registers set to 0, up to 64
+//	01xxxxxx yyyyyyyy  XZERO: xxxxxxyyyyyyyy+1 registers set to 0, up to 16384
+//	1vvvvvxx           VAL: xx+1 registers set to vvvvv+1, up to 4 of them
+//
+// Sparse HyperLogLogs are promoted to dense once a register exceeds 32 or
+// they grow past SparseMaxBytes.
+package hll
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+const (
+	p         = 14 // Bits of the hash selecting a register
+	q         = 64 - p
+	Registers = 1 << p // Number of registers
+
+	regBits    = 6
+	regMax     = 1<<regBits - 1
+	HeaderSize = 16
+	DenseSize  = HeaderSize + (Registers*regBits+7)/8
+
+	dense  = 0
+	sparse = 1
+
+	// SparseMaxBytes is the size past which a sparse HyperLogLog is
+	// promoted, the default hll-sparse-max-bytes of Redis.
+	SparseMaxBytes = 3000
+
+	xzeroBit       = 0x40
+	valBit         = 0x80
+	valMaxValue    = 32
+	valMaxLen      = 4
+	zeroMaxLen     = 64
+	xzeroMaxLen    = 16384
+	alphaInf       = 0.721347520444481703680 // 0.5/ln(2)
+	hashSeed       = 0xadc83b19
+	cacheStaleBit  = 1 << 7
+	encodingOffset = 4
+	cardOffset     = 8
+)
+
+// ErrInvalid is returned for a HyperLogLog whose sparse representation is
+// corrupted.
+var ErrInvalid = errors.New("hll: corrupted sparse representation")
+
+// New returns an empty HyperLogLog, sparse, with all its registers covered
+// by XZERO opcodes and a cached cardinality of 0.
+func New() []byte {
+	b := make([]byte, HeaderSize, HeaderSize+(Registers+xzeroMaxLen-1)/xzeroMaxLen*2)
+	copy(b, "HYLL")
+	b[encodingOffset] = sparse
+	for n := Registers; n > 0; n -= xzeroMaxLen {
+		b = appendXZero(b, min(n, xzeroMaxLen))
+	}
+	return b
+}
+
+// Valid reports whether s looks like a HyperLogLog: it has the magic and a
+// known encoding, and the size of the registers if they are dense. Sparse
+// opcodes are only checked when they are read.
+func Valid(s string) bool {
+	if len(s) < HeaderSize || s[:4] != "HYLL" {
+		return false
+	}
+	switch s[encodingOffset] {
+	case dense:
+		return len(s) == DenseSize
+	case sparse:
+		return true
+	}
+	return false
+}
+
+// IsSparse reports whether the valid HyperLogLog b is sparse.
+func IsSparse(b []byte) bool {
+	return b[encodingOffset] == sparse
+}
+
+// Cached returns the cardinality cached in the header of b, and whether it
+// is still valid.
+func Cached(b []byte) (uint64, bool) {
+	var card uint64
+	for i := 7; i >= 0; i-- {
+		card = card<<8 | uint64(b[cardOffset+i])
+	}
+	return card, b[cardOffset+7]&cacheStaleBit == 0
+}
+
+// SetCached caches card in the header of b.
+func SetCached(b []byte, card uint64) {
+	for i := 0; i < 8; i++ {
+		b[cardOffset+i] = byte(card >> (8 * i))
+	}
+}
+
+// Invalidate marks the cardinality cached in b as stale.
+func Invalidate(b []byte) {
+	b[cardOffset+7] |= cacheStaleBit
+}
+
+// hash returns the register elem falls in, and the length of the run of
+// zeros that follows in its hash, plus one, which is the value the
+// register takes if it is larger.
+func hash(elem string) (index int, count uint8) {
+	h := murmurHash64A(elem, hashSeed)
+	index = int(h & (Registers - 1))
+	h >>= p
+	h |= 1 << q // Make sure the loop terminates
+	return index, uint8(bits.TrailingZeros64(h) + 1)
+}
+
+// murmurHash64A is the MurmurHash2 variant Redis hashes elements with,
+// reading 8 byte blocks little-endian.
+func murmurHash64A(key string, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	n := len(key)
+	h := seed ^ uint64(n)*m
+	for len(key) >= 8 {
+		k := uint64(key[0]) | uint64(key[1])<<8 | uint64(key[2])<<16 | uint64(key[3])<<24 |
+			uint64(key[4])<<32 | uint64(key[5])<<40 | uint64(key[6])<<48 | uint64(key[7])<<56
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+	switch len(key) {
+	case 7:
+		h ^= uint64(key[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(key[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(key[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(key[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(key[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(key[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(key[0])
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// denseGet returns register i of the dense registers regs.
+func denseGet(regs []byte, i int) uint8 {
+	byteIdx, fb := i*regBits/8, uint(i*regBits&7)
+	v := regs[byteIdx] >> fb
+	if byteIdx+1 < len(regs) {
+		v |= regs[byteIdx+1] << (8 - fb)
+	}
+	return v & regMax
+}
+
+// denseSet sets register i of the dense registers regs to v.
+func denseSet(regs []byte, i int, v uint8) {
+	byteIdx, fb := i*regBits/8, uint(i*regBits&7)
+	regs[byteIdx] &^= regMax << fb
+	regs[byteIdx] |= v << fb
+	if byteIdx+1 < len(regs) {
+		regs[byteIdx+1] &^= regMax >> (8 - fb)
+		regs[byteIdx+1] |= v >> (8 - fb)
+	}
+}
+
+// Sparse opcodes.
+func isZero(op byte) bool   { return op&0xc0 == 0 }
+func isXZero(op byte) bool  { return op&0xc0 == xzeroBit }
+func isVal(op byte) bool    { return op&valBit != 0 }
+func zeroLen(op byte) int   { return int(op&0x3f) + 1 }
+func valValue(op byte) int  { return int(op>>2&0x1f) + 1 }
+func valLen(op byte) int    { return int(op&0x3) + 1 }
+func xzeroLen(b []byte) int { return (int(b[0]&0x3f)<<8 | int(b[1])) + 1 }
+
+func val(v, n int) byte { return byte((v-1)<<2|(n-1)) | valBit }
+
+func appendXZero(b []byte, n int) []byte {
+	return append(b, byte((n-1)>>8)|xzeroBit, byte(n-1))
+}
+
+// appendZeros appends the opcode covering n zero registers.
+func appendZeros(b []byte, n int) []byte {
+	if n > zeroMaxLen {
+		return appendXZero(b, n)
+	}
+	return append(b, byte(n-1))
+}
+
+// Add adds elem to the HyperLogLog b, in place or in the slice returned,
+// and reports whether a register changed. It does not invalidate the
+// cached cardinality.
+func Add(b []byte, elem string) ([]byte, bool, error) {
+	index, count := hash(elem)
+	if IsSparse(b) {
+		return sparseSet(b, index, count)
+	}
+	regs := b[HeaderSize:]
+	if denseGet(regs, index) >= count {
+		return b, false, nil
+	}
+	denseSet(regs, index, count)
+	return b, true, nil
+}
+
+// sparseSet raises register index of the sparse HyperLogLog b to count,
+// splitting the opcode covering it and merging the VAL opcodes around the
+// change as Redis does, so both build the same bytes from the same adds.
+// It promotes b if count does not fit a VAL opcode or b grows too large.
+func sparseSet(b []byte, index int, count uint8) ([]byte, bool, error) {
+	if count > valMaxValue {
+		return promote(b, index, count)
+	}
+	// Find the opcode covering the register.
+	pos, prev, first, span := HeaderSize, -1, 0, 0
+	for pos < len(b) {
+		oplen := 1
+		switch op := b[pos]; {
+		case isZero(op):
+			span = zeroLen(op)
+		case isVal(op):
+			span = valLen(op)
+		default:
+			if pos+1 >= len(b) {
+				return b, false, ErrInvalid
+			}
+			span = xzeroLen(b[pos:])
+			oplen = 2
+		}
+		if index <= first+span-1 {
+			break
+		}
+		prev = pos
+		pos += oplen
+		first += span
+	}
+	if span == 0 || pos >= len(b) {
+		return b, false, ErrInvalid
+	}
+	op := b[pos]
+	switch {
+	case isVal(op) && valValue(op) >= int(count):
+		return b, false, nil
+	case isVal(op) && valLen(op) == 1, isZero(op) && zeroLen(op) == 1:
+		b[pos] = val(int(count), 1)
+	default:
+		// Split the opcode around the register.
+		last := first + span - 1
+		seq := make([]byte, 0, 5)
+		oldlen := 1
+		if isVal(op) {
+			cur := valValue(op)
+			if index != first {
+				seq = append(seq, val(cur, index-first))
+			}
+			seq = append(seq, val(int(count), 1))
+			if index != last {
+				seq = append(seq, val(cur, last-index))
+			}
+		} else {
+			if isXZero(op) {
+				oldlen = 2
+			}
+			if index != first {
+				seq = appendZeros(seq, index-first)
+			}
+			seq = append(seq, val(int(count), 1))
+			if index != last {
+				seq = appendZeros(seq, last-index)
+			}
+		}
+		if delta := len(seq) - oldlen; delta > 0 && len(b)+delta > SparseMaxBytes {
+			return promote(b, index, count)
+		}
+		rest := b[pos+oldlen:]
+		b = append(b[:pos:pos], append(seq, rest...)...)
+	}
+	// Merge adjacent VAL opcodes of the same value, scanning up to five
+	// opcodes from the one before the change.
+	pos = HeaderSize
+	if prev >= 0 {
+		pos = prev
+	}
+	for scan := 5; pos < len(b) && scan > 0; scan-- {
+		op := b[pos]
+		switch {
+		case isXZero(op):
+			pos += 2
+			continue
+		case isZero(op):
+			pos++
+			continue
+		}
+		if pos+1 < len(b) && isVal(b[pos+1]) && valValue(op) == valValue(b[pos+1]) {
+			if n := valLen(op) + valLen(b[pos+1]); n <= valMaxLen {
+				b[pos+1] = val(valValue(op), n)
+				b = append(b[:pos], b[pos+1:]...)
+				continue
+			}
+		}
+		pos++
+	}
+	return b, true, nil
+}
+
+// promote converts the sparse HyperLogLog b to dense and sets register
+// index to count, which is larger than it.
+func promote(b []byte, index int, count uint8) ([]byte, bool, error) {
+	d, err := ToDense(b)
+	if err != nil {
+		return b, false, err
+	}
+	denseSet(d[HeaderSize:], index, count)
+	return d, true, nil
+}
+
+// ToDense returns the HyperLogLog b with dense registers, b itself if they
+// already are. The header, and so the cached cardinality, is kept.
+func ToDense(b []byte) ([]byte, error) {
+	if !IsSparse(b) {
+		return b, nil
+	}
+	d := make([]byte, DenseSize)
+	copy(d, b[:HeaderSize])
+	d[encodingOffset] = dense
+	err := sparseRuns(b, func(i, v, n int) {
+		for ; n > 0; n-- {
+			denseSet(d[HeaderSize:], i, uint8(v))
+			i++
+		}
+	})
+	return d, err
+}
+
+// sparseRuns calls f for each run of n registers from register i set to a
+// value v other than 0 of the sparse HyperLogLog b, in order. It fails if
+// the runs do not cover the registers exactly.
+func sparseRuns(b []byte, f func(i, v, n int)) error {
+	covered := 0
+	for pos := HeaderSize; pos < len(b); {
+		v, n := 0, 0
+		switch op := b[pos]; {
+		case isZero(op):
+			n = zeroLen(op)
+			pos++
+		case isXZero(op):
+			if pos+1 >= len(b) {
+				return ErrInvalid
+			}
+			n = xzeroLen(b[pos:])
+			pos += 2
+		default:
+			v, n = valValue(op), valLen(op)
+			pos++
+		}
+		if covered+n > Registers {
+			return ErrInvalid
+		}
+		if v > 0 {
+			f(covered, v, n)
+		}
+		covered += n
+	}
+	if covered != Registers {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Merge raises each of the registers regs, Registers of them, to the one
+// of the HyperLogLog b if larger.
+func Merge(regs []uint8, b []byte) error {
+	if !IsSparse(b) {
+		for i := range regs {
+			regs[i] = max(regs[i], denseGet(b[HeaderSize:], i))
+		}
+		return nil
+	}
+	return sparseRuns(b, func(i, v, n int) {
+		for ; n > 0; n-- {
+			regs[i] = max(regs[i], uint8(v))
+			i++
+		}
+	})
+}
+
+// Load returns the registers of the HyperLogLog b, one byte each.
+func Load(b []byte) ([]uint8, error) {
+	regs := make([]uint8, Registers)
+	return regs, Merge(regs, b)
+}
+
+// Store sets the registers of the HyperLogLog b to regs, raising them,
+// and returns it, promoted if needed. The caller converts b to dense first
+// if it wants dense registers, as PFMERGE does.
+func Store(b []byte, regs []uint8) ([]byte, error) {
+	var err error
+	for i, v := range regs {
+		switch {
+		case v == 0:
+		case IsSparse(b):
+			b, _, err = sparseSet(b, i, v)
+			if err != nil {
+				return b, err
+			}
+		default:
+			if denseGet(b[HeaderSize:], i) < v {
+				denseSet(b[HeaderSize:], i, v)
+			}
+		}
+	}
+	return b, nil
+}
+
+// Count returns the estimated cardinality of the HyperLogLog b.
+func Count(b []byte) (uint64, error) {
+	regs, err := Load(b)
+	if err != nil {
+		return 0, err
+	}
+	return Estimate(regs), nil
+}
+
+// Estimate returns the cardinality estimated from registers regs with the
+// estimator of Otmar Ertl, "New cardinality estimation algorithms for
+// HyperLogLog sketches", as Redis does.
+func Estimate(regs []uint8) uint64 {
+	var histo [64]int
+	for _, v := range regs {
+		histo[v]++
+	}
+	m := float64(Registers)
+	z := m * tau((m-float64(histo[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histo[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// Decode describes the opcodes of the sparse HyperLogLog b as PFDEBUG
+// DECODE does: z:n and Z:n for the ZERO and XZERO runs, v:value,n for the others.
+func Decode(b []byte) (string, error) {
+	var sb strings.Builder
+	for pos := HeaderSize; pos < len(b); {
+		switch op := b[pos]; {
+		case isZero(op):
+			fmt.Fprintf(&sb, "z:%d ", zeroLen(op))
+			pos++
+		case isXZero(op):
+			if pos+1 >= len(b) {
+				return "", ErrInvalid
+			}
+			fmt.Fprintf(&sb, "Z:%d ", xzeroLen(b[pos:]))
+			pos += 2
+		default:
+			fmt.Fprintf(&sb, "v:%d,%d ", valValue(op), valLen(op))
+			pos++
+		}
+	}
+	return strings.TrimSuffix(sb.String(), " "), nil
+}
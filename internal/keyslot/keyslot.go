@@ -0,0 +1,67 @@
+// Package keyslot maps keys to the hash slots of Redis Cluster.
+//
+// A key belongs to slot CRC16(key) mod 16384, where CRC16 is the XMODEM
+// variant. If the key holds a hash tag, a non-empty substring between the
+// first '{' and the first '}' after it, only the tag is hashed, so keys
+// such as {user:1}.cart and {user:1}.orders share a slot.
+package keyslot
+
+import "strings"
+
+// Count is the number of hash slots.
+const Count = 16384
+
+// crc16Table holds the CRC16 of each byte value, for the polynomial 0x1021.
+var crc16Table = func() (t [256]uint16) {
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// CRC16 returns the CRC16 checksum of s, as Redis computes it.
+func CRC16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// HashTag returns the part of key that is hashed: its hash tag if it has
+// one, the whole key otherwise.
+func HashTag(key string) string {
+	open := strings.IndexByte(key, '{')
+	if open < 0 {
+		return key
+	}
+	n := strings.IndexByte(key[open+1:], '}')
+	if n <= 0 {
+		return key
+	}
+	return key[open+1 : open+1+n]
+}
+
+// Of returns the hash slot of key.
+func Of(key string) int {
+	return int(CRC16(HashTag(key)) % Count)
+}
+
+// Same reports whether all keys belong to the same slot, which also holds
+// when there are none.
+func Same(keys []string) bool {
+	for _, key := range keys[min(len(keys), 1):] {
+		if Of(key) != Of(keys[0]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+// Package logfile writes the server log to a file, appending to it, that
+// can be reopened once log rotation tools moved it away. The standard
+// output and error of the process may be redirected to the file as well,
+// so that what is printed directly, and the stack of a crash, are not lost
+// when the server runs detached from a terminal.
+package logfile
+
+import (
+	"os"
+	"sync"
+)
+
+// File is a log file. It is an io.Writer, for log.SetOutput.
+type File struct {
+	mu       sync.Mutex
+	path     string
+	redirect bool // Redirect the standard output and error to the file
+	file     *os.File
+}
+
+// Open opens the log file at path for appending, creating it if needed.
+// With redirect, the standard output and error of the process are
+// redirected to it.
+func Open(path string, redirect bool) (*File, error) {
+	f := &File{path: path, redirect: redirect}
+	if err := f.Reopen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reopen opens the file at the path of the log again, so that the log goes
+// to a new file once the previous one was renamed, and closes the previous
+// one. The log keeps going to the previous file if the new one cannot be
+// opened.
+func (f *File) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if f.redirect {
+		if err := redirectStdio(file); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	f.mu.Lock()
+	previous := f.file
+	f.file = file
+	f.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// Write appends p to the log file.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Path returns the path of the log file.
+func (f *File) Path() string {
+	return f.path
+}
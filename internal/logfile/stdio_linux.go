@@ -0,0 +1,21 @@
+package logfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// ReopenSignals are the signals on which the server reopens its log file,
+// as logrotate sends them after moving it.
+var ReopenSignals = []os.Signal{syscall.SIGUSR1}
+
+// redirectStdio makes the standard output and error of the process refer
+// to file. Linux is done with dup3, as some architectures lack dup2.
+func redirectStdio(file *os.File) error {
+	for _, fd := range []int{syscall.Stdout, syscall.Stderr} {
+		if err := syscall.Dup3(int(file.Fd()), fd, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
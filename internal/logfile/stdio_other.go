@@ -0,0 +1,18 @@
+//go:build !unix
+
+package logfile
+
+import "os"
+
+// ReopenSignals is empty where there is no SIGUSR1: the log file is only
+// opened at startup.
+var ReopenSignals []os.Signal
+
+// redirectStdio points os.Stdout and os.Stderr to file where the file
+// descriptors of the process cannot be replaced, which redirects what the
+// server prints but not the stack of a crash.
+func redirectStdio(file *os.File) error {
+	os.Stdout = file
+	os.Stderr = file
+	return nil
+}
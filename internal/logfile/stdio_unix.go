@@ -0,0 +1,23 @@
+//go:build unix && !linux
+
+package logfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// ReopenSignals are the signals on which the server reopens its log file,
+// as logrotate sends them after moving it.
+var ReopenSignals = []os.Signal{syscall.SIGUSR1}
+
+// redirectStdio makes the standard output and error of the process refer
+// to file.
+func redirectStdio(file *os.File) error {
+	for _, fd := range []int{syscall.Stdout, syscall.Stderr} {
+		if err := syscall.Dup2(int(file.Fd()), fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package rdb
+
+// crc64Table is the table of the reflected CRC-64 variant with the Jones
+// polynomial (0xad93d23594c935a9) that Redis uses for RDB checksums.
+var crc64Table = func() *[256]uint64 {
+	const poly = 0x95ac9329ac4bc9b5 // Jones polynomial, bit-reversed
+	var table [256]uint64
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return &table
+}()
+
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
@@ -0,0 +1,178 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// ErrListpack is returned when a listpack is malformed.
+var ErrListpack = errors.New("rdb: invalid listpack")
+
+const (
+	lpHeaderSize = 6    // Total bytes and number of elements
+	lpEnd        = 0xFF // Last byte of a listpack
+	lpMaxCount   = 0xFFFF
+)
+
+// Listpack builds a listpack, the compact list encoding Redis keeps the
+// entries of a stream in: a header holding its size and number of
+// elements, then each element followed by its own length, so the list can
+// be walked backwards, and an end byte.
+type Listpack struct {
+	buf []byte // Elements encoded so far
+	n   int
+}
+
+// AppendString appends a string element.
+func (lp *Listpack) AppendString(s string) {
+	start := len(lp.buf)
+	switch n := len(s); {
+	case n < 1<<6:
+		lp.buf = append(lp.buf, 0x80|byte(n))
+	case n < 1<<12:
+		lp.buf = append(lp.buf, 0xE0|byte(n>>8), byte(n))
+	default:
+		lp.buf = append(lp.buf, 0xF0)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(n))
+	}
+	lp.buf = append(lp.buf, s...)
+	lp.appendBacklen(len(lp.buf) - start)
+}
+
+// AppendInt appends an integer element, in the smallest encoding holding
+// it.
+func (lp *Listpack) AppendInt(v int64) {
+	start := len(lp.buf)
+	switch {
+	case v >= 0 && v < 1<<7:
+		lp.buf = append(lp.buf, byte(v))
+	case v >= -1<<12 && v < 1<<12:
+		u := uint64(v) & (1<<13 - 1)
+		lp.buf = append(lp.buf, 0xC0|byte(u>>8), byte(u))
+	case v >= -1<<15 && v < 1<<15:
+		lp.buf = append(lp.buf, 0xF1)
+		lp.buf = binary.LittleEndian.AppendUint16(lp.buf, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		lp.buf = append(lp.buf, 0xF2, byte(v), byte(v>>8), byte(v>>16))
+	case v >= -1<<31 && v < 1<<31:
+		lp.buf = append(lp.buf, 0xF3)
+		lp.buf = binary.LittleEndian.AppendUint32(lp.buf, uint32(v))
+	default:
+		lp.buf = append(lp.buf, 0xF4)
+		lp.buf = binary.LittleEndian.AppendUint64(lp.buf, uint64(v))
+	}
+	lp.appendBacklen(len(lp.buf) - start)
+}
+
+// appendBacklen appends the length of the element just appended, seven
+// bits per byte, most significant first, all but the first byte with the
+// high bit set.
+func (lp *Listpack) appendBacklen(l int) {
+	size := backlenSize(l)
+	for i := size - 1; i >= 0; i-- {
+		b := byte(l>>(7*i)) & 0x7F
+		if i < size-1 {
+			b |= 0x80
+		}
+		lp.buf = append(lp.buf, b)
+	}
+	lp.n++
+}
+
+// backlenSize returns the bytes the length l of an element takes.
+func backlenSize(l int) int {
+	switch {
+	case l < 1<<7:
+		return 1
+	case l < 1<<14-1:
+		return 2
+	case l < 1<<21-1:
+		return 3
+	case l < 1<<28-1:
+		return 4
+	}
+	return 5
+}
+
+// Bytes returns the encoded listpack.
+func (lp *Listpack) Bytes() []byte {
+	p := make([]byte, lpHeaderSize, lpHeaderSize+len(lp.buf)+1)
+	binary.LittleEndian.PutUint32(p, uint32(cap(p)))
+	binary.LittleEndian.PutUint16(p[4:], uint16(min(lp.n, lpMaxCount)))
+	p = append(p, lp.buf...)
+	return append(p, lpEnd)
+}
+
+// ParseListpack returns the elements of the listpack p, integers
+// formatted in decimal.
+func ParseListpack(p []byte) ([]string, error) {
+	if len(p) < lpHeaderSize+1 || binary.LittleEndian.Uint32(p) != uint32(len(p)) || p[len(p)-1] != lpEnd {
+		return nil, ErrListpack
+	}
+	var elems []string
+	for i := lpHeaderSize; p[i] != lpEnd; {
+		elem, n, err := parseElement(p[i : len(p)-1])
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		i += n + backlenSize(n)
+		if i >= len(p) {
+			return nil, ErrListpack
+		}
+	}
+	if count := binary.LittleEndian.Uint16(p[4:]); count != lpMaxCount && int(count) != len(elems) {
+		return nil, ErrListpack
+	}
+	return elems, nil
+}
+
+// parseElement decodes the element at the start of p, and returns it with
+// the bytes it takes, its length excluded.
+func parseElement(p []byte) (string, int, error) {
+	b := p[0]
+	var hdr, n int // Bytes of the encoding, and of a string
+	switch {
+	case b&0x80 == 0:
+		return strconv.Itoa(int(b)), 1, nil
+	case b&0xC0 == 0x80:
+		hdr, n = 1, int(b&0x3F)
+	case b&0xE0 == 0xC0:
+		if len(p) < 2 {
+			return "", 0, ErrListpack
+		}
+		v := int64(b&0x1F)<<8 | int64(p[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return strconv.FormatInt(v, 10), 2, nil
+	case b&0xF0 == 0xE0:
+		if len(p) < 2 {
+			return "", 0, ErrListpack
+		}
+		hdr, n = 2, int(b&0x0F)<<8|int(p[1])
+	case b == 0xF0:
+		if len(p) < 5 {
+			return "", 0, ErrListpack
+		}
+		hdr, n = 5, int(binary.LittleEndian.Uint32(p[1:]))
+	default:
+		size := map[byte]int{0xF1: 2, 0xF2: 3, 0xF3: 4, 0xF4: 8}[b]
+		if size == 0 || len(p) < 1+size {
+			return "", 0, ErrListpack
+		}
+		var u uint64
+		for i := size; i >= 1; i-- {
+			u = u<<8 | uint64(p[i])
+		}
+		// Sign extend the size bytes read.
+		shift := 64 - 8*size
+		v := int64(u<<shift) >> shift
+		return strconv.FormatInt(v, 10), 1 + size, nil
+	}
+	if n < 0 || len(p) < hdr+n {
+		return "", 0, ErrListpack
+	}
+	return string(p[hdr : hdr+n]), hdr + n, nil
+}
@@ -0,0 +1,54 @@
+package rdb
+
+import "errors"
+
+// errLZF is returned for an LZF compressed string that does not decompress
+// to its length.
+var errLZF = errors.New("rdb: invalid LZF compressed string")
+
+// lzfDecompress decompresses in, compressed with LZF as Redis compresses
+// long strings, into a buffer of n bytes. Each control byte starts either
+// a run of literal bytes, when below 32, or a back reference copying from
+// the output already decompressed.
+func lzfDecompress(in []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			ctrl++
+			if i+ctrl > len(in) || len(out)+ctrl > n {
+				return nil, errLZF
+			}
+			out = append(out, in[i:i+ctrl]...)
+			i += ctrl
+			continue
+		}
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errLZF
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errLZF
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		length += 2
+		if ref < 0 || len(out)+length > n {
+			return nil, errLZF
+		}
+		// The reference may overlap the bytes it produces.
+		for ; length > 0; length-- {
+			out = append(out, out[ref])
+			ref++
+		}
+	}
+	if len(out) != n {
+		return nil, errLZF
+	}
+	return out, nil
+}
@@ -0,0 +1,452 @@
+// Package rdb reads and writes the low-level encoding of Redis RDB files:
+// length-prefixed strings, object type bytes, opcodes and the trailing
+// CRC64 checksum. Only the plain, non-compact object encodings are written,
+// and strings are written uncompressed, while LZF compressed ones are read.
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Version is the RDB format version written in the file header.
+const Version = 9
+
+// PayloadVersion is the latest format version of the payloads of DUMP
+// that are read, that of Redis 7.2. Versions 10 and 11 only added object
+// types, those not supported being rejected as they are read.
+const PayloadVersion = 11
+
+// Object types.
+const (
+	TypeString = 0
+	TypeList   = 1
+	TypeSet    = 2
+	TypeHash   = 4
+	TypeZSet2  = 5 // Sorted set with binary double scores
+
+	TypeStreamListpacks3 = 21 // Stream as listpacks, with consumer active times
+)
+
+// Opcodes.
+const (
+	OpFunction2    = 0xF5 // Code of a function library
+	OpAux          = 0xFA
+	OpResizeDB     = 0xFB
+	OpExpireTimeMs = 0xFC
+	OpExpireTime   = 0xFD
+	OpSelectDB     = 0xFE
+	OpEOF          = 0xFF
+)
+
+// ErrChecksum is returned when the checksum at the end of a file does not
+// match its contents.
+var ErrChecksum = errors.New("rdb: checksum mismatch")
+
+// ErrPayload is returned when a payload has an unsupported version or a
+// checksum that does not match its contents.
+var ErrPayload = errors.New("rdb: payload version or checksum are wrong")
+
+const (
+	len6Bit  = 0
+	len14Bit = 1
+	len32Bit = 0x80
+	len64Bit = 0x81
+	lenEnc   = 3
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// Writer writes an RDB file.
+type Writer struct {
+	w       *bufio.Writer
+	crc     uint64
+	err     error
+	payload bool // Writing the payload of DUMP, which holds no key
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	w.crc = crc64Update(w.crc, p)
+	_, w.err = w.w.Write(p)
+}
+
+// WriteHeader writes the magic string and format version.
+func (w *Writer) WriteHeader() {
+	w.write([]byte(fmt.Sprintf("REDIS%04d", Version)))
+}
+
+// WriteAux writes an auxiliary field.
+func (w *Writer) WriteAux(key, value string) {
+	w.WriteByte(OpAux)
+	w.WriteString(key)
+	w.WriteString(value)
+}
+
+// WriteSelectDB starts the keys of database db.
+func (w *Writer) WriteSelectDB(db int) {
+	w.WriteByte(OpSelectDB)
+	w.WriteLength(uint64(db))
+}
+
+// WriteExpireTimeMs writes the expire time, in Unix milliseconds, of the
+// key that follows.
+func (w *Writer) WriteExpireTimeMs(ms int64) {
+	w.WriteByte(OpExpireTimeMs)
+	w.WriteMillisecondTime(ms)
+}
+
+// WriteByte writes a type byte or opcode.
+func (w *Writer) WriteByte(b byte) error {
+	w.write([]byte{b})
+	return w.err
+}
+
+// WriteKey writes the name of the key whose value follows. The payload of
+// DUMP holds a value alone, so it is skipped there.
+func (w *Writer) WriteKey(key string) {
+	if !w.payload {
+		w.WriteString(key)
+	}
+}
+
+// WriteLength writes a length.
+func (w *Writer) WriteLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		w.write([]byte{byte(n)})
+	case n < 1<<14:
+		w.write([]byte{byte(n>>8) | len14Bit<<6, byte(n)})
+	case n <= math.MaxUint32:
+		var buf [5]byte
+		buf[0] = len32Bit
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+		w.write(buf[:])
+	default:
+		var buf [9]byte
+		buf[0] = len64Bit
+		binary.BigEndian.PutUint64(buf[1:], n)
+		w.write(buf[:])
+	}
+}
+
+// WriteString writes a length-prefixed string.
+func (w *Writer) WriteString(s string) {
+	w.WriteLength(uint64(len(s)))
+	w.write([]byte(s))
+}
+
+// WriteRaw writes p as it is, without a length, such as the IDs of the
+// pending entries of a stream.
+func (w *Writer) WriteRaw(p []byte) {
+	w.write(p)
+}
+
+// WriteMillisecondTime writes a time in Unix milliseconds, little-endian.
+func (w *Writer) WriteMillisecondTime(ms int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(ms))
+	w.write(buf[:])
+}
+
+// WriteBinaryDouble writes a sorted set score.
+func (w *Writer) WriteBinaryDouble(f float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	w.write(buf[:])
+}
+
+// Close writes the EOF opcode and checksum, and flushes the output.
+func (w *Writer) Close() error {
+	w.WriteByte(OpEOF)
+	if w.err != nil {
+		return w.err
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], w.crc)
+	if _, err := w.w.Write(buf[:]); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// Reader reads an RDB file.
+type Reader struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+func (r *Reader) read(p []byte) error {
+	if _, err := io.ReadFull(r.r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.crc = crc64Update(r.crc, p)
+	return nil
+}
+
+// ReadHeader reads and checks the magic string and format version.
+func (r *Reader) ReadHeader() error {
+	var buf [9]byte
+	if err := r.read(buf[:]); err != nil {
+		return err
+	}
+	if string(buf[:5]) != "REDIS" {
+		return errors.New("rdb: wrong signature")
+	}
+	version, err := strconv.Atoi(string(buf[5:]))
+	if err != nil || version < 1 || version > Version {
+		return fmt.Errorf("rdb: unsupported version %q", buf[5:])
+	}
+	return nil
+}
+
+// ReadByte reads a type byte or opcode.
+func (r *Reader) ReadByte() (byte, error) {
+	var buf [1]byte
+	err := r.read(buf[:])
+	return buf[0], err
+}
+
+// ReadLength reads a length.
+func (r *Reader) ReadLength() (uint64, error) {
+	n, encoded, err := r.readLength()
+	if err == nil && encoded {
+		err = errors.New("rdb: unexpected string encoding")
+	}
+	return n, err
+}
+
+// readLength reads a length, or a special string encoding when encoded is
+// true.
+func (r *Reader) readLength() (n uint64, encoded bool, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case len6Bit:
+		return uint64(b & 0x3F), false, nil
+	case len14Bit:
+		next, err := r.ReadByte()
+		return uint64(b&0x3F)<<8 | uint64(next), false, err
+	case lenEnc:
+		return uint64(b & 0x3F), true, nil
+	}
+	switch b {
+	case len32Bit:
+		var buf [4]byte
+		err := r.read(buf[:])
+		return uint64(binary.BigEndian.Uint32(buf[:])), false, err
+	case len64Bit:
+		var buf [8]byte
+		err := r.read(buf[:])
+		return binary.BigEndian.Uint64(buf[:]), false, err
+	}
+	return 0, false, fmt.Errorf("rdb: invalid length encoding 0x%02x", b)
+}
+
+// ReadString reads a string, either length-prefixed or integer encoded.
+func (r *Reader) ReadString() (string, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return "", err
+	}
+	if encoded {
+		var size int
+		switch n {
+		case encInt8:
+			size = 1
+		case encInt16:
+			size = 2
+		case encInt32:
+			size = 4
+		case encLZF:
+			return r.readLZF()
+		default:
+			return "", fmt.Errorf("rdb: unknown string encoding %d", n)
+		}
+		var buf [4]byte
+		if err := r.read(buf[:size]); err != nil {
+			return "", err
+		}
+		var v int64
+		switch size {
+		case 1:
+			v = int64(int8(buf[0]))
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(buf[:])))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(buf[:])))
+		}
+		return strconv.FormatInt(v, 10), nil
+	}
+	buf := make([]byte, n)
+	if err := r.read(buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// readLZF reads an LZF compressed string: its compressed and decompressed
+// lengths, then its compressed bytes.
+func (r *Reader) readLZF() (string, error) {
+	clen, err := r.ReadLength()
+	if err != nil {
+		return "", err
+	}
+	n, err := r.ReadLength()
+	if err != nil {
+		return "", err
+	}
+	in, err := r.ReadRaw(int(clen))
+	if err != nil {
+		return "", err
+	}
+	out, err := lzfDecompress(in, int(n))
+	return string(out), err
+}
+
+// ReadRaw reads n bytes written by WriteRaw.
+func (r *Reader) ReadRaw(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if err := r.read(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ReadBinaryDouble reads a sorted set score.
+func (r *Reader) ReadBinaryDouble() (float64, error) {
+	var buf [8]byte
+	if err := r.read(buf[:]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+}
+
+// ReadInt64 reads a little-endian 64-bit integer, such as a millisecond
+// expire time.
+func (r *Reader) ReadInt64() (int64, error) {
+	var buf [8]byte
+	err := r.read(buf[:])
+	return int64(binary.LittleEndian.Uint64(buf[:])), err
+}
+
+// ReadInt32 reads a little-endian 32-bit integer, such as an expire time
+// in seconds.
+func (r *Reader) ReadInt32() (int32, error) {
+	var buf [4]byte
+	err := r.read(buf[:])
+	return int32(binary.LittleEndian.Uint32(buf[:])), err
+}
+
+// VerifyChecksum reads the checksum following the EOF opcode and checks
+// it. A zero checksum means the writer did not compute one.
+func (r *Reader) VerifyChecksum() error {
+	expected := r.crc
+	var buf [8]byte
+	if _, err := io.ReadFull(r.r, buf[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if sum := binary.LittleEndian.Uint64(buf[:]); sum != 0 && sum != expected {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Payload returns the payload of DUMP holding what write writes, such as
+// the type byte and value of a key. It ends with the format version and a
+// checksum rather than the EOF opcode, and keys are left out of it.
+func Payload(write func(w *Writer)) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.payload = true
+	write(w)
+	var trailer [10]byte
+	binary.LittleEndian.PutUint16(trailer[:2], Version)
+	w.write(trailer[:2])
+	binary.LittleEndian.PutUint64(trailer[2:], w.crc)
+	w.w.Write(trailer[2:])
+	w.w.Flush()
+	return buf.Bytes()
+}
+
+// ReadPayload checks the version and checksum of a payload of DUMP, and
+// returns a Reader of what it holds.
+func ReadPayload(p []byte) (*Reader, error) {
+	if len(p) < 10 {
+		return nil, ErrPayload
+	}
+	body, trailer := p[:len(p)-10], p[len(p)-10:]
+	if binary.LittleEndian.Uint16(trailer[:2]) > PayloadVersion ||
+		crc64Update(0, p[:len(p)-8]) != binary.LittleEndian.Uint64(trailer[2:]) {
+		return nil, ErrPayload
+	}
+	return NewReader(bytes.NewReader(body)), nil
+}
+
+// More reports whether anything is left to read.
+func (r *Reader) More() bool {
+	_, err := r.r.Peek(1)
+	return err == nil
+}
+
+// FunctionsPayload returns the payload of FUNCTION DUMP holding the code
+// of the given function libraries.
+func FunctionsPayload(code []string) []byte {
+	return Payload(func(w *Writer) {
+		for _, c := range code {
+			w.WriteByte(OpFunction2)
+			w.WriteString(c)
+		}
+	})
+}
+
+// ReadFunctionsPayload returns the code of the function libraries held by
+// a payload of FUNCTION DUMP.
+func ReadFunctionsPayload(p []byte) ([]string, error) {
+	r, err := ReadPayload(p)
+	if err != nil {
+		return nil, err
+	}
+	var code []string
+	for r.More() {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if op != OpFunction2 {
+			return nil, fmt.Errorf("rdb: unexpected opcode 0x%02x in functions payload", op)
+		}
+		c, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		code = append(code, c)
+	}
+	return code, nil
+}
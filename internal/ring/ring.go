@@ -0,0 +1,74 @@
+// Package ring spreads keys over several servers by consistent hashing,
+// with the ketama scheme of twemproxy and libmemcached: each server is
+// given points on a circle of 32-bit hashes, from the MD5 digests of
+// "host:port-n", and a key belongs to the server of the first point at or
+// after the hash of the key. Adding or removing a server only moves the
+// keys of the points it gains or loses.
+//
+// If a key holds a hash tag, as in {user:1}.cart, only the tag is hashed,
+// so related keys go to the same server.
+package ring
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+
+	"github.com/liweiyuan/go-redis-server/internal/keyslot"
+)
+
+// pointsPerServer is the number of points of each server on the circle.
+const pointsPerServer = 160
+
+type point struct {
+	hash   uint32
+	server int
+}
+
+// Ring maps keys to servers.
+type Ring struct {
+	servers []string
+	points  []point // Sorted by hash
+}
+
+// New returns the ring of the servers, given by address. The same
+// addresses always give the same ring, whatever their order.
+func New(servers []string) *Ring {
+	r := &Ring{servers: servers}
+	for i, server := range servers {
+		for n := 0; n < pointsPerServer/4; n++ {
+			digest := md5.Sum([]byte(server + "-" + strconv.Itoa(n)))
+			for j := 0; j < 4; j++ {
+				r.points = append(r.points, point{hash: binary.LittleEndian.Uint32(digest[j*4:]), server: i})
+			}
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		a, b := r.points[i], r.points[j]
+		if a.hash != b.hash {
+			return a.hash < b.hash
+		}
+		return servers[a.server] < servers[b.server]
+	})
+	return r
+}
+
+// Servers returns the addresses of the servers, in the order given to New.
+func (r *Ring) Servers() []string {
+	return r.servers
+}
+
+// Server returns the index of the server holding key.
+func (r *Ring) Server(key string) int {
+	if len(r.points) == 0 {
+		return 0
+	}
+	digest := md5.Sum([]byte(keyslot.HashTag(key)))
+	h := binary.LittleEndian.Uint32(digest[:])
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].server
+}
@@ -0,0 +1,128 @@
+// Package servertest runs a server in process for the tests of the other
+// packages. Commands run either straight through the command registry, on
+// behalf of clients registered as connections are, or over connections to
+// the server, through the whole network layer:
+//
+//	srv := servertest.Start(t)
+//	srv.Exec(nil, "SET", "k", "v")
+//	c := srv.Dial(t)
+//	reply := c.Do("GET", "k")
+package servertest
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/server"
+)
+
+var seed = flag.Int64("seed", 0, "seed of the randomized tests, 0 for a new one")
+
+// Seed returns the seed of a randomized test, that of -seed if set, and
+// logs it so that a failure can be reproduced.
+func Seed(t testing.TB) int64 {
+	s := *seed
+	if s == 0 {
+		s = time.Now().UnixNano()
+	}
+	t.Logf("seed %d (reproduce with -seed %d)", s, s)
+	return s
+}
+
+// Server is a server running in process, on an empty dataset.
+type Server struct {
+	*server.InMemory
+}
+
+// Start starts a server, closed when the test ends.
+func Start(t testing.TB) *Server {
+	srv := &Server{server.NewInMemory()}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// Client registers a client as a connection does, to run commands on its
+// behalf with Exec.
+func (srv *Server) Client() *command.Client {
+	return srv.Registry.Clients().Register("127.0.0.1:0", "127.0.0.1:6379")
+}
+
+// Exec runs a command through the registry on behalf of client, nil for
+// the commands that need none, and returns its reply. Argument errors are
+// returned as error replies.
+func (srv *Server) Exec(client *command.Client, args ...string) resp.RespValue {
+	argv := bulks(args)
+	cmd, err := srv.Registry.ParseCommand(resp.NewArray(argv))
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return srv.Registry.Execute(client, argv, cmd, srv.Storage)
+}
+
+// Conn is a connection to a Server.
+type Conn struct {
+	t testing.TB
+	c net.Conn
+	r *bufio.Reader
+}
+
+// Dial opens a connection to the server, closed when the test ends.
+func (srv *Server) Dial(t testing.TB) *Conn {
+	c, err := srv.InMemory.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &Conn{t: t, c: c, r: bufio.NewReader(c)}
+}
+
+// Do sends a command and returns its reply. A failure to send it or read
+// the reply fails the test, which Do may report from any goroutine, and is
+// returned as an error reply.
+func (c *Conn) Do(args ...string) resp.RespValue {
+	c.Send(args...)
+	return c.Receive()
+}
+
+// Send sends a command without waiting for its reply.
+func (c *Conn) Send(args ...string) {
+	if err := resp.WriteResp(c.c, resp.NewArray(bulks(args))); err != nil {
+		c.t.Errorf("%s: %v", strings.Join(args, " "), err)
+	}
+}
+
+// Receive reads a reply, waiting for it at most 5 seconds.
+func (c *Conn) Receive() resp.RespValue {
+	return c.ReceiveWithin(5 * time.Second)
+}
+
+// ReceiveWithin reads a reply, waiting for it at most timeout.
+func (c *Conn) ReceiveWithin(timeout time.Duration) resp.RespValue {
+	c.c.SetReadDeadline(time.Now().Add(timeout))
+	v, err := resp.ReadResp(c.r)
+	if err != nil {
+		c.t.Errorf("reading a reply: %v", err)
+		return resp.NewError(fmt.Sprintf("ERR %v", err))
+	}
+	return v
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+func bulks(args []string) []resp.RespValue {
+	argv := make([]resp.RespValue, len(args))
+	for i, arg := range args {
+		argv[i] = resp.NewBulk(arg)
+	}
+	return argv
+}
@@ -1,13 +1,194 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/config"
+	"github.com/liweiyuan/go-redis-server/internal/logfile"
 	"github.com/liweiyuan/go-redis-server/network"
+	"github.com/liweiyuan/go-redis-server/persistence"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to export the dataset: %v", err)
+			}
+			return
+		case "import":
+			if err := runImport(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to import the dataset: %v", err)
+			}
+			return
+		case "--version", "-v":
+			fmt.Println(command.VersionLine())
+			return
+		}
+	}
+
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.LogFile != "" {
+		logFile, err := logfile.Open(cfg.LogFile, cfg.LogRedirectStdio)
+		if err != nil {
+			log.Fatalf("Can't open the log file: %v", err)
+		}
+		log.SetOutput(logFile)
+		go reopenLogOnSignal(logFile)
+	}
+	log.Printf("Redis version=%s, bits=%d, commit=%s, modified=0, pid=%d, just started", command.ServerVersion, strconv.IntSize, command.GitSHA1, os.Getpid())
+
 	s := storage.NewStorage()
+	s.SetKeyspaceStatsPrefixes(cfg.KeyspaceStatsPrefixes)
+	snapshotter := persistence.New(filepath.Join(cfg.Dir, cfg.DBFilename))
+	savePoints := make([]persistence.SavePoint, len(cfg.SavePoints))
+	for i, sp := range cfg.SavePoints {
+		savePoints[i] = persistence.SavePoint{Seconds: sp.Seconds, Changes: sp.Changes}
+	}
+	snapshotter.SetSavePoints(savePoints)
 	cr := command.NewCommandRegistry()
-	network.Start(s, cr)
+	cr.SetSnapshotter(snapshotter)
+	cr.SetBusyReplyThreshold(time.Duration(cfg.BusyReplyThreshold) * time.Millisecond)
+	cr.SetEarlyExpireWindow(time.Duration(cfg.EarlyExpireWindow) * time.Millisecond)
+	cr.SetShutdownTimeout(time.Duration(cfg.ShutdownTimeout) * time.Second)
+	cr.SetClusterEnabled(cfg.ClusterEnabled)
+	cr.SetTCPPort(cfg.Port)
+	if cfg.ACLFile != "" {
+		cr.SetACLFile(cfg.ACLFile)
+		if err := cr.LoadACL(); err != nil {
+			log.Fatalf("Failed to load the ACL file: %v", err)
+		}
+	}
+	if cfg.PidFile != "" {
+		if err := writePidFile(cfg.PidFile); err != nil {
+			log.Printf("Failed to write PID file: %v", err)
+		} else {
+			cr.SetPidFile(cfg.PidFile)
+		}
+	}
+	cr.Clients().SetMemoryLimit(cfg.MaxMemoryClients)
+	if cfg.ClusterEnabled {
+		s.EnableSlotIndex()
+	}
+	// Clients are answered with -LOADING until the dataset is loaded.
+	var loaded <-chan error
+	if cfg.AppendOnly {
+		aof, err := persistence.OpenAOF(filepath.Join(cfg.Dir, cfg.AppendDirname), cfg.AppendFilename, persistence.AOFOptions{
+			Fsync:         cfg.AppendFsync,
+			RDBPreamble:   cfg.AOFUseRDBPreamble,
+			LoadTruncated: cfg.AOFLoadTruncated,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open append only file: %v", err)
+		}
+		defer aof.Close()
+		cr.SetAOF(aof, cfg.AutoAOFRewritePercentage, cfg.AutoAOFRewriteMinSize)
+		loaded = snapshotter.LoadAOFInBackground(s, aof, func(argv []string) error {
+			return cr.Replay(s, argv)
+		})
+	} else {
+		loaded = snapshotter.LoadInBackground(s)
+	}
+	go func() {
+		if err := <-loaded; err != nil {
+			log.Fatalf("Failed to load the dataset: %v", err)
+		}
+	}()
+	for _, rc := range cfg.RenameCommands {
+		if err := cr.Rename(rc.Name, rc.NewName); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	}
+	go func() {
+		for range time.Tick(100 * time.Millisecond) {
+			cr.ActiveExpireCycle(s)
+			cr.SaveIfDue(s)
+			cr.RewriteAOFIfDue(s)
+		}
+	}()
+	if cfg.ActiveDefrag {
+		s.SetActiveDefrag(true)
+		go func() {
+			for range time.Tick(time.Second) {
+				cr.Defrag(s)
+			}
+		}()
+	}
+	if cfg.BigKeysLogInterval > 0 {
+		go func() {
+			for range time.Tick(time.Duration(cfg.BigKeysLogInterval) * time.Second) {
+				log.Printf("Biggest keys:\n%s", s.KeyspaceReport(1))
+			}
+		}()
+	}
+	go shutdownOnSignal(s, cr)
+	network.Start(cfg, s, cr)
+}
+
+// shutdownOnSignal shuts the server down on SIGTERM or SIGINT, as SHUTDOWN
+// does. If the shutdown fails, the server keeps running.
+func shutdownOnSignal(s *storage.Storage, cr *command.CommandRegistry) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	for sig := range signals {
+		log.Printf("Received %v, shutting down", sig)
+		if err := cr.Shutdown(s, nil, command.ShutdownOptions{}); err != nil {
+			log.Printf("Shutdown failed: %v", err)
+		}
+	}
+}
+
+// writePidFile writes the process ID to path, for init systems to find the
+// server. A shutdown removes it.
+func writePidFile(path string) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// reopenLogOnSignal reopens the log file on SIGUSR1, which log rotation
+// tools send once they moved it away.
+func reopenLogOnSignal(logFile *logfile.File) {
+	if len(logfile.ReopenSignals) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, logfile.ReopenSignals...)
+	for sig := range signals {
+		if err := logFile.Reopen(); err != nil {
+			log.Printf("Failed to reopen the log file %s on %v: %v", logFile.Path(), sig, err)
+			continue
+		}
+		log.Printf("Reopened the log file on %v", sig)
+	}
+}
+
+// loadConfig builds the configuration from an optional config file path
+// followed by --directive value overrides, as redis-server accepts them.
+func loadConfig(args []string) (*config.Config, error) {
+	cfg := config.Default()
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		var err error
+		cfg, err = config.Load(args[0])
+		if err != nil {
+			return nil, err
+		}
+		args = args[1:]
+	}
+	if err := cfg.ParseArgs(args); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
@@ -0,0 +1,34 @@
+package network
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/audit"
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// audit records write and admin commands in the audit log, if enabled.
+func (srv *server) audit(conn net.Conn, client *command.Client, respValue resp.RespValue) {
+	if srv.auditLog == nil {
+		return
+	}
+	spec, ok := srv.lookup(respValue)
+	if !ok || !(spec.HasFlag(command.FlagWrite) || spec.HasFlag(command.FlagAdmin)) {
+		return
+	}
+	keys, _ := srv.registry.GetKeys(respValue.Array)
+	err := srv.auditLog.Log(audit.Entry{
+		Time:    time.Now(),
+		Client:  conn.RemoteAddr().String(),
+		User:    client.User(),
+		Command: strings.ToLower(spec.FullName()),
+		Keys:    keys,
+	})
+	if err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+package network
+
+import (
+	"github.com/liweiyuan/go-redis-server/command"
+)
+
+const noAuthError = "NOAUTH Authentication required."
+
+// authDenies reports whether the client may not run the command because it
+// has not authenticated, as the connections of a server whose default user
+// has a password must before any command but AUTH, HELLO, QUIT and RESET.
+func authDenies(client *command.Client, spec *command.CommandSpec) bool {
+	return !client.Authenticated() && !spec.HasFlag(command.FlagNoAuth)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package network
+
+import "net"
+
+// setBacklog is a no-op where the backlog of a listening socket cannot be
+// changed; the system default applies.
+func setBacklog(listener net.Listener, backlog int) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package network
+
+import (
+	"net"
+	"syscall"
+)
+
+// setBacklog changes the accept queue length of a listening socket. The
+// standard library listens with the system maximum; calling listen again
+// on the socket replaces the backlog.
+func setBacklog(listener net.Listener, backlog int) error {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	raw, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,48 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/liweiyuan/go-redis-server/internal/keyslot"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+const crossSlotError = "CROSSSLOT Keys in request don't hash to the same slot"
+
+// commandSlot returns the hash slot of the keys of the command in cluster
+// mode, -1 if it has no keys or cluster mode is disabled. crossSlot reports
+// that its keys belong to different slots, which refuses the command; hash
+// tags let related keys share a slot.
+func (srv *server) commandSlot(respValue resp.RespValue) (slot int, crossSlot bool) {
+	if !srv.cfg.ClusterEnabled {
+		return -1, false
+	}
+	keys, err := srv.registry.GetKeys(respValue.Array)
+	if err != nil || len(keys) == 0 {
+		return -1, false
+	}
+	if !keyslot.Same(keys) {
+		return -1, true
+	}
+	return keyslot.Of(keys[0]), false
+}
+
+// remoteNode returns the address of the node serving the hash slot, if
+// cluster-remote-slots assigns it to another node.
+func (srv *server) remoteNode(slot int) (string, bool) {
+	if slot < 0 {
+		return "", false
+	}
+	for _, rs := range srv.cfg.ClusterRemoteSlots {
+		if slot >= rs.First && slot <= rs.Last {
+			return rs.Addr, true
+		}
+	}
+	return "", false
+}
+
+// movedError returns the redirection of a command on a slot served by the
+// node at addr.
+func movedError(slot int, addr string) string {
+	return fmt.Sprintf("MOVED %d %s", slot, addr)
+}
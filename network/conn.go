@@ -0,0 +1,27 @@
+package network
+
+import (
+	"net"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/config"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// Server serves connections handed to it instead of accepted from a
+// listener, such as the in-process connections of server.InMemory. The
+// audit log and health checks of the configuration are not started.
+type Server struct {
+	srv *server
+}
+
+// NewServer returns a Server running commands on s.
+func NewServer(cfg *config.Config, s *storage.Storage, cr *command.CommandRegistry) *Server {
+	return &Server{srv: newServer(cfg, s, cr)}
+}
+
+// ServeConn serves conn as an accepted connection, until the client
+// disconnects or conn is closed.
+func (s *Server) ServeConn(conn net.Conn) {
+	s.srv.handleConnection(conn)
+}
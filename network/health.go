@@ -0,0 +1,91 @@
+package network
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// healthStatus is the JSON body of the health check endpoints.
+type healthStatus struct {
+	Status      string `json:"status"` // "ok" or "fail"
+	Role        string `json:"role"`   // Replication role, always "master"
+	Loading     bool   `json:"loading"`
+	Ping        string `json:"ping"` // Reply of the internal PING, or why it failed
+	PingLatency int64  `json:"ping_latency_us"`
+	LastSaveAge *int64 `json:"last_save_age_seconds,omitempty"` // Unset without persistence
+}
+
+// serveHealth serves the HTTP health check endpoints on addr: /healthz for
+// liveness and /readyz for readiness. Both run a PING through the command
+// path, so a server wedged by a long script fails its probes; the server
+// is not ready while it loads the dataset.
+func (srv *server) serveHealth(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleHealth(w, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		srv.handleHealth(w, true)
+	})
+	log.Printf("Health checks listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Health check server stopped: %v", err)
+	}
+}
+
+func (srv *server) handleHealth(w http.ResponseWriter, readiness bool) {
+	status := healthStatus{Status: "ok", Role: "master"}
+
+	start := time.Now()
+	reply, ok := srv.pingWithin(time.Duration(srv.cfg.HealthCheckTimeout) * time.Millisecond)
+	status.PingLatency = time.Since(start).Microseconds()
+	if !ok {
+		status.Status = "fail"
+		status.Ping = "timeout"
+	} else if reply.Type == resp.Error {
+		status.Status = "fail"
+		status.Ping = reply.Str
+	} else {
+		status.Ping = reply.Str
+	}
+	if snapshotter := srv.registry.Snapshotter(); snapshotter != nil {
+		age := int64(time.Since(snapshotter.LastSave()).Seconds())
+		status.LastSaveAge = &age
+		status.Loading = snapshotter.Loading()
+		if status.Loading && readiness {
+			status.Status = "fail"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// pingWithin executes PING as a client would, and reports whether it
+// completed within timeout.
+func (srv *server) pingWithin(timeout time.Duration) (resp.RespValue, bool) {
+	done := make(chan resp.RespValue, 1)
+	go func() {
+		cmd, err := command.NewPingCommand(nil)
+		if err != nil {
+			done <- resp.NewError(errs.Reply(err))
+			return
+		}
+		done <- srv.registry.Execute(nil, nil, cmd, srv.storage)
+	}()
+	select {
+	case reply := <-done:
+		return reply, true
+	case <-time.After(timeout):
+		return resp.RespValue{}, false
+	}
+}
@@ -0,0 +1,15 @@
+package network
+
+import (
+	"github.com/liweiyuan/go-redis-server/command"
+)
+
+const loadingError = "LOADING Redis is loading the dataset in memory"
+
+// loadingDenies reports whether the command may not run because the
+// dataset is still being loaded. Only commands flagged as allowed while
+// loading, such as PING and INFO, run meanwhile.
+func (srv *server) loadingDenies(spec *command.CommandSpec) bool {
+	snapshotter := srv.registry.Snapshotter()
+	return snapshotter != nil && snapshotter.Loading() && !spec.HasFlag(command.FlagLoading)
+}
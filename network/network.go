@@ -2,64 +2,380 @@ package network
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/liweiyuan/go-redis-server/audit"
 	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/config"
+	"github.com/liweiyuan/go-redis-server/internal/errs"
 	"github.com/liweiyuan/go-redis-server/resp"
 	"github.com/liweiyuan/go-redis-server/storage"
 )
 
-func Start(s *storage.Storage, cr *command.CommandRegistry) {
-	listener, err := net.Listen("tcp", ":6379")
-	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+// readBufferSize is the size of the read buffer of a connection, large
+// enough to hold many pipelined requests.
+const readBufferSize = 16 * 1024
+
+// server holds the state shared by all connections.
+type server struct {
+	cfg      *config.Config
+	storage  *storage.Storage
+	registry *command.CommandRegistry
+	auditLog *audit.Logger // nil when audit logging is disabled
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[*connection]struct{}
+	draining  bool // A shutdown is closing the connections, see Drain
+}
+
+func newServer(cfg *config.Config, s *storage.Storage, cr *command.CommandRegistry) *server {
+	return &server{cfg: cfg, storage: s, registry: cr, conns: make(map[*connection]struct{})}
+}
+
+// Start serves clients on the configured addresses. It does not return:
+// the process exits through the shutdown of the registry, which drains the
+// connections of the server.
+func Start(cfg *config.Config, s *storage.Storage, cr *command.CommandRegistry) {
+	srv := newServer(cfg, s, cr)
+	cr.SetDrainer(srv)
+	if cfg.AuditLogFile != "" {
+		auditLog, err := audit.Open(cfg.AuditLogFile, cfg.AuditLogMaxSize, cfg.AuditLogMaxFiles)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		srv.auditLog = auditLog
 	}
-	defer listener.Close()
-	fmt.Println("Redis server listening on :6379")
 
+	if cfg.HealthCheckAddr != "" {
+		go srv.serveHealth(cfg.HealthCheckAddr)
+	}
+
+	srv.mu.Lock()
+	srv.listeners = srv.listenAll()
+	for _, listener := range srv.listeners {
+		go srv.serve(listener)
+	}
+	srv.mu.Unlock()
+	select {}
+}
+
+// listenAll opens a listener on every bind address. Addresses prefixed
+// with '-' are optional and skipped if they cannot be bound, as on hosts
+// without IPv6; any other failure is fatal.
+func (srv *server) listenAll() []net.Listener {
+	binds := srv.cfg.Bind
+	if len(binds) == 0 {
+		binds = []string{""}
+	}
+	var listeners []net.Listener
+	for _, bind := range binds {
+		optional := strings.HasPrefix(bind, "-")
+		host := strings.TrimPrefix(bind, "-")
+		network := "tcp"
+		switch host {
+		case "*":
+			network, host = "tcp4", "0.0.0.0"
+		case "::*":
+			network, host = "tcp6", "::"
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(srv.cfg.Port))
+		listener, err := listen(srv.cfg, network, addr)
+		if err != nil {
+			if optional {
+				log.Printf("Could not listen on %s, skipping it: %v", addr, err)
+				continue
+			}
+			log.Fatalf("Failed to listen on %s: %v", addr, err)
+		}
+		fmt.Printf("Redis server listening on %s\n", addr)
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		log.Fatalf("Failed to listen: none of the bind addresses could be bound")
+	}
+	return listeners
+}
+
+// serve accepts connections on listener until it is closed.
+func (srv *server) serve(listener net.Listener) {
+	defer listener.Close()
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.Printf("Failed to accept connection: %v", err)
 			continue
 		}
-		go handleConnection(conn, s, cr)
+		go srv.handleConnection(conn)
 	}
 }
 
-func handleConnection(conn net.Conn, s *storage.Storage, cr *command.CommandRegistry) {
+func (srv *server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 	fmt.Printf("Accepted connection from %s\n", conn.RemoteAddr())
+	applySocketOptions(srv.cfg, conn)
+
+	if protectedModeDenies(srv.cfg, srv.registry, conn) {
+		resp.WriteResp(conn, resp.NewError(protectedModeError))
+		return
+	}
+
+	client := srv.registry.Clients().Register(conn.RemoteAddr().String(), conn.LocalAddr().String())
+	defer srv.registry.Clients().Unregister(client)
+	srv.registry.AuthenticateDefault(client)
 
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
+	client.SetDisconnect(func() { conn.Close() })
+	counter := &countingReader{r: conn, client: client}
+	reader := bufio.NewReaderSize(counter, readBufferSize)
+	requests := resp.NewReader(reader, resp.Limits{
+		MaxLineLength:   srv.cfg.ProtoMaxInlineLen,
+		MaxMultiBulkLen: srv.cfg.ProtoMaxMultiBulkLen,
+		MaxBulkLen:      int(srv.cfg.ProtoMaxBulkLen),
+		MaxValueBytes:   srv.cfg.ClientQueryBufferLimit,
+	})
+	writer := &replyWriter{
+		conn:    conn,
+		client:  client,
+		w:       resp.NewWriter(conn, int(srv.cfg.ReplyStreamThreshold)),
+		timeout: time.Duration(srv.cfg.ReplyWriteTimeout) * time.Second,
+	}
+	client.SetPusher(func(v resp.RespValue) { writer.write(v) })
+	defer writer.stop()
+	defer srv.registry.Tracking().Disconnect(client)
+	defer srv.registry.PubSub().Disconnect(client)
+	limiter := newRateLimiter(srv.cfg.ClientRateLimitCommands, srv.cfg.ClientRateLimitBytes)
+	proxies := upstreams{}
+	defer proxies.close()
+	pipe := newPipeline(requests, reader, counter, srv.cfg.ClientPipelineQueueLimit, func() {
+		srv.registry.Blocking().Disconnect(client)
+	})
+	defer pipe.close()
+	tracked := &connection{conn: conn, client: client, pipe: pipe}
+	if !srv.addConn(tracked) {
+		return
+	}
+	defer srv.removeConn(tracked)
 
+	var executed int64 // Bytes of the last request, counted in the input memory of the client until it executed
 	for {
-		respValue, err := resp.ReadResp(reader)
+		client.AddInputMemory(-executed)
+		req := pipe.next()
+		executed = req.bytes
+		if req.refused {
+			writer.reply(resp.NewError(shuttingDownError), pipe)
+			continue
+		}
+		respValue, err := req.value, req.err
 		if err != nil {
-			if err != io.EOF {
+			var protoErr resp.ProtocolError
+			if errors.As(err, &protoErr) {
+				writer.write(resp.NewError("ERR " + protoErr.Error()))
+			}
+			if err != io.EOF && err != errDrained {
 				fmt.Printf("Error reading RESP: %v\n", err)
 			}
 			return
 		}
 
-		cmd, err := cr.ParseCommand(respValue)
-		if err != nil {
-			// If ParseCommand returns an error, it's already a RespValue error
-			resp.WriteResp(writer, resp.NewError(err.Error()))
-			writer.Flush()
+		if !limiter.allow(req.bytes) {
+			writer.reply(resp.NewError("ERR rate limit exceeded for this client"), pipe)
 			continue
 		}
 
-		result := cmd.Apply(s)
-		err = resp.WriteResp(writer, result)
+		// Arguments are only checked once the client is authenticated.
+		if spec, ok := srv.lookup(respValue); ok && authDenies(client, spec) {
+			srv.registry.Stats().RecordRejected(spec.FullName())
+			writer.reply(resp.NewError(noAuthError), pipe)
+			continue
+		}
+		cmd, err := srv.registry.ParseCommand(respValue)
 		if err != nil {
+			if spec, ok := srv.lookup(respValue); ok {
+				srv.registry.Stats().RecordRejected(spec.FullName())
+			}
+			writer.reply(resp.NewError(errs.Reply(err)), pipe)
+			continue
+		}
+
+		spec, _ := srv.lookup(respValue)
+		if srv.loadingDenies(spec) {
+			srv.registry.Stats().RecordRejected(spec.FullName())
+			writer.reply(resp.NewError(loadingError), pipe)
+			continue
+		}
+		if srv.replicasDeny(spec) {
+			srv.registry.Stats().RecordRejected(spec.FullName())
+			writer.reply(resp.NewError(noReplicasError), pipe)
+			continue
+		}
+		slot, crossSlot := srv.commandSlot(respValue)
+		if crossSlot {
+			srv.registry.Stats().RecordRejected(spec.FullName())
+			writer.reply(resp.NewError(crossSlotError), pipe)
+			continue
+		}
+		if msg, denied := subscribeModeDenies(client, spec); denied {
+			srv.registry.Stats().RecordRejected(spec.FullName())
+			writer.reply(resp.NewError(msg), pipe)
+			continue
+		}
+
+		addr, remote := srv.remoteNode(slot)
+		if remote && !srv.cfg.ClusterProxy {
+			srv.registry.Stats().RecordRejected(spec.FullName())
+			writer.reply(resp.NewError(movedError(slot, addr)), pipe)
+			continue
+		}
+
+		srv.audit(conn, client, respValue)
+		client.Touch(spec.FullName())
+		if remote {
+			if err := writer.reply(proxies.forward(addr, respValue.Array), pipe); err != nil {
+				fmt.Printf("Error writing RESP: %v\n", err)
+				return
+			}
+			continue
+		}
+		// A blocked client still gets the replies to the requests before.
+		if spec.HasFlag(command.FlagBlocking) {
+			if err := writer.flush(); err != nil {
+				return
+			}
+		}
+		start := time.Now()
+		result := srv.registry.Execute(client, respValue.Array, cmd, srv.storage)
+		srv.registry.Stats().Record(spec.FullName(), time.Since(start), result.Type == resp.Error)
+		srv.track(client, respValue, result)
+		if err := writer.reply(result, pipe); err != nil {
 			fmt.Printf("Error writing RESP: %v\n", err)
 			return
 		}
-		writer.Flush()
+		if client.Closing() {
+			return
+		}
+	}
+}
+
+// replyWriter writes replies and out-of-band push messages to a
+// connection, which may happen from different goroutines. A reply that
+// cannot be written within the timeout closes the connection, so a client
+// that stops reading does not hold its goroutine forever. Values are
+// written in the protocol version the client chose with HELLO.
+type replyWriter struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	client  *command.Client
+	w       *resp.Writer
+	timeout time.Duration // Zero for no limit
+	timer   *time.Timer   // Flushes the buffered replies after maxReplyDelay
+}
+
+// maxReplyDelay is the longest a reply waits in the buffer for the replies
+// to the next pipelined requests, so that a slow command does not hold back
+// the replies to those before it.
+const maxReplyDelay = 10 * time.Millisecond
+
+func (rw *replyWriter) write(v resp.RespValue) error {
+	return rw.send(v, true)
+}
+
+// reply writes the reply to a request, unless the client turned replies
+// off with CLIENT REPLY. It is sent along with the replies to the next
+// requests if the client pipelined more, so the replies to a batch of
+// requests go out in as few writes as possible, but no later than
+// maxReplyDelay.
+func (rw *replyWriter) reply(v resp.RespValue, pipe *pipeline) error {
+	flush := !pipe.pending() || rw.client.Closing()
+	if rw.client.ReplySuppressed() {
+		if !flush {
+			return nil
+		}
+		return rw.flush()
+	}
+	return rw.send(v, flush)
+}
+
+// flush writes the replies buffered so far, if any.
+func (rw *replyWriter) flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.w.Buffered() == 0 {
+		return nil
+	}
+	if rw.timeout > 0 {
+		rw.conn.SetWriteDeadline(time.Now().Add(rw.timeout))
+	}
+	err := rw.w.Flush()
+	if err != nil {
+		rw.conn.Close()
+	}
+	return err
+}
+
+// send writes v, and flushes it with the replies buffered before it if
+// flush is set. Until it is written, v counts in the output memory of the
+// client.
+func (rw *replyWriter) send(v resp.RespValue, flush bool) error {
+	size := resp.Size(v)
+	rw.client.AddOutputMemory(size)
+	defer rw.client.AddOutputMemory(-size)
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.timeout > 0 {
+		rw.conn.SetWriteDeadline(time.Now().Add(rw.timeout))
+	}
+	rw.w.SetProtocol(rw.client.Protocol())
+	var err error
+	if flush {
+		err = rw.w.WriteValue(v)
+	} else {
+		empty := rw.w.Buffered() == 0
+		err = rw.w.BufferValue(v)
+		if empty && rw.w.Buffered() > 0 {
+			rw.flushAfter(maxReplyDelay)
+		}
+	}
+	if err != nil {
+		rw.conn.Close()
+	}
+	return err
+}
+
+// flushAfter flushes the buffered replies once delay elapsed, whatever the
+// connection's goroutine is doing meanwhile. rw.mu must be held.
+func (rw *replyWriter) flushAfter(delay time.Duration) {
+	if rw.timer == nil {
+		rw.timer = time.AfterFunc(delay, func() { rw.flush() })
+		return
+	}
+	rw.timer.Reset(delay)
+}
+
+// stop cancels the pending flush, once the connection is done.
+func (rw *replyWriter) stop() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.timer != nil {
+		rw.timer.Stop()
+	}
+}
+
+// lookup returns the spec of the command invoked by respValue.
+func (srv *server) lookup(respValue resp.RespValue) (*command.CommandSpec, bool) {
+	if respValue.Type != resp.Array || len(respValue.Array) == 0 {
+		return nil, false
 	}
+	return srv.registry.LookupArgv(respValue.Array)
 }
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"bufio"
+	"errors"
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// errDrained ends the requests of a connection drained by a shutdown.
+var errDrained = errors.New("connection drained")
+
+// request is a request read from a connection, waiting to be executed.
+type request struct {
+	value   resp.RespValue
+	bytes   int64 // Bytes of the request on the wire
+	err     error // Error reading the request; the last request of the queue
+	refused bool  // Read before the connection was drained, to be answered with an error
+}
+
+// pipeline reads and parses the requests of a connection in its own
+// goroutine while the connection's goroutine executes those read before,
+// so a client pipelining commands does not wait for each one to be parsed.
+// Parsed requests are queued until they run. Reading stops while the
+// queued requests hold limit bytes or more, so a burst of requests holds at
+// most limit bytes plus those of one request.
+type pipeline struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []request
+	queued   int64 // Bytes of the queued requests
+	limit    int64
+	closed   bool // The connection is done with its requests
+	draining bool // No more requests are read, and those queued are refused
+}
+
+// newPipeline starts reading the requests of requests, reading from reader
+// through counter, and returns the queue they go to. gone is called once
+// reading fails, which tells that the connection went away while its
+// goroutine may be waiting, say on a blocking command.
+func newPipeline(requests *resp.Reader, reader *bufio.Reader, counter *countingReader, limit int64, gone func()) *pipeline {
+	p := &pipeline{limit: limit}
+	p.cond = sync.NewCond(&p.mu)
+	go func() {
+		for {
+			value, err := requests.ReadValue()
+			if err != nil {
+				gone()
+			}
+			n := counter.n - int64(reader.Buffered())
+			counter.n = int64(reader.Buffered())
+			if !p.push(request{value: value, bytes: n, err: err}) || err != nil {
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// push queues r once the queue has room for it, and reports whether the
+// connection still reads requests.
+func (p *pipeline) push(r request) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && !p.draining && len(p.queue) > 0 && p.queued >= p.limit {
+		p.cond.Wait()
+	}
+	if p.closed || p.draining {
+		return false
+	}
+	p.queue = append(p.queue, r)
+	p.queued += r.bytes
+	p.cond.Broadcast()
+	return true
+}
+
+// next returns the next request, waiting for it to be read. Once the
+// connection is drained, the queued requests are returned refused, and then
+// errDrained.
+func (p *pipeline) next() request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queue) == 0 && !p.draining {
+		p.cond.Wait()
+	}
+	if len(p.queue) == 0 {
+		return request{err: errDrained}
+	}
+	r := p.queue[0]
+	r.refused = p.draining && r.err == nil
+	p.queue[0] = request{}
+	p.queue = p.queue[1:]
+	p.queued -= r.bytes
+	p.cond.Broadcast()
+	return r
+}
+
+// pending reports whether a request is queued to be executed, so the reply
+// to the current one can wait to be sent along with the next. A queued read
+// error does not count, as the connection ends with it.
+func (p *pipeline) pending() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue) > 0 && p.queue[0].err == nil
+}
+
+// drain stops the reading of requests, for a shutdown: the request
+// executing completes, and the connection ends once the queued ones were
+// refused.
+func (p *pipeline) drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draining = true
+	p.cond.Broadcast()
+}
+
+// close stops the queueing of requests. The reading goroutine ends once
+// its read returns, which closing the connection makes happen.
+func (p *pipeline) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.queue = nil
+	p.cond.Broadcast()
+}
@@ -0,0 +1,25 @@
+package network_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/servertest"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// TestPipelineRepliesBeforeBlocking pipelines a write and a blocking pop:
+// the client gets the reply to the write while the pop waits.
+func TestPipelineRepliesBeforeBlocking(t *testing.T) {
+	srv := servertest.Start(t)
+	c := srv.Dial(t)
+	c.Send("SET", "a", "1")
+	c.Send("BLPOP", "q", "0")
+	if v := c.ReceiveWithin(time.Second); v.Type != resp.String || v.Str != "OK" {
+		t.Fatalf("SET got %+v, want +OK", v)
+	}
+	srv.Dial(t).Do("RPUSH", "q", "x")
+	if v := c.Receive(); len(v.Array) != 2 || v.Array[1].Str != "x" {
+		t.Fatalf("BLPOP got %+v, want [q x]", v)
+	}
+}
@@ -0,0 +1,31 @@
+package network
+
+import (
+	"net"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/config"
+)
+
+const protectedModeError = "DENIED Redis is running in protected mode because protected mode is enabled and no password is set for the default user. " +
+	"In this mode connections are only accepted from the loopback interface. " +
+	"If you want to connect from external computers to Redis you may adopt one of the following solutions: " +
+	"1) Disable protected mode by editing the configuration file, setting the protected mode option to 'no', and then restarting the server. " +
+	"2) If you started the server manually just for testing, restart it with the '--protected-mode no' option. " +
+	"3) Set an explicit bind address with the 'bind' option. " +
+	"NOTE: You only need to do one of the above things in order for the server to start accepting connections from the outside."
+
+// protectedModeDenies reports whether conn must be refused because the
+// server runs in protected mode: enabled, without an explicit bind address,
+// without a password for the default user, and the client does not connect
+// from a loopback address.
+func protectedModeDenies(cfg *config.Config, registry *command.CommandRegistry, conn net.Conn) bool {
+	if !cfg.ProtectedMode || len(cfg.Bind) != 0 || registry.DefaultUserHasPassword() {
+		return false
+	}
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	return !addr.IP.IsLoopback()
+}
@@ -0,0 +1,60 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// proxyDialTimeout bounds how long connecting to another node may take.
+const proxyDialTimeout = 5 * time.Second
+
+// upstreams holds the connections of a client to the nodes its commands
+// are forwarded to with cluster-proxy. Each client has its own, so its
+// commands run on a node in the order it sent them, blocking commands
+// included. The connections speak RESP2, whatever the client chose with
+// HELLO, and are closed with the client connection.
+type upstreams map[string]*upstream
+
+type upstream struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// forward runs the command argv on the node at addr and returns its reply.
+// A connection that fails is dropped, so the next command reconnects.
+func (u upstreams) forward(addr string, argv []resp.RespValue) resp.RespValue {
+	up, ok := u[addr]
+	if !ok {
+		conn, err := net.DialTimeout("tcp", addr, proxyDialTimeout)
+		if err != nil {
+			return resp.NewError(fmt.Sprintf("ERR failed to connect to the node at %s: %v", addr, err))
+		}
+		up = &upstream{conn: conn, r: bufio.NewReader(conn)}
+		u[addr] = up
+	}
+	reply, err := up.do(argv)
+	if err != nil {
+		up.conn.Close()
+		delete(u, addr)
+		return resp.NewError(fmt.Sprintf("ERR failed to forward the command to the node at %s: %v", addr, err))
+	}
+	return reply
+}
+
+func (up *upstream) do(argv []resp.RespValue) (resp.RespValue, error) {
+	if err := resp.WriteResp(up.conn, resp.NewArray(argv)); err != nil {
+		return resp.RespValue{}, err
+	}
+	return resp.ReadResp(up.r)
+}
+
+// close closes the connections to the nodes.
+func (u upstreams) close() {
+	for _, up := range u {
+		up.conn.Close()
+	}
+}
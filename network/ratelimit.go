@@ -0,0 +1,95 @@
+package network
+
+import (
+	"io"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+)
+
+// tokenBucket is a token bucket refilled at rate tokens per second, holding
+// at most one second worth of tokens.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// ready refills the bucket and reports whether it has tokens left.
+func (b *tokenBucket) ready(now time.Time) bool {
+	b.refill(now)
+	return b.tokens > 0
+}
+
+// take removes n tokens from a ready bucket, letting it go into debt so that
+// a request larger than the bucket still goes through, once.
+func (b *tokenBucket) take(n float64) {
+	b.tokens -= n
+}
+
+// rateLimiter enforces the per-connection command and bandwidth limits.
+// A nil bucket means the corresponding limit is disabled.
+type rateLimiter struct {
+	commands *tokenBucket
+	bytes    *tokenBucket
+}
+
+func newRateLimiter(commandsPerSec, bytesPerSec int64) *rateLimiter {
+	rl := &rateLimiter{}
+	if commandsPerSec > 0 {
+		rl.commands = newTokenBucket(commandsPerSec)
+	}
+	if bytesPerSec > 0 {
+		rl.bytes = newTokenBucket(bytesPerSec)
+	}
+	return rl
+}
+
+// allow reports whether one command of n request bytes may be executed,
+// and only then charges it to the buckets: a rejected command costs
+// nothing, so a client is throttled no longer than it exceeds the limits.
+func (rl *rateLimiter) allow(n int64) bool {
+	now := time.Now()
+	if rl.bytes != nil && !rl.bytes.ready(now) {
+		return false
+	}
+	if rl.commands != nil && !rl.commands.ready(now) {
+		return false
+	}
+	if rl.bytes != nil {
+		rl.bytes.take(float64(n))
+	}
+	if rl.commands != nil {
+		rl.commands.take(1)
+	}
+	return true
+}
+
+// countingReader counts the bytes read from the underlying reader, and
+// adds them to the input memory of client until their request executed.
+type countingReader struct {
+	r      io.Reader
+	n      int64
+	client *command.Client
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if n > 0 {
+		cr.client.AddInputMemory(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterChargesOnlyAdmittedCommands(t *testing.T) {
+	rl := newRateLimiter(10, 0)
+	admitted := 0
+	for i := 0; i < 1000; i++ {
+		if rl.allow(1) {
+			admitted++
+		}
+	}
+	if admitted < 10 || admitted > 11 {
+		t.Fatalf("admitted %d of 1000 commands at once, want about 10", admitted)
+	}
+	// The rejected commands left no debt: a tenth of a second refills a
+	// token, whatever the client sent meanwhile.
+	rl.commands.last = rl.commands.last.Add(-150 * time.Millisecond)
+	if !rl.allow(1) {
+		t.Fatal("command rejected after the bucket refilled")
+	}
+}
+
+func TestRateLimiterChecksBothBucketsBeforeCharging(t *testing.T) {
+	rl := newRateLimiter(1000, 100)
+	if !rl.allow(200) {
+		t.Fatal("first request rejected")
+	}
+	// The bytes bucket is in debt: the command is rejected without
+	// costing a command token.
+	commands := rl.commands.tokens
+	if rl.allow(1) {
+		t.Fatal("request admitted while the bytes bucket is in debt")
+	}
+	if rl.commands.tokens < commands {
+		t.Fatalf("rejected request charged the commands bucket: %v tokens, had %v", rl.commands.tokens, commands)
+	}
+}
+
+func TestRateLimiterAdmitsRequestsLargerThanTheBucket(t *testing.T) {
+	rl := newRateLimiter(0, 100)
+	if !rl.allow(1000) {
+		t.Fatal("request larger than the bucket rejected while the bucket was full")
+	}
+	if rl.allow(1) {
+		t.Fatal("request admitted while the bucket pays back a large request")
+	}
+}
@@ -0,0 +1,16 @@
+package network
+
+import (
+	"github.com/liweiyuan/go-redis-server/command"
+)
+
+const noReplicasError = "NOREPLICAS Not enough good replicas to write."
+
+// replicasDeny reports whether the write command may not run because fewer
+// than min-replicas-to-write replicas acknowledged the replication stream
+// within min-replicas-max-lag seconds. The server has no replicas, so any
+// non-zero setting refuses every write, as on a Redis master whose replicas
+// are all unreachable.
+func (srv *server) replicasDeny(spec *command.CommandSpec) bool {
+	return srv.cfg.MinReplicasToWrite > 0 && srv.cfg.MinReplicasMaxLag > 0 && spec.HasFlag(command.FlagWrite)
+}
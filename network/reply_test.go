@@ -0,0 +1,37 @@
+package network
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+func TestReplyWriterFlushesBufferedRepliesAfterMaxDelay(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	rw := &replyWriter{
+		conn:   server,
+		client: command.NewCommandRegistry().Clients().Register("127.0.0.1:0", "127.0.0.1:6379"),
+		w:      resp.NewWriter(server, 0),
+	}
+	defer rw.stop()
+	start := time.Now()
+	if err := rw.send(resp.NewString("OK"), false); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	v, err := resp.ReadResp(bufio.NewReader(client))
+	if err != nil {
+		t.Fatalf("buffered reply not flushed: %v", err)
+	}
+	if v.Str != "OK" {
+		t.Fatalf("got %+v, want +OK", v)
+	}
+	if elapsed := time.Since(start); elapsed < maxReplyDelay {
+		t.Fatalf("buffered reply flushed after %v, before maxReplyDelay", elapsed)
+	}
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"net"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+)
+
+const shuttingDownError = "ERR The server is shutting down"
+
+// connection is an open client connection, tracked so a shutdown can drain
+// it.
+type connection struct {
+	conn   net.Conn
+	client *command.Client
+	pipe   *pipeline
+}
+
+// addConn tracks c until removeConn, and reports whether it may be served:
+// connections accepted while the server drains are closed right away.
+func (srv *server) addConn(c *connection) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.draining {
+		return false
+	}
+	srv.conns[c] = struct{}{}
+	return true
+}
+
+func (srv *server) removeConn(c *connection) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.conns, c)
+}
+
+// Drain stops accepting connections and drains the open ones, except that
+// of except: each closes once its command in flight returned and its reply
+// was written, answering the requests it already read with an error.
+// Connections still open after grace are closed.
+func (srv *server) Drain(except *command.Client, grace time.Duration) {
+	srv.mu.Lock()
+	srv.draining = true
+	for _, listener := range srv.listeners {
+		listener.Close()
+	}
+	srv.listeners = nil
+	for c := range srv.conns {
+		if c.client != except {
+			c.pipe.drain()
+		}
+	}
+	srv.mu.Unlock()
+
+	deadline := time.Now().Add(grace)
+	for srv.openConns(except) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.conns {
+		if c.client != except {
+			c.conn.Close()
+		}
+	}
+}
+
+// openConns returns the number of open connections besides that of except.
+func (srv *server) openConns(except *command.Client) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	n := 0
+	for c := range srv.conns {
+		if c.client != except {
+			n++
+		}
+	}
+	return n
+}
+
+// Resume listens again after Drain, when the shutdown failed.
+func (srv *server) Resume() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.draining = false
+	srv.listeners = srv.listenAll()
+	for _, listener := range srv.listeners {
+		go srv.serve(listener)
+	}
+}
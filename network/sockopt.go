@@ -0,0 +1,44 @@
+package network
+
+import (
+	"log"
+	"net"
+
+	"github.com/liweiyuan/go-redis-server/config"
+)
+
+// listen opens the listening socket on addr with the configured backlog.
+func listen(cfg *config.Config, network, addr string) (net.Listener, error) {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TCPBacklog > 0 {
+		if err := setBacklog(listener, cfg.TCPBacklog); err != nil {
+			log.Printf("Failed to set TCP backlog to %d: %v", cfg.TCPBacklog, err)
+		}
+	}
+	return listener, nil
+}
+
+// applySocketOptions sets the configured TCP options on an accepted
+// connection.
+func applySocketOptions(cfg *config.Config, conn net.Conn) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if err := tcpConn.SetNoDelay(cfg.TCPNoDelay); err != nil {
+		log.Printf("Failed to set TCP_NODELAY on %s: %v", conn.RemoteAddr(), err)
+	}
+	if cfg.TCPSendBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(int(cfg.TCPSendBuffer)); err != nil {
+			log.Printf("Failed to set send buffer size on %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+	if cfg.TCPRecvBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(int(cfg.TCPRecvBuffer)); err != nil {
+			log.Printf("Failed to set receive buffer size on %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package network
+
+import (
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/command"
+)
+
+// subscribeModeCommands are the commands a RESP2 client may send while it
+// is subscribed to channels or patterns.
+var subscribeModeCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"SSUBSCRIBE":   true,
+	"SUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+	"RESET":        true,
+}
+
+// subscribeModeDenies reports whether the client may not run the command
+// because it is in subscribe mode, and returns the error to reply with.
+func subscribeModeDenies(client *command.Client, spec *command.CommandSpec) (string, bool) {
+	if subscribeModeCommands[spec.FullName()] || !client.InSubscribeMode() {
+		return "", false
+	}
+	return "ERR Can't execute '" + strings.ToLower(spec.FullName()) + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", true
+}
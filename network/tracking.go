@@ -0,0 +1,32 @@
+package network
+
+import (
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// track updates the client-side caching tracking table after a command:
+// keys read by tracking clients are remembered, and keys modified by a
+// successful write are invalidated.
+func (srv *server) track(client *command.Client, respValue resp.RespValue, result resp.RespValue) {
+	spec, ok := srv.lookup(respValue)
+	if !ok {
+		return
+	}
+	if spec.FullName() == "CLIENT|CACHING" {
+		// CLIENT CACHING applies to the command that follows it.
+		return
+	}
+	tracking := srv.registry.Tracking()
+	var keys []string
+	if spec.HasFlag(command.FlagWrite) || spec.HasFlag(command.FlagReadOnly) {
+		keys, _ = srv.registry.GetKeys(respValue.Array)
+	}
+	if spec.HasFlag(command.FlagWrite) {
+		if result.Type != resp.Error {
+			tracking.Invalidate(client, keys)
+		}
+		keys = nil
+	}
+	tracking.Read(client, keys)
+}
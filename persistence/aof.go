@@ -0,0 +1,641 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// Fsync policies of the append only file, as the appendfsync directive
+// names them.
+const (
+	FsyncAlways   = "always"   // After every command
+	FsyncEverySec = "everysec" // Once per second, in the background
+	FsyncNo       = "no"       // Left to the operating system
+)
+
+// ErrRewriteInProgress is returned when a rewrite of the append only file
+// is started while another one is running.
+var ErrRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// AOF is the append only file: a log of the write commands, in the RESP
+// format, that recreates the dataset when replayed. It is split into a base
+// file and incremental files, listed by a manifest in its directory. A
+// rewrite replaces the base with the shortest log of the current dataset.
+type AOF struct {
+	dir  string
+	name string // Prefix of the file names
+	opts AOFOptions
+
+	mu        sync.Mutex
+	manifest  manifest
+	f         *os.File // Last incremental file, commands are appended to it
+	size      int64    // Current size of the files
+	baseSize  int64    // Size after the last rewrite or load
+	unsynced  bool     // Commands were written since the last fsync
+	rewriting bool     // A rewrite is in progress
+
+	scheduled     atomic.Bool // A rewrite waits for a snapshot in progress
+	lastRewriteOK atomic.Bool // The last rewrite succeeded
+
+	stop chan struct{}
+}
+
+// AOFOptions configures the append only file.
+type AOFOptions struct {
+	Fsync         string // Fsync policy
+	RDBPreamble   bool   // Rewrite the dataset as an RDB snapshot, which loads much faster than the equivalent commands
+	LoadTruncated bool   // Load a last file whose last command is cut short, trimming it, instead of failing
+}
+
+// OpenAOF opens the append only file in dir, whose files are named after
+// name, creating it if needed, and syncs it according to the fsync policy.
+// A single file append only file named name next to dir, as older versions
+// wrote it, becomes the base file. Temporary files left by a crash are
+// removed.
+func OpenAOF(dir, name string, opts AOFOptions) (*AOF, error) {
+	if opts.Fsync != FsyncAlways && opts.Fsync != FsyncEverySec && opts.Fsync != FsyncNo {
+		return nil, fmt.Errorf("invalid appendfsync policy '%s'", opts.Fsync)
+	}
+	if name == "" || filepath.Base(name) != name || strings.ContainsAny(name, " \t\r\n") {
+		return nil, fmt.Errorf("invalid appendfilename '%s'", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &AOF{dir: dir, name: name, opts: opts, stop: make(chan struct{})}
+	if err := a.removeTemp(); err != nil {
+		return nil, err
+	}
+	m, err := readManifest(a.manifestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		m, err = a.upgrade()
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.manifest = m
+	if err := a.deleteHistory(); err != nil {
+		return nil, err
+	}
+	if len(a.manifest.incrs) == 0 {
+		if err := a.openIncr(); err != nil {
+			return nil, err
+		}
+	} else {
+		last := a.manifest.incrs[len(a.manifest.incrs)-1]
+		a.f, err = os.OpenFile(a.filePath(last.name), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range a.manifest.files() {
+		info, err := os.Stat(a.filePath(f.name))
+		if err != nil {
+			a.f.Close()
+			return nil, err
+		}
+		a.size += info.Size()
+	}
+	a.baseSize = a.size
+	a.lastRewriteOK.Store(true)
+	if opts.Fsync == FsyncEverySec {
+		go a.syncEverySecond()
+	}
+	return a, nil
+}
+
+// upgrade moves a single file append only file into the directory as the
+// base file. Without one, it returns an empty manifest.
+func (a *AOF) upgrade() (manifest, error) {
+	var m manifest
+	old := filepath.Join(filepath.Dir(a.dir), a.name)
+	if _, err := os.Stat(old); errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+	m.base = &aofFile{name: a.name, seq: 1, typ: aofBase}
+	if err := os.Rename(old, a.filePath(a.name)); err != nil {
+		return m, err
+	}
+	if err := syncDir(filepath.Dir(a.dir)); err != nil {
+		return m, err
+	}
+	if err := writeManifest(a.manifestPath(), &m); err != nil {
+		return m, err
+	}
+	log.Printf("Moved the append only file %s to %s", old, a.dir)
+	return m, nil
+}
+
+// removeTemp removes the temporary files of rewrites and manifest updates
+// interrupted by a crash.
+func (a *AOF) removeTemp() error {
+	for _, pattern := range []string{"temp-rewriteaof-*", "temp-manifest-*"} {
+		names, err := filepath.Glob(filepath.Join(a.dir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// manifestPath returns the path of the manifest.
+func (a *AOF) manifestPath() string {
+	return filepath.Join(a.dir, a.name+".manifest")
+}
+
+// filePath returns the path of the file of the append only file with the
+// given name.
+func (a *AOF) filePath(name string) string {
+	return filepath.Join(a.dir, name)
+}
+
+// openIncr starts a new incremental file, which the commands fed from now
+// on are appended to. The caller must hold a.mu, except while opening.
+func (a *AOF) openIncr() error {
+	seq := a.manifest.nextIncrSeq()
+	incr := aofFile{name: fmt.Sprintf("%s.%d.incr.aof", a.name, seq), seq: seq, typ: aofIncr}
+	f, err := os.OpenFile(a.filePath(incr.name), os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// The file must exist after a crash once the manifest lists it.
+	if err := syncDir(a.dir); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	m := a.manifest
+	m.incrs = append(slices.Clip(m.incrs), incr)
+	if err := writeManifest(a.manifestPath(), &m); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if a.f != nil {
+		if err := a.f.Sync(); err != nil {
+			log.Printf("Failed to fsync the append only file: %v", err)
+		}
+		a.f.Close()
+	}
+	a.manifest = m
+	a.f = f
+	a.unsynced = false
+	return nil
+}
+
+// deleteHistory deletes the files made obsolete by a rewrite, then drops
+// them from the manifest. The caller must hold a.mu, except while opening.
+func (a *AOF) deleteHistory() error {
+	if len(a.manifest.history) == 0 {
+		return nil
+	}
+	for _, f := range a.manifest.history {
+		if err := os.Remove(a.filePath(f.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	m := a.manifest
+	m.history = nil
+	if err := writeManifest(a.manifestPath(), &m); err != nil {
+		return err
+	}
+	a.manifest = m
+	return nil
+}
+
+// Dir returns the directory of the append only file.
+func (a *AOF) Dir() string {
+	return a.dir
+}
+
+// Close syncs and closes the file.
+func (a *AOF) Close() error {
+	close(a.stop)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.f.Sync(); err != nil {
+		a.f.Close()
+		return err
+	}
+	return a.f.Close()
+}
+
+// syncEverySecond syncs the file once per second if commands were written.
+func (a *AOF) syncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			if a.unsynced {
+				if err := a.f.Sync(); err != nil {
+					log.Printf("Failed to fsync the append only file: %v", err)
+				}
+				a.unsynced = false
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Feed appends a command to the last incremental file.
+func (a *AOF) Feed(argv []string) error {
+	var buf bytes.Buffer
+	encodeCommand(&buf, argv)
+	return a.append(buf.Bytes())
+}
+
+// FeedTransaction appends cmds to the file as a MULTI/EXEC transaction,
+// in a single write, so that Load applies all of them or none.
+func (a *AOF) FeedTransaction(cmds [][]string) error {
+	var buf bytes.Buffer
+	encodeCommand(&buf, []string{"MULTI"})
+	for _, argv := range cmds {
+		encodeCommand(&buf, argv)
+	}
+	encodeCommand(&buf, []string{"EXEC"})
+	return a.append(buf.Bytes())
+}
+
+// append writes encoded commands to the last incremental file.
+func (a *AOF) append(p []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n, err := a.f.Write(p)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if a.opts.Fsync == FsyncAlways {
+		return a.f.Sync()
+	}
+	a.unsynced = true
+	return nil
+}
+
+// rdbMagic starts an RDB preamble.
+const rdbMagic = "REDIS"
+
+// encodeCommand writes argv to w as a RESP array of bulk strings.
+func encodeCommand(w io.Writer, argv []string) error {
+	vals := make([]resp.RespValue, len(argv))
+	for i, arg := range argv {
+		vals[i] = resp.NewBulk(arg)
+	}
+	return resp.WriteResp(w, resp.NewArray(vals))
+}
+
+// Load replays the files into s in order: an RDB preamble of the base file
+// is loaded into s, then apply is called with each of the commands. If the
+// last file ends with a command cut short, as when the server crashed while
+// writing it, the file is trimmed to its last whole command if the
+// LoadTruncated option is set; otherwise, or in an earlier file, Load fails.
+func (a *AOF) Load(s *storage.Storage, apply func(argv []string) error) error {
+	a.mu.Lock()
+	files := a.manifest.files()
+	a.mu.Unlock()
+	for i, f := range files {
+		last := i == len(files)-1
+		valid, err := a.loadFile(f.name, i == 0, s, apply)
+		if !errors.Is(err, errTruncated) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !last || !a.opts.LoadTruncated {
+			return fmt.Errorf("%w; set aof-load-truncated yes to load it anyway", err)
+		}
+		log.Printf("!!! Warning: short read while loading the append only file %s !!!", f.name)
+		if err := a.truncate(valid); err != nil {
+			return err
+		}
+		log.Printf("Append only file %s loaded anyway because aof-load-truncated is enabled", f.name)
+	}
+	return nil
+}
+
+// errTruncated is returned by loadFile when the file ends with a command
+// cut short.
+var errTruncated = errors.New("unexpected end of file")
+
+// loadFile replays one file into s, which may start with an RDB preamble if
+// it is the first one. It returns the size of the file up to the end of the
+// last command read.
+func (a *AOF) loadFile(name string, first bool, s *storage.Storage, apply func(argv []string) error) (int64, error) {
+	f, err := os.Open(a.filePath(name))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	cr := &countingReader{r: f}
+	br := bufio.NewReader(cr)
+	offset := func() int64 { return cr.n - int64(br.Buffered()) }
+	if magic, _ := br.Peek(len(rdbMagic)); first && string(magic) == rdbMagic {
+		// The RDB reader shares br, so it stops right after the preamble.
+		if err := s.ReadSnapshot(br); err != nil {
+			return 0, fmt.Errorf("%s: RDB preamble: %w", name, err)
+		}
+	}
+	r := resp.NewReader(br, resp.Limits{})
+	valid := offset()
+	var tx [][]string // Commands of the transaction being read, if inTx
+	inTx := false
+	for n := 1; ; n++ {
+		v, err := r.ReadValue()
+		if err == io.EOF && offset() == valid && !inTx {
+			return valid, nil
+		}
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return valid, fmt.Errorf("%s: command %d: %w", name, n, errTruncated)
+		}
+		if err != nil {
+			return valid, fmt.Errorf("%s: command %d: %w", name, n, err)
+		}
+		if v.Type != resp.Array || len(v.Array) == 0 {
+			return valid, fmt.Errorf("%s: command %d: not a command", name, n)
+		}
+		argv := make([]string, len(v.Array))
+		for i, arg := range v.Array {
+			argv[i] = arg.Str
+		}
+		// The commands of a transaction are applied once it is read whole,
+		// and the file is only valid up to its start until then, so that
+		// a transaction cut short is dropped along with its MULTI.
+		switch {
+		case strings.EqualFold(argv[0], "MULTI") && len(argv) == 1:
+			if inTx {
+				return valid, fmt.Errorf("%s: command %d: MULTI calls can not be nested", name, n)
+			}
+			inTx, tx = true, nil
+			continue
+		case strings.EqualFold(argv[0], "EXEC") && len(argv) == 1:
+			if !inTx {
+				return valid, fmt.Errorf("%s: command %d: EXEC without MULTI", name, n)
+			}
+			for _, argv := range tx {
+				if err := apply(argv); err != nil {
+					return valid, fmt.Errorf("%s: command %d: %w", name, n, err)
+				}
+			}
+			inTx, tx = false, nil
+		case inTx:
+			tx = append(tx, argv)
+			continue
+		default:
+			if err := apply(argv); err != nil {
+				return valid, fmt.Errorf("%s: command %d: %w", name, n, err)
+			}
+		}
+		valid = offset()
+	}
+}
+
+// truncate cuts the last incremental file, which commands are appended
+// to, to size bytes, dropping a command cut short.
+func (a *AOF) truncate(size int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	info, err := a.f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := a.f.Truncate(size); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+	a.size -= info.Size() - size
+	a.baseSize = a.size
+	return nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// BackgroundRewrite starts writing a new base file from the dataset in a
+// separate goroutine. Commands are appended to a new incremental file from
+// now on, so the files it replaces can be deleted once it is written. As
+// with Snapshotter.BackgroundSave, the caller must ensure no write is in
+// progress. If a snapshot is being written, the rewrite is scheduled
+// instead, and scheduled reports true.
+func (a *AOF) BackgroundRewrite(s *storage.Storage) (scheduled bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriting {
+		return false, ErrRewriteInProgress
+	}
+	sn, err := s.BeginSnapshot()
+	if errors.Is(err, storage.ErrSnapshotInProgress) {
+		a.scheduled.Store(true)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := a.openIncr(); err != nil {
+		sn.Abort()
+		return false, err
+	}
+	ext := "aof"
+	if a.opts.RDBPreamble {
+		ext = "rdb"
+	}
+	seq := a.manifest.nextBaseSeq()
+	base := aofFile{name: fmt.Sprintf("%s.%d.base.%s", a.name, seq, ext), seq: seq, typ: aofBase}
+	incr := a.manifest.incrs[len(a.manifest.incrs)-1]
+	a.scheduled.Store(false)
+	a.rewriting = true
+	go func() {
+		err := a.rewrite(sn, base, incr)
+		if err != nil {
+			log.Printf("Background append only file rewriting error: %v", err)
+		} else {
+			log.Printf("Background AOF rewrite finished successfully")
+		}
+		a.lastRewriteOK.Store(err == nil)
+	}()
+	return false, nil
+}
+
+// rewrite writes the snapshot sn to the new base file, then replaces the
+// base and the incremental files before incr with it.
+func (a *AOF) rewrite(sn *storage.Snapshot, base, incr aofFile) error {
+	tmp, err := os.CreateTemp(a.dir, "temp-rewriteaof-*.aof")
+	if err != nil {
+		sn.Abort()
+		a.endRewrite()
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		a.endRewrite()
+		return err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		sn.Abort()
+		return fail(err)
+	}
+	w := bufio.NewWriter(tmp)
+	if a.opts.RDBPreamble {
+		err = sn.WriteRDB(w)
+	} else {
+		err = sn.Commands(func(argv []string) error { return encodeCommand(w, argv) })
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp.Name(), a.filePath(base.name)); err != nil {
+		return fail(err)
+	}
+	if err := syncDir(a.dir); err != nil {
+		os.Remove(a.filePath(base.name))
+		a.endRewrite()
+		return err
+	}
+	if err := a.finishRewrite(base, incr); err != nil {
+		os.Remove(a.filePath(base.name))
+		a.endRewrite()
+		return err
+	}
+	return nil
+}
+
+// finishRewrite makes base the base file, keeping the incremental files
+// from incr on, and deletes the files it replaces.
+func (a *AOF) finishRewrite(base, incr aofFile) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := manifest{base: &base}
+	if a.manifest.base != nil {
+		old := *a.manifest.base
+		old.typ = aofHistory
+		m.history = append(m.history, old)
+	}
+	for _, f := range a.manifest.incrs {
+		if f.seq < incr.seq {
+			f.typ = aofHistory
+			m.history = append(m.history, f)
+		} else {
+			m.incrs = append(m.incrs, f)
+		}
+	}
+	m.history = append(m.history, a.manifest.history...)
+	if err := writeManifest(a.manifestPath(), &m); err != nil {
+		return err
+	}
+	a.manifest = m
+	a.size = 0
+	for _, f := range m.files() {
+		if info, err := os.Stat(a.filePath(f.name)); err == nil {
+			a.size += info.Size()
+		}
+	}
+	a.baseSize = a.size
+	a.rewriting = false
+	if err := a.deleteHistory(); err != nil {
+		log.Printf("Failed to delete the obsolete append only files: %v", err)
+	}
+	return nil
+}
+
+// endRewrite ends a failed rewrite. The incremental file it started stays,
+// listed after the files it was meant to replace.
+func (a *AOF) endRewrite() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewriting = false
+}
+
+// Rewriting reports whether a rewrite is in progress.
+func (a *AOF) Rewriting() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewriting
+}
+
+// RewriteScheduled reports whether a rewrite waits for a snapshot to
+// finish.
+func (a *AOF) RewriteScheduled() bool {
+	return a.scheduled.Load()
+}
+
+// LastRewriteOK reports whether the last rewrite succeeded. It is true
+// before the first one.
+func (a *AOF) LastRewriteOK() bool {
+	return a.lastRewriteOK.Load()
+}
+
+// Sizes returns the current size of the files and their size after the
+// last rewrite or load.
+func (a *AOF) Sizes() (size, baseSize int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size, a.baseSize
+}
+
+// RewriteDue reports whether the file should be rewritten: when a rewrite
+// is scheduled, or when it reached minSize and grew by percentage percent
+// since the last rewrite. A percentage of 0 disables the automatic rewrite.
+func (a *AOF) RewriteDue(percentage int, minSize int64) bool {
+	if a.scheduled.Load() {
+		return true
+	}
+	if percentage <= 0 {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriting || a.size < minSize {
+		return false
+	}
+	base := max(a.baseSize, 1)
+	return (a.size-base)*100/base >= int64(percentage)
+}
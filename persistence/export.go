@@ -0,0 +1,467 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// Formats of Export and Import.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// The JSON format is an array with one object per key, one per line:
+//
+//	{"key":"k","type":"string","ttl":5000,"value":"v"}
+//
+// where ttl is the time to live in milliseconds, omitted for none, and value
+// is a string, an array of strings for a list or a set, an object for a
+// hash, an array of {"member","score"} objects for a sorted set, or an
+// array of {"id","fields"} objects for a stream, fields holding its fields
+// and values alternately. The consumer groups of a stream are not exported.
+//
+// The CSV format has a header line and the columns key, type, ttl, field
+// and value, with one line per string, list element, set member, hash field
+// or sorted set member. A hash field goes in field, as does a sorted set
+// member, whose score goes in value. Streams cannot be exported as CSV.
+
+// csvHeader is the first line of the CSV format.
+var csvHeader = []string{"key", "type", "ttl", "field", "value"}
+
+// FormatOf returns the format for a file name: CSV for a .csv file, JSON
+// otherwise.
+func FormatOf(name string) string {
+	if strings.HasSuffix(strings.ToLower(name), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSON
+}
+
+// Export writes the dataset of s to w in format, skipping the keys that
+// already expired. Values that the format cannot hold exactly, such as
+// binary strings, make it fail.
+func Export(s *storage.Storage, w io.Writer, format string) error {
+	if format != FormatJSON && format != FormatCSV {
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+	sn, err := s.BeginSnapshot()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	n := 0
+	if format == FormatJSON {
+		bw.WriteString("[")
+	} else {
+		cw.Write(csvHeader)
+	}
+	now := time.Now().UnixMilli()
+	err = sn.Entries(func(e storage.Entry) error {
+		ttl := int64(0)
+		if e.ExpireAt >= 0 {
+			if ttl = e.ExpireAt - now; ttl <= 0 {
+				return nil
+			}
+		}
+		if err := checkExportable(e, format); err != nil {
+			return err
+		}
+		if format == FormatCSV {
+			return writeCSVEntry(cw, e, ttl)
+		}
+		if n > 0 {
+			bw.WriteString(",")
+		}
+		n++
+		bw.WriteString("\n")
+		return writeJSONEntry(bw, e, ttl)
+	})
+	if err != nil {
+		return err
+	}
+	if format == FormatJSON {
+		if n > 0 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("]\n")
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// checkExportable checks that the strings of e can be written in format
+// and read back unchanged.
+func checkExportable(e storage.Entry, format string) error {
+	strs := []string{e.Key, e.String}
+	strs = append(strs, e.Elements...)
+	for field, value := range e.Fields {
+		strs = append(strs, field, value)
+	}
+	for _, m := range e.Members {
+		strs = append(strs, m.Member)
+	}
+	for _, str := range strs {
+		// The CSV reader turns \r\n in a quoted field into \n.
+		if !utf8.ValidString(str) || format == FormatCSV && strings.Contains(str, "\r") {
+			return fmt.Errorf("key %q: value cannot be exported as %s", e.Key, strings.ToUpper(format))
+		}
+	}
+	return nil
+}
+
+// jsonEntry is a key in the JSON format.
+type jsonEntry struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	TTL   int64           `json:"ttl,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonMember is a sorted set member in the JSON format.
+type jsonMember struct {
+	Member string    `json:"member"`
+	Score  jsonScore `json:"score"`
+}
+
+// jsonStreamEntry is a stream entry in the JSON format.
+type jsonStreamEntry struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+// jsonScore is a score in the JSON format: a number, or the string "inf"
+// or "-inf", which JSON numbers cannot hold.
+type jsonScore float64
+
+func (sc jsonScore) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(sc), 0) {
+		return json.Marshal(formatScore(float64(sc)))
+	}
+	return []byte(strconv.FormatFloat(float64(sc), 'g', -1, 64)), nil
+}
+
+func (sc *jsonScore) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		str = string(data)
+	}
+	f, err := parseScore(str)
+	if err != nil {
+		return err
+	}
+	*sc = jsonScore(f)
+	return nil
+}
+
+// formatScore formats a score as ZSCORE does.
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseScore parses a score, accepting inf and -inf.
+func parseScore(str string) (float64, error) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid score '%s'", str)
+	}
+	return f, nil
+}
+
+// marshalJSON encodes v without escaping HTML characters, which keeps the
+// output readable.
+func marshalJSON(v any) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// writeJSONEntry writes e to w as a JSON object.
+func writeJSONEntry(w *bufio.Writer, e storage.Entry, ttl int64) error {
+	var value any
+	switch e.Type {
+	case "string":
+		value = e.String
+	case "list", "set":
+		value = e.Elements
+	case "hash":
+		value = e.Fields
+	case "zset":
+		members := make([]jsonMember, len(e.Members))
+		for i, m := range e.Members {
+			members[i] = jsonMember{Member: m.Member, Score: jsonScore(m.Score)}
+		}
+		value = members
+	case "stream":
+		entries := make([]jsonStreamEntry, len(e.Entries))
+		for i, se := range e.Entries {
+			entries[i] = jsonStreamEntry{ID: se.ID.String(), Fields: se.Fields}
+		}
+		value = entries
+	}
+	raw, err := marshalJSON(value)
+	if err != nil {
+		return err
+	}
+	data, err := marshalJSON(jsonEntry{Key: e.Key, Type: e.Type, TTL: ttl, Value: raw})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeCSVEntry writes e to w as CSV lines.
+func writeCSVEntry(w *csv.Writer, e storage.Entry, ttl int64) error {
+	ttlStr := ""
+	if ttl > 0 {
+		ttlStr = strconv.FormatInt(ttl, 10)
+	}
+	row := func(field, value string) error {
+		return w.Write([]string{e.Key, e.Type, ttlStr, field, value})
+	}
+	switch e.Type {
+	case "string":
+		return row("", e.String)
+	case "list", "set":
+		for _, el := range e.Elements {
+			if err := row("", el); err != nil {
+				return err
+			}
+		}
+	case "hash":
+		fields := make([]string, 0, len(e.Fields))
+		for field := range e.Fields {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		for _, field := range fields {
+			if err := row(field, e.Fields[field]); err != nil {
+				return err
+			}
+		}
+	case "zset":
+		for _, m := range e.Members {
+			if err := row(m.Member, formatScore(m.Score)); err != nil {
+				return err
+			}
+		}
+	case "stream":
+		return fmt.Errorf("key '%s': streams cannot be exported as CSV", e.Key)
+	}
+	return nil
+}
+
+// Import adds the keys read from r in format to s. A key that already
+// exists makes it fail, except for the lines of a collection in the CSV
+// format, which add to it.
+func Import(s *storage.Storage, r io.Reader, format string) error {
+	switch format {
+	case FormatJSON:
+		return importJSON(s, r)
+	case FormatCSV:
+		return importCSV(s, r)
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
+
+func importJSON(s *storage.Storage, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return errors.New("expected a JSON array")
+	}
+	for n := 1; dec.More(); n++ {
+		var je jsonEntry
+		if err := dec.Decode(&je); err != nil {
+			return fmt.Errorf("entry %d: %w", n, err)
+		}
+		if err := importJSONEntry(s, je); err != nil {
+			return fmt.Errorf("entry %d: %w", n, err)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func importJSONEntry(s *storage.Storage, je jsonEntry) error {
+	if s.Exists(je.Key) > 0 {
+		return fmt.Errorf("duplicate key '%s'", je.Key)
+	}
+	if len(je.Value) == 0 {
+		return fmt.Errorf("key '%s': missing value", je.Key)
+	}
+	var err error
+	switch je.Type {
+	case "string":
+		var str string
+		if err = json.Unmarshal(je.Value, &str); err == nil {
+			s.Set(je.Key, str)
+		}
+	case "list", "set":
+		var elements []string
+		if err = json.Unmarshal(je.Value, &elements); err == nil && len(elements) == 0 {
+			err = fmt.Errorf("empty %s", je.Type)
+		}
+		if err == nil && je.Type == "list" {
+			_, err = s.RPush(je.Key, elements...)
+		} else if err == nil {
+			_, err = s.SAdd(je.Key, elements...)
+		}
+	case "hash":
+		var fields map[string]string
+		if err = json.Unmarshal(je.Value, &fields); err == nil && len(fields) == 0 {
+			err = errors.New("empty hash")
+		}
+		for field, value := range fields {
+			if err == nil {
+				_, err = s.HSet(je.Key, field, value)
+			}
+		}
+	case "zset":
+		var members []jsonMember
+		if err = json.Unmarshal(je.Value, &members); err == nil && len(members) == 0 {
+			err = errors.New("empty zset")
+		}
+		if err == nil {
+			zms := make([]storage.ZSetMember, len(members))
+			for i, m := range members {
+				zms[i] = storage.ZSetMember{Member: m.Member, Score: float64(m.Score)}
+			}
+			_, err = s.ZAdd(je.Key, zms...)
+		}
+	case "stream":
+		var entries []jsonStreamEntry
+		if err = json.Unmarshal(je.Value, &entries); err == nil && len(entries) == 0 {
+			err = errors.New("empty stream")
+		}
+		for _, se := range entries {
+			if err != nil {
+				break
+			}
+			err = importStreamEntry(s, je.Key, se)
+		}
+	default:
+		err = fmt.Errorf("unknown type '%s'", je.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("key '%s': %w", je.Key, err)
+	}
+	return setTTL(s, je.Key, je.TTL)
+}
+
+// importStreamEntry adds se to the stream at key.
+func importStreamEntry(s *storage.Storage, key string, se jsonStreamEntry) error {
+	id, err := storage.ParseStreamID(se.ID, 0)
+	if err != nil {
+		return fmt.Errorf("invalid stream ID '%s'", se.ID)
+	}
+	if len(se.Fields) == 0 || len(se.Fields)%2 != 0 {
+		return fmt.Errorf("entry %s: fields and values do not pair up", se.ID)
+	}
+	_, _, err = s.XAdd(key, storage.XAddOptions{ID: id}, se.Fields)
+	return err
+}
+
+func importCSV(s *storage.Storage, r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(header, csvHeader) {
+		return fmt.Errorf("expected the header %s", strings.Join(csvHeader, ","))
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		if err := importCSVRecord(s, rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func importCSVRecord(s *storage.Storage, rec []string) error {
+	key, typ, field, value := rec[0], rec[1], rec[3], rec[4]
+	var ttl int64
+	if rec[2] != "" {
+		var err error
+		if ttl, err = strconv.ParseInt(rec[2], 10, 64); err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid ttl '%s'", rec[2])
+		}
+	}
+	var err error
+	switch typ {
+	case "string":
+		if s.Exists(key) > 0 {
+			return fmt.Errorf("duplicate key '%s'", key)
+		}
+		s.Set(key, value)
+	case "list":
+		_, err = s.RPush(key, value)
+	case "set":
+		_, err = s.SAdd(key, value)
+	case "hash":
+		_, err = s.HSet(key, field, value)
+	case "zset":
+		var score float64
+		if score, err = parseScore(value); err == nil {
+			_, err = s.ZAdd(key, storage.ZSetMember{Member: field, Score: score})
+		}
+	default:
+		err = fmt.Errorf("unknown type '%s'", typ)
+	}
+	if err != nil {
+		return fmt.Errorf("key '%s': %w", key, err)
+	}
+	return setTTL(s, key, ttl)
+}
+
+// setTTL makes key expire in ttl milliseconds, unless ttl is 0.
+func setTTL(s *storage.Storage, key string, ttl int64) error {
+	if ttl < 0 {
+		return fmt.Errorf("key '%s': invalid ttl %d", key, ttl)
+	}
+	if ttl > 0 {
+		s.Expire(key, time.Now().Add(time.Duration(ttl)*time.Millisecond), storage.ExpireAlways)
+	}
+	return nil
+}
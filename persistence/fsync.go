@@ -0,0 +1,10 @@
+package persistence
+
+// Files are replaced by writing a temporary file, syncing it and renaming it
+// over the old one, then syncing the directory so the rename survives a
+// crash. Either the old or the new file is found after a crash, never a
+// partial one.
+//
+// On macOS, os.File.Sync asks the drive to flush its cache, with
+// F_FULLFSYNC, as a plain fsync does not; appendfsync always is slower
+// there for it. Windows cannot sync directories, see syncDir.
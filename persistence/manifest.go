@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The append only file is split into files in its own directory: a base
+// file, written by the last rewrite, and incremental files holding the
+// commands logged since, in order. The manifest lists them. A rewrite starts
+// a new incremental file and writes a new base, then replaces the manifest;
+// the files it made obsolete are listed as history until they are deleted,
+// so a crash in between never loses track of them.
+
+// Types of the files listed in the manifest.
+const (
+	aofBase    = "b"
+	aofIncr    = "i"
+	aofHistory = "h"
+)
+
+// aofFile is a file listed in the manifest.
+type aofFile struct {
+	name string
+	seq  int
+	typ  string
+}
+
+// manifest lists the files of the append only file.
+type manifest struct {
+	base    *aofFile
+	incrs   []aofFile // In the order they are replayed
+	history []aofFile // Obsolete files still to be deleted
+}
+
+// files returns the files to replay: the base first, then the incremental
+// files.
+func (m *manifest) files() []aofFile {
+	var files []aofFile
+	if m.base != nil {
+		files = append(files, *m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+// nextIncrSeq returns the sequence number of the next incremental file.
+func (m *manifest) nextIncrSeq() int {
+	if len(m.incrs) == 0 {
+		return 1
+	}
+	return m.incrs[len(m.incrs)-1].seq + 1
+}
+
+// nextBaseSeq returns the sequence number of the next base file.
+func (m *manifest) nextBaseSeq() int {
+	if m.base == nil {
+		return 1
+	}
+	return m.base.seq + 1
+}
+
+// encode returns the manifest as written to disk, one file per line.
+func (m *manifest) encode() []byte {
+	var b bytes.Buffer
+	line := func(f aofFile) {
+		fmt.Fprintf(&b, "file %s seq %d type %s\n", f.name, f.seq, f.typ)
+	}
+	if m.base != nil {
+		line(*m.base)
+	}
+	for _, f := range m.history {
+		line(f)
+	}
+	for _, f := range m.incrs {
+		line(f)
+	}
+	return b.Bytes()
+}
+
+// readManifest reads the manifest at path.
+func readManifest(path string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		f, err := parseManifestLine(fields)
+		if err != nil {
+			return m, fmt.Errorf("%s: line %d: %w", path, n, err)
+		}
+		switch f.typ {
+		case aofBase:
+			if m.base != nil {
+				return m, fmt.Errorf("%s: line %d: more than one base file", path, n)
+			}
+			m.base = &f
+		case aofIncr:
+			if len(m.incrs) > 0 && f.seq <= m.incrs[len(m.incrs)-1].seq {
+				return m, fmt.Errorf("%s: line %d: incremental files out of order", path, n)
+			}
+			m.incrs = append(m.incrs, f)
+		case aofHistory:
+			m.history = append(m.history, f)
+		}
+	}
+	return m, sc.Err()
+}
+
+// parseManifestLine parses the key value pairs of a manifest line.
+func parseManifestLine(fields []string) (aofFile, error) {
+	var f aofFile
+	if len(fields)%2 != 0 {
+		return f, fmt.Errorf("invalid line")
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key, val := fields[i], fields[i+1]
+		switch key {
+		case "file":
+			if filepath.Base(val) != val {
+				return f, fmt.Errorf("invalid file name '%s'", val)
+			}
+			f.name = val
+		case "seq":
+			seq, err := strconv.Atoi(val)
+			if err != nil || seq < 1 {
+				return f, fmt.Errorf("invalid sequence number '%s'", val)
+			}
+			f.seq = seq
+		case "type":
+			if val != aofBase && val != aofIncr && val != aofHistory {
+				return f, fmt.Errorf("invalid file type '%s'", val)
+			}
+			f.typ = val
+		}
+	}
+	if f.name == "" || f.seq == 0 || f.typ == "" {
+		return f, fmt.Errorf("incomplete line")
+	}
+	return f, nil
+}
+
+// writeManifest replaces the manifest at path with m, so it is either the
+// old or the new one after a crash.
+func writeManifest(path string, m *manifest) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-manifest-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(m.encode()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
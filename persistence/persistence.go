@@ -0,0 +1,238 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// Snapshotter saves the dataset to the snapshot file and loads it back.
+type Snapshotter struct {
+	path string
+
+	mu           sync.Mutex   // Serializes saves and loads
+	lastSave     atomic.Int64 // Unix nanoseconds of the last save, readable during a save or load
+	loading      atomic.Bool  // A load started by LoadInBackground is in progress
+	bgsave       atomic.Bool  // A save started by BackgroundSave is in progress
+	lastBgsaveOK atomic.Bool  // The last background save succeeded
+	lastBgsave   atomic.Int64 // Unix nanoseconds of the start of the last background save
+
+	savePoints atomic.Pointer[[]SavePoint]
+}
+
+// SavePoint triggers a background save once Changes changes were made and
+// Seconds seconds passed since the last save.
+type SavePoint struct {
+	Seconds int
+	Changes int64
+}
+
+// bgsaveRetryDelay is how long to wait after a failed background save
+// before a save point triggers another one.
+const bgsaveRetryDelay = 5 * time.Second
+
+// ErrSaveInProgress is returned when a save is started while a background
+// save is being written.
+var ErrSaveInProgress = errors.New("Background save already in progress")
+
+// New returns a Snapshotter using the snapshot file at path.
+func New(path string) *Snapshotter {
+	p := &Snapshotter{path: path}
+	p.lastSave.Store(time.Now().UnixNano())
+	p.lastBgsaveOK.Store(true)
+	return p
+}
+
+// Path returns the path of the snapshot file.
+func (p *Snapshotter) Path() string {
+	return p.path
+}
+
+// Save writes the dataset to the snapshot file. The snapshot is written to
+// a temporary file first and renamed over the previous one, so a failed
+// save never leaves a partial snapshot behind.
+func (p *Snapshotter) Save(s *storage.Storage) error {
+	sn, err := s.BeginSnapshot()
+	if err != nil {
+		return ErrSaveInProgress
+	}
+	return p.write(sn)
+}
+
+// BackgroundSave starts writing the dataset to the snapshot file in a
+// separate goroutine, while commands keep running. The snapshot holds the
+// dataset as it is when BackgroundSave is called, so the caller must ensure
+// no write is in progress.
+func (p *Snapshotter) BackgroundSave(s *storage.Storage) error {
+	sn, err := s.BeginSnapshot()
+	if err != nil {
+		return ErrSaveInProgress
+	}
+	p.bgsave.Store(true)
+	p.lastBgsave.Store(time.Now().UnixNano())
+	go func() {
+		defer p.bgsave.Store(false)
+		err := p.write(sn)
+		if err != nil {
+			log.Printf("Background saving error: %v", err)
+		} else {
+			log.Printf("Background saving terminated with success")
+		}
+		p.lastBgsaveOK.Store(err == nil)
+	}()
+	return nil
+}
+
+// write saves the snapshot sn to the snapshot file.
+func (p *Snapshotter) write(sn *storage.Snapshot) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), "temp-*.rdb")
+	if err != nil {
+		sn.Abort()
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := sn.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(p.path)); err != nil {
+		return err
+	}
+	p.lastSave.Store(time.Now().UnixNano())
+	return nil
+}
+
+// Load replaces the dataset with the contents of the snapshot file. A
+// missing file is not an error and leaves the dataset untouched.
+func (p *Snapshotter) Load(s *storage.Storage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.Open(p.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := s.ReadSnapshot(f); err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+	return nil
+}
+
+// LoadInBackground loads the snapshot file like Load, but in a separate
+// goroutine, so the server can accept connections meanwhile. Loading
+// reports true from the moment it is called until the load completes. The
+// returned channel receives the result of the load.
+func (p *Snapshotter) LoadInBackground(s *storage.Storage) <-chan error {
+	return p.loadInBackground(func() error { return p.Load(s) })
+}
+
+// LoadAOFInBackground is LoadInBackground for a server with the append
+// only file enabled: the dataset is replayed from aof, calling apply with
+// each command. An empty append only file, as when it was just enabled, is
+// rewritten from the snapshot file instead.
+func (p *Snapshotter) LoadAOFInBackground(s *storage.Storage, aof *AOF, apply func(argv []string) error) <-chan error {
+	return p.loadInBackground(func() error {
+		if size, _ := aof.Sizes(); size > 0 {
+			if err := aof.Load(s, apply); err != nil {
+				return err
+			}
+			s.ResetDirty()
+			return nil
+		}
+		if err := p.Load(s); err != nil {
+			return err
+		}
+		_, err := aof.BackgroundRewrite(s)
+		return err
+	})
+}
+
+func (p *Snapshotter) loadInBackground(load func() error) <-chan error {
+	p.loading.Store(true)
+	done := make(chan error, 1)
+	go func() {
+		defer p.loading.Store(false)
+		done <- load()
+	}()
+	return done
+}
+
+// Loading reports whether a load started by LoadInBackground is in
+// progress.
+func (p *Snapshotter) Loading() bool {
+	return p.loading.Load()
+}
+
+// SetSavePoints sets the save points checked by DueSavePoint.
+func (p *Snapshotter) SetSavePoints(points []SavePoint) {
+	p.savePoints.Store(&points)
+}
+
+// HasSavePoints reports whether save points are set, so the dataset is
+// saved on shutdown.
+func (p *Snapshotter) HasSavePoints() bool {
+	points := p.savePoints.Load()
+	return points != nil && len(*points) > 0
+}
+
+// DueSavePoint returns the save point reached with dirty changes since the
+// last save, if any. No save point is due while a background save or a
+// load is in progress, or shortly after a background save failed.
+func (p *Snapshotter) DueSavePoint(dirty int64) (SavePoint, bool) {
+	points := p.savePoints.Load()
+	if points == nil || p.bgsave.Load() || p.loading.Load() {
+		return SavePoint{}, false
+	}
+	now := time.Now()
+	if !p.lastBgsaveOK.Load() && now.Sub(time.Unix(0, p.lastBgsave.Load())) < bgsaveRetryDelay {
+		return SavePoint{}, false
+	}
+	elapsed := now.Sub(p.LastSave())
+	for _, sp := range *points {
+		if dirty >= sp.Changes && elapsed >= time.Duration(sp.Seconds)*time.Second {
+			return sp, true
+		}
+	}
+	return SavePoint{}, false
+}
+
+// BackgroundSaving reports whether a save started by BackgroundSave is in
+// progress.
+func (p *Snapshotter) BackgroundSaving() bool {
+	return p.bgsave.Load()
+}
+
+// LastBackgroundSaveOK reports whether the last save started by
+// BackgroundSave succeeded. It is true before the first one.
+func (p *Snapshotter) LastBackgroundSaveOK() bool {
+	return p.lastBgsaveOK.Load()
+}
+
+// LastSave returns the time of the last successful save.
+func (p *Snapshotter) LastSave() time.Time {
+	return time.Unix(0, p.lastSave.Load())
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package persistence
+
+import "os"
+
+// syncDir syncs the directory dir, making the files created, renamed or
+// removed in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
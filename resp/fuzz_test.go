@@ -0,0 +1,44 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+// fuzzLimits are those of a connection with the default configuration, so
+// the parser does not allocate more than a client could make it.
+var fuzzLimits = Limits{
+	MaxLineLength:   64 * 1024,
+	MaxMultiBulkLen: 1024 * 1024,
+	MaxBulkLen:      512 * 1024 * 1024,
+	MaxValueBytes:   1024 * 1024 * 1024,
+}
+
+// FuzzReadValue reads values from malformed input, as a connection would,
+// until it fails, and writes back each value read.
+func FuzzReadValue(f *testing.F) {
+	for _, seed := range []string{
+		"*1\r\n$4\r\nPING\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n",
+		"+OK\r\n", "-ERR x\r\n", ":123\r\n", "$-1\r\n", "*-1\r\n", "*0\r\n", "$0\r\n\r\n",
+		"*2\r\n*1\r\n:1\r\n$3\r\nabc\r\n",
+		"*3\r\n$3\r\nSET\r\n$-1\r\n$9223372036854775807\r\n",
+		"PING\r\n", "SET k \"v w\"\r\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		r := NewReader(bufio.NewReader(bytes.NewReader(input)), fuzzLimits)
+		for {
+			v, err := r.ReadValue()
+			if err != nil {
+				return
+			}
+			if err := WriteResp(io.Discard, v); err != nil {
+				t.Fatalf("writing %+v: %v", v, err)
+			}
+		}
+	})
+}
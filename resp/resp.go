@@ -4,24 +4,47 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
+	"strings"
 )
 
 // RESP types
 const (
-	String  = '+'
-	Error   = '-'
-	Integer = ':'
-	Bulk    = '$'
-	Array   = '*'
+	String    = '+'
+	Error     = '-'
+	Integer   = ':'
+	Bulk      = '$'
+	Array     = '*'
+	Push      = '>' // RESP3 out-of-band push message
+	Map       = '%' // RESP3 map, written as a flat array to RESP2 clients
+	Attribute = '|' // RESP3 attributes of the reply that follows, dropped for RESP2 clients
+	Verbatim  = '=' // RESP3 verbatim string, written as a bulk string to RESP2 clients
+	BigNumber = '(' // RESP3 big number, written as a bulk string to RESP2 clients
+	Double    = ',' // RESP3 double, written as a bulk string to RESP2 clients
+	Boolean   = '#' // RESP3 boolean, written as the integer 1 or 0 to RESP2 clients
+	Raw       = 'r' // Not a RESP type: bytes already encoded, written as they are
 )
 
+// MaxBulkLen is the maximum length of a bulk string, matching the default
+// proto-max-bulk-len of Redis.
+const MaxBulkLen = 512 * 1024 * 1024
+
+// ProtocolError is returned by ReadResp for input that is not valid RESP.
+type ProtocolError string
+
+func (e ProtocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
 // RespValue represents a parsed RESP value
 type RespValue struct {
 	Type  byte
 	Str   string
 	Num   int64
 	Array []RespValue
+	Bulks []string // Elements of an array or map of bulk strings, in place of Array, see NewBulkArray
+	Null  bool     // Null bulk string or null array
 }
 
 func (e RespValue) Error() string {
@@ -53,151 +76,513 @@ func NewArray(arr []RespValue) RespValue {
 	return RespValue{Type: Array, Array: arr}
 }
 
-// ReadResp reads a RESP value from the given reader
-func ReadResp(reader *bufio.Reader) (RespValue, error) {
-	typeByte, err := reader.ReadByte()
-	if err != nil {
-		return RespValue{}, err
+// NewBulkArray creates a new RESP array of bulk strings. It holds the
+// strings rather than a value for each, so that a large reply, such as the
+// members of a set of millions, takes no more memory than its elements, and
+// is written element by element through the output buffer.
+func NewBulkArray(strs []string) RespValue {
+	return RespValue{Type: Array, Bulks: strs}
+}
+
+// NewBulkMap creates a new RESP3 map of bulk strings, keys and values
+// alternating, held as NewBulkArray holds them.
+func NewBulkMap(pairs []string) RespValue {
+	return RespValue{Type: Map, Bulks: pairs}
+}
+
+// Elements returns the elements of an array, push or map value, building
+// them for one holding bulk strings.
+func (v RespValue) Elements() []RespValue {
+	if v.Bulks == nil {
+		return v.Array
+	}
+	elems := make([]RespValue, len(v.Bulks))
+	for i, s := range v.Bulks {
+		elems[i] = NewBulk(s)
 	}
+	return elems
+}
 
-	switch typeByte {
-	case String:
-		return readSimpleString(reader)
-	case Error:
-		return readError(reader)
-	case Integer:
-		return readInteger(reader)
-	case Bulk:
-		return readBulkString(reader)
-	case Array:
-		return readArray(reader)
-	default:
-		return RespValue{}, fmt.Errorf("unknown RESP type: %c", typeByte)
+// NewPush creates a new RESP3 push value
+func NewPush(arr []RespValue) RespValue {
+	return RespValue{Type: Push, Array: arr}
+}
+
+// NewMap creates a new RESP3 map value from its keys and values, which
+// alternate in pairs
+func NewMap(pairs []RespValue) RespValue {
+	return RespValue{Type: Map, Array: pairs}
+}
+
+// NewAttribute creates a RESP3 reply carrying attributes, metadata about
+// the reply given as keys and values alternating in pairs. RESP2 clients
+// get the reply alone. The value holds the pairs followed by the reply.
+func NewAttribute(pairs []RespValue, reply RespValue) RespValue {
+	return RespValue{Type: Attribute, Array: append(pairs, reply)}
+}
+
+// NewVerbatim creates a RESP3 verbatim string, text meant to be shown as
+// it is, in the given format of three characters, such as txt for plain
+// text or mkd for markdown. Str holds the payload of the value, the format
+// and a colon followed by the text; RESP2 clients get the text as a bulk
+// string.
+func NewVerbatim(format, text string) RespValue {
+	return RespValue{Type: Verbatim, Str: format + ":" + text}
+}
+
+// Text returns the text of a verbatim string, and Str for other values.
+func (v RespValue) Text() string {
+	if v.Type == Verbatim && len(v.Str) >= 4 {
+		return v.Str[4:]
 	}
+	return v.Str
 }
 
-func readSimpleString(reader *bufio.Reader) (RespValue, error) {
-	s, err := readLine(reader)
-	if err != nil {
-		return RespValue{}, err
+// NewBigNumber creates a RESP3 big number, an integer out of the range of
+// 64 bits given by its decimal digits, with a leading minus sign if it is
+// negative. RESP2 clients get the digits as a bulk string.
+func NewBigNumber(digits string) RespValue {
+	return RespValue{Type: BigNumber, Str: digits}
+}
+
+// NewDouble creates a RESP3 double. Str holds its text, as FormatDouble
+// writes it, which RESP2 clients get as a bulk string.
+func NewDouble(f float64) RespValue {
+	return RespValue{Type: Double, Str: FormatDouble(f)}
+}
+
+// FormatDouble returns the text of f as Redis replies it: the shortest
+// digits that read back as f, written as %.17g writes them, with an
+// exponent only below 1e-4 or from 1e17 on, or inf, -inf and nan.
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	if exp, _ := strconv.Atoi(s[strings.LastIndexByte(s, 'e')+1:]); exp < -4 || exp >= 17 {
+		return s
 	}
-	return NewString(s), nil
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
-func readError(reader *bufio.Reader) (RespValue, error) {
-	s, err := readLine(reader)
-	if err != nil {
-		return RespValue{}, err
+// NewBoolean creates a RESP3 boolean, held in Num as 1 or 0, which RESP2
+// clients get as an integer.
+func NewBoolean(b bool) RespValue {
+	if b {
+		return RespValue{Type: Boolean, Num: 1}
 	}
-	return NewError(s), nil
+	return RespValue{Type: Boolean}
 }
 
-func readInteger(reader *bufio.Reader) (RespValue, error) {
-	s, err := readLine(reader)
+// NewRaw creates a value holding bytes already encoded in RESP, written to
+// the connection as they are. It lets a command reply with a value it
+// encoded itself, or kept from an earlier reply, and send push frames
+// without building a value for each element. The bytes are not checked: a
+// reply must be a single value, encoded in the protocol version of the
+// client.
+func NewRaw(s string) RespValue {
+	return RespValue{Type: Raw, Str: s}
+}
+
+// NewNullBulk creates a new RESP null bulk string value
+func NewNullBulk() RespValue {
+	return RespValue{Type: Bulk, Null: true}
+}
+
+// NewNullArray creates a new RESP null array value
+func NewNullArray() RespValue {
+	return RespValue{Type: Array, Null: true}
+}
+
+// Limits bounds the size of the values a Reader accepts, so that a client
+// cannot make the server allocate unbounded memory. Zero fields mean no
+// limit, except MaxBulkLen, which defaults to the package MaxBulkLen.
+type Limits struct {
+	MaxLineLength   int   // Longest type or length line, CRLF excluded
+	MaxMultiBulkLen int   // Most elements in an array
+	MaxBulkLen      int   // Longest bulk string
+	MaxValueBytes   int64 // Most bytes in a single top-level value
+}
+
+// Reader reads RESP values subject to limits.
+type Reader struct {
+	r      *bufio.Reader
+	limits Limits
+	read   int64 // Bytes read of the value being read
+}
+
+// NewReader returns a Reader reading from r subject to limits.
+func NewReader(r *bufio.Reader, limits Limits) *Reader {
+	if limits.MaxBulkLen == 0 {
+		limits.MaxBulkLen = MaxBulkLen
+	}
+	return &Reader{r: r, limits: limits}
+}
+
+// ReadValue reads the next RESP value. Values that are not valid RESP or
+// exceed the limits yield a ProtocolError.
+func (rd *Reader) ReadValue() (RespValue, error) {
+	rd.read = 0
+	return rd.readValue()
+}
+
+// ReadResp reads a RESP value from the given reader
+func ReadResp(reader *bufio.Reader) (RespValue, error) {
+	return NewReader(reader, Limits{}).ReadValue()
+}
+
+func (rd *Reader) readValue() (RespValue, error) {
+	typeByte, err := rd.r.ReadByte()
 	if err != nil {
 		return RespValue{}, err
 	}
-	i, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
+	if err := rd.consume(1); err != nil {
 		return RespValue{}, err
 	}
-	return NewInteger(i), nil
+
+	switch typeByte {
+	case String:
+		s, err := rd.readLine()
+		if err != nil {
+			return RespValue{}, err
+		}
+		return NewString(s), nil
+	case Error:
+		s, err := rd.readLine()
+		if err != nil {
+			return RespValue{}, err
+		}
+		return NewError(s), nil
+	case Integer:
+		s, err := rd.readLine()
+		if err != nil {
+			return RespValue{}, err
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return RespValue{}, ProtocolError("invalid integer")
+		}
+		return NewInteger(i), nil
+	case Bulk:
+		return rd.readBulkString()
+	case Array, Push, Map:
+		return rd.readArray(typeByte)
+	case Verbatim:
+		v, err := rd.readBulkString()
+		if err != nil {
+			return RespValue{}, err
+		}
+		if v.Null || len(v.Str) < 4 || v.Str[3] != ':' {
+			return RespValue{}, ProtocolError("invalid verbatim string")
+		}
+		v.Type = Verbatim
+		return v, nil
+	case BigNumber:
+		s, err := rd.readLine()
+		if err != nil {
+			return RespValue{}, err
+		}
+		if !validBigNumber(s) {
+			return RespValue{}, ProtocolError("invalid big number")
+		}
+		return NewBigNumber(s), nil
+	case Double:
+		s, err := rd.readLine()
+		if err != nil {
+			return RespValue{}, err
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return RespValue{}, ProtocolError("invalid double")
+		}
+		return RespValue{Type: Double, Str: s}, nil
+	case Boolean:
+		s, err := rd.readLine()
+		if err != nil {
+			return RespValue{}, err
+		}
+		if s != "t" && s != "f" {
+			return RespValue{}, ProtocolError("invalid boolean")
+		}
+		return NewBoolean(s == "t"), nil
+	case Attribute:
+		attrs, err := rd.readArray(Map)
+		if err != nil {
+			return RespValue{}, err
+		}
+		reply, err := rd.readValue()
+		if err != nil {
+			return RespValue{}, err
+		}
+		return NewAttribute(attrs.Array, reply), nil
+	default:
+		return RespValue{}, ProtocolError(fmt.Sprintf("unknown RESP type '%c'", typeByte))
+	}
+}
+
+// consume accounts for n more bytes of the value being read.
+func (rd *Reader) consume(n int) error {
+	rd.read += int64(n)
+	if rd.limits.MaxValueBytes > 0 && rd.read > rd.limits.MaxValueBytes {
+		return ProtocolError("request exceeds client-query-buffer-limit")
+	}
+	return nil
 }
 
-func readBulkString(reader *bufio.Reader) (RespValue, error) {
-	lenStr, err := readLine(reader)
+func (rd *Reader) readBulkString() (RespValue, error) {
+	lenStr, err := rd.readLine()
 	if err != nil {
 		return RespValue{}, err
 	}
 	length, err := strconv.Atoi(lenStr)
-	if err != nil {
-		return RespValue{}, err
+	if err != nil || length < -1 || length > rd.limits.MaxBulkLen {
+		return RespValue{}, ProtocolError("invalid bulk length")
 	}
 
 	if length == -1 {
-		return NewBulk(""), nil // Null bulk string
+		return NewNullBulk(), nil
 	}
 
-	buf := make([]byte, length)
-	_, err = io.ReadFull(reader, buf)
-	if err != nil {
+	// Check the limit before allocating the payload.
+	if err := rd.consume(length + 2); err != nil {
 		return RespValue{}, err
 	}
-
-	// Read the trailing CRLF
-	_, err = reader.ReadByte() // \r
-	if err != nil {
+	// The payload may contain any bytes, CR and LF included, so it is read
+	// by length along with its trailing CRLF.
+	buf := make([]byte, length+2)
+	if _, err := io.ReadFull(rd.r, buf); err != nil {
 		return RespValue{}, err
 	}
-	_, err = reader.ReadByte() // \n
-	if err != nil {
-		return RespValue{}, err
+	if buf[length] != '\r' || buf[length+1] != '\n' {
+		return RespValue{}, ProtocolError("bulk string not terminated by CRLF")
 	}
+	return NewBulk(string(buf[:length])), nil
+}
 
-	return NewBulk(string(buf)), nil
+// validBigNumber reports whether s is the decimal digits of an integer,
+// with an optional minus sign.
+func validBigNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
 }
 
-func readArray(reader *bufio.Reader) (RespValue, error) {
-	lenStr, err := readLine(reader)
+// readArray reads an array, or the push message or map of the same layout
+// that typ denotes.
+func (rd *Reader) readArray(typ byte) (RespValue, error) {
+	lenStr, err := rd.readLine()
 	if err != nil {
 		return RespValue{}, err
 	}
 	length, err := strconv.Atoi(lenStr)
-	if err != nil {
-		return RespValue{}, err
+	if err == nil && typ == Map && length > 0 {
+		length *= 2 // Keys and values
+	}
+	if err != nil || length < -1 || (rd.limits.MaxMultiBulkLen > 0 && length > rd.limits.MaxMultiBulkLen) {
+		return RespValue{}, ProtocolError("invalid multibulk length")
 	}
 
-	if length == -1 {
-		return NewArray(nil), nil // Null array
+	if length == -1 && typ == Array {
+		return NewNullArray(), nil
+	} else if length == -1 {
+		return RespValue{}, ProtocolError("invalid multibulk length")
 	}
 
-	arr := make([]RespValue, length)
+	// Grow the array as elements arrive rather than trusting the length.
+	arr := make([]RespValue, 0, min(length, 1024))
 	for i := 0; i < length; i++ {
-		val, err := ReadResp(reader)
+		val, err := rd.readValue()
 		if err != nil {
 			return RespValue{}, err
 		}
-		arr[i] = val
+		arr = append(arr, val)
 	}
-	return NewArray(arr), nil
+	return RespValue{Type: typ, Array: arr}, nil
 }
 
-func readLine(reader *bufio.Reader) (string, error) {
-	line, err := reader.ReadString('\n')
-	if err != nil {
+// readLine reads a line terminated by CRLF, without buffering more than
+// the line length limit.
+func (rd *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := rd.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if rd.limits.MaxLineLength > 0 && len(line) > rd.limits.MaxLineLength+2 {
+			return "", ProtocolError("too big inline request")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+	if err := rd.consume(len(line)); err != nil {
 		return "", err
 	}
-	return line[:len(line)-2], nil // Remove CRLF
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", ProtocolError("line not terminated by CRLF")
+	}
+	return string(line[:len(line)-2]), nil // Remove CRLF
+}
+
+// lineBreaks replaces the CR and LF characters that cannot appear in
+// simple strings and errors.
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+// Size returns about the bytes val takes once written: its strings plus a
+// few bytes of type, length and line breaks for each value.
+func Size(val RespValue) int64 {
+	n := int64(len(val.Str)) + 16
+	for _, item := range val.Array {
+		n += Size(item)
+	}
+	for _, s := range val.Bulks {
+		n += int64(len(s)) + 16
+	}
+	return n
 }
 
 // WriteResp writes a RESP value to the given writer
 func WriteResp(writer io.Writer, val RespValue) error {
 	switch val.Type {
 	case String:
-		_, err := fmt.Fprintf(writer, "+%s\r\n", val.Str)
+		_, err := fmt.Fprintf(writer, "+%s\r\n", lineBreaks.Replace(val.Str))
 		return err
 	case Error:
-		_, err := fmt.Fprintf(writer, "-%s\r\n", val.Str)
+		_, err := fmt.Fprintf(writer, "-%s\r\n", lineBreaks.Replace(val.Str))
 		return err
 	case Integer:
 		_, err := fmt.Fprintf(writer, ":%d\r\n", val.Num)
 		return err
 	case Bulk:
-		_, err := fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(val.Str), val.Str)
-		return err
-	case Array:
-		_, err := fmt.Fprintf(writer, "*%d\r\n", len(val.Array))
+		if val.Null {
+			_, err := io.WriteString(writer, "$-1\r\n")
+			return err
+		}
+		return writeBulk(writer, val.Str)
+	case Array, Push:
+		if val.Null {
+			_, err := io.WriteString(writer, "*-1\r\n")
+			return err
+		}
+		_, err := fmt.Fprintf(writer, "%c%d\r\n", val.Type, len(val.Array)+len(val.Bulks))
 		if err != nil {
 			return err
 		}
-		for _, item := range val.Array {
-			err := WriteResp(writer, item)
-			if err != nil {
+		return writeElements(writer, val)
+	case Map:
+		var err error
+		n := len(val.Array) + len(val.Bulks)
+		if resp3(writer) {
+			_, err = fmt.Fprintf(writer, "%%%d\r\n", n/2)
+		} else {
+			_, err = fmt.Fprintf(writer, "*%d\r\n", n)
+		}
+		if err != nil {
+			return err
+		}
+		return writeElements(writer, val)
+	case Attribute:
+		n := len(val.Array) - 1
+		if resp3(writer) {
+			if _, err := fmt.Fprintf(writer, "|%d\r\n", n/2); err != nil {
 				return err
 			}
+			for _, item := range val.Array[:n] {
+				if err := WriteResp(writer, item); err != nil {
+					return err
+				}
+			}
+		}
+		return WriteResp(writer, val.Array[n])
+	case Verbatim:
+		if !resp3(writer) {
+			return writeBulk(writer, val.Text())
+		}
+		_, err := fmt.Fprintf(writer, "=%d\r\n%s\r\n", len(val.Str), val.Str)
+		return err
+	case BigNumber:
+		if !resp3(writer) {
+			return writeBulk(writer, val.Str)
+		}
+		_, err := fmt.Fprintf(writer, "(%s\r\n", val.Str)
+		return err
+	case Double:
+		if !resp3(writer) {
+			return writeBulk(writer, val.Str)
+		}
+		_, err := fmt.Fprintf(writer, ",%s\r\n", val.Str)
+		return err
+	case Boolean:
+		var err error
+		switch {
+		case !resp3(writer):
+			_, err = fmt.Fprintf(writer, ":%d\r\n", val.Num)
+		case val.Num != 0:
+			_, err = io.WriteString(writer, "#t\r\n")
+		default:
+			_, err = io.WriteString(writer, "#f\r\n")
 		}
-		return nil
+		return err
+	case Raw:
+		if w, ok := writer.(*Writer); ok {
+			return w.writeBulkPayload(val.Str)
+		}
+		_, err := io.WriteString(writer, val.Str)
+		return err
 	default:
 		return fmt.Errorf("unknown RESP type to write: %c", val.Type)
 	}
 }
+
+// resp3 reports whether writer writes to a client speaking RESP3. Other
+// writers get RESP2.
+func resp3(writer io.Writer) bool {
+	w, ok := writer.(*Writer)
+	return ok && w.protocol >= 3
+}
+
+// writeBulk writes s as a bulk string.
+func writeBulk(writer io.Writer, s string) error {
+	if w, ok := writer.(*Writer); ok {
+		return w.writeBulk(s)
+	}
+	if _, err := fmt.Fprintf(writer, "$%d\r\n", len(s)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(writer, "\r\n")
+	return err
+}
+
+// writeElements writes the elements of an array, push or map value. Bulk
+// strings held as such are written one by one, without building a value
+// for each, the output buffer being flushed to the connection as it fills.
+func writeElements(writer io.Writer, val RespValue) error {
+	for _, item := range val.Array {
+		if err := WriteResp(writer, item); err != nil {
+			return err
+		}
+	}
+	for _, s := range val.Bulks {
+		if err := writeBulk(writer, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
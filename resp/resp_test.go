@@ -0,0 +1,74 @@
+package resp
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestBulkArray checks that arrays and maps holding their bulk strings as
+// such are written, in RESP2 and RESP3, and read through Elements, as the
+// same values holding a value for each.
+func TestBulkArray(t *testing.T) {
+	strs := []string{"a", "", "line\r\nbreak", "nul\x00byte"}
+	elems := make([]RespValue, len(strs))
+	for i, s := range strs {
+		elems[i] = NewBulk(s)
+	}
+	for _, tc := range []struct {
+		name      string
+		bulks, vs RespValue
+	}{
+		{"array", NewBulkArray(strs), NewArray(elems)},
+		{"map", NewBulkMap(strs), NewMap(elems)},
+		{"empty array", NewBulkArray([]string{}), NewArray([]RespValue{})},
+	} {
+		if got := tc.bulks.Elements(); !reflect.DeepEqual(got, tc.vs.Elements()) {
+			t.Errorf("%s: Elements is %+v, want %+v", tc.name, got, tc.vs.Elements())
+		}
+		for _, protocol := range []int{2, 3} {
+			var got, want bytes.Buffer
+			w := NewWriter(&got, 0)
+			w.SetProtocol(protocol)
+			if err := w.WriteValue(tc.bulks); err != nil {
+				t.Fatal(err)
+			}
+			w = NewWriter(&want, 0)
+			w.SetProtocol(protocol)
+			if err := w.WriteValue(tc.vs); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("%s, RESP%d: wrote %q, want %q", tc.name, protocol, got.String(), want.String())
+			}
+		}
+	}
+}
+
+// TestFormatDouble checks doubles are written as Redis writes them.
+func TestFormatDouble(t *testing.T) {
+	for _, tc := range []struct {
+		f    float64
+		want string
+	}{
+		{0, "0"},
+		{1.5, "1.5"},
+		{-2, "-2"},
+		{0.1, "0.1"},
+		{1000000, "1000000"},
+		{1e16, "10000000000000000"},
+		{1e17, "1e+17"},
+		{1e300, "1e+300"},
+		{0.0001, "0.0001"},
+		{0.00001, "1e-05"},
+		{-1.5e-7, "-1.5e-07"},
+		{math.Inf(1), "inf"},
+		{math.Inf(-1), "-inf"},
+		{math.NaN(), "nan"},
+	} {
+		if got := FormatDouble(tc.f); got != tc.want {
+			t.Errorf("FormatDouble(%v) = %q, want %q", tc.f, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"unsafe"
+)
+
+// streamChunkSize is the size of the writes a streamed bulk payload is
+// split into.
+const streamChunkSize = 1024 * 1024
+
+// Writer writes RESP values to a connection through an output buffer.
+// Bulk payloads of at least the stream threshold bypass the buffer: it is
+// flushed, and the payload is copied to the connection in chunks straight
+// from the stored value, so a multi-megabyte reply is never copied into a
+// second buffer.
+type Writer struct {
+	buf       *bufio.Writer
+	dst       io.Writer
+	threshold int
+	protocol  int // RESP version of the client, 2 unless set to 3
+}
+
+// NewWriter returns a Writer writing to w. Bulk payloads of threshold bytes
+// or more are streamed; a threshold of 0 disables streaming.
+func NewWriter(w io.Writer, threshold int) *Writer {
+	return &Writer{buf: bufio.NewWriter(w), dst: w, threshold: threshold}
+}
+
+// SetProtocol sets the RESP version the values are written in: before
+// version 3, maps are written as flat arrays, verbatim strings, big
+// numbers and doubles as bulk strings, booleans as integers, and attributes
+// are dropped.
+func (w *Writer) SetProtocol(protocol int) {
+	w.protocol = protocol
+}
+
+// Write writes p to the output buffer.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// WriteValue writes val and flushes the output buffer.
+func (w *Writer) WriteValue(val RespValue) error {
+	if err := w.BufferValue(val); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// BufferValue writes val to the output buffer, which a later WriteValue
+// flushes, so several values can be sent in one write. Parts of val are
+// sent before if the buffer fills or a payload is streamed.
+func (w *Writer) BufferValue(val RespValue) error {
+	return WriteResp(w, val)
+}
+
+// Buffered returns the number of bytes buffered and not yet written.
+func (w *Writer) Buffered() int {
+	return w.buf.Buffered()
+}
+
+// Flush writes the values buffered so far to the connection.
+func (w *Writer) Flush() error {
+	return w.buf.Flush()
+}
+
+// writeBulk writes s as a bulk string, its length formatted in the free
+// space of the output buffer so that writing the many elements of an array
+// allocates nothing.
+func (w *Writer) writeBulk(s string) error {
+	header := w.buf.AvailableBuffer()
+	header = append(strconv.AppendInt(append(header, '$'), int64(len(s)), 10), '\r', '\n')
+	if _, err := w.buf.Write(header); err != nil {
+		return err
+	}
+	if err := w.writeBulkPayload(s); err != nil {
+		return err
+	}
+	_, err := w.buf.WriteString("\r\n")
+	return err
+}
+
+// writeBulkPayload writes the payload of a bulk string, streaming it when
+// it reaches the threshold.
+func (w *Writer) writeBulkPayload(s string) error {
+	if w.threshold <= 0 || len(s) < w.threshold {
+		_, err := w.buf.WriteString(s)
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	// The connection only reads the bytes, so they can be passed without
+	// copying the string.
+	p := unsafe.Slice(unsafe.StringData(s), len(s))
+	for len(p) > 0 {
+		n := min(len(p), streamChunkSize)
+		if _, err := w.dst.Write(p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// ErrNoFunction is returned when calling a function no library registered.
+var ErrNoFunction error = errs.NoFunction
+
+// ErrFunctionKilled is returned when the context of a function is canceled
+// while it runs.
+var ErrFunctionKilled error = errs.FunctionKilled
+
+// functionFlags are the flags redis.register_function accepts.
+var functionFlags = []string{"no-writes", "allow-oom", "allow-stale", "no-cluster", "allow-cross-slot-keys"}
+
+// Library is a function library loaded with FUNCTION LOAD.
+type Library struct {
+	Name      string
+	Code      string
+	Functions []Function // Sorted by name
+}
+
+// Function is a function registered by a library.
+type Function struct {
+	Name        string
+	Description string
+	Flags       []string
+}
+
+// ReadOnly reports whether the function was registered with the no-writes
+// flag, and so may be called by FCALL_RO.
+func (f Function) ReadOnly() bool {
+	return slices.Contains(f.Flags, "no-writes")
+}
+
+type library struct {
+	name      string
+	code      string
+	functions map[string]*function
+}
+
+type function struct {
+	Function
+	fn *lua.LFunction
+}
+
+// LoadPolicy is what loading libraries does with the libraries already
+// loaded.
+type LoadPolicy int
+
+const (
+	AppendLibraries  LoadPolicy = iota // Fail if a library already exists
+	ReplaceLibraries                   // Replace the libraries with the same names
+	FlushLibraries                     // Delete all libraries first
+)
+
+// LoadLibraries compiles the libraries whose code is given and adds them
+// as policy says, and returns their names. Either all of them are loaded
+// or, on error, none.
+func (e *Engine) LoadLibraries(code []string, policy LoadPolicy) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	libs := make([]*library, len(code))
+	for i, c := range code {
+		lib, err := e.compile(c)
+		if err != nil {
+			return nil, err
+		}
+		libs[i] = lib
+	}
+
+	kept := e.libraries
+	if policy == FlushLibraries {
+		kept = nil
+	}
+	libraries := make(map[string]*library, len(kept)+len(libs))
+	for name, lib := range kept {
+		libraries[name] = lib
+	}
+	names := make([]string, len(libs))
+	for i, lib := range libs {
+		if _, ok := libraries[lib.name]; ok && (policy != ReplaceLibraries || slices.Contains(names[:i], lib.name)) {
+			return nil, errs.Errorf("Library '%s' already exists", lib.name)
+		}
+		libraries[lib.name] = lib
+		names[i] = lib.name
+	}
+	functions, err := functionsOf(libraries)
+	if err != nil {
+		return nil, err
+	}
+	e.libraries, e.functions = libraries, functions
+	return names, nil
+}
+
+// DeleteLibrary deletes the library with the given name.
+func (e *Engine) DeleteLibrary(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lib, ok := e.libraries[name]
+	if !ok {
+		return errs.Errorf("Library not found")
+	}
+	delete(e.libraries, name)
+	for fname := range lib.functions {
+		delete(e.functions, fname)
+	}
+	return nil
+}
+
+// Libraries returns the loaded libraries, sorted by name.
+func (e *Engine) Libraries() []Library {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	libs := make([]Library, 0, len(e.libraries))
+	for _, lib := range e.libraries {
+		l := Library{Name: lib.name, Code: lib.code}
+		for _, f := range lib.functions {
+			l.Functions = append(l.Functions, f.Function)
+		}
+		slices.SortFunc(l.Functions, func(a, b Function) int { return strings.Compare(a.Name, b.Name) })
+		libs = append(libs, l)
+	}
+	slices.SortFunc(libs, func(a, b Library) int { return strings.Compare(a.Name, b.Name) })
+	return libs
+}
+
+// LibraryCode returns the code of the loaded libraries, sorted by library
+// name.
+func (e *Engine) LibraryCode() []string {
+	libs := e.Libraries()
+	code := make([]string, len(libs))
+	for i, lib := range libs {
+		code[i] = lib.Code
+	}
+	return code
+}
+
+// SyncLibraries makes the loaded libraries those whose code is given, in
+// any order, compiling only the libraries not already loaded. A library
+// that fails to load is left out and its error returned, along with those
+// of the others.
+func (e *Engine) SyncLibraries(code []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	loaded := make(map[string]*library, len(e.libraries))
+	for _, lib := range e.libraries {
+		loaded[lib.code] = lib
+	}
+	if len(code) == len(loaded) && !slices.ContainsFunc(code, func(c string) bool { return loaded[c] == nil }) {
+		return nil
+	}
+
+	var errList []error
+	libraries := make(map[string]*library, len(code))
+	for _, c := range code {
+		lib := loaded[c]
+		if lib == nil {
+			var err error
+			if lib, err = e.compile(c); err != nil {
+				errList = append(errList, err)
+				continue
+			}
+		}
+		libraries[lib.name] = lib
+	}
+	functions, err := functionsOf(libraries)
+	if err != nil {
+		return errors.Join(append(errList, err)...)
+	}
+	e.libraries, e.functions = libraries, functions
+	return errors.Join(errList...)
+}
+
+// functionsOf returns the functions of libraries by name, failing if two
+// libraries register the same one.
+func functionsOf(libraries map[string]*library) (map[string]*function, error) {
+	functions := make(map[string]*function)
+	for _, lib := range libraries {
+		for name, f := range lib.functions {
+			if _, ok := functions[name]; ok {
+				return nil, errs.Errorf("Function %s already exists", name)
+			}
+			functions[name] = f
+		}
+	}
+	return functions, nil
+}
+
+// Function returns the function registered under name.
+func (e *Engine) Function(name string) (Function, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, ok := e.functions[name]
+	if !ok {
+		return Function{}, false
+	}
+	return f.Function, true
+}
+
+// Call calls the function registered under name with keys and argv as its
+// two arguments. Its redis.call and redis.pcall invocations are executed
+// by call. Canceling ctx stops the function.
+func (e *Engine) Call(ctx context.Context, name string, keys, argv []string, call CallFunc) (resp.RespValue, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, ok := e.functions[name]
+	if !ok {
+		return resp.RespValue{}, ErrNoFunction
+	}
+
+	L := e.fL
+	e.call = call
+	defer func() { e.call = nil }()
+
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	L.Push(f.fn)
+	L.Push(stringTable(L, keys))
+	L.Push(stringTable(L, argv))
+	if err := L.PCall(2, 1, nil); err != nil {
+		if ctx.Err() != nil {
+			return resp.RespValue{}, ErrFunctionKilled
+		}
+		return scriptError(err, name), nil
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return toResp(ret), nil
+}
+
+// compile runs the code of a library, which registers its functions, and
+// returns the library. Each library has its own global variables, falling
+// back to the shared ones.
+func (e *Engine) compile(code string) (*library, error) {
+	name, body, err := parseShebang(code)
+	if err != nil {
+		return nil, err
+	}
+	L := e.fL
+	fn, err := L.Load(strings.NewReader(body), "@user_function")
+	if err != nil {
+		return nil, errs.Errorf("Error compiling function: %s", strings.TrimSpace(err.Error()))
+	}
+	env := L.NewTable()
+	meta := L.NewTable()
+	meta.RawSetString("__index", L.Get(lua.GlobalsIndex))
+	L.SetMetatable(env, meta)
+	fn.Env = env
+
+	lib := &library{name: name, code: code, functions: make(map[string]*function)}
+	e.registering = lib
+	defer func() { e.registering = nil }()
+	L.Push(fn)
+	if err := L.PCall(0, 0, nil); err != nil {
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			err = errors.New(apiErr.Object.String())
+		}
+		return nil, errs.Errorf("Error registering functions: %s", err)
+	}
+	if len(lib.functions) == 0 {
+		return nil, errs.Errorf("No functions registered")
+	}
+	return lib, nil
+}
+
+// parseShebang parses the first line of the code of a library, such as
+// "#!lua name=mylib", and returns the library name and the code to run, in
+// which the line is left blank so line numbers still match.
+func parseShebang(code string) (name, body string, err error) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", errs.Errorf("Missing library metadata")
+	}
+	line, rest, _ := strings.Cut(code, "\n")
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "lua") {
+		engine := ""
+		if len(fields) > 0 {
+			engine = fields[0]
+		}
+		return "", "", errs.Errorf("Engine '%s' not found", engine)
+	}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key != "name" {
+			return "", "", errs.Errorf("Invalid metadata value given: %s", field)
+		}
+		name = value
+	}
+	if name == "" {
+		return "", "", errs.Errorf("Library name was not given")
+	}
+	if !validName(name) {
+		return "", "", errs.Errorf("Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return name, "\n" + rest, nil
+}
+
+// validName reports whether name is a valid library or function name.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// registerFunction implements redis.register_function, which takes either
+// a name and a callback or a table with the function_name, callback,
+// description and flags fields.
+func (e *Engine) registerFunction(L *lua.LState) int {
+	lib := e.registering
+	if lib == nil {
+		L.RaiseError("redis.register_function can only be called on FUNCTION LOAD command")
+		return 0
+	}
+	f := &function{}
+	switch L.GetTop() {
+	case 1:
+		var bad string
+		L.CheckTable(1).ForEach(func(k, v lua.LValue) {
+			switch k.String() {
+			case "function_name":
+				f.Name = lua.LVAsString(v)
+			case "callback":
+				f.fn, _ = v.(*lua.LFunction)
+			case "description":
+				f.Description = lua.LVAsString(v)
+			case "flags":
+				t, ok := v.(*lua.LTable)
+				if !ok {
+					bad = "flags argument to redis.register_function must be a table representing function flags"
+					return
+				}
+				t.ForEach(func(_, flag lua.LValue) {
+					if !slices.Contains(functionFlags, lua.LVAsString(flag)) {
+						bad = "unknown flag given"
+						return
+					}
+					f.Flags = append(f.Flags, lua.LVAsString(flag))
+				})
+			default:
+				bad = "unknown argument given to redis.register_function"
+			}
+		})
+		if bad != "" {
+			L.RaiseError("%s", bad)
+			return 0
+		}
+		if f.fn == nil {
+			L.RaiseError("redis.register_function must get a callback argument")
+			return 0
+		}
+	case 2:
+		f.Name = L.CheckString(1)
+		f.fn = L.CheckFunction(2)
+	default:
+		L.RaiseError("wrong number of arguments to redis.register_function")
+		return 0
+	}
+	if !validName(f.Name) {
+		L.RaiseError("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+		return 0
+	}
+	if _, ok := lib.functions[f.Name]; ok {
+		L.RaiseError("Function already exists in the library")
+		return 0
+	}
+	if f.Flags == nil {
+		f.Flags = []string{}
+	}
+	lib.functions[f.Name] = f
+	return 0
+}
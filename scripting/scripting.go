@@ -0,0 +1,313 @@
+// Package scripting runs the Lua scripts of EVAL and EVALSHA, and the
+// function libraries of FUNCTION and FCALL.
+package scripting
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/resp"
+)
+
+// ErrNoScript is returned when running a script that is not cached.
+var ErrNoScript error = errs.NoScript
+
+// ErrScriptKilled is returned when the context of a script is canceled
+// while it runs.
+var ErrScriptKilled error = errs.ScriptKilled
+
+// CallFunc executes a command called by a script with redis.call or
+// redis.pcall, and returns its reply.
+type CallFunc func(args []string) resp.RespValue
+
+// Engine compiles, caches and runs Lua scripts and function libraries.
+// Scripts are run one at a time in a single sandboxed interpreter;
+// function libraries live in an interpreter of their own, which flushing
+// the scripts leaves alone.
+type Engine struct {
+	mu          sync.Mutex
+	L           *lua.LState
+	scripts     map[string]*lua.LFunction // Compiled scripts by SHA1 digest
+	call        CallFunc                  // Command executor of the running script
+	fL          *lua.LState               // Interpreter of the function libraries
+	libraries   map[string]*library       // Function libraries by name
+	functions   map[string]*function      // Functions of all libraries by name
+	registering *library                  // Library being loaded, if any
+}
+
+// NewEngine creates a new Engine.
+func NewEngine() *Engine {
+	e := &Engine{
+		scripts:   make(map[string]*lua.LFunction),
+		libraries: make(map[string]*library),
+		functions: make(map[string]*function),
+	}
+	e.L = e.newState()
+	e.fL = e.newState()
+	return e
+}
+
+// newState creates an interpreter with the libraries scripts may use and
+// the redis module.
+func (e *Engine) newState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// Scripts must not touch the file system.
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call":  func(L *lua.LState) int { return e.redisCall(L, true) },
+		"pcall": func(L *lua.LState) int { return e.redisCall(L, false) },
+		"error_reply": func(L *lua.LState) int {
+			L.Push(replyTable(L, "err", L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(replyTable(L, "ok", L.CheckString(1)))
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(SHA1(L.CheckString(1))))
+			return 1
+		},
+		"log":                func(L *lua.LState) int { return 0 },
+		"replicate_commands": func(L *lua.LState) int { L.Push(lua.LTrue); return 1 },
+		"register_function":  e.registerFunction,
+	})
+	for i, level := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		redis.RawSetString(level, lua.LNumber(i))
+	}
+	L.SetGlobal("redis", redis)
+	return L
+}
+
+// SHA1 returns the hex SHA1 digest identifying a script body.
+func SHA1(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load compiles a script and caches it, and returns its SHA1 digest.
+func (e *Engine) Load(body string) (string, error) {
+	sha := SHA1(body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.scripts[sha]; ok {
+		return sha, nil
+	}
+	fn, err := e.L.Load(strings.NewReader(body), "user_script")
+	if err != nil {
+		return "", errs.Errorf("Error compiling script (new function): %s", strings.TrimSpace(err.Error()))
+	}
+	e.scripts[sha] = fn
+	return sha, nil
+}
+
+// Exists reports whether the script with the given SHA1 digest is cached.
+func (e *Engine) Exists(sha string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.scripts[strings.ToLower(sha)]
+	return ok
+}
+
+// Flush empties the script cache.
+func (e *Engine) Flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scripts = make(map[string]*lua.LFunction)
+	e.L.Close()
+	e.L = e.newState()
+}
+
+// Run runs the cached script with the given SHA1 digest. The script sees
+// keys and argv as its KEYS and ARGV tables, and its redis.call and
+// redis.pcall invocations are executed by call. Canceling ctx stops the
+// script.
+func (e *Engine) Run(ctx context.Context, sha string, keys, argv []string, call CallFunc) (resp.RespValue, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn, ok := e.scripts[strings.ToLower(sha)]
+	if !ok {
+		return resp.RespValue{}, ErrNoScript
+	}
+
+	L := e.L
+	L.SetGlobal("KEYS", stringTable(L, keys))
+	L.SetGlobal("ARGV", stringTable(L, argv))
+	e.call = call
+	defer func() { e.call = nil }()
+
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	L.Push(fn)
+	if err := L.PCall(0, 1, nil); err != nil {
+		if ctx.Err() != nil {
+			return resp.RespValue{}, ErrScriptKilled
+		}
+		return scriptError(err, sha), nil
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return toResp(ret), nil
+}
+
+// redisCall implements redis.call, which raises errors, and redis.pcall,
+// which returns them as error tables.
+func (e *Engine) redisCall(L *lua.LState, raise bool) int {
+	if e.call == nil {
+		L.RaiseError("redis.call and redis.pcall can not be used while loading a library")
+		return 0
+	}
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for this redis lib call")
+		return 0
+	}
+	args := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args[i-1] = string(v)
+		case lua.LNumber:
+			args[i-1] = v.String()
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+			return 0
+		}
+	}
+	reply := e.call(args)
+	if reply.Type == resp.Error && raise {
+		L.Error(replyTable(L, "err", reply.Str), 1)
+		return 0
+	}
+	L.Push(toLua(L, reply))
+	return 1
+}
+
+// scriptError converts the error raised by a script, or a function, into
+// an error reply naming it.
+func scriptError(err error, name string) resp.RespValue {
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) {
+		if t, ok := apiErr.Object.(*lua.LTable); ok {
+			if msg, ok := t.RawGetString("err").(lua.LString); ok {
+				return resp.NewError(string(msg))
+			}
+		}
+		return resp.NewError("ERR " + apiErr.Object.String() + " script: " + name)
+	}
+	return resp.NewError("ERR " + err.Error() + " script: " + name)
+}
+
+func replyTable(L *lua.LState, field, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString(field, lua.LString(msg))
+	return t
+}
+
+func stringTable(L *lua.LState, strs []string) *lua.LTable {
+	t := L.CreateTable(len(strs), 0)
+	for _, s := range strs {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
+
+// toLua converts a command reply to a Lua value the way Redis does.
+func toLua(L *lua.LState, v resp.RespValue) lua.LValue {
+	switch v.Type {
+	case resp.Integer:
+		return lua.LNumber(v.Num)
+	case resp.Bulk:
+		if v.Null {
+			return lua.LFalse
+		}
+		return lua.LString(v.Str)
+	case resp.Verbatim, resp.BigNumber, resp.Double:
+		return lua.LString(v.Text())
+	case resp.Boolean:
+		return lua.LNumber(v.Num)
+	case resp.Attribute:
+		return toLua(L, v.Array[len(v.Array)-1])
+	case resp.String:
+		return replyTable(L, "ok", v.Str)
+	case resp.Error:
+		return replyTable(L, "err", v.Str)
+	case resp.Array, resp.Push, resp.Map:
+		if v.Null {
+			return lua.LFalse
+		}
+		elems := v.Elements()
+		t := L.CreateTable(len(elems), 0)
+		for _, elem := range elems {
+			t.Append(toLua(L, elem))
+		}
+		return t
+	case resp.Raw:
+		decoded, err := resp.ReadResp(bufio.NewReader(strings.NewReader(v.Str)))
+		if err != nil {
+			return replyTable(L, "err", "ERR invalid reply encoded by the command")
+		}
+		return toLua(L, decoded)
+	}
+	return lua.LNil
+}
+
+// toResp converts a value returned by a script to a reply the way Redis
+// does: numbers are truncated to integers, false and nil become null, and
+// arrays stop at their first nil.
+func toResp(lv lua.LValue) resp.RespValue {
+	switch v := lv.(type) {
+	case lua.LNumber:
+		return resp.NewInteger(int64(v))
+	case lua.LString:
+		return resp.NewBulk(string(v))
+	case lua.LBool:
+		if v {
+			return resp.NewInteger(1)
+		}
+		return resp.NewNullBulk()
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return resp.NewError(string(msg))
+		}
+		if msg, ok := v.RawGetString("ok").(lua.LString); ok {
+			return resp.NewString(string(msg))
+		}
+		arr := []resp.RespValue{}
+		for i := 1; ; i++ {
+			elem := v.RawGetInt(i)
+			if elem == lua.LNil {
+				break
+			}
+			arr = append(arr, toResp(elem))
+		}
+		return resp.NewArray(arr)
+	}
+	return resp.NewNullBulk()
+}
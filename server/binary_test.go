@@ -0,0 +1,109 @@
+package server_test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/server"
+)
+
+// binarySizes are the sizes of the values TestBinaryValues stores: around
+// the read buffer of a connection (16kb), the default reply stream
+// threshold (64kb), and the chunks a streamed reply is written in (1mb).
+var binarySizes = []int{
+	0, 1, 2, 100,
+	16*1024 - 1, 16 * 1024, 16*1024 + 1,
+	64*1024 - 1, 64 * 1024, 64*1024 + 1,
+	1024*1024 + 7, 3 * 1024 * 1024,
+}
+
+// randomBytes returns n random bytes, with a CRLF and a NUL byte among
+// them if there is room.
+func randomBytes(rnd *rand.Rand, n int) string {
+	b := make([]byte, n)
+	rnd.Read(b)
+	if n >= 3 {
+		i := rnd.Intn(n - 2)
+		copy(b[i:], "\r\n\x00")
+	}
+	return string(b)
+}
+
+// TestBinaryValues stores random bytes, CRLF and NUL bytes included, under
+// keys of random bytes, and checks that the string commands read and
+// change them byte for byte, whatever their size.
+func TestBinaryValues(t *testing.T) {
+	srv := server.NewInMemory()
+	defer srv.Close()
+	nc, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConn(nc)
+	defer nc.Close()
+	do := func(argv ...string) resp.RespValue {
+		t.Helper()
+		if err := c.send(argv); err != nil {
+			t.Fatal(err)
+		}
+		nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		v, err := resp.ReadResp(c.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range binarySizes {
+		key := randomBytes(rnd, 3+rnd.Intn(30))
+		val := randomBytes(rnd, size)
+		name := "size " + strconv.Itoa(size)
+
+		if v := do("SET", key, val); v.Str != "OK" {
+			t.Fatalf("%s: SET replied %+v", name, v)
+		}
+		if v := do("GET", key); v.Str != val {
+			t.Fatalf("%s: GET returned %d bytes differing from the %d set", name, len(v.Str), len(val))
+		}
+		if v := do("STRLEN", key); v.Num != int64(size) {
+			t.Fatalf("%s: STRLEN is %d", name, v.Num)
+		}
+
+		tail := randomBytes(rnd, 100)
+		val += tail
+		if v := do("APPEND", key, tail); v.Num != int64(len(val)) {
+			t.Fatalf("%s: APPEND returned %d, want %d", name, v.Num, len(val))
+		}
+
+		patch := randomBytes(rnd, 50)
+		offset := rnd.Intn(len(val))
+		b := []byte(val)
+		if end := offset + len(patch); end > len(b) {
+			b = append(b, make([]byte, end-len(b))...)
+		}
+		copy(b[offset:], patch)
+		val = string(b)
+		if v := do("SETRANGE", key, strconv.Itoa(offset), patch); v.Num != int64(len(val)) {
+			t.Fatalf("%s: SETRANGE returned %d, want %d", name, v.Num, len(val))
+		}
+		if v := do("GET", key); v.Str != val {
+			t.Fatalf("%s: GET after APPEND and SETRANGE returned %d bytes differing from the %d expected", name, len(v.Str), len(val))
+		}
+
+		start := rnd.Intn(len(val))
+		end := start + rnd.Intn(len(val)-start)
+		if v := do("GETRANGE", key, strconv.Itoa(start), strconv.Itoa(end)); v.Str != val[start:end+1] {
+			t.Fatalf("%s: GETRANGE %d %d returned %q", name, start, end, v.Str)
+		}
+		if v := do("GETRANGE", key, "-1", "-1"); v.Str != val[len(val)-1:] {
+			t.Fatalf("%s: GETRANGE -1 -1 returned %q", name, v.Str)
+		}
+		if v := do("EXISTS", key, key+"\x00"); v.Num != 1 {
+			t.Fatalf("%s: EXISTS of the key and the key with a NUL byte after it is %d, want 1", name, v.Num)
+		}
+	}
+}
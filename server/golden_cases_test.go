@@ -0,0 +1,95 @@
+package server_test
+
+// goldenCase runs cmds in order, on an empty dataset, and records the
+// replies to each. Cases leave out the replies that change from run to
+// run, such as client ids, times and the order of hash tables, which must
+// be the same bytes every time, and the commands that silence replies or
+// close the connection, CLIENT REPLY and QUIT, since each command is
+// followed by a PING whose reply must come.
+type goldenCase struct {
+	command string
+	name    string
+	cmds    [][]string
+}
+
+var goldenCases = []goldenCase{
+	// Connection
+	{command: "PING", name: "without a message", cmds: [][]string{{"PING"}}},
+	{command: "PING", name: "with a message", cmds: [][]string{{"PING", "hello"}}},
+	{command: "SELECT", name: "databases", cmds: [][]string{{"SELECT", "0"}, {"SELECT", "1"}, {"SELECT", "x"}}},
+	{command: "HELLO", name: "errors", cmds: [][]string{{"HELLO", "4"}, {"HELLO", "x"}, {"HELLO", "2", "NOSUCH"}}},
+	{command: "RESET", name: "back to RESP2", cmds: [][]string{{"CLIENT", "SETNAME", "c"}, {"RESET"}, {"CLIENT", "GETNAME"}, {"SISMEMBER", "s", "a"}}},
+	{command: "CLIENT", name: "names", cmds: [][]string{{"CLIENT", "GETNAME"}, {"CLIENT", "SETNAME", "conn"}, {"CLIENT", "GETNAME"}, {"CLIENT", "SETNAME", "a b"}}},
+	{command: "CLIENT", name: "SETINFO", cmds: [][]string{{"CLIENT", "SETINFO", "lib-name", "golden"}, {"CLIENT", "SETINFO", "lib-ver", "1.0"}, {"CLIENT", "SETINFO", "nosuch", "x"}}},
+	{command: "CLIENT", name: "tracking", cmds: [][]string{{"CLIENT", "TRACKINGINFO"}, {"CLIENT", "GETREDIR"}, {"CLIENT", "CACHING", "YES"}, {"CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "k"}, {"CLIENT", "TRACKINGINFO"}, {"SET", "k1", "v"}, {"CLIENT", "TRACKING", "OFF"}}},
+	{command: "CLIENT", name: "unknown clients", cmds: [][]string{{"CLIENT", "KILL", "ID", "999999"}, {"CLIENT", "UNBLOCK", "999999"}, {"CLIENT", "UNPAUSE"}}},
+	{command: "CLIENT", name: "HELP", cmds: [][]string{{"CLIENT", "HELP"}, {"CLIENT", "NOSUCH"}}},
+	// Strings
+	{command: "SET", name: "options", cmds: [][]string{{"SET", "k", "v"}, {"SET", "k", "w", "NX"}, {"SET", "k", "w", "XX", "GET"}, {"SET", "k", "v", "EXAT", "4102444800"}, {"SET", "k", "v", "EX", "0"}, {"SET", "k", "v", "NX", "XX"}}},
+	{command: "GET", name: "values", cmds: [][]string{{"GET", "k"}, {"SET", "k", "line\r\nbreak"}, {"GET", "k"}, {"SET", "e", ""}, {"GET", "e"}, {"RPUSH", "l", "a"}, {"GET", "l"}}},
+	{command: "GETEX", name: "expire times", cmds: [][]string{{"SET", "k", "v"}, {"GETEX", "k", "EXAT", "4102444800"}, {"EXPIRETIME", "k"}, {"GETEX", "k", "PERSIST"}, {"TTL", "k"}, {"GETEX", "missing"}, {"GETEX", "k", "EX", "0"}}},
+	{command: "GETDEL", name: "values", cmds: [][]string{{"SET", "k", "v"}, {"GETDEL", "k"}, {"GETDEL", "k"}}},
+	{command: "GETSET", name: "old values", cmds: [][]string{{"GETSET", "k", "v"}, {"GETSET", "k", "w"}}},
+	{command: "INCR", name: "counters", cmds: [][]string{{"INCR", "n"}, {"INCR", "n"}, {"DECR", "n"}, {"DECR", "m"}, {"SET", "s", "x"}, {"INCR", "s"}, {"SET", "max", "9223372036854775807"}, {"INCR", "max"}}},
+	{command: "INCRBYFLOAT", name: "doubles", cmds: [][]string{{"INCRBYFLOAT", "f", "10.5"}, {"INCRBYFLOAT", "f", "0.1"}, {"INCRBYFLOAT", "f", "-5e3"}, {"INCRBYFLOAT", "f", "x"}, {"SET", "big", "1e308"}, {"INCRBYFLOAT", "big", "1e308"}}},
+	{command: "APPEND", name: "lengths", cmds: [][]string{{"APPEND", "k", "ab"}, {"APPEND", "k", "cd"}, {"STRLEN", "k"}, {"STRLEN", "missing"}}},
+	{command: "GETRANGE", name: "ranges", cmds: [][]string{{"SET", "k", "This is a string"}, {"GETRANGE", "k", "0", "3"}, {"GETRANGE", "k", "-3", "-1"}, {"SUBSTR", "k", "10", "100"}, {"SETRANGE", "k", "5", "was"}, {"GET", "k"}, {"SETRANGE", "k", "-1", "x"}}},
+	{command: "OBJECT", name: "IDLETIME", cmds: [][]string{{"SET", "k", "v"}, {"OBJECT", "IDLETIME", "k"}, {"OBJECT", "IDLETIME", "missing"}}},
+	// Keys
+	{command: "DEL", name: "counts", cmds: [][]string{{"SET", "a", "1"}, {"SET", "b", "2"}, {"DEL", "a", "b", "c"}, {"SET", "a", "1"}, {"UNLINK", "a", "c"}, {"DEL"}}},
+	{command: "EXISTS", name: "counts", cmds: [][]string{{"SET", "a", "1"}, {"EXISTS", "a", "a", "b"}}},
+	{command: "KEYS", name: "patterns", cmds: [][]string{{"SET", "key", "v"}, {"KEYS", "k*"}, {"KEYS", "x*"}, {"RANDOMKEY"}}},
+	{command: "SCAN", name: "cursor", cmds: [][]string{{"SET", "key", "v"}, {"SCAN", "0"}, {"SCAN", "0", "MATCH", "x*", "COUNT", "10"}, {"SCAN", "x"}}},
+	{command: "RENAME", name: "keys", cmds: [][]string{{"SET", "a", "v"}, {"RENAME", "a", "b"}, {"GET", "b"}, {"RENAME", "a", "b"}}},
+	{command: "COPY", name: "keys", cmds: [][]string{{"SET", "a", "v"}, {"COPY", "a", "b"}, {"COPY", "a", "b"}, {"COPY", "a", "b", "REPLACE"}, {"COPY", "a", "a"}}},
+	{command: "DUMP", name: "payloads", cmds: [][]string{{"SET", "k", "10"}, {"DUMP", "k"}, {"DUMP", "missing"}, {"RESTORE", "r", "0", "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"}, {"GET", "r"}, {"RESTORE", "r", "0", "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"}, {"RESTORE", "x", "0", "bad"}}},
+	{command: "EXPIRE", name: "expire times", cmds: [][]string{{"SET", "k", "v"}, {"EXPIREAT", "k", "4102444800"}, {"EXPIRETIME", "k"}, {"PEXPIRETIME", "k"}, {"PEXPIREAT", "k", "4102444800000", "GT"}, {"EXPIRE", "k", "100", "NX"}, {"PERSIST", "k"}, {"TTL", "k"}, {"PTTL", "missing"}, {"EXPIRE", "k", "x"}}},
+	{command: "EXPIRE", name: "relative", cmds: [][]string{{"SET", "k", "v"}, {"EXPIRE", "k", "1000"}, {"PEXPIRE", "k", "2000000"}, {"EXPIRE", "k", "-1"}, {"EXISTS", "k"}}},
+	// Hashes
+	{command: "HSET", name: "fields", cmds: [][]string{{"HSET", "h", "f", "v"}, {"HSET", "h", "f", "w", "g", "x"}, {"HMSET", "h", "i", "y"}, {"HGET", "h", "f"}, {"HGET", "h", "nosuch"}, {"HLEN", "h"}, {"HDEL", "h", "g", "i", "nosuch"}, {"HSET", "h", "f"}}},
+	{command: "HGETALL", name: "maps", cmds: [][]string{{"HGETALL", "h"}, {"HSET", "h", "f", "v"}, {"HGETALL", "h"}}},
+	{command: "HEXISTS", name: "booleans", cmds: [][]string{{"HSET", "h", "f", "v"}, {"HEXISTS", "h", "f"}, {"HEXISTS", "h", "g"}, {"HEXISTS", "missing", "f"}, {"SET", "s", "v"}, {"HEXISTS", "s", "f"}}},
+	// Lists
+	{command: "LPUSH", name: "lists", cmds: [][]string{{"LPUSH", "l", "a", "b"}, {"RPUSH", "l", "c"}, {"LPUSHX", "missing", "a"}, {"RPUSHX", "l", "d"}, {"LRANGE", "l", "0", "-1"}, {"LLEN", "l"}, {"LINDEX", "l", "1"}, {"LINDEX", "l", "10"}}},
+	{command: "LPOP", name: "counts", cmds: [][]string{{"RPUSH", "l", "a", "b", "c"}, {"LPOP", "l"}, {"RPOP", "l", "5"}, {"LPOP", "l"}, {"LPOP", "l", "2"}, {"RPOP", "l", "-1"}}},
+	{command: "LSET", name: "changes", cmds: [][]string{{"RPUSH", "l", "a", "b", "a"}, {"LSET", "l", "0", "x"}, {"LSET", "l", "9", "x"}, {"LINSERT", "l", "BEFORE", "b", "y"}, {"LINSERT", "l", "AFTER", "nosuch", "y"}, {"LREM", "l", "0", "a"}, {"LTRIM", "l", "0", "1"}, {"LRANGE", "l", "0", "-1"}}},
+	{command: "BLPOP", name: "ready and timed out", cmds: [][]string{{"RPUSH", "l", "a"}, {"BLPOP", "l", "0"}, {"BRPOP", "l", "0.01"}, {"BLPOP", "l", "-1"}}},
+	// Sets
+	{command: "SADD", name: "members", cmds: [][]string{{"SADD", "s", "a", "a"}, {"SREM", "s", "b"}, {"SCARD", "s"}, {"SMEMBERS", "s"}, {"SMEMBERS", "missing"}, {"SPOP", "s"}, {"SPOP", "s"}, {"SADD", "t", "x"}, {"SRANDMEMBER", "t"}, {"SRANDMEMBER", "t", "-2"}}},
+	{command: "SISMEMBER", name: "booleans", cmds: [][]string{{"SADD", "s", "a"}, {"SISMEMBER", "s", "a"}, {"SISMEMBER", "s", "b"}, {"SISMEMBER", "missing", "a"}, {"SET", "k", "v"}, {"SISMEMBER", "k", "a"}}},
+	{command: "SINTER", name: "set operations", cmds: [][]string{{"SADD", "a", "x", "y"}, {"SADD", "b", "y", "z"}, {"SINTER", "a", "b"}, {"SDIFF", "a", "b"}, {"SREM", "b", "z"}, {"SUNION", "b", "missing"}, {"SINTER", "a", "missing"}}},
+	// Sorted sets
+	{command: "ZADD", name: "options", cmds: [][]string{{"ZADD", "z", "1", "a", "2", "b"}, {"ZADD", "z", "NX", "5", "a", "3", "c"}, {"ZADD", "z", "XX", "CH", "4", "a"}, {"ZADD", "z", "NX", "XX", "1", "a"}, {"ZADD", "z", "x", "a"}, {"ZCARD", "z"}}},
+	{command: "ZSCORE", name: "doubles", cmds: [][]string{{"ZADD", "z", "1.5", "a", "+inf", "b", "-inf", "c", "3", "d"}, {"ZSCORE", "z", "a"}, {"ZSCORE", "z", "b"}, {"ZSCORE", "z", "c"}, {"ZSCORE", "z", "d"}, {"ZSCORE", "z", "nosuch"}}},
+	{command: "ZINCRBY", name: "doubles", cmds: [][]string{{"ZINCRBY", "z", "1.25", "a"}, {"ZINCRBY", "z", "-0.25", "a"}, {"ZINCRBY", "z", "x", "a"}}},
+	{command: "ZRANGE", name: "ranges", cmds: [][]string{{"ZADD", "z", "1", "a", "2", "b", "3", "c"}, {"ZRANGE", "z", "0", "-1", "WITHSCORES"}, {"ZREVRANGE", "z", "0", "0"}, {"ZRANGEBYSCORE", "z", "(1", "+inf"}, {"ZREVRANGEBYSCORE", "z", "+inf", "-inf", "WITHSCORES"}, {"ZCOUNT", "z", "2", "3"}, {"ZRANK", "z", "b"}, {"ZREVRANK", "z", "b"}, {"ZREM", "z", "a", "x"}}},
+	{command: "ZRANGE", name: "scores", cmds: [][]string{{"ZADD", "z", "1e300", "big", "1000000", "million", "0.00001", "tiny", "+inf", "top"}, {"ZRANGE", "z", "0", "-1", "WITHSCORES"}, {"ZSCORE", "z", "big"}, {"ZINCRBY", "z", "0.5", "million"}, {"ZSCORE", "z", "top"}}},
+	{command: "ZREMRANGEBYSCORE", name: "emptied key", cmds: [][]string{{"ZADD", "z", "1", "a", "2", "b", "3", "c"}, {"ZREMRANGEBYRANK", "z", "0", "0"}, {"ZREMRANGEBYSCORE", "z", "-inf", "+inf"}, {"EXISTS", "z"}, {"TYPE", "z"}}},
+	// Streams
+	{command: "XADD", name: "entries", cmds: [][]string{{"XADD", "s", "1-1", "f", "v"}, {"XADD", "s", "1-1", "f", "v"}, {"XADD", "s", "2-0", "f", "w"}, {"XLEN", "s"}, {"XRANGE", "s", "-", "+"}, {"XREVRANGE", "s", "+", "-", "COUNT", "1"}, {"XDEL", "s", "1-1"}, {"XTRIM", "s", "MAXLEN", "0"}, {"XSETID", "s", "5-0"}}},
+	{command: "XREAD", name: "maps of streams", cmds: [][]string{{"XADD", "s", "1-1", "f", "v"}, {"XREAD", "STREAMS", "s", "0"}, {"XREAD", "STREAMS", "s", "1-1"}}},
+	{command: "XREADGROUP", name: "groups", cmds: [][]string{{"XADD", "s", "1-1", "f", "v"}, {"XGROUP", "CREATE", "s", "g", "0"}, {"XGROUP", "CREATECONSUMER", "s", "g", "c2"}, {"XREADGROUP", "GROUP", "g", "c", "STREAMS", "s", ">"}, {"XPENDING", "s", "g"}, {"XCLAIM", "s", "g", "c2", "0", "1-1", "JUSTID"}, {"XAUTOCLAIM", "s", "g", "c", "0", "0-0", "JUSTID"}, {"XACK", "s", "g", "1-1"}, {"XGROUP", "SETID", "s", "g", "$"}, {"XGROUP", "DELCONSUMER", "s", "g", "c2"}, {"XGROUP", "DESTROY", "s", "g"}}},
+	{command: "XINFO", name: "stream", cmds: [][]string{{"XADD", "s", "1-1", "f", "v"}, {"XGROUP", "CREATE", "s", "g", "$"}, {"XINFO", "STREAM", "s"}, {"XINFO", "GROUPS", "s"}, {"XINFO", "STREAM", "missing"}}},
+	// HyperLogLog
+	{command: "PFADD", name: "counts", cmds: [][]string{{"PFADD", "h", "a", "b", "c"}, {"PFADD", "h", "a"}, {"PFCOUNT", "h"}, {"PFADD", "i", "d"}, {"PFMERGE", "m", "h", "i"}, {"PFCOUNT", "m"}, {"PFDEBUG", "ENCODING", "m"}, {"SET", "s", "v"}, {"PFCOUNT", "s"}}},
+	// Geospatial indexes
+	{command: "GEOADD", name: "Sicily", cmds: [][]string{{"GEOADD", "g", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, {"GEODIST", "g", "Palermo", "Catania", "km"}, {"GEOHASH", "g", "Palermo", "nosuch"}, {"GEOPOS", "g", "Palermo", "nosuch"}, {"GEOADD", "g", "200", "0", "x"}}},
+	{command: "GEOSEARCH", name: "Sicily", cmds: [][]string{{"GEOADD", "g", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, {"GEOSEARCH", "g", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC", "WITHCOORD", "WITHDIST", "WITHHASH"}, {"GEOSEARCHSTORE", "d", "g", "FROMMEMBER", "Palermo", "BYBOX", "400", "400", "km", "ASC", "STOREDIST"}, {"ZRANGE", "d", "0", "-1", "WITHSCORES"}, {"GEORADIUS", "g", "15", "37", "200", "km", "WITHDIST", "ASC"}, {"GEORADIUS_RO", "g", "15", "37", "1", "km"}, {"GEORADIUSBYMEMBER", "g", "Palermo", "100", "km"}, {"GEORADIUSBYMEMBER_RO", "g", "Palermo", "100", "km", "COUNT", "1"}}},
+	// Pub/Sub
+	{command: "SUBSCRIBE", name: "channels", cmds: [][]string{{"SUBSCRIBE", "a", "b"}, {"PSUBSCRIBE", "p*"}, {"PUNSUBSCRIBE"}, {"UNSUBSCRIBE"}, {"SSUBSCRIBE", "s"}, {"SUNSUBSCRIBE", "s"}}},
+	{command: "PUBLISH", name: "receivers", cmds: [][]string{{"PUBLISH", "a", "m"}, {"SPUBLISH", "s", "m"}, {"PUBSUB", "CHANNELS"}, {"PUBSUB", "NUMSUB", "a"}, {"PUBSUB", "NUMPAT"}, {"PUBSUB", "SHARDCHANNELS"}, {"PUBSUB", "SHARDNUMSUB", "s"}}},
+	// Scripting
+	{command: "EVAL", name: "conversions", cmds: [][]string{{"EVAL", "return {1, 'two', {3}, false, redis.status_reply('OK')}", "0"}, {"EVAL", "return redis.error_reply('MY error')", "0"}, {"EVAL", "return 3.99", "0"}, {"EVAL", "redis.call('SADD', KEYS[1], 'a'); return {redis.call('SISMEMBER', KEYS[1], 'a'), redis.call('ZINCRBY', KEYS[2], 1.5, 'a')}", "2", "s", "z"}, {"EVAL_RO", "return redis.call('GET', KEYS[1])", "1", "k"}, {"EVAL", "return redis.call('NOSUCH')", "0"}}},
+	{command: "EVALSHA", name: "cached scripts", cmds: [][]string{{"SCRIPT", "LOAD", "return ARGV[1]"}, {"EVALSHA", "098e0f0d1448c0a81dafe820f66d460eb09263da", "0", "x"}, {"SCRIPT", "EXISTS", "098e0f0d1448c0a81dafe820f66d460eb09263da", "nosuch"}, {"EVALSHA_RO", "098e0f0d1448c0a81dafe820f66d460eb09263da", "0", "x"}, {"SCRIPT", "FLUSH"}, {"SCRIPT", "KILL"}}},
+	{command: "FCALL", name: "libraries", cmds: [][]string{{"FUNCTION", "LOAD", "#!lua name=golden\nredis.register_function('echo', function(keys, args) return args[1] end)\nredis.register_function{function_name='ro', callback=function() return 1 end, flags={'no-writes'}}"}, {"FCALL", "echo", "0", "hi"}, {"FCALL_RO", "ro", "0"}, {"FUNCTION", "LIST"}, {"FUNCTION", "DELETE", "golden"}, {"FCALL", "echo", "0", "hi"}, {"FUNCTION", "KILL"}}},
+	// Server
+	{command: "COMMAND", name: "introspection", cmds: [][]string{{"COMMAND", "COUNT"}, {"COMMAND", "INFO", "GET", "nosuch"}, {"COMMAND", "GETKEYS", "SET", "k", "v"}}},
+	{command: "INFO", name: "verbatim", cmds: [][]string{{"INFO", "keyspace"}, {"SET", "k", "v"}, {"INFO", "keyspace"}}},
+	{command: "ACL", name: "users and categories", cmds: [][]string{{"ACL", "WHOAMI"}, {"ACL", "CAT", "geo"}, {"ACL", "CAT", "nosuch"}}},
+	{command: "ACL", name: "SETUSER and AUTH", cmds: [][]string{{"ACL", "SETUSER", "golden", "on", ">pw", "~*", "&*", "+@all"}, {"ACL", "GETUSER", "golden"}, {"ACL", "GETUSER", "nosuch"}, {"AUTH", "golden", "nopw"}, {"AUTH", "golden", "pw"}, {"ACL", "WHOAMI"}, {"AUTH", "default", "any"}, {"ACL", "DELUSER", "golden"}, {"ACL", "USERS"}, {"ACL", "SAVE"}}},
+	{command: "CLUSTER", name: "slots", cmds: [][]string{{"CLUSTER", "KEYSLOT", "somekey"}, {"CLUSTER", "KEYSLOT", "{user1000}.following"}, {"SET", "somekey", "v"}, {"CLUSTER", "COUNTKEYSINSLOT", "11058"}, {"CLUSTER", "GETKEYSINSLOT", "11058", "10"}}},
+	{command: "DEBUG", name: "keys", cmds: [][]string{{"SET", "k", "v"}, {"DEBUG", "BIGKEYS"}, {"DEBUG", "NOSUCH"}}},
+	{command: "ROLE", name: "master", cmds: [][]string{{"ROLE"}}},
+	{command: "SAVE", name: "without persistence", cmds: [][]string{{"SAVE"}, {"BGSAVE"}, {"BGREWRITEAOF"}}},
+	{command: "NOSUCH", name: "unknown command", cmds: [][]string{{"NOSUCH", "a", "b"}, {"GET"}}},
+}
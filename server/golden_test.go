@@ -0,0 +1,252 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/resp"
+	"github.com/liweiyuan/go-redis-server/server"
+)
+
+var update = flag.Bool("update", false, "write the replies to the golden files rather than check them")
+
+// sentinel is the message of the PING sent after each command: the replies
+// read before its own are those of the command, pushes included.
+const sentinel = "golden:end-of-replies"
+
+// pass is a protocol version the cases run in.
+type pass struct {
+	name  string     // The golden file, in testdata
+	hello [][]string // The commands switching the connection to the version
+}
+
+var passes = []pass{
+	{name: "resp2", hello: nil},
+	{name: "resp3", hello: [][]string{{"HELLO", "3"}}},
+	{name: "resp2", hello: [][]string{{"HELLO", "3"}, {"HELLO", "2"}}},
+}
+
+// TestGoldenReplies checks the bytes the server writes for the replies of
+// every command, in RESP2 and in RESP3, against the golden files of
+// testdata, so that a change to the resp package or to the reply of a
+// command cannot alter what goes on the wire unnoticed. Each case runs the
+// commands of golden_cases_test.go on a new connection, on an empty
+// dataset, three times: in RESP2, in RESP3 after HELLO 3, and after HELLO
+// 3 then HELLO 2, where the replies must be those of RESP2 again. -update
+// writes the replies to the golden files instead, to be reviewed as any
+// other change.
+func TestGoldenReplies(t *testing.T) {
+	srv := server.NewInMemory()
+	defer srv.Close()
+	for i, p := range passes {
+		path := filepath.Join("testdata", p.name+".golden")
+		if *update {
+			// The downgraded pass checks the file of its version, written
+			// once.
+			if i < 2 {
+				writeGolden(t, srv, p, path)
+			}
+			continue
+		}
+		golden, err := readGolden(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(describePass(p), func(t *testing.T) {
+			for _, cs := range goldenCases {
+				header := cs.command + ": " + cs.name
+				t.Run(header, func(t *testing.T) {
+					block, err := runCase(srv, p, cs)
+					if err != nil {
+						t.Fatal(err)
+					}
+					want, ok := golden[header]
+					if !ok {
+						t.Fatalf("no golden replies in %s, run with -update", path)
+					}
+					if block != want {
+						t.Errorf("replies differ from %s\n%s", path, indent("got", block)+indent("want", want))
+					}
+				})
+			}
+		})
+	}
+}
+
+// writeGolden runs every case in the version of p and writes their
+// replies to the golden file at path.
+func writeGolden(t *testing.T, srv *server.InMemory, p pass, path string) {
+	var file strings.Builder
+	for _, cs := range goldenCases {
+		header := cs.command + ": " + cs.name
+		block, err := runCase(srv, p, cs)
+		if err != nil {
+			t.Fatalf("%s %s: %v", p.name, header, err)
+		}
+		file.WriteString("# " + header + "\n" + block + "\n")
+	}
+	if err := os.WriteFile(path, []byte(file.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("wrote %s", path)
+}
+
+// recorder keeps the bytes read from a connection until they are taken.
+type recorder struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func (rec *recorder) Read(p []byte) (int, error) {
+	n, err := rec.r.Read(p)
+	rec.buf.Write(p[:n])
+	return n, err
+}
+
+// conn is a connection that returns the bytes of the replies it reads.
+type conn struct {
+	c   net.Conn
+	rec *recorder
+	r   *bufio.Reader
+}
+
+func newConn(c net.Conn) *conn {
+	rec := &recorder{r: c}
+	return &conn{c: c, rec: rec, r: bufio.NewReader(rec)}
+}
+
+// do sends argv and returns the bytes of the replies to it, the pushes
+// the server sent before them included.
+func (c *conn) do(argv []string) (string, error) {
+	if err := c.send(argv); err != nil {
+		return "", err
+	}
+	if err := c.send([]string{"PING", sentinel}); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for {
+		c.c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		v, err := resp.ReadResp(c.r)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", strings.Join(argv, " "), err)
+		}
+		// The reply is what the reader consumed, less what it buffered.
+		raw := string(c.rec.buf.Next(c.rec.buf.Len() - c.r.Buffered()))
+		if isSentinel(v) {
+			return out.String(), nil
+		}
+		out.WriteString(raw)
+	}
+}
+
+func (c *conn) send(argv []string) error {
+	args := make([]resp.RespValue, len(argv))
+	for i, arg := range argv {
+		args[i] = resp.NewBulk(arg)
+	}
+	return resp.WriteResp(c.c, resp.NewArray(args))
+}
+
+// isSentinel reports whether v is the reply to the PING of sentinel, which
+// a subscribed RESP2 connection gets as an array.
+func isSentinel(v resp.RespValue) bool {
+	if v.Type == resp.Bulk {
+		return v.Str == sentinel
+	}
+	elems := v.Elements()
+	return (v.Type == resp.Array || v.Type == resp.Push) && len(elems) == 2 && elems[1].Str == sentinel
+}
+
+// runCase runs the commands of cs on a new connection switched to the
+// version of p, after removing all the keys, and returns the block of the
+// golden file for them: each command, then its replies quoted as Go
+// strings.
+func runCase(srv *server.InMemory, p pass, cs goldenCase) (string, error) {
+	nc, err := srv.Dial()
+	if err != nil {
+		return "", err
+	}
+	c := newConn(nc)
+	defer nc.Close()
+	for _, argv := range append(p.hello, []string{"DEBUG", "FLUSHALL"}) {
+		if _, err := c.do(argv); err != nil {
+			return "", err
+		}
+	}
+	var b strings.Builder
+	for _, argv := range cs.cmds {
+		raw, err := c.do(argv)
+		if err != nil {
+			return "", err
+		}
+		quoted := make([]string, len(argv))
+		for i, arg := range argv {
+			quoted[i] = arg
+			if q := strconv.Quote(arg); arg == "" || strings.Contains(arg, " ") || q[1:len(q)-1] != arg {
+				quoted[i] = q
+			}
+		}
+		fmt.Fprintf(&b, "> %s\n%s\n", strings.Join(quoted, " "), strconv.Quote(raw))
+	}
+	return b.String(), nil
+}
+
+// readGolden reads a golden file into the blocks of its cases, by header.
+func readGolden(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make(map[string]string)
+	var header string
+	var block strings.Builder
+	flush := func() {
+		if header != "" {
+			blocks[header] = strings.TrimSuffix(block.String(), "\n")
+		}
+		block.Reset()
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if h, ok := strings.CutPrefix(line, "# "); ok {
+			flush()
+			header = h
+			continue
+		}
+		block.WriteString(line + "\n")
+	}
+	flush()
+	return blocks, nil
+}
+
+// describePass names the way the connection of p got its version.
+func describePass(p pass) string {
+	if len(p.hello) == 0 {
+		return p.name
+	}
+	steps := make([]string, len(p.hello))
+	for i, argv := range p.hello {
+		steps[i] = strings.Join(argv, " ")
+	}
+	return p.name + " after " + strings.Join(steps, ", ")
+}
+
+// indent labels the lines of a block of a failure report.
+func indent(label, block string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(block, "\n"), "\n") {
+		fmt.Fprintf(&b, "     %-4s %s\n", label, line)
+		label = ""
+	}
+	return b.String()
+}
@@ -0,0 +1,176 @@
+// Package server embeds the server in another Go program, to test Redis
+// clients without a network.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/command"
+	"github.com/liweiyuan/go-redis-server/config"
+	"github.com/liweiyuan/go-redis-server/network"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// ErrClosed is returned by Dial once the server is closed.
+var ErrClosed = errors.New("server: in-memory server closed")
+
+// InMemory is a server running in the process, without persistence, whose
+// connections are pipes rather than sockets. Each test can run its own:
+//
+//	srv := server.NewInMemory()
+//	defer srv.Close()
+//	rdb := redis.NewClient(&redis.Options{Dialer: srv.DialContext})
+type InMemory struct {
+	Storage  *storage.Storage
+	Registry *command.CommandRegistry
+
+	srv  *network.Server
+	stop chan struct{}
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{} // Client ends of the open connections
+	closed bool
+}
+
+// NewInMemory starts a server with the default configuration and an empty
+// dataset.
+func NewInMemory() *InMemory {
+	s := storage.NewStorage()
+	cr := command.NewCommandRegistry()
+	m := &InMemory{
+		Storage:  s,
+		Registry: cr,
+		srv:      network.NewServer(config.Default(), s, cr),
+		stop:     make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go m.expireKeys()
+	return m
+}
+
+// Dial returns a new connection to the server.
+func (m *InMemory) Dial() (net.Conn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	client, conn := net.Pipe()
+	m.conns[client] = struct{}{}
+	go func() {
+		m.srv.ServeConn(newBufferedConn(conn))
+		m.mu.Lock()
+		delete(m.conns, client)
+		m.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// DialContext is Dial with the signature of the Dialer option of client
+// libraries such as go-redis; the network and address are ignored.
+func (m *InMemory) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Dial()
+}
+
+// Close closes the open connections and stops the server.
+func (m *InMemory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.stop)
+	for conn := range m.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// expireKeys runs the active expire cycle until the server is closed, as
+// the server started by main does.
+func (m *InMemory) expireKeys() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.Registry.ActiveExpireCycle(m.Storage)
+		}
+	}
+}
+
+// bufferedConn is the server end of a pipe, whose writes are queued and
+// copied to the pipe by another goroutine. A pipe has no buffer, so
+// otherwise a client writing a pipeline before reading the replies would
+// block on the server writing the first reply.
+type bufferedConn struct {
+	net.Conn
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []byte
+	closing bool  // Close was called; the pipe closes once pending is written
+	err     error // Set once writing to the pipe failed
+}
+
+func newBufferedConn(conn net.Conn) *bufferedConn {
+	c := &bufferedConn{Conn: conn}
+	c.cond = sync.NewCond(&c.mu)
+	go c.flush()
+	return c
+}
+
+func (c *bufferedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.closing {
+		return 0, net.ErrClosed
+	}
+	c.pending = append(c.pending, b...)
+	c.cond.Signal()
+	return len(b), nil
+}
+
+// Close closes the pipe after the queued writes, such as the reply to
+// QUIT, reach the client.
+func (c *bufferedConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closing = true
+	c.cond.Signal()
+	return nil
+}
+
+// flush copies the queued writes to the pipe until it is closed.
+func (c *bufferedConn) flush() {
+	defer c.Conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.err == nil {
+		for len(c.pending) == 0 && !c.closing {
+			c.cond.Wait()
+		}
+		if len(c.pending) == 0 {
+			return
+		}
+		b := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		_, err := c.Conn.Write(b)
+		c.mu.Lock()
+		c.err = err
+	}
+}
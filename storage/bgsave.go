@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/internal/rdb"
+)
+
+// A snapshot is written while commands keep modifying the dataset, without
+// copying the dataset up front. It is written shard by shard. Until the
+// shard of a key has been written, the first write to the key saves a copy
+// of its old value, which the snapshot writes instead of the current one.
+// Once a shard has been written its keys are no longer copied, so the extra
+// memory is bounded by the keys modified in the shards still to be written.
+
+// ErrSnapshotInProgress is returned when a snapshot is started while
+// another one is being written.
+var ErrSnapshotInProgress = errors.New("a snapshot is already in progress")
+
+// snapshotState tracks the shards of a snapshot being written.
+type snapshotState struct {
+	shards [numShards]struct {
+		mu      sync.Mutex // Held while the shard is written
+		done    bool
+		pending map[string]pendingEntry // Keys modified since the snapshot started
+	}
+}
+
+// pendingEntry is the state of a key when the snapshot started.
+type pendingEntry struct {
+	val      Value
+	expireAt int64 // Expire time in Unix milliseconds, -1 for none
+	exists   bool
+}
+
+// Snapshot is a point-in-time view of the dataset, started by
+// BeginSnapshot and written by Save, WriteRDB or Commands.
+type Snapshot struct {
+	s         *Storage
+	state     *snapshotState
+	dirty     int64    // Changes not yet saved when the snapshot started
+	functions []string // Code of the function libraries when the snapshot started
+}
+
+// BeginSnapshot starts a snapshot of the dataset as it is now. The caller
+// must ensure no write is in progress when it is called, and must end the
+// snapshot with Save, WriteRDB, Commands or Abort. Only one snapshot can be in progress at a time.
+func (s *Storage) BeginSnapshot() (*Snapshot, error) {
+	state := &snapshotState{}
+	if !s.snap.CompareAndSwap(nil, state) {
+		return nil, ErrSnapshotInProgress
+	}
+	return &Snapshot{s: s, state: state, dirty: s.dirty.Load(), functions: s.Functions()}, nil
+}
+
+// Save writes the snapshot to w in the RDB format and ends it. Once it has
+// been written, the changes it contains no longer count as dirty.
+func (sn *Snapshot) Save(w io.Writer) error {
+	if err := sn.WriteRDB(w); err != nil {
+		return err
+	}
+	sn.s.dirty.Add(-sn.dirty)
+	return nil
+}
+
+// WriteRDB writes the snapshot to w in the RDB format and ends it, like
+// Save, but leaves the count of dirty changes alone, as the preamble of the
+// append only file does not replace the snapshot file.
+func (sn *Snapshot) WriteRDB(w io.Writer) error {
+	return writeRDB(w, sn.functions, sn.each)
+}
+
+// writeRDB writes the code of the function libraries and the keys each
+// calls its function with to w in the RDB format.
+func writeRDB(w io.Writer, functions []string, each func(f func(key string, val Value, expireAt int64) error) error) error {
+	rw := rdb.NewWriter(w)
+	rw.WriteHeader()
+	rw.WriteAux("redis-ver", "7.0.0")
+	rw.WriteAux("redis-bits", "64")
+	for _, code := range functions {
+		rw.WriteByte(rdb.OpFunction2)
+		rw.WriteString(code)
+	}
+	rw.WriteSelectDB(0)
+	err := each(func(key string, val Value, expireAt int64) error {
+		if expireAt >= 0 {
+			rw.WriteExpireTimeMs(expireAt)
+		}
+		val.Serialize(rw, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rw.Close()
+}
+
+// Abort ends the snapshot without writing it.
+func (sn *Snapshot) Abort() {
+	sn.s.snap.Store(nil)
+}
+
+// each calls f for each key of the snapshot, with its value and expire
+// time in Unix milliseconds, -1 for none, and ends the snapshot.
+func (sn *Snapshot) each(f func(key string, val Value, expireAt int64) error) error {
+	defer sn.s.snap.Store(nil)
+	for i := range sn.s.shards {
+		if err := sn.eachInShard(i, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachInShard calls f for the keys of shard i, as they were when the
+// snapshot started. Writes to the shard wait until f has been called for
+// all of them.
+func (sn *Snapshot) eachInShard(i int, f func(key string, val Value, expireAt int64) error) error {
+	ss := &sn.state.shards[i]
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sh := &sn.s.shards[i]
+	var err error
+	sh.data.Range(func(k, v any) bool {
+		key := k.(string)
+		if _, modified := ss.pending[key]; modified {
+			return true
+		}
+		expireAt := int64(-1)
+		if at, ok := sh.expires.Load(key); ok {
+			expireAt = at.(int64)
+		}
+		err = f(key, v.(Value), expireAt)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	for key, e := range ss.pending {
+		if !e.exists {
+			continue
+		}
+		if err := f(key, e.val, e.expireAt); err != nil {
+			return err
+		}
+	}
+	ss.done = true
+	ss.pending = nil
+	return nil
+}
+
+// preserve saves the current state of key for the snapshot in progress, if
+// the snapshot has not written it yet. Every write must call it before
+// modifying the key.
+func (s *Storage) preserve(key string) {
+	s.preserveValue(key, true)
+}
+
+// preserveRemoved is preserve for a write that deletes or replaces the
+// value of key as a whole. Nothing modifies the value once it is removed,
+// so it is saved as it is rather than copied, and deleting a large value
+// during a background save costs no more than otherwise.
+func (s *Storage) preserveRemoved(key string) {
+	s.preserveValue(key, false)
+}
+
+func (s *Storage) preserveValue(key string, clone bool) {
+	state := s.snap.Load()
+	if state == nil {
+		return
+	}
+	i := shardIndex(key)
+	ss := &state.shards[i]
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.done {
+		return
+	}
+	if _, ok := ss.pending[key]; ok {
+		return
+	}
+	if ss.pending == nil {
+		ss.pending = make(map[string]pendingEntry)
+	}
+	e := pendingEntry{expireAt: -1}
+	sh := &s.shards[i]
+	if v, ok := sh.data.Load(key); ok {
+		val := v.(Value)
+		if clone {
+			val = val.clone()
+		}
+		e.val, e.exists = val, true
+		if at, ok := sh.expires.Load(key); ok {
+			e.expireAt = at.(int64)
+		}
+	}
+	ss.pending[key] = e
+}
+
+// Strings are immutable, so they need no copy.
+func (v StringValue) clone() Value { return v }
+
+func (v ListValue) clone() Value {
+	lst := newList()
+	for e := v.Front(); e != nil; e = e.Next() {
+		lst.PushBack(e.Value)
+	}
+	return lst
+}
+
+func (v SetValue) clone() Value  { return maps.Clone(v) }
+func (v HashValue) clone() Value { return maps.Clone(v) }
+func (v ZSetValue) clone() Value { return maps.Clone(v) }
+
+func (v StreamValue) clone() Value {
+	st := *v.stream
+	st.entries = slices.Clone(v.entries)
+	st.groups = make(map[string]*consumerGroup, len(v.groups))
+	for name, g := range v.groups {
+		cg := *g
+		cg.pending = make(map[StreamID]*delivery, len(g.pending))
+		for id, p := range g.pending {
+			d := *p
+			cg.pending[id] = &d
+		}
+		cg.consumers = make(map[string]*consumer, len(g.consumers))
+		for cname, c := range g.consumers {
+			cc := *c
+			cc.pending = maps.Clone(c.pending)
+			cg.consumers[cname] = &cc
+		}
+		st.groups[name] = &cg
+	}
+	return StreamValue{&st}
+}
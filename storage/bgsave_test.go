@@ -0,0 +1,49 @@
+package storage
+
+import "testing"
+
+// TestSnapshotPreservesWritesOnly checks that reads during a background
+// snapshot copy nothing into it, and that a write preserves the key it
+// changes.
+func TestSnapshotPreservesWritesOnly(t *testing.T) {
+	s := NewStorage()
+	s.Set("string", "v")
+	s.RPush("list", "a", "b")
+	s.SAdd("set", "a", "b")
+	s.HSet("hash", "f", "v")
+	s.ZAdd("zset", ZSetMember{Member: "a", Score: 1})
+
+	sn, err := s.BeginSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sn.Abort()
+	s.Get("string")
+	s.LRange("list", 0, -1)
+	s.SMembers("set")
+	s.HGetAll("hash")
+	s.ZRange("zset", 0, -1, false)
+	if got := preserved(s); len(got) != 0 {
+		t.Errorf("reads preserved %v", got)
+	}
+
+	s.SAdd("set", "c")
+	if got := preserved(s); len(got) != 1 || got[0] != "set" {
+		t.Errorf("SADD preserved %v, want [set]", got)
+	}
+}
+
+// preserved returns the keys preserved for the snapshot in progress.
+func preserved(s *Storage) []string {
+	var keys []string
+	state := s.snap.Load()
+	for i := range state.shards {
+		ss := &state.shards[i]
+		ss.mu.Lock()
+		for key := range ss.pending {
+			keys = append(keys, key)
+		}
+		ss.mu.Unlock()
+	}
+	return keys
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// BigKey is a key reported by KeyspaceReport, with its number of elements
+// (bytes for a string) and the estimated bytes of its name and value.
+type BigKey struct {
+	Key      string
+	Elements int64
+	Bytes    int64
+}
+
+// TypeReport summarizes the keys of a type.
+type TypeReport struct {
+	Type       string // string, list, set, hash, zset or stream
+	Keys       int64
+	Elements   int64
+	Bytes      int64
+	ByElements []BigKey // Keys with the most elements, most first
+	ByBytes    []BigKey // Keys with the most estimated bytes, most first
+}
+
+// KeyspaceReport is the result of a scan of the keyspace for big keys, as
+// redis-cli --bigkeys reports them.
+type KeyspaceReport struct {
+	Types []TypeReport // In the order string, list, set, hash, zset, stream
+	// Histogram counts the keys by estimated bytes: bucket i holds those
+	// of 2^i to 2^(i+1)-1 bytes, and bucket 0 the empty ones too.
+	Histogram [64]int64
+}
+
+var reportTypes = []string{"string", "list", "set", "hash", "zset", "stream"}
+
+// KeyspaceReport scans the keyspace and returns, for each type, the top
+// keys with the most elements and the most bytes. The bytes are estimated
+// from the lengths of the key and of the strings of its value, without the
+// overhead of the data structures holding them.
+func (s *Storage) KeyspaceReport(top int) *KeyspaceReport {
+	r := &KeyspaceReport{Types: make([]TypeReport, len(reportTypes))}
+	for i, typ := range reportTypes {
+		r.Types[i].Type = typ
+	}
+	now := nowMs()
+	s.rangeKeys(func(key string, val Value) bool {
+		if at, ok := s.shard(key).expires.Load(key); ok && at.(int64) <= now {
+			return true
+		}
+		unlock := s.rlockKey(key)
+		elements, size := int64(val.Len()), val.SizeOf()
+		unlock()
+		i := slices.Index(reportTypes, val.Type())
+		bk := BigKey{Key: key, Elements: elements, Bytes: int64(len(key)) + size}
+		tr := &r.Types[i]
+		tr.Keys++
+		tr.Elements += bk.Elements
+		tr.Bytes += bk.Bytes
+		tr.ByElements = insertTop(tr.ByElements, bk, top, func(k BigKey) int64 { return k.Elements })
+		tr.ByBytes = insertTop(tr.ByBytes, bk, top, func(k BigKey) int64 { return k.Bytes })
+		r.Histogram[max(bits.Len64(uint64(bk.Bytes))-1, 0)]++
+		return true
+	})
+	return r
+}
+
+// insertTop inserts k into keys, sorted by decreasing weight, keeping the
+// top n of them.
+func insertTop(keys []BigKey, k BigKey, n int, weight func(BigKey) int64) []BigKey {
+	if n <= 0 {
+		return keys
+	}
+	i := len(keys)
+	for i > 0 && weight(keys[i-1]) < weight(k) {
+		i--
+	}
+	if i >= n {
+		return keys
+	}
+	keys = slices.Insert(keys, i, k)
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// String renders the report as text, in the manner of redis-cli --bigkeys.
+func (r *KeyspaceReport) String() string {
+	var b strings.Builder
+	unit := map[string]string{"string": "bytes", "list": "items", "set": "members", "hash": "fields", "zset": "members", "stream": "entries"}
+	for _, tr := range r.Types {
+		if tr.Keys == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %d keys with %d %s (%d bytes estimated)\n", tr.Type, tr.Keys, tr.Elements, unit[tr.Type], tr.Bytes)
+		for _, k := range tr.ByElements {
+			fmt.Fprintf(&b, "  biggest %s %q has %d %s\n", tr.Type, k.Key, k.Elements, unit[tr.Type])
+		}
+		for _, k := range tr.ByBytes {
+			fmt.Fprintf(&b, "  largest %s %q has %d bytes\n", tr.Type, k.Key, k.Bytes)
+		}
+	}
+	for i, n := range r.Histogram {
+		if n == 0 {
+			continue
+		}
+		lo := uint64(1) << i
+		if i == 0 {
+			lo = 0
+		}
+		fmt.Fprintf(&b, "keys of %d to %d bytes: %d\n", lo, uint64(1)<<(i+1)-1, n)
+	}
+	return b.String()
+}
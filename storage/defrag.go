@@ -0,0 +1,142 @@
+package storage
+
+import "sync/atomic"
+
+// A Go map never gives back the memory of the entries it once held: a set,
+// hash or sorted set that grew large and then shrank keeps the size of its
+// peak. Active defragmentation records the peak length of these containers
+// as they grow, and rebuilds those much smaller than their peak.
+
+const (
+	defragRatio    = 4   // Rebuild containers whose peak length is this many times their length
+	defragMinWaste = 128 // ... and that held at least this many more entries
+)
+
+// Estimated bytes of a map entry, beyond those of its strings: the string
+// header of the key, the value, and the share of the map's own overhead.
+const (
+	setEntryBytes  = 24
+	hashEntryBytes = 40
+	zsetEntryBytes = 56
+)
+
+// defragState holds the state of active defragmentation.
+type defragState struct {
+	enabled   atomic.Bool
+	running   atomic.Bool
+	hits      atomic.Int64 // Containers rebuilt
+	reclaimed atomic.Int64 // Estimated bytes given back by the rebuilds
+}
+
+// DefragStats reports the work of active defragmentation.
+type DefragStats struct {
+	Enabled   bool
+	Running   bool  // A defragmentation pass is in progress
+	Hits      int64 // Containers rebuilt
+	Reclaimed int64 // Estimated bytes given back by the rebuilds
+}
+
+// SetActiveDefrag enables or disables the tracking of the peak length of
+// containers that Defrag needs. Containers that grew before it was enabled
+// are not tracked until they grow again.
+func (s *Storage) SetActiveDefrag(enabled bool) {
+	s.defrag.enabled.Store(enabled)
+	if enabled {
+		return
+	}
+	for i := range s.shards {
+		peaks := &s.shards[i].peaks
+		peaks.Range(func(k, _ any) bool {
+			peaks.Delete(k)
+			return true
+		})
+	}
+}
+
+// DefragStats returns the statistics of active defragmentation.
+func (s *Storage) DefragStats() DefragStats {
+	return DefragStats{
+		Enabled:   s.defrag.enabled.Load(),
+		Running:   s.defrag.running.Load(),
+		Hits:      s.defrag.hits.Load(),
+		Reclaimed: s.defrag.reclaimed.Load(),
+	}
+}
+
+// recordPeak records the length of the container at key if it is the
+// largest seen, after elements were added to it.
+func (s *Storage) recordPeak(key string) {
+	sh := s.shard(key)
+	val, _ := sh.data.Load(key)
+	c, ok := val.(container)
+	if !ok {
+		return
+	}
+	n := c.Len()
+	if peak, ok := sh.peaks.Load(key); !ok || peak.(int) < n {
+		sh.peaks.Store(key, n)
+	}
+}
+
+// Defrag rebuilds the sets, hashes and sorted sets whose length fell far
+// below their peak, so the memory of the entries they no longer hold is
+// given back, and returns the number rebuilt. It holds the lock of each
+// shard while it rebuilds its containers.
+func (s *Storage) Defrag() int {
+	if !s.defrag.enabled.Load() {
+		return 0
+	}
+	s.defrag.running.Store(true)
+	defer s.defrag.running.Store(false)
+	rebuilt := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.peaks.Range(func(k, v any) bool {
+			key, peak := k.(string), v.(int)
+			val, _ := sh.data.Load(key)
+			c, ok := val.(container)
+			if !ok {
+				sh.peaks.Delete(key)
+				return true
+			}
+			n := c.Len()
+			if peak < n*defragRatio || peak-n < defragMinWaste {
+				return true
+			}
+			sh.data.Store(key, c.rebuild())
+			sh.peaks.Store(key, n)
+			s.defrag.hits.Add(1)
+			s.defrag.reclaimed.Add(int64(peak-n) * c.entryBytes())
+			rebuilt++
+			return true
+		})
+		sh.mu.Unlock()
+	}
+	return rebuilt
+}
+
+// container is a value whose memory Defrag can give back.
+type container interface {
+	Value
+	// entryBytes returns the estimated bytes of an entry.
+	entryBytes() int64
+	// rebuild returns a copy sized for the length of the value.
+	rebuild() Value
+}
+
+func (SetValue) entryBytes() int64  { return setEntryBytes }
+func (HashValue) entryBytes() int64 { return hashEntryBytes }
+func (ZSetValue) entryBytes() int64 { return zsetEntryBytes }
+
+func (v SetValue) rebuild() Value  { return copyMap(v) }
+func (v HashValue) rebuild() Value { return copyMap(v) }
+func (v ZSetValue) rebuild() Value { return copyMap(v) }
+
+func copyMap[M ~map[string]V, V any](m M) M {
+	c := make(M, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,18 @@
+package storage
+
+// changed records n changes to the dataset.
+func (s *Storage) changed(n int) {
+	s.dirty.Add(int64(n))
+}
+
+// Dirty returns the number of changes made to the dataset since the last
+// snapshot was started that was written successfully.
+func (s *Storage) Dirty() int64 {
+	return s.dirty.Load()
+}
+
+// ResetDirty forgets the changes made to the dataset, as after loading it
+// from disk.
+func (s *Storage) ResetDirty() {
+	s.dirty.Store(0)
+}
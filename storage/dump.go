@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"sync/atomic"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/rdb"
+)
+
+var (
+	errBusyKey    = errs.New("BUSYKEY", "Target key name already exists.")
+	errBadPayload = errs.Errorf("DUMP payload version or checksum are wrong")
+	errBadData    = errs.Errorf("Bad data format")
+)
+
+// DumpKey returns the value of key serialized as DUMP does, in the RDB format
+// followed by the format version and a checksum, and reports whether the
+// key exists.
+func (s *Storage) DumpKey(key string) (string, bool) {
+	defer s.rlockKey(key)()
+	val, ok := s.lookupRead(key)
+	if !ok {
+		return "", false
+	}
+	return string(rdb.Payload(func(w *rdb.Writer) {
+		val.(Value).Serialize(w, key)
+	})), true
+}
+
+// RestoreOptions holds the options of RESTORE.
+type RestoreOptions struct {
+	Replace  bool  // Overwrite an existing key
+	ExpireAt int64 // Expire time in Unix milliseconds, 0 for none
+	IdleTime int64 // Seconds since the last access to the key, -1 for now
+}
+
+// RestoreKey creates key from payload, a value serialized by DumpKey or by
+// Redis. A key whose expire time has already passed is not created, and
+// deletes the one it replaces.
+func (s *Storage) RestoreKey(key, payload string, opts RestoreOptions) error {
+	defer s.lockKey(key)()
+	_, exists := s.load(key)
+	if exists && !opts.Replace {
+		return errBusyKey
+	}
+	rr, err := rdb.ReadPayload([]byte(payload))
+	if err != nil {
+		return errBadPayload
+	}
+	typ, err := rr.ReadByte()
+	if err != nil {
+		return errBadData
+	}
+	val, err := readValue(rr, typ)
+	if err != nil || rr.More() {
+		return errBadData
+	}
+	if opts.ExpireAt > 0 && opts.ExpireAt <= nowMs() {
+		if exists {
+			s.delete(key)
+			s.changed(1)
+		}
+		return nil
+	}
+	s.write(key, val, ttlClear, "")
+	if opts.ExpireAt > 0 {
+		s.shard(key).expires.Store(key, opts.ExpireAt)
+	}
+	if opts.IdleTime >= 0 {
+		if stamp, ok := s.shard(key).access.Load(key); ok {
+			stamp.(*atomic.Int64).Store(lruClock() - opts.IdleTime*1000)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Entry is a key of a snapshot with its value, as exported to other
+// formats. The value is in the field matching Type.
+type Entry struct {
+	Key      string
+	Type     string            // string, list, set, hash, zset or stream
+	ExpireAt int64             // Unix milliseconds, -1 for none
+	String   string            // Value of a string
+	Elements []string          // Elements of a list in order, or members of a set sorted
+	Fields   map[string]string // Fields of a hash
+	Members  []ZSetMember      // Members of a sorted set by score
+	Entries  []StreamEntry     // Entries of a stream by ID
+}
+
+// Entries calls f with each key of the snapshot and ends the snapshot.
+func (sn *Snapshot) Entries(f func(e Entry) error) error {
+	return sn.each(func(key string, val Value, expireAt int64) error {
+		return f(newEntry(key, val, expireAt))
+	})
+}
+
+// newEntry returns the Entry of key holding val.
+func newEntry(key string, val Value, expireAt int64) Entry {
+	e := Entry{Key: key, Type: val.Type(), ExpireAt: expireAt}
+	val.export(&e)
+	return e
+}
+
+func (v StringValue) export(e *Entry) { e.String = string(v) }
+
+func (v ListValue) export(e *Entry) {
+	for el := v.Front(); el != nil; el = el.Next() {
+		e.Elements = append(e.Elements, el.Value.(string))
+	}
+}
+
+func (v SetValue) export(e *Entry) {
+	for member := range v {
+		e.Elements = append(e.Elements, member)
+	}
+	slices.Sort(e.Elements)
+}
+
+func (v HashValue) export(e *Entry) { e.Fields = maps.Clone(v) }
+
+func (v ZSetValue) export(e *Entry) {
+	for _, m := range v {
+		e.Members = append(e.Members, m)
+	}
+	slices.SortFunc(e.Members, func(a, b ZSetMember) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), cmp.Compare(a.Member, b.Member))
+	})
+}
+
+// export leaves out the consumer groups, which only snapshots keep.
+func (v StreamValue) export(e *Entry) { e.Entries = slices.Clone(v.entries) }
+
+// entryValue returns the value stored for e, the reverse of newEntry.
+func entryValue(e Entry) (Value, error) {
+	switch e.Type {
+	case "string":
+		return StringValue(e.String), nil
+	case "list":
+		lst := newList()
+		for _, el := range e.Elements {
+			lst.PushBack(el)
+		}
+		return lst, nil
+	case "set":
+		set := make(SetValue, len(e.Elements))
+		for _, member := range e.Elements {
+			set[member] = struct{}{}
+		}
+		return set, nil
+	case "hash":
+		return HashValue(maps.Clone(e.Fields)), nil
+	case "zset":
+		zset := make(ZSetValue, len(e.Members))
+		for _, m := range e.Members {
+			zset[m.Member] = m
+		}
+		return zset, nil
+	case "stream":
+		st := newStream()
+		st.entries = slices.Clone(e.Entries)
+		if n := len(st.entries); n > 0 {
+			st.lastID = st.entries[n-1].ID
+		}
+		st.entriesAdded = uint64(len(st.entries))
+		return st, nil
+	}
+	return nil, fmt.Errorf("cannot import value of type %q", e.Type)
+}
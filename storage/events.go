@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the kind of change a KeyEvent reports.
+type EventType int
+
+const (
+	EventCreate EventType = iota + 1 // The key was created
+	EventUpdate                      // The value of an existing key changed
+	EventDelete                      // The key was deleted
+	EventExpire                      // The key was deleted as its expire time passed
+)
+
+var eventTypeNames = [...]string{
+	EventCreate: "create",
+	EventUpdate: "update",
+	EventDelete: "delete",
+	EventExpire: "expire",
+}
+
+func (t EventType) String() string {
+	if t > 0 && int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return "unknown"
+}
+
+// KeyEvent is a change to a key of the dataset.
+type KeyEvent struct {
+	Type EventType
+	Key  string
+}
+
+// keyEvents holds the subscribers to key events. The list is replaced
+// rather than modified, so changes read it without locking.
+type keyEvents struct {
+	mu   sync.Mutex // Serializes Subscribe and cancel
+	subs atomic.Pointer[[]*func(KeyEvent)]
+}
+
+// Subscribe calls f with every change to a key until the returned cancel
+// function is called. Writes to a value report it created or updated,
+// whatever command made them; changes to expire times alone are not
+// reported, but the deletion of a key once it expired is.
+//
+// f is called on the goroutine making the change, once it is made, so it
+// must return quickly and must not call back into the storage; embedders
+// with more work to do hand the event over to a goroutine of their own.
+func (s *Storage) Subscribe(f func(KeyEvent)) (cancel func()) {
+	ke := &s.events
+	sub := &f
+	ke.mu.Lock()
+	defer ke.mu.Unlock()
+	var subs []*func(KeyEvent)
+	if cur := ke.subs.Load(); cur != nil {
+		subs = slices.Clone(*cur)
+	}
+	subs = append(subs, sub)
+	ke.subs.Store(&subs)
+
+	return func() {
+		ke.mu.Lock()
+		defer ke.mu.Unlock()
+		cur := ke.subs.Load()
+		if cur == nil {
+			return
+		}
+		i := slices.Index(*cur, sub)
+		if i < 0 {
+			return
+		}
+		subs := slices.Delete(slices.Clone(*cur), i, i+1)
+		if len(subs) == 0 {
+			ke.subs.Store(nil)
+			return
+		}
+		ke.subs.Store(&subs)
+	}
+}
+
+// notify reports a change to key to the subscribers.
+func (s *Storage) notify(typ EventType, key string) {
+	subs := s.events.subs.Load()
+	if subs == nil {
+		return
+	}
+	e := KeyEvent{Type: typ, Key: key}
+	for _, f := range *subs {
+		(*f)(e)
+	}
+}
+
+// keyChanged records n changes to key, as changed does, and reports them
+// to the subscribers: as a creation unless the key existed before, and not
+// at all if they deleted the key, as delete reported it.
+func (s *Storage) keyChanged(key string, existed bool, n int) {
+	s.changed(n)
+	if n > 0 && s.defrag.enabled.Load() {
+		s.recordPeak(key)
+	}
+	switch {
+	case s.events.subs.Load() == nil:
+	case !existed:
+		s.notify(EventCreate, key)
+	case n > 0:
+		if _, ok := s.shard(key).data.Load(key); ok {
+			s.notify(EventUpdate, key)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// Keys with an expire time are deleted lazily, by the first access after
+// they expired, and actively by ActiveExpireCycle for keys nobody touches.
+
+// ExpireCondition restricts when Expire changes the expire time of a key,
+// as the NX, XX, GT and LT options of EXPIRE do. Conditions combine, as XX
+// and LT do, by or-ing them.
+type ExpireCondition int
+
+const (
+	ExpireAlways ExpireCondition = 0
+	ExpireNX     ExpireCondition = 1 << (iota - 1) // Only if the key has no expire time
+	ExpireXX                                       // Only if the key has an expire time
+	ExpireGT                                       // Only if the new expire time is later
+	ExpireLT                                       // Only if the new expire time is earlier
+)
+
+// SetOptions are the options of SetWithOptions.
+type SetOptions struct {
+	NX       bool      // Only set the key if it does not exist
+	XX       bool      // Only set the key if it exists
+	Get      bool      // Return the old value, which must be a string
+	KeepTTL  bool      // Retain the expire time of the key
+	ExpireAt time.Time // Expire time to set, the zero time for none
+}
+
+// GetExOptions are the options of GetEx: ExpireAt sets the expire time of
+// the key, unless it is the zero time, and Persist removes it.
+type GetExOptions struct {
+	ExpireAt time.Time
+	Persist  bool
+}
+
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+// expireIfNeeded deletes key if its expire time has passed, and reports
+// whether it is gone. The caller holds the lock of key, for reading at
+// least, so no write lands between the check and the delete; of readers
+// finding the key expired together, one deletes it.
+func (s *Storage) expireIfNeeded(key string) bool {
+	sh := s.shard(key)
+	at, ok := sh.expires.Load(key)
+	if !ok || at.(int64) > nowMs() {
+		return false
+	}
+	s.preserveRemoved(key)
+	if _, ok := sh.data.LoadAndDelete(key); !ok {
+		return true
+	}
+	sh.expires.Delete(key)
+	sh.access.Delete(key)
+	s.indexSlot(key)
+	s.changed(1)
+	s.notify(EventExpire, key)
+	return true
+}
+
+// expireKey is expireIfNeeded for callers not holding the lock of key, such
+// as the walks of the keyspace. It takes the lock once the key looks
+// expired, and checks again under it.
+func (s *Storage) expireKey(key string) bool {
+	if at, ok := s.shard(key).expires.Load(key); !ok || at.(int64) > nowMs() {
+		return false
+	}
+	defer s.lockKey(key)()
+	return s.expireIfNeeded(key)
+}
+
+// load loads the value of key for a write, treating expired keys as
+// missing. It preserves the key for the snapshot in progress, as the
+// write is about to change it.
+func (s *Storage) load(key string) (any, bool) {
+	s.expireIfNeeded(key)
+	s.preserve(key)
+	return s.loadValue(key)
+}
+
+// peek loads the value of key for a read, treating expired keys as
+// missing. The key is not preserved: a read leaves it as the snapshot in
+// progress will write it, so reads during a save copy nothing.
+func (s *Storage) peek(key string) (any, bool) {
+	s.expireIfNeeded(key)
+	return s.loadValue(key)
+}
+
+// loadValue loads the value of key, recording the access.
+func (s *Storage) loadValue(key string) (any, bool) {
+	val, ok := s.shard(key).data.Load(key)
+	if ok {
+		s.touch(key)
+	}
+	return val, ok
+}
+
+// loadOrStore loads the value of key, or stores val if the key is missing
+// or expired.
+func (s *Storage) loadOrStore(key string, val Value) (any, bool) {
+	s.expireIfNeeded(key)
+	s.preserve(key)
+	s.touch(key)
+	actual, loaded := s.shard(key).data.LoadOrStore(key, val)
+	if !loaded {
+		s.indexSlot(key)
+	}
+	return actual, loaded
+}
+
+// delete removes key along with its expire time.
+func (s *Storage) delete(key string) {
+	s.preserveRemoved(key)
+	s.shard(key).expires.Delete(key)
+	s.shard(key).access.Delete(key)
+	if _, ok := s.shard(key).data.LoadAndDelete(key); ok {
+		s.indexSlot(key)
+		s.notify(EventDelete, key)
+	}
+}
+
+// deleteIfEmpty deletes key if val, its value, is a list, set, hash or
+// sorted set left without elements, as empty containers are never kept.
+// Every removal from a container ends with it, so EXISTS and the keyspace
+// do not see the key afterwards.
+func (s *Storage) deleteIfEmpty(key string, val Value) {
+	if containerLen(val) == 0 {
+		s.delete(key)
+	}
+}
+
+// containerLen returns the number of elements of a list, set, hash or
+// sorted set value, and -1 for a string or a stream, which stays empty.
+func containerLen(val Value) int {
+	switch val.(type) {
+	case StringValue, StreamValue:
+		return -1
+	}
+	return val.Len()
+}
+
+// ttlRule is what writing a key does to its expire time.
+type ttlRule int
+
+const (
+	ttlClear   ttlRule = iota // The value replaces the key, which no longer expires: SET, GETSET
+	ttlKeep                   // The value changes in place: INCR, DECR, APPEND, SETRANGE, SET KEEPTTL
+	ttlInherit                // The key takes the expire time of the key copied: RENAME, COPY
+)
+
+// write stores val at key, applying rule to the expire time of key. With
+// ttlInherit, src is the key whose expire time is taken; it is ignored
+// otherwise. The caller preserves key beforehand, as load does. The write
+// is recorded as a change.
+func (s *Storage) write(key string, val Value, rule ttlRule, src string) {
+	sh := s.shard(key)
+	_, existed := sh.data.Swap(key, val)
+	if !existed {
+		s.indexSlot(key)
+	}
+	s.touch(key)
+	switch rule {
+	case ttlClear:
+		sh.expires.Delete(key)
+	case ttlInherit:
+		if at, ok := s.shard(src).expires.Load(src); ok {
+			sh.expires.Store(key, at)
+		} else {
+			sh.expires.Delete(key)
+		}
+	}
+	s.keyChanged(key, existed, 1)
+}
+
+// Rename renames src to dst, overwriting dst. The key keeps its expire
+// time, whatever the one of dst was.
+func (s *Storage) Rename(src, dst string) error {
+	defer s.lockKeys(src, dst)()
+	// load preserves a copy of src, as its value lives on at dst.
+	val, ok := s.load(src)
+	if !ok {
+		return errs.NoSuchKey
+	}
+	if src == dst {
+		return nil
+	}
+	s.expireIfNeeded(dst)
+	s.preserveRemoved(dst)
+	s.write(dst, val.(Value), ttlInherit, src)
+	s.delete(src)
+	return nil
+}
+
+// Copy copies the value of src to dst along with its expire time, unless
+// dst exists and replace is false. It reports whether the value was copied.
+func (s *Storage) Copy(src, dst string, replace bool) (bool, error) {
+	if src == dst {
+		return false, errs.SameObject
+	}
+	defer s.lockKeys(src, dst)()
+	val, ok := s.lookupRead(src)
+	if !ok {
+		return false, nil
+	}
+	if _, exists := s.load(dst); exists && !replace {
+		return false, nil
+	}
+	s.write(dst, val.(Value).clone(), ttlInherit, src)
+	return true, nil
+}
+
+// SetWithOptions sets key to value as the SET command does. It returns the
+// old value and whether the key existed, and reports whether the value was
+// written, which the NX and XX conditions may prevent. With Get set, an old
+// value that is not a string is an error and nothing is written.
+func (s *Storage) SetWithOptions(key, value string, opts SetOptions) (string, bool, bool, error) {
+	defer s.lockKey(key)()
+	s.expireIfNeeded(key)
+	s.preserve(key)
+	var old any
+	var exists bool
+	if opts.NX && !opts.Get {
+		// Check and set atomically, which lock implementations rely on.
+		old, exists = s.shard(key).data.LoadOrStore(key, StringValue(value))
+	} else {
+		old, exists = s.shard(key).data.Load(key)
+	}
+	oldStr, isStr := old.(StringValue)
+	if exists && opts.Get && !isStr {
+		return "", false, false, errs.WrongType
+	}
+	switch {
+	case opts.NX && exists, opts.XX && !exists:
+		return string(oldStr), exists, false, nil
+	case opts.NX && opts.Get:
+		if old, exists = s.shard(key).data.LoadOrStore(key, StringValue(value)); exists {
+			oldStr, isStr = old.(StringValue)
+			if !isStr {
+				return "", false, false, errs.WrongType
+			}
+			return string(oldStr), true, false, nil
+		}
+	case !opts.NX:
+		s.shard(key).data.Store(key, StringValue(value))
+	}
+
+	if !opts.ExpireAt.IsZero() {
+		s.shard(key).expires.Store(key, opts.ExpireAt.UnixMilli())
+	} else if !opts.KeepTTL {
+		s.shard(key).expires.Delete(key)
+	}
+	if !exists {
+		s.indexSlot(key)
+	}
+	s.touch(key)
+	s.keyChanged(key, exists, 1)
+	return string(oldStr), exists, true, nil
+}
+
+// GetDel returns the string value of key and deletes the key atomically.
+func (s *Storage) GetDel(key string) (string, bool, error) {
+	defer s.lockKey(key)()
+	for {
+		val, ok, err := stringValue(s.lookupRead(key))
+		if err != nil || !ok {
+			return val, ok, err
+		}
+		s.preserve(key)
+		if s.shard(key).data.CompareAndDelete(key, StringValue(val)) {
+			s.shard(key).expires.Delete(key)
+			s.shard(key).access.Delete(key)
+			s.indexSlot(key)
+			s.changed(1)
+			s.notify(EventDelete, key)
+			return val, true, nil
+		}
+	}
+}
+
+// GetEx returns the string value of key as Get does, and changes its
+// expire time as opts say. An expire time that has already passed deletes
+// the key once its value is read.
+func (s *Storage) GetEx(key string, opts GetExOptions) (string, bool, error) {
+	if err := s.readThrough(key); err != nil {
+		return "", false, err
+	}
+	defer s.lockKey(key)()
+	val, ok, err := stringValue(s.lookupRead(key))
+	if err != nil || !ok {
+		return val, ok, err
+	}
+	switch {
+	case opts.Persist:
+		s.persist(key)
+	case !opts.ExpireAt.IsZero():
+		s.expire(key, opts.ExpireAt, ExpireAlways)
+	}
+	return val, true, nil
+}
+
+// PeekExpireTime returns the expire time of key, if it has one, without
+// accessing the key: it is neither expired nor counted as read.
+func (s *Storage) PeekExpireTime(key string) (time.Time, bool) {
+	ms, ok := s.shard(key).expires.Load(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms.(int64)), true
+}
+
+// Expire sets the expire time of key, subject to cond. It reports whether
+// the expire time was set, which requires the key to exist. An expire time
+// that has already passed deletes the key.
+func (s *Storage) Expire(key string, at time.Time, cond ExpireCondition) bool {
+	defer s.lockKey(key)()
+	return s.expire(key, at, cond)
+}
+
+// expire is Expire, for callers holding the lock of key.
+func (s *Storage) expire(key string, at time.Time, cond ExpireCondition) bool {
+	if _, ok := s.load(key); !ok {
+		return false
+	}
+	ms := at.UnixMilli()
+	cur, volatile := s.shard(key).expires.Load(key)
+	if cond&ExpireNX != 0 && volatile {
+		return false
+	}
+	if cond&ExpireXX != 0 && !volatile {
+		return false
+	}
+	// A key without an expire time never expires, so no time is later.
+	if cond&ExpireGT != 0 && (!volatile || ms <= cur.(int64)) {
+		return false
+	}
+	if cond&ExpireLT != 0 && volatile && ms >= cur.(int64) {
+		return false
+	}
+	if ms <= nowMs() {
+		s.delete(key)
+		s.changed(1)
+		return true
+	}
+	s.shard(key).expires.Store(key, ms)
+	s.changed(1)
+	return true
+}
+
+// ExpireTime returns the expire time of key. volatile reports whether the
+// key has an expire time and exists whether the key exists at all.
+func (s *Storage) ExpireTime(key string) (at time.Time, volatile, exists bool) {
+	defer s.rlockKey(key)()
+	if _, ok := s.lookupRead(key); !ok {
+		return time.Time{}, false, false
+	}
+	ms, ok := s.shard(key).expires.Load(key)
+	if !ok {
+		return time.Time{}, false, true
+	}
+	return time.UnixMilli(ms.(int64)), true, true
+}
+
+// Persist removes the expire time of key, and reports whether it had one.
+func (s *Storage) Persist(key string) bool {
+	defer s.lockKey(key)()
+	return s.persist(key)
+}
+
+// persist is Persist, for callers holding the lock of key.
+func (s *Storage) persist(key string) bool {
+	if _, ok := s.load(key); !ok {
+		return false
+	}
+	_, loaded := s.shard(key).expires.LoadAndDelete(key)
+	if loaded {
+		s.changed(1)
+	}
+	return loaded
+}
+
+// ActiveExpireCycle deletes expired keys that were not accessed since they
+// expired. It samples keys with an expire time and keeps going while more
+// than a quarter of a sample had expired, like Redis does. It returns the
+// number of keys deleted.
+func (s *Storage) ActiveExpireCycle() int {
+	const sampleSize = 20
+	deleted := 0
+	for {
+		sample := s.SampleVolatile(sampleSize)
+		sampled, expired := len(sample), 0
+		for _, key := range sample {
+			unlock := s.lockKey(key)
+			if s.expireIfNeeded(key) {
+				expired++
+			}
+			unlock()
+		}
+		deleted += expired
+		if sampled < sampleSize || expired*4 <= sampled {
+			return deleted
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// TestExpireRacesWrite has readers walk and read a key that keeps expiring
+// while SET replaces it, and checks that the value written is never deleted
+// as the expired one.
+func TestExpireRacesWrite(t *testing.T) {
+	rounds := 2000
+	if testing.Short() {
+		rounds = 200
+	}
+	s := storage.NewStorage()
+	expired := storage.SetOptions{ExpireAt: time.Now().Add(-time.Second)}
+	readers := []func(){
+		func() { s.Get("k") },
+		func() { s.Exists("k") },
+		func() { s.Keys("*") },
+		func() { s.RandomKey() },
+		func() { s.Scan(0, 10, "", "") },
+	}
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for _, read := range readers {
+		wg.Add(1)
+		go func(read func()) {
+			defer wg.Done()
+			for !stop.Load() {
+				read()
+				runtime.Gosched()
+			}
+		}(read)
+	}
+	defer func() {
+		stop.Store(true)
+		wg.Wait()
+	}()
+	for round := 0; round < rounds; round++ {
+		s.SetWithOptions("k", "old", expired)
+		s.Set("k", "new")
+		runtime.Gosched()
+		if val, ok, _ := s.Get("k"); !ok || val != "new" {
+			t.Fatalf("round %d: got %q, %v after SET, want \"new\"", round, val, ok)
+		}
+	}
+}
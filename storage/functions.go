@@ -0,0 +1,31 @@
+package storage
+
+// The code of the function libraries loaded with FUNCTION LOAD is kept with
+// the dataset, so snapshots and rewrites of the append only file save it
+// along with the keys. Compiling and running it is up to the caller.
+
+// Functions returns the code of the function libraries saved with the
+// dataset. The slice must not be modified.
+func (s *Storage) Functions() []string {
+	if code := s.functions.Load(); code != nil {
+		return *code
+	}
+	return nil
+}
+
+// SetFunctions replaces the code of the function libraries saved with the
+// dataset, which counts as one change still to be saved.
+func (s *Storage) SetFunctions(code []string) {
+	s.storeFunctions(code)
+	s.changed(1)
+}
+
+// storeFunctions replaces the code of the function libraries.
+func (s *Storage) storeFunctions(code []string) {
+	if len(code) == 0 {
+		s.functions.Store(nil)
+		return
+	}
+	code = append([]string(nil), code...)
+	s.functions.Store(&code)
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/geohash"
+)
+
+// Geospatial members are the members of a sorted set scored with the
+// geohash of their position, so the sorted set commands work on them as
+// on any other, ZREM removing them.
+
+var errGeoMember = errs.Errorf("could not decode requested zset member")
+
+// GeoLocation is a member of a geospatial index with its position.
+type GeoLocation struct {
+	Member string
+	Lon    float64
+	Lat    float64
+}
+
+// GeoAdd adds locations to the geospatial index at key as ZAddWithOptions
+// adds members.
+func (s *Storage) GeoAdd(key string, opts ZAddOptions, locations ...GeoLocation) (int64, error) {
+	members := make([]ZSetMember, len(locations))
+	for i, loc := range locations {
+		members[i] = ZSetMember{Member: loc.Member, Score: float64(geohash.Encode(loc.Lon, loc.Lat))}
+	}
+	return s.ZAddWithOptions(key, opts, members...)
+}
+
+// loadGeo loads the sorted set at key, nil if the key does not exist.
+func (s *Storage) loadGeo(key string) (ZSetValue, error) {
+	actual, ok := s.lookupRead(key)
+	if !ok {
+		return nil, nil
+	}
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return nil, errs.WrongType
+	}
+	return zset, nil
+}
+
+// GeoHashes returns the geohashes of members in the geospatial index at
+// key, with false for the missing ones.
+func (s *Storage) GeoHashes(key string, members ...string) ([]uint64, []bool, error) {
+	defer s.rlockKey(key)()
+	zset, err := s.loadGeo(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes, found := make([]uint64, len(members)), make([]bool, len(members))
+	for i, member := range members {
+		if m, ok := zset[member]; ok {
+			hashes[i], found[i] = uint64(m.Score), true
+		}
+	}
+	return hashes, found, nil
+}
+
+// GeoDist returns the distance in meters between two members of the
+// geospatial index at key, and false if either is missing.
+func (s *Storage) GeoDist(key, member1, member2 string) (float64, bool, error) {
+	hashes, found, err := s.GeoHashes(key, member1, member2)
+	if err != nil || !found[0] || !found[1] {
+		return 0, false, err
+	}
+	lon1, lat1 := geohash.Decode(hashes[0])
+	lon2, lat2 := geohash.Decode(hashes[1])
+	return geohash.Distance(lon1, lat1, lon2, lat2), true, nil
+}
+
+// GeoQuery is the area and the options of GeoSearch.
+type GeoQuery struct {
+	FromMember string  // The member at the center, unless FromLonLat
+	FromLonLat bool    // The center is Lon, Lat
+	Lon, Lat   float64 // The center with FromLonLat
+	ByBox      bool    // The area is a box of Width by Height, not a circle of Radius
+	Radius     float64 // Meters
+	Width      float64 // Meters
+	Height     float64 // Meters
+	Sort       int     // 1 nearest first, -1 farthest first, 0 in score order
+	Count      int     // The most results, 0 for no limit
+	Any        bool    // Stop at the first Count results found, before sorting
+}
+
+// GeoResult is a member found by GeoSearch.
+type GeoResult struct {
+	GeoLocation
+	Dist float64 // Meters from the center
+	Hash uint64
+}
+
+// GeoSearch returns the members of the geospatial index at key within the
+// area of q. A missing key has no members, but a missing FromMember is an
+// error.
+func (s *Storage) GeoSearch(key string, q GeoQuery) ([]GeoResult, error) {
+	defer s.rlockKey(key)()
+	return s.geoSearch(key, q)
+}
+
+// geoSearch is GeoSearch, for callers holding the lock of key.
+func (s *Storage) geoSearch(key string, q GeoQuery) ([]GeoResult, error) {
+	zset, err := s.loadGeo(key)
+	if err != nil || zset == nil {
+		return nil, err
+	}
+	if !q.FromLonLat {
+		m, ok := zset[q.FromMember]
+		if !ok {
+			return nil, errGeoMember
+		}
+		q.Lon, q.Lat = geohash.Decode(uint64(m.Score))
+	}
+	var results []GeoResult
+	for _, m := range sortedMembers(zset, false) {
+		hash := uint64(m.Score)
+		lon, lat := geohash.Decode(hash)
+		var dist float64
+		if q.ByBox {
+			var ok bool
+			if dist, ok = geohash.InBox(q.Lon, q.Lat, q.Width, q.Height, lon, lat); !ok {
+				continue
+			}
+		} else if dist = geohash.Distance(q.Lon, q.Lat, lon, lat); dist > q.Radius {
+			continue
+		}
+		results = append(results, GeoResult{GeoLocation: GeoLocation{Member: m.Member, Lon: lon, Lat: lat}, Dist: dist, Hash: hash})
+		if q.Any && len(results) == q.Count {
+			break
+		}
+	}
+	if q.Sort != 0 {
+		sort.SliceStable(results, func(i, j int) bool {
+			if q.Sort < 0 {
+				return results[i].Dist > results[j].Dist
+			}
+			return results[i].Dist < results[j].Dist
+		})
+	}
+	if q.Count > 0 && len(results) > q.Count {
+		results = results[:q.Count]
+	}
+	return results, nil
+}
+
+// GeoSearchStore stores at dst the members GeoSearch finds, as a sorted
+// set scored with their geohashes, or with their distances from the center
+// in units of unit meters when storeDist is set, and returns their number.
+// dst loses its expire time, and is deleted when nothing is found.
+func (s *Storage) GeoSearchStore(dst, key string, q GeoQuery, storeDist bool, unit float64) (int64, error) {
+	defer s.lockKeys(dst, key)()
+	results, err := s.geoSearch(key, q)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		if _, ok := s.load(dst); ok {
+			s.delete(dst)
+			s.changed(1)
+		}
+		return 0, nil
+	}
+	zset := make(ZSetValue, len(results))
+	for _, r := range results {
+		score := float64(r.Hash)
+		if storeDist {
+			score = r.Dist / unit
+		}
+		zset[r.Member] = ZSetMember{Member: r.Member, Score: score}
+	}
+	s.expireIfNeeded(dst)
+	s.preserveRemoved(dst)
+	s.write(dst, zset, ttlClear, "")
+	return int64(len(zset)), nil
+}
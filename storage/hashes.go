@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// HSet sets the string values of hash fields, given as field and value
+// pairs, and returns the number of fields added.
+// If a field already exists in the hash, it is overwritten.
+func (s *Storage) HSet(key string, pairs ...string) (int64, error) {
+	defer s.lockKey(key)()
+	actual, loaded := s.loadOrStore(key, HashValue{})
+	hash, ok := actual.(HashValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+
+	added := int64(0)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if _, fieldExists := hash[pairs[i]]; !fieldExists {
+			added++
+		}
+		hash[pairs[i]] = pairs[i+1]
+	}
+	s.keyChanged(key, loaded, len(pairs)/2)
+	return added, nil
+}
+
+// HGet returns the value associated with field in the hash stored at key.
+// The boolean reports whether the field exists. A missing key is first
+// loaded by its loader, if any.
+func (s *Storage) HGet(key, field string) (string, bool, error) {
+	if err := s.readThrough(key); err != nil {
+		return "", false, err
+	}
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		hash, ok := actual.(HashValue)
+		if !ok {
+			return "", false, errs.WrongType
+		}
+		if val, found := hash[field]; found {
+			return val, true, nil
+		}
+		return "", false, nil // Field not found
+	}
+	return "", false, nil // Key not found
+}
+
+// HDel deletes one or more hash fields from the hash stored at key.
+func (s *Storage) HDel(key string, fields ...string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		hash, ok := actual.(HashValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		deletedCount := int64(0)
+		for _, field := range fields {
+			if _, found := hash[field]; found {
+				delete(hash, field)
+				deletedCount++
+			}
+		}
+		s.deleteIfEmpty(key, hash)
+		s.keyChanged(key, true, int(deletedCount))
+		return deletedCount, nil
+	}
+	return 0, nil // Key not found, so no fields deleted
+}
+
+// HExists returns if field is an existing field in the hash stored at key.
+func (s *Storage) HExists(key, field string) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		hash, ok := actual.(HashValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+		if _, found := hash[field]; found {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, nil // Key not found
+}
+
+// HLen returns the number of fields contained in the hash at key.
+func (s *Storage) HLen(key string) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		hash, ok := actual.(HashValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+		return int64(len(hash)), nil
+	}
+	return 0, nil // Key not found, length is 0
+}
+
+// HGetAll returns all fields and values of the hash stored at key, each
+// field followed by its value, in the order of the fields. It is a copy
+// taken under the key lock, so concurrent writes are either all or not at
+// all part of it.
+func (s *Storage) HGetAll(key string) ([]string, error) {
+	unlock := s.rlockKey(key)
+	actual, ok := s.lookupRead(key)
+	if !ok {
+		unlock()
+		return []string{}, nil // Key not found, return empty list
+	}
+	hash, ok := actual.(HashValue)
+	if !ok {
+		unlock()
+		return nil, errs.WrongType
+	}
+	snapshot := maps.Clone(hash)
+	unlock()
+
+	fields := make([]string, 0, len(snapshot))
+	for field := range snapshot {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	result := make([]string, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, field, snapshot[field])
+	}
+	return result, nil
+}
@@ -0,0 +1,34 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// TestHashes checks the hash commands on missing keys, keys of another type
+// and hashes, and that a hash is deleted with its last field.
+func TestHashes(t *testing.T) {
+	str := func(s *storage.Storage) { s.Set("k", "v") }
+	hash := func(s *storage.Storage) { s.HSet("k", "b", "2", "a", "1") }
+	runCases(t, []storageCase{
+		wrongType("HSET on a string", str, func(s *storage.Storage) (any, error) { return s.HSet("k", "f", "v") }),
+		wrongType("HGET on a string", str, func(s *storage.Storage) (any, error) { return found(s.HGet("k", "f")) }),
+		wrongType("HDEL on a string", str, func(s *storage.Storage) (any, error) { return s.HDel("k", "f") }),
+		wrongType("HEXISTS on a string", str, func(s *storage.Storage) (any, error) { return s.HExists("k", "f") }),
+		wrongType("HLEN on a string", str, func(s *storage.Storage) (any, error) { return s.HLen("k") }),
+		wrongType("HGETALL on a string", str, func(s *storage.Storage) (any, error) { return s.HGetAll("k") }),
+
+		{name: "HGET of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.HGet("k", "f")) }, want: []any{"", false}},
+		{name: "HDEL from a missing key", op: func(s *storage.Storage) (any, error) { return s.HDel("k", "f") }, want: int64(0)},
+		{name: "HEXISTS of a missing key", op: func(s *storage.Storage) (any, error) { return s.HExists("k", "f") }, want: int64(0)},
+		{name: "HLEN of a missing key", op: func(s *storage.Storage) (any, error) { return s.HLen("k") }, want: int64(0)},
+		{name: "HGETALL of a missing key", op: func(s *storage.Storage) (any, error) { return s.HGetAll("k") }, want: []string{}},
+
+		{name: "HSET counts new fields only", setup: hash, op: func(s *storage.Storage) (any, error) { return s.HSet("k", "a", "3", "c", "4") }, want: int64(1)},
+		{name: "HGET of a missing field", setup: hash, op: func(s *storage.Storage) (any, error) { return found(s.HGet("k", "x")) }, want: []any{"", false}},
+		{name: "HGETALL in the order of the fields", setup: hash, op: func(s *storage.Storage) (any, error) { return s.HGetAll("k") }, want: []string{"a", "1", "b", "2"}},
+
+		{name: "HDEL of every field", setup: hash, op: func(s *storage.Storage) (any, error) { return s.HDel("k", "a", "b", "c") }, want: int64(2), gone: "k"},
+	})
+}
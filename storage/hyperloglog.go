@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/internal/hll"
+)
+
+var (
+	errNotHLL     = errs.New("WRONGTYPE", "Key is not a valid HyperLogLog string value.")
+	errInvalidHLL = errs.New("INVALIDOBJ", "Corrupted HLL object detected")
+)
+
+// loadHLL loads the HyperLogLog at key as a copy the caller may change,
+// nil if the key does not exist. The caller holds the lock of key.
+func (s *Storage) loadHLL(key string) ([]byte, error) {
+	str, ok, err := stringValue(s.load(key))
+	if err != nil || !ok {
+		return nil, err
+	}
+	if !hll.Valid(str) {
+		return nil, errNotHLL
+	}
+	return []byte(str), nil
+}
+
+// PFAdd adds elems to the HyperLogLog at key, creating it if it does not
+// exist, and reports whether it changed: a register was raised or the key
+// was created.
+func (s *Storage) PFAdd(key string, elems ...string) (bool, error) {
+	defer s.lockKey(key)()
+	b, err := s.loadHLL(key)
+	if err != nil {
+		return false, err
+	}
+	updated := b == nil
+	if updated {
+		b = hll.New()
+	}
+	for _, elem := range elems {
+		var changed bool
+		if b, changed, err = hll.Add(b, elem); err != nil {
+			return false, errInvalidHLL
+		}
+		updated = updated || changed
+	}
+	if updated {
+		hll.Invalidate(b)
+		s.write(key, StringValue(b), ttlKeep, "")
+	}
+	return updated, nil
+}
+
+// PFCount returns the estimated cardinality of the union of the
+// HyperLogLogs at keys, missing keys counting as empty ones. The
+// cardinality of a single key is cached in its header, which changes the
+// value when the cached one was stale.
+func (s *Storage) PFCount(keys ...string) (int64, error) {
+	if len(keys) > 1 {
+		regs := make([]uint8, hll.Registers)
+		for _, key := range keys {
+			unlock := s.rlockKey(key)
+			str, ok, err := stringValue(s.lookupRead(key))
+			unlock()
+			if err != nil {
+				return 0, err
+			}
+			if ok && !hll.Valid(str) {
+				return 0, errNotHLL
+			}
+			if ok && hll.Merge(regs, []byte(str)) != nil {
+				return 0, errInvalidHLL
+			}
+		}
+		return int64(hll.Estimate(regs)), nil
+	}
+	key := keys[0]
+	defer s.lockKey(key)()
+	b, err := s.loadHLL(key)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	if card, ok := hll.Cached(b); ok {
+		return int64(card), nil
+	}
+	card, err := hll.Count(b)
+	if err != nil {
+		return 0, errInvalidHLL
+	}
+	hll.SetCached(b, card)
+	s.write(key, StringValue(b), ttlKeep, "")
+	return int64(card), nil
+}
+
+// PFMerge stores at dst the union of the HyperLogLogs at dst and srcs,
+// missing keys counting as empty ones. The result is dense if any of them
+// is, sparse otherwise, as long as it fits.
+func (s *Storage) PFMerge(dst string, srcs ...string) error {
+	regs := make([]uint8, hll.Registers)
+	toDense := false
+	for _, key := range append([]string{dst}, srcs...) {
+		unlock := s.rlockKey(key)
+		str, ok, err := stringValue(s.lookupRead(key))
+		unlock()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if !hll.Valid(str) {
+			return errNotHLL
+		}
+		b := []byte(str)
+		toDense = toDense || !hll.IsSparse(b)
+		if hll.Merge(regs, b) != nil {
+			return errInvalidHLL
+		}
+	}
+	defer s.lockKey(dst)()
+	b, err := s.loadHLL(dst)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		b = hll.New()
+	}
+	if toDense {
+		if b, err = hll.ToDense(b); err != nil {
+			return errInvalidHLL
+		}
+	}
+	if b, err = hll.Store(b, regs); err != nil {
+		return errInvalidHLL
+	}
+	hll.Invalidate(b)
+	s.write(dst, StringValue(b), ttlKeep, "")
+	return nil
+}
+
+// PFDebugGetReg returns the registers of the HyperLogLog at key, which is
+// converted to dense first, as PFDEBUG GETREG does, and reports whether it
+// was sparse. A missing key is an error.
+func (s *Storage) PFDebugGetReg(key string) ([]uint8, bool, error) {
+	defer s.lockKey(key)()
+	b, err := s.loadPFDebug(key)
+	if err != nil {
+		return nil, false, err
+	}
+	sparse := hll.IsSparse(b)
+	if b, err = s.toDenseHLL(key, b); err != nil {
+		return nil, false, err
+	}
+	regs, err := hll.Load(b)
+	return regs, sparse, err
+}
+
+// PFDebugToDense converts the HyperLogLog at key to dense and reports
+// whether it was sparse.
+func (s *Storage) PFDebugToDense(key string) (bool, error) {
+	defer s.lockKey(key)()
+	b, err := s.loadPFDebug(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.toDenseHLL(key, b)
+	return hll.IsSparse(b), err
+}
+
+// toDenseHLL converts b, the HyperLogLog at key, to dense if it is sparse,
+// and returns it. The caller holds the lock of key.
+func (s *Storage) toDenseHLL(key string, b []byte) ([]byte, error) {
+	if !hll.IsSparse(b) {
+		return b, nil
+	}
+	d, err := hll.ToDense(b)
+	if err != nil {
+		return nil, errInvalidHLL
+	}
+	s.write(key, StringValue(d), ttlKeep, "")
+	return d, nil
+}
+
+// PFDebugEncoding returns the encoding of the HyperLogLog at key, sparse
+// or dense.
+func (s *Storage) PFDebugEncoding(key string) (string, error) {
+	defer s.rlockKey(key)()
+	b, err := s.loadPFDebug(key)
+	if err != nil {
+		return "", err
+	}
+	if hll.IsSparse(b) {
+		return "sparse", nil
+	}
+	return "dense", nil
+}
+
+// PFDebugDecode describes the opcodes of the sparse HyperLogLog at key.
+func (s *Storage) PFDebugDecode(key string) (string, error) {
+	defer s.rlockKey(key)()
+	b, err := s.loadPFDebug(key)
+	if err != nil {
+		return "", err
+	}
+	if !hll.IsSparse(b) {
+		return "", errs.Errorf("HLL encoding is not sparse")
+	}
+	decoded, err := hll.Decode(b)
+	if err != nil {
+		return "", errInvalidHLL
+	}
+	return decoded, nil
+}
+
+// loadPFDebug loads the HyperLogLog at key for PFDEBUG, for which a
+// missing key is an error. The caller holds the lock of key.
+func (s *Storage) loadPFDebug(key string) ([]byte, error) {
+	b, err := s.loadHLL(key)
+	if err == nil && b == nil {
+		err = errs.Errorf("The specified key does not exist")
+	}
+	return b, err
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lruResolution is how often the LRU clock advances.
+const lruResolution = 100 * time.Millisecond
+
+// The LRU clock is the time, in Unix milliseconds, accesses to keys are
+// stamped with. A goroutine started with the first reading advances it
+// every lruResolution, so stamping an access loads an atomic rather than
+// asking the system for the time.
+var (
+	lruClockNow   atomic.Int64
+	lruClockStart sync.Once
+)
+
+// lruClock returns the LRU clock.
+func lruClock() int64 {
+	lruClockStart.Do(func() {
+		lruClockNow.Store(time.Now().UnixMilli())
+		go func() {
+			for now := range time.Tick(lruResolution) {
+				lruClockNow.Store(now.UnixMilli())
+			}
+		}()
+	})
+	return lruClockNow.Load()
+}
+
+// touch records an access to key, by a read or a write. Each key has its
+// own stamp, created on its first access and then updated in place, so
+// later accesses neither lock nor allocate, and only write the stamp when
+// the clock advanced. Views from WithoutTouch record nothing.
+func (s *Storage) touch(key string) {
+	if s.noTouch {
+		return
+	}
+	now := lruClock()
+	sh := s.shard(key)
+	if v, ok := sh.access.Load(key); ok {
+		if stamp := v.(*atomic.Int64); stamp.Load() != now {
+			stamp.Store(now)
+		}
+		return
+	}
+	stamp := new(atomic.Int64)
+	stamp.Store(now)
+	if v, loaded := sh.access.LoadOrStore(key, stamp); loaded {
+		v.(*atomic.Int64).Store(now)
+	}
+}
+
+// idleSince returns the milliseconds since the last access to key, which
+// is in shard sh, at LRU clock now. Keys never accessed since they were
+// loaded count from then.
+func idleSince(sh *shard, key string, now int64) int64 {
+	v, ok := sh.access.Load(key)
+	if !ok {
+		return 0
+	}
+	return max(now-v.(*atomic.Int64).Load(), 0)
+}
+
+// IdleTime returns the time since key was last read or written, and
+// reports whether it exists. It does not count as an access itself.
+func (s *Storage) IdleTime(key string) (time.Duration, bool) {
+	defer s.rlockKey(key)()
+	if s.expireIfNeeded(key) {
+		return 0, false
+	}
+	sh := s.shard(key)
+	if _, ok := sh.data.Load(key); !ok {
+		return 0, false
+	}
+	return time.Duration(idleSince(sh, key, lruClock())) * time.Millisecond, true
+}
+
+// IdleKey is a key found by ColdKeys, with the time since its last access.
+type IdleKey struct {
+	Key  string
+	Idle time.Duration
+}
+
+// ColdKeys samples up to samples keys, starting from a random shard, and
+// returns those not accessed for at least minIdle, the idlest first. The
+// scan itself does not count as an access.
+func (s *Storage) ColdKeys(minIdle time.Duration, samples int) []IdleKey {
+	now, nowMillis := lruClock(), nowMs()
+	minMillis := minIdle.Milliseconds()
+	cold := []IdleKey{}
+	start := rand.Intn(numShards)
+	for n := 0; n < numShards && samples > 0; n++ {
+		sh := &s.shards[(start+n)%numShards]
+		sh.data.Range(func(k, _ any) bool {
+			key := k.(string)
+			if at, ok := sh.expires.Load(key); ok && at.(int64) <= nowMillis {
+				return true
+			}
+			samples--
+			if idle := idleSince(sh, key, now); idle >= minMillis {
+				cold = append(cold, IdleKey{Key: key, Idle: time.Duration(idle) * time.Millisecond})
+			}
+			return samples > 0
+		})
+	}
+	slices.SortFunc(cold, func(a, b IdleKey) int {
+		return cmp.Or(cmp.Compare(b.Idle, a.Idle), cmp.Compare(a.Key, b.Key))
+	})
+	return cold
+}
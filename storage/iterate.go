@@ -0,0 +1,62 @@
+package storage
+
+import "math/rand"
+
+// The iteration primitives below walk the shards one at a time, through
+// the lock-free Range of their maps, so they hold no lock while calling
+// back and never stop writers for the whole walk. Keys added or deleted
+// during a walk may or may not be visited; a key visited is never visited
+// twice. None of them counts as an access to the keys.
+
+// ForEach calls f with each key that has not expired, shard by shard,
+// until f returns false. Expired keys met on the way are deleted rather
+// than visited. f may read or write any key, the one visited included.
+func (s *Storage) ForEach(f func(key string) bool) {
+	for i := range s.shards {
+		more := true
+		s.shards[i].data.Range(func(k, _ any) bool {
+			key := k.(string)
+			if s.expireKey(key) {
+				return true
+			}
+			more = f(key)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// RandomKey returns a random key that has not expired, and reports whether
+// there is one. It starts at a random shard, from the random position the
+// iteration of its map starts at, so it is cheap but not uniform. Expired
+// keys met on the way are deleted.
+func (s *Storage) RandomKey() (string, bool) {
+	var key string
+	found := false
+	start := rand.Intn(numShards)
+	for i := 0; i < numShards && !found; i++ {
+		s.shards[(start+i)%numShards].data.Range(func(k, _ any) bool {
+			key = k.(string)
+			found = !s.expireKey(key)
+			return !found
+		})
+	}
+	return key, found
+}
+
+// SampleVolatile returns up to n keys with an expire time, expired or not,
+// starting at a random shard, for active expiry to check. It returns fewer
+// only if there are fewer such keys.
+func (s *Storage) SampleVolatile(n int) []string {
+	keys := make([]string, 0, n)
+	start := rand.Intn(numShards)
+	for i := 0; i < numShards && len(keys) < n; i++ {
+		s.shards[(start+i)%numShards].expires.Range(func(k, _ any) bool {
+			keys = append(keys, k.(string))
+			return len(keys) < n
+		})
+	}
+	return keys
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/liweiyuan/go-redis-server/internal/glob"
+)
+
+// Del deletes one or more keys from the storage.
+func (s *Storage) Del(keys ...string) int {
+	count := 0
+	for _, key := range keys {
+		unlock := s.lockKey(key)
+		s.expireIfNeeded(key)
+		s.preserveRemoved(key)
+		if _, loaded := s.shard(key).data.LoadAndDelete(key); loaded {
+			s.shard(key).expires.Delete(key)
+			s.shard(key).access.Delete(key)
+			s.indexSlot(key)
+			count++
+			s.notify(EventDelete, key)
+		}
+		unlock()
+	}
+	s.changed(count)
+	return count
+}
+
+// Exists checks if one or more keys exist in the storage.
+func (s *Storage) Exists(keys ...string) int {
+	count := 0
+	for _, key := range keys {
+		unlock := s.rlockKey(key)
+		if _, ok := s.lookupRead(key); ok {
+			count++
+		}
+		unlock()
+	}
+	return count
+}
+
+// Type returns the type of the value stored at key, such as "string" or
+// "zset", or "none" if the key does not exist.
+func (s *Storage) Type(key string) string {
+	defer s.rlockKey(key)()
+	val, ok := s.lookupRead(key)
+	if !ok {
+		return "none"
+	}
+	return val.(Value).Type()
+}
+
+// Keys returns the keys matching the glob-style pattern, in sorted order.
+func (s *Storage) Keys(pattern string) []string {
+	keys := []string{}
+	s.ForEach(func(key string) bool {
+		if glob.Match(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,148 @@
+package storage_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// storageCase runs an operation on a storage prepared by setup, and
+// expects it to return want and err. If gone is set, key must no longer
+// exist afterwards.
+type storageCase struct {
+	name  string
+	setup func(s *storage.Storage)
+	op    func(s *storage.Storage) (any, error)
+	want  any
+	err   error
+	gone  string
+}
+
+// runCases runs each case on a new storage.
+func runCases(t *testing.T, cases []storageCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := storage.NewStorage()
+			if tc.setup != nil {
+				tc.setup(s)
+			}
+			got, err := tc.op(s)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if tc.err == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+			if tc.gone != "" && s.Exists(tc.gone) != 0 {
+				t.Errorf("%s still exists", tc.gone)
+			}
+		})
+	}
+}
+
+// wrongType returns a case running op on a key holding a value of another
+// type, set up by setup, which must fail with WRONGTYPE.
+func wrongType(name string, setup func(s *storage.Storage), op func(s *storage.Storage) (any, error)) storageCase {
+	return storageCase{name: name, setup: setup, op: op, err: errs.WrongType}
+}
+
+// found returns the value and found flag of a lookup as one result.
+func found[T any](v T, ok bool, err error) (any, error) {
+	return []any{v, ok}, err
+}
+
+// TestKeys checks the commands working on keys of any type.
+func TestKeys(t *testing.T) {
+	runCases(t, []storageCase{
+		{
+			name:  "DEL counts the keys deleted",
+			setup: func(s *storage.Storage) { s.Set("a", "1"); s.SAdd("b", "x") },
+			op:    func(s *storage.Storage) (any, error) { return s.Del("a", "b", "c"), nil },
+			want:  2,
+			gone:  "b",
+		},
+		{
+			name:  "EXISTS counts a key each time it is given",
+			setup: func(s *storage.Storage) { s.Set("a", "1") },
+			op:    func(s *storage.Storage) (any, error) { return s.Exists("a", "a", "missing"), nil },
+			want:  2,
+		},
+		{
+			name: "EXISTS skips an expired key",
+			setup: func(s *storage.Storage) {
+				s.SetWithOptions("a", "1", storage.SetOptions{ExpireAt: time.Now().Add(-time.Second)})
+			},
+			op:   func(s *storage.Storage) (any, error) { return s.Exists("a"), nil },
+			want: 0,
+		},
+		{
+			name:  "KEYS matches keys of every type in order",
+			setup: func(s *storage.Storage) { s.Set("k2", "v"); s.RPush("k1", "a"); s.HSet("other", "f", "v") },
+			op:    func(s *storage.Storage) (any, error) { return s.Keys("k*"), nil },
+			want:  []string{"k1", "k2"},
+		},
+		{
+			name: "KEYS on an empty storage",
+			op:   func(s *storage.Storage) (any, error) { return s.Keys("*"), nil },
+			want: []string{},
+		},
+		{
+			name: "TYPE of a missing key",
+			op:   func(s *storage.Storage) (any, error) { return s.Type("a"), nil },
+			want: "none",
+		},
+		{
+			name: "TYPE of each type",
+			setup: func(s *storage.Storage) {
+				s.Set("a", "1")
+				s.RPush("b", "x")
+				s.SAdd("c", "x")
+				s.HSet("d", "f", "v")
+				s.ZAdd("e", storage.ZSetMember{Member: "x"})
+			},
+			op: func(s *storage.Storage) (any, error) {
+				return []string{s.Type("a"), s.Type("b"), s.Type("c"), s.Type("d"), s.Type("e")}, nil
+			},
+			want: []string{"string", "list", "set", "hash", "zset"},
+		},
+		{
+			name:  "TYPE of an emptied container",
+			setup: func(s *storage.Storage) { s.RPush("a", "x"); s.LPop("a") },
+			op:    func(s *storage.Storage) (any, error) { return s.Type("a"), nil },
+			want:  "none",
+		},
+		{
+			name: "RENAME of a missing key",
+			op:   func(s *storage.Storage) (any, error) { return nil, s.Rename("a", "b") },
+			err:  errs.NoSuchKey,
+		},
+		{
+			name:  "RENAME moves the value",
+			setup: func(s *storage.Storage) { s.SAdd("a", "x") },
+			op: func(s *storage.Storage) (any, error) {
+				if err := s.Rename("a", "b"); err != nil {
+					return nil, err
+				}
+				return s.SMembers("b")
+			},
+			want: []string{"x"},
+			gone: "a",
+		},
+		{
+			name: "COPY of a missing key",
+			op:   func(s *storage.Storage) (any, error) { return s.Copy("a", "b", false) },
+			want: false,
+		},
+		{
+			name:  "COPY onto itself",
+			setup: func(s *storage.Storage) { s.Set("a", "1") },
+			op:    func(s *storage.Storage) (any, error) { return s.Copy("a", "a", true) },
+			err:   errs.SameObject,
+		},
+	})
+}
@@ -0,0 +1,375 @@
+package storage
+
+import "github.com/liweiyuan/go-redis-server/internal/errs"
+
+// LPush prepends one or multiple values to a list.
+func (s *Storage) LPush(key string, values ...string) (int64, error) {
+	defer s.lockKey(key)()
+	actual, loaded := s.loadOrStore(key, newList())
+	lst, ok := actual.(ListValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+
+	for _, val := range values {
+		lst.PushFront(val)
+	}
+	s.keyChanged(key, loaded, len(values))
+	return int64(lst.Len()), nil
+}
+
+// RPush appends one or multiple values to a list.
+func (s *Storage) RPush(key string, values ...string) (int64, error) {
+	defer s.lockKey(key)()
+	actual, loaded := s.loadOrStore(key, newList())
+	lst, ok := actual.(ListValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+
+	for _, val := range values {
+		lst.PushBack(val)
+	}
+	s.keyChanged(key, loaded, len(values))
+	return int64(lst.Len()), nil
+}
+
+// LPop removes and returns the first element of the list stored at key.
+// The boolean reports whether an element was popped.
+func (s *Storage) LPop(key string) (string, bool, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return "", false, errs.WrongType
+		}
+		if lst.Len() == 0 {
+			return "", false, nil // List is empty
+		}
+		elem := lst.Remove(lst.Front())
+		s.deleteIfEmpty(key, lst)
+		s.keyChanged(key, true, 1)
+		return elem.(string), true, nil
+	}
+	return "", false, nil // Key not found
+}
+
+// RPop removes and returns the last element of the list stored at key.
+// The boolean reports whether an element was popped.
+func (s *Storage) RPop(key string) (string, bool, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return "", false, errs.WrongType
+		}
+		if lst.Len() == 0 {
+			return "", false, nil // List is empty
+		}
+		elem := lst.Remove(lst.Back())
+		s.deleteIfEmpty(key, lst)
+		s.keyChanged(key, true, 1)
+		return elem.(string), true, nil
+	}
+	return "", false, nil // Key not found
+}
+
+// LLen returns the length of the list stored at key.
+func (s *Storage) LLen(key string) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+		return int64(lst.Len()), nil
+	}
+	return 0, nil // Key not found, length is 0
+}
+
+// LIndex returns the element at index from the list stored at key.
+// The index is zero-based, so 0 means the first element, 1 the second element and so on.
+// Negative indices can be used to designate elements starting at the tail of the list.
+// Here, -1 means the last element, -2 means the penultimate and so on.
+// The boolean reports whether an element exists at index.
+func (s *Storage) LIndex(key string, index int64) (string, bool, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return "", false, errs.WrongType
+		}
+
+		if lst.Len() == 0 {
+			return "", false, nil // List is empty
+		}
+
+		// Adjust negative index
+		if index < 0 {
+			index = int64(lst.Len()) + index
+		}
+
+		if index < 0 || index >= int64(lst.Len()) {
+			return "", false, nil // Index out of range
+		}
+
+		elem := lst.Front()
+		for i := int64(0); i < index; i++ {
+			elem = elem.Next()
+		}
+		return elem.Value.(string), true, nil
+	}
+	return "", false, nil // Key not found
+}
+
+// LSet sets the list element at index to value.
+// An error is returned when the key is not a list or the index is out of range.
+func (s *Storage) LSet(key string, index int64, value string) error {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return errs.WrongType
+		}
+
+		// Adjust negative index
+		if index < 0 {
+			index = int64(lst.Len()) + index
+		}
+
+		if index < 0 || index >= int64(lst.Len()) {
+			return errs.OutOfRange
+		}
+
+		elem := lst.Front()
+		for i := int64(0); i < index; i++ {
+			elem = elem.Next()
+		}
+		elem.Value = value
+		s.keyChanged(key, true, 1)
+		return nil
+	}
+	return errs.NoSuchKey
+}
+
+// LRem removes the first count occurrences of elements equal to value from the list stored at key.
+// The count argument influences the operation in the following ways:
+// count > 0: Remove elements equal to value moving from head to tail.
+// count < 0: Remove elements equal to value moving from tail to head.
+// count = 0: Remove all elements equal to value.
+func (s *Storage) LRem(key string, count int64, value string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		removed := int64(0)
+		if count == 0 {
+			// Remove all occurrences
+			for e := lst.Front(); e != nil; {
+				next := e.Next()
+				if e.Value.(string) == value {
+					lst.Remove(e)
+					removed++
+				}
+				e = next
+			}
+		} else if count > 0 {
+			// Remove from head to tail
+			for e := lst.Front(); e != nil && removed < count; {
+				next := e.Next()
+				if e.Value.(string) == value {
+					lst.Remove(e)
+					removed++
+				}
+				e = next
+			}
+		} else { // count < 0
+			// Remove from tail to head
+			count = -count // Make count positive for iteration
+			for e := lst.Back(); e != nil && removed < count; {
+				prev := e.Prev()
+				if e.Value.(string) == value {
+					lst.Remove(e)
+					removed++
+				}
+				e = prev
+			}
+		}
+		s.deleteIfEmpty(key, lst)
+		s.keyChanged(key, true, int(removed))
+		return removed, nil
+	}
+	return 0, nil // Key not found
+}
+
+// LPushX prepends one or multiple values to a list only if the key already exists and holds a list.
+// An existing key of another type is an error, as for LPush.
+func (s *Storage) LPushX(key string, values ...string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		for _, val := range values {
+			lst.PushFront(val)
+		}
+		s.keyChanged(key, true, len(values))
+		return int64(lst.Len()), nil
+	}
+	return 0, nil // Key not found, return 0 as per Redis behavior
+}
+
+// RPushX appends one or multiple values to a list only if the key already exists and holds a list.
+func (s *Storage) RPushX(key string, values ...string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		for _, val := range values {
+			lst.PushBack(val)
+		}
+		s.keyChanged(key, true, len(values))
+		return int64(lst.Len()), nil
+	}
+	return 0, nil // Key not found, return 0 as per Redis behavior
+}
+
+// LInsert inserts an element before or after a pivot element in the list,
+// and returns the length of the list: -1 when the pivot is not found, and
+// 0 when the key does not exist.
+func (s *Storage) LInsert(key, position, pivot, value string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		found := false
+		for e := lst.Front(); e != nil; e = e.Next() {
+			if e.Value.(string) == pivot {
+				if position == "BEFORE" {
+					lst.InsertBefore(value, e)
+				} else if position == "AFTER" {
+					lst.InsertAfter(value, e)
+				}
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return -1, nil // Pivot not found
+		}
+		s.keyChanged(key, true, 1)
+		return int64(lst.Len()), nil
+	}
+	return 0, nil // Key not found
+}
+
+// LRange returns the specified elements of the list stored at key.
+// The offsets start and stop are zero-based indexes.
+// Negative indices can be used to designate elements starting at the tail of the list.
+func (s *Storage) LRange(key string, start, stop int64) ([]string, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return nil, errs.WrongType
+		}
+
+		length := int64(lst.Len())
+
+		// Adjust negative indices
+		if start < 0 {
+			start = length + start
+		}
+		if stop < 0 {
+			stop = length + stop
+		}
+
+		// Handle out of bounds indices
+		if start < 0 {
+			start = 0
+		}
+		if stop >= length {
+			stop = length - 1
+		}
+
+		if start > stop || length == 0 {
+			return []string{}, nil // Empty list or invalid range
+		}
+
+		var result []string
+		elem := lst.Front()
+		for i := int64(0); i < start; i++ {
+			elem = elem.Next()
+		}
+
+		for i := start; i <= stop && elem != nil; i++ {
+			result = append(result, elem.Value.(string))
+			elem = elem.Next()
+		}
+		return result, nil
+	}
+	return []string{}, nil // Key not found, return empty list
+}
+
+// LTrim trims a list to the specified range of elements.
+// The offsets start and stop are zero-based indexes.
+// Negative indices can be used to designate elements starting at the tail of the list.
+func (s *Storage) LTrim(key string, start, stop int64) error {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		lst, ok := actual.(ListValue)
+		if !ok {
+			return errs.WrongType
+		}
+
+		length := int64(lst.Len())
+
+		// Adjust negative indices
+		if start < 0 {
+			start = length + start
+		}
+		if stop < 0 {
+			stop = length + stop
+		}
+
+		// Handle out of bounds indices
+		if start < 0 {
+			start = 0
+		}
+		if stop >= length {
+			stop = length - 1
+		}
+
+		// If the start index is greater than the stop index, or the list is empty,
+		// or the effective range is empty, the list is emptied.
+		if start > stop || length == 0 || start >= length {
+			lst.Init()
+		} else {
+			// Remove elements before the start index
+			for i := int64(0); i < start; i++ {
+				lst.Remove(lst.Front())
+			}
+
+			// Remove elements after the stop index
+			for i := int64(0); i < length-(stop+1); i++ {
+				lst.Remove(lst.Back())
+			}
+		}
+		s.deleteIfEmpty(key, lst)
+		s.keyChanged(key, true, 1)
+		return nil
+	}
+	return nil // Key not found, no operation needed
+}
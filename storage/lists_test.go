@@ -0,0 +1,104 @@
+package storage_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func listElements(n int) []string {
+	elements := make([]string, n)
+	for i := range elements {
+		elements[i] = strconv.Itoa(i)
+	}
+	return elements
+}
+
+// BenchmarkLPush pushes elements to a list of size elements, trimmed back
+// to that size as it doubles.
+func BenchmarkLPush(b *testing.B) {
+	runSizes(b, []int{10, 1000, 100000}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		s.LPush("list", listElements(size)...)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			n, err := s.LPush("list", "element")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if n >= int64(2*size) {
+				b.StopTimer()
+				s.LTrim("list", 0, int64(size-1))
+				b.StartTimer()
+			}
+		}
+	})
+}
+
+// BenchmarkLRange reads a whole list of size elements.
+func BenchmarkLRange(b *testing.B) {
+	runSizes(b, []int{10, 100, 1000}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		s.LPush("list", listElements(size)...)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.LRange("list", 0, -1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestLists checks the list commands on missing keys, keys of another type
+// and lists, and that a list is deleted with its last element.
+func TestLists(t *testing.T) {
+	str := func(s *storage.Storage) { s.Set("k", "v") }
+	list := func(s *storage.Storage) { s.RPush("k", "a", "b", "a") }
+	one := func(s *storage.Storage) { s.RPush("k", "a") }
+	runCases(t, []storageCase{
+		wrongType("LPUSH on a string", str, func(s *storage.Storage) (any, error) { return s.LPush("k", "a") }),
+		wrongType("RPUSH on a string", str, func(s *storage.Storage) (any, error) { return s.RPush("k", "a") }),
+		wrongType("LPUSHX on a string", str, func(s *storage.Storage) (any, error) { return s.LPushX("k", "a") }),
+		wrongType("RPUSHX on a string", str, func(s *storage.Storage) (any, error) { return s.RPushX("k", "a") }),
+		wrongType("LPOP on a string", str, func(s *storage.Storage) (any, error) { return found(s.LPop("k")) }),
+		wrongType("RPOP on a string", str, func(s *storage.Storage) (any, error) { return found(s.RPop("k")) }),
+		wrongType("LLEN on a string", str, func(s *storage.Storage) (any, error) { return s.LLen("k") }),
+		wrongType("LINDEX on a string", str, func(s *storage.Storage) (any, error) { return found(s.LIndex("k", 0)) }),
+		wrongType("LSET on a string", str, func(s *storage.Storage) (any, error) { return nil, s.LSet("k", 0, "a") }),
+		wrongType("LREM on a string", str, func(s *storage.Storage) (any, error) { return s.LRem("k", 0, "a") }),
+		wrongType("LINSERT on a string", str, func(s *storage.Storage) (any, error) { return s.LInsert("k", "BEFORE", "a", "b") }),
+		wrongType("LRANGE on a string", str, func(s *storage.Storage) (any, error) { return s.LRange("k", 0, -1) }),
+		wrongType("LTRIM on a string", str, func(s *storage.Storage) (any, error) { return nil, s.LTrim("k", 0, -1) }),
+
+		{name: "LPUSHX to a missing key", op: func(s *storage.Storage) (any, error) { return s.LPushX("k", "a") }, want: int64(0), gone: "k"},
+		{name: "RPUSHX to a missing key", op: func(s *storage.Storage) (any, error) { return s.RPushX("k", "a") }, want: int64(0), gone: "k"},
+		{name: "LPOP of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.LPop("k")) }, want: []any{"", false}},
+		{name: "RPOP of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.RPop("k")) }, want: []any{"", false}},
+		{name: "LLEN of a missing key", op: func(s *storage.Storage) (any, error) { return s.LLen("k") }, want: int64(0)},
+		{name: "LINDEX of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.LIndex("k", 0)) }, want: []any{"", false}},
+		{name: "LSET of a missing key", op: func(s *storage.Storage) (any, error) { return nil, s.LSet("k", 0, "a") }, err: errs.NoSuchKey},
+		{name: "LREM of a missing key", op: func(s *storage.Storage) (any, error) { return s.LRem("k", 0, "a") }, want: int64(0)},
+		{name: "LINSERT into a missing key", op: func(s *storage.Storage) (any, error) { return s.LInsert("k", "BEFORE", "a", "b") }, want: int64(0), gone: "k"},
+		{name: "LRANGE of a missing key", op: func(s *storage.Storage) (any, error) { return s.LRange("k", 0, -1) }, want: []string{}},
+
+		{name: "LINDEX from the tail", setup: list, op: func(s *storage.Storage) (any, error) { return found(s.LIndex("k", -1)) }, want: []any{"a", true}},
+		{name: "LSET out of range", setup: list, op: func(s *storage.Storage) (any, error) { return nil, s.LSet("k", 3, "x") }, err: errs.OutOfRange},
+		{name: "LINSERT without the pivot", setup: list, op: func(s *storage.Storage) (any, error) { return s.LInsert("k", "AFTER", "x", "y") }, want: int64(-1)},
+		{name: "LREM from the tail", setup: list, op: func(s *storage.Storage) (any, error) {
+			if _, err := s.LRem("k", -1, "a"); err != nil {
+				return nil, err
+			}
+			return s.LRange("k", 0, -1)
+		}, want: []string{"a", "b"}},
+
+		{name: "LPOP of the last element", setup: one, op: func(s *storage.Storage) (any, error) { return found(s.LPop("k")) }, want: []any{"a", true}, gone: "k"},
+		{name: "RPOP of the last element", setup: one, op: func(s *storage.Storage) (any, error) { return found(s.RPop("k")) }, want: []any{"a", true}, gone: "k"},
+		{name: "LREM of every element", setup: list, op: func(s *storage.Storage) (any, error) {
+			s.LRem("k", 0, "b")
+			return s.LRem("k", 0, "a")
+		}, want: int64(2), gone: "k"},
+		{name: "LTRIM to an empty range", setup: list, op: func(s *storage.Storage) (any, error) { return nil, s.LTrim("k", 2, 1) }, gone: "k"},
+	})
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// Loader fetches the keys starting with Prefix from an external source
+// when GET or HGET finds them missing, making the storage a read-through
+// cache in front of that source.
+type Loader struct {
+	Prefix string
+	TTL    time.Duration // Expire time of the keys loaded, 0 for none
+	// Load returns the value of key as an Entry of type string or hash,
+	// whose ExpireAt is ignored. ok is false if the source has no such key.
+	Load func(key string) (e Entry, ok bool, err error)
+}
+
+// SetLoaders sets the loaders of missing keys, replacing the previous ones.
+// The loader with the longest matching prefix loads a key.
+func (s *Storage) SetLoaders(ls []Loader) {
+	if len(ls) == 0 {
+		s.loaders.Store(nil)
+		return
+	}
+	ls = append([]Loader(nil), ls...)
+	s.loaders.Store(&ls)
+}
+
+// loaderFor returns the loader of key, nil if there is none.
+func (s *Storage) loaderFor(key string) *Loader {
+	ls := s.loaders.Load()
+	if ls == nil {
+		return nil
+	}
+	var best *Loader
+	for i := range *ls {
+		l := &(*ls)[i]
+		if strings.HasPrefix(key, l.Prefix) && (best == nil || len(l.Prefix) > len(best.Prefix)) {
+			best = l
+		}
+	}
+	return best
+}
+
+// readThrough loads key with its loader if it is missing. The value is only
+// stored if the key is still missing once loaded, so a write made in the
+// meantime wins. The loader is called without locks held, and concurrent
+// misses of a key may each call it.
+func (s *Storage) readThrough(key string) error {
+	l := s.loaderFor(key)
+	if l == nil {
+		return nil
+	}
+	s.expireKey(key)
+	if _, ok := s.shard(key).data.Load(key); ok {
+		return nil
+	}
+	e, ok, err := l.Load(key)
+	if err != nil || !ok {
+		return err
+	}
+	val, err := entryValue(e)
+	if err != nil {
+		return err
+	}
+
+	defer s.lockKey(key)()
+	s.expireIfNeeded(key)
+	s.preserve(key)
+	sh := s.shard(key)
+	if _, loaded := sh.data.LoadOrStore(key, val); loaded {
+		return nil
+	}
+	s.indexSlot(key)
+	s.touch(key)
+	if l.TTL > 0 {
+		sh.expires.Store(key, time.Now().Add(l.TTL).UnixMilli())
+	}
+	s.keyChanged(key, false, 1)
+	return nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"strconv"
+)
+
+// rewriteItemsPerCommand is the most elements a command produced by
+// Commands adds to a collection, so replaying a large collection does not
+// need one huge command.
+const rewriteItemsPerCommand = 64
+
+// Commands calls emit with commands that recreate the snapshot when run in
+// order, such as FUNCTION LOAD, SET, RPUSH, SADD, HSET, ZADD, XADD and PEXPIREAT,
+// and ends the snapshot. It is used to rewrite the append only file.
+func (sn *Snapshot) Commands(emit func(argv []string) error) error {
+	for _, code := range sn.functions {
+		if err := emit([]string{"FUNCTION", "LOAD", code}); err != nil {
+			sn.Abort()
+			return err
+		}
+	}
+	return sn.each(func(key string, val Value, expireAt int64) error {
+		if err := val.rewrite(key, emit); err != nil {
+			return err
+		}
+		if expireAt >= 0 {
+			return emit([]string{"PEXPIREAT", key, strconv.FormatInt(expireAt, 10)})
+		}
+		return nil
+	})
+}
+
+func (v StringValue) rewrite(key string, emit func(argv []string) error) error {
+	return emit([]string{"SET", key, string(v)})
+}
+
+func (v ListValue) rewrite(key string, emit func(argv []string) error) error {
+	var items []string
+	for e := v.Front(); e != nil; e = e.Next() {
+		items = append(items, e.Value.(string))
+	}
+	return emitItems(emit, "RPUSH", key, items, 1)
+}
+
+func (v SetValue) rewrite(key string, emit func(argv []string) error) error {
+	var items []string
+	for member := range v {
+		items = append(items, member)
+	}
+	return emitItems(emit, "SADD", key, items, 1)
+}
+
+func (v HashValue) rewrite(key string, emit func(argv []string) error) error {
+	// HSET sets a single field.
+	for field, value := range v {
+		if err := emit([]string{"HSET", key, field, value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v ZSetValue) rewrite(key string, emit func(argv []string) error) error {
+	var items []string
+	for _, m := range v {
+		items = append(items, strconv.FormatFloat(m.Score, 'g', 17, 64), m.Member)
+	}
+	// Sorted sets take items in pairs.
+	return emitItems(emit, "ZADD", key, items, 2)
+}
+
+// rewrite adds the entries of the stream with their IDs, as Redis does,
+// then sets its last ID and counters with XSETID; an empty stream is
+// created by adding an entry trimmed at once. Its consumer groups are
+// created at the entries they delivered last, and their consumers with the
+// entries pending for them claimed with their delivery times and counts.
+// Pending entries deleted from the stream are not kept, as claiming them
+// would drop them anyway.
+func (v StreamValue) rewrite(key string, emit func(argv []string) error) error {
+	for _, e := range v.entries {
+		if err := emit(append([]string{"XADD", key, e.ID.String()}, e.Fields...)); err != nil {
+			return err
+		}
+	}
+	if len(v.entries) == 0 {
+		if err := emit([]string{"XADD", key, "MAXLEN", "0", "0-1", "x", "y"}); err != nil {
+			return err
+		}
+	}
+	err := emit([]string{"XSETID", key, v.lastID.String(),
+		"ENTRIESADDED", strconv.FormatUint(v.entriesAdded, 10),
+		"MAXDELETEDID", v.maxDeletedID.String()})
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedNames(v.groups) {
+		g := v.groups[name]
+		argv := []string{"XGROUP", "CREATE", key, name, g.lastID.String(),
+			"ENTRIESREAD", strconv.FormatInt(g.entriesRead, 10)}
+		if err := emit(argv); err != nil {
+			return err
+		}
+		for _, cname := range sortedNames(g.consumers) {
+			if err := g.rewriteConsumer(key, name, cname, emit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteConsumer creates the consumer cname of the group name, then
+// claims each entry pending for it. It is created first, so that it is
+// kept even if all its pending entries were deleted from the stream.
+func (g *consumerGroup) rewriteConsumer(key, name, cname string, emit func(argv []string) error) error {
+	if err := emit([]string{"XGROUP", "CREATECONSUMER", key, name, cname}); err != nil {
+		return err
+	}
+	for _, id := range sortedIDs(g.consumers[cname].pending) {
+		p := g.pending[id]
+		argv := []string{"XCLAIM", key, name, cname, "0", id.String(),
+			"TIME", strconv.FormatInt(p.deliveryTime, 10),
+			"RETRYCOUNT", strconv.FormatUint(p.deliveryCount, 10),
+			"JUSTID", "FORCE"}
+		if err := emit(argv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitItems calls emit with name commands adding items to key, at most
+// rewriteItemsPerCommand at a time, each made of width arguments.
+func emitItems(emit func(argv []string) error, name, key string, items []string, width int) error {
+	for len(items) > 0 {
+		n := min(len(items), rewriteItemsPerCommand*width)
+		argv := append([]string{name, key}, items[:n]...)
+		if err := emit(argv); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/liweiyuan/go-redis-server/internal/glob"
+)
+
+// A SCAN cursor holds the index of a shard in its top bits and, below, the
+// smallest scan hash of the shard's keys not returned yet. Each call
+// returns the keys of a shard in the order of their scan hash, from the
+// cursor on, and never splits the keys sharing a hash between two calls.
+// As a key always lives in the same shard with the same hash, a key that
+// exists for the whole scan is returned exactly once, whatever keys are
+// added or deleted meanwhile; keys added or deleted during the scan may or
+// may not be returned.
+const (
+	scanHashBits = 58
+	scanHashMask = 1<<scanHashBits - 1
+)
+
+// scanMinParts bounds the number of calls scanning a shard: each returns at
+// least this fraction of its keys, whatever the count asked for, so a full
+// scan reads each shard a bounded number of times.
+const scanMinParts = 16
+
+// scanHash returns the position of key in the scan order of its shard: the
+// FNV-1a 64-bit hash of the key, cut to scanHashBits bits.
+func scanHash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h & scanHashMask
+}
+
+// Scan returns keys starting at cursor, at least count of them unless the
+// scan ends, and the cursor to continue from, 0 once every shard has been
+// scanned. Keys are skipped if they do not match the glob-style pattern or,
+// if typ is not empty, do not hold a value of that type; a call may then
+// return fewer keys, or none, before the scan ends.
+func (s *Storage) Scan(cursor uint64, count int, pattern, typ string) ([]string, uint64) {
+	shardIdx := int(cursor >> scanHashBits)
+	next := cursor & scanHashMask
+	var keys []string
+	for shardIdx < numShards {
+		batch, last, done := s.scanShard(shardIdx, next, count-len(keys))
+		for _, key := range batch {
+			if s.scanMatches(key, pattern, typ) {
+				keys = append(keys, key)
+			}
+		}
+		if !done {
+			return keys, uint64(shardIdx)<<scanHashBits | (last + 1)
+		}
+		shardIdx++
+		next = 0
+		if len(keys) >= count {
+			break
+		}
+	}
+	if shardIdx >= numShards {
+		return keys, 0
+	}
+	return keys, uint64(shardIdx) << scanHashBits
+}
+
+type scanEntry struct {
+	hash uint64
+	key  string
+}
+
+// scanShard returns the keys of the shard whose scan hash is at least next,
+// in scan order: at least count of them, along with all keys sharing the
+// hash of the last one. It reports the last hash returned, and whether no
+// key of the shard is left beyond it.
+func (s *Storage) scanShard(i int, next uint64, count int) (keys []string, last uint64, done bool) {
+	var entries []scanEntry
+	total := 0
+	s.shards[i].data.Range(func(k, _ any) bool {
+		total++
+		key := k.(string)
+		if h := scanHash(key); h >= next {
+			entries = append(entries, scanEntry{h, key})
+		}
+		return true
+	})
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].hash != entries[b].hash {
+			return entries[a].hash < entries[b].hash
+		}
+		return entries[a].key < entries[b].key
+	})
+
+	n := min(max(count, total/scanMinParts, 1), len(entries))
+	for n < len(entries) && entries[n].hash == entries[n-1].hash {
+		n++
+	}
+	if n == len(entries) || n > 0 && entries[n-1].hash == scanHashMask {
+		done = true
+	}
+	keys = make([]string, n)
+	for j, e := range entries[:n] {
+		keys[j] = e.key
+	}
+	if n > 0 {
+		last = entries[n-1].hash
+	}
+	return keys, last, done
+}
+
+// scanMatches reports whether SCAN returns key: it exists, has not expired,
+// and matches pattern and typ.
+func (s *Storage) scanMatches(key, pattern, typ string) bool {
+	if pattern != "" && pattern != "*" && !glob.Match(pattern, key) {
+		return false
+	}
+	if s.expireKey(key) {
+		return false
+	}
+	val, ok := s.shard(key).data.Load(key)
+	if !ok {
+		return false
+	}
+	return typ == "" || val.(Value).Type() == typ
+}
@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// SAdd adds the specified members to the set stored at key.
+// Specified members that are already a member of this set are ignored.
+// If key does not exist, a new set is created with the specified members.
+// If the key holds a value of another type, an error is returned.
+func (s *Storage) SAdd(key string, members ...string) (int64, error) {
+	defer s.lockKey(key)()
+	actual, loaded := s.loadOrStore(key, SetValue{})
+	set, ok := actual.(SetValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+
+	addedCount := int64(0)
+	for _, member := range members {
+		if _, found := set[member]; !found {
+			set[member] = struct{}{}
+			addedCount++
+		}
+	}
+	s.keyChanged(key, loaded, int(addedCount))
+	return addedCount, nil
+}
+
+// SRem removes the specified members from the set stored at key.
+// Specified members that are not a member of this set are ignored.
+// If key does not exist, it is treated as an empty set and this command returns 0.
+// If the key holds a value of another type, an error is returned.
+func (s *Storage) SRem(key string, members ...string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		set, ok := actual.(SetValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		removedCount := int64(0)
+		for _, member := range members {
+			if _, found := set[member]; found {
+				delete(set, member)
+				removedCount++
+			}
+		}
+		s.deleteIfEmpty(key, set)
+		s.keyChanged(key, true, int(removedCount))
+		return removedCount, nil
+	}
+	return 0, nil // Key not found, so no members removed
+}
+
+// SIsMember returns if member is a member of the set stored at key.
+func (s *Storage) SIsMember(key, member string) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		set, ok := actual.(SetValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+		if _, found := set[member]; found {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, nil // Key not found, so member is not in set
+}
+
+// SCard returns the number of elements in the set stored at key.
+func (s *Storage) SCard(key string) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		set, ok := actual.(SetValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+		return int64(len(set)), nil
+	}
+	return 0, nil // Key not found, so set is empty
+}
+
+// SMembers returns all members of the set stored at key.
+func (s *Storage) SMembers(key string) ([]string, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		set, ok := actual.(SetValue)
+		if !ok {
+			return nil, errs.WrongType
+		}
+
+		members := make([]string, 0, len(set))
+		for member := range set {
+			members = append(members, member)
+		}
+		return members, nil
+	}
+	return []string{}, nil // Key not found, return empty list
+}
+
+// SPop removes and returns up to count random members from the set value
+// stored at key, none if the key does not exist.
+func (s *Storage) SPop(key string, count int64) ([]string, error) {
+	defer s.lockKey(key)()
+	actual, ok := s.load(key)
+	if !ok {
+		return []string{}, nil // Key not found, return empty list
+	}
+	set, ok := actual.(SetValue)
+	if !ok {
+		return nil, errs.WrongType
+	}
+
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	n := int(min(count, int64(len(members))))
+	// Move n random members to the front of the slice.
+	for i := 0; i < n; i++ {
+		j := i + rand.Intn(len(members)-i)
+		members[i], members[j] = members[j], members[i]
+		delete(set, members[i])
+	}
+	popped := members[:n]
+
+	s.deleteIfEmpty(key, set)
+	s.keyChanged(key, true, len(popped))
+	return popped, nil
+}
+
+// SRandMember returns a random member from the set value stored at key.
+// If count is provided, returns an array of count random members.
+// If count is positive, returns unique members.
+// If count is negative, returns members that may be repeated.
+func (s *Storage) SRandMember(key string, count int64) ([]string, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		set, ok := actual.(SetValue)
+		if !ok {
+			return nil, errs.WrongType
+		}
+
+		if len(set) == 0 {
+			return []string{}, nil // Set is empty
+		}
+
+		members := make([]string, 0, len(set))
+		for member := range set {
+			members = append(members, member)
+		}
+
+		rand.Seed(time.Now().UnixNano())
+
+		var result []string
+		if count == 0 {
+			return []string{}, nil
+		} else if count > 0 {
+			// Return unique members
+			numToReturn := count
+			if numToReturn > int64(len(members)) {
+				numToReturn = int64(len(members))
+			}
+			// Shuffle members and take the first numToReturn
+			rand.Shuffle(len(members), func(i, j int) {
+				members[i], members[j] = members[j], members[i]
+			})
+			result = members[:numToReturn]
+		} else { // count < 0
+			// Return members that may be repeated
+			numToReturn := -count
+			for i := int64(0); i < numToReturn; i++ {
+				randIndex := rand.Intn(len(members))
+				result = append(result, members[randIndex])
+			}
+		}
+		return result, nil
+	}
+	return []string{}, nil // Key not found, return empty list
+}
+
+// SInter returns the members of the set resulting from the intersection of all the given sets.
+func (s *Storage) SInter(keys ...string) ([]string, error) {
+	defer s.rlockKeys(keys...)()
+	sets, err := s.readSets(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 || sets[0] == nil {
+		return []string{}, nil // First key not found, intersection is empty
+	}
+
+	// Initialize intersection with the first set's members
+	intersection := make(map[string]struct{})
+	for member := range sets[0] {
+		intersection[member] = struct{}{}
+	}
+
+	// Intersect with remaining sets
+	for _, currentSet := range sets[1:] {
+		newIntersection := make(map[string]struct{})
+		for member := range intersection {
+			if _, found := currentSet[member]; found {
+				newIntersection[member] = struct{}{}
+			}
+		}
+		intersection = newIntersection
+		if len(intersection) == 0 {
+			return []string{}, nil // Optimization: if intersection becomes empty, no need to continue
+		}
+	}
+
+	result := make([]string, 0, len(intersection))
+	for member := range intersection {
+		result = append(result, member)
+	}
+	return result, nil
+}
+
+// readSets returns the sets stored at keys, nil for a missing key. As in
+// Redis, a key of another type is an error even if an earlier key is
+// missing, which empties the result anyway. The caller holds the locks of
+// keys.
+func (s *Storage) readSets(keys []string) ([]SetValue, error) {
+	sets := make([]SetValue, len(keys))
+	for i, key := range keys {
+		actual, ok := s.lookupRead(key)
+		if !ok {
+			continue
+		}
+		set, ok := actual.(SetValue)
+		if !ok {
+			return nil, errs.WrongType
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// SUnion returns the members of the set resulting from the union of all the given sets.
+func (s *Storage) SUnion(keys ...string) ([]string, error) {
+	defer s.rlockKeys(keys...)()
+	unionSet := make(map[string]struct{})
+
+	for _, key := range keys {
+		if actual, ok := s.lookupRead(key); ok {
+			set, ok := actual.(SetValue)
+			if !ok {
+				return nil, errs.WrongType
+			}
+			for member := range set {
+				unionSet[member] = struct{}{}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(unionSet))
+	for member := range unionSet {
+		result = append(result, member)
+	}
+	return result, nil
+}
+
+// SDiff returns the members of the set resulting from the difference between the first set and all the successive sets.
+func (s *Storage) SDiff(keys ...string) ([]string, error) {
+	defer s.rlockKeys(keys...)()
+	sets, err := s.readSets(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 || sets[0] == nil {
+		return []string{}, nil // First key not found, difference is empty
+	}
+
+	// Initialize difference with the first set's members
+	difference := make(map[string]struct{})
+	for member := range sets[0] {
+		difference[member] = struct{}{}
+	}
+
+	// Remove members present in successive sets, a missing key removing none
+	for _, currentSet := range sets[1:] {
+		for member := range currentSet {
+			delete(difference, member)
+		}
+	}
+
+	result := make([]string, 0, len(difference))
+	for member := range difference {
+		result = append(result, member)
+	}
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package storage_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// BenchmarkSAdd adds members to a set of size members, half of them new.
+func BenchmarkSAdd(b *testing.B) {
+	runSizes(b, []int{10, 1000, 100000}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		members := make([]string, 2*size)
+		for i := range members {
+			members[i] = "m" + strconv.Itoa(i)
+		}
+		s.SAdd("set", members[:size]...)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.SAdd("set", members[i%len(members)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSInter intersects two sets of size members sharing half of
+// them.
+func BenchmarkSInter(b *testing.B) {
+	runSizes(b, []int{10, 1000, 10000}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		for i := 0; i < size; i++ {
+			s.SAdd("a", "m"+strconv.Itoa(i))
+			s.SAdd("b", "m"+strconv.Itoa(i+size/2))
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.SInter("a", "b"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestSets checks the set commands on missing keys, keys of another type
+// and sets, and that a set is deleted with its last member.
+func TestSets(t *testing.T) {
+	str := func(s *storage.Storage) { s.Set("k", "v") }
+	set := func(s *storage.Storage) { s.SAdd("k", "a", "b") }
+	runCases(t, []storageCase{
+		wrongType("SADD on a string", str, func(s *storage.Storage) (any, error) { return s.SAdd("k", "a") }),
+		wrongType("SREM on a string", str, func(s *storage.Storage) (any, error) { return s.SRem("k", "a") }),
+		wrongType("SISMEMBER on a string", str, func(s *storage.Storage) (any, error) { return s.SIsMember("k", "a") }),
+		wrongType("SCARD on a string", str, func(s *storage.Storage) (any, error) { return s.SCard("k") }),
+		wrongType("SMEMBERS on a string", str, func(s *storage.Storage) (any, error) { return s.SMembers("k") }),
+		wrongType("SPOP on a string", str, func(s *storage.Storage) (any, error) { return s.SPop("k", 1) }),
+		wrongType("SRANDMEMBER on a string", str, func(s *storage.Storage) (any, error) { return s.SRandMember("k", 1) }),
+		wrongType("SINTER with a string after a missing key", str, func(s *storage.Storage) (any, error) { return s.SInter("missing", "k") }),
+		wrongType("SUNION with a string after a missing key", str, func(s *storage.Storage) (any, error) { return s.SUnion("missing", "k") }),
+		wrongType("SDIFF with a string after a missing key", str, func(s *storage.Storage) (any, error) { return s.SDiff("missing", "k") }),
+
+		{name: "SREM from a missing key", op: func(s *storage.Storage) (any, error) { return s.SRem("k", "a") }, want: int64(0)},
+		{name: "SISMEMBER of a missing key", op: func(s *storage.Storage) (any, error) { return s.SIsMember("k", "a") }, want: int64(0)},
+		{name: "SCARD of a missing key", op: func(s *storage.Storage) (any, error) { return s.SCard("k") }, want: int64(0)},
+		{name: "SMEMBERS of a missing key", op: func(s *storage.Storage) (any, error) { return s.SMembers("k") }, want: []string{}},
+		{name: "SPOP of a missing key", op: func(s *storage.Storage) (any, error) { return s.SPop("k", 1) }, want: []string{}},
+		{name: "SRANDMEMBER of a missing key", op: func(s *storage.Storage) (any, error) { return s.SRandMember("k", 1) }, want: []string{}},
+		{name: "SINTER with a missing key", setup: set, op: func(s *storage.Storage) (any, error) { return s.SInter("k", "missing") }, want: []string{}},
+
+		{name: "SADD counts new members only", setup: set, op: func(s *storage.Storage) (any, error) { return s.SAdd("k", "b", "c") }, want: int64(1)},
+		{name: "SRANDMEMBER with a negative count repeats members", setup: func(s *storage.Storage) { s.SAdd("k", "a") }, op: func(s *storage.Storage) (any, error) { return s.SRandMember("k", -3) }, want: []string{"a", "a", "a"}},
+
+		{name: "SREM of every member", setup: set, op: func(s *storage.Storage) (any, error) { return s.SRem("k", "a", "b", "c") }, want: int64(2), gone: "k"},
+		{name: "SPOP of every member", setup: func(s *storage.Storage) { s.SAdd("k", "a") }, op: func(s *storage.Storage) (any, error) { return s.SPop("k", 5) }, want: []string{"a"}, gone: "k"},
+	})
+}
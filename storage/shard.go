@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+)
+
+// numShards is the number of shards the keyspace is split into. A key
+// always lives in the same shard, so a background snapshot can be written
+// one shard at a time.
+const numShards = 64
+
+// shard holds the keys whose name hashes to it.
+type shard struct {
+	data    sync.Map     // Stores key-value pairs
+	expires sync.Map     // Expire times of volatile keys, in Unix milliseconds
+	access  sync.Map     // *atomic.Int64 LRU clock of the last access to each key, see touch
+	peaks   sync.Map     // Peak length of containers, see SetActiveDefrag
+	mu      sync.RWMutex // Key lock of the containers of the shard, see lockKey
+}
+
+// shardIndex returns the index of the shard holding key, using the FNV-1a
+// hash of the key.
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % numShards)
+}
+
+// shard returns the shard holding key.
+func (s *Storage) shard(key string) *shard {
+	return &s.shards[shardIndex(key)]
+}
+
+// lockKey locks key for writing and returns the function unlocking it.
+// Containers are modified in place and strings read before they are
+// written, so every write holds the lock, and every read of a container,
+// and never sees another command half done. The lock is shared by the keys
+// of a shard, and is not reentrant: a function holding it calls none that
+// takes it.
+func (s *Storage) lockKey(key string) (unlock func()) {
+	mu := &s.shard(key).mu
+	mu.Lock()
+	return mu.Unlock
+}
+
+// rlockKey locks key for reading and returns the function unlocking it.
+func (s *Storage) rlockKey(key string) (unlock func()) {
+	mu := &s.shard(key).mu
+	mu.RLock()
+	return mu.RUnlock
+}
+
+// lockKeys locks keys for writing and returns the function unlocking them.
+// The shards of the keys are locked once each, in the order of their
+// index, so that commands locking several keys cannot deadlock.
+func (s *Storage) lockKeys(keys ...string) (unlock func()) {
+	shards := s.shardsOf(keys)
+	for _, i := range shards {
+		s.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range shards {
+			s.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// rlockKeys locks keys for reading as lockKeys does for writing.
+func (s *Storage) rlockKeys(keys ...string) (unlock func()) {
+	shards := s.shardsOf(keys)
+	for _, i := range shards {
+		s.shards[i].mu.RLock()
+	}
+	return func() {
+		for _, i := range shards {
+			s.shards[i].mu.RUnlock()
+		}
+	}
+}
+
+// shardsOf returns the indexes of the shards holding keys, sorted and
+// without duplicates.
+func (s *Storage) shardsOf(keys []string) []int {
+	shards := make([]int, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, shardIndex(key))
+	}
+	slices.Sort(shards)
+	return slices.Compact(shards)
+}
+
+// rangeKeys calls f for each key and its value, shard by shard, until f
+// returns false.
+func (s *Storage) rangeKeys(f func(key string, val Value) bool) {
+	for i := range s.shards {
+		more := true
+		s.shards[i].data.Range(func(k, v any) bool {
+			more = f(k.(string), v.(Value))
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
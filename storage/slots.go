@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/internal/keyslot"
+)
+
+// slotIndex holds the keys of each hash slot, for the CLUSTER commands
+// enumerating the keys of a slot. It is only kept in cluster mode.
+type slotIndex struct {
+	slots [keyslot.Count]struct {
+		mu   sync.Mutex
+		keys map[string]struct{}
+	}
+}
+
+// EnableSlotIndex starts keeping the keys of each hash slot, which
+// CountKeysInSlot and KeysInSlot require. It is called once, in cluster
+// mode, before the dataset is loaded.
+func (s *Storage) EnableSlotIndex() {
+	if !s.slots.CompareAndSwap(nil, &slotIndex{}) {
+		return
+	}
+	s.rangeKeys(func(key string, _ Value) bool {
+		s.indexSlot(key)
+		return true
+	})
+}
+
+// indexSlot updates the slot index after key was created or deleted. The
+// presence of the key is checked under the lock of its slot, so concurrent
+// changes to the key leave the index matching the last of them.
+func (s *Storage) indexSlot(key string) {
+	idx := s.slots.Load()
+	if idx == nil {
+		return
+	}
+	slot := &idx.slots[keyslot.Of(key)]
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	if _, ok := s.shard(key).data.Load(key); !ok {
+		delete(slot.keys, key)
+		return
+	}
+	if slot.keys == nil {
+		slot.keys = make(map[string]struct{})
+	}
+	slot.keys[key] = struct{}{}
+}
+
+// CountKeysInSlot returns the number of keys in the hash slot, which keys
+// past their expire time count in until they are deleted.
+func (s *Storage) CountKeysInSlot(slot int) int {
+	idx := s.slots.Load()
+	if idx == nil {
+		return 0
+	}
+	sl := &idx.slots[slot]
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return len(sl.keys)
+}
+
+// KeysInSlot returns at most count keys of the hash slot, in sorted order.
+func (s *Storage) KeysInSlot(slot, count int) []string {
+	idx := s.slots.Load()
+	if idx == nil {
+		return []string{}
+	}
+	sl := &idx.slots[slot]
+	sl.mu.Lock()
+	keys := make([]string, 0, len(sl.keys))
+	for key := range sl.keys {
+		keys = append(keys, key)
+	}
+	sl.mu.Unlock()
+	sort.Strings(keys)
+	return keys[:min(count, len(keys))]
+}
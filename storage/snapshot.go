@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/liweiyuan/go-redis-server/internal/rdb"
+)
+
+// WriteSnapshot writes the dataset to w in the RDB format.
+func (s *Storage) WriteSnapshot(w io.Writer) error {
+	sn, err := s.BeginSnapshot()
+	if err != nil {
+		return err
+	}
+	return sn.Save(w)
+}
+
+func (v StringValue) Serialize(rw *rdb.Writer, key string) {
+	rw.WriteByte(rdb.TypeString)
+	rw.WriteKey(key)
+	rw.WriteString(string(v))
+}
+
+func (v ListValue) Serialize(rw *rdb.Writer, key string) {
+	rw.WriteByte(rdb.TypeList)
+	rw.WriteKey(key)
+	rw.WriteLength(uint64(v.Len()))
+	for e := v.Front(); e != nil; e = e.Next() {
+		rw.WriteString(e.Value.(string))
+	}
+}
+
+func (v SetValue) Serialize(rw *rdb.Writer, key string) {
+	rw.WriteByte(rdb.TypeSet)
+	rw.WriteKey(key)
+	rw.WriteLength(uint64(len(v)))
+	for member := range v {
+		rw.WriteString(member)
+	}
+}
+
+func (v HashValue) Serialize(rw *rdb.Writer, key string) {
+	rw.WriteByte(rdb.TypeHash)
+	rw.WriteKey(key)
+	rw.WriteLength(uint64(len(v)))
+	for field, value := range v {
+		rw.WriteString(field)
+		rw.WriteString(value)
+	}
+}
+
+func (v ZSetValue) Serialize(rw *rdb.Writer, key string) {
+	rw.WriteByte(rdb.TypeZSet2)
+	rw.WriteKey(key)
+	rw.WriteLength(uint64(len(v)))
+	for _, m := range v {
+		rw.WriteString(m.Member)
+		rw.WriteBinaryDouble(m.Score)
+	}
+}
+
+// ReadSnapshot replaces the dataset with the one read from r in the RDB
+// format. The dataset is left untouched if r cannot be read completely.
+func (s *Storage) ReadSnapshot(r io.Reader) error {
+	f, err := readRDB(r)
+	if err != nil {
+		return err
+	}
+	s.replace(f)
+	// The dataset matches the snapshot, so nothing needs saving.
+	s.dirty.Store(0)
+	return nil
+}
+
+// Snapshot writes the dataset to w in the RDB format, for embedders to
+// checkpoint it and Restore it later, as between test cases. Unlike
+// BeginSnapshot, it neither waits for nor disturbs a background save, and
+// leaves the count of dirty changes alone; the caller makes sure no write
+// is in progress.
+func (s *Storage) Snapshot(w io.Writer) error {
+	now := nowMs()
+	return writeRDB(w, s.Functions(), func(f func(key string, val Value, expireAt int64) error) error {
+		var err error
+		s.rangeKeys(func(key string, val Value) bool {
+			expireAt := int64(-1)
+			if at, ok := s.shard(key).expires.Load(key); ok {
+				if expireAt = at.(int64); expireAt <= now {
+					return true
+				}
+			}
+			err = f(key, val, expireAt)
+			return err == nil
+		})
+		return err
+	})
+}
+
+// Restore replaces the dataset with the one written by Snapshot, or any
+// other RDB file, read from r. The dataset is left untouched if r cannot be
+// read completely. Unlike ReadSnapshot, the keys restored count as changes
+// still to be saved.
+func (s *Storage) Restore(r io.Reader) error {
+	f, err := readRDB(r)
+	if err != nil {
+		return err
+	}
+	s.replace(f)
+	s.changed(len(f.entries))
+	return nil
+}
+
+// rdbFile is the contents of an RDB file.
+type rdbFile struct {
+	entries   map[string]Value
+	expires   map[string]int64 // Expire times of the keys that have one
+	functions []string         // Code of the function libraries
+}
+
+// replace replaces the dataset, and the function libraries, with those of
+// f.
+func (s *Storage) replace(f rdbFile) {
+	s.FlushAll()
+	s.storeFunctions(f.functions)
+	for key, val := range f.entries {
+		s.preserve(key)
+		s.shard(key).data.Store(key, val)
+		s.indexSlot(key)
+		s.touch(key)
+		s.notify(EventCreate, key)
+	}
+	for key, at := range f.expires {
+		s.shard(key).expires.Store(key, at)
+	}
+}
+
+// readRDB reads an RDB file from r, dropping the keys already expired.
+func readRDB(r io.Reader) (rdbFile, error) {
+	rr := rdb.NewReader(r)
+	if err := rr.ReadHeader(); err != nil {
+		return rdbFile{}, err
+	}
+
+	f := rdbFile{entries: make(map[string]Value), expires: make(map[string]int64)}
+	expireAt := int64(-1) // Expire time of the next key, -1 for none
+	for {
+		typ, err := rr.ReadByte()
+		if err != nil {
+			return rdbFile{}, err
+		}
+		switch typ {
+		case rdb.OpEOF:
+			if err := rr.VerifyChecksum(); err != nil {
+				return rdbFile{}, err
+			}
+			return f, nil
+		case rdb.OpExpireTimeMs:
+			if expireAt, err = rr.ReadInt64(); err != nil {
+				return rdbFile{}, err
+			}
+		case rdb.OpExpireTime:
+			sec, err := rr.ReadInt32()
+			if err != nil {
+				return rdbFile{}, err
+			}
+			expireAt = int64(sec) * 1000
+		case rdb.OpFunction2:
+			code, err := rr.ReadString()
+			if err != nil {
+				return rdbFile{}, err
+			}
+			f.functions = append(f.functions, code)
+		case rdb.OpAux:
+			if _, err := rr.ReadString(); err != nil {
+				return rdbFile{}, err
+			}
+			if _, err := rr.ReadString(); err != nil {
+				return rdbFile{}, err
+			}
+		case rdb.OpSelectDB:
+			db, err := rr.ReadLength()
+			if err != nil {
+				return rdbFile{}, err
+			}
+			if db != 0 {
+				return rdbFile{}, fmt.Errorf("rdb: database %d is not supported", db)
+			}
+		case rdb.OpResizeDB:
+			if _, err := rr.ReadLength(); err != nil {
+				return rdbFile{}, err
+			}
+			if _, err := rr.ReadLength(); err != nil {
+				return rdbFile{}, err
+			}
+		default:
+			key, err := rr.ReadString()
+			if err != nil {
+				return rdbFile{}, err
+			}
+			val, err := readValue(rr, typ)
+			if err != nil {
+				return rdbFile{}, err
+			}
+			if expireAt >= 0 && expireAt <= nowMs() {
+				// Already expired, drop it.
+				expireAt = -1
+				continue
+			}
+			f.entries[key] = val
+			if expireAt >= 0 {
+				f.expires[key] = expireAt
+				expireAt = -1
+			}
+		}
+	}
+}
+
+func readValue(rr *rdb.Reader, typ byte) (Value, error) {
+	switch typ {
+	case rdb.TypeString:
+		str, err := rr.ReadString()
+		return StringValue(str), err
+	case rdb.TypeList:
+		n, err := rr.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		lst := newList()
+		for i := uint64(0); i < n; i++ {
+			elem, err := rr.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			lst.PushBack(elem)
+		}
+		return lst, nil
+	case rdb.TypeSet:
+		n, err := rr.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		set := SetValue{}
+		for i := uint64(0); i < n; i++ {
+			member, err := rr.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			set[member] = struct{}{}
+		}
+		return set, nil
+	case rdb.TypeHash:
+		n, err := rr.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		hash := HashValue{}
+		for i := uint64(0); i < n; i++ {
+			field, err := rr.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := rr.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			hash[field] = value
+		}
+		return hash, nil
+	case rdb.TypeZSet2:
+		n, err := rr.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		zset := ZSetValue{}
+		for i := uint64(0); i < n; i++ {
+			member, err := rr.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			score, err := rr.ReadBinaryDouble()
+			if err != nil {
+				return nil, err
+			}
+			zset[member] = ZSetMember{Member: member, Score: score}
+		}
+		return zset, nil
+	case rdb.TypeStreamListpacks3:
+		return readStreamValue(rr)
+	}
+	return nil, fmt.Errorf("rdb: unsupported object type %d", typ)
+}
+
+// Merge copies all keys of other into the dataset, replacing existing keys
+// with the same names.
+func (s *Storage) Merge(other *Storage) {
+	other.rangeKeys(func(key string, val Value) bool {
+		defer s.lockKey(key)()
+		s.preserveRemoved(key)
+		sh := s.shard(key)
+		_, existed := sh.data.Swap(key, val)
+		if !existed {
+			s.indexSlot(key)
+		}
+		s.touch(key)
+		if at, ok := other.shard(key).expires.Load(key); ok {
+			sh.expires.Store(key, at)
+		} else {
+			sh.expires.Delete(key)
+		}
+		s.keyChanged(key, existed, 1)
+		return true
+	})
+}
+
+// FlushAll removes all keys.
+func (s *Storage) FlushAll() {
+	s.rangeKeys(func(key string, _ Value) bool {
+		defer s.lockKey(key)()
+		s.delete(key)
+		s.changed(1)
+		return true
+	})
+}
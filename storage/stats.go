@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// keyspaceStats counts keyspace hits and misses of read lookups, globally
+// and per configured key prefix.
+type keyspaceStats struct {
+	hits     atomic.Int64
+	misses   atomic.Int64
+	prefixes atomic.Pointer[[]*prefixStats]
+}
+
+// prefixStats counts the hits and misses of keys starting with prefix.
+type prefixStats struct {
+	prefix string
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (ks *keyspaceStats) record(key string, hit bool) {
+	if hit {
+		ks.hits.Add(1)
+	} else {
+		ks.misses.Add(1)
+	}
+
+	prefixes := ks.prefixes.Load()
+	if prefixes == nil {
+		return
+	}
+	// Count the access against the longest matching prefix.
+	var best *prefixStats
+	for _, ps := range *prefixes {
+		if strings.HasPrefix(key, ps.prefix) && (best == nil || len(ps.prefix) > len(best.prefix)) {
+			best = ps
+		}
+	}
+	if best == nil {
+		return
+	}
+	if hit {
+		best.hits.Add(1)
+	} else {
+		best.misses.Add(1)
+	}
+}
+
+// lookupRead loads the value of key for a read-only access, counting the
+// access as a keyspace hit or miss. A caller writing the key afterwards
+// preserves it first, as load does.
+func (s *Storage) lookupRead(key string) (any, bool) {
+	val, ok := s.peek(key)
+	s.stats.record(key, ok)
+	return val, ok
+}
+
+// SetKeyspaceStatsPrefixes sets the key prefixes whose hits and misses are
+// tracked separately, resetting their counters.
+func (s *Storage) SetKeyspaceStatsPrefixes(prefixes []string) {
+	buckets := make([]*prefixStats, len(prefixes))
+	for i, prefix := range prefixes {
+		buckets[i] = &prefixStats{prefix: prefix}
+	}
+	s.stats.prefixes.Store(&buckets)
+}
+
+// KeyspaceHits returns the number of successful read lookups.
+func (s *Storage) KeyspaceHits() int64 {
+	return s.stats.hits.Load()
+}
+
+// KeyspaceMisses returns the number of read lookups of missing keys.
+func (s *Storage) KeyspaceMisses() int64 {
+	return s.stats.misses.Load()
+}
+
+// ResetStats resets the keyspace hit and miss counters.
+func (s *Storage) ResetStats() {
+	s.stats.hits.Store(0)
+	s.stats.misses.Store(0)
+	if prefixes := s.stats.prefixes.Load(); prefixes != nil {
+		for _, ps := range *prefixes {
+			ps.hits.Store(0)
+			ps.misses.Store(0)
+		}
+	}
+}
+
+// InfoKeyspacePrefixes renders the per-prefix hit and miss counters as
+// INFO fields.
+func (s *Storage) InfoKeyspacePrefixes() string {
+	prefixes := s.stats.prefixes.Load()
+	if prefixes == nil {
+		return ""
+	}
+	var b strings.Builder
+	for i, ps := range *prefixes {
+		hits, misses := ps.hits.Load(), ps.misses.Load()
+		hitRate := 0.0
+		if hits+misses > 0 {
+			hitRate = float64(hits) / float64(hits+misses)
+		}
+		fmt.Fprintf(&b, "keyspace_prefix_%d:prefix=%s,hits=%d,misses=%d,hit_rate=%.4f\r\n", i, ps.prefix, hits, misses, hitRate)
+	}
+	return b.String()
+}
+
+// KeyCounts are the numbers of keys of the dataset, as INFO keyspace
+// reports them.
+type KeyCounts struct {
+	Keys    int64 // Keys, the expired ones not deleted yet included
+	Expires int64 // Keys with an expire time
+	AvgTTL  int64 // Average time to live of the keys that did not expire yet, in milliseconds
+}
+
+// KeyCounts counts the keys of the dataset. It walks the shards, as the
+// iteration primitives do, so its cost grows with the dataset, and keys
+// written meanwhile may or may not be counted.
+func (s *Storage) KeyCounts() KeyCounts {
+	var c KeyCounts
+	var ttls, live int64
+	now := nowMs()
+	for i := range s.shards {
+		s.shards[i].data.Range(func(_, _ any) bool {
+			c.Keys++
+			return true
+		})
+		s.shards[i].expires.Range(func(_, at any) bool {
+			c.Expires++
+			if ttl := at.(int64) - now; ttl > 0 {
+				ttls += ttl
+				live++
+			}
+			return true
+		})
+	}
+	if live > 0 {
+		c.AvgTTL = ttls / live
+	}
+	return c
+}
@@ -0,0 +1,772 @@
+package storage
+
+import (
+	"slices"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// consumerGroup is a consumer group of a stream: the ID of the last entry
+// delivered to its consumers, and the entries delivered but not yet
+// acknowledged, its pending entries list.
+type consumerGroup struct {
+	lastID      StreamID
+	entriesRead int64 // Entries of the stream read up to lastID, -1 if unknown
+	pending     map[StreamID]*delivery
+	consumers   map[string]*consumer
+}
+
+// delivery is an entry delivered to a consumer and not acknowledged.
+type delivery struct {
+	consumer      string
+	deliveryTime  int64 // Unix milliseconds of the last delivery
+	deliveryCount uint64
+}
+
+// consumer is a consumer of a group, with the IDs of its pending entries.
+type consumer struct {
+	seenTime   int64 // Unix milliseconds of its last attempted interaction
+	activeTime int64 // Unix milliseconds of its last successful one, -1 if none
+	pending    map[StreamID]struct{}
+}
+
+func newConsumerGroup(lastID StreamID, entriesRead int64) *consumerGroup {
+	return &consumerGroup{
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pending:     make(map[StreamID]*delivery),
+		consumers:   make(map[string]*consumer),
+	}
+}
+
+func newConsumer(now int64) *consumer {
+	return &consumer{seenTime: now, activeTime: -1, pending: make(map[StreamID]struct{})}
+}
+
+// noGroupError returns the error of a command naming a group the stream at
+// key does not have.
+func noGroupError(key, group string) error {
+	return errs.New("NOGROUP", "No such consumer group '"+group+"' for key name '"+key+"'")
+}
+
+// consumer returns the consumer of g named name, created if missing. The
+// boolean reports whether it was created.
+func (g *consumerGroup) consumer(name string, now int64) (*consumer, bool) {
+	if c, ok := g.consumers[name]; ok {
+		return c, false
+	}
+	c := newConsumer(now)
+	g.consumers[name] = c
+	return c, true
+}
+
+// deliver adds the entry with ID id, just delivered to consumer c named
+// name, to the pending entries of g, moving it from the consumer it was
+// delivered to before, if any.
+func (g *consumerGroup) deliver(id StreamID, name string, c *consumer, now int64) {
+	if p, ok := g.pending[id]; ok {
+		if prev, ok := g.consumers[p.consumer]; ok {
+			delete(prev.pending, id)
+		}
+	}
+	g.pending[id] = &delivery{consumer: name, deliveryTime: now, deliveryCount: 1}
+	c.pending[id] = struct{}{}
+}
+
+// pendingIDs returns the IDs of the pending entries of g, by ID.
+func (g *consumerGroup) pendingIDs() []StreamID {
+	return sortedIDs(g.pending)
+}
+
+// hasTombstones reports whether entries with IDs between start and end,
+// included, may have been deleted, so the count of entries between them
+// cannot be told from the number added.
+func (st *stream) hasTombstones(start, end StreamID) bool {
+	if len(st.entries) == 0 || st.maxDeletedID.IsZero() {
+		return false
+	}
+	return start.Compare(st.maxDeletedID) <= 0 && st.maxDeletedID.Compare(end) <= 0
+}
+
+// entriesBefore returns the number of entries ever added up to the one
+// with ID id, included, -1 if deleted entries make it unknown.
+func (st *stream) entriesBefore(id StreamID) int64 {
+	added := int64(st.entriesAdded)
+	if added == 0 {
+		return 0
+	}
+	switch cmp := id.Compare(st.lastID); {
+	case len(st.entries) == 0 && cmp <= 0, cmp == 0:
+		return added
+	case cmp > 0:
+		return -1
+	}
+	first := st.firstID()
+	if st.maxDeletedID.IsZero() || st.maxDeletedID.Compare(first) < 0 {
+		// No entry was deleted after the first one.
+		switch id.Compare(first) {
+		case -1:
+			return added - int64(len(st.entries))
+		case 0:
+			return added - int64(len(st.entries)) + 1
+		}
+	}
+	return -1
+}
+
+// lag returns the number of entries of the stream g has yet to read, -1
+// if deleted entries make it unknown.
+func (st *stream) lag(g *consumerGroup) int64 {
+	added := int64(st.entriesAdded)
+	switch {
+	case added == 0:
+		return 0
+	case g.entriesRead >= 0 && !st.hasTombstones(g.lastID, MaxStreamID):
+		return added - g.entriesRead
+	}
+	if read := st.entriesBefore(g.lastID); read >= 0 {
+		return added - read
+	}
+	return -1
+}
+
+// groupStream returns the stream at key for XGROUP, which requires the
+// key to exist unless mkStream creates it.
+func (s *Storage) groupStream(key string, mkStream bool) (StreamValue, error) {
+	st, ok, err := s.writeStream(key)
+	switch {
+	case err != nil:
+		return StreamValue{}, err
+	case ok:
+		return st, nil
+	case !mkStream:
+		return StreamValue{}, errStreamKeyRequired
+	}
+	st = newStream()
+	s.loadOrStore(key, st)
+	s.keyChanged(key, false, 0)
+	return st, nil
+}
+
+// XGroupCreate creates the consumer group group of the stream at key,
+// having read up to the entry with ID id, or to the last entry if last is
+// set, entriesRead entries of the stream, -1 if unknown. The stream is
+// created if mkStream is set.
+func (s *Storage) XGroupCreate(key, group string, id StreamID, last, mkStream bool, entriesRead int64) error {
+	defer s.lockKey(key)()
+	st, err := s.groupStream(key, mkStream)
+	if err != nil {
+		return err
+	}
+	if _, ok := st.groups[group]; ok {
+		return errBusyGroup
+	}
+	if last {
+		id = st.lastID
+	}
+	st.groups[group] = newConsumerGroup(id, entriesRead)
+	s.keyChanged(key, true, 1)
+	return nil
+}
+
+// XGroupSetID sets the ID of the last entry delivered to group, or that of
+// the last entry of the stream if last is set, and the number of entries
+// it read, -1 if unknown.
+func (s *Storage) XGroupSetID(key, group string, id StreamID, last bool, entriesRead int64) error {
+	defer s.lockKey(key)()
+	st, err := s.groupStream(key, false)
+	if err != nil {
+		return err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return noGroupError(key, group)
+	}
+	if last {
+		id = st.lastID
+	}
+	g.lastID, g.entriesRead = id, entriesRead
+	s.keyChanged(key, true, 1)
+	return nil
+}
+
+// XGroupDestroy deletes the consumer group group of the stream at key, and
+// reports whether it existed.
+func (s *Storage) XGroupDestroy(key, group string) (bool, error) {
+	defer s.lockKey(key)()
+	st, err := s.groupStream(key, false)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := st.groups[group]; !ok {
+		return false, nil
+	}
+	delete(st.groups, group)
+	s.keyChanged(key, true, 1)
+	return true, nil
+}
+
+// XGroupCreateConsumer creates the consumer name in group, and reports
+// whether it did: false if it exists already.
+func (s *Storage) XGroupCreateConsumer(key, group, name string) (bool, error) {
+	defer s.lockKey(key)()
+	st, err := s.groupStream(key, false)
+	if err != nil {
+		return false, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return false, noGroupError(key, group)
+	}
+	if _, created := g.consumer(name, nowMs()); !created {
+		return false, nil
+	}
+	s.keyChanged(key, true, 1)
+	return true, nil
+}
+
+// XGroupDelConsumer deletes the consumer name from group, and returns the
+// number of entries pending for it, which are no longer pending.
+func (s *Storage) XGroupDelConsumer(key, group, name string) (int64, error) {
+	defer s.lockKey(key)()
+	st, err := s.groupStream(key, false)
+	if err != nil {
+		return 0, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return 0, noGroupError(key, group)
+	}
+	c, ok := g.consumers[name]
+	if !ok {
+		return 0, nil
+	}
+	for id := range c.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, name)
+	s.keyChanged(key, true, 1)
+	return int64(len(c.pending)), nil
+}
+
+// XHasGroup reports whether the stream at key has the consumer group
+// group.
+func (s *Storage) XHasGroup(key, group string) (bool, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	_, ok = st.groups[group]
+	return ok, nil
+}
+
+// XReadGroup reads the stream at key as the consumer name of group,
+// created if missing, at most count entries unless count is zero or
+// negative. With newOnly, as for ">", it returns the entries never
+// delivered to the group, which become pending for the consumer unless
+// noAck is set. Otherwise it returns the pending entries of the consumer
+// with IDs greater than after, those deleted since with nil fields. The
+// boolean reports whether the consumer was created.
+func (s *Storage) XReadGroup(key, group, name string, after StreamID, newOnly bool, count int, noAck bool) ([]StreamEntry, bool, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return nil, false, nil
+	}
+	if count <= 0 {
+		count = -1
+	}
+	now := nowMs()
+	c, created := g.consumer(name, now)
+	c.seenTime = now
+	defer s.keyChanged(key, true, 1)
+	if !newOnly {
+		return st.history(g, c, after, count, now), created, nil
+	}
+
+	var entries []StreamEntry
+	start, ok := g.lastID.Next()
+	for i := st.search(start); ok && i < len(st.entries) && count != 0; i++ {
+		e := st.entries[i]
+		if g.entriesRead >= 0 && !st.hasTombstones(e.ID, MaxStreamID) {
+			g.entriesRead++
+		} else {
+			g.entriesRead = st.entriesBefore(e.ID)
+		}
+		g.lastID = e.ID
+		if !noAck {
+			g.deliver(e.ID, name, c, now)
+		}
+		entries = append(entries, e)
+		count--
+	}
+	if len(entries) > 0 {
+		c.activeTime = now
+	}
+	return entries, created, nil
+}
+
+// history returns the entries pending for consumer c of group g with IDs
+// greater than after, at most count unless count is negative, counting a
+// delivery of each one still in the stream.
+func (st *stream) history(g *consumerGroup, c *consumer, after StreamID, count int, now int64) []StreamEntry {
+	entries := []StreamEntry{}
+	for _, id := range sortedIDs(c.pending) {
+		if count == 0 {
+			break
+		}
+		if id.Compare(after) <= 0 {
+			continue
+		}
+		e := StreamEntry{ID: id}
+		if i := st.search(id); i < len(st.entries) && st.entries[i].ID == id {
+			e = st.entries[i]
+			p := g.pending[id]
+			p.deliveryTime = now
+			p.deliveryCount++
+		}
+		entries = append(entries, e)
+		count--
+	}
+	return entries
+}
+
+// XAck acknowledges the pending entries of group with the given IDs, and
+// returns the number that were pending.
+func (s *Storage) XAck(key, group string, ids ...StreamID) (int64, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return 0, nil
+	}
+	acked := int64(0)
+	for _, id := range ids {
+		if _, ok := g.pending[id]; ok {
+			g.drop(id)
+			acked++
+		}
+	}
+	s.keyChanged(key, true, int(acked))
+	return acked, nil
+}
+
+// StreamPending is a pending entry of a consumer group.
+type StreamPending struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  int64 // Unix milliseconds of the last delivery
+	DeliveryCount uint64
+}
+
+// XPendingFilter selects the pending entries XPending returns.
+type XPendingFilter struct {
+	Start, End StreamID // Range of IDs, included
+	Count      int
+	MinIdle    int64  // Milliseconds since the last delivery, at least
+	Consumer   string // Only those of this consumer, if not empty
+}
+
+// XPending returns the pending entries of group selected by f, by ID. The
+// boolean reports whether the stream and group exist.
+func (s *Storage) XPending(key, group string, f XPendingFilter) ([]StreamPending, bool, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return nil, false, nil
+	}
+	now := nowMs()
+	pending := []StreamPending{}
+	for _, id := range g.pendingIDs() {
+		if len(pending) >= f.Count {
+			break
+		}
+		p := g.pending[id]
+		if id.Compare(f.Start) < 0 || id.Compare(f.End) > 0 ||
+			now-p.deliveryTime < f.MinIdle || (f.Consumer != "" && p.consumer != f.Consumer) {
+			continue
+		}
+		pending = append(pending, g.pendingInfo(id))
+	}
+	return pending, true, nil
+}
+
+// StreamPendingSummary sums up the pending entries of a consumer group, as
+// XPENDING without a range reports them.
+type StreamPendingSummary struct {
+	Count       int
+	First, Last StreamID         // Smallest and greatest IDs
+	Consumers   []string         // Those having pending entries, by name
+	PerConsumer map[string]int64 // Number of entries pending for each
+}
+
+// XPendingSummary sums up the pending entries of group. The boolean
+// reports whether the stream and group exist.
+func (s *Storage) XPendingSummary(key, group string) (StreamPendingSummary, bool, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return StreamPendingSummary{}, false, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return StreamPendingSummary{}, false, nil
+	}
+	sum := StreamPendingSummary{Count: len(g.pending), PerConsumer: make(map[string]int64)}
+	if ids := g.pendingIDs(); len(ids) > 0 {
+		sum.First, sum.Last = ids[0], ids[len(ids)-1]
+	}
+	for _, name := range sortedNames(g.consumers) {
+		if n := len(g.consumers[name].pending); n > 0 {
+			sum.Consumers = append(sum.Consumers, name)
+			sum.PerConsumer[name] = int64(n)
+		}
+	}
+	return sum, true, nil
+}
+
+// XClaimOptions are the options of XClaim.
+type XClaimOptions struct {
+	MinIdle      int64 // Milliseconds since the last delivery, at least
+	DeliveryTime int64 // Unix milliseconds of the delivery recorded, -1 for now
+	RetryCount   int64 // Deliveries recorded, -1 to count one more
+	Force        bool  // Claim entries of the stream no consumer was delivered
+	JustID       bool  // Return only IDs, and count no delivery
+	LastID       StreamID
+	HasLastID    bool // Move the last ID of the group up to LastID
+}
+
+// StreamClaim is what XClaim or XAutoClaim did: the entries claimed, with
+// nil fields with JustID, and the pending entries they are now, the pending
+// entries dropped as they were deleted from the stream, and the state of
+// the group after.
+type StreamClaim struct {
+	Entries       []StreamEntry
+	Pending       []StreamPending
+	Deleted       []StreamID
+	Next          StreamID // XAutoClaim: the ID to scan from next, 0-0 once done
+	LastID        StreamID
+	LastIDChanged bool
+	EntriesRead   int64
+}
+
+// XClaim gives the pending entries of group with the given IDs, idle for
+// at least opts.MinIdle milliseconds, to the consumer name, created if it
+// claims any. The boolean reports whether the stream and group exist.
+func (s *Storage) XClaim(key, group, name string, ids []StreamID, opts XClaimOptions) (StreamClaim, bool, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return StreamClaim{}, false, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return StreamClaim{}, false, nil
+	}
+	now := nowMs()
+	var claim StreamClaim
+	if opts.HasLastID && opts.LastID.Compare(g.lastID) > 0 {
+		g.lastID, claim.LastIDChanged = opts.LastID, true
+	}
+	deliveryTime := now
+	if opts.DeliveryTime >= 0 && opts.DeliveryTime <= now {
+		deliveryTime = opts.DeliveryTime
+	}
+	for _, id := range ids {
+		i := st.search(id)
+		exists := i < len(st.entries) && st.entries[i].ID == id
+		p, ok := g.pending[id]
+		forced := !ok && opts.Force && exists
+		if forced {
+			// As delivered now to nobody, whatever the idle time.
+			p = &delivery{deliveryTime: now, deliveryCount: 1}
+			g.pending[id] = p
+		}
+		switch {
+		case !ok && !forced:
+			continue
+		case !exists:
+			g.drop(id)
+			claim.Deleted = append(claim.Deleted, id)
+			continue
+		case !forced && opts.MinIdle > 0 && now-p.deliveryTime < opts.MinIdle:
+			continue
+		}
+		switch {
+		case opts.RetryCount >= 0:
+			p.deliveryCount = uint64(opts.RetryCount)
+		case !opts.JustID:
+			p.deliveryCount++
+		}
+		g.claim(id, name, p, deliveryTime, now)
+		claim.add(g, st.entries[i], opts.JustID)
+	}
+	g.seen(name, now)
+	claim.LastID, claim.EntriesRead = g.lastID, g.entriesRead
+	s.keyChanged(key, true, len(claim.Entries)+len(claim.Deleted))
+	return claim, true, nil
+}
+
+// XAutoClaim gives the pending entries of group idle for at least minIdle
+// milliseconds to the consumer name, as XClaim does, scanning them from
+// the one with ID start: at most count claimed of 10 times as many looked
+// at. The boolean reports whether the stream and group exist.
+func (s *Storage) XAutoClaim(key, group, name string, minIdle int64, start StreamID, count int, justID bool) (StreamClaim, bool, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return StreamClaim{}, false, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return StreamClaim{}, false, nil
+	}
+	now := nowMs()
+	var claim StreamClaim
+	ids := g.pendingIDs()
+	i, _ := slices.BinarySearchFunc(ids, start, StreamID.Compare)
+	for attempts := 10 * count; i < len(ids) && attempts > 0 && count > 0; i++ {
+		attempts--
+		id := ids[i]
+		j := st.search(id)
+		if j == len(st.entries) || st.entries[j].ID != id {
+			g.drop(id)
+			claim.Deleted = append(claim.Deleted, id)
+			continue
+		}
+		p := g.pending[id]
+		if minIdle > 0 && now-p.deliveryTime < minIdle {
+			continue
+		}
+		if !justID {
+			p.deliveryCount++
+		}
+		g.claim(id, name, p, now, now)
+		claim.add(g, st.entries[j], justID)
+		count--
+	}
+	if i < len(ids) {
+		claim.Next = ids[i]
+	}
+	g.seen(name, now)
+	claim.LastID, claim.EntriesRead = g.lastID, g.entriesRead
+	s.keyChanged(key, true, len(claim.Entries)+len(claim.Deleted))
+	return claim, true, nil
+}
+
+// claim gives the pending entry p with ID id to the consumer name, created
+// if missing, as delivered at deliveryTime.
+func (g *consumerGroup) claim(id StreamID, name string, p *delivery, deliveryTime, now int64) {
+	if prev, ok := g.consumers[p.consumer]; ok && p.consumer != name {
+		delete(prev.pending, id)
+	}
+	c, _ := g.consumer(name, now)
+	c.pending[id] = struct{}{}
+	c.activeTime = now
+	p.consumer, p.deliveryTime = name, deliveryTime
+}
+
+// seen records an attempt of the consumer name to claim entries, if it
+// exists.
+func (g *consumerGroup) seen(name string, now int64) {
+	if c, ok := g.consumers[name]; ok {
+		c.seenTime = now
+	}
+}
+
+// drop removes the entry with ID id from the pending entries of g.
+func (g *consumerGroup) drop(id StreamID) {
+	if p, ok := g.pending[id]; ok {
+		if c, ok := g.consumers[p.consumer]; ok {
+			delete(c.pending, id)
+		}
+		delete(g.pending, id)
+	}
+}
+
+// add records the entry e of group g as claimed, without its fields if
+// justID is set.
+func (claim *StreamClaim) add(g *consumerGroup, e StreamEntry, justID bool) {
+	if justID {
+		e.Fields = nil
+	}
+	claim.Entries = append(claim.Entries, e)
+	claim.Pending = append(claim.Pending, g.pendingInfo(e.ID))
+}
+
+// sortedIDs returns the IDs keying m, by ID.
+func sortedIDs[V any](m map[StreamID]V) []StreamID {
+	ids := make([]StreamID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, StreamID.Compare)
+	return ids
+}
+
+// sortedNames returns the names keying m, sorted.
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// StreamInfo describes a stream, as XINFO STREAM reports it.
+type StreamInfo struct {
+	Length       int
+	Nodes        int // Listpacks holding the entries
+	LastID       StreamID
+	MaxDeletedID StreamID
+	FirstID      StreamID // 0-0 if the stream is empty
+	EntriesAdded uint64
+	First, Last  *StreamEntry      // Nil if the stream is empty
+	Entries      []StreamEntry     // With FULL only
+	Groups       []StreamGroupInfo // Consumers and pending entries with FULL only
+	GroupCount   int
+}
+
+// StreamGroupInfo describes a consumer group, as XINFO GROUPS reports it.
+type StreamGroupInfo struct {
+	Name         string
+	LastID       StreamID
+	EntriesRead  int64 // -1 if unknown
+	Lag          int64 // -1 if unknown
+	PendingCount int
+	Pending      []StreamPending // With FULL only
+	Consumers    []StreamConsumerInfo
+}
+
+// StreamConsumerInfo describes a consumer of a group, as XINFO CONSUMERS
+// reports it.
+type StreamConsumerInfo struct {
+	Name         string
+	SeenTime     int64 // Unix milliseconds
+	ActiveTime   int64 // Unix milliseconds, -1 if never active
+	PendingCount int
+	Pending      []StreamPending // With FULL only
+}
+
+// XInfoStream describes the stream at key. With full, it lists at most
+// count entries, and as many pending entries of each group and consumer,
+// all of them if count is zero or negative. The boolean reports whether
+// the key exists.
+func (s *Storage) XInfoStream(key string, full bool, count int) (StreamInfo, bool, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return StreamInfo{}, false, err
+	}
+	info := StreamInfo{
+		Length:       len(st.entries),
+		Nodes:        st.nodes(),
+		LastID:       st.lastID,
+		MaxDeletedID: st.maxDeletedID,
+		FirstID:      st.firstID(),
+		EntriesAdded: st.entriesAdded,
+		GroupCount:   len(st.groups),
+	}
+	if !full {
+		if n := len(st.entries); n > 0 {
+			first, last := st.entries[0], st.entries[n-1]
+			info.First, info.Last = &first, &last
+		}
+		return info, true, nil
+	}
+	if count <= 0 {
+		count = -1
+	}
+	info.Entries = slices.Clone(limit(st.entries, count))
+	for _, name := range sortedNames(st.groups) {
+		info.Groups = append(info.Groups, st.groupInfo(name, true, count))
+	}
+	return info, true, nil
+}
+
+// XInfoGroups describes the consumer groups of the stream at key, by name.
+// The boolean reports whether the key exists.
+func (s *Storage) XInfoGroups(key string) ([]StreamGroupInfo, bool, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	groups := []StreamGroupInfo{}
+	for _, name := range sortedNames(st.groups) {
+		groups = append(groups, st.groupInfo(name, false, 0))
+	}
+	return groups, true, nil
+}
+
+// XInfoConsumers describes the consumers of group, by name. The boolean
+// reports whether the key exists.
+func (s *Storage) XInfoConsumers(key, group string) ([]StreamConsumerInfo, bool, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if _, ok := st.groups[group]; !ok {
+		return nil, true, noGroupError(key, group)
+	}
+	return st.groupInfo(group, false, 0).Consumers, true, nil
+}
+
+// groupInfo describes the group name, with at most count of its pending
+// entries and of those of each consumer if full is set, all of them if
+// count is negative.
+func (st *stream) groupInfo(name string, full bool, count int) StreamGroupInfo {
+	g := st.groups[name]
+	info := StreamGroupInfo{
+		Name:         name,
+		LastID:       g.lastID,
+		EntriesRead:  g.entriesRead,
+		Lag:          st.lag(g),
+		PendingCount: len(g.pending),
+		Consumers:    []StreamConsumerInfo{},
+	}
+	if full {
+		for _, id := range limit(g.pendingIDs(), count) {
+			info.Pending = append(info.Pending, g.pendingInfo(id))
+		}
+	}
+	for _, cname := range sortedNames(g.consumers) {
+		c := g.consumers[cname]
+		ci := StreamConsumerInfo{Name: cname, SeenTime: c.seenTime, ActiveTime: c.activeTime, PendingCount: len(c.pending)}
+		if full {
+			for _, id := range limit(sortedIDs(c.pending), count) {
+				ci.Pending = append(ci.Pending, g.pendingInfo(id))
+			}
+		}
+		info.Consumers = append(info.Consumers, ci)
+	}
+	return info
+}
+
+func (g *consumerGroup) pendingInfo(id StreamID) StreamPending {
+	p := g.pending[id]
+	return StreamPending{ID: id, Consumer: p.consumer, DeliveryTime: p.deliveryTime, DeliveryCount: p.deliveryCount}
+}
+
+// limit returns the first count elements of s, all of them if count is
+// negative.
+func limit[E any](s []E, count int) []E {
+	if count >= 0 && count < len(s) {
+		return s[:count]
+	}
+	return s
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/liweiyuan/go-redis-server/internal/rdb"
+)
+
+// errStreamRDB is returned when a stream read from an RDB file is
+// malformed.
+var errStreamRDB = errors.New("rdb: invalid stream")
+
+// Flags of an entry in a listpack node of a stream.
+const (
+	streamItemDeleted    = 1 << 0 // Deleted, kept until the node is rewritten
+	streamItemSameFields = 1 << 1 // Has the fields of the master entry
+)
+
+// Serialize writes the stream as Redis 7.2 does: its entries in listpacks
+// of streamNodeMaxEntries, each keyed by the ID of its first entry, then
+// its IDs and counters, and its consumer groups with their pending
+// entries and consumers.
+func (v StreamValue) Serialize(rw *rdb.Writer, key string) {
+	rw.WriteByte(rdb.TypeStreamListpacks3)
+	rw.WriteKey(key)
+	rw.WriteLength(uint64(v.nodes()))
+	for entries := v.entries; len(entries) > 0; {
+		n := min(len(entries), streamNodeMaxEntries)
+		rw.WriteString(string(rawStreamID(entries[0].ID)))
+		rw.WriteString(string(streamNode(entries[:n])))
+		entries = entries[n:]
+	}
+	rw.WriteLength(uint64(len(v.entries)))
+	writeStreamID(rw, v.lastID)
+	writeStreamID(rw, v.firstID())
+	writeStreamID(rw, v.maxDeletedID)
+	rw.WriteLength(v.entriesAdded)
+
+	rw.WriteLength(uint64(len(v.groups)))
+	for _, name := range sortedNames(v.groups) {
+		g := v.groups[name]
+		rw.WriteString(name)
+		writeStreamID(rw, g.lastID)
+		rw.WriteLength(uint64(g.entriesRead))
+		ids := g.pendingIDs()
+		rw.WriteLength(uint64(len(ids)))
+		for _, id := range ids {
+			p := g.pending[id]
+			rw.WriteRaw(rawStreamID(id))
+			rw.WriteMillisecondTime(p.deliveryTime)
+			rw.WriteLength(p.deliveryCount)
+		}
+		rw.WriteLength(uint64(len(g.consumers)))
+		for _, cname := range sortedNames(g.consumers) {
+			c := g.consumers[cname]
+			rw.WriteString(cname)
+			rw.WriteMillisecondTime(c.seenTime)
+			rw.WriteMillisecondTime(c.activeTime)
+			ids := sortedIDs(c.pending)
+			rw.WriteLength(uint64(len(ids)))
+			for _, id := range ids {
+				rw.WriteRaw(rawStreamID(id))
+			}
+		}
+	}
+}
+
+// streamNode returns the listpack holding entries: a master entry with
+// their number, the number deleted, and the fields of the first entry,
+// then each entry with its ID relative to that of the first, its values
+// alone when it has the fields of the master entry, and its number of
+// elements so the listpack can be walked backwards.
+func streamNode(entries []StreamEntry) []byte {
+	var lp rdb.Listpack
+	master := entries[0]
+	masterFields := fieldNames(master.Fields)
+	lp.AppendInt(int64(len(entries)))
+	lp.AppendInt(0)
+	lp.AppendInt(int64(len(masterFields)))
+	for _, f := range masterFields {
+		lp.AppendString(f)
+	}
+	lp.AppendInt(0)
+	for _, e := range entries {
+		fields := fieldNames(e.Fields)
+		same := slices.Equal(fields, masterFields)
+		flags := 0
+		if same {
+			flags = streamItemSameFields
+		}
+		lp.AppendInt(int64(flags))
+		lp.AppendInt(int64(e.ID.Ms - master.ID.Ms))
+		lp.AppendInt(int64(e.ID.Seq - master.ID.Seq))
+		if same {
+			for i := 1; i < len(e.Fields); i += 2 {
+				lp.AppendString(e.Fields[i])
+			}
+			lp.AppendInt(int64(len(fields) + 3))
+			continue
+		}
+		lp.AppendInt(int64(len(fields)))
+		for _, f := range e.Fields {
+			lp.AppendString(f)
+		}
+		lp.AppendInt(int64(2*len(fields) + 4))
+	}
+	return lp.Bytes()
+}
+
+// fieldNames returns the fields of an entry without their values.
+func fieldNames(fields []string) []string {
+	names := make([]string, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		names = append(names, fields[i])
+	}
+	return names
+}
+
+// rawStreamID returns id as the 16 big-endian bytes keying a node and a
+// pending entry.
+func rawStreamID(id StreamID) []byte {
+	p := binary.BigEndian.AppendUint64(nil, id.Ms)
+	return binary.BigEndian.AppendUint64(p, id.Seq)
+}
+
+func parseRawStreamID(p []byte) (StreamID, error) {
+	if len(p) != 16 {
+		return StreamID{}, errStreamRDB
+	}
+	return StreamID{Ms: binary.BigEndian.Uint64(p), Seq: binary.BigEndian.Uint64(p[8:])}, nil
+}
+
+func writeStreamID(rw *rdb.Writer, id StreamID) {
+	rw.WriteLength(id.Ms)
+	rw.WriteLength(id.Seq)
+}
+
+func readStreamID(rr *rdb.Reader) (StreamID, error) {
+	ms, err := rr.ReadLength()
+	if err != nil {
+		return StreamID{}, err
+	}
+	seq, err := rr.ReadLength()
+	return StreamID{Ms: ms, Seq: seq}, err
+}
+
+// readStreamValue reads a stream written by Serialize, or by Redis 7.2.
+func readStreamValue(rr *rdb.Reader) (Value, error) {
+	st := newStream()
+	nodes, err := rr.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		rawID, err := rr.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		master, err := parseRawStreamID([]byte(rawID))
+		if err != nil {
+			return nil, err
+		}
+		p, err := rr.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		elems, err := rdb.ParseListpack([]byte(p))
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseStreamNode(master, elems)
+		if err != nil {
+			return nil, err
+		}
+		st.entries = append(st.entries, entries...)
+	}
+	if _, err := rr.ReadLength(); err != nil {
+		return nil, err
+	}
+	if st.lastID, err = readStreamID(rr); err != nil {
+		return nil, err
+	}
+	if _, err := readStreamID(rr); err != nil { // The first ID, known from the entries
+		return nil, err
+	}
+	if st.maxDeletedID, err = readStreamID(rr); err != nil {
+		return nil, err
+	}
+	if st.entriesAdded, err = rr.ReadLength(); err != nil {
+		return nil, err
+	}
+
+	groups, err := rr.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		name, err := rr.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		g, err := readConsumerGroup(rr)
+		if err != nil {
+			return nil, err
+		}
+		st.groups[name] = g
+	}
+	return st, nil
+}
+
+func readConsumerGroup(rr *rdb.Reader) (*consumerGroup, error) {
+	lastID, err := readStreamID(rr)
+	if err != nil {
+		return nil, err
+	}
+	entriesRead, err := rr.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	g := newConsumerGroup(lastID, int64(entriesRead))
+	n, err := rr.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		id, err := readRawStreamID(rr)
+		if err != nil {
+			return nil, err
+		}
+		p := &delivery{}
+		if p.deliveryTime, err = rr.ReadInt64(); err != nil {
+			return nil, err
+		}
+		if p.deliveryCount, err = rr.ReadLength(); err != nil {
+			return nil, err
+		}
+		g.pending[id] = p
+	}
+
+	if n, err = rr.ReadLength(); err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		name, err := rr.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		c := newConsumer(0)
+		if c.seenTime, err = rr.ReadInt64(); err != nil {
+			return nil, err
+		}
+		if c.activeTime, err = rr.ReadInt64(); err != nil {
+			return nil, err
+		}
+		pending, err := rr.ReadLength()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < pending; j++ {
+			id, err := readRawStreamID(rr)
+			if err != nil {
+				return nil, err
+			}
+			p, ok := g.pending[id]
+			if !ok {
+				return nil, errStreamRDB
+			}
+			p.consumer = name
+			c.pending[id] = struct{}{}
+		}
+		g.consumers[name] = c
+	}
+	return g, nil
+}
+
+func readRawStreamID(rr *rdb.Reader) (StreamID, error) {
+	p, err := rr.ReadRaw(16)
+	if err != nil {
+		return StreamID{}, err
+	}
+	return parseRawStreamID(p)
+}
+
+// parseStreamNode returns the entries of the listpack node keyed by master,
+// the ID of its first entry, skipping those deleted.
+func parseStreamNode(master StreamID, elems []string) ([]StreamEntry, error) {
+	next := func() (int64, error) {
+		if len(elems) == 0 {
+			return 0, errStreamRDB
+		}
+		v, err := strconv.ParseInt(elems[0], 10, 64)
+		elems = elems[1:]
+		if err != nil {
+			return 0, errStreamRDB
+		}
+		return v, nil
+	}
+	take := func(n int64) ([]string, error) {
+		if n < 0 || int64(len(elems)) < n {
+			return nil, errStreamRDB
+		}
+		s := elems[:n:n]
+		elems = elems[n:]
+		return s, nil
+	}
+
+	count, err := next()
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := next()
+	if err != nil {
+		return nil, err
+	}
+	nfields, err := next()
+	if err != nil {
+		return nil, err
+	}
+	masterFields, err := take(nfields)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := next(); err != nil { // The master entry terminator
+		return nil, err
+	}
+
+	var entries []StreamEntry
+	for i := int64(0); i < count+deleted; i++ {
+		var hdr [3]int64 // Flags, ms and seq differences
+		for j := range hdr {
+			if hdr[j], err = next(); err != nil {
+				return nil, err
+			}
+		}
+		e := StreamEntry{ID: StreamID{Ms: master.Ms + uint64(hdr[1]), Seq: master.Seq + uint64(hdr[2])}}
+		if hdr[0]&streamItemSameFields != 0 {
+			values, err := take(int64(len(masterFields)))
+			if err != nil {
+				return nil, err
+			}
+			for j, f := range masterFields {
+				e.Fields = append(e.Fields, f, values[j])
+			}
+		} else {
+			n, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if e.Fields, err = take(2 * n); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := next(); err != nil { // The number of elements
+			return nil, err
+		}
+		if hdr[0]&streamItemDeleted == 0 {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// streamNodeMaxEntries is the most entries a node of a stream holds, the
+// default stream-node-max-entries of Redis: snapshots write the entries of
+// a stream in listpacks of that many, and XINFO STREAM counts them.
+const streamNodeMaxEntries = 100
+
+// DefaultTrimLimit is the most entries approximate trimming evicts at once
+// unless told otherwise, those of 100 nodes.
+const DefaultTrimLimit = 100 * streamNodeMaxEntries
+
+var (
+	errStreamIDTooSmall  = errs.Errorf("The ID specified in XADD is equal or smaller than the target stream top item")
+	errStreamExhausted   = errs.Errorf("The stream has exhausted the last possible ID, unable to add more items")
+	errStreamKeyRequired = errs.Errorf("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	errBusyGroup         = errs.New("BUSYGROUP", "Consumer Group name already exists")
+)
+
+// StreamID is the ID of a stream entry: the Unix time in milliseconds it
+// was added at, and a sequence number telling apart the entries added in
+// the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the greatest ID, that XRANGE "+" stands for.
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ParseStreamID parses an ID given as <ms>-<seq>, or as <ms> alone, in
+// which case its sequence number is seq.
+func ParseStreamID(s string, seq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, errs.InvalidStreamID
+	}
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return StreamID{}, errs.InvalidStreamID
+		}
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare returns -1, 0 or 1 as id is smaller than, equal to or greater
+// than other.
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms != other.Ms:
+		if id.Ms < other.Ms {
+			return -1
+		}
+		return 1
+	case id.Seq != other.Seq:
+		if id.Seq < other.Seq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether id is 0-0.
+func (id StreamID) IsZero() bool {
+	return id == StreamID{}
+}
+
+// Next returns the smallest ID greater than id, false if id is the
+// greatest.
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev returns the greatest ID smaller than id, false if id is 0-0.
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// StreamEntry is an entry of a stream: its ID and its fields, each
+// followed by its value. The fields of an entry that was deleted, which
+// only a consumer's history returns, are nil.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// StreamValue is a stream: entries ordered by ID, which only grows, and the
+// consumer groups reading them. Unlike the other collections, a stream
+// stays when its last entry is deleted, keeping its last ID and groups.
+type StreamValue struct{ *stream }
+
+type stream struct {
+	entries      []StreamEntry // By ID
+	lastID       StreamID      // Of the last entry ever added
+	maxDeletedID StreamID      // Greatest ID of the entries deleted
+	entriesAdded uint64        // Entries ever added
+	groups       map[string]*consumerGroup
+}
+
+func newStream() StreamValue {
+	return StreamValue{&stream{groups: make(map[string]*consumerGroup)}}
+}
+
+func (StreamValue) Type() string { return "stream" }
+
+func (v StreamValue) Len() int { return len(v.entries) }
+
+func (v StreamValue) SizeOf() int64 {
+	var size int64
+	for _, e := range v.entries {
+		size += 16 // The ID
+		for _, f := range e.Fields {
+			size += int64(len(f))
+		}
+	}
+	return size
+}
+
+// search returns the index of the first entry whose ID is id or greater.
+func (st *stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return st.entries[i].ID.Compare(id) >= 0
+	})
+}
+
+// firstID returns the ID of the first entry, 0-0 if there is none.
+func (st *stream) firstID() StreamID {
+	if len(st.entries) == 0 {
+		return StreamID{}
+	}
+	return st.entries[0].ID
+}
+
+// nodes returns the number of nodes holding the entries, see
+// streamNodeMaxEntries.
+func (st *stream) nodes() int {
+	return (len(st.entries) + streamNodeMaxEntries - 1) / streamNodeMaxEntries
+}
+
+// XAddOptions are the options of XAdd: how the ID of the entry is chosen,
+// whether a missing stream is created, and how the stream is trimmed.
+type XAddOptions struct {
+	ID         StreamID    // Explicit ID, or its milliseconds with SeqAuto
+	Auto       bool        // Generate the ID from the clock, as "*"
+	SeqAuto    bool        // Generate the sequence number, as "<ms>-*"
+	NoMkStream bool        // Add nothing if the key is missing
+	Trim       *StreamTrim // Trim the stream once the entry is added
+}
+
+// StreamTrim is how XADD and XTRIM trim a stream: by evicting its oldest
+// entries until it holds at most MaxLen of them, or until none has an ID
+// smaller than MinID with ByMinID set. Approximate trimming only evicts
+// whole nodes of streamNodeMaxEntries, so that a capped stream is trimmed
+// once per node filled rather than on every entry added, and at most Limit
+// entries unless Limit is zero.
+type StreamTrim struct {
+	MaxLen  int64
+	MinID   StreamID
+	ByMinID bool
+	Approx  bool
+	Limit   int64
+}
+
+// XAdd appends an entry with the given fields, each followed by its value,
+// to the stream at key, creating it unless NoMkStream is set, and returns
+// its ID. The boolean reports whether it was added: false if NoMkStream
+// kept a missing stream from being created. An explicit ID must be greater
+// than that of the last entry ever added.
+func (s *Storage) XAdd(key string, opts XAddOptions, fields []string) (StreamID, bool, error) {
+	defer s.lockKey(key)()
+	actual, exists := s.load(key)
+	if !exists && opts.NoMkStream {
+		return StreamID{}, false, nil
+	}
+	st := newStream()
+	if exists {
+		var ok bool
+		if st, ok = actual.(StreamValue); !ok {
+			return StreamID{}, false, errs.WrongType
+		}
+	}
+	id, err := st.nextID(opts)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if !exists {
+		s.loadOrStore(key, st)
+	}
+	st.entries = append(st.entries, StreamEntry{ID: id, Fields: fields})
+	st.lastID = id
+	st.entriesAdded++
+	if opts.Trim != nil {
+		st.trim(*opts.Trim)
+	}
+	s.keyChanged(key, exists, 1)
+	return id, true, nil
+}
+
+// nextID returns the ID of the entry XAdd adds with opts.
+func (st *stream) nextID(opts XAddOptions) (StreamID, error) {
+	last := st.lastID
+	switch {
+	case opts.Auto:
+		if ms := uint64(nowMs()); ms > last.Ms {
+			return StreamID{Ms: ms}, nil
+		}
+		// The clock went back, or the millisecond has entries already.
+		id, ok := last.Next()
+		if !ok {
+			return StreamID{}, errStreamExhausted
+		}
+		return id, nil
+	case opts.SeqAuto:
+		switch {
+		case opts.ID.Ms > last.Ms:
+			return StreamID{Ms: opts.ID.Ms}, nil
+		case opts.ID.Ms == last.Ms && last.Seq < math.MaxUint64:
+			return StreamID{Ms: last.Ms, Seq: last.Seq + 1}, nil
+		}
+		return StreamID{}, errStreamIDTooSmall
+	}
+	if opts.ID.Compare(last) <= 0 {
+		return StreamID{}, errStreamIDTooSmall
+	}
+	return opts.ID, nil
+}
+
+// XLen returns the number of entries of the stream at key.
+func (s *Storage) XLen(key string) (int64, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return int64(len(st.entries)), nil
+}
+
+// XRange returns the entries of the stream at key whose IDs lie between
+// start and end, included, by ID, or the other way round if rev is set,
+// at most count of them unless count is negative.
+func (s *Storage) XRange(key string, start, end StreamID, count int, rev bool) ([]StreamEntry, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	lo, hi := st.search(start), len(st.entries)
+	if next, ok := end.Next(); ok {
+		hi = st.search(next)
+	}
+	if lo >= hi {
+		return nil, nil
+	}
+	n := hi - lo
+	if count >= 0 {
+		n = min(n, count)
+	}
+	entries := make([]StreamEntry, n)
+	for i := range entries {
+		if rev {
+			entries[i] = st.entries[hi-1-i]
+		} else {
+			entries[i] = st.entries[lo+i]
+		}
+	}
+	return entries, nil
+}
+
+// XRead returns the entries of the stream at key added after the entry
+// with ID after, at most count of them unless count is zero or negative.
+func (s *Storage) XRead(key string, after StreamID, count int) ([]StreamEntry, error) {
+	start, ok := after.Next()
+	if !ok {
+		return nil, nil
+	}
+	if count <= 0 {
+		count = -1
+	}
+	return s.XRange(key, start, MaxStreamID, count, false)
+}
+
+// XLastID returns the ID of the last entry ever added to the stream at
+// key, which XREAD "$" stands for, 0-0 for a missing key.
+func (s *Storage) XLastID(key string) (StreamID, error) {
+	defer s.rlockKey(key)()
+	st, ok, err := s.readStream(key)
+	if err != nil || !ok {
+		return StreamID{}, err
+	}
+	return st.lastID, nil
+}
+
+// XDel deletes the entries with the given IDs from the stream at key, and
+// returns the number deleted. The pending entries of the consumer groups
+// keep their IDs.
+func (s *Storage) XDel(key string, ids ...StreamID) (int64, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	deleted := int64(0)
+	for _, id := range ids {
+		i := st.search(id)
+		if i == len(st.entries) || st.entries[i].ID != id {
+			continue
+		}
+		st.entries = append(st.entries[:i], st.entries[i+1:]...)
+		if id.Compare(st.maxDeletedID) > 0 {
+			st.maxDeletedID = id
+		}
+		deleted++
+	}
+	s.keyChanged(key, true, int(deleted))
+	return deleted, nil
+}
+
+// XTrim trims the stream at key as t says, and returns the number of
+// entries evicted.
+func (s *Storage) XTrim(key string, t StreamTrim) (int64, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	n := st.trim(t)
+	s.keyChanged(key, true, int(n))
+	return n, nil
+}
+
+// XSetIDOptions are the options of XSetID, setting counters of the stream
+// along with its last ID, as replicas and rewritten append only files do.
+type XSetIDOptions struct {
+	EntriesAdded    int64 // -1 to leave it
+	MaxDeletedID    StreamID
+	HasMaxDeletedID bool
+}
+
+// XSetID sets the ID of the last entry ever added to the stream at key,
+// which may not be smaller than that of its last entry. The boolean reports
+// whether the key exists.
+func (s *Storage) XSetID(key string, id StreamID, opts XSetIDOptions) (bool, error) {
+	defer s.lockKey(key)()
+	st, ok, err := s.writeStream(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if n := len(st.entries); n > 0 {
+		if id.Compare(st.entries[n-1].ID) < 0 {
+			return true, errs.Errorf("The ID specified in XSETID is smaller than the target stream top item")
+		}
+		if opts.EntriesAdded >= 0 && opts.EntriesAdded < int64(n) {
+			return true, errs.Errorf("The entries_added specified in XSETID is smaller than the target stream length")
+		}
+	}
+	st.lastID = id
+	if opts.EntriesAdded >= 0 {
+		st.entriesAdded = uint64(opts.EntriesAdded)
+	}
+	if opts.HasMaxDeletedID && !opts.MaxDeletedID.IsZero() {
+		st.maxDeletedID = opts.MaxDeletedID
+	}
+	s.keyChanged(key, true, 1)
+	return true, nil
+}
+
+// trim evicts the oldest entries as t says, and returns their number. The
+// nodes are the entries taken streamNodeMaxEntries at a time from the
+// first. Unlike XDel, trimming leaves the greatest deleted ID alone: the
+// entries evicted all precede the first one left.
+func (st *stream) trim(t StreamTrim) int64 {
+	var n int
+	if t.ByMinID {
+		n = st.search(t.MinID)
+	} else if t.MaxLen < int64(len(st.entries)) {
+		n = len(st.entries) - int(t.MaxLen)
+	}
+	if t.Approx {
+		if t.Limit > 0 && int64(n) > t.Limit {
+			n = int(t.Limit)
+		}
+		n -= n % streamNodeMaxEntries
+	}
+	clear(st.entries[:n])
+	st.entries = st.entries[n:]
+	return int64(n)
+}
+
+// readStream returns the stream at key for a command reading it, counting
+// the lookup in the keyspace hits and misses.
+func (s *Storage) readStream(key string) (StreamValue, bool, error) {
+	return asStream(s.lookupRead(key))
+}
+
+// writeStream returns the stream at key for a command writing it.
+func (s *Storage) writeStream(key string) (StreamValue, bool, error) {
+	return asStream(s.load(key))
+}
+
+func asStream(actual any, ok bool) (StreamValue, bool, error) {
+	if !ok {
+		return StreamValue{}, false, nil
+	}
+	st, ok := actual.(StreamValue)
+	if !ok {
+		return StreamValue{}, false, errs.WrongType
+	}
+	return st, true, nil
+}
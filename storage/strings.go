@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// Set sets a key-value pair in the storage, clearing any expire time.
+func (s *Storage) Set(key, value string) {
+	defer s.lockKey(key)()
+	s.set(key, value)
+}
+
+// set is Set, for callers holding the lock of key.
+func (s *Storage) set(key, value string) {
+	s.preserveRemoved(key)
+	s.write(key, StringValue(value), ttlClear, "")
+}
+
+// Get retrieves the value associated with a key from the storage.
+// The boolean reports whether the key exists. If the key holds a value
+// that is not a string, an error is returned. A missing key is first
+// loaded by its loader, if any.
+func (s *Storage) Get(key string) (string, bool, error) {
+	if err := s.readThrough(key); err != nil {
+		return "", false, err
+	}
+	defer s.rlockKey(key)()
+	return stringValue(s.lookupRead(key))
+}
+
+// stringValue converts a value loaded from the map into a string.
+func stringValue(val any, ok bool) (string, bool, error) {
+	if !ok {
+		return "", false, nil
+	}
+	str, ok := val.(StringValue)
+	if !ok {
+		return "", false, errs.WrongType
+	}
+	return string(str), true, nil
+}
+
+// Incr increments the integer value of a key by 1.
+// If the key does not exist, it is set to 0 before performing the operation.
+// If the key contains a value of the wrong type, an error is returned.
+func (s *Storage) Incr(key string) (int64, error) {
+	defer s.lockKey(key)()
+	val, ok, err := stringValue(s.load(key))
+	if err != nil {
+		return 0, err
+	}
+	var num int64
+	if !ok {
+		num = 0
+	} else {
+		num, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, errs.NotInteger
+		}
+	}
+	if num == math.MaxInt64 {
+		return 0, errs.Overflow
+	}
+	num++
+	s.write(key, StringValue(strconv.FormatInt(num, 10)), ttlKeep, "")
+	return num, nil
+}
+
+// Decr decrements the integer value of a key by 1.
+// If the key does not exist, it is set to 0 before performing the operation.
+// If the key contains a value of the wrong type, an error is returned.
+func (s *Storage) Decr(key string) (int64, error) {
+	defer s.lockKey(key)()
+	val, ok, err := stringValue(s.load(key))
+	if err != nil {
+		return 0, err
+	}
+	var num int64
+	if !ok {
+		num = 0
+	} else {
+		num, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, errs.NotInteger
+		}
+	}
+	if num == math.MinInt64 {
+		return 0, errs.Overflow
+	}
+	num--
+	s.write(key, StringValue(strconv.FormatInt(num, 10)), ttlKeep, "")
+	return num, nil
+}
+
+// IncrByFloat increments the value of a key, read as a float, by incr, and
+// returns the new value, which the key holds as its shortest text. A
+// missing key counts as 0; a result that is not a finite number is an
+// error, and leaves the key as it was.
+func (s *Storage) IncrByFloat(key string, incr float64) (float64, error) {
+	defer s.lockKey(key)()
+	val, ok, err := stringValue(s.load(key))
+	if err != nil {
+		return 0, err
+	}
+	var num float64
+	if ok {
+		num, err = strconv.ParseFloat(val, 64)
+		if err != nil || math.IsNaN(num) {
+			return 0, errs.NotFloat
+		}
+	}
+	num += incr
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0, errs.Errorf("increment would produce NaN or Infinity")
+	}
+	s.write(key, StringValue(strconv.FormatFloat(num, 'f', -1, 64)), ttlKeep, "")
+	return num, nil
+}
+
+// MaxStringLength is the maximum length of a string value, matching the
+// default proto-max-bulk-len of Redis.
+const MaxStringLength = 512 * 1024 * 1024
+
+// SetRange overwrites part of the string value of key starting at offset,
+// padding it with zero bytes if it is shorter than offset. A missing key is
+// treated as an empty string, but is not created when value is empty. It
+// returns the length of the string after the change.
+func (s *Storage) SetRange(key string, offset int64, value string) (int64, error) {
+	defer s.lockKey(key)()
+	old, ok, err := stringValue(s.load(key))
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return int64(len(old)), nil
+	}
+	if offset > MaxStringLength-int64(len(value)) { // Written so offset+len cannot overflow
+		return 0, errs.StringTooLong
+	}
+	buf := []byte(old)
+	if end := int(offset) + len(value); end > len(buf) {
+		buf = append(buf, make([]byte, end-len(buf))...)
+	}
+	copy(buf[offset:], value)
+	if ok {
+		s.write(key, StringValue(buf), ttlKeep, "")
+	} else {
+		s.set(key, string(buf))
+	}
+	return int64(len(buf)), nil
+}
+
+// GetRange returns the substring of the string value of key between the
+// byte offsets start and end, both inclusive. Negative offsets count from
+// the end of the string.
+func (s *Storage) GetRange(key string, start, end int64) (string, error) {
+	defer s.rlockKey(key)()
+	val, _, err := stringValue(s.lookupRead(key))
+	if err != nil {
+		return "", err
+	}
+	n := int64(len(val))
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+	if n == 0 || start > end {
+		return "", nil
+	}
+	return val[start : end+1], nil
+}
+
+// Append appends value to the string value of key, creating the key if it
+// does not exist, and returns the length of the string after the append.
+func (s *Storage) Append(key, value string) (int64, error) {
+	defer s.lockKey(key)()
+	old, ok, err := stringValue(s.load(key))
+	if err != nil {
+		return 0, err
+	}
+	if len(old)+len(value) > MaxStringLength {
+		return 0, errs.StringTooLong
+	}
+	if ok {
+		s.write(key, StringValue(old+value), ttlKeep, "")
+	} else {
+		s.set(key, value)
+	}
+	return int64(len(old) + len(value)), nil
+}
+
+// StrLen returns the length of the string value of key, 0 if it does not
+// exist.
+func (s *Storage) StrLen(key string) (int64, error) {
+	defer s.rlockKey(key)()
+	val, _, err := stringValue(s.lookupRead(key))
+	return int64(len(val)), err
+}
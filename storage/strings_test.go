@@ -0,0 +1,101 @@
+package storage_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// keys is the number of keys SET and GET spread over.
+const keys = 10000
+
+func keyNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = "key:" + strconv.Itoa(i)
+	}
+	return names
+}
+
+// runSizes runs bench as a sub-benchmark for each size.
+func runSizes(b *testing.B, sizes []int, bench func(b *testing.B, size int)) {
+	for _, size := range sizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			bench(b, size)
+		})
+	}
+}
+
+// BenchmarkSet sets values of size bytes.
+func BenchmarkSet(b *testing.B) {
+	runSizes(b, []int{16, 1024, 16384}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		names := keyNames(keys)
+		value := strings.Repeat("x", size)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.Set(names[i%keys], value)
+		}
+	})
+}
+
+// BenchmarkGet gets values of size bytes.
+func BenchmarkGet(b *testing.B) {
+	runSizes(b, []int{16, 1024, 16384}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		names := keyNames(keys)
+		value := strings.Repeat("x", size)
+		for _, name := range names {
+			s.Set(name, value)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := s.Get(names[i%keys]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestStrings checks the string commands on missing keys, keys of another
+// type and existing strings.
+func TestStrings(t *testing.T) {
+	list := func(s *storage.Storage) { s.RPush("k", "a") }
+	str := func(s *storage.Storage) { s.Set("k", "hello") }
+	runCases(t, []storageCase{
+		wrongType("GET on a list", list, func(s *storage.Storage) (any, error) { return found(s.Get("k")) }),
+		wrongType("INCR on a list", list, func(s *storage.Storage) (any, error) { return s.Incr("k") }),
+		wrongType("DECR on a list", list, func(s *storage.Storage) (any, error) { return s.Decr("k") }),
+		wrongType("INCRBYFLOAT on a list", list, func(s *storage.Storage) (any, error) { return s.IncrByFloat("k", 1) }),
+		wrongType("SETRANGE on a list", list, func(s *storage.Storage) (any, error) { return s.SetRange("k", 0, "x") }),
+		wrongType("GETRANGE on a list", list, func(s *storage.Storage) (any, error) { return s.GetRange("k", 0, -1) }),
+		wrongType("APPEND on a list", list, func(s *storage.Storage) (any, error) { return s.Append("k", "x") }),
+		wrongType("STRLEN on a list", list, func(s *storage.Storage) (any, error) { return s.StrLen("k") }),
+
+		{name: "GET of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.Get("k")) }, want: []any{"", false}},
+		{name: "INCR of a missing key", op: func(s *storage.Storage) (any, error) { return s.Incr("k") }, want: int64(1)},
+		{name: "DECR of a missing key", op: func(s *storage.Storage) (any, error) { return s.Decr("k") }, want: int64(-1)},
+		{name: "INCRBYFLOAT of a missing key", op: func(s *storage.Storage) (any, error) { return s.IncrByFloat("k", 1.5) }, want: 1.5},
+		{name: "GETRANGE of a missing key", op: func(s *storage.Storage) (any, error) { return s.GetRange("k", 0, -1) }, want: ""},
+		{name: "STRLEN of a missing key", op: func(s *storage.Storage) (any, error) { return s.StrLen("k") }, want: int64(0)},
+		{name: "APPEND to a missing key", op: func(s *storage.Storage) (any, error) { return s.Append("k", "ab") }, want: int64(2)},
+		{name: "SETRANGE of a missing key pads it", op: func(s *storage.Storage) (any, error) {
+			if _, err := s.SetRange("k", 2, "x"); err != nil {
+				return nil, err
+			}
+			return found(s.Get("k"))
+		}, want: []any{"\x00\x00x", true}},
+		{name: "SETRANGE of an empty value creates no key", op: func(s *storage.Storage) (any, error) { return s.SetRange("k", 5, "") }, want: int64(0), gone: "k"},
+
+		{name: "INCR of a string that is not a number", setup: str, op: func(s *storage.Storage) (any, error) { return s.Incr("k") }, err: errs.NotInteger},
+		{name: "INCR past the largest integer", setup: func(s *storage.Storage) { s.Set("k", "9223372036854775807") }, op: func(s *storage.Storage) (any, error) { return s.Incr("k") }, err: errs.Overflow},
+		{name: "GETRANGE with negative offsets", setup: str, op: func(s *storage.Storage) (any, error) { return s.GetRange("k", -3, -1) }, want: "llo"},
+		{name: "GETRANGE past the end", setup: str, op: func(s *storage.Storage) (any, error) { return s.GetRange("k", 10, 20) }, want: ""},
+		{name: "APPEND to a string", setup: str, op: func(s *storage.Storage) (any, error) { return s.Append("k", " world") }, want: int64(11)},
+		{name: "SETRANGE past the largest string", setup: str, op: func(s *storage.Storage) (any, error) { return s.SetRange("k", storage.MaxStringLength, "x") }, err: errs.StringTooLong},
+	})
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"container/list"
+
+	"github.com/liweiyuan/go-redis-server/internal/rdb"
+)
+
+// Value is the value of a key. Each type of value implements it, so the
+// code handling values of any type, such as snapshots, the rewrite of the
+// append only file and memory reports, does not need to know them all;
+// commands assert the type they operate on.
+type Value interface {
+	// Type returns the name of the type, as TYPE reports it.
+	Type() string
+	// Len returns the number of elements, or the length of a string.
+	Len() int
+	// SizeOf returns the bytes of the strings the value holds, scores
+	// included.
+	SizeOf() int64
+	// Serialize writes key holding the value to rw, in the RDB format.
+	Serialize(rw *rdb.Writer, key string)
+
+	// clone returns a copy that later writes to the value do not modify.
+	clone() Value
+	// rewrite calls emit with the commands that create key holding the
+	// value.
+	rewrite(key string, emit func(argv []string) error) error
+	// export sets the type and value of e.
+	export(e *Entry)
+}
+
+// StringValue is a string.
+type StringValue string
+
+// ListValue is a list of strings.
+type ListValue struct{ *list.List }
+
+// SetValue is a set, its members being the keys of the map.
+type SetValue map[string]struct{}
+
+// HashValue is a hash, mapping fields to values.
+type HashValue map[string]string
+
+// ZSetValue is a sorted set, mapping members to themselves with their
+// score.
+type ZSetValue map[string]ZSetMember
+
+func newList() ListValue { return ListValue{list.New()} }
+
+func (StringValue) Type() string { return "string" }
+func (ListValue) Type() string   { return "list" }
+func (SetValue) Type() string    { return "set" }
+func (HashValue) Type() string   { return "hash" }
+func (ZSetValue) Type() string   { return "zset" }
+
+func (v StringValue) Len() int { return len(v) }
+func (v SetValue) Len() int    { return len(v) }
+func (v HashValue) Len() int   { return len(v) }
+func (v ZSetValue) Len() int   { return len(v) }
+
+func (v StringValue) SizeOf() int64 { return int64(len(v)) }
+
+func (v ListValue) SizeOf() int64 {
+	var size int64
+	for e := v.Front(); e != nil; e = e.Next() {
+		size += int64(len(e.Value.(string)))
+	}
+	return size
+}
+
+func (v SetValue) SizeOf() int64 {
+	var size int64
+	for member := range v {
+		size += int64(len(member))
+	}
+	return size
+}
+
+func (v HashValue) SizeOf() int64 {
+	var size int64
+	for field, value := range v {
+		size += int64(len(field) + len(value))
+	}
+	return size
+}
+
+func (v ZSetValue) SizeOf() int64 {
+	var size int64
+	for member := range v {
+		size += int64(len(member)) + 8 // The score is a float64
+	}
+	return size
+}
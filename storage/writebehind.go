@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/liweiyuan/go-redis-server/internal/glob"
+)
+
+// WriteBehind passes the keys matching a pattern to a function once they
+// are written, on a goroutine of its own, so that the function can write
+// them through to an external store, such as the database a server
+// embedded as a cache sits in front of, without slowing commands down.
+// Writes to a key made before the function gets to it are coalesced: the
+// function is called once, with the value the key holds by then.
+type WriteBehind struct {
+	s       *Storage
+	pattern string
+	f       func(key string, e Entry, ok bool)
+	cancel  func()
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	order   []string // Pending keys in the order of their first write
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// WriteBehind starts calling f with the keys matching the glob-style
+// pattern after each write to them, until Close. ok is false when the key
+// was deleted or expired, and e is then empty. f runs on a single
+// goroutine, one key at a time, and may use the storage.
+func (s *Storage) WriteBehind(pattern string, f func(key string, e Entry, ok bool)) *WriteBehind {
+	w := &WriteBehind{
+		s:       s,
+		pattern: pattern,
+		f:       f,
+		pending: make(map[string]struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.cancel = s.Subscribe(w.record)
+	go w.run()
+	return w
+}
+
+// record queues the key of e if it matches the pattern.
+func (w *WriteBehind) record(e KeyEvent) {
+	if !glob.Match(w.pattern, e.Key) {
+		return
+	}
+	w.mu.Lock()
+	if _, ok := w.pending[e.Key]; !ok {
+		w.pending[e.Key] = struct{}{}
+		w.order = append(w.order, e.Key)
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *WriteBehind) run() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.wake:
+			w.flush()
+		case <-w.stop:
+			w.flush()
+			return
+		}
+	}
+}
+
+// flush calls f with the keys queued so far.
+func (w *WriteBehind) flush() {
+	w.mu.Lock()
+	keys := w.order
+	w.order = nil
+	w.mu.Unlock()
+
+	for _, key := range keys {
+		// A write from now on queues the key again.
+		w.mu.Lock()
+		delete(w.pending, key)
+		w.mu.Unlock()
+		e, ok := w.s.entry(key)
+		w.f(key, e, ok)
+	}
+}
+
+// Pending returns the number of keys waiting for f.
+func (w *WriteBehind) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// Close stops queueing writes and returns once f was called with the keys
+// already queued.
+func (w *WriteBehind) Close() {
+	w.cancel()
+	close(w.stop)
+	<-w.done
+}
+
+// entry returns a copy of the value of key as an Entry, and reports
+// whether the key exists. The copy is taken under the lock every write to
+// the key holds, so f never sees a value being changed.
+func (s *Storage) entry(key string) (Entry, bool) {
+	defer s.rlockKey(key)()
+	if s.expireIfNeeded(key) {
+		return Entry{}, false
+	}
+	sh := s.shard(key)
+	val, ok := sh.data.Load(key)
+	if !ok {
+		return Entry{}, false
+	}
+	expireAt := int64(-1)
+	if at, ok := sh.expires.Load(key); ok {
+		expireAt = at.(int64)
+	}
+	return newEntry(key, val.(Value), expireAt), true
+}
@@ -0,0 +1,52 @@
+package storage_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+// TestWriteBehindCopiesContainers writes to a set, a list and a sorted set
+// while the write-behind goroutine copies them, for the race detector to
+// check the copies against the writes, and checks that the last copy of
+// each key holds every write.
+func TestWriteBehindCopiesContainers(t *testing.T) {
+	const writes = 500
+	s := storage.NewStorage()
+	var mu sync.Mutex
+	last := make(map[string]storage.Entry)
+	w := s.WriteBehind("*", func(key string, e storage.Entry, ok bool) {
+		mu.Lock()
+		last[key] = e
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for _, write := range []func(i int){
+		func(i int) { s.SAdd("set", strconv.Itoa(i)) },
+		func(i int) { s.RPush("list", strconv.Itoa(i)) },
+		func(i int) { s.ZAdd("zset", storage.ZSetMember{Member: strconv.Itoa(i), Score: float64(i)}) },
+	} {
+		wg.Add(1)
+		go func(write func(i int)) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				write(i)
+			}
+		}(write)
+	}
+	wg.Wait()
+	w.Close()
+
+	if n := len(last["set"].Elements); n != writes {
+		t.Errorf("set: got %d members, want %d", n, writes)
+	}
+	if n := len(last["list"].Elements); n != writes {
+		t.Errorf("list: got %d elements, want %d", n, writes)
+	}
+	if n := len(last["zset"].Members); n != writes {
+		t.Errorf("zset: got %d members, want %d", n, writes)
+	}
+}
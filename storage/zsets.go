@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/liweiyuan/go-redis-server/internal/errs"
+)
+
+// ZSetMember represents a member in a sorted set with its score.
+type ZSetMember struct {
+	Member string
+	Score  float64
+}
+
+// ZAddOptions are the options of ZAddWithOptions.
+type ZAddOptions struct {
+	NX bool // Only add new members, never update existing ones
+	XX bool // Only update existing members, never add new ones
+	GT bool // Only update existing members to a greater score
+	LT bool // Only update existing members to a lower score
+	CH bool // Count the members whose score changed along with those added
+}
+
+// ZAdd adds all the specified members with the specified scores to the sorted set stored at key,
+// and returns the number of members added, not counting those whose score was updated.
+// If a member is already a member of the sorted set, its score is updated, and the element is reinserted
+// at the correct position to ensure the correct ordering.
+func (s *Storage) ZAdd(key string, members ...ZSetMember) (int64, error) {
+	return s.ZAddWithOptions(key, ZAddOptions{}, members...)
+}
+
+// ZAddWithOptions adds members to the sorted set stored at key as ZAdd
+// does. With NX it leaves existing members alone, with XX it adds no new
+// ones, not even creating the key, with GT or LT it only updates a member
+// to a greater or lower score, and with CH the count it returns includes
+// the members whose score changed.
+func (s *Storage) ZAddWithOptions(key string, opts ZAddOptions, members ...ZSetMember) (int64, error) {
+	defer s.lockKey(key)()
+	if opts.XX {
+		actual, ok := s.load(key)
+		if !ok {
+			return 0, nil
+		}
+		if _, ok := actual.(ZSetValue); !ok {
+			return 0, errs.WrongType
+		}
+	}
+	actual, loaded := s.loadOrStore(key, ZSetValue{})
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+
+	added, updated := int64(0), int64(0)
+	for _, member := range members {
+		existingMember, found := zset[member.Member]
+		switch {
+		case found && opts.NX, !found && opts.XX:
+			continue
+		case found && opts.GT && member.Score <= existingMember.Score,
+			found && opts.LT && member.Score >= existingMember.Score:
+			continue
+		case !found:
+			added++
+		case existingMember.Score != member.Score:
+			updated++
+		default:
+			continue
+		}
+		zset[member.Member] = member
+	}
+	s.keyChanged(key, loaded, int(added+updated))
+	if opts.CH {
+		return added + updated, nil
+	}
+	return added, nil
+}
+
+// ZScore returns the score of member in the sorted set at key.
+// If member does not exist in the sorted set, or key does not exist, nil is returned.
+func (s *Storage) ZScore(key, member string) (float64, bool, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		zset, ok := actual.(ZSetValue)
+		if !ok {
+			return 0, false, errs.WrongType
+		}
+		if zMember, found := zset[member]; found {
+			return zMember.Score, true, nil
+		}
+		return 0, false, nil // Member not found
+	}
+	return 0, false, nil // Key not found
+}
+
+// ZRem removes the specified members from the sorted set stored at key.
+// Non existing members are ignored.
+// If key does not exist, it is treated as an empty sorted set and this command returns 0.
+// If the key holds a value of another type, an error is returned.
+func (s *Storage) ZRem(key string, members ...string) (int64, error) {
+	defer s.lockKey(key)()
+	if actual, ok := s.load(key); ok {
+		zset, ok := actual.(ZSetValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		removedCount := int64(0)
+		for _, member := range members {
+			if _, found := zset[member]; found {
+				delete(zset, member)
+				removedCount++
+			}
+		}
+		s.deleteIfEmpty(key, zset)
+		s.keyChanged(key, true, int(removedCount))
+		return removedCount, nil
+	}
+	return 0, nil // Key not found, so no members removed
+}
+
+// ZCard returns the number of elements in the sorted set at key.
+func (s *Storage) ZCard(key string) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		zset, ok := actual.(ZSetValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+		return int64(len(zset)), nil
+	}
+	return 0, nil // Key not found, so sorted set is empty
+}
+
+// ScoreBound is one end of a range of scores, which includes the score
+// itself unless Exclusive, as in "(1.5".
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+// inScoreRange reports whether score lies between min and max.
+func inScoreRange(score float64, min, max ScoreBound) bool {
+	return (score > min.Score || score == min.Score && !min.Exclusive) &&
+		(score < max.Score || score == max.Score && !max.Exclusive)
+}
+
+// sortedMembers returns the members of zset ordered from low to high
+// scores, members with the same score in lexicographical order, or the
+// reverse when rev is set.
+func sortedMembers(zset map[string]ZSetMember, rev bool) []ZSetMember {
+	members := make([]ZSetMember, 0, len(zset))
+	for _, member := range zset {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if rev {
+			a, b = b, a
+		}
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		return a.Member < b.Member
+	})
+	return members
+}
+
+// ZRange returns the members of the sorted set at key between the ranks
+// start and stop, both inclusive, ordered from low to high scores or from
+// high to low when rev is set. Negative ranks count from the end.
+func (s *Storage) ZRange(key string, start, stop int64, rev bool) ([]ZSetMember, error) {
+	defer s.rlockKey(key)()
+	actual, ok := s.lookupRead(key)
+	if !ok {
+		return nil, nil // Key not found, return empty list
+	}
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return nil, errs.WrongType
+	}
+	members := sortedMembers(zset, rev)
+	start, stop, ok = rankRange(int64(len(members)), start, stop)
+	if !ok {
+		return nil, nil // Empty list or invalid range
+	}
+	return members[start : stop+1], nil
+}
+
+// rankRange returns the ranks start and stop of a sorted set of length
+// members, negative ones counting from the end, clamped to its members, and
+// reports whether the range holds any.
+func rankRange(length, start, stop int64) (int64, int64, bool) {
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, start <= stop
+}
+
+// ZRemRangeByRank removes the members of the sorted set at key between the
+// ranks start and stop, both inclusive, as ZRange counts them, and returns
+// the number removed. The key is deleted with its last member.
+func (s *Storage) ZRemRangeByRank(key string, start, stop int64) (int64, error) {
+	defer s.lockKey(key)()
+	actual, ok := s.load(key)
+	if !ok {
+		return 0, nil
+	}
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+	members := sortedMembers(zset, false)
+	start, stop, ok = rankRange(int64(len(members)), start, stop)
+	if !ok {
+		return 0, nil
+	}
+	for _, m := range members[start : stop+1] {
+		delete(zset, m.Member)
+	}
+	removed := stop - start + 1
+	s.deleteIfEmpty(key, zset)
+	s.keyChanged(key, true, int(removed))
+	return removed, nil
+}
+
+// ZRemRangeByScore removes the members of the sorted set at key with a
+// score between min and max, and returns the number removed. The key is
+// deleted with its last member.
+func (s *Storage) ZRemRangeByScore(key string, min, max ScoreBound) (int64, error) {
+	defer s.lockKey(key)()
+	actual, ok := s.load(key)
+	if !ok {
+		return 0, nil
+	}
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+	removed := int64(0)
+	for member, m := range zset {
+		if inScoreRange(m.Score, min, max) {
+			delete(zset, member)
+			removed++
+		}
+	}
+	s.deleteIfEmpty(key, zset)
+	s.keyChanged(key, true, int(removed))
+	return removed, nil
+}
+
+// ZRangeByScore returns the members of the sorted set at key with a score
+// between min and max, ordered from low to high scores or from high to low
+// when rev is set. The first offset members are skipped and at most count
+// returned, all of them if count is negative.
+func (s *Storage) ZRangeByScore(key string, min, max ScoreBound, rev bool, offset, count int64) ([]ZSetMember, error) {
+	defer s.rlockKey(key)()
+	actual, ok := s.lookupRead(key)
+	if !ok {
+		return nil, nil // Key not found, return empty list
+	}
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return nil, errs.WrongType
+	}
+	var members []ZSetMember
+	for _, m := range sortedMembers(zset, rev) {
+		if inScoreRange(m.Score, min, max) {
+			members = append(members, m)
+		}
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= int64(len(members)) {
+		return nil, nil
+	}
+	members = members[offset:]
+	if count >= 0 && count < int64(len(members)) {
+		members = members[:count]
+	}
+	return members, nil
+}
+
+// ZCount returns the number of elements in the sorted set at key with a
+// score between min and max.
+func (s *Storage) ZCount(key string, min, max ScoreBound) (int64, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		zset, ok := actual.(ZSetValue)
+		if !ok {
+			return 0, errs.WrongType
+		}
+
+		count := int64(0)
+		for _, member := range zset {
+			if inScoreRange(member.Score, min, max) {
+				count++
+			}
+		}
+		return count, nil
+	}
+	return 0, nil // Key not found, count is 0
+}
+
+// ZIncrBy increments the score of member in the sorted set at key by increment.
+// If member does not exist in the sorted set, it is added with increment as its score (a new sorted set if key does not exist).
+// If the key holds a value of another type, an error is returned.
+func (s *Storage) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	defer s.lockKey(key)()
+	actual, loaded := s.loadOrStore(key, ZSetValue{})
+	zset, ok := actual.(ZSetValue)
+	if !ok {
+		return 0, errs.WrongType
+	}
+
+	currentMember, found := zset[member]
+	newScore := increment
+	if found {
+		newScore = currentMember.Score + increment
+	}
+	zset[member] = ZSetMember{Member: member, Score: newScore}
+	s.keyChanged(key, loaded, 1)
+	return newScore, nil
+}
+
+// ZRank returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
+// The rank (or index) is 0-based, so the member with the lowest score has rank 0.
+// If member does not exist in the sorted set, nil is returned.
+func (s *Storage) ZRank(key, member string) (int64, bool, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		zset, ok := actual.(ZSetValue)
+		if !ok {
+			return 0, false, errs.WrongType
+		}
+
+		// Check if member exists
+		if _, found := zset[member]; !found {
+			return 0, false, nil
+		}
+
+		// Convert map to slice for sorting
+		members := make([]ZSetMember, 0, len(zset))
+		for _, m := range zset {
+			members = append(members, m)
+		}
+
+		// Sort by score, then by member string for ties
+		sort.Slice(members, func(i, j int) bool {
+			if members[i].Score != members[j].Score {
+				return members[i].Score < members[j].Score
+			}
+			return members[i].Member < members[j].Member
+		})
+
+		for i, m := range members {
+			if m.Member == member {
+				return int64(i), true, nil
+			}
+		}
+	}
+	return 0, false, nil // Should not reach here if member was found initially
+}
+
+// ZRevRank returns the rank of member in the sorted set stored at key, with the scores ordered from high to low.
+// The rank (or index) is 0-based, so the member with the highest score has rank 0.
+// If member does not exist in the sorted set, nil is returned.
+func (s *Storage) ZRevRank(key, member string) (int64, bool, error) {
+	defer s.rlockKey(key)()
+	if actual, ok := s.lookupRead(key); ok {
+		zset, ok := actual.(ZSetValue)
+		if !ok {
+			return 0, false, errs.WrongType
+		}
+
+		// Check if member exists
+		if _, found := zset[member]; !found {
+			return 0, false, nil
+		}
+
+		// Convert map to slice for sorting
+		members := make([]ZSetMember, 0, len(zset))
+		for _, m := range zset {
+			members = append(members, m)
+		}
+
+		// Sort by score in descending order, then by member string for ties
+		sort.Slice(members, func(i, j int) bool {
+			if members[i].Score != members[j].Score {
+				return members[i].Score > members[j].Score // Descending order
+			}
+			return members[i].Member < members[j].Member // Ascending for ties
+		})
+
+		for i, m := range members {
+			if m.Member == member {
+				return int64(i), true, nil
+			}
+		}
+	}
+	return 0, false, nil // Should not reach here if member was found initially
+}
@@ -0,0 +1,123 @@
+package storage_test
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/liweiyuan/go-redis-server/storage"
+)
+
+func zsetMembers(n int) []storage.ZSetMember {
+	members := make([]storage.ZSetMember, n)
+	for i := range members {
+		members[i] = storage.ZSetMember{Member: "m" + strconv.Itoa(i), Score: float64(i * 7 % n)}
+	}
+	return members
+}
+
+// BenchmarkZAdd updates the scores of the members of a sorted set of size
+// members.
+func BenchmarkZAdd(b *testing.B) {
+	runSizes(b, []int{10, 1000, 100000}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		s.ZAdd("zset", zsetMembers(size)...)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m := storage.ZSetMember{Member: "m" + strconv.Itoa(i%size), Score: float64(i)}
+			if _, err := s.ZAdd("zset", m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkZRange reads a whole sorted set of size members, with their
+// scores.
+func BenchmarkZRange(b *testing.B) {
+	runSizes(b, []int{10, 100, 1000}, func(b *testing.B, size int) {
+		s := storage.NewStorage()
+		s.ZAdd("zset", zsetMembers(size)...)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.ZRange("zset", 0, -1, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestZSets checks the sorted set commands on missing keys, keys of another
+// type and sorted sets, and that a sorted set is deleted with its last
+// member.
+func TestZSets(t *testing.T) {
+	str := func(s *storage.Storage) { s.Set("k", "v") }
+	zset := func(s *storage.Storage) {
+		s.ZAdd("k", storage.ZSetMember{Member: "a", Score: 1}, storage.ZSetMember{Member: "b", Score: 2})
+	}
+	all := storage.ScoreBound{Score: math.Inf(-1)}
+	top := storage.ScoreBound{Score: math.Inf(1)}
+	runCases(t, []storageCase{
+		wrongType("ZADD on a string", str, func(s *storage.Storage) (any, error) { return s.ZAdd("k", storage.ZSetMember{Member: "a"}) }),
+		wrongType("ZADD XX on a string", str, func(s *storage.Storage) (any, error) {
+			return s.ZAddWithOptions("k", storage.ZAddOptions{XX: true}, storage.ZSetMember{Member: "a"})
+		}),
+		wrongType("ZSCORE on a string", str, func(s *storage.Storage) (any, error) { return found(s.ZScore("k", "a")) }),
+		wrongType("ZREM on a string", str, func(s *storage.Storage) (any, error) { return s.ZRem("k", "a") }),
+		wrongType("ZCARD on a string", str, func(s *storage.Storage) (any, error) { return s.ZCard("k") }),
+		wrongType("ZRANGE on a string", str, func(s *storage.Storage) (any, error) { return s.ZRange("k", 0, -1, false) }),
+		wrongType("ZRANGEBYSCORE on a string", str, func(s *storage.Storage) (any, error) { return s.ZRangeByScore("k", all, top, false, 0, -1) }),
+		wrongType("ZCOUNT on a string", str, func(s *storage.Storage) (any, error) { return s.ZCount("k", all, top) }),
+		wrongType("ZINCRBY on a string", str, func(s *storage.Storage) (any, error) { return s.ZIncrBy("k", 1, "a") }),
+		wrongType("ZRANK on a string", str, func(s *storage.Storage) (any, error) { return found(s.ZRank("k", "a")) }),
+		wrongType("ZREVRANK on a string", str, func(s *storage.Storage) (any, error) { return found(s.ZRevRank("k", "a")) }),
+		wrongType("ZREMRANGEBYRANK on a string", str, func(s *storage.Storage) (any, error) { return s.ZRemRangeByRank("k", 0, -1) }),
+		wrongType("ZREMRANGEBYSCORE on a string", str, func(s *storage.Storage) (any, error) { return s.ZRemRangeByScore("k", all, top) }),
+
+		{name: "ZADD XX to a missing key", op: func(s *storage.Storage) (any, error) {
+			return s.ZAddWithOptions("k", storage.ZAddOptions{XX: true}, storage.ZSetMember{Member: "a"})
+		}, want: int64(0), gone: "k"},
+		{name: "ZSCORE of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.ZScore("k", "a")) }, want: []any{0.0, false}},
+		{name: "ZREM from a missing key", op: func(s *storage.Storage) (any, error) { return s.ZRem("k", "a") }, want: int64(0)},
+		{name: "ZCARD of a missing key", op: func(s *storage.Storage) (any, error) { return s.ZCard("k") }, want: int64(0)},
+		{name: "ZRANGE of a missing key", op: func(s *storage.Storage) (any, error) { return s.ZRange("k", 0, -1, false) }, want: []storage.ZSetMember(nil)},
+		{name: "ZCOUNT of a missing key", op: func(s *storage.Storage) (any, error) { return s.ZCount("k", all, top) }, want: int64(0)},
+		{name: "ZRANK of a missing key", op: func(s *storage.Storage) (any, error) { return found(s.ZRank("k", "a")) }, want: []any{int64(0), false}},
+		{name: "ZREMRANGEBYRANK of a missing key", op: func(s *storage.Storage) (any, error) { return s.ZRemRangeByRank("k", 0, -1) }, want: int64(0)},
+		{name: "ZREMRANGEBYSCORE of a missing key", op: func(s *storage.Storage) (any, error) { return s.ZRemRangeByScore("k", all, top) }, want: int64(0)},
+		{name: "ZINCRBY of a missing key", op: func(s *storage.Storage) (any, error) { return s.ZIncrBy("k", 2.5, "a") }, want: 2.5},
+
+		{name: "ZADD CH counts changed scores", setup: zset, op: func(s *storage.Storage) (any, error) {
+			return s.ZAddWithOptions("k", storage.ZAddOptions{CH: true}, storage.ZSetMember{Member: "a", Score: 5}, storage.ZSetMember{Member: "c", Score: 3})
+		}, want: int64(2)},
+		{name: "ZADD GT only raises scores, and adds members", setup: zset, op: func(s *storage.Storage) (any, error) {
+			if _, err := s.ZAddWithOptions("k", storage.ZAddOptions{GT: true}, storage.ZSetMember{Member: "a", Score: 0}, storage.ZSetMember{Member: "b", Score: 5}, storage.ZSetMember{Member: "c", Score: 3}); err != nil {
+				return nil, err
+			}
+			return s.ZRange("k", 0, -1, false)
+		}, want: []storage.ZSetMember{{Member: "a", Score: 1}, {Member: "c", Score: 3}, {Member: "b", Score: 5}}},
+		{name: "ZADD LT CH counts lowered scores only", setup: zset, op: func(s *storage.Storage) (any, error) {
+			return s.ZAddWithOptions("k", storage.ZAddOptions{LT: true, CH: true}, storage.ZSetMember{Member: "a", Score: 0}, storage.ZSetMember{Member: "b", Score: 5})
+		}, want: int64(1)},
+		{name: "ZRANGE in reverse", setup: zset, op: func(s *storage.Storage) (any, error) { return s.ZRange("k", 0, 0, true) }, want: []storage.ZSetMember{{Member: "b", Score: 2}}},
+		{name: "ZRANGEBYSCORE with an exclusive bound", setup: zset, op: func(s *storage.Storage) (any, error) {
+			return s.ZRangeByScore("k", storage.ScoreBound{Score: 1, Exclusive: true}, top, false, 0, -1)
+		}, want: []storage.ZSetMember{{Member: "b", Score: 2}}},
+		{name: "ZREVRANK of the lowest member", setup: zset, op: func(s *storage.Storage) (any, error) { return found(s.ZRevRank("k", "a")) }, want: []any{int64(1), true}},
+
+		{name: "ZREMRANGEBYRANK from the tail", setup: zset, op: func(s *storage.Storage) (any, error) {
+			if _, err := s.ZRemRangeByRank("k", -1, -1); err != nil {
+				return nil, err
+			}
+			return s.ZRange("k", 0, -1, false)
+		}, want: []storage.ZSetMember{{Member: "a", Score: 1}}},
+		{name: "ZREMRANGEBYRANK of an empty range", setup: zset, op: func(s *storage.Storage) (any, error) { return s.ZRemRangeByRank("k", 1, 0) }, want: int64(0)},
+		{name: "ZREMRANGEBYSCORE with an exclusive bound", setup: zset, op: func(s *storage.Storage) (any, error) {
+			return s.ZRemRangeByScore("k", storage.ScoreBound{Score: 1, Exclusive: true}, top)
+		}, want: int64(1)},
+
+		{name: "ZREM of every member", setup: zset, op: func(s *storage.Storage) (any, error) { return s.ZRem("k", "a", "b") }, want: int64(2), gone: "k"},
+		{name: "ZREMRANGEBYRANK of every member", setup: zset, op: func(s *storage.Storage) (any, error) { return s.ZRemRangeByRank("k", 0, -1) }, want: int64(2), gone: "k"},
+		{name: "ZREMRANGEBYSCORE of every member", setup: zset, op: func(s *storage.Storage) (any, error) { return s.ZRemRangeByScore("k", all, top) }, want: int64(2), gone: "k"},
+	})
+}